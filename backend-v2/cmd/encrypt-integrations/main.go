@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+
+	"backend-v2/internal/config"
+	"backend-v2/internal/database"
+	"backend-v2/internal/models"
+	integrationRepo "backend-v2/internal/repositories/integration"
+
+	"github.com/qiniu/qmgo"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+/*
+encrypt-integrations encrypts plaintext provider API keys in the integrations collection
+and re-wraps data keys under the active master key after a rotation.
+It is idempotent: documents already sealed under the active key are skipped.
+
+The Node backend reads and writes the same documents, sealing and opening keys with the same keyring
+(backend/src/controllers/utils/integrationSecrets.js). Deploy it with the same
+INTEGRATION_ENCRYPTION_KEYS before running this command, or its commands lose their API keys.
+
+Rotation: prepend the new key to INTEGRATION_ENCRYPTION_KEYS (keeping the old one) on both
+backends, run this command, then drop the old key once it reports no remaining updates.
+*/
+func main() {
+	dryRun := flag.Bool("dry-run", false, "Report documents that would change without writing")
+	flag.Parse()
+
+	secrets, err := integrationRepo.NewSecretsFromConfig()
+	if err != nil {
+		log.Fatalf("Invalid INTEGRATION_ENCRYPTION_KEYS: %v", err)
+	}
+	if !secrets.Enabled() {
+		log.Fatalf("INTEGRATION_ENCRYPTION_KEYS is not set - nothing to encrypt with")
+	}
+
+	db := database.Connect(config.MongoURI, config.MongoDatabase)
+	defer database.Disconnect()
+
+	ctx := context.Background()
+	collection := db.Collection("integrations")
+
+	var integrations []models.Integration
+	if err := collection.Find(ctx, bson.M{}).All(&integrations); err != nil {
+		log.Fatalf("Failed to load integrations: %v", err)
+	}
+
+	updated, failed := 0, 0
+	for i := range integrations {
+		doc := &integrations[i]
+
+		set, err := secrets.SealDocument(doc)
+		if err != nil {
+			log.Printf("✗ user %s: %v", doc.UserID, err)
+			failed++
+			continue
+		}
+		if len(set) == 0 {
+			continue
+		}
+
+		if *dryRun {
+			fmt.Printf("→ would update user %s (%d fields)\n", doc.UserID, len(set))
+			updated++
+			continue
+		}
+
+		/* The server may be sealing keys into this document too; agree on its data key first */
+		if doc.Encryption == nil {
+			if err := secrets.EnsureDataKey(ctx, collection, doc); err != nil {
+				log.Printf("✗ user %s: %v", doc.UserID, err)
+				failed++
+				continue
+			}
+			if set, err = secrets.SealDocument(doc); err != nil {
+				log.Printf("✗ user %s: %v", doc.UserID, err)
+				failed++
+				continue
+			}
+		}
+
+		/* A key saved since the read wins; the next run seals it */
+		err = collection.UpdateOne(ctx, integrationRepo.SealFilter(doc, set), bson.M{"$set": set})
+		if errors.Is(err, qmgo.ErrNoSuchDocuments) {
+			log.Printf("✗ user %s: changed while encrypting", doc.UserID)
+			failed++
+			continue
+		}
+		if err != nil {
+			log.Printf("✗ user %s: %v", doc.UserID, err)
+			failed++
+			continue
+		}
+		updated++
+	}
+
+	fmt.Printf("✓ %d of %d integrations updated, %d failed\n", updated, len(integrations), failed)
+	if failed > 0 {
+		log.Fatalf("Encryption incomplete - rerun after fixing the failures above")
+	}
+}
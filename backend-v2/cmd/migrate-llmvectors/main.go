@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+
+	"backend-v2/internal/config"
+	"backend-v2/internal/database"
+	"backend-v2/internal/models"
+	"backend-v2/internal/modules/llmvector"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+/*
+migrate-llmvectors moves vectors out of the nested store of llmvectors documents into one
+llmvectorchunks document per vector. It is idempotent: migrated contexts have no store left,
+and a context interrupted mid-way is redone from its store on the next run. It then records
+the content hash of vectors written without one, which appends match duplicates on.
+
+Unmigrated contexts keep working - reads merge the nested store and writes migrate the
+context first - so this can run while the service is up.
+*/
+func main() {
+	dryRun := flag.Bool("dry-run", false, "Report contexts that would be migrated without writing")
+	flag.Parse()
+
+	db := database.Connect(config.MongoURI, config.MongoDatabase)
+	defer database.Disconnect()
+
+	ctx := context.Background()
+	service := llmvector.NewService(db, nil)
+
+	cursor := db.Collection("llmvectors").Find(ctx, bson.M{"store": bson.M{"$exists": true}}).Cursor()
+	defer cursor.Close()
+
+	migrated, vectors, failed := 0, 0, 0
+	var header models.LLMVector
+	for cursor.Next(&header) {
+		if *dryRun {
+			count := 0
+			for _, typeStore := range header.Store {
+				for _, source := range typeStore {
+					count += len(source)
+				}
+			}
+			fmt.Printf("→ would migrate context %s of user %s (%d vectors)\n", header.ID.Hex(), header.UserID, count)
+			migrated++
+			vectors += count
+		} else if moved, err := service.Migrate(ctx, &header); err != nil {
+			log.Printf("✗ context %s of user %s: %v", header.ID.Hex(), header.UserID, err)
+			failed++
+		} else {
+			migrated++
+			vectors += moved
+		}
+		header = models.LLMVector{}
+	}
+	if err := cursor.Err(); err != nil {
+		log.Fatalf("Failed to read llmvectors: %v", err)
+	}
+
+	fmt.Printf("✓ %d contexts migrated (%d vectors), %d failed\n", migrated, vectors, failed)
+	if failed > 0 {
+		log.Fatalf("Migration incomplete - rerun after fixing the failures above")
+	}
+
+	hashed, err := service.BackfillHashes(ctx, *dryRun)
+	if err != nil {
+		log.Fatalf("Failed to hash vectors after %d: %v", hashed, err)
+	}
+	if *dryRun {
+		fmt.Printf("→ would hash %d vectors\n", hashed)
+	} else {
+		fmt.Printf("✓ %d vectors hashed\n", hashed)
+	}
+}
@@ -126,7 +126,7 @@ func main() {
 	}
 
 	/* Clean up test data collections for deterministic test state */
-	testDataCollections := []string{"workflows", "macros", "templates", "integrations", "llmvectors"}
+	testDataCollections := []string{"workflows", "macros", "templates", "integrations", "llmvectors", "llmvectorchunks", "llmusage"}
 	baseUserIDs := []string{"admin", "subscriber", "customer"}
 
 	for _, collName := range testDataCollections {
@@ -279,6 +279,196 @@ describe('Authentication Router', () => {
   })
 })
 
+/* bcrypt hash of SessionPass123!; /sync/users stores passwords as given */
+const passwordHash = '$2a$10$8vOkOgzSRfqWP/rBOat87ufZwo4vvAoprQHvkynBck3ni7DpHdWXW'
+const bearer = (request, token) => request.set('Authorization', `Bearer ${token}`)
+
+/* Creates a user with a known password and signs in through /auth/login-jwt */
+const signIn = async () => {
+  const name = `session-${Date.now()}-${Math.floor(Math.random() * 10000)}`
+  await testDataFactory.createUser({id: name, name, mail: `${name}@example.com`, password: passwordHash, confirmed: true})
+  const res = await publicRequest.post('/auth/login-jwt').send({usernameOrEmail: name, password: 'SessionPass123!'})
+  expect(res.status).toBe(200)
+  return res.body
+}
+
+describe('Authentication Router - Sessions', () => {
+  const refresh = refreshToken => publicRequest.post('/auth/refresh').send({refresh_token: refreshToken})
+
+  beforeAll(async () => {
+    await testOrchestrator.prepareTestEnvironment()
+  })
+
+  afterAll(async () => {
+    await testOrchestrator.cleanupTestEnvironment()
+  })
+
+  it('rotates the refresh token on every refresh', async () => {
+    const auth = await signIn()
+    expect(auth.refresh_token).not.toBe(auth.access_token)
+
+    const res = await refresh(auth.refresh_token)
+    expect(res.status).toBe(200)
+    expect(res.body.refresh_token).toBeDefined()
+    expect(res.body.refresh_token).not.toBe(auth.refresh_token)
+
+    /* The token just replaced is turned away without ending the session */
+    expect((await refresh(auth.refresh_token)).status).toBe(401)
+    expect((await refresh(res.body.refresh_token)).status).toBe(200)
+  })
+
+  it('revokes the whole family when an older token is reused', async () => {
+    const auth = await signIn()
+    const first = await refresh(auth.refresh_token)
+    const second = await refresh(first.body.refresh_token)
+    expect(second.status).toBe(200)
+
+    const reuse = await refresh(auth.refresh_token)
+    expect(reuse.status).toBe(401)
+    expect(reuse.body.message).toMatch(/reused/i)
+
+    const latest = await refresh(second.body.refresh_token)
+    expect(latest.status).toBe(401)
+    expect(latest.body.message).toMatch(/revoked/i)
+  })
+
+  it('refuses refresh tokens as access tokens', async () => {
+    const auth = await signIn()
+    const res = await bearer(publicRequest.get('/auth/sessions'), auth.refresh_token)
+
+    expect(res.status).toBe(401)
+  })
+
+  it('lists and revokes sessions', async () => {
+    const auth = await signIn()
+    const list = await bearer(publicRequest.get('/auth/sessions'), auth.access_token)
+    expect(list.status).toBe(200)
+    expect(list.body).toHaveLength(1)
+    expect(list.body[0].current).toBe(true)
+    expect(list.body[0]).not.toHaveProperty('tokenId')
+
+    const other = await publicRequest.post('/auth/login-jwt').send({usernameOrEmail: auth.user.id, password: 'SessionPass123!'})
+    const revoke = await bearer(publicRequest.delete(`/auth/sessions/${list.body[0].id}`), other.body.access_token)
+    expect(revoke.status).toBe(200)
+    expect((await refresh(auth.refresh_token)).status).toBe(401)
+
+    const again = await bearer(publicRequest.delete(`/auth/sessions/${list.body[0].id}`), other.body.access_token)
+    expect(again.status).toBe(404)
+  })
+
+  it('turns away access tokens of a revoked session', async () => {
+    const auth = await signIn()
+    expect((await bearer(publicRequest.get('/auth/sessions'), auth.access_token)).status).toBe(200)
+
+    const logout = await publicRequest.post('/auth/logout').send({refresh_token: auth.refresh_token})
+    expect(logout.status).toBe(200)
+
+    const res = await bearer(publicRequest.get('/auth/sessions'), auth.access_token)
+    expect(res.status).toBe(401)
+  })
+
+  it('logs out everywhere but the current session', async () => {
+    const here = await signIn()
+    const name = here.user.id
+    const elsewhere = await publicRequest.post('/auth/login-jwt').send({usernameOrEmail: name, password: 'SessionPass123!'})
+
+    const res = await bearer(publicRequest.delete('/auth/sessions?keepCurrent=true'), here.access_token)
+    expect(res.status).toBe(200)
+    expect(res.body.revoked).toBe(1)
+
+    expect((await refresh(elsewhere.body.refresh_token)).status).toBe(401)
+    expect((await bearer(publicRequest.get('/auth/sessions'), elsewhere.body.access_token)).status).toBe(401)
+    expect((await bearer(publicRequest.get('/auth/sessions'), here.access_token)).status).toBe(200)
+    expect((await refresh(here.refresh_token)).status).toBe(200)
+  })
+
+  it('revokes the session on logout', async () => {
+    const auth = await signIn()
+    const res = await publicRequest.post('/auth/logout').send({refresh_token: auth.refresh_token})
+
+    expect(res.status).toBe(200)
+    expect((await refresh(auth.refresh_token)).status).toBe(401)
+  })
+})
+
+describe('Authentication Router - Personal access tokens', () => {
+  const inDays = days => new Date(Date.now() + days * 24 * 60 * 60 * 1000).toISOString()
+  const createToken = (auth, body) => bearer(publicRequest.post('/auth/tokens'), auth.access_token).send(body)
+
+  beforeAll(async () => {
+    await testOrchestrator.prepareTestEnvironment()
+  })
+
+  afterAll(async () => {
+    await testOrchestrator.cleanupTestEnvironment()
+  })
+
+  it('shows the token once and lists it without the secret', async () => {
+    const auth = await signIn()
+    const created = await createToken(auth, {name: 'backup script', scopes: ['vector', 'vector'], expiresAt: inDays(30)})
+    expect(created.status).toBe(201)
+    expect(created.body.token).toMatch(/^d5p_[0-9a-f]{64}$/)
+    expect(created.body.scopes).toEqual(['vector'])
+    expect(created.body).not.toHaveProperty('hash')
+
+    const list = await bearer(publicRequest.get('/auth/tokens'), auth.access_token)
+    expect(list.status).toBe(200)
+    expect(list.body).toHaveLength(1)
+    expect(list.body[0].prefix).toBe(created.body.token.slice(0, 12))
+    expect(list.body[0]).not.toHaveProperty('token')
+    expect(list.body[0]).not.toHaveProperty('lastUsedAt')
+  })
+
+  it('validates name, scopes and expiry', async () => {
+    const auth = await signIn()
+
+    expect((await createToken(auth, {name: '', scopes: ['vector'], expiresAt: inDays(1)})).status).toBe(400)
+    expect((await createToken(auth, {name: 'x', scopes: ['admin'], expiresAt: inDays(1)})).status).toBe(400)
+    expect((await createToken(auth, {name: 'x', scopes: [], expiresAt: inDays(1)})).status).toBe(400)
+    expect((await createToken(auth, {name: 'x', scopes: ['vector'], expiresAt: inDays(-1)})).status).toBe(400)
+    expect((await createToken(auth, {name: 'x', scopes: ['vector'], expiresAt: inDays(400)})).status).toBe(400)
+  })
+
+  it('authenticates as the user within its scopes and records use', async () => {
+    const auth = await signIn()
+    const {body} = await createToken(auth, {name: 'vectors', scopes: ['vector'], expiresAt: inDays(7)})
+
+    const vectors = await bearer(publicRequest.get('/vector/all'), body.token)
+    expect(vectors.status).toBe(200)
+
+    expect((await bearer(publicRequest.get('/workflow'), body.token)).status).toBe(403)
+    expect((await bearer(publicRequest.get('/auth/tokens'), body.token)).status).toBe(403)
+    expect((await bearer(publicRequest.get('/auth/sessions'), body.token)).status).toBe(403)
+
+    const list = await bearer(publicRequest.get('/auth/tokens'), auth.access_token)
+    expect(list.body[0].lastUsedAt).toBeDefined()
+  })
+
+  it('separates reading and writing workflows', async () => {
+    const auth = await signIn()
+    const {body} = await createToken(auth, {name: 'reader', scopes: ['workflows:read'], expiresAt: inDays(7)})
+
+    expect((await bearer(publicRequest.get('/workflow'), body.token)).status).toBe(200)
+    expect((await bearer(publicRequest.post('/workflow'), body.token).send({name: 'x'})).status).toBe(403)
+  })
+
+  it('stops working once revoked', async () => {
+    const auth = await signIn()
+    const {body} = await createToken(auth, {name: 'temporary', scopes: ['vector'], expiresAt: inDays(1)})
+
+    const revoke = await bearer(publicRequest.delete(`/auth/tokens/${body.id}`), auth.access_token)
+    expect(revoke.status).toBe(200)
+    expect((await bearer(publicRequest.get('/vector/all'), body.token)).status).toBe(401)
+    expect((await bearer(publicRequest.delete(`/auth/tokens/${body.id}`), auth.access_token)).status).toBe(404)
+  })
+
+  it('rejects unknown tokens', async () => {
+    const res = await bearer(publicRequest.get('/vector/all'), `d5p_${'0'.repeat(64)}`)
+
+    expect(res.status).toBe(401)
+  })
+})
+
 describe('Authentication Router - Subscriber Tests', () => {
   beforeAll(async () => {
     await testOrchestrator.prepareTestEnvironment()
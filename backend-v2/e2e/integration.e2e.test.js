@@ -37,7 +37,7 @@ describe('Integration Router', () => {
       expect(typeof res.body.openai).toBe('object')
       expect(res.body.openai).toHaveProperty('apiKey')
       expect(typeof res.body.openai.apiKey).toBe('string')
-      expect(res.body.openai.apiKey).toBe('test-key')
+      expect(res.body.openai.apiKey).toBe('****')
       expect(res.body).toHaveProperty('lang')
       expect(res.body).toHaveProperty('model')
       expect(res.body.lang).toBe('none')
@@ -116,6 +116,32 @@ describe('Integration Router', () => {
     })
   })
 
+  describe('GET /integration/models', () => {
+    it('returns the models catalog grouped by provider', async () => {
+      const res = await subscriberRequest.get('/integration/models')
+
+      expect(res.status).toBe(200)
+      const openai = res.body.providers.find(provider => provider.id === 'openai')
+      expect(openai.defaultModel).toBeTruthy()
+      expect(openai.models.length).toBeGreaterThan(0)
+      expect(openai).not.toHaveProperty('baseUrl')
+    })
+
+    it('filters by model type', async () => {
+      const res = await subscriberRequest.get('/integration/models?type=embedding')
+
+      expect(res.status).toBe(200)
+      res.body.providers.forEach(provider => {
+        provider.models.forEach(model => expect(model.type).toBe('embedding'))
+      })
+    })
+
+    it('rejects unknown model types', async () => {
+      const res = await subscriberRequest.get('/integration/models?type=image')
+      expect(res.status).toBe(400)
+    })
+  })
+
   describe('POST /integration/language', () => {
     it('sets user language preference', async () => {
       const res = await subscriberRequest.post('/integration/language').send({language: 'en'})
@@ -147,11 +173,49 @@ describe('Integration Router', () => {
       expect(typeof res.body.openai).toBe('object')
       expect(res.body.openai).toHaveProperty('apiKey')
       expect(typeof res.body.openai.apiKey).toBe('string')
-      expect(res.body.openai.apiKey).toBe('test-key')
+      expect(res.body.openai.apiKey).toBe('****')
+    })
+
+    it('masks long keys to the last 4 characters', async () => {
+      await subscriberRequest.put('/integration/openai/update').send({apiKey: 'sk-proj-1234567890abcd'})
+      const res = await subscriberRequest.get('/integration/openai')
+
+      expect(res.status).toBe(200)
+      expect(res.body.openai.apiKey).toBe('****abcd')
+    })
+  })
+
+  describe('POST /integration/:service/reveal', () => {
+    it('returns the full stored key', async () => {
+      const res = await subscriberRequest.post('/integration/openai/reveal')
+
+      expect(res.status).toBe(200)
+      expect(res.body).toHaveProperty('apiKey', 'test-key')
+    })
+
+    it('returns 404 for a service without a key', async () => {
+      const res = await subscriberRequest.post('/integration/claude/reveal')
+
+      expect(res.status).toBe(404)
+    })
+
+    it('rejects unknown services', async () => {
+      const res = await subscriberRequest.post('/integration/unknown/reveal')
+
+      expect(res.status).toBe(400)
     })
   })
 
   describe('PUT /integration/:service/update', () => {
+    it('keeps the stored key when the masked value is sent back', async () => {
+      const current = await subscriberRequest.get('/integration/openai')
+      const res = await subscriberRequest.put('/integration/openai/update').send({...current.body.openai, model: 'gpt-4o'})
+      expect(res.status).toBe(200)
+
+      const revealed = await subscriberRequest.post('/integration/openai/reveal')
+      expect(revealed.body.apiKey).toBe('test-key')
+    })
+
     it('updates integration configuration', async () => {
       const res = await subscriberRequest.put('/integration/openai/update').send({apiKey: 'updated-test-key'})
       
@@ -238,6 +302,26 @@ describe('Integration Router - Administrator Tests', () => {
     await testOrchestrator.cleanupTestEnvironment()
   })
 
+  describe('Integration health', () => {
+    it('records a credential check when a key is saved', async () => {
+      const res = await subscriberRequest.put('/integration/openai/update').send({apiKey: 'health-key'})
+      expect(res.status).toBe(200)
+      expect(res.body.health).toHaveProperty('status', 'valid')
+      expect(res.body.health).toHaveProperty('checkedAt')
+
+      const stored = await subscriberRequest.get('/integration')
+      expect(stored.body.health.openai.status).toBe('valid')
+    })
+
+    it('only lets administrators re-check all integrations', async () => {
+      const denied = await subscriberRequest.post('/integration/health/recheck')
+      expect(denied.status).toBe(403)
+
+      const started = await administratorRequest.post('/integration/health/recheck')
+      expect([202, 409]).toContain(started.status)
+    })
+  })
+
   describe('Administrator API Access', () => {
     it('should have full access to integration configuration', async () => {
       const res = await administratorRequest.get('/integration')
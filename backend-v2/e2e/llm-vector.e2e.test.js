@@ -1,6 +1,6 @@
-import {subscriberRequest, publicRequest} from './shared/requests'
+import {subscriberRequest, customerRequest, publicRequest} from './shared/requests'
 import {testDataFactory, testOrchestrator} from './shared/test-data-factory'
-import {subscriber} from './shared/test-users.js'
+import {subscriber, customer} from './shared/test-users.js'
 
 const userId = subscriber.name
 const subscriberUserId = subscriber.name
@@ -189,6 +189,16 @@ describe('LLM Vector E2E', () => {
       /* HTTP mode: Test success via API response only */
     }, 10000)
 
+    it('removes the type with its last source', async () => {
+      const res = await subscriberRequest
+        .delete('/vector')
+        .send({contextName: 'delete-test', type: 'openai', sources: ['test']})
+      expect(res.status).toBe(200)
+
+      const overview = await subscriberRequest.get('/vector/overview')
+      expect(JSON.parse(overview.text)['delete-test']).toEqual({})
+    }, 10000)
+
     it('returns 404 for missing context', async () => {
       const res = await subscriberRequest.delete('/vector').send({contextName: 'nonexistent'})
       expect(res.status).toBe(404)
@@ -213,6 +223,515 @@ describe('LLM Vector E2E', () => {
       expect(data).toHaveProperty('overview-test')
     }, 10000)
   })
+
+  describe('POST /vector/search', () => {
+    beforeEach(async () => {
+      await testDataFactory.createLLMVector({
+        contextName: 'search-test',
+        type: 'openai',
+        data: {
+          'doc-a': [
+            {content: 'close', embedding: [1, 0.1], metadata: {lang: 'en'}},
+            {content: 'far', embedding: [0, 1], metadata: {lang: 'de'}},
+          ],
+          'doc-b': [{content: 'no embedding'}],
+        },
+      })
+    }, 15000)
+
+    it('ranks vectors by similarity to the query embedding', async () => {
+      const res = await subscriberRequest.post('/vector/search').send({
+        contextName: 'search-test',
+        embedding: [1, 0],
+        topK: 1,
+      })
+      expect(res.status).toBe(200)
+      const {results} = JSON.parse(res.text)
+      expect(results).toHaveLength(1)
+      expect(results[0]).toMatchObject({type: 'openai', source: 'doc-a', index: 0, content: 'close'})
+      expect(results[0]).not.toHaveProperty('embedding')
+    }, 10000)
+
+    it('filters by metadata', async () => {
+      const res = await subscriberRequest.post('/vector/search').send({
+        contextName: 'search-test',
+        embedding: [1, 0],
+        metadata: {lang: 'de'},
+      })
+      expect(res.status).toBe(200)
+      const {results} = JSON.parse(res.text)
+      expect(results.map(r => r.content)).toEqual(['far'])
+    }, 10000)
+
+    it('requires an embedding or text', async () => {
+      const res = await subscriberRequest.post('/vector/search').send({contextName: 'search-test'})
+      expect(res.status).toBe(400)
+    }, 10000)
+
+    it('returns 404 for missing context', async () => {
+      const res = await subscriberRequest.post('/vector/search').send({contextName: 'nonexistent', embedding: [1, 0]})
+      expect(res.status).toBe(404)
+    }, 10000)
+  })
+
+  describe('POST /vector/nearest', () => {
+    beforeEach(async () => {
+      await testDataFactory.createLLMVector({
+        contextName: 'nearest-test',
+        type: 'openai',
+        data: {
+          'doc-a': [
+            {content: 'close', embedding: [1, 0.1], metadata: {lang: 'en'}},
+            {content: 'far', embedding: [0, 1], metadata: {lang: 'de'}},
+          ],
+          'doc-b': [{content: 'other source', embedding: [1, 0.2]}],
+        },
+      })
+    }, 15000)
+
+    it('returns the nearest vectors with their ids', async () => {
+      const res = await subscriberRequest.post('/vector/nearest').send({
+        contextName: 'nearest-test',
+        embedding: [1, 0],
+        topK: 2,
+      })
+      expect(res.status).toBe(200)
+      const {results} = JSON.parse(res.text)
+      expect(results.map(r => r.content)).toEqual(['close', 'other source'])
+      expect(results[0]).toMatchObject({type: 'openai', source: 'doc-a'})
+      expect(results[0].id).toMatch(/^[0-9a-f]{24}$/)
+      expect(results[0]).not.toHaveProperty('embedding')
+    }, 10000)
+
+    it('filters by source and metadata', async () => {
+      const res = await subscriberRequest.post('/vector/nearest').send({
+        contextName: 'nearest-test',
+        embedding: [1, 0],
+        sources: ['doc-a'],
+        metadata: {lang: 'de'},
+      })
+      expect(res.status).toBe(200)
+      const {results} = JSON.parse(res.text)
+      expect(results.map(r => r.content)).toEqual(['far'])
+    }, 10000)
+
+    it('follows writes made after the index was built', async () => {
+      await subscriberRequest.post('/vector/nearest').send({contextName: 'nearest-test', embedding: [1, 0]})
+      await subscriberRequest.delete('/vector').send({contextName: 'nearest-test', type: 'openai', sources: ['doc-a']})
+      await subscriberRequest.post('/vector').send({
+        contextName: 'nearest-test',
+        type: 'openai',
+        data: {'doc-c': [{content: 'exact', embedding: [2, 0]}]},
+        keep: true,
+      })
+
+      const res = await subscriberRequest.post('/vector/nearest').send({contextName: 'nearest-test', embedding: [1, 0]})
+      expect(res.status).toBe(200)
+      const {results} = JSON.parse(res.text)
+      expect(results.map(r => r.content)).toEqual(['exact', 'other source'])
+    }, 15000)
+
+    it('returns 404 for missing context', async () => {
+      const res = await subscriberRequest.post('/vector/nearest').send({contextName: 'nonexistent', embedding: [1, 0]})
+      expect(res.status).toBe(404)
+    }, 10000)
+  })
+
+  describe('POST /vector/retrieve', () => {
+    beforeEach(async () => {
+      await testDataFactory.createLLMVector({
+        contextName: 'retrieve-test',
+        type: 'openai',
+        data: {
+          'catalog': [
+            {content: 'Widget SKU-4411 in blue', embedding: [0, 1]},
+            {content: 'A similar widget without a code', embedding: [1, 0]},
+          ],
+          'notes': [{content: 'Remember SKU-4411 for the spring board'}],
+        },
+      })
+    }, 15000)
+
+    it('finds exact terms in vectors saved without embeddings', async () => {
+      const res = await subscriberRequest.post('/vector/retrieve').send({
+        contextName: 'retrieve-test',
+        mode: 'lexical',
+        text: 'sku-4411',
+      })
+      expect(res.status).toBe(200)
+      const {results} = JSON.parse(res.text)
+      expect(results.map(r => r.source).sort()).toEqual(['catalog', 'notes'])
+      expect(results[0].lexicalRank).toBe(1)
+    }, 10000)
+
+    it('fuses keyword and vector rankings with weights', async () => {
+      const res = await subscriberRequest.post('/vector/retrieve').send({
+        contextName: 'retrieve-test',
+        text: 'SKU-4411',
+        embedding: [1, 0],
+        weights: {vector: 1, lexical: 2},
+      })
+      expect(res.status).toBe(200)
+      const {results} = JSON.parse(res.text)
+      expect(results).toHaveLength(3)
+      expect(results[0].content).toBe('Widget SKU-4411 in blue')
+      expect(results[0]).toHaveProperty('vectorRank', 2)
+    }, 10000)
+
+    it('validates mode, weights and text', async () => {
+      const mode = await subscriberRequest.post('/vector/retrieve').send({contextName: 'retrieve-test', mode: 'fuzzy', text: 'a'})
+      expect(mode.status).toBe(400)
+
+      const weights = await subscriberRequest.post('/vector/retrieve').send({
+        contextName: 'retrieve-test', text: 'a', embedding: [1, 0], weights: {vector: 0, lexical: 0},
+      })
+      expect(weights.status).toBe(400)
+
+      const text = await subscriberRequest.post('/vector/retrieve').send({contextName: 'retrieve-test', mode: 'lexical'})
+      expect(text.status).toBe(400)
+    }, 10000)
+  })
+
+  describe('/vector/export and /vector/import', () => {
+    beforeEach(async () => {
+      await testDataFactory.createLLMVector({
+        contextName: 'export-test',
+        type: 'openai',
+        data: {
+          'doc-a': [{content: 'with embedding', embedding: [0.5, -1.25], metadata: {page: 1}}],
+          'doc-b': [{content: 'text only'}],
+        },
+      })
+    }, 15000)
+
+    const importExport = (query, body) => subscriberRequest
+      .post(`/vector/import?${query}`)
+      .set('Content-Type', 'application/x-ndjson')
+      .send(body)
+
+    it('streams a context as JSON Lines and imports it under a new name', async () => {
+      const res = await subscriberRequest.get('/vector/export?name=export-test&embeddings=binary')
+      expect(res.status).toBe(200)
+      expect(res.headers['content-type']).toContain('application/x-ndjson')
+      const lines = res.text.trim().split('\n').map(line => JSON.parse(line))
+      expect(lines[0]).toMatchObject({format: 'd5-vector-context', version: 1, name: 'export-test'})
+      expect(lines.slice(1).map(l => l.source)).toEqual(['doc-a', 'doc-b'])
+      expect(lines[1]).toHaveProperty('embeddingF32', 'AAAAPwAAoL8=')
+
+      const imported = await importExport('name=export-copy', res.text)
+      expect(imported.status).toBe(200)
+      expect(JSON.parse(imported.text)).toMatchObject({name: 'export-copy', types: 1, vectors: 2})
+
+      const copy = await subscriberRequest.get('/vector?name=export-copy&type=openai')
+      const store = JSON.parse(copy.text)
+      expect(store['doc-a'][0]).toMatchObject({content: 'with embedding', embedding: [0.5, -1.25]})
+    }, 15000)
+
+    it('handles name conflicts', async () => {
+      const line = JSON.stringify({type: 'openai', source: 'doc-c', content: 'added', embedding: [1, 0]})
+
+      const conflict = await importExport('name=export-test', line)
+      expect(conflict.status).toBe(409)
+
+      const merged = await importExport('name=export-test&onConflict=merge', line)
+      expect(merged.status).toBe(200)
+      let store = JSON.parse((await subscriberRequest.get('/vector?name=export-test&type=openai')).text)
+      expect(Object.keys(store).sort()).toEqual(['doc-a', 'doc-b', 'doc-c'])
+
+      const replaced = await importExport('name=export-test&onConflict=replace', line)
+      expect(replaced.status).toBe(200)
+      store = JSON.parse((await subscriberRequest.get('/vector?name=export-test&type=openai')).text)
+      expect(Object.keys(store)).toEqual(['doc-c'])
+    }, 15000)
+
+    it('validates embedding dimensions', async () => {
+      const line = JSON.stringify({type: 'openai', source: 'doc-c', content: 'wrong', embedding: [1, 0, 0]})
+      const res = await importExport('name=export-test&onConflict=merge', line)
+      expect(res.status).toBe(400)
+      expect(res.text).toContain('dimension')
+    }, 10000)
+
+    it('refuses imports over the request body limit', async () => {
+      const line = JSON.stringify({type: 'openai', source: 'doc-large', content: 'x'.repeat(5 << 20), embedding: [1, 0]})
+      const res = await importExport('name=export-large', line)
+      expect(res.status).toBe(413)
+    }, 15000)
+
+    it('returns 404 for missing context', async () => {
+      const res = await subscriberRequest.get('/vector/export?name=nonexistent')
+      expect(res.status).toBe(404)
+    }, 10000)
+  })
+
+  describe('shared contexts', () => {
+    const shareWith = role => subscriberRequest.post('/vector/share').send({
+      contextName: 'share-test',
+      access: role ? [{subjectId: customer.id, subjectType: 'user', role}] : [],
+    })
+
+    beforeEach(async () => {
+      await testDataFactory.createLLMVector({
+        contextName: 'share-test',
+        type: 'openai',
+        data: {'doc': [{content: 'shared knowledge', embedding: [1, 0]}]},
+      })
+      await shareWith(null)
+    }, 15000)
+
+    it('hides contexts that are not shared', async () => {
+      const res = await customerRequest.get(`/vector?name=share-test&owner=${subscriber.name}`)
+      expect(res.status).toBe(404)
+    }, 10000)
+
+    it('lets readers get, search and list but not write', async () => {
+      expect((await shareWith('reader')).status).toBe(200)
+
+      const access = await subscriberRequest.get('/vector/share?name=share-test')
+      expect(JSON.parse(access.text)).toEqual([{subjectId: customer.id, subjectType: 'user', role: 'reader'}])
+
+      const get = await customerRequest.get(`/vector?name=share-test&owner=${subscriber.name}&type=openai`)
+      expect(get.status).toBe(200)
+      expect(JSON.parse(get.text)).toHaveProperty('doc')
+
+      const search = await customerRequest.post('/vector/search').send({
+        contextName: 'share-test', owner: subscriber.name, embedding: [1, 0],
+      })
+      expect(search.status).toBe(200)
+      expect(JSON.parse(search.text).results[0].content).toBe('shared knowledge')
+
+      const overview = JSON.parse((await customerRequest.get('/vector/overview')).text)
+      expect(overview).toHaveProperty([`${subscriber.name}/share-test`])
+
+      const all = JSON.parse((await customerRequest.get('/vector/all')).text)
+      const shared = all.find(c => c.userId === subscriber.name && c.name === 'share-test')
+      expect(shared).toBeDefined()
+      expect(shared).not.toHaveProperty('share')
+
+      const save = await customerRequest.post('/vector').send({
+        contextName: 'share-test', owner: subscriber.name, type: 'openai', data: {'doc': [{content: 'x'}]},
+      })
+      expect(save.status).toBe(403)
+    }, 15000)
+
+    it('lets contributors save and delete sources but not the context', async () => {
+      await shareWith('contributor')
+
+      const save = await customerRequest.post('/vector').send({
+        contextName: 'share-test', owner: subscriber.name, type: 'openai', data: {'added': [{content: 'from a colleague'}]}, keep: true,
+      })
+      expect(save.status).toBe(200)
+
+      const store = JSON.parse((await subscriberRequest.get('/vector?name=share-test&type=openai')).text)
+      expect(Object.keys(store).sort()).toEqual(['added', 'doc'])
+
+      const removeSource = await customerRequest.delete('/vector').send({
+        contextName: 'share-test', owner: subscriber.name, type: 'openai', sources: ['added'],
+      })
+      expect(removeSource.status).toBe(200)
+
+      const removeContext = await customerRequest.delete('/vector').send({contextName: 'share-test', owner: subscriber.name})
+      expect(removeContext.status).toBe(403)
+    }, 15000)
+
+    it('matches mail grants against the account mail address', async () => {
+      const share = await subscriberRequest.post('/vector/share').send({
+        contextName: 'share-test',
+        access: [{subjectId: customer.mail, subjectType: 'mail', role: 'reader'}],
+      })
+      expect(share.status).toBe(200)
+
+      const get = await customerRequest.get(`/vector?name=share-test&owner=${subscriber.name}&type=openai`)
+      expect(get.status).toBe(200)
+    }, 10000)
+
+    it('rejects invalid access lists', async () => {
+      const res = await subscriberRequest.post('/vector/share').send({
+        contextName: 'share-test',
+        access: [{subjectId: customer.id, subjectType: 'user', role: 'owner'}],
+      })
+      expect(res.status).toBe(400)
+
+      /* Users belong to no groups, so group grants are refused rather than stored unmatched */
+      const group = await subscriberRequest.post('/vector/share').send({
+        contextName: 'share-test',
+        access: [{subjectId: 'research', subjectType: 'group', role: 'reader'}],
+      })
+      expect(group.status).toBe(400)
+    }, 10000)
+  })
+
+  describe('retention', () => {
+    const contextName = 'retention-test'
+
+    beforeAll(async () => {
+      await subscriberRequest.post('/vector').send({
+        contextName,
+        type: 'openai',
+        data: {'doc-a': [{content: 'one'}, {content: 'two'}], 'doc-b': [{content: 'three'}]},
+      })
+    })
+
+    it('evicts the oldest vectors past the cap', async () => {
+      const res = await subscriberRequest.post('/vector/retention').send({contextName, maxVectors: 2, sources: [{type: 'openai', source: 'doc-b', ttl: 86400}]})
+      expect(res.status).toBe(200)
+
+      const policy = JSON.parse((await subscriberRequest.get(`/vector/retention?name=${contextName}`)).text)
+      expect(policy).toEqual({maxVectors: 2, sources: [{type: 'openai', source: 'doc-b', ttl: 86400}]})
+
+      await subscriberRequest.post('/vector').send({contextName, type: 'openai', keep: true, data: {'doc-c': [{content: 'four'}]}})
+      const store = JSON.parse((await subscriberRequest.get(`/vector?name=${contextName}&type=openai`)).text)
+      expect(Object.keys(store).sort()).toEqual(['doc-b', 'doc-c'])
+    }, 15000)
+
+    it('reports vector counts, size and last use in the overview', async () => {
+      const res = await subscriberRequest.get('/vector/overview?stats=true')
+      expect(res.status).toBe(200)
+      const stats = JSON.parse(res.text)[contextName]
+      expect(stats).toMatchObject({vectors: 2, retention: {maxVectors: 2}})
+      expect(stats.bytes).toBeGreaterThan(0)
+      expect(stats.types.openai.sort()).toEqual(['doc-b', 'doc-c'])
+      expect(Date.parse(stats.lastUsedAt)).toBeGreaterThan(0)
+    }, 10000)
+
+    it('validates the policy and hides it from other users', async () => {
+      const invalid = await subscriberRequest.post('/vector/retention').send({contextName, ttl: -1})
+      expect(invalid.status).toBe(400)
+
+      const noTTL = await subscriberRequest.post('/vector/retention').send({contextName, sources: [{type: 'openai', source: 'doc-b'}]})
+      expect(noTTL.status).toBe(400)
+
+      const other = await customerRequest.get(`/vector/retention?name=${contextName}`)
+      expect(other.status).toBe(404)
+    }, 10000)
+  })
+
+  describe('embedding models and deduplication', () => {
+    const contextName = 'model-test'
+
+    beforeAll(async () => {
+      await subscriberRequest.post('/vector').send({
+        contextName,
+        type: 'openai',
+        model: 'text-embedding-ada-002',
+        data: {'doc-a': [{content: 'alpha', embedding: [1, 0]}]},
+      })
+    })
+
+    it('records the model and dimension of each type', async () => {
+      const res = await subscriberRequest.get(`/vector/all`)
+      const context = JSON.parse(res.text).find(c => c.name === contextName)
+      expect(context.embeddings).toEqual([{type: 'openai', model: 'text-embedding-ada-002', dimension: 2}])
+      expect(context.store.openai['doc-a'][0]).toMatchObject({model: 'text-embedding-ada-002', dimension: 2})
+    }, 10000)
+
+    it('rejects embeddings from another model or of another dimension', async () => {
+      const model = await subscriberRequest.post('/vector').send({
+        contextName,
+        type: 'openai',
+        keep: true,
+        data: {'doc-b': [{content: 'beta', embedding: [0, 1], model: 'custom-embed'}]},
+      })
+      expect(model.status).toBe(400)
+      expect(model.text).toContain('custom-embed')
+
+      const dimension = await subscriberRequest.post('/vector').send({
+        contextName,
+        type: 'openai',
+        keep: true,
+        data: {'doc-b': [{content: 'beta', embedding: [0, 1, 0]}]},
+      })
+      expect(dimension.status).toBe(400)
+    }, 10000)
+
+    it('skips content a source already holds when appending', async () => {
+      const res = await subscriberRequest.post('/vector').send({
+        contextName,
+        type: 'openai',
+        keep: true,
+        data: {'doc-a': [{content: 'alpha', embedding: [1, 0]}, {content: 'gamma', embedding: [0, 1]}, {content: 'gamma', embedding: [0, 1]}]},
+      })
+      expect(res.status).toBe(200)
+      const store = JSON.parse((await subscriberRequest.get(`/vector?name=${contextName}&type=openai&source=doc-a`)).text)
+      expect(store['doc-a'].map(v => v.content)).toEqual(['alpha', 'gamma'])
+    }, 10000)
+
+    it('lets a replace switch the model', async () => {
+      const res = await subscriberRequest.post('/vector').send({
+        contextName,
+        type: 'openai',
+        model: 'custom-embed',
+        data: {'doc-a': [{content: 'alpha', embedding: [1, 0, 0]}]},
+      })
+      expect(res.status).toBe(200)
+      expect(JSON.parse(res.text).embeddings).toEqual([{type: 'openai', model: 'custom-embed', dimension: 3}])
+    }, 10000)
+  })
+
+  describe('/vector/ingest', () => {
+    it('queues text and reports the job', async () => {
+      const res = await subscriberRequest.post('/vector/ingest').send({
+        contextName: 'ingest-test',
+        type: 'openai',
+        source: 'notes',
+        text: 'First paragraph.\n\nSecond paragraph.',
+      })
+      expect(res.status).toBe(202)
+      const job = JSON.parse(res.text)
+      expect(job).toMatchObject({source: 'notes', provider: 'openai', status: 'pending'})
+      expect(job).not.toHaveProperty('text')
+
+      const got = await subscriberRequest.get(`/vector/ingest/${job._id}`)
+      expect(got.status).toBe(200)
+      expect(JSON.parse(got.text)).toHaveProperty('_id', job._id)
+
+      const list = await subscriberRequest.get('/vector/ingest')
+      expect(list.status).toBe(200)
+      expect(JSON.parse(list.text).map(j => j._id)).toContain(job._id)
+    }, 10000)
+
+    it('requires exactly one input', async () => {
+      const none = await subscriberRequest.post('/vector/ingest').send({type: 'openai'})
+      expect(none.status).toBe(400)
+
+      const both = await subscriberRequest.post('/vector/ingest').send({type: 'openai', text: 'a', url: 'https://example.com'})
+      expect(both.status).toBe(400)
+    }, 10000)
+
+    it('rejects private URLs and bad chunk sizes', async () => {
+      const local = await subscriberRequest.post('/vector/ingest').send({type: 'openai', url: 'http://127.0.0.1/doc'})
+      expect(local.status).toBe(400)
+
+      const small = await subscriberRequest.post('/vector/ingest').send({type: 'openai', text: 'a', chunkSize: 10})
+      expect(small.status).toBe(400)
+    }, 10000)
+
+    it('queues re-embedding a type with another model', async () => {
+      await subscriberRequest.post('/vector').send({
+        contextName: 'reembed-test',
+        type: 'openai',
+        data: {notes: [{content: 'to embed again', embedding: [1, 0]}]},
+      })
+
+      const res = await subscriberRequest.post('/vector/reembed').send({
+        contextName: 'reembed-test',
+        type: 'openai',
+        model: 'text-embedding-3-large',
+      })
+      expect(res.status).toBe(202)
+      expect(JSON.parse(res.text)).toMatchObject({kind: 'reembed', type: 'openai', model: 'text-embedding-3-large', status: 'pending'})
+
+      const missing = await subscriberRequest.post('/vector/reembed').send({contextName: 'reembed-test', type: 'absent'})
+      expect(missing.status).toBe(404)
+    }, 10000)
+
+    it('returns 404 for unknown files and jobs', async () => {
+      const file = await subscriberRequest.post('/vector/ingest').send({type: 'openai', fileId: '000000000000000000000000'})
+      expect(file.status).toBe(404)
+
+      const job = await subscriberRequest.get('/vector/ingest/000000000000000000000000')
+      expect(job.status).toBe(404)
+    }, 10000)
+  })
 })
 
 describe('LLM Vector E2E - Subscriber Tests', () => {
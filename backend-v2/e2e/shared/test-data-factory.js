@@ -33,7 +33,8 @@ async function cleanupUserCollections(userIds) {
     const db = await getMongoConnection()
     await Promise.all([
       db.collection('integrations').deleteMany({ userId: { $in: userIds } }),
-      db.collection('llmvectors').deleteMany({ userId: { $in: userIds } })
+      db.collection('llmvectors').deleteMany({ userId: { $in: userIds } }),
+      db.collection('llmvectorchunks').deleteMany({ userId: { $in: userIds } })
     ])
   } catch (err) {
     /* Cleanup failure should not break tests */
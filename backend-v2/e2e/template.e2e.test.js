@@ -191,6 +191,29 @@ describe('Template Router', () => {
     })
   })
 
+  describe('POST /workflow/from/template/:templateId', () => {
+    it('creates a workflow with its own id from the template', async () => {
+      const userTemplateData = {
+        ...workflowTemplateData,
+        name: `user-test-template-${timestamp}`,
+        keywords: ['test'],
+        share: {public: false},
+      }
+      const template = await subscriberRequest.post('/templates').send(JSON.stringify(userTemplateData))
+      const {templateId} = JSON.parse(template.res.text)
+
+      const response = await subscriberRequest.post(`/workflow/from/template/${templateId}`)
+      expect(response.status).toBe(201)
+      const data = JSON.parse(response.res.text)
+      expect(data.workflowId).toBeDefined()
+      expect(data.workflowId).not.toBe(templateId)
+
+      const workflow = await subscriberRequest.get(`/workflow/${data.workflowId}`)
+      expect(workflow.status).toBe(200)
+      expect(JSON.parse(workflow.res.text)).toMatchObject({title: userTemplateData.name, root: 'rootId'})
+    })
+  })
+
   describe('POST /templates (public)', () => {
     it('creates public template for admin user', async () => {
       const publicTemplateData = {
@@ -0,0 +1,180 @@
+package envelope
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+/* SealedPrefix tags values produced by Seal so plaintext and ciphertext can coexist during migration */
+const SealedPrefix = "enc:v1:"
+
+const keySize = 32
+
+var (
+	ErrNoMasterKey   = errors.New("no master key configured")
+	ErrUnknownKeyID  = errors.New("unknown master key id")
+	ErrMalformed     = errors.New("malformed ciphertext")
+	ErrInvalidKeySet = errors.New("invalid master key set")
+)
+
+/* Keyring holds the master keys; the active key wraps new data keys, older keys only unwrap */
+type Keyring struct {
+	activeID string
+	keys     map[string][]byte
+}
+
+/*
+ParseKeyring reads "id:base64key[,id:base64key...]". The first entry is the active key,
+the rest are retired keys kept so existing records can still be unwrapped during rotation.
+An empty spec yields a disabled keyring.
+*/
+func ParseKeyring(spec string) (*Keyring, error) {
+	ring := &Keyring{keys: map[string][]byte{}}
+
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		id, encoded, ok := strings.Cut(entry, ":")
+		if !ok || id == "" {
+			return nil, fmt.Errorf("%w: entry must be id:base64key", ErrInvalidKeySet)
+		}
+		if _, exists := ring.keys[id]; exists {
+			return nil, fmt.Errorf("%w: duplicate key id %q", ErrInvalidKeySet, id)
+		}
+
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(key) != keySize {
+			return nil, fmt.Errorf("%w: key %q must be %d base64-encoded bytes", ErrInvalidKeySet, id, keySize)
+		}
+
+		ring.keys[id] = key
+		if ring.activeID == "" {
+			ring.activeID = id
+		}
+	}
+
+	return ring, nil
+}
+
+/* Enabled reports whether a master key is configured */
+func (k *Keyring) Enabled() bool {
+	return k != nil && k.activeID != ""
+}
+
+/* ActiveID returns the id of the key used to wrap new data keys */
+func (k *Keyring) ActiveID() string {
+	if k == nil {
+		return ""
+	}
+	return k.activeID
+}
+
+/* NewDataKey generates a random data key and returns it with its wrapped form */
+func (k *Keyring) NewDataKey() ([]byte, string, error) {
+	dataKey := make([]byte, keySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, "", err
+	}
+
+	wrapped, err := k.Wrap(dataKey)
+	if err != nil {
+		return nil, "", err
+	}
+	return dataKey, wrapped, nil
+}
+
+/* Wrap encrypts a data key with the active master key */
+func (k *Keyring) Wrap(dataKey []byte) (string, error) {
+	if !k.Enabled() {
+		return "", ErrNoMasterKey
+	}
+	return encrypt(k.keys[k.activeID], dataKey)
+}
+
+/* Unwrap decrypts a data key wrapped by the master key with the given id */
+func (k *Keyring) Unwrap(keyID, wrapped string) ([]byte, error) {
+	if k == nil {
+		return nil, ErrNoMasterKey
+	}
+	master, ok := k.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKeyID, keyID)
+	}
+	return decrypt(master, wrapped)
+}
+
+/* IsSealed reports whether a value was produced by Seal */
+func IsSealed(value string) bool {
+	return strings.HasPrefix(value, SealedPrefix)
+}
+
+/* Seal encrypts a secret with a data key */
+func Seal(dataKey []byte, plaintext string) (string, error) {
+	encoded, err := encrypt(dataKey, []byte(plaintext))
+	if err != nil {
+		return "", err
+	}
+	return SealedPrefix + encoded, nil
+}
+
+/* Open decrypts a value produced by Seal; plaintext values are returned unchanged */
+func Open(dataKey []byte, value string) (string, error) {
+	if !IsSealed(value) {
+		return value, nil
+	}
+
+	plaintext, err := decrypt(dataKey, strings.TrimPrefix(value, SealedPrefix))
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+func encrypt(key, plaintext []byte) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, plaintext, nil)), nil
+}
+
+func decrypt(key []byte, encoded string) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(raw) < gcm.NonceSize() {
+		return nil, ErrMalformed
+	}
+
+	nonce, ciphertext := raw[:gcm.NonceSize()], raw[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,102 @@
+package envelope
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func testKey(b byte) string {
+	return base64.StdEncoding.EncodeToString([]byte(strings.Repeat(string(b), keySize)))
+}
+
+func TestParseKeyring(t *testing.T) {
+	ring, err := ParseKeyring("k2:" + testKey('b') + ", k1:" + testKey('a'))
+	if err != nil {
+		t.Fatalf("ParseKeyring() error = %v", err)
+	}
+	if !ring.Enabled() || ring.ActiveID() != "k2" {
+		t.Errorf("ActiveID() = %q, want k2", ring.ActiveID())
+	}
+
+	empty, err := ParseKeyring("")
+	if err != nil || empty.Enabled() {
+		t.Errorf("ParseKeyring(\"\") = enabled %v, err %v; want disabled, nil", empty.Enabled(), err)
+	}
+}
+
+func TestParseKeyring_Invalid(t *testing.T) {
+	cases := []string{
+		"nokey",
+		"k1:not-base64!",
+		"k1:" + base64.StdEncoding.EncodeToString([]byte("short")),
+		"k1:" + testKey('a') + ",k1:" + testKey('b'),
+	}
+	for _, spec := range cases {
+		if _, err := ParseKeyring(spec); !errors.Is(err, ErrInvalidKeySet) {
+			t.Errorf("ParseKeyring(%q) error = %v, want ErrInvalidKeySet", spec, err)
+		}
+	}
+}
+
+func TestSealOpen_RoundTrip(t *testing.T) {
+	ring, _ := ParseKeyring("k1:" + testKey('a'))
+	dataKey, wrapped, err := ring.NewDataKey()
+	if err != nil {
+		t.Fatalf("NewDataKey() error = %v", err)
+	}
+
+	sealed, err := Seal(dataKey, "sk-secret")
+	if err != nil {
+		t.Fatalf("Seal() error = %v", err)
+	}
+	if !IsSealed(sealed) || strings.Contains(sealed, "sk-secret") {
+		t.Fatalf("Seal() = %q, want opaque sealed value", sealed)
+	}
+
+	unwrapped, err := ring.Unwrap("k1", wrapped)
+	if err != nil {
+		t.Fatalf("Unwrap() error = %v", err)
+	}
+	opened, err := Open(unwrapped, sealed)
+	if err != nil || opened != "sk-secret" {
+		t.Errorf("Open() = %q, %v; want sk-secret, nil", opened, err)
+	}
+}
+
+func TestOpen_PlaintextPassthrough(t *testing.T) {
+	opened, err := Open(nil, "sk-legacy")
+	if err != nil || opened != "sk-legacy" {
+		t.Errorf("Open() = %q, %v; want sk-legacy, nil", opened, err)
+	}
+}
+
+func TestOpen_WrongKey(t *testing.T) {
+	sealed, _ := Seal([]byte(strings.Repeat("a", keySize)), "sk-secret")
+	if _, err := Open([]byte(strings.Repeat("b", keySize)), sealed); !errors.Is(err, ErrMalformed) {
+		t.Errorf("Open() with wrong key error = %v, want ErrMalformed", err)
+	}
+}
+
+func TestRotation_RetiredKeyStillUnwraps(t *testing.T) {
+	oldRing, _ := ParseKeyring("k1:" + testKey('a'))
+	dataKey, wrapped, _ := oldRing.NewDataKey()
+
+	rotated, _ := ParseKeyring("k2:" + testKey('b') + ",k1:" + testKey('a'))
+	unwrapped, err := rotated.Unwrap("k1", wrapped)
+	if err != nil || string(unwrapped) != string(dataKey) {
+		t.Fatalf("Unwrap() with retired key failed: %v", err)
+	}
+
+	rewrapped, err := rotated.Wrap(unwrapped)
+	if err != nil {
+		t.Fatalf("Wrap() error = %v", err)
+	}
+	if _, err := rotated.Unwrap("k2", rewrapped); err != nil {
+		t.Errorf("Unwrap() with active key error = %v", err)
+	}
+	if _, err := rotated.Unwrap("k3", rewrapped); !errors.Is(err, ErrUnknownKeyID) {
+		t.Errorf("Unwrap() unknown id error = %v, want ErrUnknownKeyID", err)
+	}
+}
@@ -9,16 +9,32 @@ type Client interface {
 	Do(*http.Request) (*http.Response, error)
 }
 
-type ClientFactory struct{}
+/* ClientFactory builds clients for user-influenced destinations; they go through the outbound guard */
+type ClientFactory struct {
+	guard *Guard
+}
 
 func NewClientFactory() *ClientFactory {
+	return &ClientFactory{guard: DefaultGuard()}
+}
+
+/* NewGuardedClientFactory builds clients with a specific guard instead of the default one */
+func NewGuardedClientFactory(guard *Guard) *ClientFactory {
+	return &ClientFactory{guard: guard}
+}
+
+/* NewTrustedClientFactory builds unguarded clients for operator-configured internal upstreams only */
+func NewTrustedClientFactory() *ClientFactory {
 	return &ClientFactory{}
 }
 
 func (f *ClientFactory) Create(timeout time.Duration) Client {
-	return &http.Client{
-		Timeout: timeout,
+	if f.guard == nil {
+		return &http.Client{
+			Timeout: timeout,
+		}
 	}
+	return f.guard.Client(timeout)
 }
 
 func (f *ClientFactory) CreateDefault() Client {
@@ -0,0 +1,294 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrBlockedScheme     = errors.New("URL scheme is not allowed")
+	ErrBlockedAddress    = errors.New("destination address is not allowed")
+	ErrTooManyRedirects  = errors.New("too many redirects")
+	ErrResponseTooLarge  = errors.New("response exceeds size limit")
+	errUnresolvedAddress = errors.New("host did not resolve")
+)
+
+/* IsBlocked reports whether err comes from the guard refusing a destination rather than from the upstream */
+func IsBlocked(err error) bool {
+	return errors.Is(err, ErrBlockedScheme) || errors.Is(err, ErrBlockedAddress) || errors.Is(err, ErrTooManyRedirects)
+}
+
+/* GuardPolicy decides which outbound requests a guarded client may make */
+type GuardPolicy struct {
+	Schemes []string
+	/* AllowCIDRs and AllowHosts ("ollama", "gpu-box:8000") exempt internal destinations from the private-range block */
+	AllowCIDRs       []netip.Prefix
+	AllowHosts       []string
+	MaxRedirects     int
+	MaxResponseBytes int64
+}
+
+/* DefaultGuardPolicy allows http(s) to public addresses only, 5 redirects and 32 MB responses */
+func DefaultGuardPolicy() GuardPolicy {
+	return GuardPolicy{
+		Schemes:          []string{"http", "https"},
+		MaxRedirects:     5,
+		MaxResponseBytes: 32 << 20,
+	}
+}
+
+/* ParseAllowlist reads "10.1.0.0/16,ollama,gpu-box:8000,192.168.1.20" into CIDRs and host names */
+func ParseAllowlist(spec string) ([]netip.Prefix, []string, error) {
+	var (
+		cidrs []netip.Prefix
+		hosts []string
+	)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if strings.Contains(entry, "/") {
+			prefix, err := netip.ParsePrefix(entry)
+			if err != nil {
+				return nil, nil, fmt.Errorf("allowlist entry %q: %w", entry, err)
+			}
+			cidrs = append(cidrs, prefix.Masked())
+			continue
+		}
+		if addr, err := netip.ParseAddr(entry); err == nil {
+			cidrs = append(cidrs, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		hosts = append(hosts, strings.ToLower(entry))
+	}
+	return cidrs, hosts, nil
+}
+
+/* carrierNAT (100.64.0.0/10) and thisNetwork (0.0.0.0/8) are not covered by netip's predicates */
+var (
+	carrierNAT  = netip.MustParsePrefix("100.64.0.0/10")
+	thisNetwork = netip.MustParsePrefix("0.0.0.0/8")
+)
+
+/* Guard resolves every destination itself and refuses private, loopback and link-local addresses */
+type Guard struct {
+	policy   GuardPolicy
+	resolver *net.Resolver
+	dialer   *net.Dialer
+}
+
+func NewGuard(policy GuardPolicy) *Guard {
+	return &Guard{
+		policy:   policy,
+		resolver: net.DefaultResolver,
+		dialer:   &net.Dialer{Timeout: 10 * time.Second, KeepAlive: 30 * time.Second},
+	}
+}
+
+var (
+	defaultGuardMu sync.RWMutex
+	defaultGuard   = NewGuard(DefaultGuardPolicy())
+)
+
+/* SetDefaultGuard replaces the guard used by NewClientFactory; call it once at startup */
+func SetDefaultGuard(guard *Guard) {
+	defaultGuardMu.Lock()
+	defer defaultGuardMu.Unlock()
+	defaultGuard = guard
+}
+
+/* DefaultGuard returns the guard used by NewClientFactory */
+func DefaultGuard() *Guard {
+	defaultGuardMu.RLock()
+	defer defaultGuardMu.RUnlock()
+	return defaultGuard
+}
+
+/* CheckURL validates the scheme and, for literal IPs, the address; host names are checked when dialed */
+func (g *Guard) CheckURL(u *url.URL) error {
+	if !g.schemeAllowed(u.Scheme) {
+		return fmt.Errorf("%w: %q", ErrBlockedScheme, u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return fmt.Errorf("%w: empty host", ErrBlockedAddress)
+	}
+	if g.hostAllowed(u.Host) {
+		return nil
+	}
+	if addr, err := netip.ParseAddr(u.Hostname()); err == nil && !g.addrAllowed(addr) {
+		return fmt.Errorf("%w: %s", ErrBlockedAddress, addr)
+	}
+	return nil
+}
+
+func (g *Guard) schemeAllowed(scheme string) bool {
+	for _, allowed := range g.policy.Schemes {
+		if strings.EqualFold(scheme, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+/* hostAllowed matches "host" or "host:port" against AllowHosts */
+func (g *Guard) hostAllowed(hostport string) bool {
+	hostport = strings.ToLower(hostport)
+	host := hostport
+	if h, _, err := net.SplitHostPort(hostport); err == nil {
+		host = h
+	}
+	for _, allowed := range g.policy.AllowHosts {
+		if allowed == host || allowed == hostport {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *Guard) addrAllowed(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range g.policy.AllowCIDRs {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return !(addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() ||
+		addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() || addr.IsMulticast() ||
+		addr.IsUnspecified() || carrierNAT.Contains(addr) || thisNetwork.Contains(addr))
+}
+
+/*
+DialContext resolves the host once, rejects the connection if any address is blocked and then
+dials the vetted IP, so a DNS answer cannot change between the check and the connect
+*/
+func (g *Guard) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	if g.hostAllowed(address) {
+		return g.dialer.DialContext(ctx, network, address)
+	}
+
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+
+	var addrs []netip.Addr
+	if addr, err := netip.ParseAddr(host); err == nil {
+		addrs = []netip.Addr{addr}
+	} else {
+		addrs, err = g.resolver.LookupNetIP(ctx, "ip", host)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("%s: %w", host, errUnresolvedAddress)
+	}
+	for _, addr := range addrs {
+		if !g.addrAllowed(addr) {
+			return nil, fmt.Errorf("%w: %s resolves to %s", ErrBlockedAddress, host, addr.Unmap())
+		}
+	}
+
+	var lastErr error
+	for _, addr := range addrs {
+		conn, err := g.dialer.DialContext(ctx, network, net.JoinHostPort(addr.Unmap().String(), port))
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+/* CheckRedirect caps the redirect chain and re-validates every hop; the dialer re-checks its addresses */
+func (g *Guard) CheckRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) > g.policy.MaxRedirects {
+		return fmt.Errorf("%w: more than %d", ErrTooManyRedirects, g.policy.MaxRedirects)
+	}
+	return g.CheckURL(req.URL)
+}
+
+/* Client builds an *http.Client whose every connection, redirect and response body goes through the guard */
+func (g *Guard) Client(timeout time.Duration) *http.Client {
+	transport := &http.Transport{
+		/* An environment proxy would dial on our behalf and bypass the address check */
+		Proxy:                 nil,
+		DialContext:           g.DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}
+	return &http.Client{
+		Timeout:       timeout,
+		Transport:     &guardedTransport{guard: g, next: transport},
+		CheckRedirect: g.CheckRedirect,
+	}
+}
+
+/* guardedTransport checks the initial URL and caps the response body */
+type guardedTransport struct {
+	guard *Guard
+	next  http.RoundTripper
+}
+
+func (t *guardedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.guard.CheckURL(req.URL); err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil || t.guard.policy.MaxResponseBytes <= 0 {
+		return resp, err
+	}
+
+	limit := t.guard.policy.MaxResponseBytes
+	if resp.ContentLength > limit {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w: %d bytes declared, limit %d", ErrResponseTooLarge, resp.ContentLength, limit)
+	}
+	resp.Body = &limitedBody{body: resp.Body, remaining: limit}
+	return resp, nil
+}
+
+/* limitedBody fails the read that crosses the limit instead of silently truncating */
+type limitedBody struct {
+	body      io.ReadCloser
+	remaining int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.remaining <= 0 {
+		/* Probe one byte so a body of exactly the limit still ends cleanly */
+		var probe [1]byte
+		n, err := b.body.Read(probe[:])
+		if n > 0 {
+			return 0, ErrResponseTooLarge
+		}
+		return 0, err
+	}
+	if int64(len(p)) > b.remaining {
+		p = p[:b.remaining]
+	}
+	n, err := b.body.Read(p)
+	b.remaining -= int64(n)
+	return n, err
+}
+
+func (b *limitedBody) Close() error {
+	return b.body.Close()
+}
@@ -0,0 +1,170 @@
+package http
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func loopbackGuard(policy GuardPolicy) *Guard {
+	policy.AllowCIDRs = append(policy.AllowCIDRs, netip.MustParsePrefix("127.0.0.0/8"))
+	return NewGuard(policy)
+}
+
+func TestParseAllowlist(t *testing.T) {
+	cidrs, hosts, err := ParseAllowlist(" 10.1.0.0/16, Ollama ,gpu-box:8000,192.168.1.20,")
+	if err != nil {
+		t.Fatalf("ParseAllowlist() error = %v", err)
+	}
+	if len(cidrs) != 2 || cidrs[0].String() != "10.1.0.0/16" || cidrs[1].String() != "192.168.1.20/32" {
+		t.Errorf("cidrs = %v", cidrs)
+	}
+	if strings.Join(hosts, ",") != "ollama,gpu-box:8000" {
+		t.Errorf("hosts = %v", hosts)
+	}
+
+	if _, _, err := ParseAllowlist("10.0.0.0/99"); err == nil {
+		t.Error("ParseAllowlist() expected error for an invalid CIDR")
+	}
+}
+
+func TestGuard_CheckURL(t *testing.T) {
+	cidrs, hosts, _ := ParseAllowlist("10.1.0.0/16,ollama")
+	policy := DefaultGuardPolicy()
+	policy.AllowCIDRs, policy.AllowHosts = cidrs, hosts
+	guard := NewGuard(policy)
+
+	tests := []struct {
+		url     string
+		blocked bool
+	}{
+		{"https://api.openai.com/v1", false},
+		{"http://8.8.8.8/", false},
+		{"ftp://example.com/file", true},
+		{"file:///etc/passwd", true},
+		{"http://127.0.0.1:8080/", true},
+		{"http://[::1]/", true},
+		{"http://169.254.169.254/latest/meta-data", true},
+		{"http://192.168.0.10/", true},
+		{"http://100.64.0.1/", true},
+		{"http://0.0.0.0/", true},
+		{"http://[::ffff:10.0.0.1]/", true},
+		{"http://[fd00::1]/", true},
+		{"http://10.1.2.3/", false},
+		{"http://ollama:11434/v1", false},
+	}
+
+	for _, tt := range tests {
+		u, _ := url.Parse(tt.url)
+		err := guard.CheckURL(u)
+		if (err != nil) != tt.blocked {
+			t.Errorf("CheckURL(%s) error = %v, blocked want %t", tt.url, err, tt.blocked)
+		}
+		if err != nil && !IsBlocked(err) {
+			t.Errorf("CheckURL(%s) error %v should satisfy IsBlocked", tt.url, err)
+		}
+	}
+}
+
+func TestGuard_BlocksResolvedPrivateAddress(t *testing.T) {
+	client := NewGuard(DefaultGuardPolicy()).Client(time.Second)
+
+	/* localhost only resolves to loopback addresses, so the dialer must refuse it */
+	_, err := client.Get("http://localhost:1/")
+	if !errors.Is(err, ErrBlockedAddress) {
+		t.Errorf("Get(localhost) error = %v, want ErrBlockedAddress", err)
+	}
+}
+
+func TestGuard_RevalidatesRedirects(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/metadata":
+			http.Redirect(w, r, "http://169.254.169.254/latest/meta-data", http.StatusFound)
+		case "/scheme":
+			http.Redirect(w, r, "gopher://example.com/", http.StatusFound)
+		case "/loop":
+			http.Redirect(w, r, "/loop", http.StatusFound)
+		default:
+			_, _ = w.Write([]byte("ok"))
+		}
+	}))
+	defer server.Close()
+
+	policy := DefaultGuardPolicy()
+	policy.MaxRedirects = 3
+	client := loopbackGuard(policy).Client(time.Second)
+
+	tests := []struct {
+		path string
+		want error
+	}{
+		{"/metadata", ErrBlockedAddress},
+		{"/scheme", ErrBlockedScheme},
+		{"/loop", ErrTooManyRedirects},
+	}
+	for _, tt := range tests {
+		_, err := client.Get(server.URL + tt.path)
+		if !errors.Is(err, tt.want) {
+			t.Errorf("Get(%s) error = %v, want %v", tt.path, err, tt.want)
+		}
+	}
+
+	resp, err := client.Get(server.URL + "/ok")
+	if err != nil {
+		t.Fatalf("allowlisted request failed: %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestGuard_CapsResponseSize(t *testing.T) {
+	payload := strings.Repeat("x", 64)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/chunked" {
+			/* Flushing forces chunked encoding, so no Content-Length is declared */
+			w.(http.Flusher).Flush()
+		}
+		_, _ = w.Write([]byte(payload))
+	}))
+	defer server.Close()
+
+	policy := DefaultGuardPolicy()
+	policy.MaxResponseBytes = 32
+	client := loopbackGuard(policy).Client(time.Second)
+
+	if _, err := client.Get(server.URL + "/declared"); !errors.Is(err, ErrResponseTooLarge) {
+		t.Errorf("declared oversize error = %v, want ErrResponseTooLarge", err)
+	}
+
+	resp, err := client.Get(server.URL + "/chunked")
+	if err != nil {
+		t.Fatalf("chunked request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if _, err := io.ReadAll(resp.Body); !errors.Is(err, ErrResponseTooLarge) {
+		t.Errorf("chunked oversize read error = %v, want ErrResponseTooLarge", err)
+	}
+
+	policy.MaxResponseBytes = int64(len(payload))
+	resp, err = loopbackGuard(policy).Client(time.Second).Get(server.URL + "/chunked")
+	if err != nil {
+		t.Fatalf("request at the limit failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if body, err := io.ReadAll(resp.Body); err != nil || string(body) != payload {
+		t.Errorf("body at the limit = %d bytes, err %v", len(body), err)
+	}
+}
+
+func TestClientFactory_TrustedIsUnguarded(t *testing.T) {
+	client, ok := NewTrustedClientFactory().Create(time.Second).(*http.Client)
+	if !ok || client.Transport != nil || client.CheckRedirect != nil {
+		t.Error("trusted factory should build a plain client")
+	}
+}
@@ -3,6 +3,7 @@ package common
 import (
 	"backend-v2/internal/config"
 	"backend-v2/internal/models"
+	"errors"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -28,21 +29,48 @@ type UserInfoData struct {
 	Email       string `json:"email"`
 }
 
-/* GenerateAuth creates JWT tokens and auth response */
-func GenerateAuth(user *models.User) (*AuthResponse, error) {
+/* RefreshTokenType marks refresh tokens so they are never taken for access tokens */
+const RefreshTokenType = "refresh"
+
+/* RefreshClaims identify one refresh token: its session (token family) and its place in the rotation */
+type RefreshClaims struct {
+	Subject   string
+	SessionID string
+	TokenID   string
+	ExpiresAt time.Time
+}
+
+/*
+GenerateAuth creates an access token bound to refresh.SessionID and the refresh token
+described by refresh. Both are HS256; the refresh token carries only what rotation needs.
+*/
+func GenerateAuth(user *models.User, refresh RefreshClaims) (*AuthResponse, error) {
 	expiresIn := int64(86400) // 24 hours
+	now := time.Now()
 
 	claims := jwt.MapClaims{
 		"sub":            user.Name,
+		"sid":            refresh.SessionID,
 		"roles":          user.Roles,
 		"limitWorkflows": user.LimitWorkflows,
 		"limitNodes":     user.LimitNodes,
-		"exp":            time.Now().Add(time.Duration(expiresIn) * time.Second).Unix(),
-		"iat":            time.Now().Unix(),
+		"exp":            now.Add(time.Duration(expiresIn) * time.Second).Unix(),
+		"iat":            now.Unix(),
+	}
+
+	tokenString, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(config.JwtSecret))
+	if err != nil {
+		return nil, err
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString([]byte(config.JwtSecret))
+	refreshString, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": refresh.Subject,
+		"sid": refresh.SessionID,
+		"jti": refresh.TokenID,
+		"typ": RefreshTokenType,
+		"exp": refresh.ExpiresAt.Unix(),
+		"iat": now.Unix(),
+	}).SignedString([]byte(config.JwtSecret))
 	if err != nil {
 		return nil, err
 	}
@@ -59,6 +87,45 @@ func GenerateAuth(user *models.User) (*AuthResponse, error) {
 		},
 		AccessToken:  tokenString,
 		ExpiresIn:    expiresIn,
-		RefreshToken: tokenString,
+		RefreshToken: refreshString,
 	}, nil
 }
+
+/*
+ParseRefreshToken verifies a refresh token and returns its claims. Tokens from before
+sessions existed, and access tokens, carry no session or type and are refused.
+*/
+func ParseRefreshToken(tokenString string) (*RefreshClaims, error) {
+	token, err := jwt.Parse(tokenString, func(t *jwt.Token) (interface{}, error) {
+		/* Enforce HS256 algorithm */
+		if t.Method.Alg() != "HS256" {
+			return nil, errors.New("unexpected signing method")
+		}
+		return []byte(config.JwtSecret), nil
+	}, jwt.WithExpirationRequired())
+	if err != nil || !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, errors.New("invalid token claims")
+	}
+	if typ, _ := claims["typ"].(string); typ != RefreshTokenType {
+		return nil, errors.New("not a refresh token")
+	}
+
+	parsed := &RefreshClaims{}
+	parsed.Subject, _ = claims["sub"].(string)
+	parsed.SessionID, _ = claims["sid"].(string)
+	parsed.TokenID, _ = claims["jti"].(string)
+	if parsed.Subject == "" || parsed.SessionID == "" || parsed.TokenID == "" {
+		return nil, errors.New("refresh token without session")
+	}
+	exp, err := claims.GetExpirationTime()
+	if err != nil || exp == nil {
+		return nil, errors.New("invalid token expiration")
+	}
+	parsed.ExpiresAt = exp.Time
+	return parsed, nil
+}
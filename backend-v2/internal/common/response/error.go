@@ -28,6 +28,22 @@ func NotFound(c *fiber.Ctx, message string) error {
 	return sendError(c, fiber.StatusNotFound, message)
 }
 
+func Conflict(c *fiber.Ctx, message string) error {
+	return sendError(c, fiber.StatusConflict, message)
+}
+
 func InternalError(c *fiber.Ctx, message string) error {
 	return sendError(c, fiber.StatusInternalServerError, message)
 }
+
+func TooManyRequests(c *fiber.Ctx, message string) error {
+	return sendError(c, fiber.StatusTooManyRequests, message)
+}
+
+func BadGateway(c *fiber.Ctx, message string) error {
+	return sendError(c, fiber.StatusBadGateway, message)
+}
+
+func ServiceUnavailable(c *fiber.Ctx, message string) error {
+	return sendError(c, fiber.StatusServiceUnavailable, message)
+}
@@ -19,6 +19,45 @@ var (
 	MongoURI      string
 	SyncUserID    string
 	ApiRoot       string
+
+	/* LLMProxyKeyMode controls explicit client keys: "client" forwards them, "server" only for key validation */
+	LLMProxyKeyMode string
+
+	/* IntegrationEncryptionKeys lists master keys as "id:base64key,..."; the first one encrypts new records */
+	IntegrationEncryptionKeys string
+
+	/* LLMRateLimits enables per-role LLM limits, e.g. "default" or "subscriber:rpm=30,burst=10,day=100000,month=0"; unset limits nobody */
+	LLMRateLimits string
+	/* LLMRateLimitStore selects where request-rate state lives: "mongo" (shared) or "memory" */
+	LLMRateLimitStore string
+
+	/* LLMRouting lists fallbacks per provider or model, e.g. "openai:gpt-4o=claude:claude-sonnet-4,deepseek:deepseek-chat" */
+	LLMRouting string
+	/* LLMResilience tunes upstream retries and circuit breaking, e.g. "attempts=3,backoff=200ms,breakerFailures=5" */
+	LLMResilience string
+
+	/* LocalLLMBaseURL is the server's own OpenAI-compatible endpoint (Ollama, vLLM), e.g. "http://ollama:11434/v1" */
+	LocalLLMBaseURL string
+
+	/* LLMProvidersFile and LLMProviders (inline JSON) override provider endpoints and models; see llmcatalog/defaults.json */
+	LLMProvidersFile string
+	LLMProviders     string
+
+	/* LLMCacheStore enables the response cache for deterministic requests: "memory" (per instance LRU) or "mongo"; empty disables */
+	LLMCacheStore string
+	/* LLMCache tunes the response cache, e.g. "ttl=30m,entryBytes=262144,entries=10000,bytes=67108864" */
+	LLMCache string
+
+	/* OutboundAllowlist exempts internal destinations from the outbound request guard, e.g. "10.1.0.0/16,ollama,gpu-box:8000" */
+	OutboundAllowlist string
+
+	/* VectorIndex tunes the in-process nearest-neighbour index, e.g. "bytes=268435456,m=16,ef=64,recallSample=0.05" */
+	VectorIndex string
+	/* VectorIndexDir keeps index snapshots so restarts skip rebuilding; empty keeps indexes in memory only */
+	VectorIndexDir string
+
+	/* Sessions tunes sign-in sessions, e.g. "refresh=24h,lifetime=720h,grace=30s"; see auth.ParseSessionPolicy */
+	Sessions string
 )
 
 func init() {
@@ -36,6 +75,21 @@ func init() {
 	JwtSecret = getEnv("JWT_SECRET", "test-jwt-secret-change-in-production")
 	SyncUserID = getEnv("SYNC_USER_ID", "wp-sync-user")
 	ApiRoot = getEnv("API_ROOT", "/")
+	LLMProxyKeyMode = getEnv("LLM_PROXY_KEY_MODE", "client")
+	IntegrationEncryptionKeys = getEnv("INTEGRATION_ENCRYPTION_KEYS", "")
+	LLMRateLimits = getEnv("LLM_RATE_LIMITS", "")
+	LLMRateLimitStore = getEnv("LLM_RATE_LIMIT_STORE", "mongo")
+	LLMRouting = getEnv("LLM_ROUTING", "")
+	LLMResilience = getEnv("LLM_RESILIENCE", "")
+	LocalLLMBaseURL = getEnv("LOCAL_LLM_BASE_URL", "")
+	LLMProvidersFile = getEnv("LLM_PROVIDERS_FILE", "")
+	LLMProviders = getEnv("LLM_PROVIDERS", "")
+	LLMCacheStore = getEnv("LLM_CACHE_STORE", "")
+	LLMCache = getEnv("LLM_CACHE", "")
+	OutboundAllowlist = getEnv("OUTBOUND_ALLOWLIST", "")
+	VectorIndex = getEnv("VECTOR_INDEX", "")
+	VectorIndexDir = getEnv("VECTOR_INDEX_DIR", "")
+	Sessions = getEnv("SESSIONS", "")
 
 	if envMongoURI := os.Getenv("MONGO_URI"); envMongoURI != "" {
 		MongoURI = envMongoURI
@@ -55,6 +109,21 @@ func init() {
 	log.Printf("MONGO_HOST=%s", MongoHost)
 	log.Printf("MONGO_PORT=%s", MongoPort)
 	log.Printf("MONGO_URI=%s", MongoURI)
+	log.Printf("LLM_PROXY_KEY_MODE=%s", LLMProxyKeyMode)
+	log.Printf("INTEGRATION_ENCRYPTION=%t", IntegrationEncryptionKeys != "")
+	log.Printf("LLM_RATE_LIMITS=%s", LLMRateLimits)
+	log.Printf("LLM_RATE_LIMIT_STORE=%s", LLMRateLimitStore)
+	log.Printf("LLM_ROUTING=%s", LLMRouting)
+	log.Printf("LLM_RESILIENCE=%s", LLMResilience)
+	log.Printf("LOCAL_LLM_BASE_URL=%s", LocalLLMBaseURL)
+	log.Printf("LLM_PROVIDERS_FILE=%s", LLMProvidersFile)
+	log.Printf("LLM_PROVIDERS=%t", LLMProviders != "")
+	log.Printf("LLM_CACHE_STORE=%s", LLMCacheStore)
+	log.Printf("LLM_CACHE=%s", LLMCache)
+	log.Printf("OUTBOUND_ALLOWLIST=%s", OutboundAllowlist)
+	log.Printf("VECTOR_INDEX=%s", VectorIndex)
+	log.Printf("VECTOR_INDEX_DIR=%s", VectorIndexDir)
+	log.Printf("SESSIONS=%s", Sessions)
 }
 
 func getEnv(key, fallback string) string {
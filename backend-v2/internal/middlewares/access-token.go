@@ -0,0 +1,60 @@
+package middlewares
+
+import (
+	"context"
+	"strings"
+
+	"backend-v2/internal/common/response"
+	"backend-v2/internal/config"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+/* AccessTokenResolver looks up personal access tokens; the accesstoken module installs one at startup */
+type AccessTokenResolver interface {
+	/* Resolve records a use of token and returns its user's claims shaped like a JWT's, or nil if it is unknown or expired */
+	Resolve(ctx context.Context, token, ip string) (jwt.MapClaims, error)
+	/* Allows reports whether the token behind claims may call method on path, relative to the API root */
+	Allows(claims jwt.MapClaims, method, path string) bool
+}
+
+var accessTokens AccessTokenResolver
+
+/* UseAccessTokens lets JWTMiddleware accept personal access tokens as Bearer tokens */
+func UseAccessTokens(resolver AccessTokenResolver) {
+	accessTokens = resolver
+}
+
+/* accessTokenAuth stands in for JWT parsing when the Bearer token is a personal access token */
+func accessTokenAuth(c *fiber.Ctx, token string) error {
+	if accessTokens == nil {
+		c.Locals("jwtOriginalError", "access tokens are not accepted")
+		return c.Next()
+	}
+
+	/* JWTMiddleware runs for more than one route group, so the token is resolved once per request */
+	claims, ok := c.Locals("auth").(jwt.MapClaims)
+	if !ok || claims["pat"] == nil {
+		var err error
+		claims, err = accessTokens.Resolve(c.Context(), token, c.IP())
+		if err != nil {
+			return response.InternalError(c, "Failed to check access token")
+		}
+		if claims == nil {
+			c.Locals("jwtOriginalError", "access token is invalid or expired")
+			return c.Next()
+		}
+	}
+
+	path := strings.TrimPrefix(c.Path(), strings.TrimSuffix(config.ApiRoot, "/"))
+	if !accessTokens.Allows(claims, c.Method(), path) {
+		return response.Forbidden(c, "Access token scopes do not cover this route")
+	}
+
+	c.Locals("auth", claims)
+	if sub, ok := claims["sub"].(string); ok {
+		c.Locals("userId", sub)
+	}
+	return c.Next()
+}
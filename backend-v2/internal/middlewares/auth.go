@@ -1,7 +1,10 @@
 package middlewares
 
 import (
+	"backend-v2/internal/common"
+	"backend-v2/internal/common/response"
 	"backend-v2/internal/config"
+	"backend-v2/internal/models"
 	"errors"
 	"strings"
 	"time"
@@ -78,6 +81,11 @@ func JWTMiddleware(c *fiber.Ctx) error {
 		return c.Next()
 	}
 
+	/* Personal access tokens come as Bearer tokens and are looked up rather than parsed */
+	if strings.HasPrefix(tokenStr, models.AccessTokenPrefix) && c.Cookies("auth") == "" {
+		return accessTokenAuth(c, tokenStr)
+	}
+
 	/* Strict JWT parsing with algorithm validation */
 	token, err := jwt.Parse(tokenStr, func(t *jwt.Token) (interface{}, error) {
 		/* Enforce HS256 algorithm only */
@@ -134,6 +142,12 @@ func JWTMiddleware(c *fiber.Ctx) error {
 		}
 	}
 
+	/* Refresh tokens only buy new access tokens at /auth/refresh */
+	if typ, _ := claims["typ"].(string); typ == common.RefreshTokenType {
+		c.Locals("jwtOriginalError", "refresh token used as access token")
+		return c.Next()
+	}
+
 	/* Validate subject exists and is not empty */
 	sub, ok := claims["sub"].(string)
 	if !ok || sub == "" {
@@ -208,6 +222,18 @@ func JWTMiddleware(c *fiber.Ctx) error {
 		}
 	}
 
+	/* Access tokens end with their session, so revoking it signs them out too */
+	if sid, _ := claims["sid"].(string); sid != "" && sessions != nil {
+		active, err := sessions.Active(c.Context(), sub, sid)
+		if err != nil {
+			return response.InternalError(c, "Failed to check session")
+		}
+		if !active {
+			c.Locals("jwtOriginalError", "session has ended")
+			return c.Next()
+		}
+	}
+
 	c.Locals("auth", claims)
 
 	/* Extract and set userID from subject claim */
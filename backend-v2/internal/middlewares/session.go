@@ -0,0 +1,18 @@
+package middlewares
+
+import (
+	"context"
+)
+
+/* SessionChecker tells whether a sign-in session is still open; the auth module installs one at startup */
+type SessionChecker interface {
+	/* Active reports whether the user's session exists and is neither revoked nor expired */
+	Active(ctx context.Context, userID, sessionID string) (bool, error)
+}
+
+var sessions SessionChecker
+
+/* UseSessions makes JWTMiddleware reject access tokens whose session has ended */
+func UseSessions(checker SessionChecker) {
+	sessions = checker
+}
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+/* AccessTokenPrefix starts every personal access token, telling it apart from a JWT */
+const AccessTokenPrefix = "d5p_"
+
+/* AccessToken is a personal access token for scripts; only the SHA-256 hash of the secret is stored */
+type AccessToken struct {
+	ID     primitive.ObjectID `json:"id" bson:"_id"`
+	UserID string             `json:"-" bson:"userId"`
+	Name   string             `json:"name" bson:"name"`
+	/* Prefix is the start of the token, enough to recognise it in a list */
+	Prefix     string     `json:"prefix" bson:"prefix"`
+	Hash       string     `json:"-" bson:"hash"`
+	Scopes     []string   `json:"scopes" bson:"scopes"`
+	ExpiresAt  time.Time  `json:"expiresAt" bson:"expiresAt"`
+	CreatedAt  time.Time  `json:"createdAt" bson:"createdAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty" bson:"lastUsedAt,omitempty"`
+	LastUsedIP string     `json:"lastUsedIp,omitempty" bson:"lastUsedIp,omitempty"`
+}
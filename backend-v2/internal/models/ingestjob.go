@@ -0,0 +1,66 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type IngestJobStatus string
+
+const (
+	IngestJobPending   IngestJobStatus = "pending"
+	IngestJobRunning   IngestJobStatus = "running"
+	IngestJobSucceeded IngestJobStatus = "succeeded"
+	IngestJobFailed    IngestJobStatus = "failed"
+)
+
+/* Kinds of ingest job; jobs stored without a kind are documents */
+const (
+	IngestKindDocument = "document"
+	IngestKindReembed  = "reembed"
+)
+
+/* Stages a running ingest job reports, in order */
+const (
+	IngestStageFetching   = "fetching"
+	IngestStageExtracting = "extracting"
+	IngestStageEmbedding  = "embedding"
+	IngestStageSaving     = "saving"
+)
+
+/*
+IngestJob turns one document (a workflow file, a URL or raw text) into vectors of a context.
+Exactly one of FileID, URL and Text is set; Text is dropped once the job finishes. A reembed
+job instead embeds the vectors a type already holds again, with Provider and Model.
+*/
+type IngestJob struct {
+	ID          primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
+	Kind        string             `json:"kind" bson:"kind,omitempty"`
+	UserID      string             `json:"userId" bson:"userId"`
+	ContextName *string            `json:"contextName" bson:"contextName"`
+	Type        string             `json:"type" bson:"type"`
+	Provider    string             `json:"provider" bson:"provider"`
+	Model       string             `json:"model,omitempty" bson:"model,omitempty"`
+	Source      string             `json:"source" bson:"source"`
+
+	FileID      string `json:"fileId,omitempty" bson:"fileId,omitempty"`
+	URL         string `json:"url,omitempty" bson:"url,omitempty"`
+	Text        string `json:"-" bson:"text,omitempty"`
+	ContentType string `json:"contentType,omitempty" bson:"contentType,omitempty"`
+
+	ChunkSize    int  `json:"chunkSize,omitempty" bson:"chunkSize,omitempty"`
+	ChunkOverlap int  `json:"chunkOverlap,omitempty" bson:"chunkOverlap,omitempty"`
+	Keep         bool `json:"keep" bson:"keep"`
+
+	Status   IngestJobStatus `json:"status" bson:"status"`
+	Stage    string          `json:"stage,omitempty" bson:"stage,omitempty"`
+	Chunks   int             `json:"chunks" bson:"chunks"`
+	Embedded int             `json:"embedded" bson:"embedded"`
+	Attempts int             `json:"attempts" bson:"attempts"`
+	Error    string          `json:"error,omitempty" bson:"error,omitempty"`
+
+	CreatedAt  time.Time  `json:"createdAt" bson:"createdAt"`
+	UpdatedAt  time.Time  `json:"updatedAt" bson:"updatedAt"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty" bson:"finishedAt,omitempty"`
+}
@@ -1,5 +1,7 @@
 package models
 
+import "time"
+
 type OpenAIConfig struct {
 	APIKey string `json:"apiKey" bson:"apiKey"`
 	Model  string `json:"model,omitempty" bson:"model,omitempty"`
@@ -41,6 +43,34 @@ type CustomLLMConfig struct {
 	APIKey              string `json:"apiKey,omitempty" bson:"apiKey,omitempty"`
 }
 
+/* LocalLLMConfig points at a self-hosted OpenAI-compatible server (Ollama, vLLM); BaseURL includes the /v1 prefix */
+type LocalLLMConfig struct {
+	BaseURL string `json:"baseUrl,omitempty" bson:"baseUrl,omitempty"`
+	APIKey  string `json:"apiKey,omitempty" bson:"apiKey,omitempty"`
+	Model   string `json:"model,omitempty" bson:"model,omitempty"`
+}
+
+/* IntegrationEncryption records the wrapped per-record data key protecting the provider API keys */
+type IntegrationEncryption struct {
+	KeyID   string `json:"keyId" bson:"keyId"`
+	DataKey string `json:"dataKey" bson:"dataKey"`
+}
+
+/* Health statuses recorded by the credential check */
+const (
+	HealthValid       = "valid"
+	HealthInvalid     = "invalid"
+	HealthUnreachable = "unreachable"
+)
+
+/* IntegrationHealth is the outcome of the last credential check of one service */
+type IntegrationHealth struct {
+	Status    string    `json:"status" bson:"status"`
+	CheckedAt time.Time `json:"checkedAt" bson:"checkedAt"`
+	Error     string    `json:"error,omitempty" bson:"error,omitempty"`
+	Models    []string  `json:"models,omitempty" bson:"models,omitempty"`
+}
+
 type Integration struct {
 	ID         string            `json:"_id,omitempty" bson:"_id,omitempty"`
 	UserID     string            `json:"userId" bson:"userId"`
@@ -51,6 +81,15 @@ type Integration struct {
 	Deepseek   *DeepseekConfig   `json:"deepseek,omitempty" bson:"deepseek,omitempty"`
 	CustomLLM  *CustomLLMConfig  `json:"custom_llm,omitempty" bson:"custom_llm,omitempty"`
 	Perplexity *PerplexityConfig `json:"perplexity,omitempty" bson:"perplexity,omitempty"`
+	Local      *LocalLLMConfig   `json:"local,omitempty" bson:"local,omitempty"`
 	Lang       string            `json:"lang" bson:"lang"`
 	Model      string            `json:"model" bson:"model"`
+
+	/* Fallbacks lists "provider:model" targets the LLM proxy tries when the requested provider fails */
+	Fallbacks []string `json:"fallbacks,omitempty" bson:"fallbacks,omitempty"`
+
+	/* Health maps each checked service to its last credential check */
+	Health map[string]IntegrationHealth `json:"health,omitempty" bson:"health,omitempty"`
+
+	Encryption *IntegrationEncryption `json:"-" bson:"encryption,omitempty"`
 }
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+/* LLMUsage aggregates the tokens one user spent on one provider model during one UTC day */
+type LLMUsage struct {
+	ID               string    `json:"_id,omitempty" bson:"_id,omitempty"`
+	UserID           string    `json:"userId" bson:"userId"`
+	Provider         string    `json:"provider" bson:"provider"`
+	Model            string    `json:"model" bson:"model"`
+	Day              string    `json:"day" bson:"day"`
+	Requests         int64     `json:"requests" bson:"requests"`
+	PromptTokens     int64     `json:"promptTokens" bson:"promptTokens"`
+	CompletionTokens int64     `json:"completionTokens" bson:"completionTokens"`
+	TotalTokens      int64     `json:"totalTokens" bson:"totalTokens"`
+	UpdatedAt        time.Time `json:"updatedAt" bson:"updatedAt"`
+}
@@ -6,19 +6,86 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-/* Vector item with content and optional embedding */
+/*
+Vector item with content and optional embedding. Model names the model that produced the
+embedding, empty when unknown; Dimension is the embedding's length, filled in on save.
+*/
 type MemoryVector struct {
 	Content   string                 `json:"content" bson:"content"`
 	Embedding []float64              `json:"embedding,omitempty" bson:"embedding,omitempty"`
+	Model     string                 `json:"model,omitempty" bson:"model,omitempty"`
+	Dimension int                    `json:"dimension,omitempty" bson:"dimension,omitempty"`
 	Metadata  map[string]interface{} `json:"metadata,omitempty" bson:"metadata,omitempty"`
 }
 
-/* LLMVector stores AI context data in nested structure: store[type][source][]vectors */
+/*
+LLMVector is a context header in "llmvectors"; its vectors live one per document in
+"llmvectorchunks". Types and Sources record the layout, including types and sources without
+vectors, and Embeddings the model and dimension each type's embeddings share. Store is
+assembled on read as store[type][source][]vectors; in Mongo it only holds data written before
+the split that has not been migrated yet.
+*/
 type LLMVector struct {
-	ID        primitive.ObjectID                   `json:"_id,omitempty" bson:"_id,omitempty"`
-	UserID    string                               `json:"userId" bson:"userId"`
-	Name      *string                              `json:"name" bson:"name"` // Nullable
-	Store     map[string]map[string][]MemoryVector `json:"store" bson:"store"`
-	CreatedAt time.Time                            `json:"createdAt" bson:"createdAt"`
-	UpdatedAt time.Time                            `json:"updatedAt" bson:"updatedAt"`
+	ID         primitive.ObjectID                   `json:"_id,omitempty" bson:"_id,omitempty"`
+	UserID     string                               `json:"userId" bson:"userId"`
+	Name       *string                              `json:"name" bson:"name"` // Nullable
+	Types      []string                             `json:"-" bson:"types,omitempty"`
+	Sources    []VectorSource                       `json:"-" bson:"sources,omitempty"`
+	Embeddings []EmbeddingSpec                      `json:"embeddings,omitempty" bson:"embeddings,omitempty"`
+	Store      map[string]map[string][]MemoryVector `json:"store" bson:"store,omitempty"`
+	Share      *VectorShare                         `json:"share,omitempty" bson:"share,omitempty"`
+	Retention  *VectorRetention                     `json:"retention,omitempty" bson:"retention,omitempty"`
+	CreatedAt  time.Time                            `json:"createdAt" bson:"createdAt"`
+	UpdatedAt  time.Time                            `json:"updatedAt" bson:"updatedAt"`
+	/* LastUsedAt is the last read or write by a user; contexts from before it was tracked fall back to UpdatedAt */
+	LastUsedAt time.Time `json:"lastUsedAt,omitempty" bson:"lastUsedAt,omitempty"`
+}
+
+/* VectorRetention bounds how long and how large a context lives; zero values leave that bound off */
+type VectorRetention struct {
+	/* TTL removes the context once it has been neither read nor written for this many seconds */
+	TTL int64 `json:"ttl,omitempty" bson:"ttl,omitempty"`
+	/* MaxVectors caps the context's vectors, evicting the oldest first */
+	MaxVectors int64 `json:"maxVectors,omitempty" bson:"maxVectors,omitempty"`
+	/* Sources expire each vector of a source a number of seconds after it was written */
+	Sources []SourceRetention `json:"sources,omitempty" bson:"sources,omitempty"`
+}
+
+/* SourceRetention is the TTL, in seconds, of one store[type][source] slot's vectors */
+type SourceRetention struct {
+	Type   string `json:"type" bson:"type"`
+	Source string `json:"source" bson:"source"`
+	TTL    int64  `json:"ttl" bson:"ttl"`
+}
+
+/* VectorShare grants other users, mail addresses or groups reader or contributor access to a context */
+type VectorShare struct {
+	Access []RoleBinding `json:"access" bson:"access"`
+}
+
+/* VectorSource is one store[type][source] slot of a context */
+type VectorSource struct {
+	Type   string `json:"type" bson:"type"`
+	Source string `json:"source" bson:"source"`
+}
+
+/* EmbeddingSpec is the model and dimension of one type's embeddings; Model is empty when unknown */
+type EmbeddingSpec struct {
+	Type      string `json:"type" bson:"type"`
+	Model     string `json:"model,omitempty" bson:"model,omitempty"`
+	Dimension int    `json:"dimension" bson:"dimension"`
+}
+
+/* LLMVectorChunk is one vector of a context, addressed by user, context name, type and source; _id order is append order */
+type LLMVectorChunk struct {
+	ID           primitive.ObjectID `bson:"_id"`
+	UserID       string             `bson:"userId"`
+	Context      *string            `bson:"context"`
+	Type         string             `bson:"type"`
+	Source       string             `bson:"source"`
+	MemoryVector `bson:",inline"`
+	/* Hash is the SHA-256 of Content, set when there is content, so appends can skip repeats */
+	Hash string `bson:"hash,omitempty"`
+	/* Legacy marks chunks split out of a nested store so an interrupted migration can be rerun */
+	Legacy bool `bson:"legacy,omitempty"`
 }
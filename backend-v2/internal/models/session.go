@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+)
+
+/*
+Session is one sign-in. Its refresh tokens form a family: every refresh replaces TokenID,
+so a token presented again after rotation shows the family was copied.
+*/
+type Session struct {
+	ID     string `json:"id" bson:"_id"`
+	UserID string `json:"userId" bson:"userId"`
+	/* TokenID is the jti of the one refresh token that may rotate next */
+	TokenID         string     `json:"-" bson:"tokenId"`
+	PreviousTokenID string     `json:"-" bson:"previousTokenId,omitempty"`
+	RotatedAt       time.Time  `json:"rotatedAt" bson:"rotatedAt"`
+	CreatedAt       time.Time  `json:"createdAt" bson:"createdAt"`
+	LastUsedAt      time.Time  `json:"lastUsedAt" bson:"lastUsedAt"`
+	ExpiresAt       time.Time  `json:"expiresAt" bson:"expiresAt"`
+	RevokedAt       *time.Time `json:"revokedAt,omitempty" bson:"revokedAt,omitempty"`
+	RevokedReason   string     `json:"revokedReason,omitempty" bson:"revokedReason,omitempty"`
+	UserAgent       string     `json:"userAgent,omitempty" bson:"userAgent,omitempty"`
+	IP              string     `json:"ip,omitempty" bson:"ip,omitempty"`
+	/* Current marks the session of the token that listed it */
+	Current bool `json:"current" bson:"-"`
+}
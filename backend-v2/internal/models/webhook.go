@@ -0,0 +1,44 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+/* WebhookSubscription registers an HTTP endpoint for a set of event types */
+type WebhookSubscription struct {
+	ID        primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
+	UserID    string             `json:"userId" bson:"userId"`
+	URL       string             `json:"url" bson:"url"`
+	Events    []string           `json:"events" bson:"events"`
+	Secret    string             `json:"secret,omitempty" bson:"secret"`
+	Active    bool               `json:"active" bson:"active"`
+	CreatedAt time.Time          `json:"createdAt" bson:"createdAt"`
+	UpdatedAt time.Time          `json:"updatedAt" bson:"updatedAt"`
+}
+
+type WebhookDeliveryStatus string
+
+const (
+	WebhookDeliveryPending    WebhookDeliveryStatus = "pending"
+	WebhookDeliveryInProgress WebhookDeliveryStatus = "in_progress"
+	WebhookDeliverySucceeded  WebhookDeliveryStatus = "succeeded"
+	WebhookDeliveryFailed     WebhookDeliveryStatus = "failed"
+)
+
+/* WebhookDelivery logs a single event sent to a subscription, including every retry */
+type WebhookDelivery struct {
+	ID             primitive.ObjectID    `json:"_id,omitempty" bson:"_id,omitempty"`
+	SubscriptionID primitive.ObjectID    `json:"subscriptionId" bson:"subscriptionId"`
+	EventID        string                `json:"eventId" bson:"eventId"`
+	EventType      string                `json:"eventType" bson:"eventType"`
+	Payload        string                `json:"payload" bson:"payload"`
+	Status         WebhookDeliveryStatus `json:"status" bson:"status"`
+	Attempts       int                   `json:"attempts" bson:"attempts"`
+	ResponseStatus int                   `json:"responseStatus,omitempty" bson:"responseStatus,omitempty"`
+	LastError      string                `json:"lastError,omitempty" bson:"lastError,omitempty"`
+	NextAttemptAt  time.Time             `json:"nextAttemptAt" bson:"nextAttemptAt"`
+	CreatedAt      time.Time             `json:"createdAt" bson:"createdAt"`
+	UpdatedAt      time.Time             `json:"updatedAt" bson:"updatedAt"`
+}
@@ -0,0 +1,71 @@
+package accesstoken
+
+import (
+	"backend-v2/internal/common/constants"
+	"backend-v2/internal/common/response"
+	"backend-v2/internal/models"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Controller struct {
+	service *Service
+}
+
+func NewController(service *Service) *Controller {
+	return &Controller{service: service}
+}
+
+/* GET /auth/tokens - list the caller's tokens (secrets are never stored) */
+func (ctrl *Controller) List(c *fiber.Ctx) error {
+	userID, _ := c.Locals(constants.ContextUserIDKey).(string)
+
+	tokens, err := ctrl.service.List(c.Context(), userID)
+	if err != nil {
+		return response.InternalError(c, err.Error())
+	}
+	return c.JSON(tokens)
+}
+
+/* POST /auth/tokens - issue a token; its secret is only returned here */
+func (ctrl *Controller) Create(c *fiber.Ctx) error {
+	userID, _ := c.Locals(constants.ContextUserIDKey).(string)
+
+	var input TokenInput
+	if err := c.BodyParser(&input); err != nil {
+		return response.BadRequest(c, "Invalid request body")
+	}
+
+	token, secret, err := ctrl.service.Create(c.Context(), userID, input)
+	if err == ErrInvalidName || err == ErrInvalidScopes || err == ErrInvalidExpiry || err == ErrTooManyTokens {
+		return response.BadRequest(c, err.Error())
+	}
+	if err != nil {
+		return response.InternalError(c, err.Error())
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(struct {
+		models.AccessToken
+		Token string `json:"token"`
+	}{*token, secret})
+}
+
+/* DELETE /auth/tokens/:id */
+func (ctrl *Controller) Revoke(c *fiber.Ctx) error {
+	userID, _ := c.Locals(constants.ContextUserIDKey).(string)
+
+	id, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return response.BadRequest(c, "Invalid token ID")
+	}
+
+	err = ctrl.service.Revoke(c.Context(), userID, id)
+	if err == ErrTokenNotFound {
+		return response.NotFound(c, "Access token not found")
+	}
+	if err != nil {
+		return response.InternalError(c, err.Error())
+	}
+	return c.JSON(fiber.Map{"success": true})
+}
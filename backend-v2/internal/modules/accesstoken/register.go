@@ -0,0 +1,24 @@
+package accesstoken
+
+import (
+	"backend-v2/internal/middlewares"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/qiniu/qmgo"
+)
+
+func Register(router fiber.Router, db *qmgo.Database) {
+	service := NewService(db)
+	service.ensureIndexes()
+	controller := NewController(service)
+
+	/* From here on JWTMiddleware accepts the tokens this module issues */
+	middlewares.UseAccessTokens(service)
+
+	/* Tokens cannot reach these routes, so only a signed-in user manages tokens */
+	group := router.Group("/auth/tokens", middlewares.RequireAuth)
+
+	group.Get("/", controller.List)
+	group.Post("/", controller.Create)
+	group.Delete("/:id", controller.Revoke)
+}
@@ -0,0 +1,76 @@
+package accesstoken
+
+import (
+	"strings"
+
+	"backend-v2/internal/common/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	ScopeWorkflowsRead  = "workflows:read"
+	ScopeWorkflowsWrite = "workflows:write"
+	ScopeVector         = "vector"
+	ScopeIntegration    = "integration"
+)
+
+/* KnownScopes lists the scopes a token can be granted */
+var KnownScopes = []string{ScopeWorkflowsRead, ScopeWorkflowsWrite, ScopeVector, ScopeIntegration}
+
+/* normalizeScopes checks scopes against KnownScopes and drops repeats, keeping their order */
+func normalizeScopes(scopes []string) ([]string, error) {
+	seen := map[string]bool{}
+	normalized := []string{}
+	for _, scope := range scopes {
+		scope = strings.TrimSpace(scope)
+		if !utils.Contains(KnownScopes, scope) {
+			return nil, ErrInvalidScopes
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			normalized = append(normalized, scope)
+		}
+	}
+	if len(normalized) == 0 {
+		return nil, ErrInvalidScopes
+	}
+	return normalized, nil
+}
+
+/* under reports whether path is prefix or below it */
+func under(path, prefix string) bool {
+	return path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
+/*
+allows maps a request to the scope it needs: workflows are read with either workflow scope
+and changed only with workflows:write; vector contexts (and their ingestion) need vector;
+integrations and the LLM API that spends them need integration. Everything else, token and
+session management included, stays closed to tokens.
+*/
+func allows(scopes []string, method, path string) bool {
+	/* Routing ignores case, so matching does too */
+	path = strings.ToLower(path)
+
+	var needed []string
+	switch {
+	case under(path, "/workflow"):
+		if method == fiber.MethodGet || method == fiber.MethodHead {
+			needed = []string{ScopeWorkflowsRead, ScopeWorkflowsWrite}
+		} else {
+			needed = []string{ScopeWorkflowsWrite}
+		}
+	case under(path, "/vector"):
+		needed = []string{ScopeVector}
+	case under(path, "/integration"), under(path, "/llm"):
+		needed = []string{ScopeIntegration}
+	}
+
+	for _, scope := range needed {
+		if utils.Contains(scopes, scope) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,48 @@
+package accesstoken
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNormalizeScopes(t *testing.T) {
+	scopes, err := normalizeScopes([]string{"vector", " workflows:read ", "vector"})
+	if err != nil || len(scopes) != 2 || scopes[0] != ScopeVector || scopes[1] != ScopeWorkflowsRead {
+		t.Errorf("normalizeScopes() = %v, %v, want [vector workflows:read]", scopes, err)
+	}
+
+	for _, invalid := range [][]string{nil, {}, {"admin"}, {"vector", "workflows"}} {
+		if _, err := normalizeScopes(invalid); !errors.Is(err, ErrInvalidScopes) {
+			t.Errorf("normalizeScopes(%v) = %v, want ErrInvalidScopes", invalid, err)
+		}
+	}
+}
+
+func TestAllows(t *testing.T) {
+	cases := []struct {
+		scopes       []string
+		method, path string
+		want         bool
+	}{
+		{[]string{ScopeWorkflowsRead}, "GET", "/workflow", true},
+		{[]string{ScopeWorkflowsRead}, "GET", "/workflow/abc/export/zip", true},
+		{[]string{ScopeWorkflowsRead}, "PUT", "/workflow/abc", false},
+		{[]string{ScopeWorkflowsWrite}, "GET", "/workflow/abc", true},
+		{[]string{ScopeWorkflowsWrite}, "DELETE", "/workflow/abc", true},
+		{[]string{ScopeWorkflowsWrite}, "GET", "/workflows-export", false},
+		{[]string{ScopeVector}, "POST", "/vector/ingest", true},
+		{[]string{ScopeVector}, "GET", "/VECTOR/all", true},
+		{[]string{ScopeVector}, "GET", "/workflow", false},
+		{[]string{ScopeIntegration}, "POST", "/integration/chat/completions", true},
+		{[]string{ScopeIntegration}, "POST", "/llm/chat", true},
+		{KnownScopes, "GET", "/auth/tokens", false},
+		{KnownScopes, "GET", "/auth/sessions", false},
+		{KnownScopes, "GET", "/user", false},
+		{nil, "GET", "/vector", false},
+	}
+	for _, c := range cases {
+		if got := allows(c.scopes, c.method, c.path); got != c.want {
+			t.Errorf("allows(%v, %s %s) = %v, want %v", c.scopes, c.method, c.path, got, c.want)
+		}
+	}
+}
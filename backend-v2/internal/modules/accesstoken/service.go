@@ -0,0 +1,213 @@
+package accesstoken
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/qiniu/qmgo"
+	"github.com/qiniu/qmgo/options"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	mongoOptions "go.mongodb.org/mongo-driver/mongo/options"
+
+	"backend-v2/internal/common/logger"
+	"backend-v2/internal/models"
+)
+
+const (
+	tokensCollection = "accesstokens"
+	/* maxTokens bounds how many tokens one user holds */
+	maxTokens = 50
+	/* maxLifetime matches the longest expiry JWTMiddleware accepts */
+	maxLifetime   = 365 * 24 * time.Hour
+	maxNameLength = 100
+	/* prefixLength is how much of a token its listing shows */
+	prefixLength = 12
+)
+
+var log = logger.New("ACCESS-TOKEN")
+
+var (
+	ErrInvalidName   = errors.New("name must be 1 to 100 characters")
+	ErrInvalidScopes = errors.New("scopes must be a non-empty list of: workflows:read, workflows:write, vector, integration")
+	ErrInvalidExpiry = errors.New("expiresAt must be in the future and at most a year away")
+	ErrTooManyTokens = errors.New("too many access tokens; revoke one first")
+	ErrTokenNotFound = errors.New("access token not found")
+)
+
+type Service struct {
+	tokens *qmgo.Collection
+	users  *qmgo.Collection
+}
+
+func NewService(db *qmgo.Database) *Service {
+	return &Service{
+		tokens: db.Collection(tokensCollection),
+		users:  db.Collection("users"),
+	}
+}
+
+/* ensureIndexes makes lookups by hash unique and fast and lets Mongo drop expired tokens */
+func (s *Service) ensureIndexes() {
+	/* Missing indexes only cost speed and disk space, so failures are logged, not fatal */
+	if err := s.tokens.CreateOneIndex(context.Background(), options.IndexModel{Key: []string{"hash"}, IndexOptions: mongoOptions.Index().SetUnique(true)}); err != nil {
+		log.Warn("could not create index on %s: %v", tokensCollection, err)
+	}
+	if err := s.tokens.CreateOneIndex(context.Background(), options.IndexModel{Key: []string{"userId", "createdAt"}}); err != nil {
+		log.Warn("could not create index on %s: %v", tokensCollection, err)
+	}
+	if err := s.tokens.CreateOneIndex(context.Background(), options.IndexModel{
+		Key:          []string{"expiresAt"},
+		IndexOptions: mongoOptions.Index().SetExpireAfterSeconds(0),
+	}); err != nil {
+		log.Warn("could not create TTL index on %s: %v", tokensCollection, err)
+	}
+}
+
+/* TokenInput carries the fields a user chooses for a new token */
+type TokenInput struct {
+	Name      string    `json:"name"`
+	Scopes    []string  `json:"scopes"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+/* hashToken is how a token is stored and looked up; tokens are random, so a plain digest suffices */
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func generateToken() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return models.AccessTokenPrefix + hex.EncodeToString(secret), nil
+}
+
+/* Create issues a token for userID and returns it with the secret, which is not kept */
+func (s *Service) Create(ctx context.Context, userID string, input TokenInput) (*models.AccessToken, string, error) {
+	name := strings.TrimSpace(input.Name)
+	if name == "" || len(name) > maxNameLength {
+		return nil, "", ErrInvalidName
+	}
+	scopes, err := normalizeScopes(input.Scopes)
+	if err != nil {
+		return nil, "", err
+	}
+	now := time.Now()
+	if !input.ExpiresAt.After(now) || input.ExpiresAt.After(now.Add(maxLifetime)) {
+		return nil, "", ErrInvalidExpiry
+	}
+
+	count, err := s.tokens.Find(ctx, bson.M{"userId": userID}).Count()
+	if err != nil {
+		return nil, "", err
+	}
+	if count >= maxTokens {
+		return nil, "", ErrTooManyTokens
+	}
+
+	secret, err := generateToken()
+	if err != nil {
+		return nil, "", err
+	}
+	token := models.AccessToken{
+		ID:        primitive.NewObjectID(),
+		UserID:    userID,
+		Name:      name,
+		Prefix:    secret[:prefixLength],
+		Hash:      hashToken(secret),
+		Scopes:    scopes,
+		ExpiresAt: input.ExpiresAt,
+		CreatedAt: now,
+	}
+	if _, err := s.tokens.InsertOne(ctx, token); err != nil {
+		return nil, "", err
+	}
+	return &token, secret, nil
+}
+
+/* List returns the user's tokens, newest first */
+func (s *Service) List(ctx context.Context, userID string) ([]models.AccessToken, error) {
+	tokens := []models.AccessToken{}
+	err := s.tokens.Find(ctx, bson.M{"userId": userID}).Sort("-createdAt").All(&tokens)
+	return tokens, err
+}
+
+/* Revoke deletes one of the user's tokens; requests using it fail from then on */
+func (s *Service) Revoke(ctx context.Context, userID string, id primitive.ObjectID) error {
+	err := s.tokens.Remove(ctx, bson.M{"_id": id, "userId": userID})
+	if errors.Is(err, qmgo.ErrNoSuchDocuments) {
+		return ErrTokenNotFound
+	}
+	return err
+}
+
+/*
+Resolve finds the token, stamps its use and returns claims for its user as a JWT would
+carry them, with the token's scopes and id. The user's roles and limits are read now, so
+they follow changes to the account.
+*/
+func (s *Service) Resolve(ctx context.Context, secret, ip string) (jwt.MapClaims, error) {
+	now := time.Now()
+	var token models.AccessToken
+	err := s.tokens.Find(ctx, bson.M{"hash": hashToken(secret), "expiresAt": bson.M{"$gt": now}}).
+		Apply(qmgo.Change{Update: bson.M{"$set": bson.M{"lastUsedAt": now, "lastUsedIp": ip}}, ReturnNew: true}, &token)
+	if errors.Is(err, qmgo.ErrNoSuchDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var user models.User
+	err = s.users.Find(ctx, bson.M{"name": token.UserID}).One(&user)
+	if errors.Is(err, qmgo.ErrNoSuchDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return claimsOf(&token, &user), nil
+}
+
+/* claimsOf shapes a token's claims as decoded JWT claims are: numbers as float64, lists as []interface{} */
+func claimsOf(token *models.AccessToken, user *models.User) jwt.MapClaims {
+	roles := make([]interface{}, len(user.Roles))
+	for i, role := range user.Roles {
+		roles[i] = role
+	}
+	scopes := make([]interface{}, len(token.Scopes))
+	for i, scope := range token.Scopes {
+		scopes[i] = scope
+	}
+	return jwt.MapClaims{
+		"sub":            user.Name,
+		"roles":          roles,
+		"limitWorkflows": float64(user.LimitWorkflows),
+		"limitNodes":     float64(user.LimitNodes),
+		"exp":            float64(token.ExpiresAt.Unix()),
+		"iat":            float64(token.CreatedAt.Unix()),
+		"pat":            token.ID.Hex(),
+		"scope":          scopes,
+	}
+}
+
+/* Allows implements middlewares.AccessTokenResolver with the token's scope claim */
+func (s *Service) Allows(claims jwt.MapClaims, method, path string) bool {
+	raw, _ := claims["scope"].([]interface{})
+	scopes := make([]string, 0, len(raw))
+	for _, scope := range raw {
+		if name, ok := scope.(string); ok {
+			scopes = append(scopes, name)
+		}
+	}
+	return allows(scopes, method, path)
+}
@@ -0,0 +1,45 @@
+package accesstoken
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"backend-v2/internal/models"
+)
+
+func TestGenerateToken(t *testing.T) {
+	first, err := generateToken()
+	if err != nil {
+		t.Fatalf("generateToken() = %v", err)
+	}
+	second, _ := generateToken()
+
+	if !strings.HasPrefix(first, models.AccessTokenPrefix) || len(first) != len(models.AccessTokenPrefix)+64 {
+		t.Errorf("generateToken() = %q, want the prefix and 64 hex digits", first)
+	}
+	if first == second || hashToken(first) == hashToken(second) || hashToken(first) == first {
+		t.Errorf("generateToken() repeated itself, or hashToken() kept the secret")
+	}
+}
+
+func TestClaimsOf_ShapedLikeJWTClaims(t *testing.T) {
+	expires := time.Unix(2000, 0)
+	token := &models.AccessToken{ID: primitive.NewObjectID(), Scopes: []string{ScopeVector}, ExpiresAt: expires, CreatedAt: time.Unix(1000, 0)}
+	user := &models.User{Name: "alice", Roles: []string{"subscriber"}, LimitWorkflows: 10}
+
+	claims := claimsOf(token, user)
+	if roles, ok := claims["roles"].([]interface{}); !ok || len(roles) != 1 || roles[0] != "subscriber" {
+		t.Errorf("roles claim = %#v, want []interface{}{\"subscriber\"}", claims["roles"])
+	}
+	if claims["sub"] != "alice" || claims["limitWorkflows"] != float64(10) || claims["exp"] != float64(2000) || claims["pat"] != token.ID.Hex() {
+		t.Errorf("claimsOf() = %v", claims)
+	}
+
+	service := &Service{}
+	if !service.Allows(claims, "GET", "/vector/all") || service.Allows(claims, "GET", "/workflow") {
+		t.Errorf("Allows() does not follow the token's scopes")
+	}
+}
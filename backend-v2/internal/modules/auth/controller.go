@@ -3,13 +3,14 @@ package auth
 import (
 	"crypto/sha1"
 	"encoding/hex"
+	"errors"
 	"log"
 
-	"backend-v2/internal/common"
 	"backend-v2/internal/common/response"
 	"backend-v2/internal/services/email"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
 )
 
 type Controller struct {
@@ -90,19 +91,13 @@ func (c *Controller) Login(ctx *fiber.Ctx) error {
 		return response.InternalError(ctx, err.Error())
 	}
 
-	auth, err := common.GenerateAuth(user)
+	auth, err := c.service.StartSession(ctx.Context(), user, ctx.Get(fiber.HeaderUserAgent), ctx.IP())
 	if err != nil {
 		return response.InternalError(ctx, "Failed to generate token")
 	}
 
 	/* Set refresh_token cookie (matches Node.js behavior) */
-	ctx.Cookie(&fiber.Cookie{
-		Name:     "refresh_token",
-		Value:    auth.RefreshToken,
-		MaxAge:   int(auth.ExpiresIn),
-		HTTPOnly: true,
-		SameSite: "Lax",
-	})
+	c.setRefreshCookie(ctx, auth.RefreshToken)
 
 	/* Compute SHA1 hash of access token (matches Node.js) */
 	hasher := sha1.New()
@@ -140,7 +135,7 @@ func (c *Controller) LoginJWT(ctx *fiber.Ctx) error {
 		return response.InternalError(ctx, err.Error())
 	}
 
-	auth, err := common.GenerateAuth(user)
+	auth, err := c.service.StartSession(ctx.Context(), user, ctx.Get(fiber.HeaderUserAgent), ctx.IP())
 	if err != nil {
 		return response.InternalError(ctx, "Failed to generate token")
 	}
@@ -149,21 +144,21 @@ func (c *Controller) LoginJWT(ctx *fiber.Ctx) error {
 	return ctx.JSON(auth)
 }
 
-/* POST /auth/logout - Logout user */
+/* POST /auth/logout - Revoke the session and clear its cookies */
 func (c *Controller) Logout(ctx *fiber.Ctx) error {
-	ctx.Cookie(&fiber.Cookie{
-		Name:     "refresh_token",
-		Value:    "",
-		MaxAge:   -1,
-		HTTPOnly: true,
-	})
-	ctx.Cookie(&fiber.Cookie{
-		Name:     "auth",
-		Value:    "",
-		MaxAge:   -1,
-		HTTPOnly: true,
-	})
+	refreshToken, _ := refreshTokenOf(ctx)
+	if refreshToken != "" {
+		if err := c.service.EndSession(ctx.Context(), refreshToken); err != nil && !errors.Is(err, ErrRefreshInvalid) {
+			return response.InternalError(ctx, err.Error())
+		}
+	} else if userID, sessionID := sessionOf(ctx); sessionID != "" {
+		/* Clients holding only an access token end the session it was issued for */
+		if err := c.service.RevokeSession(ctx.Context(), userID, sessionID); err != nil && !errors.Is(err, ErrSessionNotFound) {
+			return response.InternalError(ctx, err.Error())
+		}
+	}
 
+	clearCookies(ctx)
 	return ctx.JSON(fiber.Map{"success": true})
 }
 
@@ -255,21 +250,28 @@ func (c *Controller) ResetPassword(ctx *fiber.Ctx) error {
 	return ctx.JSON(fiber.Map{"success": true})
 }
 
-/* POST /refresh - Refresh access token */
+/*
+POST /refresh - Rotate a refresh token into new tokens. The token comes from the
+refresh_token cookie, or the body for clients that signed in through /auth/login-jwt;
+the rotated one goes back the same way.
+*/
 func (c *Controller) Refresh(ctx *fiber.Ctx) error {
-	refreshToken := ctx.Cookies("refresh_token")
+	refreshToken, fromBody := refreshTokenOf(ctx)
 	if refreshToken == "" {
 		return response.Unauthorized(ctx, "No refresh token found.")
 	}
 
-	user, err := c.service.ValidateRefreshToken(ctx.Context(), refreshToken)
+	user, auth, err := c.service.Rotate(ctx.Context(), refreshToken, ctx.Get(fiber.HeaderUserAgent), ctx.IP())
 	if err != nil {
-		return response.Unauthorized(ctx, "Refresh JWT invalid.")
-	}
-
-	auth, err := common.GenerateAuth(user)
-	if err != nil {
-		return response.InternalError(ctx, "Failed to generate token")
+		var authErr *AuthError
+		if !errors.As(err, &authErr) {
+			return response.InternalError(ctx, err.Error())
+		}
+		/* The winner of a concurrent refresh already set fresh cookies */
+		if !fromBody && (errors.Is(err, ErrRefreshReused) || errors.Is(err, ErrSessionRevoked)) {
+			clearCookies(ctx)
+		}
+		return response.Unauthorized(ctx, authErr.Message)
 	}
 
 	/* Set auth cookie with access token (matches Node.js) */
@@ -285,7 +287,7 @@ func (c *Controller) Refresh(ctx *fiber.Ctx) error {
 	hasher.Write([]byte(auth.AccessToken))
 	tokenHash := hex.EncodeToString(hasher.Sum(nil))
 
-	return ctx.JSON(fiber.Map{
+	body := fiber.Map{
 		"user":           auth.User,
 		"access_token":   auth.AccessToken,
 		"tokenHash":      tokenHash,
@@ -296,5 +298,121 @@ func (c *Controller) Refresh(ctx *fiber.Ctx) error {
 		"limitWorkflows": user.LimitWorkflows,
 		"limitNodes":     user.LimitNodes,
 		"name":           user.Name,
+	}
+	if fromBody {
+		body["refresh_token"] = auth.RefreshToken
+	} else {
+		c.setRefreshCookie(ctx, auth.RefreshToken)
+	}
+	return ctx.JSON(body)
+}
+
+/* GET /auth/sessions - List the caller's active sessions */
+func (c *Controller) ListSessions(ctx *fiber.Ctx) error {
+	userID, ok := ctx.Locals("userId").(string)
+	if !ok || userID == "" {
+		return response.Unauthorized(ctx, "Authentication required")
+	}
+	_, currentID := sessionOf(ctx)
+
+	sessions, err := c.service.ListSessions(ctx.Context(), userID, currentID)
+	if err != nil {
+		return response.InternalError(ctx, err.Error())
+	}
+	return ctx.JSON(sessions)
+}
+
+/* DELETE /auth/sessions/:id - Revoke one of the caller's sessions */
+func (c *Controller) RevokeSession(ctx *fiber.Ctx) error {
+	userID, ok := ctx.Locals("userId").(string)
+	if !ok || userID == "" {
+		return response.Unauthorized(ctx, "Authentication required")
+	}
+	sessionID := ctx.Params("id")
+
+	if err := c.service.RevokeSession(ctx.Context(), userID, sessionID); err != nil {
+		if errors.Is(err, ErrSessionNotFound) {
+			return response.NotFound(ctx, err.Error())
+		}
+		return response.InternalError(ctx, err.Error())
+	}
+
+	if _, currentID := sessionOf(ctx); currentID == sessionID {
+		clearCookies(ctx)
+	}
+	return ctx.JSON(fiber.Map{"success": true})
+}
+
+/* DELETE /auth/sessions?keepCurrent=true - Log out everywhere, optionally except here */
+func (c *Controller) RevokeSessions(ctx *fiber.Ctx) error {
+	userID, ok := ctx.Locals("userId").(string)
+	if !ok || userID == "" {
+		return response.Unauthorized(ctx, "Authentication required")
+	}
+
+	keepID := ""
+	if ctx.Query("keepCurrent") == "true" {
+		_, keepID = sessionOf(ctx)
+		if keepID == "" {
+			return response.BadRequest(ctx, "Current session unknown; sign in again to keep it.")
+		}
+	}
+
+	revoked, err := c.service.RevokeSessions(ctx.Context(), userID, keepID, "logout-all")
+	if err != nil {
+		return response.InternalError(ctx, err.Error())
+	}
+	if keepID == "" {
+		clearCookies(ctx)
+	}
+	return ctx.JSON(fiber.Map{"success": true, "revoked": revoked})
+}
+
+/* refreshTokenOf reads the refresh token from the body, else the cookie, and says which */
+func refreshTokenOf(ctx *fiber.Ctx) (string, bool) {
+	var payload struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	/* The body is optional; cookie clients send none */
+	_ = ctx.BodyParser(&payload)
+	if payload.RefreshToken != "" {
+		return payload.RefreshToken, true
+	}
+	return ctx.Cookies("refresh_token"), false
+}
+
+/* sessionOf is the user and session named by the caller's access token, if any */
+func sessionOf(ctx *fiber.Ctx) (string, string) {
+	claims, ok := ctx.Locals("auth").(jwt.MapClaims)
+	if !ok {
+		return "", ""
+	}
+	userID, _ := claims["sub"].(string)
+	sessionID, _ := claims["sid"].(string)
+	return userID, sessionID
+}
+
+func (c *Controller) setRefreshCookie(ctx *fiber.Ctx, refreshToken string) {
+	ctx.Cookie(&fiber.Cookie{
+		Name:     "refresh_token",
+		Value:    refreshToken,
+		MaxAge:   int(c.service.policy.RefreshTTL.Seconds()),
+		HTTPOnly: true,
+		SameSite: "Lax",
+	})
+}
+
+func clearCookies(ctx *fiber.Ctx) {
+	ctx.Cookie(&fiber.Cookie{
+		Name:     "refresh_token",
+		Value:    "",
+		MaxAge:   -1,
+		HTTPOnly: true,
+	})
+	ctx.Cookie(&fiber.Cookie{
+		Name:     "auth",
+		Value:    "",
+		MaxAge:   -1,
+		HTTPOnly: true,
 	})
 }
@@ -44,8 +44,9 @@ func TestControllerWithMockedEmail(t *testing.T) {
 	/* In real test would use test database or mock */
 	var usersCollection *qmgo.Collection    // Would initialize with test DB
 	var waitlistCollection *qmgo.Collection // Would initialize with test DB
+	var sessionsCollection *qmgo.Collection // Would initialize with test DB
 
-	service := auth.NewService(usersCollection, waitlistCollection)
+	service := auth.NewService(usersCollection, waitlistCollection, sessionsCollection, auth.DefaultSessionPolicy())
 
 	/* Create controller with mock email service injected */
 	controller := auth.NewController(service, mockEmail)
@@ -64,8 +65,9 @@ func ExampleProductionSetup() {
 
 	var usersCollection *qmgo.Collection
 	var waitlistCollection *qmgo.Collection
+	var sessionsCollection *qmgo.Collection
 
-	service := auth.NewService(usersCollection, waitlistCollection)
+	service := auth.NewService(usersCollection, waitlistCollection, sessionsCollection, auth.DefaultSessionPolicy())
 
 	controller := auth.NewController(service, emailService)
 
@@ -79,8 +81,9 @@ func ExampleE2ESetup() {
 
 	var usersCollection *qmgo.Collection
 	var waitlistCollection *qmgo.Collection
+	var sessionsCollection *qmgo.Collection
 
-	service := auth.NewService(usersCollection, waitlistCollection)
+	service := auth.NewService(usersCollection, waitlistCollection, sessionsCollection, auth.DefaultSessionPolicy())
 
 	controller := auth.NewController(service, emailService)
 
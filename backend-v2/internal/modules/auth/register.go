@@ -1,6 +1,10 @@
 package auth
 
 import (
+	"log"
+
+	"backend-v2/internal/config"
+	"backend-v2/internal/middlewares"
 	"backend-v2/internal/services/email"
 
 	"github.com/gofiber/fiber/v2"
@@ -10,8 +14,16 @@ import (
 func RegisterRoutes(router fiber.Router, db *qmgo.Database, emailService email.Service) {
 	usersCollection := db.Collection("users")
 	waitlistCollection := db.Collection("waitlists")
+	sessions := db.Collection(sessionsCollection)
+	ensureSessionIndexes(sessions)
+
+	policy, err := ParseSessionPolicy(config.Sessions)
+	if err != nil {
+		log.Fatalf("Session settings invalid: %v", err)
+	}
 
-	service := NewService(usersCollection, waitlistCollection)
+	service := NewService(usersCollection, waitlistCollection, sessions, policy)
+	middlewares.UseSessions(service)
 	controller := NewController(service, emailService)
 
 	/* RESTful auth routes under /auth namespace */
@@ -23,6 +35,9 @@ func RegisterRoutes(router fiber.Router, db *qmgo.Database, emailService email.S
 	router.Post("/auth/forgot-password", controller.ForgotPassword)
 	router.Get("/auth/check-reset-token/:pwdResetToken", controller.CheckResetToken)
 	router.Post("/auth/reset-password/:pwdResetToken", controller.ResetPassword)
+	router.Get("/auth/sessions", middlewares.RequireAuth, controller.ListSessions)
+	router.Delete("/auth/sessions", middlewares.RequireAuth, controller.RevokeSessions)
+	router.Delete("/auth/sessions/:id", middlewares.RequireAuth, controller.RevokeSession)
 
 	/* Backward compatibility aliases (deprecated) */
 	router.Post("/auth", controller.Login)                    // Legacy: Use /auth/login
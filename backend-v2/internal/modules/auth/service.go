@@ -1,16 +1,13 @@
 package auth
 
 import (
-	"backend-v2/internal/config"
 	"context"
 	"crypto/rand"
 	"encoding/hex"
-	"errors"
 	"fmt"
 	"strings"
 	"time"
 
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/qiniu/qmgo"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -22,12 +19,18 @@ import (
 type Service struct {
 	usersCollection    *qmgo.Collection
 	waitlistCollection *qmgo.Collection
+	sessionsCollection *qmgo.Collection
+	policy             SessionPolicy
+	activeSessions     *sessionCache
 }
 
-func NewService(usersCollection, waitlistCollection *qmgo.Collection) *Service {
+func NewService(usersCollection, waitlistCollection, sessionsCollection *qmgo.Collection, policy SessionPolicy) *Service {
 	return &Service{
 		usersCollection:    usersCollection,
 		waitlistCollection: waitlistCollection,
+		sessionsCollection: sessionsCollection,
+		policy:             policy,
+		activeSessions:     newSessionCache(),
 	}
 }
 
@@ -175,46 +178,15 @@ func (s *Service) ResetPassword(ctx context.Context, token, newPassword string)
 	}
 
 	filter = bson.M{"id": user.ID}
-	err = s.usersCollection.UpdateOne(ctx, filter, update)
-	return err
-}
-
-/* ValidateRefreshToken - Validate JWT refresh token and return user */
-func (s *Service) ValidateRefreshToken(ctx context.Context, tokenString string) (*models.User, error) {
-	/* Parse and validate JWT token */
-	token, err := jwt.Parse(tokenString, func(t *jwt.Token) (interface{}, error) {
-		/* Enforce HS256 algorithm */
-		if t.Method.Alg() != "HS256" {
-			return nil, errors.New("unexpected signing method")
-		}
-		return []byte(config.JwtSecret), nil
-	})
-
-	if err != nil || !token.Valid {
-		return nil, errors.New("invalid token")
-	}
-
-	/* Extract claims */
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok {
-		return nil, errors.New("invalid token claims")
-	}
-
-	/* Get username from subject */
-	sub, ok := claims["sub"].(string)
-	if !ok || sub == "" {
-		return nil, errors.New("invalid token subject")
+	if err := s.usersCollection.UpdateOne(ctx, filter, update); err != nil {
+		return err
 	}
 
-	/* Find user by username */
-	filter := bson.M{"name": sub}
-	var user models.User
-	err = s.usersCollection.Find(ctx, filter).One(&user)
-	if err != nil {
-		return nil, ErrUserNotFound
+	/* Whoever knew the old password may hold a session; all of them end */
+	if _, err := s.RevokeSessions(ctx, user.Name, "", "password-reset"); err != nil {
+		return fmt.Errorf("password changed but sessions not revoked: %w", err)
 	}
-
-	return &user, nil
+	return nil
 }
 
 func generateRandomString(length int) (string, error) {
@@ -232,6 +204,11 @@ var (
 	ErrUserNotFound    = &AuthError{Message: "User not found."}
 	ErrInvalidPassword = &AuthError{Message: "Wrong password."}
 	ErrAccountPending  = &AuthError{Message: "Error: Account pending activation"}
+	ErrRefreshInvalid  = &AuthError{Message: "Refresh JWT invalid."}
+	ErrRefreshRaced    = &AuthError{Message: "Refresh token already rotated."}
+	ErrRefreshReused   = &AuthError{Message: "Refresh token reused; session revoked."}
+	ErrSessionRevoked  = &AuthError{Message: "Session revoked."}
+	ErrSessionNotFound = &AuthError{Message: "Session not found."}
 )
 
 type AuthError struct {
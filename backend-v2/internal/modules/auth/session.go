@@ -0,0 +1,318 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/qiniu/qmgo"
+	"github.com/qiniu/qmgo/options"
+	"go.mongodb.org/mongo-driver/bson"
+	mongoOptions "go.mongodb.org/mongo-driver/mongo/options"
+
+	"backend-v2/internal/common"
+	"backend-v2/internal/common/logger"
+	"backend-v2/internal/models"
+)
+
+const (
+	sessionsCollection = "sessions"
+	/* maxUserAgent bounds what a client can make us store per session */
+	maxUserAgent = 256
+)
+
+var sessionLog = logger.New("SESSION")
+
+/* SessionPolicy bounds how long sessions and their refresh tokens live */
+type SessionPolicy struct {
+	/* RefreshTTL is how long a refresh token lives; every refresh starts it again */
+	RefreshTTL time.Duration
+	/* Lifetime caps a session from sign-in, however often it refreshes */
+	Lifetime time.Duration
+	/* Grace lets the token just rotated away fail quietly, e.g. two tabs refreshing at once, instead of counting as reuse */
+	Grace time.Duration
+}
+
+func DefaultSessionPolicy() SessionPolicy {
+	return SessionPolicy{RefreshTTL: 24 * time.Hour, Lifetime: 30 * 24 * time.Hour, Grace: 30 * time.Second}
+}
+
+/* ParseSessionPolicy reads "refresh=24h,lifetime=720h,grace=30s"; fields left out keep their defaults */
+func ParseSessionPolicy(spec string) (SessionPolicy, error) {
+	policy := DefaultSessionPolicy()
+
+	for _, field := range strings.Split(spec, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		name, raw, ok := strings.Cut(field, "=")
+		if !ok {
+			return SessionPolicy{}, fmt.Errorf("session field %q: expected name=value", field)
+		}
+		value, err := time.ParseDuration(raw)
+		if err != nil || value < 0 || (value == 0 && name != "grace") {
+			return SessionPolicy{}, fmt.Errorf("session field %q: invalid duration", field)
+		}
+		switch name {
+		case "refresh":
+			policy.RefreshTTL = value
+		case "lifetime":
+			policy.Lifetime = value
+		case "grace":
+			policy.Grace = value
+		default:
+			return SessionPolicy{}, fmt.Errorf("session field %q: unknown field %q", field, name)
+		}
+	}
+
+	if policy.Lifetime < policy.RefreshTTL {
+		return SessionPolicy{}, fmt.Errorf("session lifetime %s is shorter than the refresh token lifetime %s", policy.Lifetime, policy.RefreshTTL)
+	}
+	return policy, nil
+}
+
+/* expiry is when a session created at createdAt and refreshed at now stops refreshing */
+func (p SessionPolicy) expiry(createdAt, now time.Time) time.Time {
+	end := createdAt.Add(p.Lifetime)
+	if next := now.Add(p.RefreshTTL); next.Before(end) {
+		return next
+	}
+	return end
+}
+
+/* ensureSessionIndexes lets Mongo drop expired sessions and serves listing a user's sessions */
+func ensureSessionIndexes(collection *qmgo.Collection) {
+	/* Missing indexes only cost disk space and speed, so failures are logged, not fatal */
+	err := collection.CreateOneIndex(context.Background(), options.IndexModel{
+		Key:          []string{"expiresAt"},
+		IndexOptions: mongoOptions.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		sessionLog.Warn("could not create TTL index on %s: %v", sessionsCollection, err)
+	}
+	if err := collection.CreateOneIndex(context.Background(), options.IndexModel{Key: []string{"userId", "lastUsedAt"}}); err != nil {
+		sessionLog.Warn("could not create index on %s: %v", sessionsCollection, err)
+	}
+}
+
+/* refreshClaims describe the refresh token session hands out now */
+func refreshClaims(session *models.Session) common.RefreshClaims {
+	return common.RefreshClaims{
+		Subject:   session.UserID,
+		SessionID: session.ID,
+		TokenID:   session.TokenID,
+		ExpiresAt: session.ExpiresAt,
+	}
+}
+
+/*
+checkRefresh decides whether claims may rotate session. Only the current token may; the one
+it replaced is turned away quietly within the grace period, and any other is a copy of the
+family in someone else's hands.
+*/
+func checkRefresh(session *models.Session, claims *common.RefreshClaims, now time.Time, grace time.Duration) error {
+	switch {
+	case session.UserID != claims.Subject:
+		return ErrRefreshInvalid
+	case session.RevokedAt != nil:
+		return ErrSessionRevoked
+	case !now.Before(session.ExpiresAt):
+		return ErrRefreshInvalid
+	case session.TokenID == claims.TokenID:
+		return nil
+	case session.PreviousTokenID == claims.TokenID && now.Sub(session.RotatedAt) <= grace:
+		return ErrRefreshRaced
+	default:
+		return ErrRefreshReused
+	}
+}
+
+func clip(value string, limit int) string {
+	if len(value) > limit {
+		return value[:limit]
+	}
+	return value
+}
+
+/* StartSession opens a session for user and issues its first tokens */
+func (s *Service) StartSession(ctx context.Context, user *models.User, userAgent, ip string) (*common.AuthResponse, error) {
+	sessionID, err := generateRandomString(32)
+	if err != nil {
+		return nil, err
+	}
+	tokenID, err := generateRandomString(32)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	session := models.Session{
+		ID:         sessionID,
+		UserID:     user.Name,
+		TokenID:    tokenID,
+		RotatedAt:  now,
+		CreatedAt:  now,
+		LastUsedAt: now,
+		ExpiresAt:  s.policy.expiry(now, now),
+		UserAgent:  clip(userAgent, maxUserAgent),
+		IP:         ip,
+	}
+	if _, err := s.sessionsCollection.InsertOne(ctx, session); err != nil {
+		return nil, err
+	}
+	return common.GenerateAuth(user, refreshClaims(&session))
+}
+
+/*
+Rotate trades a refresh token for new tokens and retires it. A retired token presented
+again outside the grace period revokes its whole session, since either the client or
+whoever copied the token is about to use the family.
+*/
+func (s *Service) Rotate(ctx context.Context, refreshToken, userAgent, ip string) (*models.User, *common.AuthResponse, error) {
+	claims, err := common.ParseRefreshToken(refreshToken)
+	if err != nil {
+		return nil, nil, ErrRefreshInvalid
+	}
+
+	var session models.Session
+	if err := s.sessionsCollection.Find(ctx, bson.M{"_id": claims.SessionID}).One(&session); err != nil {
+		if errors.Is(err, qmgo.ErrNoSuchDocuments) {
+			return nil, nil, ErrRefreshInvalid
+		}
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	if err := checkRefresh(&session, claims, now, s.policy.Grace); err != nil {
+		if err == ErrRefreshReused {
+			sessionLog.Warn("refresh token reused for session %s of user %s from %s; revoking it", session.ID, session.UserID, ip)
+			if revokeErr := s.sessionsCollection.UpdateOne(ctx, bson.M{"_id": session.ID}, revoke(now, "reuse")); revokeErr != nil {
+				return nil, nil, revokeErr
+			}
+			s.activeSessions.forget(session.ID)
+		}
+		return nil, nil, err
+	}
+
+	var user models.User
+	if err := s.usersCollection.Find(ctx, bson.M{"name": claims.Subject}).One(&user); err != nil {
+		return nil, nil, ErrRefreshInvalid
+	}
+
+	tokenID, err := generateRandomString(32)
+	if err != nil {
+		return nil, nil, err
+	}
+	session.PreviousTokenID = session.TokenID
+	session.TokenID = tokenID
+	session.RotatedAt = now
+	session.LastUsedAt = now
+	session.ExpiresAt = s.policy.expiry(session.CreatedAt, now)
+	session.UserAgent = clip(userAgent, maxUserAgent)
+	session.IP = ip
+
+	/* Only one rotation of a token wins; the loser presented a token that is now the previous one */
+	current := bson.M{"_id": session.ID, "tokenId": claims.TokenID, "revokedAt": bson.M{"$exists": false}}
+	update := bson.M{"$set": bson.M{
+		"tokenId":         session.TokenID,
+		"previousTokenId": session.PreviousTokenID,
+		"rotatedAt":       session.RotatedAt,
+		"lastUsedAt":      session.LastUsedAt,
+		"expiresAt":       session.ExpiresAt,
+		"userAgent":       session.UserAgent,
+		"ip":              session.IP,
+	}}
+	if err := s.sessionsCollection.UpdateOne(ctx, current, update); err != nil {
+		if errors.Is(err, qmgo.ErrNoSuchDocuments) {
+			return nil, nil, ErrRefreshRaced
+		}
+		return nil, nil, err
+	}
+
+	auth, err := common.GenerateAuth(&user, refreshClaims(&session))
+	if err != nil {
+		return nil, nil, err
+	}
+	return &user, auth, nil
+}
+
+/* EndSession revokes the session refreshToken belongs to, whichever of its tokens it is */
+func (s *Service) EndSession(ctx context.Context, refreshToken string) error {
+	claims, err := common.ParseRefreshToken(refreshToken)
+	if err != nil {
+		return ErrRefreshInvalid
+	}
+	err = s.RevokeSession(ctx, claims.Subject, claims.SessionID)
+	if errors.Is(err, ErrSessionNotFound) {
+		return nil
+	}
+	return err
+}
+
+/* ListSessions returns the user's sessions that can still refresh, most recently used first */
+func (s *Service) ListSessions(ctx context.Context, userID, currentID string) ([]models.Session, error) {
+	filter := bson.M{"userId": userID, "revokedAt": bson.M{"$exists": false}, "expiresAt": bson.M{"$gt": time.Now()}}
+	sessions := []models.Session{}
+	if err := s.sessionsCollection.Find(ctx, filter).Sort("-lastUsedAt").All(&sessions); err != nil {
+		return nil, err
+	}
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == currentID
+	}
+	return sessions, nil
+}
+
+/* RevokeSession ends one of the user's sessions */
+func (s *Service) RevokeSession(ctx context.Context, userID, sessionID string) error {
+	filter := bson.M{"_id": sessionID, "userId": userID, "revokedAt": bson.M{"$exists": false}}
+	err := s.sessionsCollection.UpdateOne(ctx, filter, revoke(time.Now(), "logout"))
+	if errors.Is(err, qmgo.ErrNoSuchDocuments) {
+		return ErrSessionNotFound
+	}
+	if err == nil {
+		s.activeSessions.forget(sessionID)
+	}
+	return err
+}
+
+/* RevokeSessions ends every session of the user except keepID, if given, and returns how many it ended */
+func (s *Service) RevokeSessions(ctx context.Context, userID, keepID, reason string) (int64, error) {
+	filter := bson.M{"userId": userID, "revokedAt": bson.M{"$exists": false}}
+	if keepID != "" {
+		filter["_id"] = bson.M{"$ne": keepID}
+	}
+	result, err := s.sessionsCollection.UpdateAll(ctx, filter, revoke(time.Now(), reason))
+	if err != nil {
+		return 0, err
+	}
+	s.activeSessions.forgetUser(userID)
+	return result.ModifiedCount, nil
+}
+
+/*
+Active implements middlewares.SessionChecker. Results are cached for sessionCheckTTL; revoking
+through this instance clears them at once, other instances catch up within the TTL.
+*/
+func (s *Service) Active(ctx context.Context, userID, sessionID string) (bool, error) {
+	now := time.Now()
+	if active, ok := s.activeSessions.get(userID, sessionID, now); ok {
+		return active, nil
+	}
+
+	var session models.Session
+	err := s.sessionsCollection.Find(ctx, bson.M{"_id": sessionID, "userId": userID}).One(&session)
+	if err != nil && !errors.Is(err, qmgo.ErrNoSuchDocuments) {
+		return false, err
+	}
+	active := err == nil && session.RevokedAt == nil && now.Before(session.ExpiresAt)
+	s.activeSessions.put(userID, sessionID, active, session.ExpiresAt, now)
+	return active, nil
+}
+
+/* revoke marks sessions revoked; they stay until they expire so their tokens are recognised */
+func revoke(now time.Time, reason string) bson.M {
+	return bson.M{"$set": bson.M{"revokedAt": now, "revokedReason": reason}}
+}
@@ -0,0 +1,80 @@
+package auth
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	/* sessionCheckTTL bounds how long another instance keeps accepting access tokens of a session revoked elsewhere */
+	sessionCheckTTL = 30 * time.Second
+	/* maxCachedSessions bounds the cache; expired entries are swept once it fills up */
+	maxCachedSessions = 10000
+)
+
+type sessionState struct {
+	userID string
+	active bool
+	until  time.Time
+}
+
+/* sessionCache remembers recent session checks so access tokens are not checked against Mongo on every request */
+type sessionCache struct {
+	mu      sync.Mutex
+	entries map[string]sessionState
+}
+
+func newSessionCache() *sessionCache {
+	return &sessionCache{entries: map[string]sessionState{}}
+}
+
+/* get returns the cached state of a session of userID, if there is a fresh one */
+func (c *sessionCache) get(userID, sessionID string, now time.Time) (active, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	state, found := c.entries[sessionID]
+	if !found || state.userID != userID || !now.Before(state.until) {
+		return false, false
+	}
+	return state.active, true
+}
+
+/* put caches a check until ttl passes or, for an active session, until it expires if that comes first */
+func (c *sessionCache) put(userID, sessionID string, active bool, expiresAt, now time.Time) {
+	until := now.Add(sessionCheckTTL)
+	if active && expiresAt.Before(until) {
+		until = expiresAt
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.entries) >= maxCachedSessions {
+		for id, state := range c.entries {
+			if !now.Before(state.until) {
+				delete(c.entries, id)
+			}
+		}
+		if len(c.entries) >= maxCachedSessions {
+			c.entries = map[string]sessionState{}
+		}
+	}
+	c.entries[sessionID] = sessionState{userID: userID, active: active, until: until}
+}
+
+/* forget drops the cached state of one session */
+func (c *sessionCache) forget(sessionID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, sessionID)
+}
+
+/* forgetUser drops the cached state of every session of userID */
+func (c *sessionCache) forgetUser(userID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for id, state := range c.entries {
+		if state.userID == userID {
+			delete(c.entries, id)
+		}
+	}
+}
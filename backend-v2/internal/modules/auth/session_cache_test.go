@@ -0,0 +1,42 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSessionCache(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	cache := newSessionCache()
+
+	cache.put("alice", "s1", true, now.Add(time.Hour), now)
+	if active, ok := cache.get("alice", "s1", now.Add(time.Second)); !ok || !active {
+		t.Errorf("get() = %v, %v, want a cached active session", active, ok)
+	}
+	if _, ok := cache.get("mallory", "s1", now); ok {
+		t.Errorf("get() answered for another user's session")
+	}
+	if _, ok := cache.get("alice", "s1", now.Add(sessionCheckTTL)); ok {
+		t.Errorf("get() answered after the check went stale")
+	}
+
+	cache.put("alice", "s2", true, now.Add(time.Second), now)
+	if _, ok := cache.get("alice", "s2", now.Add(2*time.Second)); ok {
+		t.Errorf("get() kept a session active past its expiry")
+	}
+
+	cache.forget("s1")
+	if _, ok := cache.get("alice", "s1", now); ok {
+		t.Errorf("get() answered for a forgotten session")
+	}
+
+	cache.put("alice", "s3", true, now.Add(time.Hour), now)
+	cache.put("bob", "s4", true, now.Add(time.Hour), now)
+	cache.forgetUser("alice")
+	if _, ok := cache.get("alice", "s3", now); ok {
+		t.Errorf("forgetUser() kept one of the user's sessions")
+	}
+	if _, ok := cache.get("bob", "s4", now); !ok {
+		t.Errorf("forgetUser() dropped another user's session")
+	}
+}
@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"backend-v2/internal/common"
+	"backend-v2/internal/models"
+)
+
+func TestParseSessionPolicy(t *testing.T) {
+	policy, err := ParseSessionPolicy("")
+	if err != nil || policy != DefaultSessionPolicy() {
+		t.Fatalf("ParseSessionPolicy(\"\") = %+v, %v, want the defaults", policy, err)
+	}
+
+	policy, err = ParseSessionPolicy("refresh=1h, lifetime=48h, grace=0s")
+	if err != nil || policy.RefreshTTL != time.Hour || policy.Lifetime != 48*time.Hour || policy.Grace != 0 {
+		t.Errorf("ParseSessionPolicy() = %+v, %v", policy, err)
+	}
+
+	for _, spec := range []string{"refresh", "refresh=0s", "lifetime=-1h", "grace=soon", "idle=1h", "refresh=48h,lifetime=24h"} {
+		if _, err := ParseSessionPolicy(spec); err == nil {
+			t.Errorf("ParseSessionPolicy(%q) accepted", spec)
+		}
+	}
+}
+
+func TestSessionPolicy_ExpiryStopsAtLifetime(t *testing.T) {
+	policy := SessionPolicy{RefreshTTL: 24 * time.Hour, Lifetime: 72 * time.Hour}
+	created := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	if got := policy.expiry(created, created.Add(time.Hour)); !got.Equal(created.Add(25 * time.Hour)) {
+		t.Errorf("expiry() = %v, want a day after the refresh", got)
+	}
+	if got := policy.expiry(created, created.Add(60*time.Hour)); !got.Equal(created.Add(72 * time.Hour)) {
+		t.Errorf("expiry() = %v, want the session's lifetime", got)
+	}
+}
+
+func TestCheckRefresh(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	revoked := now.Add(-time.Minute)
+	session := func() *models.Session {
+		return &models.Session{
+			ID:              "s",
+			UserID:          "alice",
+			TokenID:         "current",
+			PreviousTokenID: "previous",
+			RotatedAt:       now.Add(-10 * time.Second),
+			ExpiresAt:       now.Add(time.Hour),
+		}
+	}
+	claims := func(tokenID string) *common.RefreshClaims {
+		return &common.RefreshClaims{Subject: "alice", SessionID: "s", TokenID: tokenID}
+	}
+	grace := 30 * time.Second
+
+	late := session()
+	late.RotatedAt = now.Add(-time.Minute)
+	ended := session()
+	ended.RevokedAt = &revoked
+	expired := session()
+	expired.ExpiresAt = now
+
+	cases := []struct {
+		name    string
+		session *models.Session
+		claims  *common.RefreshClaims
+		want    error
+	}{
+		{"current token", session(), claims("current"), nil},
+		{"previous token within grace", session(), claims("previous"), ErrRefreshRaced},
+		{"previous token after grace", late, claims("previous"), ErrRefreshReused},
+		{"older token", session(), claims("older"), ErrRefreshReused},
+		{"other user", session(), &common.RefreshClaims{Subject: "mallory", SessionID: "s", TokenID: "current"}, ErrRefreshInvalid},
+		{"revoked session", ended, claims("current"), ErrSessionRevoked},
+		{"expired session", expired, claims("current"), ErrRefreshInvalid},
+	}
+	for _, c := range cases {
+		if got := checkRefresh(c.session, c.claims, now, grace); got != c.want {
+			t.Errorf("%s: checkRefresh() = %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestRefreshToken_RoundTrip(t *testing.T) {
+	user := &models.User{Name: "alice", Roles: []string{"subscriber"}}
+	session := &models.Session{ID: "s", UserID: "alice", TokenID: "t", ExpiresAt: time.Now().Add(time.Hour).Truncate(time.Second)}
+
+	auth, err := common.GenerateAuth(user, refreshClaims(session))
+	if err != nil {
+		t.Fatalf("GenerateAuth() = %v", err)
+	}
+	if auth.RefreshToken == auth.AccessToken {
+		t.Fatalf("GenerateAuth() issued the access token as the refresh token")
+	}
+
+	claims, err := common.ParseRefreshToken(auth.RefreshToken)
+	if err != nil {
+		t.Fatalf("ParseRefreshToken() = %v", err)
+	}
+	if *claims != refreshClaims(session) {
+		t.Errorf("ParseRefreshToken() = %+v, want %+v", *claims, refreshClaims(session))
+	}
+
+	if _, err := common.ParseRefreshToken(auth.AccessToken); err == nil {
+		t.Errorf("ParseRefreshToken() accepted an access token")
+	}
+}
@@ -19,7 +19,7 @@ type Proxy struct {
 }
 
 func NewProxy(config *Config) *Proxy {
-	factory := http.NewClientFactory()
+	factory := http.NewTrustedClientFactory()
 	return &Proxy{
 		config:          config,
 		httpClient:      factory.Create(300 * time.Second),
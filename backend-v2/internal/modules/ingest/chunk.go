@@ -0,0 +1,112 @@
+package ingest
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	/* defaultChunkSize applies when neither the request nor the integration sets one */
+	defaultChunkSize = 2000
+	minChunkSize     = 100
+	maxChunkSize     = 8000
+)
+
+/* separators are tried in order; text is split on the coarsest one that brings pieces under the size */
+var separators = []string{"\n\n", "\n", ". ", " "}
+
+/*
+Chunk splits text into pieces of at most size characters, preferring paragraph, line, sentence
+and word boundaries in that order. Consecutive chunks share about overlap characters of context.
+*/
+func Chunk(text string, size, overlap int) []string {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil
+	}
+	if overlap < 0 || overlap >= size {
+		overlap = 0
+	}
+	return merge(split(text, size, separators), size, overlap)
+}
+
+/* split breaks text into pieces no longer than size, each keeping its trailing separator */
+func split(text string, size int, seps []string) []string {
+	if length(text) <= size {
+		return []string{text}
+	}
+	if len(seps) == 0 {
+		return hardSplit(text, size)
+	}
+
+	var pieces []string
+	for _, part := range splitAfter(text, seps[0]) {
+		if length(part) <= size {
+			pieces = append(pieces, part)
+			continue
+		}
+		pieces = append(pieces, split(part, size, seps[1:])...)
+	}
+	return pieces
+}
+
+func splitAfter(text, sep string) []string {
+	parts := strings.SplitAfter(text, sep)
+	if parts[len(parts)-1] == "" {
+		parts = parts[:len(parts)-1]
+	}
+	return parts
+}
+
+/* hardSplit cuts a run without separators at size characters */
+func hardSplit(text string, size int) []string {
+	var pieces []string
+	runes := []rune(text)
+	for len(runes) > size {
+		pieces = append(pieces, string(runes[:size]))
+		runes = runes[size:]
+	}
+	return append(pieces, string(runes))
+}
+
+/* merge packs pieces into chunks up to size, starting each new chunk with the previous one's tail pieces up to overlap */
+func merge(pieces []string, size, overlap int) []string {
+	var (
+		chunks  []string
+		current []string
+		total   int
+	)
+	flush := func() {
+		if chunk := strings.TrimSpace(strings.Join(current, "")); chunk != "" {
+			chunks = append(chunks, chunk)
+		}
+	}
+
+	for _, piece := range pieces {
+		n := length(piece)
+		if total+n > size && len(current) > 0 {
+			flush()
+			/* Keep whole pieces from the end while they fit the overlap and leave room for this one */
+			keep := len(current)
+			kept := 0
+			for keep > 0 {
+				next := length(current[keep-1])
+				if kept+next > overlap || kept+next+n > size {
+					break
+				}
+				kept += next
+				keep--
+			}
+			current = append([]string(nil), current[keep:]...)
+			total = kept
+		}
+		current = append(current, piece)
+		total += n
+	}
+	flush()
+	return chunks
+}
+
+func length(s string) int {
+	return utf8.RuneCountInString(s)
+}
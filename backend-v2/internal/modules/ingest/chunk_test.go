@@ -0,0 +1,60 @@
+package ingest
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestChunk_PrefersParagraphsAndRespectsSize(t *testing.T) {
+	text := "First paragraph is short.\n\nSecond paragraph is also short.\n\nThird one closes the text."
+	chunks := Chunk(text, 40, 0)
+
+	want := []string{"First paragraph is short.", "Second paragraph is also short.", "Third one closes the text."}
+	if len(chunks) != len(want) {
+		t.Fatalf("Chunk() = %q, want %q", chunks, want)
+	}
+	for i := range want {
+		if chunks[i] != want[i] {
+			t.Errorf("chunk %d = %q, want %q", i, chunks[i], want[i])
+		}
+	}
+}
+
+func TestChunk_OverlapCarriesContext(t *testing.T) {
+	words := make([]string, 200)
+	for i := range words {
+		words[i] = "word"
+	}
+	chunks := Chunk(strings.Join(words, " "), 100, 20)
+	if len(chunks) < 2 {
+		t.Fatalf("Chunk() made %d chunks, want several", len(chunks))
+	}
+
+	total := 0
+	for i, chunk := range chunks {
+		if n := utf8.RuneCountInString(chunk); n > 100 {
+			t.Errorf("chunk %d has %d characters, want at most 100", i, n)
+		}
+		total += strings.Count(chunk, "word")
+	}
+	if total <= 200 {
+		t.Errorf("chunks hold %d words, want overlap to repeat some of the 200", total)
+	}
+}
+
+func TestChunk_SplitsUnbrokenRunsAndMultibyteText(t *testing.T) {
+	chunks := Chunk(strings.Repeat("ж", 250), 100, 10)
+	if len(chunks) != 3 {
+		t.Fatalf("Chunk() made %d chunks, want 3", len(chunks))
+	}
+	for _, chunk := range chunks {
+		if !utf8.ValidString(chunk) || utf8.RuneCountInString(chunk) > 100 {
+			t.Errorf("chunk %q is invalid or too long", chunk)
+		}
+	}
+
+	if chunks := Chunk("   \n\n ", 100, 10); chunks != nil {
+		t.Errorf("blank text chunks = %q, want none", chunks)
+	}
+}
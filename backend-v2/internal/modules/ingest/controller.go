@@ -0,0 +1,189 @@
+package ingest
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+
+	"backend-v2/internal/common/http"
+	"backend-v2/internal/common/response"
+	"backend-v2/internal/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+/* listLimit is how many recent jobs GET /vector/ingest returns */
+const listLimit = 50
+
+type Controller struct {
+	service *Service
+}
+
+func NewController(service *Service) *Controller {
+	return &Controller{service: service}
+}
+
+/* POST /vector/ingest - Queue a file, URL or text to be chunked, embedded and stored in a context */
+func (c *Controller) Ingest(ctx *fiber.Ctx) error {
+	userID, ok := ctx.Locals("userId").(string)
+	if !ok {
+		return response.Unauthorized(ctx, "Unauthorized")
+	}
+
+	var payload struct {
+		ContextName  *string `json:"contextName"`
+		Type         string  `json:"type"`
+		Source       string  `json:"source"`
+		Provider     string  `json:"provider"`
+		Model        string  `json:"model"`
+		FileID       string  `json:"fileId"`
+		URL          string  `json:"url"`
+		Text         string  `json:"text"`
+		ContentType  string  `json:"contentType"`
+		ChunkSize    int     `json:"chunkSize"`
+		ChunkOverlap int     `json:"chunkOverlap"`
+		Keep         bool    `json:"keep"`
+	}
+
+	if err := ctx.BodyParser(&payload); err != nil {
+		return response.BadRequest(ctx, "Invalid payload")
+	}
+
+	if payload.Type == "" {
+		return response.BadRequest(ctx, "Invalid payload: \"type\" is required")
+	}
+
+	inputs := 0
+	for _, input := range []string{payload.FileID, payload.URL, payload.Text} {
+		if input != "" {
+			inputs++
+		}
+	}
+	if inputs != 1 {
+		return response.BadRequest(ctx, "Invalid payload: exactly one of \"fileId\", \"url\" and \"text\" is required")
+	}
+	if len(payload.Text) > MaxTextBytes {
+		return response.BadRequest(ctx, "\"text\" is larger than "+strconv.Itoa(MaxTextBytes>>20)+" MB, upload it as a file instead")
+	}
+
+	if payload.URL != "" {
+		target, err := url.Parse(payload.URL)
+		if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+			return response.BadRequest(ctx, "\"url\" must be an absolute http(s) URL")
+		}
+		if err := http.DefaultGuard().CheckURL(target); err != nil {
+			return response.BadRequest(ctx, "\"url\" is not allowed: "+err.Error())
+		}
+	}
+
+	if payload.ChunkSize != 0 && (payload.ChunkSize < minChunkSize || payload.ChunkSize > maxChunkSize) {
+		return response.BadRequest(ctx, "\"chunkSize\" must be between "+strconv.Itoa(minChunkSize)+" and "+strconv.Itoa(maxChunkSize))
+	}
+	if payload.ChunkOverlap < 0 || (payload.ChunkSize != 0 && payload.ChunkOverlap*2 > payload.ChunkSize) {
+		return response.BadRequest(ctx, "\"chunkOverlap\" must be at most half of \"chunkSize\"")
+	}
+
+	job := &models.IngestJob{
+		UserID:       userID,
+		ContextName:  payload.ContextName,
+		Type:         payload.Type,
+		Source:       payload.Source,
+		Provider:     payload.Provider,
+		Model:        payload.Model,
+		FileID:       payload.FileID,
+		URL:          payload.URL,
+		Text:         payload.Text,
+		ContentType:  payload.ContentType,
+		ChunkSize:    payload.ChunkSize,
+		ChunkOverlap: payload.ChunkOverlap,
+		Keep:         payload.Keep,
+	}
+
+	err := c.service.Enqueue(ctx.Context(), job)
+	if errors.Is(err, ErrFileNotFound) {
+		return response.NotFound(ctx, "File not found")
+	}
+	if err != nil {
+		return response.InternalError(ctx, err.Error())
+	}
+
+	return ctx.Status(fiber.StatusAccepted).JSON(job)
+}
+
+/* POST /vector/reembed - Queue embedding a type's vectors again with another model */
+func (c *Controller) Reembed(ctx *fiber.Ctx) error {
+	userID, ok := ctx.Locals("userId").(string)
+	if !ok {
+		return response.Unauthorized(ctx, "Unauthorized")
+	}
+
+	var payload struct {
+		ContextName *string `json:"contextName"`
+		Type        string  `json:"type"`
+		Provider    string  `json:"provider"`
+		Model       string  `json:"model"`
+	}
+
+	if err := ctx.BodyParser(&payload); err != nil {
+		return response.BadRequest(ctx, "Invalid payload")
+	}
+
+	if payload.Type == "" {
+		return response.BadRequest(ctx, "Invalid payload: \"type\" is required")
+	}
+
+	job := &models.IngestJob{
+		Kind:        models.IngestKindReembed,
+		UserID:      userID,
+		ContextName: payload.ContextName,
+		Type:        payload.Type,
+		Provider:    payload.Provider,
+		Model:       payload.Model,
+	}
+
+	err := c.service.Enqueue(ctx.Context(), job)
+	if errors.Is(err, ErrTypeNotFound) {
+		return response.NotFound(ctx, "Context type not found")
+	}
+	if errors.Is(err, ErrModelRequired) {
+		return response.BadRequest(ctx, "Invalid payload: \"model\" is required for "+job.Provider)
+	}
+	if err != nil {
+		return response.InternalError(ctx, err.Error())
+	}
+
+	return ctx.Status(fiber.StatusAccepted).JSON(job)
+}
+
+/* GET /vector/ingest - List the user's recent ingest jobs */
+func (c *Controller) List(ctx *fiber.Ctx) error {
+	userID, ok := ctx.Locals("userId").(string)
+	if !ok {
+		return response.Unauthorized(ctx, "Unauthorized")
+	}
+
+	jobs, err := c.service.List(ctx.Context(), userID, listLimit)
+	if err != nil {
+		return response.InternalError(ctx, err.Error())
+	}
+
+	return ctx.JSON(jobs)
+}
+
+/* GET /vector/ingest/:id - Get an ingest job with its progress */
+func (c *Controller) Get(ctx *fiber.Ctx) error {
+	userID, ok := ctx.Locals("userId").(string)
+	if !ok {
+		return response.Unauthorized(ctx, "Unauthorized")
+	}
+
+	job, err := c.service.Get(ctx.Context(), userID, ctx.Params("id"))
+	if errors.Is(err, ErrJobNotFound) {
+		return response.NotFound(ctx, "Ingest job not found")
+	}
+	if err != nil {
+		return response.InternalError(ctx, err.Error())
+	}
+
+	return ctx.JSON(job)
+}
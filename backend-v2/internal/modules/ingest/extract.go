@@ -0,0 +1,160 @@
+package ingest
+
+import (
+	"bytes"
+	"errors"
+	"html"
+	"mime"
+	"path"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+/* Kind is a document format text can be extracted from */
+type Kind string
+
+const (
+	KindText     Kind = "text"
+	KindMarkdown Kind = "markdown"
+	KindHTML     Kind = "html"
+	KindPDF      Kind = "pdf"
+)
+
+var ErrUnsupportedFormat = errors.New("unsupported document format; send plain text, Markdown, HTML or PDF")
+
+/*
+DetectKind picks the format from the content type, then the file extension, then the leading
+bytes. Content types like application/octet-stream say nothing and fall through.
+*/
+func DetectKind(contentType, filename string, data []byte) (Kind, error) {
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		switch mediaType {
+		case "application/pdf":
+			return KindPDF, nil
+		case "text/html", "application/xhtml+xml":
+			return KindHTML, nil
+		case "text/markdown", "text/x-markdown":
+			return KindMarkdown, nil
+		case "text/plain", "text/csv", "application/json":
+			return KindText, nil
+		}
+	}
+
+	switch strings.ToLower(path.Ext(filename)) {
+	case ".pdf":
+		return KindPDF, nil
+	case ".html", ".htm", ".xhtml":
+		return KindHTML, nil
+	case ".md", ".markdown":
+		return KindMarkdown, nil
+	case ".txt", ".csv", ".json", ".log":
+		return KindText, nil
+	}
+
+	head := bytes.ToLower(bytes.TrimSpace(data[:min(len(data), 512)]))
+	switch {
+	case bytes.HasPrefix(head, []byte("%pdf-")):
+		return KindPDF, nil
+	case bytes.HasPrefix(head, []byte("<!doctype html")), bytes.HasPrefix(head, []byte("<html")):
+		return KindHTML, nil
+	case utf8.Valid(data) && !bytes.ContainsRune(data, 0):
+		return KindText, nil
+	}
+	return "", ErrUnsupportedFormat
+}
+
+/* Extract returns the readable text of a document of the given kind */
+func Extract(kind Kind, data []byte) (string, error) {
+	switch kind {
+	case KindPDF:
+		return extractPDF(data)
+	case KindHTML:
+		return htmlText(string(data)), nil
+	case KindMarkdown:
+		return markdownText(string(data)), nil
+	case KindText:
+		if !utf8.Valid(data) {
+			return "", ErrUnsupportedFormat
+		}
+		return normalizeSpace(string(data)), nil
+	}
+	return "", ErrUnsupportedFormat
+}
+
+var (
+	htmlComment = regexp.MustCompile(`(?s)<!--.*?-->`)
+	htmlHidden  = map[string]*regexp.Regexp{}
+	htmlBreak   = regexp.MustCompile(`(?i)<br\b[^>]*>`)
+	htmlBlock   = regexp.MustCompile(`(?i)</?(p|div|hr|li|ul|ol|dl|dt|dd|h[1-6]|tr|table|thead|tbody|section|article|header|footer|nav|aside|main|pre|blockquote|figure|figcaption|form)\b[^>]*>`)
+	htmlCell    = regexp.MustCompile(`(?i)</t[dh]\s*>`)
+	htmlTag     = regexp.MustCompile(`(?s)<[a-zA-Z/!?][^>]*>`)
+)
+
+func init() {
+	/* RE2 has no backreferences, so each element whose content is never shown gets its own pattern */
+	for _, tag := range []string{"script", "style", "noscript", "head", "svg", "template", "iframe"} {
+		htmlHidden[tag] = regexp.MustCompile(`(?is)<` + tag + `\b.*?</` + tag + `\s*>`)
+	}
+}
+
+/* htmlText drops markup, scripts and styles, keeping block boundaries as paragraph breaks */
+func htmlText(source string) string {
+	source = htmlComment.ReplaceAllString(source, "")
+	for _, hidden := range htmlHidden {
+		source = hidden.ReplaceAllString(source, "")
+	}
+	source = htmlBreak.ReplaceAllString(source, "\n")
+	source = htmlBlock.ReplaceAllString(source, "\n\n")
+	source = htmlCell.ReplaceAllString(source, " ")
+	source = htmlTag.ReplaceAllString(source, "")
+	return normalizeSpace(html.UnescapeString(source))
+}
+
+var (
+	markdownFence   = regexp.MustCompile("(?m)^[ \\t]*(```|~~~).*$")
+	markdownImage   = regexp.MustCompile(`!\[([^\]]*)\]\([^)]*\)`)
+	markdownLink    = regexp.MustCompile(`\[([^\]]+)\]\([^)]*\)`)
+	markdownHeading = regexp.MustCompile(`(?m)^[ \t]{0,3}#{1,6}[ \t]+`)
+	markdownQuote   = regexp.MustCompile(`(?m)^[ \t]{0,3}>[ \t]?`)
+	markdownRule    = regexp.MustCompile(`(?m)^[ \t]{0,3}([-*_][ \t]*){3,}$`)
+	markdownEmph    = regexp.MustCompile(`(\*\*|__|~~)`)
+)
+
+/* markdownText keeps the prose of a Markdown document and drops its syntax */
+func markdownText(source string) string {
+	source = markdownFence.ReplaceAllString(source, "")
+	source = markdownImage.ReplaceAllString(source, "$1")
+	source = markdownLink.ReplaceAllString(source, "$1")
+	source = markdownHeading.ReplaceAllString(source, "")
+	source = markdownQuote.ReplaceAllString(source, "")
+	source = markdownRule.ReplaceAllString(source, "")
+	source = markdownEmph.ReplaceAllString(source, "")
+	return normalizeSpace(htmlText(source))
+}
+
+/* normalizeSpace collapses runs of blanks within lines and keeps at most one empty line between paragraphs */
+func normalizeSpace(text string) string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\r", "\n")
+
+	var out strings.Builder
+	blank := 0
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.Join(strings.Fields(line), " ")
+		if line == "" {
+			blank++
+			continue
+		}
+		if out.Len() > 0 {
+			if blank > 0 {
+				out.WriteString("\n\n")
+			} else {
+				out.WriteString("\n")
+			}
+		}
+		out.WriteString(line)
+		blank = 0
+	}
+	return out.String()
+}
@@ -0,0 +1,178 @@
+package ingest
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestDetectKind(t *testing.T) {
+	cases := []struct {
+		contentType, filename string
+		data                  string
+		want                  Kind
+	}{
+		{"application/pdf", "", "", KindPDF},
+		{"text/html; charset=utf-8", "", "", KindHTML},
+		{"application/octet-stream", "notes.md", "", KindMarkdown},
+		{"", "report.PDF", "", KindPDF},
+		{"", "", "%PDF-1.7\n", KindPDF},
+		{"", "", "<!DOCTYPE html><html>", KindHTML},
+		{"", "", "plain words", KindText},
+	}
+	for _, c := range cases {
+		got, err := DetectKind(c.contentType, c.filename, []byte(c.data))
+		if err != nil || got != c.want {
+			t.Errorf("DetectKind(%q, %q) = %q, %v, want %q", c.contentType, c.filename, got, err, c.want)
+		}
+	}
+
+	if _, err := DetectKind("", "image.bin", []byte{0x89, 'P', 'N', 'G', 0, 0}); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Errorf("binary data error = %v, want ErrUnsupportedFormat", err)
+	}
+}
+
+func TestExtract_HTML(t *testing.T) {
+	source := `<html><head><title>T</title><style>p{color:red}</style></head>
+<body><script>alert(1)</script><h1>Title</h1><p>One &amp; <b>two</b>.</p><p>Three<br>four</p>
+<!-- hidden --><table><tr><td>a</td><td>b</td></tr></table></body></html>`
+
+	text, err := Extract(KindHTML, []byte(source))
+	if err != nil {
+		t.Fatalf("Extract() error = %v", err)
+	}
+	want := "Title\n\nOne & two.\n\nThree\nfour\n\na b"
+	if text != want {
+		t.Errorf("Extract() = %q, want %q", text, want)
+	}
+}
+
+func TestExtract_Markdown(t *testing.T) {
+	source := "# Heading\n\nSome **bold** text with a [link](https://example.com) and ![alt text](img.png).\n\n```go\nfmt.Println(1 < 2)\n```\n\n> quoted"
+
+	text, err := Extract(KindMarkdown, []byte(source))
+	if err != nil {
+		t.Fatalf("Extract() error = %v", err)
+	}
+	want := "Heading\n\nSome bold text with a link and alt text.\n\nfmt.Println(1 < 2)\n\nquoted"
+	if text != want {
+		t.Errorf("Extract() = %q, want %q", text, want)
+	}
+}
+
+/* buildPDF lays out numbered objects; streams are given as "dict|data" and compressed when the dict asks */
+func buildPDF(objects ...string) []byte {
+	var out bytes.Buffer
+	out.WriteString("%PDF-1.7\n")
+	for i, object := range objects {
+		fmt.Fprintf(&out, "%d 0 obj\n", i+1)
+		if dict, data, isStream := strings.Cut(object, "|"); isStream {
+			payload := []byte(data)
+			if strings.Contains(dict, "/FlateDecode") {
+				var compressed bytes.Buffer
+				writer := zlib.NewWriter(&compressed)
+				writer.Write(payload)
+				writer.Close()
+				payload = compressed.Bytes()
+			}
+			fmt.Fprintf(&out, "%s /Length %d >>\nstream\n", strings.TrimSuffix(dict, ">>"), len(payload))
+			out.Write(payload)
+			out.WriteString("\nendstream")
+		} else {
+			out.WriteString(object)
+		}
+		out.WriteString("\nendobj\n")
+	}
+	out.WriteString("trailer\n<< /Root 1 0 R >>\n%%EOF\n")
+	return out.Bytes()
+}
+
+func TestExtract_PDF(t *testing.T) {
+	toUnicode := "/CIDInit /ProcSet findresource begin\nbegincmap\n1 begincodespacerange <0000> <FFFF> endcodespacerange\n" +
+		"2 beginbfchar <0001> <0048> <0002> <0069> endbfchar\n1 beginbfrange <0010> <0012> <0041> endbfrange\nendcmap"
+
+	data := buildPDF(
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R 4 0 R] /Count 2 /Resources << /Font << /F1 5 0 R /F2 6 0 R >> >> >>",
+		"<< /Type /Page /Parent 2 0 R /Contents 7 0 R >>",
+		"<< /Type /Page /Parent 2 0 R /Contents [8 0 R] >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>",
+		"<< /Type /Font /Subtype /Type0 /ToUnicode 9 0 R >>",
+		"<< /Filter /FlateDecode >>|BT /F1 12 Tf 72 720 Td (Hello \\(PDF\\) world) Tj 0 -14 Td [(Sec) 20 (ond) -250 (line)] TJ ET",
+		"<< >>|BT /F2 12 Tf 1 0 0 1 72 700 Tm <00010002> Tj 1 0 0 1 72 680 Tm <001000110012> Tj ET",
+		"<< /Filter /FlateDecode >>|"+toUnicode,
+	)
+
+	text, err := Extract(KindPDF, data)
+	if err != nil {
+		t.Fatalf("Extract() error = %v", err)
+	}
+	want := "Hello (PDF) world\nSecond line\n\nHi\nABC"
+	if text != want {
+		t.Errorf("Extract() = %q, want %q", text, want)
+	}
+}
+
+func TestExtract_PDFWithoutText(t *testing.T) {
+	data := buildPDF(
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /Contents 4 0 R >>",
+		"<< >>|q 100 0 0 100 0 0 cm /Im1 Do Q",
+	)
+	if _, err := Extract(KindPDF, data); !errors.Is(err, ErrPDFNoText) {
+		t.Errorf("Extract() error = %v, want ErrPDFNoText", err)
+	}
+}
+
+func TestExtract_PDFDecodedBudget(t *testing.T) {
+	content := "BT (Hello) Tj ET"
+	data := buildPDF(
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /Contents [4 0 R 4 0 R 4 0 R] >>",
+		"<< /Filter /FlateDecode >>|"+content,
+	)
+
+	file := newPDFFile(3 * minPDFCharge)
+	file.scan(data)
+	if joined := file.contents(file.pages()[0].dict["Contents"]); file.err != nil || strings.Count(string(joined), "Hello") != 3 {
+		t.Fatalf("contents() = %q, %v; want the stream three times", joined, file.err)
+	}
+	if len(file.decoded) != 1 {
+		t.Errorf("decoded %d streams, want the shared one inflated once", len(file.decoded))
+	}
+
+	file = newPDFFile(3*minPDFCharge - 1)
+	file.scan(data)
+	file.contents(file.pages()[0].dict["Contents"])
+	if !errors.Is(file.err, ErrPDFTooLarge) {
+		t.Errorf("err = %v, want ErrPDFTooLarge once reuse passes the budget", file.err)
+	}
+}
+
+func FuzzExtractPDF(f *testing.F) {
+	f.Add([]byte("%PDF-0000000 0 obj<"))
+	f.Add([]byte("%PDF-1 0 obj << /Length 1e300 >> stream\nx\nendstream endobj"))
+	f.Add([]byte("%PDF-1 0 obj << /Type /ObjStm /N 1 /First 4 >> stream\n2 -9 (x)\nendstream endobj"))
+	f.Add(buildPDF(
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /Contents 4 0 R >>",
+		"<< /Filter /FlateDecode >>|BT /F1 12 Tf (Hello) Tj ET",
+	))
+	f.Add(buildPDF(
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /Resources << /XObject << /X 5 0 R >> >> /Contents [4 0 R 4 0 R] >>",
+		"<< /Filter /FlateDecode >>|/X Do /X Do",
+		"<< /Type /XObject /Subtype /Form /Filter /FlateDecode /Resources << /XObject << /X 5 0 R >> >> >>|/X Do /X Do BT (x) Tj ET",
+	))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		/* Malformed input must come back as an error, never a panic */
+		_, _ = Extract(KindPDF, data)
+	})
+}
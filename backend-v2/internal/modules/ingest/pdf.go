@@ -0,0 +1,910 @@
+package ingest
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+/*
+A small PDF text extractor: it finds objects by scanning rather than through the xref table,
+which also copes with damaged files, expands object streams, and replays the text operators
+of each page with the page's fonts. Fonts with a ToUnicode map decode exactly; simple fonts
+without one are read as WinAnsi. Scanned pages carry no text and come out empty.
+*/
+
+var (
+	ErrPDFEncrypted = errors.New("encrypted PDFs are not supported")
+	ErrPDFNoText    = errors.New("PDF has no extractable text; scanned documents need OCR first")
+	ErrPDFTooLarge  = errors.New("PDF expands to more than 256 MB of streams")
+)
+
+const (
+	/* maxPDFStream bounds one decompressed stream */
+	maxPDFStream = 64 << 20
+	/* maxPDFDecoded bounds the stream bytes one document hands out, counting each reuse */
+	maxPDFDecoded = 256 << 20
+	/* minPDFCharge is the least one use costs, which bounds how often tiny forms replay */
+	minPDFCharge = 1 << 10
+	/* maxPDFDepth bounds nesting of page trees, forms and parsed values */
+	maxPDFDepth = 32
+)
+
+type (
+	pdfName    string
+	pdfKeyword string
+	pdfDict    map[string]interface{}
+	pdfRef     struct{ num, gen int }
+)
+
+type pdfObject struct {
+	value  interface{}
+	stream []byte
+}
+
+type pdfFile struct {
+	objects map[int]*pdfObject
+	fonts   map[int]*pdfFont
+	/* decoded caches streams by object number, nil for ones that failed to decode */
+	decoded map[int][]byte
+	budget  int
+	err     error
+}
+
+func newPDFFile(budget int) *pdfFile {
+	return &pdfFile{objects: map[int]*pdfObject{}, fonts: map[int]*pdfFont{}, decoded: map[int][]byte{}, budget: budget}
+}
+
+var pdfObjectHeader = regexp.MustCompile(`(\d+)\s+(\d+)\s+obj\b`)
+
+func extractPDF(data []byte) (string, error) {
+	if !bytes.Contains(data[:min(len(data), 1024)], []byte("%PDF-")) {
+		return "", ErrUnsupportedFormat
+	}
+
+	file := newPDFFile(maxPDFDecoded)
+	file.scan(data)
+	for _, object := range file.objects {
+		if dict, ok := object.value.(pdfDict); ok && dict["Encrypt"] != nil {
+			return "", ErrPDFEncrypted
+		}
+	}
+	if trailer := bytes.LastIndex(data, []byte("trailer")); trailer >= 0 {
+		lexer := &pdfLexer{data: data, pos: trailer + len("trailer")}
+		if dict, ok := lexer.value(0).(pdfDict); ok && dict["Encrypt"] != nil {
+			return "", ErrPDFEncrypted
+		}
+	}
+
+	var out strings.Builder
+	for _, page := range file.pages() {
+		text := &pdfText{file: file}
+		text.run(file.contents(page.dict["Contents"]), page.resources, 0)
+		out.WriteString(text.out.String())
+		out.WriteString("\n\n")
+	}
+	if file.err != nil {
+		return "", file.err
+	}
+
+	text := normalizeSpace(out.String())
+	if text == "" {
+		return "", ErrPDFNoText
+	}
+	return text, nil
+}
+
+/* scan reads every "n g obj" in file order; later definitions win, as incremental updates append */
+func (f *pdfFile) scan(data []byte) {
+	skipUntil := 0
+	for _, match := range pdfObjectHeader.FindAllSubmatchIndex(data, -1) {
+		if match[0] < skipUntil {
+			continue
+		}
+		num, _ := strconv.Atoi(string(data[match[2]:match[3]]))
+		lexer := &pdfLexer{data: data, pos: match[1]}
+		object := &pdfObject{value: lexer.value(0)}
+
+		lexer.skipSpace()
+		if lexer.pos < len(data) && bytes.HasPrefix(data[lexer.pos:], []byte("stream")) {
+			start := lexer.pos + len("stream")
+			if bytes.HasPrefix(data[start:], []byte("\r\n")) {
+				start += 2
+			} else if start < len(data) && (data[start] == '\n' || data[start] == '\r') {
+				start++
+			}
+			end := streamEnd(data, start, object.value)
+			object.stream = data[start:end]
+			skipUntil = end
+		}
+		f.objects[num] = object
+	}
+
+	/* Objects inside object streams never override ones defined directly */
+	for _, num := range f.numsOfType("ObjStm") {
+		f.expandObjectStream(num)
+	}
+}
+
+/* streamEnd trusts a direct /Length that lands on endstream and searches for endstream otherwise */
+func streamEnd(data []byte, start int, value interface{}) int {
+	if start >= len(data) {
+		return len(data)
+	}
+	if dict, ok := value.(pdfDict); ok {
+		if length, ok := dict["Length"].(float64); ok && length >= 0 && length <= float64(len(data)-start) {
+			end := start + int(length)
+			if bytes.HasPrefix(bytes.TrimLeft(data[end:], "\r\n \t"), []byte("endstream")) {
+				return end
+			}
+		}
+	}
+	end := bytes.Index(data[start:], []byte("endstream"))
+	if end < 0 {
+		return len(data)
+	}
+	end += start
+	for end > start && (data[end-1] == '\n' || data[end-1] == '\r') {
+		end--
+	}
+	return end
+}
+
+func (f *pdfFile) expandObjectStream(num int) {
+	dict := f.objects[num].value.(pdfDict)
+	decoded := f.decode(num)
+	if decoded == nil {
+		return
+	}
+	count, _ := dict["N"].(float64)
+	first, _ := dict["First"].(float64)
+	if !(first >= 0 && first <= float64(len(decoded))) {
+		return
+	}
+
+	header := &pdfLexer{data: decoded[:int(first)]}
+	for i := 0; i < int(count); i++ {
+		num, okNum := header.value(0).(float64)
+		offset, okOffset := header.value(0).(float64)
+		if !okNum || !okOffset {
+			return
+		}
+		pos := int(first + offset)
+		if _, defined := f.objects[int(num)]; defined || offset < 0 || pos < 0 || pos >= len(decoded) {
+			continue
+		}
+		lexer := &pdfLexer{data: decoded, pos: pos}
+		f.objects[int(num)] = &pdfObject{value: lexer.value(0)}
+	}
+}
+
+func (f *pdfFile) numsOfType(typ string) []int {
+	var nums []int
+	for num, object := range f.objects {
+		if dict, ok := object.value.(pdfDict); ok && dict["Type"] == pdfName(typ) {
+			nums = append(nums, num)
+		}
+	}
+	sort.Ints(nums)
+	return nums
+}
+
+func (f *pdfFile) objectsOfType(typ string) []*pdfObject {
+	nums := f.numsOfType(typ)
+	objects := make([]*pdfObject, len(nums))
+	for i, num := range nums {
+		objects[i] = f.objects[num]
+	}
+	return objects
+}
+
+/* resolve follows indirect references */
+func (f *pdfFile) resolve(value interface{}) interface{} {
+	for i := 0; i < maxPDFDepth; i++ {
+		ref, ok := value.(pdfRef)
+		if !ok {
+			return value
+		}
+		object := f.objects[ref.num]
+		if object == nil {
+			return nil
+		}
+		value = object.value
+	}
+	return nil
+}
+
+func (f *pdfFile) dict(value interface{}) pdfDict {
+	dict, _ := f.resolve(value).(pdfDict)
+	return dict
+}
+
+/* stream returns the decoded stream an indirect reference points at */
+func (f *pdfFile) stream(value interface{}) (pdfDict, []byte) {
+	ref, ok := value.(pdfRef)
+	if !ok {
+		return nil, nil
+	}
+	object := f.objects[ref.num]
+	if object == nil || object.stream == nil {
+		return nil, nil
+	}
+	dict, _ := object.value.(pdfDict)
+	return dict, f.decode(ref.num)
+}
+
+/*
+decode inflates an object's stream once and charges every use against the document's budget,
+so a stream referenced from many pages or forms cannot multiply past it. Once the budget runs
+out, no stream decodes any more and the extraction fails with ErrPDFTooLarge.
+*/
+func (f *pdfFile) decode(num int) []byte {
+	if f.err != nil {
+		return nil
+	}
+	data, cached := f.decoded[num]
+	if !cached {
+		object := f.objects[num]
+		dict, _ := object.value.(pdfDict)
+		if decoded, ok := decodeStream(dict, object.stream, min(maxPDFStream, f.budget+1)); ok {
+			data = decoded
+		}
+		f.decoded[num] = data
+	}
+	charge := max(len(data), minPDFCharge)
+	if charge > f.budget {
+		f.err = ErrPDFTooLarge
+		return nil
+	}
+	f.budget -= charge
+	return data
+}
+
+/* contents joins a page's content streams */
+func (f *pdfFile) contents(value interface{}) []byte {
+	var refs []interface{}
+	switch resolved := f.resolve(value).(type) {
+	case []interface{}:
+		refs = resolved
+	default:
+		refs = []interface{}{value}
+	}
+
+	var joined []byte
+	for _, ref := range refs {
+		if _, data := f.stream(ref); data != nil {
+			joined = append(joined, data...)
+			joined = append(joined, '\n')
+		}
+	}
+	return joined
+}
+
+type pdfPage struct {
+	dict      pdfDict
+	resources pdfDict
+}
+
+/* pages walks the page tree in reading order, handing inherited resources down */
+func (f *pdfFile) pages() []pdfPage {
+	var pages []pdfPage
+	visited := map[int]bool{}
+
+	var walk func(value interface{}, inherited pdfDict, depth int)
+	walk = func(value interface{}, inherited pdfDict, depth int) {
+		if ref, ok := value.(pdfRef); ok {
+			if visited[ref.num] {
+				return
+			}
+			visited[ref.num] = true
+		}
+		node := f.dict(value)
+		if node == nil || depth > maxPDFDepth {
+			return
+		}
+		resources := inherited
+		if own := f.dict(node["Resources"]); own != nil {
+			resources = own
+		}
+		if node["Type"] == pdfName("Page") {
+			pages = append(pages, pdfPage{dict: node, resources: resources})
+			return
+		}
+		kids, _ := f.resolve(node["Kids"]).([]interface{})
+		for _, kid := range kids {
+			walk(kid, resources, depth+1)
+		}
+	}
+
+	/* Older revisions can leave unused trees behind; the first root with pages wins */
+	var roots []int
+	for num, object := range f.objects {
+		if dict, ok := object.value.(pdfDict); ok && dict["Type"] == pdfName("Pages") && dict["Parent"] == nil {
+			roots = append(roots, num)
+		}
+	}
+	sort.Ints(roots)
+	for _, num := range roots {
+		if walk(pdfRef{num: num}, nil, 0); len(pages) > 0 {
+			break
+		}
+	}
+	if len(pages) == 0 {
+		/* No usable page tree: take the page objects in definition order */
+		for _, object := range f.objectsOfType("Page") {
+			dict := object.value.(pdfDict)
+			pages = append(pages, pdfPage{dict: dict, resources: f.dict(dict["Resources"])})
+		}
+	}
+	return pages
+}
+
+/* decodeStream inflates FlateDecode filters, reading at most limit bytes from each */
+func decodeStream(dict pdfDict, raw []byte, limit int) ([]byte, bool) {
+	var filters []interface{}
+	switch filter := dict["Filter"].(type) {
+	case nil:
+		return raw, true
+	case pdfName:
+		filters = []interface{}{filter}
+	case []interface{}:
+		filters = filter
+	}
+
+	data := raw
+	for _, filter := range filters {
+		if filter != pdfName("FlateDecode") && filter != pdfName("Fl") {
+			return nil, false
+		}
+		reader, err := zlib.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, false
+		}
+		/* Truncated streams are common; keep whatever inflated before the error */
+		decoded, err := io.ReadAll(io.LimitReader(reader, int64(limit)))
+		if err != nil && len(decoded) == 0 {
+			return nil, false
+		}
+		data = decoded
+	}
+	return data, true
+}
+
+/* pdfText replays text operators into plain text */
+type pdfText struct {
+	file  *pdfFile
+	out   strings.Builder
+	font  *pdfFont
+	lastY float64
+	haveY bool
+}
+
+func (t *pdfText) run(content []byte, resources pdfDict, depth int) {
+	if depth > maxPDFDepth {
+		return
+	}
+	lexer := &pdfLexer{data: content}
+	var operands []interface{}
+
+	for {
+		token := lexer.value(0)
+		if token == nil && lexer.pos >= len(content) {
+			return
+		}
+		operator, ok := token.(pdfKeyword)
+		if !ok {
+			operands = append(operands, token)
+			continue
+		}
+
+		switch operator {
+		case "Tf":
+			if len(operands) >= 2 {
+				if name, ok := operands[0].(pdfName); ok {
+					t.font = t.file.font(t.file.dict(resources["Font"])[string(name)])
+				}
+			}
+		case "Tj":
+			t.show(last(operands))
+		case "'":
+			t.newline()
+			t.show(last(operands))
+		case "\"":
+			t.newline()
+			t.show(last(operands))
+		case "TJ":
+			items, _ := last(operands).([]interface{})
+			for _, item := range items {
+				if adjust, ok := item.(float64); ok {
+					/* Kerning is small; a gap this wide is a word space the generator did not emit */
+					if adjust < -180 {
+						t.space()
+					}
+					continue
+				}
+				t.show(item)
+			}
+		case "Td", "TD":
+			if len(operands) >= 2 {
+				if dy, _ := operands[1].(float64); dy != 0 {
+					t.newline()
+				} else {
+					t.space()
+				}
+			}
+		case "T*":
+			t.newline()
+		case "Tm":
+			if len(operands) >= 6 {
+				y, _ := operands[5].(float64)
+				if t.haveY && y != t.lastY {
+					t.newline()
+				} else {
+					t.space()
+				}
+				t.lastY, t.haveY = y, true
+			}
+		case "Do":
+			if len(operands) >= 1 {
+				name, _ := operands[0].(pdfName)
+				t.form(t.file.dict(resources["XObject"])[string(name)], resources, depth)
+			}
+		case "BI":
+			lexer.skipInlineImage()
+		}
+		operands = operands[:0]
+	}
+}
+
+/* form replays a form XObject, which draws with its own resources when it has them */
+func (t *pdfText) form(ref interface{}, resources pdfDict, depth int) {
+	dict, data := t.file.stream(ref)
+	if dict == nil || data == nil || dict["Subtype"] != pdfName("Form") {
+		return
+	}
+	if own := t.file.dict(dict["Resources"]); own != nil {
+		resources = own
+	}
+	t.run(data, resources, depth+1)
+}
+
+func (t *pdfText) show(value interface{}) {
+	if s, ok := value.([]byte); ok {
+		t.out.WriteString(t.font.decode(s))
+	}
+}
+
+func (t *pdfText) newline() {
+	if t.out.Len() > 0 && !strings.HasSuffix(t.out.String(), "\n") {
+		t.out.WriteByte('\n')
+	}
+}
+
+func (t *pdfText) space() {
+	if text := t.out.String(); text != "" && !strings.HasSuffix(text, " ") && !strings.HasSuffix(text, "\n") {
+		t.out.WriteByte(' ')
+	}
+}
+
+func last(values []interface{}) interface{} {
+	if len(values) == 0 {
+		return nil
+	}
+	return values[len(values)-1]
+}
+
+/* pdfFont decodes shown strings: through its ToUnicode map when present, otherwise as WinAnsi */
+type pdfFont struct {
+	cmap *pdfCMap
+	/* composite fonts use two-byte codes that mean nothing without a ToUnicode map */
+	composite bool
+}
+
+func (f *pdfFile) font(value interface{}) *pdfFont {
+	ref, cacheable := value.(pdfRef)
+	if font, ok := f.fonts[ref.num]; ok && cacheable {
+		return font
+	}
+
+	dict := f.dict(value)
+	font := &pdfFont{composite: dict["Subtype"] == pdfName("Type0")}
+	if _, data := f.stream(dict["ToUnicode"]); data != nil {
+		font.cmap = parseCMap(data)
+	}
+	if cacheable {
+		f.fonts[ref.num] = font
+	}
+	return font
+}
+
+func (f *pdfFont) decode(s []byte) string {
+	if f == nil {
+		return winAnsi(s)
+	}
+	if f.cmap == nil || len(f.cmap.chars) == 0 {
+		if f.composite {
+			return ""
+		}
+		return winAnsi(s)
+	}
+
+	width := f.cmap.width
+	if width == 0 {
+		width = 1
+		if f.composite {
+			width = 2
+		}
+	}
+	var out strings.Builder
+	for i := 0; i+width <= len(s); i += width {
+		code := bigEndian(s[i : i+width])
+		if text, ok := f.cmap.chars[code]; ok {
+			out.WriteString(text)
+		} else if width == 1 {
+			out.WriteString(winAnsi(s[i : i+1]))
+		}
+	}
+	return out.String()
+}
+
+/* winAnsiHigh maps the 0x80-0x9F range where WinAnsi departs from Latin-1 */
+var winAnsiHigh = map[byte]rune{
+	0x80: '€', 0x85: '…', 0x91: '‘', 0x92: '’', 0x93: '“', 0x94: '”',
+	0x95: '•', 0x96: '–', 0x97: '—', 0x99: '™',
+}
+
+func winAnsi(s []byte) string {
+	runes := make([]rune, 0, len(s))
+	for _, b := range s {
+		switch {
+		case b >= 0x80 && b <= 0x9f:
+			if r, ok := winAnsiHigh[b]; ok {
+				runes = append(runes, r)
+			}
+		case b < 0x20 && b != '\t' && b != '\n' && b != '\r':
+		default:
+			runes = append(runes, rune(b))
+		}
+	}
+	return string(runes)
+}
+
+type pdfCMap struct {
+	width int
+	chars map[uint32]string
+}
+
+/* maxCMapRange keeps a hostile bfrange from expanding into millions of entries */
+const maxCMapRange = 1 << 16
+
+func parseCMap(data []byte) *pdfCMap {
+	cmap := &pdfCMap{chars: map[uint32]string{}}
+	lexer := &pdfLexer{data: data}
+	for lexer.pos < len(data) {
+		switch lexer.value(0) {
+		case pdfKeyword("begincodespacerange"):
+			if lo, ok := lexer.value(0).([]byte); ok && cmap.width == 0 {
+				cmap.width = len(lo)
+			}
+		case pdfKeyword("beginbfchar"):
+			for {
+				src, ok := lexer.value(0).([]byte)
+				if !ok {
+					break
+				}
+				if cmap.width == 0 {
+					cmap.width = len(src)
+				}
+				if dst, ok := lexer.value(0).([]byte); ok {
+					cmap.chars[bigEndian(src)] = utf16BE(dst)
+				}
+			}
+		case pdfKeyword("beginbfrange"):
+			for {
+				lo, ok := lexer.value(0).([]byte)
+				if !ok {
+					break
+				}
+				hi, _ := lexer.value(0).([]byte)
+				if cmap.width == 0 {
+					cmap.width = len(lo)
+				}
+				first, end := bigEndian(lo), bigEndian(hi)
+				if end < first || end-first >= maxCMapRange {
+					lexer.value(0)
+					continue
+				}
+				switch dst := lexer.value(0).(type) {
+				case []byte:
+					if len(dst) == 0 {
+						continue
+					}
+					base := bigEndian(dst)
+					for code := first; code <= end; code++ {
+						cmap.chars[code] = utf16BE(putBigEndian(base+code-first, len(dst)))
+					}
+				case []interface{}:
+					for i, item := range dst {
+						if s, ok := item.([]byte); ok && first+uint32(i) <= end {
+							cmap.chars[first+uint32(i)] = utf16BE(s)
+						}
+					}
+				}
+			}
+		}
+	}
+	if cmap.width > 4 {
+		cmap.width = 0
+	}
+	return cmap
+}
+
+func bigEndian(b []byte) uint32 {
+	var v uint32
+	for _, c := range b[:min(len(b), 4)] {
+		v = v<<8 | uint32(c)
+	}
+	return v
+}
+
+func putBigEndian(v uint32, n int) []byte {
+	b := make([]byte, n)
+	for i := n - 1; i >= 0; i-- {
+		b[i] = byte(v)
+		v >>= 8
+	}
+	return b
+}
+
+func utf16BE(b []byte) string {
+	if len(b)%2 != 0 {
+		return winAnsi(b)
+	}
+	units := make([]uint16, len(b)/2)
+	for i := range units {
+		units[i] = uint16(b[2*i])<<8 | uint16(b[2*i+1])
+	}
+	return string(utf16.Decode(units))
+}
+
+/* pdfLexer reads PDF tokens and values; operators and delimiters come back as pdfKeyword */
+type pdfLexer struct {
+	data []byte
+	pos  int
+}
+
+func isPDFSpace(c byte) bool {
+	return c == 0 || c == '\t' || c == '\n' || c == '\f' || c == '\r' || c == ' '
+}
+
+func isPDFDelimiter(c byte) bool {
+	return strings.IndexByte("()<>[]{}/%", c) >= 0
+}
+
+func (l *pdfLexer) skipSpace() {
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		if c == '%' {
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+			continue
+		}
+		if !isPDFSpace(c) {
+			return
+		}
+		l.pos++
+	}
+}
+
+/* value reads one value: numbers, names, strings, arrays, dictionaries and "n g R" references */
+func (l *pdfLexer) value(depth int) interface{} {
+	token := l.token()
+	switch token {
+	case pdfKeyword("["):
+		items := []interface{}{}
+		for depth < maxPDFDepth && l.pos < len(l.data) {
+			item := l.value(depth + 1)
+			if item == pdfKeyword("]") || item == nil {
+				break
+			}
+			items = append(items, item)
+		}
+		return items
+	case pdfKeyword("<<"):
+		dict := pdfDict{}
+		for depth < maxPDFDepth && l.pos < len(l.data) {
+			key := l.value(depth + 1)
+			name, ok := key.(pdfName)
+			if !ok {
+				break
+			}
+			dict[string(name)] = l.value(depth + 1)
+		}
+		return dict
+	case pdfKeyword("true"):
+		return true
+	case pdfKeyword("false"):
+		return false
+	case pdfKeyword("null"):
+		return nil
+	}
+
+	if num, ok := token.(float64); ok && num == float64(int(num)) {
+		saved := l.pos
+		if gen, ok := l.token().(float64); ok {
+			if l.token() == pdfKeyword("R") {
+				return pdfRef{num: int(num), gen: int(gen)}
+			}
+		}
+		l.pos = saved
+	}
+	return token
+}
+
+func (l *pdfLexer) token() interface{} {
+	l.skipSpace()
+	if l.pos >= len(l.data) {
+		return nil
+	}
+
+	c := l.data[l.pos]
+	switch {
+	case c == '(':
+		return l.literalString()
+	case c == '<':
+		if l.pos+1 < len(l.data) && l.data[l.pos+1] == '<' {
+			l.pos += 2
+			return pdfKeyword("<<")
+		}
+		return l.hexString()
+	case c == '>':
+		if l.pos+1 < len(l.data) && l.data[l.pos+1] == '>' {
+			l.pos += 2
+			return pdfKeyword(">>")
+		}
+		l.pos++
+		return pdfKeyword(">")
+	case c == '[' || c == ']' || c == '{' || c == '}' || c == ')':
+		l.pos++
+		return pdfKeyword(string(c))
+	case c == '/':
+		l.pos++
+		return pdfName(l.name())
+	}
+
+	start := l.pos
+	for l.pos < len(l.data) && !isPDFSpace(l.data[l.pos]) && !isPDFDelimiter(l.data[l.pos]) {
+		l.pos++
+	}
+	word := string(l.data[start:l.pos])
+	if c == '+' || c == '-' || c == '.' || (c >= '0' && c <= '9') {
+		if num, err := strconv.ParseFloat(word, 64); err == nil {
+			return num
+		}
+	}
+	return pdfKeyword(word)
+}
+
+func (l *pdfLexer) name() string {
+	var name strings.Builder
+	for l.pos < len(l.data) && !isPDFSpace(l.data[l.pos]) && !isPDFDelimiter(l.data[l.pos]) {
+		c := l.data[l.pos]
+		if c == '#' && l.pos+2 < len(l.data) {
+			if b, err := strconv.ParseUint(string(l.data[l.pos+1:l.pos+3]), 16, 8); err == nil {
+				name.WriteByte(byte(b))
+				l.pos += 3
+				continue
+			}
+		}
+		name.WriteByte(c)
+		l.pos++
+	}
+	return name.String()
+}
+
+func (l *pdfLexer) literalString() []byte {
+	l.pos++
+	var out []byte
+	depth := 1
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return out
+			}
+		case '\\':
+			if l.pos >= len(l.data) {
+				return out
+			}
+			e := l.data[l.pos]
+			l.pos++
+			switch e {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r':
+				if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+					l.pos++
+				}
+				continue
+			case '\n':
+				continue
+			default:
+				if e >= '0' && e <= '7' {
+					v := int(e - '0')
+					for i := 0; i < 2 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; i++ {
+						v = v*8 + int(l.data[l.pos]-'0')
+						l.pos++
+					}
+					c = byte(v)
+				} else {
+					c = e
+				}
+			}
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+func (l *pdfLexer) hexString() []byte {
+	l.pos++
+	var digits []byte
+	for l.pos < len(l.data) && l.data[l.pos] != '>' {
+		c := l.data[l.pos]
+		if (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F') {
+			digits = append(digits, c)
+		}
+		l.pos++
+	}
+	/* An unterminated string ends at the end of the data, not past it */
+	if l.pos < len(l.data) {
+		l.pos++
+	}
+	if len(digits)%2 != 0 {
+		digits = append(digits, '0')
+	}
+	out := make([]byte, len(digits)/2)
+	for i := range out {
+		b, _ := strconv.ParseUint(string(digits[2*i:2*i+2]), 16, 8)
+		out[i] = byte(b)
+	}
+	return out
+}
+
+/* skipInlineImage jumps past "ID <binary> EI", whose data is not tokenizable */
+func (l *pdfLexer) skipInlineImage() {
+	for l.pos < len(l.data) {
+		i := bytes.Index(l.data[l.pos:], []byte("EI"))
+		if i < 0 {
+			l.pos = len(l.data)
+			return
+		}
+		at := l.pos + i
+		l.pos = at + 2
+		before := at == 0 || isPDFSpace(l.data[at-1])
+		after := l.pos >= len(l.data) || isPDFSpace(l.data[l.pos])
+		if before && after {
+			return
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package ingest
+
+import (
+	"context"
+
+	"backend-v2/internal/database"
+	"backend-v2/internal/middlewares"
+	"backend-v2/internal/modules/llmvector"
+	workflowRepo "backend-v2/internal/repositories/workflow"
+	"backend-v2/internal/services/container"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/qiniu/qmgo"
+)
+
+func Register(router fiber.Router, db *qmgo.Database, services *container.ServiceContainer) {
+	files, err := workflowRepo.NewFileRepository(database.MongoClient.Database(db.GetDatabaseName()))
+	if err != nil {
+		log.Warn("workflow files unavailable, fileId ingestion disabled: %v", err)
+	}
+
+	service := NewService(db, files, services.Embedder, llmvector.NewService(db, services.VectorIndex))
+	controller := NewController(service)
+
+	go service.Run(context.Background())
+
+	router.Post("/vector/ingest", middlewares.ExtractUserID, controller.Ingest)
+	router.Get("/vector/ingest", middlewares.ExtractUserID, controller.List)
+	router.Get("/vector/ingest/:id", middlewares.ExtractUserID, controller.Get)
+	router.Post("/vector/reembed", middlewares.ExtractUserID, controller.Reembed)
+}
@@ -0,0 +1,485 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	nethttp "net/http"
+	"runtime/debug"
+	"time"
+
+	"github.com/qiniu/qmgo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"backend-v2/internal/common/http"
+	"backend-v2/internal/common/logger"
+	"backend-v2/internal/database"
+	"backend-v2/internal/models"
+	"backend-v2/internal/modules/llmvector"
+	workflowRepo "backend-v2/internal/repositories/workflow"
+	"backend-v2/internal/services/llmproxy"
+)
+
+var log = logger.New("INGEST")
+
+const (
+	jobsCollection = "ingestjobs"
+
+	/* workers is how many jobs one instance runs at a time */
+	workers      = 2
+	pollInterval = 15 * time.Second
+	/* Running jobs touch updatedAt after every batch; one silent this long lost its instance and is reclaimed */
+	staleClaimAfter = 5 * time.Minute
+	/* maxAttempts bounds reclaims, so a document that crashes the worker does not loop forever */
+	maxAttempts = 3
+
+	fetchTimeout = time.Minute
+	/* maxDocumentBytes bounds a downloaded file or page */
+	maxDocumentBytes = 20 << 20
+	/* MaxTextBytes bounds raw text sent with the request, which is kept on the job until it runs */
+	MaxTextBytes = 2 << 20
+	/* maxChunks keeps one document from turning into an unbounded embedding bill */
+	maxChunks = 2000
+	/* embedBatch is how many chunks go to the provider per request */
+	embedBatch = 32
+)
+
+var (
+	ErrFileNotFound  = errors.New("file not found")
+	ErrJobNotFound   = errors.New("ingest job not found")
+	ErrTypeNotFound  = errors.New("context type not found")
+	ErrModelRequired = errors.New("name the model to embed with")
+)
+
+/*
+Service queues ingest jobs in Mongo and runs them in the background: fetch the document,
+extract its text, chunk it, embed the chunks with the user's provider and store them as one
+source of a vector context, or embed a type's vectors again with another model. Jobs are
+claimed atomically, so several instances share the queue.
+*/
+type Service struct {
+	jobs     *qmgo.Collection
+	files    workflowRepo.FileRepository
+	client   http.Client
+	embedder llmproxy.Embedder
+	vectors  *llmvector.Service
+	wake     chan struct{}
+}
+
+/* NewService reads workflow files through files, which may be nil when GridFS is unavailable */
+func NewService(db *qmgo.Database, files workflowRepo.FileRepository, embedder llmproxy.Embedder, vectors *llmvector.Service) *Service {
+	return &Service{
+		jobs:     db.Collection(jobsCollection),
+		files:    files,
+		client:   http.NewClientFactory().Create(fetchTimeout),
+		embedder: embedder,
+		vectors:  vectors,
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+/*
+Enqueue stores a pending job. A document job has its file resolved, filling the source and
+content type from it; a reembed job needs the type to exist and a model to name.
+*/
+func (s *Service) Enqueue(ctx context.Context, job *models.IngestJob) error {
+	if job.Provider == "" {
+		job.Provider = job.Type
+	}
+	if job.Kind == models.IngestKindReembed {
+		if err := s.checkReembed(ctx, job); err != nil {
+			return err
+		}
+	} else if err := s.resolveDocument(ctx, job); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	job.ID = primitive.NewObjectID()
+	job.Status = models.IngestJobPending
+	job.CreatedAt = now
+	job.UpdatedAt = now
+	if _, err := s.jobs.InsertOne(ctx, job); err != nil {
+		return err
+	}
+	s.Wake()
+	return nil
+}
+
+func (s *Service) resolveDocument(ctx context.Context, job *models.IngestJob) error {
+	job.Kind = models.IngestKindDocument
+	if job.FileID != "" {
+		file, err := s.file(ctx, job.UserID, job.FileID)
+		if err != nil {
+			return err
+		}
+		if job.Source == "" {
+			job.Source = file.Filename
+		}
+		if job.ContentType == "" {
+			job.ContentType, _ = file.Metadata.Lookup("contentType").StringValueOK()
+		}
+	}
+	if job.Source == "" {
+		job.Source = job.URL
+	}
+	if job.Source == "" {
+		job.Source = "text"
+	}
+	return nil
+}
+
+func (s *Service) checkReembed(ctx context.Context, job *models.IngestJob) error {
+	/* The model is fixed now, so the job and the vectors it writes name the same one */
+	if job.Model = s.embedder.Model(job.Provider, job.Model); job.Model == "" {
+		return ErrModelRequired
+	}
+	_, err := s.vectors.Embeddings(ctx, job.ContextName, job.UserID, job.Type)
+	if errors.Is(err, qmgo.ErrNoSuchDocuments) {
+		return ErrTypeNotFound
+	}
+	return err
+}
+
+/* Get returns one of the user's jobs */
+func (s *Service) Get(ctx context.Context, userID, id string) (*models.IngestJob, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrJobNotFound
+	}
+	var job models.IngestJob
+	err = s.jobs.Find(ctx, bson.M{"_id": objectID, "userId": userID}).One(&job)
+	if errors.Is(err, qmgo.ErrNoSuchDocuments) {
+		return nil, ErrJobNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+/* List returns the user's most recent jobs */
+func (s *Service) List(ctx context.Context, userID string, limit int64) ([]models.IngestJob, error) {
+	jobs := []models.IngestJob{}
+	err := s.jobs.Find(ctx, bson.M{"userId": userID}).Sort("-createdAt").Limit(limit).All(&jobs)
+	return jobs, err
+}
+
+/* Wake asks the workers to pick up new jobs without waiting for the next tick */
+func (s *Service) Wake() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+/* Run processes jobs until ctx is cancelled */
+func (s *Service) Run(ctx context.Context) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	slots := make(chan struct{}, workers)
+	for {
+		s.drain(ctx, slots)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-s.wake:
+		}
+	}
+}
+
+/* drain starts claimed jobs while a worker slot is free */
+func (s *Service) drain(ctx context.Context, slots chan struct{}) {
+	for ctx.Err() == nil {
+		select {
+		case slots <- struct{}{}:
+		default:
+			return
+		}
+
+		job, err := s.claimNext(ctx)
+		if err != nil {
+			<-slots
+			if !errors.Is(err, qmgo.ErrNoSuchDocuments) {
+				log.Error("claim job: %v", err)
+			}
+			return
+		}
+
+		go func() {
+			defer func() {
+				<-slots
+				/* A freed slot may let a queued job start */
+				s.Wake()
+			}()
+			s.run(ctx, job)
+		}()
+	}
+}
+
+/* claimNext atomically moves one pending or abandoned job to running */
+func (s *Service) claimNext(ctx context.Context) (*models.IngestJob, error) {
+	now := time.Now()
+	filter := bson.M{
+		"$or": []bson.M{
+			{"status": models.IngestJobPending},
+			{"status": models.IngestJobRunning, "updatedAt": bson.M{"$lt": now.Add(-staleClaimAfter)}},
+		},
+	}
+	change := qmgo.Change{
+		Update: bson.M{
+			"$set": bson.M{"status": models.IngestJobRunning, "updatedAt": now},
+			"$inc": bson.M{"attempts": 1},
+		},
+		ReturnNew: true,
+	}
+
+	var job models.IngestJob
+	if err := s.jobs.Find(ctx, filter).Sort("createdAt").Apply(change, &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (s *Service) run(ctx context.Context, job *models.IngestJob) {
+	if job.Attempts > maxAttempts {
+		s.finish(ctx, job, fmt.Errorf("gave up after %d interrupted attempts", maxAttempts))
+		return
+	}
+
+	err := s.attempt(ctx, job)
+	switch {
+	case err != nil:
+		log.Warn("job %s of user %s failed: %v", job.ID.Hex(), job.UserID, err)
+	case job.Kind == models.IngestKindReembed:
+		log.Info("job %s of user %s embedded %d vectors of type %q with %s", job.ID.Hex(), job.UserID, job.Embedded, job.Type, job.Model)
+	default:
+		log.Info("job %s of user %s stored %d vectors in source %q", job.ID.Hex(), job.UserID, job.Chunks, job.Source)
+	}
+	s.finish(ctx, job, err)
+}
+
+/*
+attempt runs the job's work. A panic fails the job instead of taking the server down;
+left to crash, the job would be claimed again and crash it on every attempt.
+*/
+func (s *Service) attempt(ctx context.Context, job *models.IngestJob) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Error("job %s panicked: %v\n%s", job.ID.Hex(), r, debug.Stack())
+			err = errors.New("internal error while processing the document")
+		}
+	}()
+	if job.Kind == models.IngestKindReembed {
+		return s.reembed(ctx, job)
+	}
+	return s.process(ctx, job)
+}
+
+func (s *Service) process(ctx context.Context, job *models.IngestJob) error {
+	s.progress(ctx, job, bson.M{"stage": models.IngestStageFetching})
+	data, contentType, filename, err := s.fetch(ctx, job)
+	if err != nil {
+		return err
+	}
+
+	s.progress(ctx, job, bson.M{"stage": models.IngestStageExtracting})
+	kind, err := DetectKind(contentType, filename, data)
+	if err != nil {
+		return err
+	}
+	text, err := Extract(kind, data)
+	if err != nil {
+		return err
+	}
+
+	size, overlap := s.chunking(ctx, job)
+	chunks := Chunk(text, size, overlap)
+	if len(chunks) == 0 {
+		return fmt.Errorf("document has no text")
+	}
+	if len(chunks) > maxChunks {
+		return fmt.Errorf("document makes %d chunks, more than the %d allowed; raise chunkSize or split it", len(chunks), maxChunks)
+	}
+
+	job.Chunks = len(chunks)
+	s.progress(ctx, job, bson.M{"stage": models.IngestStageEmbedding, "chunks": job.Chunks, "embedded": 0})
+
+	model := s.embedder.Model(job.Provider, job.Model)
+	vectors := make([]models.MemoryVector, 0, len(chunks))
+	for start := 0; start < len(chunks); start += embedBatch {
+		batch := chunks[start:min(start+embedBatch, len(chunks))]
+		embeddings, err := s.embedder.EmbedBatch(ctx, job.UserID, job.Provider, job.Model, batch)
+		if err != nil {
+			return err
+		}
+		for i, content := range batch {
+			vectors = append(vectors, models.MemoryVector{
+				Content:   content,
+				Embedding: embeddings[i],
+				Model:     model,
+				Metadata:  vectorMetadata(job, kind, start+i),
+			})
+		}
+		job.Embedded = len(vectors)
+		s.progress(ctx, job, bson.M{"embedded": job.Embedded})
+	}
+
+	s.progress(ctx, job, bson.M{"stage": models.IngestStageSaving})
+	store := map[string][]models.MemoryVector{job.Source: vectors}
+	if job.Keep {
+		_, err = s.vectors.SaveContext(ctx, job.ContextName, job.UserID, job.Type, store, true)
+		return err
+	}
+	return s.vectors.ReplaceSources(ctx, job.ContextName, job.UserID, job.Type, store)
+}
+
+/* reembed embeds the vectors of the job's type again with its model, in place */
+func (s *Service) reembed(ctx context.Context, job *models.IngestJob) error {
+	s.progress(ctx, job, bson.M{"stage": models.IngestStageEmbedding, "embedded": 0})
+	embed := func(ctx context.Context, texts []string) ([][]float64, error) {
+		return s.embedder.EmbedBatch(ctx, job.UserID, job.Provider, job.Model, texts)
+	}
+	progress := func(done, total int) {
+		job.Chunks, job.Embedded = total, done
+		s.progress(ctx, job, bson.M{"chunks": total, "embedded": done})
+	}
+	_, err := s.vectors.Reembed(ctx, job.ContextName, job.UserID, job.Type, job.Model, embed, progress)
+	return err
+}
+
+/* fetch returns the document with what is known of its type and name */
+func (s *Service) fetch(ctx context.Context, job *models.IngestJob) ([]byte, string, string, error) {
+	switch {
+	case job.FileID != "":
+		file, err := s.file(ctx, job.UserID, job.FileID)
+		if err != nil {
+			return nil, "", "", err
+		}
+		stream, err := file.OpenDownloadStream(ctx)
+		if err != nil {
+			return nil, "", "", err
+		}
+		if closer, ok := stream.(io.Closer); ok {
+			defer closer.Close()
+		}
+		data, err := readLimited(stream)
+		return data, job.ContentType, file.Filename, err
+
+	case job.URL != "":
+		req, err := nethttp.NewRequestWithContext(ctx, nethttp.MethodGet, job.URL, nil)
+		if err != nil {
+			return nil, "", "", err
+		}
+		req.Header.Set("User-Agent", "D5-Ingest/1.0")
+		resp, err := s.client.Do(req)
+		if err != nil {
+			return nil, "", "", fmt.Errorf("fetch %s: %w", job.URL, err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return nil, "", "", fmt.Errorf("fetch %s: status %d", job.URL, resp.StatusCode)
+		}
+		contentType := job.ContentType
+		if contentType == "" {
+			contentType = resp.Header.Get("Content-Type")
+		}
+		data, err := readLimited(resp.Body)
+		return data, contentType, resp.Request.URL.Path, err
+	}
+
+	contentType := job.ContentType
+	if contentType == "" {
+		contentType = "text/plain"
+	}
+	return []byte(job.Text), contentType, "", nil
+}
+
+/* file loads a workflow file the user uploaded */
+func (s *Service) file(ctx context.Context, userID, fileID string) (*database.GridFSFile, error) {
+	id, err := primitive.ObjectIDFromHex(fileID)
+	if err != nil || s.files == nil {
+		return nil, ErrFileNotFound
+	}
+	file, err := s.files.FindByID(ctx, id)
+	if err != nil {
+		return nil, ErrFileNotFound
+	}
+	if owner, _ := file.Metadata.Lookup("userId").StringValueOK(); owner != userID {
+		return nil, ErrFileNotFound
+	}
+	return file, nil
+}
+
+/* chunking picks the job's chunk size, else the integration's, else the default; overlap defaults to a tenth and never passes half */
+func (s *Service) chunking(ctx context.Context, job *models.IngestJob) (int, int) {
+	size := job.ChunkSize
+	if size == 0 {
+		size = s.embedder.ChunkSize(ctx, job.UserID, job.Provider)
+	}
+	if size == 0 {
+		size = defaultChunkSize
+	}
+	size = max(minChunkSize, min(size, maxChunkSize))
+
+	overlap := job.ChunkOverlap
+	if overlap == 0 {
+		overlap = size / 10
+	}
+	return size, min(overlap, size/2)
+}
+
+/* progress records job fields and doubles as the heartbeat that keeps the claim */
+func (s *Service) progress(ctx context.Context, job *models.IngestJob, fields bson.M) {
+	fields["updatedAt"] = time.Now()
+	if err := s.jobs.UpdateOne(ctx, bson.M{"_id": job.ID}, bson.M{"$set": fields}); err != nil {
+		log.Warn("record progress of job %s: %v", job.ID.Hex(), err)
+	}
+}
+
+func (s *Service) finish(ctx context.Context, job *models.IngestJob, err error) {
+	now := time.Now()
+	set := bson.M{"status": models.IngestJobSucceeded, "stage": "", "updatedAt": now, "finishedAt": now}
+	if err != nil {
+		set["status"] = models.IngestJobFailed
+		set["error"] = err.Error()
+	}
+	update := bson.M{"$set": set, "$unset": bson.M{"text": ""}}
+	if updateErr := s.jobs.UpdateOne(ctx, bson.M{"_id": job.ID}, update); updateErr != nil {
+		log.Error("finish job %s: %v", job.ID.Hex(), updateErr)
+	}
+}
+
+func readLimited(r io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxDocumentBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxDocumentBytes {
+		return nil, fmt.Errorf("document is larger than %d MB", maxDocumentBytes>>20)
+	}
+	return data, nil
+}
+
+/* vectorMetadata says where a vector came from, so search results can point back to the document */
+func vectorMetadata(job *models.IngestJob, kind Kind, chunk int) map[string]interface{} {
+	metadata := map[string]interface{}{
+		"source": job.Source,
+		"format": string(kind),
+		"chunk":  chunk,
+		"chunks": job.Chunks,
+		"jobId":  job.ID.Hex(),
+	}
+	if job.FileID != "" {
+		metadata["fileId"] = job.FileID
+	}
+	if job.URL != "" {
+		metadata["url"] = job.URL
+	}
+	return metadata
+}
@@ -5,6 +5,7 @@ import (
 	"backend-v2/internal/common/logger"
 	"backend-v2/internal/common/response"
 	"backend-v2/internal/models"
+	"backend-v2/internal/services/llmproxy"
 	"encoding/json"
 
 	"github.com/gofiber/fiber/v2"
@@ -15,11 +16,10 @@ var log = logger.New("INTEGRATION")
 
 type Controller struct {
 	service *Service
-	db      *qmgo.Database
 }
 
-func NewController(service *Service, db *qmgo.Database) *Controller {
-	return &Controller{service: service, db: db}
+func NewController(service *Service) *Controller {
+	return &Controller{service: service}
 }
 
 func (ctrl *Controller) Authorization(c *fiber.Ctx) error {
@@ -57,7 +57,7 @@ func (ctrl *Controller) GetAll(c *fiber.Ctx) error {
 		return response.InternalError(c, err.Error())
 	}
 
-	return c.JSON(integration)
+	return c.JSON(maskIntegration(integration))
 }
 
 func (ctrl *Controller) GetService(c *fiber.Ctx) error {
@@ -69,7 +69,7 @@ func (ctrl *Controller) GetService(c *fiber.Ctx) error {
 		return err
 	}
 
-	integrationBytes, _ := json.Marshal(integration)
+	integrationBytes, _ := json.Marshal(maskIntegration(integration))
 	var integrationMap map[string]interface{}
 	if err := json.Unmarshal(integrationBytes, &integrationMap); err != nil {
 		return response.InternalError(c, "failed to parse integration")
@@ -89,7 +89,12 @@ func (ctrl *Controller) UpdateService(c *fiber.Ctx) error {
 		return response.BadRequest(c, "Something is wrong with the provided data")
 	}
 
-	vectors, err := ctrl.service.CreateLLMVector(c.Context(), ctrl.db, userID, service)
+	/* Clients round-trip the masked document; a masked key means "keep the stored one" */
+	if err := ctrl.service.KeepMaskedKey(c.Context(), userID, service, serviceConfig); err != nil {
+		return response.BadRequest(c, "API key is masked and no stored key exists; provide the full key")
+	}
+
+	vectors, err := ctrl.service.CreateLLMVector(c.Context(), userID, service)
 	if err != nil {
 		return response.InternalError(c, err.Error())
 	}
@@ -99,7 +104,36 @@ func (ctrl *Controller) UpdateService(c *fiber.Ctx) error {
 		return response.InternalError(c, err.Error())
 	}
 
-	return c.JSON(fiber.Map{"vectors": vectors})
+	/* The key is saved either way; the recorded health tells the client whether it works */
+	integration, err := ctrl.service.FindByUserID(c.Context(), userID)
+	if err != nil {
+		return response.InternalError(c, err.Error())
+	}
+	health, err := ctrl.service.CheckHealth(c.Context(), integration, service)
+	if err != nil {
+		log.Warn("UpdateService: recording %s health for user %s: %v", service, userID, err)
+	}
+
+	return c.JSON(fiber.Map{"vectors": vectors, "health": health})
+}
+
+/* RevealKey returns the full stored API key of one service to its owner */
+func (ctrl *Controller) RevealKey(c *fiber.Ctx) error {
+	userID := ctrl.getUserID(c)
+	service := c.Params("service")
+
+	if !isValidService(service) {
+		return response.BadRequest(c, "Invalid service name")
+	}
+
+	key, err := ctrl.service.APIKey(c.Context(), userID, service)
+	if err != nil || key == "" {
+		return response.NotFound(c, "API key not configured")
+	}
+
+	log.Info("RevealKey: user %s revealed %s key", userID, service)
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.JSON(fiber.Map{"apiKey": key})
 }
 
 func (ctrl *Controller) Delete(c *fiber.Ctx) error {
@@ -118,20 +152,12 @@ func (ctrl *Controller) DeleteService(c *fiber.Ctx) error {
 	service := c.Params("service")
 
 	/* Validate service name */
-	validServices := []string{"openai", "deepseek", "qwen", "claude", "perplexity", "yandex", "custom_llm"}
-	isValid := false
-	for _, s := range validServices {
-		if s == service {
-			isValid = true
-			break
-		}
-	}
-	if !isValid {
+	if !isValidService(service) {
 		return response.BadRequest(c, "Invalid service name")
 	}
 
 	/* Remove service field entirely from integration document using $unset */
-	unset := map[string]interface{}{service: ""}
+	unset := map[string]interface{}{service: "", "health." + service: ""}
 	update := map[string]interface{}{"$unset": unset}
 
 	if err := ctrl.service.UpdateRaw(c.Context(), userID, update); err != nil {
@@ -161,6 +187,34 @@ func (ctrl *Controller) SetModel(c *fiber.Ctx) error {
 	return ctrl.updatePreference(c, "model", "Model not specified")
 }
 
+/* SetFallbacks stores the providers the LLM proxy tries, in order, when the requested one fails */
+func (ctrl *Controller) SetFallbacks(c *fiber.Ctx) error {
+	userID := ctrl.getUserID(c)
+
+	var body struct {
+		Fallbacks []string `json:"fallbacks"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return response.BadRequest(c, "Invalid request body")
+	}
+
+	fallbacks := make([]string, 0, len(body.Fallbacks))
+	for _, spec := range body.Fallbacks {
+		target, err := llmproxy.ParseTarget(spec)
+		if err != nil {
+			return response.BadRequest(c, err.Error())
+		}
+		fallbacks = append(fallbacks, target.String())
+	}
+
+	update := map[string]interface{}{"fallbacks": fallbacks}
+	if err := ctrl.service.Upsert(c.Context(), userID, update); err != nil {
+		return response.InternalError(c, err.Error())
+	}
+
+	return c.JSON(fiber.Map{"fallbacks": fallbacks})
+}
+
 func (ctrl *Controller) updatePreference(c *fiber.Ctx, fieldName, errorMsg string) error {
 	userID := ctrl.getUserID(c)
 
@@ -0,0 +1,50 @@
+package integration
+
+import (
+	"context"
+	"sync/atomic"
+
+	"backend-v2/internal/common/constants"
+	"backend-v2/internal/common/response"
+	"backend-v2/internal/common/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+/* HealthController runs credential re-checks across all users */
+type HealthController struct {
+	service *Service
+	running atomic.Bool
+}
+
+func NewHealthController(service *Service) *HealthController {
+	return &HealthController{service: service}
+}
+
+/* Authorization - admin only, a re-check touches every user's integration */
+func (ctrl *HealthController) Authorization(c *fiber.Ctx) error {
+	roles, ok := c.Locals("roles").([]string)
+	if !ok || !utils.Contains(roles, string(constants.Administrator)) {
+		return response.Forbidden(c, "This endpoint is only available for administrators.")
+	}
+	return c.Next()
+}
+
+/* POST /integration/health/recheck - re-verify every stored LLM credential in the background */
+func (ctrl *HealthController) RecheckAll(c *fiber.Ctx) error {
+	if !ctrl.running.CompareAndSwap(false, true) {
+		return response.Conflict(c, "A re-check is already running")
+	}
+
+	go func() {
+		defer ctrl.running.Store(false)
+
+		counts, err := ctrl.service.RecheckAll(context.Background())
+		if err != nil {
+			log.Error("RecheckAll: %v", err)
+		}
+		log.Info("RecheckAll finished: %v", counts)
+	}()
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{"status": "started"})
+}
@@ -10,3 +10,15 @@ func parseBody(c *fiber.Ctx, v interface{}) error {
 	}
 	return nil
 }
+
+/* validServices lists the integration services that hold an API key */
+var validServices = []string{"openai", "deepseek", "qwen", "claude", "perplexity", "yandex", "custom_llm", "local"}
+
+func isValidService(service string) bool {
+	for _, s := range validServices {
+		if s == service {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+package integration
+
+import (
+	"backend-v2/internal/models"
+	"backend-v2/internal/providers/apikey"
+)
+
+/* maskIntegration returns a copy of the integration with every API key masked for client responses */
+func maskIntegration(src *models.Integration) *models.Integration {
+	masked := *src
+
+	if src.OpenAI != nil {
+		config := *src.OpenAI
+		config.APIKey = apikey.Mask(config.APIKey)
+		masked.OpenAI = &config
+	}
+	if src.Yandex != nil {
+		config := *src.Yandex
+		config.APIKey = apikey.Mask(config.APIKey)
+		masked.Yandex = &config
+	}
+	if src.Claude != nil {
+		config := *src.Claude
+		config.APIKey = apikey.Mask(config.APIKey)
+		masked.Claude = &config
+	}
+	if src.Perplexity != nil {
+		config := *src.Perplexity
+		config.APIKey = apikey.Mask(config.APIKey)
+		masked.Perplexity = &config
+	}
+	if src.Qwen != nil {
+		config := *src.Qwen
+		config.APIKey = apikey.Mask(config.APIKey)
+		masked.Qwen = &config
+	}
+	if src.Deepseek != nil {
+		config := *src.Deepseek
+		config.APIKey = apikey.Mask(config.APIKey)
+		masked.Deepseek = &config
+	}
+	if src.CustomLLM != nil {
+		config := *src.CustomLLM
+		config.APIKey = apikey.Mask(config.APIKey)
+		masked.CustomLLM = &config
+	}
+	if src.Local != nil {
+		config := *src.Local
+		config.APIKey = apikey.Mask(config.APIKey)
+		masked.Local = &config
+	}
+
+	return &masked
+}
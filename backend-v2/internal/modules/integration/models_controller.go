@@ -0,0 +1,61 @@
+package integration
+
+import (
+	"backend-v2/internal/common/response"
+	"backend-v2/internal/services/llmcatalog"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+/* ModelsController serves the LLM models catalog so clients need not hard-code model lists */
+type ModelsController struct {
+	catalog *llmcatalog.Catalog
+}
+
+func NewModelsController(catalog *llmcatalog.Catalog) *ModelsController {
+	return &ModelsController{catalog: catalog}
+}
+
+/* catalogProvider is the client view of a provider; endpoints and headers stay server-side */
+type catalogProvider struct {
+	ID           string             `json:"id"`
+	Name         string             `json:"name"`
+	DefaultModel string             `json:"defaultModel,omitempty"`
+	Models       []llmcatalog.Model `json:"models"`
+}
+
+/* List returns providers with their models, optionally filtered by ?provider= and ?type=chat|embedding */
+func (ctrl *ModelsController) List(c *fiber.Ctx) error {
+	providerFilter := c.Query("provider")
+	typeFilter := c.Query("type")
+	if typeFilter != "" && typeFilter != llmcatalog.TypeChat && typeFilter != llmcatalog.TypeEmbedding {
+		return response.BadRequest(c, "type must be chat or embedding")
+	}
+
+	providers := []catalogProvider{}
+	for _, id := range ctrl.catalog.IDs() {
+		if providerFilter != "" && providerFilter != id {
+			continue
+		}
+		provider, _ := ctrl.catalog.Provider(id)
+
+		models := []llmcatalog.Model{}
+		for _, model := range provider.Models {
+			if typeFilter == "" || model.Type == typeFilter {
+				models = append(models, model)
+			}
+		}
+		if len(models) == 0 && typeFilter != "" {
+			continue
+		}
+
+		providers = append(providers, catalogProvider{
+			ID:           id,
+			Name:         provider.Name,
+			DefaultModel: provider.DefaultModel,
+			Models:       models,
+		})
+	}
+
+	return c.JSON(fiber.Map{"providers": providers})
+}
@@ -3,21 +3,24 @@ package integration
 import (
 	"backend-v2/internal/middlewares"
 	"backend-v2/internal/services/container"
+	"backend-v2/internal/services/llmproxy"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/qiniu/qmgo"
 )
 
 func Register(router fiber.Router, db *qmgo.Database, services *container.ServiceContainer) {
-	service := NewService(db)
+	service := NewService(db, services.IntegrationSecrets, services.KeyChecker)
 
 	/* Core integration CRUD controller */
-	baseCtrl := NewController(service, db)
+	baseCtrl := NewController(service)
 
 	/* Service-specific controllers (non-LLM only) */
 	midjourneyCtrl := NewMidjourneyController(services.Midjourney)
 	zoomCtrl := NewZoomController(services.Zoom)
 	freepikCtrl := NewFreepikController(services.Freepik)
+	modelsCtrl := NewModelsController(services.Catalog)
+	healthCtrl := NewHealthController(service)
 
 	integrationGroup := router.Group("/integration")
 
@@ -30,18 +33,26 @@ func Register(router fiber.Router, db *qmgo.Database, services *container.Servic
 	protectedGroup.Get("/languages", baseCtrl.GetLanguages)
 	protectedGroup.Post("/language", baseCtrl.SetLanguage)
 	protectedGroup.Post("/model", baseCtrl.SetModel)
+	protectedGroup.Post("/fallbacks", baseCtrl.SetFallbacks)
+	protectedGroup.Get("/models", modelsCtrl.List)
+	protectedGroup.Post("/health/recheck", healthCtrl.Authorization, healthCtrl.RecheckAll)
 
 	/* LLM proxy endpoints for API key validation (NOT for production LLM execution) */
 	/* Purpose: Validate user API keys when installing integrations */
 	/* Production LLM execution handled by Node.js backend at /api/v1/integration/* */
-	protectedGroup.Post("/chat/completions", services.LLMProxy.ChatCompletions)
-	protectedGroup.Post("/embeddings", services.LLMProxy.Embeddings)
-	protectedGroup.Post("/perplexity/chat/completions", services.LLMProxy.PerplexityChatCompletions)
-	protectedGroup.Post("/claude/messages", services.LLMProxy.ClaudeMessages)
-	protectedGroup.Post("/yandex/completion", services.LLMProxy.YandexCompletion)
-	protectedGroup.Post("/deepseek/chat/completions", services.LLMProxy.DeepSeekChatCompletions)
-	protectedGroup.Post("/custom_llm/chat/completions", services.LLMProxy.CustomLLMChatCompletions)
-	protectedGroup.Post("/custom_llm/embeddings", services.LLMProxy.CustomLLMEmbeddings)
+	/* KeyValidation lets them forward the key being installed, even when LLM_PROXY_KEY_MODE=server */
+	protectedGroup.Post("/chat/completions", llmproxy.KeyValidation("openai"), services.LLMProxy.ChatCompletions)
+	protectedGroup.Post("/embeddings", llmproxy.KeyValidation("openai-embeddings"), services.LLMProxy.Embeddings)
+	protectedGroup.Post("/perplexity/chat/completions", llmproxy.KeyValidation("perplexity"), services.LLMProxy.PerplexityChatCompletions)
+	protectedGroup.Post("/claude/messages", llmproxy.KeyValidation("claude"), services.LLMProxy.ClaudeMessages)
+	protectedGroup.Post("/yandex/completion", llmproxy.KeyValidation("yandex"), services.LLMProxy.YandexCompletion)
+	protectedGroup.Post("/deepseek/chat/completions", llmproxy.KeyValidation("deepseek"), services.LLMProxy.DeepSeekChatCompletions)
+	protectedGroup.Post("/qwen/chat/completions", llmproxy.KeyValidation("qwen"), services.LLMProxy.QwenChatCompletions)
+	protectedGroup.Post("/custom_llm/chat/completions", llmproxy.KeyValidation("custom_llm"), services.LLMProxy.CustomLLMChatCompletions)
+	protectedGroup.Post("/custom_llm/embeddings", llmproxy.KeyValidation("custom_llm-embeddings"), services.LLMProxy.CustomLLMEmbeddings)
+	protectedGroup.Post("/local/chat/completions", llmproxy.KeyValidation("local"), services.LLMProxy.LocalChatCompletions)
+	protectedGroup.Post("/local/embeddings", llmproxy.KeyValidation("local-embeddings"), services.LLMProxy.LocalEmbeddings)
+	protectedGroup.Get("/local/models", llmproxy.KeyValidation("local"), services.LLMProxy.LocalModels)
 
 	/* Midjourney endpoints */
 	protectedGroup.Post("/midjourney/create", midjourneyCtrl.Create)
@@ -58,5 +69,6 @@ func Register(router fiber.Router, db *qmgo.Database, services *container.Servic
 	/* Parameterized routes LAST - catches remaining requests */
 	protectedGroup.Get("/:service", baseCtrl.GetService)
 	protectedGroup.Put("/:service/update", baseCtrl.UpdateService)
+	protectedGroup.Post("/:service/reveal", baseCtrl.RevealKey)
 	protectedGroup.Delete("/:service/delete", baseCtrl.DeleteService)
 }
@@ -2,35 +2,129 @@ package integration
 
 import (
 	"backend-v2/internal/models"
+	"backend-v2/internal/modules/llmvector"
+	"backend-v2/internal/providers/apikey"
+	integrationRepo "backend-v2/internal/repositories/integration"
+	"backend-v2/internal/services/llmproxy"
 	"context"
+	"sync"
 
 	"github.com/qiniu/qmgo"
 	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 const (
 	defaultLanguage = "none"
 	defaultModel    = "auto"
+
+	/* recheckWorkers bounds concurrent upstream calls of a full re-check */
+	recheckWorkers = 8
 )
 
 type Service struct {
 	collection *qmgo.Collection
+	repo       integrationRepo.Repository
+	secrets    *integrationRepo.Secrets
+	keys       apikey.Provider
+	checker    llmproxy.KeyChecker
+	vectors    *llmvector.Service
 }
 
-func NewService(db *qmgo.Database) *Service {
+func NewService(db *qmgo.Database, secrets *integrationRepo.Secrets, checker llmproxy.KeyChecker) *Service {
+	repo := integrationRepo.NewMongoRepository(db, secrets)
 	return &Service{
 		collection: db.Collection("integrations"),
+		repo:       repo,
+		secrets:    secrets,
+		keys:       apikey.NewIntegrationProvider(repo),
+		checker:    checker,
+		vectors:    llmvector.NewService(db, nil),
 	}
 }
 
+/* FindByUserID returns the user's integration with API keys decrypted */
 func (s *Service) FindByUserID(ctx context.Context, userID string) (*models.Integration, error) {
-	var integration models.Integration
-	err := s.collection.Find(ctx, qmgo.M{"userId": userID}).One(&integration)
+	return s.repo.FindByUserID(ctx, userID)
+}
+
+/* APIKey returns the decrypted stored key of one service */
+func (s *Service) APIKey(ctx context.Context, userID, service string) (string, error) {
+	return s.keys.GetAPIKey(ctx, userID, service)
+}
+
+/* KeepMaskedKey swaps a masked apiKey echoed back by the client for the stored key, leaving it unchanged */
+func (s *Service) KeepMaskedKey(ctx context.Context, userID, service string, serviceConfig map[string]interface{}) error {
+	key, _ := serviceConfig["apiKey"].(string)
+	if !apikey.IsMasked(key) {
+		return nil
+	}
+
+	stored, err := s.APIKey(ctx, userID, service)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	return &integration, nil
+	serviceConfig["apiKey"] = stored
+	return nil
+}
+
+/*
+CheckHealth verifies the stored credentials of one service and records the outcome under health.<service>.
+It returns nil when the service has no credentials to check.
+*/
+func (s *Service) CheckHealth(ctx context.Context, integration *models.Integration, service string) (*models.IntegrationHealth, error) {
+	credentials, ok := llmproxy.CredentialsFor(integration, service)
+	if !ok {
+		return nil, nil
+	}
+
+	health := s.checker.Check(ctx, service, credentials)
+	err := s.collection.UpdateOne(ctx, qmgo.M{"userId": integration.UserID}, bson.M{"$set": bson.M{"health." + service: health}})
+	return &health, err
+}
+
+/* RecheckAll re-verifies every configured LLM service of every integration and counts the outcomes by status */
+func (s *Service) RecheckAll(ctx context.Context) (map[string]int, error) {
+	var (
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+		counts = map[string]int{}
+		slots  = make(chan struct{}, recheckWorkers)
+	)
+
+	cursor := s.collection.Find(ctx, bson.M{}).Cursor()
+	defer cursor.Close()
+
+	for {
+		var integration models.Integration
+		if !cursor.Next(&integration) {
+			break
+		}
+		if err := s.secrets.Open(&integration); err != nil {
+			log.Warn("RecheckAll: skipping integration of user %s: %v", integration.UserID, err)
+			continue
+		}
+
+		for _, service := range llmproxy.CheckableServices {
+			slots <- struct{}{}
+			wg.Add(1)
+			go func(integration *models.Integration, service string) {
+				defer func() { <-slots; wg.Done() }()
+
+				health, err := s.CheckHealth(ctx, integration, service)
+				if err != nil {
+					log.Warn("RecheckAll: recording %s health of user %s: %v", service, integration.UserID, err)
+				}
+				if health != nil {
+					mu.Lock()
+					counts[health.Status]++
+					mu.Unlock()
+				}
+			}(&integration, service)
+		}
+	}
+
+	wg.Wait()
+	return counts, cursor.Err()
 }
 
 func (s *Service) Upsert(ctx context.Context, userID string, update map[string]interface{}) error {
@@ -42,12 +136,14 @@ func (s *Service) Upsert(ctx context.Context, userID string, update map[string]i
 	}
 
 	filter := qmgo.M{"userId": userID}
-	updateOp := bson.M{"$set": updateDoc}
 
 	var existing models.Integration
 	err := s.collection.Find(ctx, filter).One(&existing)
 
 	if err == qmgo.ErrNoSuchDocuments {
+		if err := s.secrets.SealUpdate(nil, updateDoc); err != nil {
+			return err
+		}
 		_, insertErr := s.collection.InsertOne(ctx, updateDoc)
 		return insertErr
 	}
@@ -56,7 +152,15 @@ func (s *Service) Upsert(ctx context.Context, userID string, update map[string]i
 		return err
 	}
 
-	return s.collection.UpdateOne(ctx, filter, updateOp)
+	/* API keys are encrypted with the document's data key before they reach Mongo */
+	if err := s.secrets.EnsureDataKey(ctx, s.collection, &existing); err != nil {
+		return err
+	}
+	if err := s.secrets.SealUpdate(&existing, updateDoc); err != nil {
+		return err
+	}
+
+	return s.collection.UpdateOne(ctx, filter, bson.M{"$set": updateDoc})
 }
 
 func (s *Service) setDefaultFields(fields map[string]interface{}, userID string) {
@@ -105,83 +209,7 @@ func (s *Service) UpdateRaw(ctx context.Context, userID string, update map[strin
 	return nil
 }
 
-func (s *Service) CreateLLMVector(ctx context.Context, db *qmgo.Database, userID string, service string) (*models.LLMVector, error) {
-	vectorsCollection := db.Collection("llmvectors")
-
-	vector, err := s.findOrCreateDefaultVector(ctx, vectorsCollection, userID)
-	if err != nil {
-		return nil, err
-	}
-
-	if err := s.ensureServiceStoreExists(ctx, vectorsCollection, vector, service, userID); err != nil {
-		return nil, err
-	}
-
-	return vector, nil
-}
-
-func (s *Service) findOrCreateDefaultVector(ctx context.Context, collection *qmgo.Collection, userID string) (*models.LLMVector, error) {
-	var vector models.LLMVector
-	err := collection.Find(ctx, qmgo.M{"userId": userID, "name": nil}).One(&vector)
-
-	if err == qmgo.ErrNoSuchDocuments {
-		return s.createDefaultVector(ctx, collection, userID)
-	}
-
-	return &vector, err
-}
-
-func (s *Service) createDefaultVector(ctx context.Context, collection *qmgo.Collection, userID string) (*models.LLMVector, error) {
-	vector := models.LLMVector{
-		UserID: userID,
-		Name:   nil,
-		Store:  make(map[string]map[string][]models.MemoryVector),
-	}
-
-	result, err := collection.InsertOne(ctx, vector)
-	if err != nil {
-		return nil, err
-	}
-
-	vector.ID = result.InsertedID.(primitive.ObjectID)
-	return &vector, nil
-}
-
-func (s *Service) ensureServiceStoreExists(ctx context.Context, collection *qmgo.Collection, vector *models.LLMVector, service, userID string) error {
-	if vector.Store == nil {
-		vector.Store = make(map[string]map[string][]models.MemoryVector)
-	}
-
-	if _, exists := vector.Store[service]; exists {
-		return nil
-	}
-
-	vector.Store[service] = make(map[string][]models.MemoryVector)
-
-	/* Use Find+Insert/Update pattern (same as Upsert method) for consistency and edge case safety */
-	filter := qmgo.M{"userId": userID, "name": nil}
-	updateOp := bson.M{"$set": bson.M{"store." + service: make(map[string][]models.MemoryVector)}}
-
-	var existing models.LLMVector
-	err := collection.Find(ctx, filter).One(&existing)
-
-	if err == qmgo.ErrNoSuchDocuments {
-		/* Document doesn't exist - insert new llmvectors doc with service store */
-		newVector := models.LLMVector{
-			UserID: userID,
-			Name:   nil,
-			Store: map[string]map[string][]models.MemoryVector{
-				service: make(map[string][]models.MemoryVector),
-			},
-		}
-		_, insertErr := collection.InsertOne(ctx, newVector)
-		return insertErr
-	}
-
-	if err != nil {
-		return err
-	}
-
-	/* Document exists - update store field with new service key */
-	return collection.UpdateOne(ctx, filter, updateOp)
+/* CreateLLMVector makes sure the user's default context has an (empty) type for the service */
+func (s *Service) CreateLLMVector(ctx context.Context, userID string, service string) (*models.LLMVector, error) {
+	return s.vectors.EnsureType(ctx, nil, userID, service)
 }
@@ -0,0 +1,15 @@
+package llm
+
+import (
+	"backend-v2/internal/middlewares"
+	"backend-v2/internal/services/llmproxy"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+/* RegisterRoutes mounts the provider-agnostic LLM API; keys come from the caller's stored integrations */
+func RegisterRoutes(router fiber.Router, proxy llmproxy.Service) {
+	llmGroup := router.Group("/llm", middlewares.RequireAuth)
+
+	llmGroup.Post("/chat", proxy.Chat)
+}
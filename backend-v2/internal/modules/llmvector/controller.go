@@ -1,18 +1,32 @@
 package llmvector
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"time"
+	"unicode"
+
 	"backend-v2/internal/common/response"
 	"backend-v2/internal/models"
+	"backend-v2/internal/services/llmproxy"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/qiniu/qmgo"
 )
 
+/* exportTimeout bounds streaming one context out */
+const exportTimeout = 10 * time.Minute
+
 type Controller struct {
-	service *Service
+	service  *Service
+	embedder llmproxy.Embedder
 }
 
-func NewController(service *Service) *Controller {
-	return &Controller{service: service}
+func NewController(service *Service, embedder llmproxy.Embedder) *Controller {
+	return &Controller{service: service, embedder: embedder}
 }
 
 /* POST /vector - Save context data */
@@ -24,9 +38,12 @@ func (c *Controller) Save(ctx *fiber.Ctx) error {
 
 	var payload struct {
 		ContextName *string                          `json:"contextName"`
+		Owner       string                           `json:"owner"`
 		Type        string                           `json:"type"`
 		Data        map[string][]models.MemoryVector `json:"data"`
 		Keep        bool                             `json:"keep"`
+		/* Model is recorded on embeddings that do not name their own */
+		Model string `json:"model"`
 	}
 
 	if err := ctx.BodyParser(&payload); err != nil {
@@ -42,18 +59,32 @@ func (c *Controller) Save(ctx *fiber.Ctx) error {
 		if source == "" {
 			return response.BadRequest(ctx, "Invalid source key")
 		}
-		for _, vector := range vectors {
+		for i, vector := range vectors {
 			if vector.Content == "" && len(vector.Embedding) == 0 {
 				return response.BadRequest(ctx, "Invalid value for '"+source+"'")
 			}
+			if vector.Model == "" && len(vector.Embedding) > 0 {
+				vectors[i].Model = payload.Model
+			}
 		}
 	}
 
-	context, err := c.service.SaveContext(ctx.Context(), payload.ContextName, userID, payload.Type, payload.Data, payload.Keep)
+	owner, done := c.resolveOwner(ctx, userID, payload.ContextName, payload.Owner, true)
+	if done != nil {
+		return done()
+	}
+
+	context, err := c.service.SaveContext(ctx.Context(), payload.ContextName, owner, payload.Type, payload.Data, payload.Keep)
+	if errors.Is(err, ErrEmbeddingMismatch) {
+		return response.BadRequest(ctx, err.Error())
+	}
 	if err != nil {
 		return response.InternalError(ctx, err.Error())
 	}
 
+	if owner != userID {
+		context.Share = nil
+	}
 	return ctx.JSON(context)
 }
 
@@ -73,7 +104,12 @@ func (c *Controller) Get(ctx *fiber.Ctx) error {
 		namePtr = &name
 	}
 
-	context, err := c.service.GetContext(ctx.Context(), namePtr, userID)
+	owner, done := c.resolveOwner(ctx, userID, namePtr, ctx.Query("owner"), false)
+	if done != nil {
+		return done()
+	}
+
+	context, err := c.service.GetContext(ctx.Context(), namePtr, owner)
 	if err != nil {
 		return response.NotFound(ctx, "Context not found")
 	}
@@ -102,7 +138,7 @@ func (c *Controller) Get(ctx *fiber.Ctx) error {
 	return ctx.JSON(typeStore)
 }
 
-/* GET /vector/all - Get all contexts for user */
+/* GET /vector/all - Get all contexts of the user and those shared with them */
 func (c *Controller) GetAll(ctx *fiber.Ctx) error {
 	userID, ok := ctx.Locals("userId").(string)
 	if !ok {
@@ -113,6 +149,15 @@ func (c *Controller) GetAll(ctx *fiber.Ctx) error {
 	if err != nil {
 		return response.InternalError(ctx, err.Error())
 	}
+	subject, err := c.service.Subject(ctx.Context(), userID)
+	if err != nil {
+		return response.InternalError(ctx, err.Error())
+	}
+	shared, err := c.service.GetSharedContexts(ctx.Context(), subject)
+	if err != nil {
+		return response.InternalError(ctx, err.Error())
+	}
+	contexts = append(contexts, shared...)
 
 	if contexts == nil {
 		contexts = []models.LLMVector{}
@@ -130,6 +175,7 @@ func (c *Controller) Delete(ctx *fiber.Ctx) error {
 
 	var payload struct {
 		ContextName *string  `json:"contextName"`
+		Owner       string   `json:"owner"`
 		Type        *string  `json:"type"`
 		Sources     []string `json:"sources"`
 	}
@@ -138,7 +184,16 @@ func (c *Controller) Delete(ctx *fiber.Ctx) error {
 		return response.BadRequest(ctx, "Invalid payload")
 	}
 
-	err := c.service.DeleteContext(ctx.Context(), payload.ContextName, userID, payload.Type, payload.Sources)
+	owner, done := c.resolveOwner(ctx, userID, payload.ContextName, payload.Owner, true)
+	if done != nil {
+		return done()
+	}
+	/* Contributors may clear types and sources; only the owner removes the context and its access list */
+	if payload.Type == nil && owner != userID {
+		return response.Forbidden(ctx, "Only the owner can remove a context")
+	}
+
+	err := c.service.DeleteContext(ctx.Context(), payload.ContextName, owner, payload.Type, payload.Sources)
 	if err != nil {
 		return response.NotFound(ctx, "Context not found")
 	}
@@ -179,10 +234,507 @@ func (c *Controller) Overview(ctx *fiber.Ctx) error {
 		filterTypePtr = &filterType
 	}
 
+	if ctx.QueryBool("stats") {
+		return c.stats(ctx, userID, filterTypePtr)
+	}
+
 	overview, err := c.service.GetOverview(ctx.Context(), userID, filterTypePtr)
 	if err != nil {
 		return response.InternalError(ctx, err.Error())
 	}
+	subject, err := c.service.Subject(ctx.Context(), userID)
+	if err != nil {
+		return response.InternalError(ctx, err.Error())
+	}
+	shared, err := c.service.GetSharedOverview(ctx.Context(), subject, filterTypePtr)
+	if err != nil {
+		return response.InternalError(ctx, err.Error())
+	}
+	/* Shared contexts are keyed "owner/name"; the user's own context wins should a name collide */
+	for key, types := range shared {
+		if _, taken := overview[key]; !taken {
+			overview[key] = types
+		}
+	}
 
 	return ctx.JSON(overview)
 }
+
+/* stats answers GET /vector/overview?stats=true, adding vector counts, sizes and last use to each context */
+func (c *Controller) stats(ctx *fiber.Ctx, userID string, filterType *string) error {
+	stats, err := c.service.GetStats(ctx.Context(), userID, filterType)
+	if err != nil {
+		return response.InternalError(ctx, err.Error())
+	}
+	subject, err := c.service.Subject(ctx.Context(), userID)
+	if err != nil {
+		return response.InternalError(ctx, err.Error())
+	}
+	shared, err := c.service.GetSharedStats(ctx.Context(), subject, filterType)
+	if err != nil {
+		return response.InternalError(ctx, err.Error())
+	}
+	for key, context := range shared {
+		if _, taken := stats[key]; !taken {
+			stats[key] = context
+		}
+	}
+
+	return ctx.JSON(stats)
+}
+
+/* POST /vector/search - Rank a context's vectors by similarity to a query embedding or text */
+func (c *Controller) Search(ctx *fiber.Ctx) error {
+	userID, ok := ctx.Locals("userId").(string)
+	if !ok {
+		return response.Unauthorized(ctx, "Unauthorized")
+	}
+
+	payload, owner, query, done := c.parseSearch(ctx, userID)
+	if done != nil {
+		return done()
+	}
+
+	filter := StoreFilter{Types: query.Types, Sources: query.Sources}
+	context, err := c.service.GetFilteredContext(ctx.Context(), payload.ContextName, owner, filter)
+	if errors.Is(err, qmgo.ErrNoSuchDocuments) {
+		return response.NotFound(ctx, "Context not found")
+	}
+	if err != nil {
+		return response.InternalError(ctx, err.Error())
+	}
+
+	results, err := Search(context.Store, query)
+	if err != nil {
+		return response.BadRequest(ctx, err.Error())
+	}
+
+	if !payload.IncludeEmbedding {
+		for i := range results {
+			results[i].Embedding = nil
+		}
+	}
+	return ctx.JSON(fiber.Map{"results": results})
+}
+
+/* POST /vector/nearest - Approximate top-k neighbours from the context's in-memory index */
+func (c *Controller) Nearest(ctx *fiber.Ctx) error {
+	userID, ok := ctx.Locals("userId").(string)
+	if !ok {
+		return response.Unauthorized(ctx, "Unauthorized")
+	}
+
+	payload, owner, query, done := c.parseSearch(ctx, userID)
+	if done != nil {
+		return done()
+	}
+
+	if norm(query.Embedding) == 0 {
+		return response.BadRequest(ctx, "query embedding must be a non-zero vector")
+	}
+
+	neighbors, err := c.service.Nearest(ctx.Context(), payload.ContextName, owner, query)
+	switch {
+	case errors.Is(err, qmgo.ErrNoSuchDocuments):
+		return response.NotFound(ctx, "Context not found")
+	case errors.Is(err, ErrIndexUnavailable):
+		return response.ServiceUnavailable(ctx, err.Error())
+	case err != nil:
+		return response.InternalError(ctx, err.Error())
+	}
+
+	if !payload.IncludeEmbedding {
+		for i := range neighbors {
+			neighbors[i].Embedding = nil
+		}
+	}
+	return ctx.JSON(fiber.Map{"results": neighbors})
+}
+
+/* POST /vector/retrieve - Rank by embedding similarity, keywords (BM25) or both fused */
+func (c *Controller) Retrieve(ctx *fiber.Ctx) error {
+	userID, ok := ctx.Locals("userId").(string)
+	if !ok {
+		return response.Unauthorized(ctx, "Unauthorized")
+	}
+
+	var payload struct {
+		searchPayload
+		Mode    RetrievalMode `json:"mode"`
+		Weights *Weights      `json:"weights"`
+	}
+	if err := ctx.BodyParser(&payload); err != nil {
+		return response.BadRequest(ctx, "Invalid payload")
+	}
+
+	weights := Weights{Vector: 1, Lexical: 1}
+	if payload.Weights != nil {
+		weights = *payload.Weights
+	}
+	switch payload.Mode {
+	case "":
+		payload.Mode = RetrieveHybrid
+	case RetrieveHybrid, RetrieveVector, RetrieveLexical:
+	default:
+		return response.BadRequest(ctx, "Invalid mode: use \"hybrid\", \"vector\" or \"lexical\"")
+	}
+	if payload.Mode == RetrieveHybrid && (weights.Vector < 0 || weights.Lexical < 0 || weights.Vector+weights.Lexical == 0) {
+		return response.BadRequest(ctx, "Invalid weights: \"vector\" and \"lexical\" must not be negative or both zero")
+	}
+
+	lexical := payload.Mode == RetrieveLexical || (payload.Mode == RetrieveHybrid && weights.Lexical > 0)
+	vector := payload.Mode == RetrieveVector || (payload.Mode == RetrieveHybrid && weights.Vector > 0)
+	if lexical && payload.Text == "" {
+		return response.BadRequest(ctx, "Invalid payload: \"text\" is required for keyword retrieval")
+	}
+
+	/* Access is checked before embedding, as in parseSearch */
+	owner, done := c.resolveOwner(ctx, userID, payload.ContextName, payload.Owner, false)
+	if done != nil {
+		return done()
+	}
+
+	query, done := c.searchQuery(ctx, payload.searchPayload, vector)
+	if done != nil {
+		return done()
+	}
+	if vector && norm(query.Embedding) == 0 {
+		return response.BadRequest(ctx, "query embedding must be a non-zero vector")
+	}
+
+	results, err := c.service.Retrieve(ctx.Context(), payload.ContextName, owner, RetrieveQuery{
+		SearchQuery: query,
+		Text:        payload.Text,
+		Mode:        payload.Mode,
+		Weights:     weights,
+	})
+	switch {
+	case errors.Is(err, qmgo.ErrNoSuchDocuments):
+		return response.NotFound(ctx, "Context not found")
+	case err != nil:
+		return response.InternalError(ctx, err.Error())
+	}
+
+	if !payload.IncludeEmbedding {
+		for i := range results {
+			results[i].Embedding = nil
+		}
+	}
+	return ctx.JSON(fiber.Map{"results": results})
+}
+
+/* GET /vector/export - Stream one context as JSON Lines */
+func (c *Controller) Export(ctx *fiber.Ctx) error {
+	userID, ok := ctx.Locals("userId").(string)
+	if !ok {
+		return response.Unauthorized(ctx, "Unauthorized")
+	}
+
+	name := ctx.Query("name")
+	var namePtr *string
+	if name != "" {
+		namePtr = &name
+	}
+
+	encoding := EmbeddingEncoding(ctx.Query("embeddings", string(EncodeJSON)))
+	if encoding != EncodeJSON && encoding != EncodeBinary && encoding != EncodeNone {
+		return response.BadRequest(ctx, "Invalid embeddings: use \"json\", \"binary\" or \"none\"")
+	}
+
+	owner, done := c.resolveOwner(ctx, userID, namePtr, ctx.Query("owner"), false)
+	if done != nil {
+		return done()
+	}
+
+	write, err := c.service.Export(ctx.Context(), namePtr, owner, encoding)
+	if errors.Is(err, qmgo.ErrNoSuchDocuments) {
+		return response.NotFound(ctx, "Context not found")
+	}
+	if err != nil {
+		return response.InternalError(ctx, err.Error())
+	}
+
+	ctx.Set("Content-Type", "application/x-ndjson")
+	ctx.Set("Content-Disposition", "attachment; filename=\""+exportFilename(name)+"\"")
+	ctx.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		/* The request context ends when the handler returns, before the body is written */
+		streamCtx, cancel := context.WithTimeout(context.Background(), exportTimeout)
+		defer cancel()
+		if err := write(streamCtx, w); err != nil {
+			log.Warn("export of context %q for user %s stopped: %v", name, userID, err)
+		}
+		w.Flush()
+	})
+	return nil
+}
+
+/* POST /vector/import - Load a JSON Lines export into a context */
+func (c *Controller) Import(ctx *fiber.Ctx) error {
+	userID, ok := ctx.Locals("userId").(string)
+	if !ok {
+		return response.Unauthorized(ctx, "Unauthorized")
+	}
+
+	mode := ImportMode(ctx.Query("onConflict", string(ImportFail)))
+	if mode != ImportFail && mode != ImportMerge && mode != ImportReplace {
+		return response.BadRequest(ctx, "Invalid onConflict: use \"fail\", \"merge\" or \"replace\"")
+	}
+
+	file, err := ReadImport(bytes.NewReader(ctx.Body()))
+	var importErr *ImportError
+	if errors.As(err, &importErr) {
+		return response.BadRequest(ctx, "Invalid export: "+importErr.Error())
+	}
+	if err != nil {
+		return response.BadRequest(ctx, "Invalid export")
+	}
+
+	/* The name in the query wins over the one the export was taken from */
+	name := file.Name
+	if queryName := ctx.Query("name"); queryName != "" {
+		name = &queryName
+	}
+
+	err = c.service.Import(ctx.Context(), name, userID, file, mode)
+	switch {
+	case errors.Is(err, ErrContextExists):
+		return response.Conflict(ctx, "Context already exists; import with onConflict=merge or onConflict=replace")
+	case errors.As(err, &importErr):
+		return response.BadRequest(ctx, "Invalid export: "+importErr.Error())
+	case errors.Is(err, ErrEmbeddingMismatch):
+		return response.BadRequest(ctx, "Invalid export: "+err.Error())
+	case err != nil:
+		return response.InternalError(ctx, err.Error())
+	}
+
+	return ctx.JSON(fiber.Map{
+		"name":    name,
+		"types":   len(file.Data),
+		"vectors": file.Vectors,
+	})
+}
+
+/* GET /vector/share - Get the access list of one of the user's contexts */
+func (c *Controller) GetShare(ctx *fiber.Ctx) error {
+	userID, ok := ctx.Locals("userId").(string)
+	if !ok {
+		return response.Unauthorized(ctx, "Unauthorized")
+	}
+
+	name := ctx.Query("name")
+	var namePtr *string
+	if name != "" {
+		namePtr = &name
+	}
+
+	access, err := c.service.GetShare(ctx.Context(), namePtr, userID)
+	if errors.Is(err, qmgo.ErrNoSuchDocuments) {
+		return response.NotFound(ctx, "Context not found")
+	}
+	if err != nil {
+		return response.InternalError(ctx, err.Error())
+	}
+
+	return ctx.JSON(access)
+}
+
+/* POST /vector/share - Replace the access list of one of the user's contexts */
+func (c *Controller) SetShare(ctx *fiber.Ctx) error {
+	userID, ok := ctx.Locals("userId").(string)
+	if !ok {
+		return response.Unauthorized(ctx, "Unauthorized")
+	}
+
+	var payload struct {
+		ContextName *string              `json:"contextName"`
+		Access      []models.RoleBinding `json:"access"`
+	}
+	if err := ctx.BodyParser(&payload); err != nil {
+		return response.BadRequest(ctx, "Invalid payload")
+	}
+
+	err := c.service.SetShare(ctx.Context(), payload.ContextName, userID, payload.Access)
+	switch {
+	case errors.Is(err, ErrInvalidShare):
+		return response.BadRequest(ctx, "Invalid access list: roles are \"reader\" or \"contributor\", subject types \"user\" or \"mail\"")
+	case errors.Is(err, qmgo.ErrNoSuchDocuments):
+		return response.NotFound(ctx, "Context not found")
+	case err != nil:
+		return response.InternalError(ctx, err.Error())
+	}
+
+	return ctx.JSON(fiber.Map{"success": true})
+}
+
+/* GET /vector/retention - Get the retention policy of one of the user's contexts */
+func (c *Controller) GetRetention(ctx *fiber.Ctx) error {
+	userID, ok := ctx.Locals("userId").(string)
+	if !ok {
+		return response.Unauthorized(ctx, "Unauthorized")
+	}
+
+	name := ctx.Query("name")
+	var namePtr *string
+	if name != "" {
+		namePtr = &name
+	}
+
+	retention, err := c.service.GetRetention(ctx.Context(), namePtr, userID)
+	if errors.Is(err, qmgo.ErrNoSuchDocuments) {
+		return response.NotFound(ctx, "Context not found")
+	}
+	if err != nil {
+		return response.InternalError(ctx, err.Error())
+	}
+
+	return ctx.JSON(retention)
+}
+
+/* POST /vector/retention - Replace the retention policy of one of the user's contexts */
+func (c *Controller) SetRetention(ctx *fiber.Ctx) error {
+	userID, ok := ctx.Locals("userId").(string)
+	if !ok {
+		return response.Unauthorized(ctx, "Unauthorized")
+	}
+
+	var payload struct {
+		ContextName *string `json:"contextName"`
+		models.VectorRetention
+	}
+	if err := ctx.BodyParser(&payload); err != nil {
+		return response.BadRequest(ctx, "Invalid payload")
+	}
+
+	err := c.service.SetRetention(ctx.Context(), payload.ContextName, userID, &payload.VectorRetention)
+	switch {
+	case errors.Is(err, ErrInvalidRetention):
+		return response.BadRequest(ctx, "Invalid retention: \"ttl\" and \"maxVectors\" must not be negative, and each of \"sources\" needs a type, a source and a positive \"ttl\" in seconds")
+	case errors.Is(err, qmgo.ErrNoSuchDocuments):
+		return response.NotFound(ctx, "Context not found")
+	case err != nil:
+		return response.InternalError(ctx, err.Error())
+	}
+
+	return ctx.JSON(fiber.Map{"success": true})
+}
+
+/*
+resolveOwner returns whose context a request addresses: the caller's own, or owner's when the
+caller holds a grant on it, a contributor one when write is set. done is set when refused;
+contexts without a grant answer 404, so their existence is not revealed.
+*/
+func (c *Controller) resolveOwner(ctx *fiber.Ctx, userID string, name *string, owner string, write bool) (string, func() error) {
+	if owner == "" || owner == userID {
+		return userID, nil
+	}
+
+	subject, err := c.service.Subject(ctx.Context(), userID)
+	if err != nil {
+		return "", func() error { return response.InternalError(ctx, err.Error()) }
+	}
+	role, err := c.service.Role(ctx.Context(), name, owner, subject)
+	if errors.Is(err, qmgo.ErrNoSuchDocuments) {
+		return "", func() error { return response.NotFound(ctx, "Context not found") }
+	}
+	if err != nil {
+		return "", func() error { return response.InternalError(ctx, err.Error()) }
+	}
+	if write && !CanWrite(role) {
+		return "", func() error { return response.Forbidden(ctx, "Only contributors can change a shared context") }
+	}
+	return owner, nil
+}
+
+/* exportFilename keeps a context name safe for a Content-Disposition header */
+func exportFilename(name string) string {
+	safe := strings.Map(func(r rune) rune {
+		if r < 128 && (unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_' || r == '.') {
+			return r
+		}
+		return '_'
+	}, name)
+	if safe == "" {
+		safe = "context"
+	}
+	return safe + ".jsonl"
+}
+
+type searchPayload struct {
+	ContextName *string                `json:"contextName"`
+	Owner       string                 `json:"owner"`
+	Embedding   []float64              `json:"embedding"`
+	Text        string                 `json:"text"`
+	Provider    string                 `json:"provider"`
+	Model       string                 `json:"model"`
+	Type        string                 `json:"type"`
+	Sources     []string               `json:"sources"`
+	Metadata    map[string]interface{} `json:"metadata"`
+	TopK        int                    `json:"topK"`
+	MinScore    *float64               `json:"minScore"`
+	/* IncludeEmbedding returns the stored vectors too; off by default to keep responses small */
+	IncludeEmbedding bool `json:"includeEmbedding"`
+}
+
+/* parseSearch reads a search payload, resolves the owner of its context and embeds its text; done is set when the response was decided */
+func (c *Controller) parseSearch(ctx *fiber.Ctx, userID string) (payload searchPayload, owner string, query SearchQuery, done func() error) {
+	if err := ctx.BodyParser(&payload); err != nil {
+		return payload, owner, query, func() error { return response.BadRequest(ctx, "Invalid payload") }
+	}
+	/* The caller must reach the context before its text is embedded at their provider's cost */
+	if owner, done = c.resolveOwner(ctx, userID, payload.ContextName, payload.Owner, false); done != nil {
+		return payload, owner, query, done
+	}
+	query, done = c.searchQuery(ctx, payload, true)
+	return payload, owner, query, done
+}
+
+/* searchQuery builds the query of payload, embedding its text unless embed is false or an embedding was given */
+func (c *Controller) searchQuery(ctx *fiber.Ctx, payload searchPayload, embed bool) (query SearchQuery, done func() error) {
+	if embed && len(payload.Embedding) == 0 && payload.Text == "" {
+		return query, func() error {
+			return response.BadRequest(ctx, "Invalid payload: \"embedding\" or \"text\" is required")
+		}
+	}
+
+	embedding := payload.Embedding
+	if embed && len(embedding) == 0 {
+		provider := payload.Provider
+		if provider == "" {
+			provider = "openai"
+		}
+		var err error
+		embedding, err = c.embedder.Embed(ctx, provider, payload.Model, payload.Text)
+		if err != nil {
+			return query, func() error { return respondEmbedError(ctx, provider, err) }
+		}
+	}
+
+	var types []string
+	if payload.Type != "" {
+		types = []string{payload.Type}
+	}
+	query = SearchQuery{
+		Embedding: embedding,
+		Types:     types,
+		Sources:   payload.Sources,
+		Metadata:  payload.Metadata,
+		TopK:      payload.TopK,
+		MinScore:  payload.MinScore,
+	}
+	return query, nil
+}
+
+func respondEmbedError(ctx *fiber.Ctx, provider string, err error) error {
+	switch {
+	case errors.Is(err, llmproxy.ErrEmbeddingUnavailable):
+		return response.ServiceUnavailable(ctx, err.Error())
+	case errors.Is(err, llmproxy.ErrEmbeddingProvider), errors.Is(err, llmproxy.ErrEmbeddingModel):
+		return response.BadRequest(ctx, err.Error())
+	case errors.Is(err, llmproxy.ErrEmbeddingLimited):
+		return response.TooManyRequests(ctx, err.Error())
+	case errors.Is(err, llmproxy.ErrAPIKeyRequired), errors.Is(err, llmproxy.ErrEndpointNotConfigured),
+		errors.Is(err, llmproxy.ErrIntegrationNotAvailable):
+		return response.BadRequest(ctx, "No "+provider+" integration configured to embed the text")
+	}
+	return response.BadGateway(ctx, err.Error())
+}
@@ -0,0 +1,209 @@
+package llmvector
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/qiniu/qmgo"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"backend-v2/internal/models"
+)
+
+/*
+ErrEmbeddingMismatch is returned when a save would mix embedding models or dimensions in one
+type; similarity between embeddings of different models means nothing.
+*/
+var ErrEmbeddingMismatch = errors.New("embedding mismatch")
+
+/*
+specOf returns the model and dimension data's embeddings share, nil when none has an
+embedding. Vectors without a model agree with any model, since nothing says otherwise.
+*/
+func specOf(contextType string, data map[string][]models.MemoryVector) (*models.EmbeddingSpec, error) {
+	var spec *models.EmbeddingSpec
+	for _, source := range sortedKeys(data, nil) {
+		for _, vector := range data[source] {
+			dimension := len(vector.Embedding)
+			if dimension == 0 {
+				continue
+			}
+			if vector.Dimension != 0 && vector.Dimension != dimension {
+				return nil, fmt.Errorf("%w: a vector of source %q declares %d dimensions but has %d", ErrEmbeddingMismatch, source, vector.Dimension, dimension)
+			}
+			next := &models.EmbeddingSpec{Type: contextType, Model: vector.Model, Dimension: dimension}
+			if spec == nil {
+				spec = next
+				continue
+			}
+			if err := agree(spec, next); err != nil {
+				return nil, err
+			}
+			if spec.Model == "" {
+				spec.Model = next.Model
+			}
+		}
+	}
+	return spec, nil
+}
+
+/* agree checks that incoming embeddings can sit beside stored ones */
+func agree(stored, incoming *models.EmbeddingSpec) error {
+	if stored.Dimension != incoming.Dimension {
+		return fmt.Errorf("%w: type %q holds %d-dimension embeddings, got %d", ErrEmbeddingMismatch, stored.Type, stored.Dimension, incoming.Dimension)
+	}
+	if stored.Model != "" && incoming.Model != "" && stored.Model != incoming.Model {
+		return fmt.Errorf("%w: type %q holds embeddings from %q, got %q", ErrEmbeddingMismatch, stored.Type, stored.Model, incoming.Model)
+	}
+	return nil
+}
+
+/*
+nextSpec is the spec a type records after a save: the incoming one when the type is replaced
+or had none, the stored one otherwise. A type whose vectors predate model tracking takes the
+model of the first embeddings saved with one. changed is false when nothing needs writing.
+*/
+func nextSpec(stored, incoming *models.EmbeddingSpec, replacing bool) (spec *models.EmbeddingSpec, changed bool) {
+	switch {
+	case replacing:
+		return incoming, stored != nil || incoming != nil
+	case incoming == nil:
+		return stored, false
+	case stored == nil:
+		return incoming, true
+	case stored.Model == "" && incoming.Model != "":
+		learned := *stored
+		learned.Model = incoming.Model
+		return &learned, true
+	}
+	return stored, false
+}
+
+/* specFor finds a type's spec in the header */
+func specFor(header *models.LLMVector, contextType string) *models.EmbeddingSpec {
+	for i := range header.Embeddings {
+		if header.Embeddings[i].Type == contextType {
+			return &header.Embeddings[i]
+		}
+	}
+	return nil
+}
+
+/* contentHash identifies repeated content */
+func contentHash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+/* dedupeKey is the identity of content within a source */
+func dedupeKey(source, hash string) string {
+	return source + "\x00" + hash
+}
+
+/*
+dedupeData drops vectors whose content a source already holds, per seen, or repeats earlier in
+data. Vectors without content are kept; only content identifies a vector. Sources stay even
+when all their vectors go, so the layout is still recorded.
+*/
+func dedupeData(data map[string][]models.MemoryVector, seen map[string]bool) (map[string][]models.MemoryVector, int) {
+	skipped := 0
+	kept := make(map[string][]models.MemoryVector, len(data))
+	for source, vectors := range data {
+		kept[source] = make([]models.MemoryVector, 0, len(vectors))
+		for _, vector := range vectors {
+			if vector.Content != "" {
+				key := dedupeKey(source, contentHash(vector.Content))
+				if seen[key] {
+					skipped++
+					continue
+				}
+				seen[key] = true
+			}
+			kept[source] = append(kept[source], vector)
+		}
+	}
+	return kept, skipped
+}
+
+/*
+storedSpec returns the spec of a type's embeddings: the header's record, else one read off a
+stored embedding for types written before specs were recorded, else nil.
+*/
+func (s *Service) storedSpec(ctx context.Context, header *models.LLMVector, contextType string) (*models.EmbeddingSpec, error) {
+	if spec := specFor(header, contextType); spec != nil {
+		return spec, nil
+	}
+
+	var chunk models.LLMVectorChunk
+	query := bson.M{"userId": header.UserID, "context": header.Name, "type": contextType, "embedding.0": bson.M{"$exists": true}}
+	err := s.chunks.Find(ctx, query).Select(bson.M{"embedding": 1, "model": 1}).One(&chunk)
+	if errors.Is(err, qmgo.ErrNoSuchDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &models.EmbeddingSpec{Type: contextType, Model: chunk.Model, Dimension: len(chunk.Embedding)}, nil
+}
+
+/* recordSpec replaces a type's spec in the header; a nil spec forgets it */
+func (s *Service) recordSpec(ctx context.Context, header *models.LLMVector, contextType string, spec *models.EmbeddingSpec) error {
+	filter := bson.M{"_id": header.ID}
+	if err := s.contexts.UpdateOne(ctx, filter, bson.M{"$pull": bson.M{"embeddings": bson.M{"type": contextType}}}); err != nil {
+		return err
+	}
+	if spec == nil {
+		return nil
+	}
+	return s.contexts.UpdateOne(ctx, filter, bson.M{"$push": bson.M{"embeddings": spec}})
+}
+
+/* dedupe drops the vectors of an append whose content their source already stores */
+func (s *Service) dedupe(ctx context.Context, name *string, userID, contextType string, data map[string][]models.MemoryVector) (map[string][]models.MemoryVector, int, error) {
+	var hashes []string
+	for _, vectors := range data {
+		for _, vector := range vectors {
+			if vector.Content != "" {
+				hashes = append(hashes, contentHash(vector.Content))
+			}
+		}
+	}
+	if len(hashes) == 0 {
+		return data, 0, nil
+	}
+
+	/* Chunks stored before hashes were recorded match nothing until cmd/migrate-llmvectors hashes them */
+	query := bson.M{
+		"userId":  userID,
+		"context": name,
+		"type":    contextType,
+		"source":  bson.M{"$in": sortedKeys(data, nil)},
+		"hash":    bson.M{"$in": hashes},
+	}
+	stored := []models.LLMVectorChunk{}
+	if err := s.chunks.Find(ctx, query).Select(bson.M{"source": 1, "hash": 1}).All(&stored); err != nil {
+		return nil, 0, err
+	}
+
+	seen := make(map[string]bool, len(stored))
+	for _, chunk := range stored {
+		seen[dedupeKey(chunk.Source, chunk.Hash)] = true
+	}
+	kept, skipped := dedupeData(data, seen)
+	return kept, skipped, nil
+}
+
+/* Embeddings returns the model and dimension of a type's embeddings, nil when it has none */
+func (s *Service) Embeddings(ctx context.Context, name *string, userID, contextType string) (*models.EmbeddingSpec, error) {
+	header, err := s.header(ctx, name, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !contains(header.Types, contextType) && header.Store[contextType] == nil {
+		return nil, qmgo.ErrNoSuchDocuments
+	}
+	return s.storedSpec(ctx, header, contextType)
+}
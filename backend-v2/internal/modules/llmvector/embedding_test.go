@@ -0,0 +1,122 @@
+package llmvector
+
+import (
+	"errors"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"backend-v2/internal/models"
+)
+
+func TestSpecOf(t *testing.T) {
+	spec, err := specOf("notes", map[string][]models.MemoryVector{
+		"a": {{Content: "no embedding"}, {Embedding: []float64{1, 2}}},
+		"b": {{Embedding: []float64{3, 4}, Model: "ada", Dimension: 2}},
+	})
+	if err != nil || spec == nil || *spec != (models.EmbeddingSpec{Type: "notes", Model: "ada", Dimension: 2}) {
+		t.Fatalf("specOf() = %+v, %v, want ada at 2 dimensions", spec, err)
+	}
+
+	if spec, err := specOf("notes", map[string][]models.MemoryVector{"a": {{Content: "text"}}}); spec != nil || err != nil {
+		t.Errorf("specOf(content only) = %+v, %v, want nil", spec, err)
+	}
+
+	invalid := map[string]map[string][]models.MemoryVector{
+		"dimensions": {"a": {{Embedding: []float64{1, 2}}, {Embedding: []float64{1, 2, 3}}}},
+		"models":     {"a": {{Embedding: []float64{1}, Model: "ada"}}, "b": {{Embedding: []float64{2}, Model: "custom"}}},
+		"declared":   {"a": {{Embedding: []float64{1, 2}, Dimension: 3}}},
+	}
+	for name, data := range invalid {
+		if _, err := specOf("notes", data); !errors.Is(err, ErrEmbeddingMismatch) {
+			t.Errorf("specOf(mixed %s) = %v, want ErrEmbeddingMismatch", name, err)
+		}
+	}
+}
+
+func TestAgreeAndNextSpec(t *testing.T) {
+	ada := &models.EmbeddingSpec{Type: "notes", Model: "ada", Dimension: 2}
+	unknown := &models.EmbeddingSpec{Type: "notes", Dimension: 2}
+	custom := &models.EmbeddingSpec{Type: "notes", Model: "custom", Dimension: 2}
+	wide := &models.EmbeddingSpec{Type: "notes", Model: "ada", Dimension: 3}
+
+	if err := agree(ada, unknown); err != nil {
+		t.Errorf("agree(ada, unknown model) = %v, want an unknown model to pass", err)
+	}
+	if err := agree(ada, custom); !errors.Is(err, ErrEmbeddingMismatch) {
+		t.Errorf("agree(ada, custom) = %v, want ErrEmbeddingMismatch", err)
+	}
+	if err := agree(unknown, wide); !errors.Is(err, ErrEmbeddingMismatch) {
+		t.Errorf("agree(2 dimensions, 3 dimensions) = %v, want ErrEmbeddingMismatch", err)
+	}
+
+	cases := []struct {
+		name             string
+		stored, incoming *models.EmbeddingSpec
+		replacing        bool
+		want             *models.EmbeddingSpec
+		changed          bool
+	}{
+		{"first embeddings", nil, ada, false, ada, true},
+		{"content only append", ada, nil, false, ada, false},
+		{"same spec", ada, ada, false, ada, false},
+		{"model learned", unknown, ada, false, ada, true},
+		{"unknown kept", ada, unknown, false, ada, false},
+		{"replace", ada, custom, true, custom, true},
+		{"replace with content only", ada, nil, true, nil, true},
+		{"replace nothing with nothing", nil, nil, true, nil, false},
+	}
+	for _, c := range cases {
+		got, changed := nextSpec(c.stored, c.incoming, c.replacing)
+		if changed != c.changed || (got == nil) != (c.want == nil) || (got != nil && *got != *c.want) {
+			t.Errorf("%s: nextSpec() = %+v, %v, want %+v, %v", c.name, got, changed, c.want, c.changed)
+		}
+	}
+	if unknown.Model != "" {
+		t.Errorf("nextSpec() changed the stored spec in place")
+	}
+}
+
+func TestDedupeData(t *testing.T) {
+	seen := map[string]bool{dedupeKey("a", contentHash("stored")): true}
+	data := map[string][]models.MemoryVector{
+		"a": {{Content: "stored"}, {Content: "new"}, {Content: "new"}, {Embedding: []float64{1}}, {Embedding: []float64{1}}},
+		"b": {{Content: "stored"}},
+		"c": {{Content: "stored"}},
+	}
+	seen[dedupeKey("c", contentHash("stored"))] = true
+
+	kept, skipped := dedupeData(data, seen)
+	if skipped != 3 {
+		t.Errorf("dedupeData() skipped %d, want 3", skipped)
+	}
+	if len(kept["a"]) != 3 || kept["a"][0].Content != "new" || len(kept["a"][1].Embedding) != 1 {
+		t.Errorf("kept a = %+v, want the new content once and both embedding-only vectors", kept["a"])
+	}
+	if len(kept["b"]) != 1 {
+		t.Errorf("kept b = %+v, want content another source holds", kept["b"])
+	}
+	if vectors, ok := kept["c"]; !ok || len(vectors) != 0 {
+		t.Errorf("kept c = %v, %v, want the source kept empty", vectors, ok)
+	}
+}
+
+func TestSplitData_RecordsHashAndDimension(t *testing.T) {
+	chunks, _ := splitData("u", nil, "notes", map[string][]models.MemoryVector{
+		"a": {
+			{Content: "text", Embedding: []float64{1, 2, 3}, Model: "ada", Dimension: 99},
+			{Content: "plain", Model: "ada"},
+			{Embedding: []float64{1}},
+		},
+	}, primitive.NewObjectID)
+
+	if chunks[0].Dimension != 3 || chunks[0].Model != "ada" || chunks[0].Hash != contentHash("text") {
+		t.Errorf("chunk 0 = %+v, want dimension 3, model and hash", chunks[0])
+	}
+	if chunks[1].Model != "" || chunks[1].Dimension != 0 {
+		t.Errorf("chunk 1 = %+v, want no model without an embedding", chunks[1])
+	}
+	if chunks[2].Hash != "" {
+		t.Errorf("chunk 2 hash = %q, want none without content", chunks[2].Hash)
+	}
+}
@@ -0,0 +1,211 @@
+package llmvector
+
+import (
+	"container/list"
+	"context"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"backend-v2/internal/models"
+	"backend-v2/internal/services/vectorindex"
+)
+
+/* BM25 term saturation and length normalisation, at their usual values */
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+/* lexicalBudget bounds the postings held by resident lexical indexes, about 24 bytes each */
+const lexicalBudget = 4 << 20
+
+type posting struct {
+	doc  int
+	freq int
+}
+
+/*
+lexicalIndex is a BM25 inverted index over the content of one context's vectors. It keeps
+terms and lengths only; content is read back for the winning vectors.
+*/
+type lexicalIndex struct {
+	version   time.Time
+	items     []vectorindex.Item
+	lengths   []int
+	postings  map[string][]posting
+	avgLength float64
+	size      int
+}
+
+func newLexicalIndex(version time.Time, chunks []models.LLMVectorChunk) *lexicalIndex {
+	idx := &lexicalIndex{version: version, postings: make(map[string][]posting)}
+	total := 0
+	for _, chunk := range chunks {
+		terms := tokenize(chunk.Content)
+		if len(terms) == 0 {
+			continue
+		}
+
+		doc := len(idx.items)
+		idx.items = append(idx.items, vectorindex.Item{ID: chunk.ID.Hex(), Type: chunk.Type, Source: chunk.Source, Metadata: chunk.Metadata})
+		idx.lengths = append(idx.lengths, len(terms))
+		total += len(terms)
+
+		freqs := make(map[string]int)
+		for _, term := range terms {
+			freqs[term]++
+		}
+		for term, freq := range freqs {
+			idx.postings[term] = append(idx.postings[term], posting{doc: doc, freq: freq})
+			idx.size++
+		}
+	}
+	if len(idx.items) > 0 {
+		idx.avgLength = float64(total) / float64(len(idx.items))
+	}
+	return idx
+}
+
+/* search returns the k best BM25 matches for terms among the items accept keeps; ties keep insertion order */
+func (idx *lexicalIndex) search(terms []string, k int, accept func(vectorindex.Item) bool) []vectorindex.Hit {
+	scores := make(map[int]float64)
+	seen := make(map[string]bool, len(terms))
+	total := float64(len(idx.items))
+	for _, term := range terms {
+		if seen[term] {
+			continue
+		}
+		seen[term] = true
+
+		postings := idx.postings[term]
+		if len(postings) == 0 {
+			continue
+		}
+		matches := float64(len(postings))
+		idf := math.Log(1 + (total-matches+0.5)/(matches+0.5))
+		for _, p := range postings {
+			freq := float64(p.freq)
+			norm := 1 - bm25B + bm25B*float64(idx.lengths[p.doc])/idx.avgLength
+			scores[p.doc] += idf * freq * (bm25K1 + 1) / (freq + bm25K1*norm)
+		}
+	}
+
+	docs := make([]int, 0, len(scores))
+	for doc := range scores {
+		if accept == nil || accept(idx.items[doc]) {
+			docs = append(docs, doc)
+		}
+	}
+	sort.Slice(docs, func(i, j int) bool {
+		if scores[docs[i]] != scores[docs[j]] {
+			return scores[docs[i]] > scores[docs[j]]
+		}
+		return docs[i] < docs[j]
+	})
+	if len(docs) > k {
+		docs = docs[:k]
+	}
+
+	hits := make([]vectorindex.Hit, len(docs))
+	for i, doc := range docs {
+		hits[i] = vectorindex.Hit{Item: idx.items[doc], Score: scores[doc]}
+	}
+	return hits
+}
+
+/*
+tokenize lowercases text into runs of letters and digits. Words joined by punctuation, such
+as product codes like "SKU-4411" or "v2.1", also yield the joined form, so the exact code
+outranks vectors that only share its parts.
+*/
+func tokenize(text string) []string {
+	var terms []string
+	for _, field := range strings.FieldsFunc(strings.ToLower(text), unicode.IsSpace) {
+		parts := strings.FieldsFunc(field, isSeparator)
+		terms = append(terms, parts...)
+		if len(parts) > 1 {
+			terms = append(terms, strings.Join(parts, ""))
+		}
+	}
+	return terms
+}
+
+func isSeparator(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+}
+
+/*
+lexicalCache keeps recently queried lexical indexes within lexicalBudget postings. An index is
+rebuilt when its context's updatedAt moved on, so writes from any instance are picked up.
+*/
+type lexicalCache struct {
+	mu      sync.Mutex
+	budget  int
+	used    int
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type lexicalEntry struct {
+	key string
+	idx *lexicalIndex
+}
+
+func newLexicalCache(budget int) *lexicalCache {
+	return &lexicalCache{budget: budget, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+/* get returns the index of key at version, building it with load when missing or stale */
+func (c *lexicalCache) get(ctx context.Context, key string, version time.Time, load func(context.Context) ([]models.LLMVectorChunk, error)) (*lexicalIndex, error) {
+	c.mu.Lock()
+	if element, ok := c.entries[key]; ok {
+		entry := element.Value.(*lexicalEntry)
+		if entry.idx.version.Equal(version) {
+			c.order.MoveToFront(element)
+			c.mu.Unlock()
+			return entry.idx, nil
+		}
+		c.remove(element)
+	}
+	c.mu.Unlock()
+
+	/* Concurrent misses may build twice; the last one wins and both answer correctly */
+	chunks, err := load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	idx := newLexicalIndex(version, chunks)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.entries[key]; ok {
+		c.remove(element)
+	}
+	c.entries[key] = c.order.PushFront(&lexicalEntry{key: key, idx: idx})
+	c.used += idx.size
+	/* The newest index always stays, even alone past the budget */
+	for c.used > c.budget && c.order.Len() > 1 {
+		c.remove(c.order.Back())
+	}
+	return idx, nil
+}
+
+/* drop forgets key after its context is deleted */
+func (c *lexicalCache) drop(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.entries[key]; ok {
+		c.remove(element)
+	}
+}
+
+/* remove unlinks element; callers hold c.mu */
+func (c *lexicalCache) remove(element *list.Element) {
+	entry := c.order.Remove(element).(*lexicalEntry)
+	delete(c.entries, entry.key)
+	c.used -= entry.idx.size
+}
@@ -0,0 +1,151 @@
+package llmvector
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"backend-v2/internal/models"
+	"backend-v2/internal/services/vectorindex"
+)
+
+func lexicalChunks(contents ...string) []models.LLMVectorChunk {
+	chunks := make([]models.LLMVectorChunk, len(contents))
+	for i, content := range contents {
+		chunks[i] = models.LLMVectorChunk{
+			ID:           primitive.NewObjectID(),
+			Type:         "notes",
+			Source:       "board",
+			MemoryVector: models.MemoryVector{Content: content, Metadata: map[string]interface{}{"n": i}},
+		}
+	}
+	return chunks
+}
+
+func hitIDs(hits []vectorindex.Hit) []string {
+	ids := make([]string, len(hits))
+	for i, hit := range hits {
+		ids[i] = hit.ID
+	}
+	return ids
+}
+
+func TestTokenize(t *testing.T) {
+	got := tokenize("Order SKU-4411, v2.1 — Ünïcode  words!")
+	want := []string{"order", "sku", "4411", "sku4411", "v2", "1", "v21", "ünïcode", "words"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("tokenize() = %q, want %q", got, want)
+	}
+}
+
+func TestLexicalIndex_RanksExactTermsFirst(t *testing.T) {
+	chunks := lexicalChunks(
+		"the blue widget ships in spring",
+		"widget SKU-4411 is the blue one",
+		"nothing relevant here at all",
+		"the sku list covers every widget and every sku",
+	)
+	idx := newLexicalIndex(time.Time{}, chunks)
+
+	hits := idx.search(tokenize("sku-4411"), 10, nil)
+	if len(hits) != 2 || hits[0].ID != chunks[1].ID.Hex() || hits[1].ID != chunks[3].ID.Hex() {
+		t.Fatalf("search(sku-4411) = %v, want the exact code first, then the shared part", hitIDs(hits))
+	}
+
+	hits = idx.search(tokenize("blue widget"), 10, nil)
+	if len(hits) != 3 || hits[2].ID != chunks[3].ID.Hex() {
+		t.Errorf("search(blue widget) = %v, want both blue chunks before the other widget", hitIDs(hits))
+	}
+
+	even := func(item vectorindex.Item) bool { return item.Metadata["n"].(int)%2 == 0 }
+	hits = idx.search(tokenize("widget"), 1, even)
+	if len(hits) != 1 || hits[0].ID != chunks[0].ID.Hex() {
+		t.Errorf("filtered search = %v, want only the first chunk", hitIDs(hits))
+	}
+
+	if hits := idx.search(tokenize("absent"), 10, nil); len(hits) != 0 {
+		t.Errorf("search(absent) = %v, want none", hitIDs(hits))
+	}
+}
+
+func TestLexicalCache_RebuildsStaleAndEvictsPastBudget(t *testing.T) {
+	cache := newLexicalCache(8)
+	loads := 0
+	load := func(contents ...string) func(context.Context) ([]models.LLMVectorChunk, error) {
+		return func(context.Context) ([]models.LLMVectorChunk, error) {
+			loads++
+			return lexicalChunks(contents...), nil
+		}
+	}
+	v1 := time.Unix(1, 0)
+	v2 := time.Unix(2, 0)
+
+	first, _ := cache.get(context.Background(), "a", v1, load("one two three"))
+	again, _ := cache.get(context.Background(), "a", v1, load("unused"))
+	if first != again || loads != 1 {
+		t.Fatalf("same version loaded %d times, want a cached index", loads)
+	}
+	if stale, _ := cache.get(context.Background(), "a", v2, load("four")); stale == first || loads != 2 {
+		t.Errorf("newer version served the old index")
+	}
+
+	cache.get(context.Background(), "b", v1, load("five six seven eight nine ten eleven twelve"))
+	if _, ok := cache.entries["a"]; ok {
+		t.Errorf("cache kept %q past its budget", "a")
+	}
+	if _, ok := cache.entries["b"]; !ok || cache.used != 8 {
+		t.Errorf("cache dropped the newest index or miscounted, used = %d", cache.used)
+	}
+
+	cache.drop("b")
+	if cache.order.Len() != 0 || cache.used != 0 {
+		t.Errorf("drop left %d entries and %d postings", cache.order.Len(), cache.used)
+	}
+}
+
+func TestFuse_ReciprocalRankFusion(t *testing.T) {
+	hit := func(id string, score float64) vectorindex.Hit {
+		return vectorindex.Hit{Item: vectorindex.Item{ID: id}, Score: score}
+	}
+	vector := []vectorindex.Hit{hit("a", 0.9), hit("b", 0.8), hit("c", 0.7)}
+	lexical := []vectorindex.Hit{hit("c", 12), hit("d", 9)}
+
+	ids := func(results []Retrieved) []string {
+		out := make([]string, len(results))
+		for i, result := range results {
+			out[i] = result.ID
+		}
+		return out
+	}
+
+	fused := fuse(vector, lexical, Weights{Vector: 1, Lexical: 1})
+	if got, want := ids(fused), []string{"c", "a", "b", "d"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("fuse() = %v, want %v", got, want)
+	}
+	if c := fused[0]; c.VectorRank != 3 || c.LexicalRank != 1 || c.LexicalScore != 12 {
+		t.Errorf("fused c = %+v, want ranks from both lists", c)
+	}
+
+	if got, want := ids(fuse(vector, lexical, Weights{Vector: 1, Lexical: 3})), []string{"c", "d", "a", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("lexical-weighted fuse() = %v, want %v", got, want)
+	}
+	if got, want := ids(fuse(nil, lexical, Weights{Lexical: 1})), []string{"c", "d"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("lexical-only fuse() = %v, want %v", got, want)
+	}
+}
+
+func TestExactHits(t *testing.T) {
+	chunks := lexicalChunks("same", "diagonal", "other dimension", "zero")
+	chunks[0].Embedding = []float64{2, 0}
+	chunks[1].Embedding = []float64{1, 1}
+	chunks[2].Embedding = []float64{1, 0, 0}
+	chunks[3].Embedding = []float64{0, 0}
+
+	hits := exactHits(chunks, []float64{1, 0}, 10, func(vectorindex.Item) bool { return true })
+	if got, want := hitIDs(hits), []string{chunks[0].ID.Hex(), chunks[1].ID.Hex()}; !reflect.DeepEqual(got, want) {
+		t.Errorf("exactHits() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,143 @@
+package llmvector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"backend-v2/internal/models"
+	"backend-v2/internal/services/vectorindex"
+)
+
+/* ErrIndexUnavailable is returned by Nearest when the service runs without an index */
+var ErrIndexUnavailable = errors.New("vector index is not enabled")
+
+/* Neighbor is one approximate nearest vector, addressed by its chunk id */
+type Neighbor struct {
+	ID        string                 `json:"id"`
+	Type      string                 `json:"type"`
+	Source    string                 `json:"source"`
+	Score     float64                `json:"score"`
+	Content   string                 `json:"content"`
+	Metadata  map[string]interface{} `json:"metadata,omitempty"`
+	Embedding []float64              `json:"embedding,omitempty"`
+}
+
+/*
+Nearest answers a SearchQuery from the context's in-memory index, building it on first use.
+Results are approximate; only the winning vectors' content is read from Mongo.
+*/
+func (s *Service) Nearest(ctx context.Context, name *string, userID string, query SearchQuery) ([]Neighbor, error) {
+	if s.index == nil {
+		return nil, ErrIndexUnavailable
+	}
+	if norm(query.Embedding) == 0 {
+		return nil, fmt.Errorf("query embedding must be a non-zero vector")
+	}
+	topK := query.TopK
+	if topK <= 0 {
+		topK = defaultTopK
+	}
+	if topK > maxTopK {
+		topK = maxTopK
+	}
+
+	header, err := s.header(ctx, name, userID)
+	if err != nil {
+		return nil, err
+	}
+	s.touch(ctx, header)
+	idx, err := s.vectorIndex(ctx, header)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := StoreFilter{Types: query.Types, Sources: query.Sources}
+	hits := s.index.Search(idx, query.Embedding, topK, func(item vectorindex.Item) bool {
+		return filter.hasType(item.Type) && filter.hasSource(item.Source) && metadataMatches(item.Metadata, query.Metadata)
+	})
+
+	ids := make([]primitive.ObjectID, 0, len(hits))
+	for _, hit := range hits {
+		if query.MinScore != nil && hit.Score < *query.MinScore {
+			break
+		}
+		if id, err := primitive.ObjectIDFromHex(hit.ID); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return []Neighbor{}, nil
+	}
+
+	chunks := []models.LLMVectorChunk{}
+	if err := s.chunks.Find(ctx, bson.M{"_id": bson.M{"$in": ids}}).All(&chunks); err != nil {
+		return nil, err
+	}
+	byID := make(map[string]models.LLMVectorChunk, len(chunks))
+	for _, chunk := range chunks {
+		byID[chunk.ID.Hex()] = chunk
+	}
+
+	/* A hit whose chunk is gone was removed by a write this index has not seen yet */
+	neighbors := make([]Neighbor, 0, len(ids))
+	for _, hit := range hits[:len(ids)] {
+		chunk, ok := byID[hit.ID]
+		if !ok {
+			continue
+		}
+		neighbors = append(neighbors, Neighbor{
+			ID:        hit.ID,
+			Type:      hit.Type,
+			Source:    hit.Source,
+			Score:     hit.Score,
+			Content:   chunk.Content,
+			Metadata:  chunk.Metadata,
+			Embedding: chunk.Embedding,
+		})
+	}
+	return neighbors, nil
+}
+
+/* vectorIndex returns the context's resident index, building it on first use */
+func (s *Service) vectorIndex(ctx context.Context, header *models.LLMVector) (*vectorindex.Index, error) {
+	return s.index.Get(ctx, indexKey(header.UserID, header.Name), header.UpdatedAt, func(ctx context.Context) (time.Time, []vectorindex.Entry, error) {
+		if err := s.migrate(ctx, header); err != nil {
+			return time.Time{}, nil, err
+		}
+		chunks := []models.LLMVectorChunk{}
+		query := bson.M{"userId": header.UserID, "context": header.Name}
+		if err := s.chunks.Find(ctx, query).Select(bson.M{"content": 0}).All(&chunks); err != nil {
+			return time.Time{}, nil, err
+		}
+		return header.UpdatedAt, indexEntries(chunks), nil
+	})
+}
+
+/* indexKey names a context's index, keeping the unnamed context apart from one named "" */
+func indexKey(userID string, name *string) string {
+	if name == nil {
+		return userID + "#"
+	}
+	return userID + "/" + *name
+}
+
+func indexEntries(chunks []models.LLMVectorChunk) []vectorindex.Entry {
+	entries := make([]vectorindex.Entry, 0, len(chunks))
+	for _, chunk := range chunks {
+		entries = append(entries, vectorindex.Entry{
+			Item: vectorindex.Item{
+				ID:       chunk.ID.Hex(),
+				Type:     chunk.Type,
+				Source:   chunk.Source,
+				Metadata: chunk.Metadata,
+			},
+			Embedding: chunk.Embedding,
+		})
+	}
+	return entries
+}
@@ -0,0 +1,148 @@
+package llmvector
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"backend-v2/internal/models"
+)
+
+/* reembedBatch is how many vectors go to the embedder at a time */
+const reembedBatch = 32
+
+/* EmbedFunc embeds texts with one model; vectors come back in input order */
+type EmbedFunc func(ctx context.Context, texts []string) ([][]float64, error)
+
+/*
+Reembed moves a type to another model. New embeddings are staged beside the old ones, so
+searches keep working, and swapped in together at the end. Once the type records the new
+model, vectors appended with the old one are refused and any appended before that are staged
+too. Staged embeddings survive an interrupted run, which picks up where it stopped. progress
+hears how many vectors are staged of how many the type holds; the count is returned.
+*/
+func (s *Service) Reembed(ctx context.Context, name *string, userID, contextType, model string, embed EmbedFunc, progress func(done, total int)) (int, error) {
+	header, err := s.header(ctx, name, userID)
+	if err != nil {
+		return 0, err
+	}
+	if err := s.migrate(ctx, header); err != nil {
+		return 0, err
+	}
+
+	filter := bson.M{"userId": userID, "context": name, "type": contextType}
+	total, err := s.chunks.Find(ctx, filter).Count()
+	if err != nil {
+		return 0, err
+	}
+	if total == 0 {
+		return 0, fmt.Errorf("type %q has no vectors", contextType)
+	}
+	hollow, err := s.chunks.Find(ctx, bson.M{"userId": userID, "context": name, "type": contextType, "content": ""}).Count()
+	if err != nil {
+		return 0, err
+	}
+	if hollow > 0 {
+		return 0, fmt.Errorf("%d vectors of type %q have no content to embed again", hollow, contextType)
+	}
+
+	done, dimension := 0, 0
+	stage := func() error {
+		pending := bson.M{"userId": userID, "context": name, "type": contextType, "content": bson.M{"$ne": ""}, "reembed.model": bson.M{"$ne": model}}
+		for {
+			batch := []models.LLMVectorChunk{}
+			if err := s.chunks.Find(ctx, pending).Select(bson.M{"content": 1}).Sort("_id").Limit(reembedBatch).All(&batch); err != nil {
+				return err
+			}
+			if len(batch) == 0 {
+				return nil
+			}
+
+			texts := make([]string, len(batch))
+			for i, chunk := range batch {
+				texts[i] = chunk.Content
+			}
+			embeddings, err := embed(ctx, texts)
+			if err != nil {
+				return err
+			}
+			for i, chunk := range batch {
+				if dimension == 0 {
+					dimension = len(embeddings[i])
+				}
+				if len(embeddings[i]) == 0 || len(embeddings[i]) != dimension {
+					return fmt.Errorf("model %q returned a %d-dimension embedding among %d-dimension ones", model, len(embeddings[i]), dimension)
+				}
+				staged := bson.M{"reembed": bson.M{"model": model, "embedding": embeddings[i]}}
+				if err := s.chunks.UpdateOne(ctx, bson.M{"_id": chunk.ID}, bson.M{"$set": staged}); err != nil {
+					return err
+				}
+			}
+			done += len(batch)
+			progress(done, max(int(total), done))
+		}
+	}
+
+	err = s.reembed(ctx, header, contextType, model, stage, &dimension)
+	if err != nil && ctx.Err() == nil {
+		/* A run that failed outright is not retried, so its staged embeddings are dropped */
+		if _, cleanErr := s.chunks.UpdateAll(context.Background(), filter, bson.M{"$unset": bson.M{"reembed": ""}}); cleanErr != nil {
+			log.Warn("drop staged embeddings of context %s: %v", header.ID.Hex(), cleanErr)
+		}
+	}
+	return done, err
+}
+
+/* reembed stages the type, switches its spec to model, stages stragglers and swaps the embeddings in */
+func (s *Service) reembed(ctx context.Context, header *models.LLMVector, contextType, model string, stage func() error, dimension *int) error {
+	if err := stage(); err != nil {
+		return err
+	}
+	if *dimension == 0 {
+		/* Every vector was staged on an earlier run; read the dimension back */
+		var chunk struct {
+			Reembed struct {
+				Embedding []float64 `bson:"embedding"`
+			} `bson:"reembed"`
+		}
+		query := bson.M{"userId": header.UserID, "context": header.Name, "type": contextType, "reembed.model": model}
+		if err := s.chunks.Find(ctx, query).Select(bson.M{"reembed": 1}).One(&chunk); err != nil {
+			return err
+		}
+		*dimension = len(chunk.Reembed.Embedding)
+	}
+
+	previous, err := s.storedSpec(ctx, header, contextType)
+	if err != nil {
+		return err
+	}
+	if err := s.recordSpec(ctx, header, contextType, &models.EmbeddingSpec{Type: contextType, Model: model, Dimension: *dimension}); err != nil {
+		return err
+	}
+	if err := stage(); err != nil {
+		/* The old embeddings are still in place, so they keep their spec */
+		if restoreErr := s.recordSpec(context.Background(), header, contextType, previous); restoreErr != nil {
+			log.Warn("restore embedding spec of context %s: %v", header.ID.Hex(), restoreErr)
+		}
+		return err
+	}
+
+	swap := []bson.M{
+		{"$set": bson.M{"embedding": "$reembed.embedding", "model": "$reembed.model", "dimension": *dimension}},
+		{"$unset": "reembed"},
+	}
+	staged := bson.M{"userId": header.UserID, "context": header.Name, "type": contextType, "reembed.model": model}
+	if _, err := s.chunks.UpdateAll(ctx, staged, swap); err != nil {
+		return err
+	}
+
+	/* Every embedding of the type changed, so resident indexes are rebuilt rather than patched */
+	if err := s.contexts.UpdateOne(ctx, bson.M{"_id": header.ID}, bson.M{"$set": bson.M{"updatedAt": stamp()}}); err != nil {
+		return err
+	}
+	if s.index != nil {
+		s.index.Drop(indexKey(header.UserID, header.Name))
+	}
+	return nil
+}
@@ -1,20 +1,34 @@
 package llmvector
 
 import (
+	"context"
+
 	"github.com/gofiber/fiber/v2"
 	"github.com/qiniu/qmgo"
 
 	"backend-v2/internal/middlewares"
+	"backend-v2/internal/services/llmproxy"
+	"backend-v2/internal/services/vectorindex"
 )
 
-func RegisterRoutes(router fiber.Router, db *qmgo.Database) {
-	collection := db.Collection("llmvectors")
-	service := NewService(collection)
-	controller := NewController(service)
+func RegisterRoutes(router fiber.Router, db *qmgo.Database, embedder llmproxy.Embedder, index *vectorindex.Manager) {
+	service := NewService(db, index)
+	controller := NewController(service, embedder)
+
+	go service.Sweep(context.Background())
 
 	router.Post("/vector", middlewares.ExtractUserID, controller.Save)
 	router.Get("/vector", middlewares.ExtractUserID, controller.Get)
 	router.Get("/vector/all", middlewares.ExtractUserID, controller.GetAll)
 	router.Delete("/vector", middlewares.ExtractUserID, controller.Delete)
 	router.Get("/vector/overview", middlewares.ExtractUserID, controller.Overview)
+	router.Post("/vector/search", middlewares.ExtractUserID, controller.Search)
+	router.Post("/vector/nearest", middlewares.ExtractUserID, controller.Nearest)
+	router.Post("/vector/retrieve", middlewares.ExtractUserID, controller.Retrieve)
+	router.Get("/vector/export", middlewares.ExtractUserID, controller.Export)
+	router.Post("/vector/import", middlewares.ExtractUserID, controller.Import)
+	router.Get("/vector/share", middlewares.ExtractUserID, controller.GetShare)
+	router.Post("/vector/share", middlewares.ExtractUserID, controller.SetShare)
+	router.Get("/vector/retention", middlewares.ExtractUserID, controller.GetRetention)
+	router.Post("/vector/retention", middlewares.ExtractUserID, controller.SetRetention)
 }
@@ -0,0 +1,398 @@
+package llmvector
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/qiniu/qmgo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"backend-v2/internal/models"
+	"backend-v2/internal/services/vectorindex"
+)
+
+const (
+	/* sweepInterval is how often retention is enforced; every instance sweeps, and a sweep only removes what is due */
+	sweepInterval = 10 * time.Minute
+	/* touchEvery bounds how often reads move lastUsedAt, so reading a context rarely writes to it */
+	touchEvery = time.Minute
+)
+
+/* ErrInvalidRetention is returned by SetRetention for a policy it cannot store */
+var ErrInvalidRetention = errors.New("invalid retention policy")
+
+/* validateRetention accepts non-negative bounds and positive TTLs for distinct, named sources */
+func validateRetention(retention *models.VectorRetention) error {
+	if retention.TTL < 0 || retention.MaxVectors < 0 {
+		return ErrInvalidRetention
+	}
+	seen := make(map[models.VectorSource]bool, len(retention.Sources))
+	for _, rule := range retention.Sources {
+		if strings.TrimSpace(rule.Type) == "" || strings.TrimSpace(rule.Source) == "" || rule.TTL <= 0 {
+			return ErrInvalidRetention
+		}
+		pair := models.VectorSource{Type: rule.Type, Source: rule.Source}
+		if seen[pair] {
+			return ErrInvalidRetention
+		}
+		seen[pair] = true
+	}
+	return nil
+}
+
+/* lastUsed is when a user last read or wrote the context */
+func lastUsed(header *models.LLMVector) time.Time {
+	if header.LastUsedAt.After(header.UpdatedAt) {
+		return header.LastUsedAt
+	}
+	return header.UpdatedAt
+}
+
+/* idleExpired reports whether the context outlived its TTL unused */
+func idleExpired(header *models.LLMVector, now time.Time) bool {
+	if header.Retention == nil || header.Retention.TTL <= 0 {
+		return false
+	}
+	return lastUsed(header).Add(time.Duration(header.Retention.TTL) * time.Second).Before(now)
+}
+
+/* expiryCutoff is the smallest ObjectID of a vector written after now-ttl; smaller ones are due */
+func expiryCutoff(ttl int64, now time.Time) primitive.ObjectID {
+	return primitive.NewObjectIDFromTimestamp(now.Add(-time.Duration(ttl) * time.Second))
+}
+
+/* GetRetention returns the retention policy of one of the owner's contexts */
+func (s *Service) GetRetention(ctx context.Context, name *string, owner string) (*models.VectorRetention, error) {
+	header, err := s.header(ctx, name, owner)
+	if err != nil {
+		return nil, err
+	}
+	if header.Retention == nil {
+		return &models.VectorRetention{}, nil
+	}
+	return header.Retention, nil
+}
+
+/*
+SetRetention replaces the retention policy of one of the owner's contexts and enforces it
+at once; an empty policy keeps the context indefinitely. Setting it counts as using it.
+*/
+func (s *Service) SetRetention(ctx context.Context, name *string, owner string, retention *models.VectorRetention) error {
+	if err := validateRetention(retention); err != nil {
+		return err
+	}
+
+	update := bson.M{"$set": bson.M{"retention": retention, "lastUsedAt": stamp()}}
+	if retention.TTL == 0 && retention.MaxVectors == 0 && len(retention.Sources) == 0 {
+		update = bson.M{"$set": bson.M{"lastUsedAt": stamp()}, "$unset": bson.M{"retention": ""}}
+	}
+	if err := s.contexts.UpdateOne(ctx, bson.M{"userId": owner, "name": name}, update); err != nil {
+		return err
+	}
+
+	header, err := s.header(ctx, name, owner)
+	if err != nil {
+		return err
+	}
+	return s.enforce(ctx, header, time.Now())
+}
+
+/* touch records a read, at most once per touchEvery */
+func (s *Service) touch(ctx context.Context, header *models.LLMVector) {
+	now := stamp()
+	if now.Sub(header.LastUsedAt) < touchEvery {
+		return
+	}
+	filter := bson.M{"_id": header.ID, "$or": []bson.M{
+		{"lastUsedAt": bson.M{"$exists": false}},
+		{"lastUsedAt": bson.M{"$lt": now.Add(-touchEvery)}},
+	}}
+	err := s.contexts.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"lastUsedAt": now}})
+	if err != nil && !errors.Is(err, qmgo.ErrNoSuchDocuments) {
+		log.Warn("record use of context %s: %v", header.ID.Hex(), err)
+	}
+}
+
+/* Sweep enforces every context's retention policy until ctx is cancelled */
+func (s *Service) Sweep(ctx context.Context) {
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+
+	for {
+		s.sweep(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Service) sweep(ctx context.Context) {
+	filter := bson.M{"$or": []bson.M{
+		{"retention.ttl": bson.M{"$gt": 0}},
+		{"retention.maxVectors": bson.M{"$gt": 0}},
+		{"retention.sources.0": bson.M{"$exists": true}},
+	}}
+	cursor := s.contexts.Find(ctx, filter).Cursor()
+	defer cursor.Close()
+
+	for {
+		var header models.LLMVector
+		if !cursor.Next(&header) {
+			break
+		}
+		if err := s.enforce(ctx, &header, time.Now()); err != nil {
+			log.Warn("enforce retention of context %s: %v", header.ID.Hex(), err)
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		log.Error("sweep contexts: %v", err)
+	}
+}
+
+/*
+enforce applies a context's retention: an idle context is removed whole; otherwise vectors
+past their source's TTL go, then the oldest vectors past the cap. Sources left empty are
+dropped from the layout, and types left without sources with them.
+*/
+func (s *Service) enforce(ctx context.Context, header *models.LLMVector, now time.Time) error {
+	retention := header.Retention
+	if retention == nil {
+		return nil
+	}
+	if idleExpired(header, now) {
+		log.Info("removing context %s of user %s, unused since %s", header.ID.Hex(), header.UserID, lastUsed(header).Format(time.RFC3339))
+		return s.DeleteContext(ctx, header.Name, header.UserID, nil, nil)
+	}
+	if err := s.migrate(ctx, header); err != nil {
+		return err
+	}
+
+	var removed []func(vectorindex.Item) bool
+	touched := make(map[models.VectorSource]bool)
+	chunkFilter := func() bson.M { return bson.M{"userId": header.UserID, "context": header.Name} }
+
+	for _, rule := range retention.Sources {
+		rule := rule
+		cutoff := expiryCutoff(rule.TTL, now)
+		filter := chunkFilter()
+		filter["type"], filter["source"], filter["_id"] = rule.Type, rule.Source, bson.M{"$lt": cutoff}
+		result, err := s.chunks.RemoveAll(ctx, filter)
+		if err != nil {
+			return err
+		}
+		if result.DeletedCount == 0 {
+			continue
+		}
+		touched[models.VectorSource{Type: rule.Type, Source: rule.Source}] = true
+		removed = append(removed, func(item vectorindex.Item) bool {
+			return item.Type == rule.Type && item.Source == rule.Source && item.ID < cutoff.Hex()
+		})
+	}
+
+	if retention.MaxVectors > 0 {
+		count, err := s.chunks.Find(ctx, chunkFilter()).Count()
+		if err != nil {
+			return err
+		}
+		if excess := count - retention.MaxVectors; excess > 0 {
+			oldest := []models.LLMVectorChunk{}
+			err := s.chunks.Find(ctx, chunkFilter()).Sort("_id").Select(bson.M{"type": 1, "source": 1}).Limit(excess).All(&oldest)
+			if err != nil {
+				return err
+			}
+			if len(oldest) > 0 {
+				last := oldest[len(oldest)-1].ID
+				filter := chunkFilter()
+				filter["_id"] = bson.M{"$lte": last}
+				if _, err := s.chunks.RemoveAll(ctx, filter); err != nil {
+					return err
+				}
+				for _, chunk := range oldest {
+					touched[models.VectorSource{Type: chunk.Type, Source: chunk.Source}] = true
+				}
+				removed = append(removed, func(item vectorindex.Item) bool { return item.ID <= last.Hex() })
+				log.Info("evicted %d vectors of context %s of user %s past its cap of %d", len(oldest), header.ID.Hex(), header.UserID, retention.MaxVectors)
+			}
+		}
+	}
+
+	if len(removed) == 0 {
+		return nil
+	}
+	if err := s.pruneLayout(ctx, header, touched); err != nil {
+		return err
+	}
+	stamped := stamp()
+	if err := s.contexts.UpdateOne(ctx, bson.M{"_id": header.ID}, bson.M{"$set": bson.M{"updatedAt": stamped}}); err != nil {
+		return err
+	}
+	s.reindex(header.UserID, header.Name, header.UpdatedAt, stamped, func(idx *vectorindex.Index) {
+		idx.Remove(func(item vectorindex.Item) bool {
+			for _, gone := range removed {
+				if gone(item) {
+					return true
+				}
+			}
+			return false
+		})
+	})
+	header.UpdatedAt = stamped
+	return nil
+}
+
+/* pruneLayout drops the sources among candidates that hold no vectors, then the types left without sources */
+func (s *Service) pruneLayout(ctx context.Context, header *models.LLMVector, candidates map[models.VectorSource]bool) error {
+	filter := bson.M{"_id": header.ID}
+	types := make(map[string]bool)
+	for pair := range candidates {
+		count, err := s.chunks.Find(ctx, bson.M{"userId": header.UserID, "context": header.Name, "type": pair.Type, "source": pair.Source}).Count()
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			continue
+		}
+		if err := s.contexts.UpdateOne(ctx, filter, bson.M{"$pull": bson.M{"sources": pair}}); err != nil {
+			return err
+		}
+		types[pair.Type] = true
+	}
+	for contextType := range types {
+		emptyType := bson.M{"_id": header.ID, "sources.type": bson.M{"$ne": contextType}}
+		err := s.contexts.UpdateOne(ctx, emptyType, bson.M{"$pull": bson.M{"types": contextType, "embeddings": bson.M{"type": contextType}}})
+		if err != nil && !errors.Is(err, qmgo.ErrNoSuchDocuments) {
+			return err
+		}
+	}
+	return nil
+}
+
+/* ContextStats is one context's layout with what it stores and when it was last used */
+type ContextStats struct {
+	Types      map[string][]string     `json:"types"`
+	Vectors    int64                   `json:"vectors"`
+	Bytes      int64                   `json:"bytes"`
+	CreatedAt  time.Time               `json:"createdAt"`
+	UpdatedAt  time.Time               `json:"updatedAt"`
+	LastUsedAt time.Time               `json:"lastUsedAt"`
+	Retention  *models.VectorRetention `json:"retention,omitempty"`
+}
+
+/* GetStats is GetOverview with each context's vector count, stored bytes and last use */
+func (s *Service) GetStats(ctx context.Context, userID string, filterType *string) (map[string]ContextStats, error) {
+	contexts := []models.LLMVector{}
+	if err := s.contexts.Find(ctx, bson.M{"userId": userID}).All(&contexts); err != nil {
+		return nil, err
+	}
+	totals, err := s.totals(ctx, bson.M{"userId": userID}, filterType)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := make(map[string]ContextStats, len(contexts))
+	for i, context := range contexts {
+		name := ""
+		if context.Name != nil {
+			name = *context.Name
+		}
+		stats[name] = statsOf(&contexts[i], totals, filterType)
+	}
+	return stats, nil
+}
+
+/* GetSharedStats is GetSharedOverview with each context's vector count, stored bytes and last use */
+func (s *Service) GetSharedStats(ctx context.Context, subject Subject, filterType *string) (map[string]ContextStats, error) {
+	contexts := []models.LLMVector{}
+	if err := s.contexts.Find(ctx, sharedFilter(subject)).All(&contexts); err != nil {
+		return nil, err
+	}
+	stats := make(map[string]ContextStats, len(contexts))
+	if len(contexts) == 0 {
+		return stats, nil
+	}
+
+	owned := make([]bson.M, len(contexts))
+	for i, context := range contexts {
+		owned[i] = bson.M{"userId": context.UserID, "context": context.Name}
+	}
+	totals, err := s.totals(ctx, bson.M{"$or": owned}, filterType)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, context := range contexts {
+		name := ""
+		if context.Name != nil {
+			name = *context.Name
+		}
+		stats[context.UserID+"/"+name] = statsOf(&contexts[i], totals, filterType)
+	}
+	return stats, nil
+}
+
+/* chunkTotals is the vector count and BSON size of one context's chunks */
+type chunkTotals struct {
+	Vectors int64
+	Bytes   int64
+}
+
+/* totals sums the chunks match selects per context, keyed like the vector index */
+func (s *Service) totals(ctx context.Context, match bson.M, filterType *string) (map[string]chunkTotals, error) {
+	if filterType != nil {
+		match["type"] = *filterType
+	}
+	pipeline := []bson.M{
+		{"$match": match},
+		{"$group": bson.M{
+			"_id":     bson.M{"userId": "$userId", "context": "$context"},
+			"vectors": bson.M{"$sum": 1},
+			"bytes":   bson.M{"$sum": bson.M{"$bsonSize": "$$ROOT"}},
+		}},
+	}
+
+	var rows []struct {
+		ID struct {
+			UserID  string  `bson:"userId"`
+			Context *string `bson:"context"`
+		} `bson:"_id"`
+		Vectors int64 `bson:"vectors"`
+		Bytes   int64 `bson:"bytes"`
+	}
+	if err := s.chunks.Aggregate(ctx, pipeline).All(&rows); err != nil {
+		return nil, err
+	}
+
+	totals := make(map[string]chunkTotals, len(rows))
+	for _, row := range rows {
+		totals[indexKey(row.ID.UserID, row.ID.Context)] = chunkTotals{Vectors: row.Vectors, Bytes: row.Bytes}
+	}
+	return totals, nil
+}
+
+/* statsOf combines a header with its chunk totals; vectors not yet migrated out of the header are counted, not sized */
+func statsOf(header *models.LLMVector, totals map[string]chunkTotals, filterType *string) ContextStats {
+	total := totals[indexKey(header.UserID, header.Name)]
+	for contextType, sources := range header.Store {
+		if filterType != nil && contextType != *filterType {
+			continue
+		}
+		for _, vectors := range sources {
+			total.Vectors += int64(len(vectors))
+		}
+	}
+	return ContextStats{
+		Types:      overviewOf(header, filterType),
+		Vectors:    total.Vectors,
+		Bytes:      total.Bytes,
+		CreatedAt:  header.CreatedAt,
+		UpdatedAt:  header.UpdatedAt,
+		LastUsedAt: lastUsed(header),
+		Retention:  header.Retention,
+	}
+}
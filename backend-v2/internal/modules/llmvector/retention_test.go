@@ -0,0 +1,102 @@
+package llmvector
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"backend-v2/internal/models"
+)
+
+func TestValidateRetention(t *testing.T) {
+	valid := []models.VectorRetention{
+		{},
+		{TTL: 3600, MaxVectors: 1000},
+		{Sources: []models.SourceRetention{{Type: "notes", Source: "news", TTL: 60}, {Type: "notes", Source: "mail", TTL: 60}}},
+	}
+	for _, retention := range valid {
+		if err := validateRetention(&retention); err != nil {
+			t.Errorf("validateRetention(%+v) = %v", retention, err)
+		}
+	}
+
+	invalid := []models.VectorRetention{
+		{TTL: -1},
+		{MaxVectors: -5},
+		{Sources: []models.SourceRetention{{Type: "notes", Source: "news"}}},
+		{Sources: []models.SourceRetention{{Type: " ", Source: "news", TTL: 60}}},
+		{Sources: []models.SourceRetention{{Type: "notes", Source: "news", TTL: 60}, {Type: "notes", Source: "news", TTL: 120}}},
+	}
+	for _, retention := range invalid {
+		if err := validateRetention(&retention); !errors.Is(err, ErrInvalidRetention) {
+			t.Errorf("validateRetention(%+v) = %v, want ErrInvalidRetention", retention, err)
+		}
+	}
+}
+
+func TestIdleExpired(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	header := &models.LLMVector{
+		UpdatedAt: now.Add(-3 * time.Hour),
+		Retention: &models.VectorRetention{TTL: int64((2 * time.Hour).Seconds())},
+	}
+	if !idleExpired(header, now) {
+		t.Errorf("context written 3h ago with a 2h TTL did not expire")
+	}
+
+	header.LastUsedAt = now.Add(-time.Hour)
+	if idleExpired(header, now) || !lastUsed(header).Equal(header.LastUsedAt) {
+		t.Errorf("context read 1h ago expired, or its read was not its last use")
+	}
+
+	header.Retention.TTL = 0
+	header.LastUsedAt = time.Time{}
+	if idleExpired(header, now) {
+		t.Errorf("context without a TTL expired")
+	}
+	if idleExpired(&models.LLMVector{}, now) {
+		t.Errorf("context without retention expired")
+	}
+}
+
+func TestExpiryCutoff_OrdersWithChunkIDs(t *testing.T) {
+	now := time.Now()
+	cutoff := expiryCutoff(60, now)
+	old := primitive.NewObjectIDFromTimestamp(now.Add(-2 * time.Minute))
+	fresh := primitive.NewObjectID()
+
+	if !(old.Hex() < cutoff.Hex()) || !(cutoff.Hex() < fresh.Hex()) {
+		t.Errorf("cutoff %s does not fall between %s and %s", cutoff.Hex(), old.Hex(), fresh.Hex())
+	}
+}
+
+func TestStatsOf(t *testing.T) {
+	name := "board"
+	used := time.Unix(100, 0)
+	header := &models.LLMVector{
+		UserID:     "u",
+		Name:       &name,
+		Types:      []string{"notes", "mail"},
+		Sources:    []models.VectorSource{{Type: "notes", Source: "a"}, {Type: "mail", Source: "inbox"}},
+		Store:      map[string]map[string][]models.MemoryVector{"notes": {"legacy": {{Content: "x"}, {Content: "y"}}}},
+		UpdatedAt:  time.Unix(50, 0),
+		LastUsedAt: used,
+		Retention:  &models.VectorRetention{MaxVectors: 10},
+	}
+	totals := map[string]chunkTotals{indexKey("u", &name): {Vectors: 3, Bytes: 900}}
+
+	stats := statsOf(header, totals, nil)
+	if stats.Vectors != 5 || stats.Bytes != 900 || !stats.LastUsedAt.Equal(used) || stats.Retention.MaxVectors != 10 {
+		t.Errorf("statsOf() = %+v, want chunk and unmigrated vectors counted", stats)
+	}
+	if len(stats.Types) != 2 || len(stats.Types["notes"]) != 2 {
+		t.Errorf("statsOf().Types = %v, want the overview layout", stats.Types)
+	}
+
+	mail := "mail"
+	if filtered := statsOf(header, totals, &mail); filtered.Vectors != 3 || len(filtered.Types) != 1 {
+		t.Errorf("statsOf(mail) = %+v, want the other type's unmigrated vectors left out", filtered)
+	}
+}
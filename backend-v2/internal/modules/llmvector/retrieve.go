@@ -0,0 +1,282 @@
+package llmvector
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"backend-v2/internal/models"
+	"backend-v2/internal/services/vectorindex"
+)
+
+/* RetrievalMode picks which rankings Retrieve consults */
+type RetrievalMode string
+
+const (
+	RetrieveHybrid  RetrievalMode = "hybrid"
+	RetrieveVector  RetrievalMode = "vector"
+	RetrieveLexical RetrievalMode = "lexical"
+)
+
+/* rrfK damps the lead of top ranks in reciprocal rank fusion; 60 is the customary value */
+const rrfK = 60
+
+/* Weights scale each ranking's share of the fused score */
+type Weights struct {
+	Vector  float64 `json:"vector"`
+	Lexical float64 `json:"lexical"`
+}
+
+/*
+RetrieveQuery is a SearchQuery that may also rank by keywords. Text feeds the lexical ranking;
+Embedding the vector one. MinScore applies to cosine similarity only.
+*/
+type RetrieveQuery struct {
+	SearchQuery
+	Text    string
+	Mode    RetrievalMode
+	Weights Weights
+}
+
+/* Retrieved is one result with its place in each ranking; ranks start at 1 and 0 means unranked */
+type Retrieved struct {
+	Neighbor
+	VectorRank   int     `json:"vectorRank,omitempty"`
+	VectorScore  float64 `json:"vectorScore,omitempty"`
+	LexicalRank  int     `json:"lexicalRank,omitempty"`
+	LexicalScore float64 `json:"lexicalScore,omitempty"`
+}
+
+/*
+Retrieve ranks a context's vectors by embedding similarity, BM25 keyword relevance or both.
+Hybrid mode merges the two rankings by weighted reciprocal rank fusion, so vectors saved
+without embeddings are still found by their words. Score is the fused score in hybrid mode
+and the ranking's own score otherwise.
+*/
+func (s *Service) Retrieve(ctx context.Context, name *string, userID string, query RetrieveQuery) ([]Retrieved, error) {
+	topK := query.TopK
+	if topK <= 0 {
+		topK = defaultTopK
+	}
+	if topK > maxTopK {
+		topK = maxTopK
+	}
+	/* Each ranking contributes more candidates than asked, so fusion can promote what one of them ranks lower */
+	candidates := min(max(topK*4, 50), 4*maxTopK)
+
+	header, err := s.header(ctx, name, userID)
+	if err != nil {
+		return nil, err
+	}
+	s.touch(ctx, header)
+	filter := StoreFilter{Types: query.Types, Sources: query.Sources}
+	accept := func(item vectorindex.Item) bool {
+		return filter.hasType(item.Type) && filter.hasSource(item.Source) && metadataMatches(item.Metadata, query.Metadata)
+	}
+
+	var vectorHits, lexicalHits []vectorindex.Hit
+	weights := query.Weights
+	switch query.Mode {
+	case RetrieveVector:
+		weights = Weights{Vector: 1}
+	case RetrieveLexical:
+		weights = Weights{Lexical: 1}
+	}
+
+	if weights.Vector > 0 {
+		if norm(query.Embedding) == 0 {
+			return nil, fmt.Errorf("query embedding must be a non-zero vector")
+		}
+		if vectorHits, err = s.vectorHits(ctx, header, query.Embedding, candidates, accept); err != nil {
+			return nil, err
+		}
+		if query.MinScore != nil {
+			kept := vectorHits[:0]
+			for _, hit := range vectorHits {
+				if hit.Score >= *query.MinScore {
+					kept = append(kept, hit)
+				}
+			}
+			vectorHits = kept
+		}
+	}
+	if weights.Lexical > 0 {
+		if lexicalHits, err = s.lexicalHits(ctx, header, query.Text, candidates, accept); err != nil {
+			return nil, err
+		}
+	}
+
+	ranked := fuse(vectorHits, lexicalHits, weights)
+	if len(ranked) > topK {
+		ranked = ranked[:topK]
+	}
+	switch query.Mode {
+	case RetrieveVector:
+		for i := range ranked {
+			ranked[i].Score = ranked[i].VectorScore
+		}
+	case RetrieveLexical:
+		for i := range ranked {
+			ranked[i].Score = ranked[i].LexicalScore
+		}
+	}
+	return s.withContent(ctx, ranked)
+}
+
+/* vectorHits ranks by cosine similarity, from the resident index when enabled and exactly otherwise */
+func (s *Service) vectorHits(ctx context.Context, header *models.LLMVector, embedding []float64, k int, accept func(vectorindex.Item) bool) ([]vectorindex.Hit, error) {
+	if s.index != nil {
+		idx, err := s.vectorIndex(ctx, header)
+		if err != nil {
+			return nil, err
+		}
+		return s.index.Search(idx, embedding, k, accept), nil
+	}
+
+	if err := s.migrate(ctx, header); err != nil {
+		return nil, err
+	}
+	chunks := []models.LLMVectorChunk{}
+	query := bson.M{"userId": header.UserID, "context": header.Name, "embedding.0": bson.M{"$exists": true}}
+	if err := s.chunks.Find(ctx, query).Select(bson.M{"content": 0}).Sort("_id").All(&chunks); err != nil {
+		return nil, err
+	}
+	return exactHits(chunks, embedding, k, accept), nil
+}
+
+/* lexicalHits ranks by BM25 over the context's lexical index, building it on first use */
+func (s *Service) lexicalHits(ctx context.Context, header *models.LLMVector, text string, k int, accept func(vectorindex.Item) bool) ([]vectorindex.Hit, error) {
+	terms := tokenize(text)
+	if len(terms) == 0 {
+		return nil, nil
+	}
+	idx, err := s.lexical.get(ctx, indexKey(header.UserID, header.Name), header.UpdatedAt, func(ctx context.Context) ([]models.LLMVectorChunk, error) {
+		if err := s.migrate(ctx, header); err != nil {
+			return nil, err
+		}
+		chunks := []models.LLMVectorChunk{}
+		query := bson.M{"userId": header.UserID, "context": header.Name}
+		err := s.chunks.Find(ctx, query).Select(bson.M{"embedding": 0}).Sort("_id").All(&chunks)
+		return chunks, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return idx.search(terms, k, accept), nil
+}
+
+/* withContent reads the ranked vectors back, dropping any a concurrent write removed */
+func (s *Service) withContent(ctx context.Context, ranked []Retrieved) ([]Retrieved, error) {
+	if len(ranked) == 0 {
+		return []Retrieved{}, nil
+	}
+	ids := make([]primitive.ObjectID, 0, len(ranked))
+	for _, result := range ranked {
+		if id, err := primitive.ObjectIDFromHex(result.ID); err == nil {
+			ids = append(ids, id)
+		}
+	}
+
+	chunks := []models.LLMVectorChunk{}
+	if err := s.chunks.Find(ctx, bson.M{"_id": bson.M{"$in": ids}}).All(&chunks); err != nil {
+		return nil, err
+	}
+	byID := make(map[string]models.LLMVectorChunk, len(chunks))
+	for _, chunk := range chunks {
+		byID[chunk.ID.Hex()] = chunk
+	}
+
+	results := make([]Retrieved, 0, len(ranked))
+	for _, result := range ranked {
+		chunk, ok := byID[result.ID]
+		if !ok {
+			continue
+		}
+		result.Content = chunk.Content
+		result.Metadata = chunk.Metadata
+		result.Embedding = chunk.Embedding
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+/* exactHits scores every accepted chunk of the query's dimension; ties keep chunk order */
+func exactHits(chunks []models.LLMVectorChunk, embedding []float64, k int, accept func(vectorindex.Item) bool) []vectorindex.Hit {
+	queryNorm := norm(embedding)
+	hits := []vectorindex.Hit{}
+	for _, chunk := range chunks {
+		if len(chunk.Embedding) != len(embedding) {
+			continue
+		}
+		item := vectorindex.Item{ID: chunk.ID.Hex(), Type: chunk.Type, Source: chunk.Source, Metadata: chunk.Metadata}
+		if !accept(item) {
+			continue
+		}
+		chunkNorm := norm(chunk.Embedding)
+		if chunkNorm == 0 {
+			continue
+		}
+		hits = append(hits, vectorindex.Hit{Item: item, Score: dot(embedding, chunk.Embedding) / (queryNorm * chunkNorm)})
+	}
+	sort.SliceStable(hits, func(i, j int) bool { return hits[i].Score > hits[j].Score })
+	if len(hits) > k {
+		hits = hits[:k]
+	}
+	return hits
+}
+
+/*
+fuse merges two rankings by weighted reciprocal rank fusion: each list adds weight/(rrfK+rank).
+Ties go to the better single rank, then to the vector ranking's order.
+*/
+func fuse(vector, lexical []vectorindex.Hit, weights Weights) []Retrieved {
+	byID := make(map[string]*Retrieved)
+	order := []string{}
+	entry := func(hit vectorindex.Hit) *Retrieved {
+		if result, ok := byID[hit.ID]; ok {
+			return result
+		}
+		result := &Retrieved{Neighbor: Neighbor{ID: hit.ID, Type: hit.Type, Source: hit.Source}}
+		byID[hit.ID] = result
+		order = append(order, hit.ID)
+		return result
+	}
+
+	for i, hit := range vector {
+		result := entry(hit)
+		result.VectorRank = i + 1
+		result.VectorScore = hit.Score
+		result.Score += weights.Vector / float64(rrfK+i+1)
+	}
+	for i, hit := range lexical {
+		result := entry(hit)
+		result.LexicalRank = i + 1
+		result.LexicalScore = hit.Score
+		result.Score += weights.Lexical / float64(rrfK+i+1)
+	}
+
+	fused := make([]Retrieved, len(order))
+	for i, id := range order {
+		fused[i] = *byID[id]
+	}
+	sort.SliceStable(fused, func(i, j int) bool {
+		if fused[i].Score != fused[j].Score {
+			return fused[i].Score > fused[j].Score
+		}
+		return bestRank(fused[i]) < bestRank(fused[j])
+	})
+	return fused
+}
+
+func bestRank(result Retrieved) int {
+	switch {
+	case result.VectorRank == 0:
+		return result.LexicalRank
+	case result.LexicalRank == 0:
+		return result.VectorRank
+	}
+	return min(result.VectorRank, result.LexicalRank)
+}
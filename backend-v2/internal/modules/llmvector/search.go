@@ -0,0 +1,184 @@
+package llmvector
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"backend-v2/internal/models"
+)
+
+const (
+	defaultTopK = 10
+	maxTopK     = 100
+)
+
+/* SearchQuery selects and ranks the vectors of one context */
+type SearchQuery struct {
+	Embedding []float64
+	/* Types and Sources narrow the store; empty means all */
+	Types   []string
+	Sources []string
+	/* Metadata keeps vectors whose metadata equals every value; an array value matches any of its elements */
+	Metadata map[string]interface{}
+	TopK     int
+	/* MinScore drops weaker matches when set; nil keeps every score, negative ones included */
+	MinScore *float64
+}
+
+/* SearchResult is one ranked vector and where it lives in store[type][source][index] */
+type SearchResult struct {
+	Type      string                 `json:"type"`
+	Source    string                 `json:"source"`
+	Index     int                    `json:"index"`
+	Score     float64                `json:"score"`
+	Content   string                 `json:"content"`
+	Metadata  map[string]interface{} `json:"metadata,omitempty"`
+	Embedding []float64              `json:"embedding,omitempty"`
+}
+
+/*
+Search ranks the store's vectors by cosine similarity to the query embedding. Vectors without
+an embedding of the query's dimension are skipped; ties keep store order.
+*/
+func Search(store map[string]map[string][]models.MemoryVector, query SearchQuery) ([]SearchResult, error) {
+	queryNorm := norm(query.Embedding)
+	if queryNorm == 0 {
+		return nil, fmt.Errorf("query embedding must be a non-zero vector")
+	}
+
+	topK := query.TopK
+	if topK <= 0 {
+		topK = defaultTopK
+	}
+	if topK > maxTopK {
+		topK = maxTopK
+	}
+
+	results := []SearchResult{}
+	for _, contextType := range sortedKeys(store, query.Types) {
+		for _, source := range sortedKeys(store[contextType], query.Sources) {
+			for index, vector := range store[contextType][source] {
+				if len(vector.Embedding) != len(query.Embedding) || !metadataMatches(vector.Metadata, query.Metadata) {
+					continue
+				}
+				vectorNorm := norm(vector.Embedding)
+				if vectorNorm == 0 {
+					continue
+				}
+
+				score := dot(query.Embedding, vector.Embedding) / (queryNorm * vectorNorm)
+				if query.MinScore != nil && score < *query.MinScore {
+					continue
+				}
+				results = append(results, SearchResult{
+					Type:      contextType,
+					Source:    source,
+					Index:     index,
+					Score:     score,
+					Content:   vector.Content,
+					Metadata:  vector.Metadata,
+					Embedding: vector.Embedding,
+				})
+			}
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Score > results[j].Score })
+	if len(results) > topK {
+		results = results[:topK]
+	}
+	return results, nil
+}
+
+/* sortedKeys lists the map's keys in stable order, restricted to only when it is not empty */
+func sortedKeys[V any](m map[string]V, only []string) []string {
+	keys := make([]string, 0, len(m))
+	if len(only) > 0 {
+		for _, key := range only {
+			if _, ok := m[key]; ok {
+				keys = append(keys, key)
+			}
+		}
+	} else {
+		for key := range m {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func dot(a, b []float64) float64 {
+	var sum float64
+	for i := range a {
+		sum += a[i] * b[i]
+	}
+	return sum
+}
+
+func norm(v []float64) float64 {
+	return math.Sqrt(dot(v, v))
+}
+
+func metadataMatches(metadata, filters map[string]interface{}) bool {
+	for key, want := range filters {
+		got, ok := metadata[key]
+		if !ok {
+			return false
+		}
+		if options, isList := want.([]interface{}); isList {
+			if !containsValue(options, got) {
+				return false
+			}
+			continue
+		}
+		if !sameValue(got, want) {
+			return false
+		}
+	}
+	return true
+}
+
+func containsValue(options []interface{}, value interface{}) bool {
+	for _, option := range options {
+		if sameValue(value, option) {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+sameValue compares metadata scalars; Mongo decodes numbers as int32/int64/float64 while filters
+arrive as float64. Nested objects and arrays never match.
+*/
+func sameValue(a, b interface{}) bool {
+	if x, ok := toFloat(a); ok {
+		y, ok := toFloat(b)
+		return ok && x == y
+	}
+	switch x := a.(type) {
+	case string:
+		y, ok := b.(string)
+		return ok && x == y
+	case bool:
+		y, ok := b.(bool)
+		return ok && x == y
+	}
+	return false
+}
+
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
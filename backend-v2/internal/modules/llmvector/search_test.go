@@ -0,0 +1,99 @@
+package llmvector
+
+import (
+	"math"
+	"testing"
+
+	"backend-v2/internal/models"
+)
+
+func testStore() map[string]map[string][]models.MemoryVector {
+	return map[string]map[string][]models.MemoryVector{
+		"notes": {
+			"board-1": {
+				{Content: "same direction", Embedding: []float64{2, 0}, Metadata: map[string]interface{}{"lang": "en", "page": int32(1)}},
+				{Content: "diagonal", Embedding: []float64{1, 1}, Metadata: map[string]interface{}{"lang": "de", "page": int32(2)}},
+				{Content: "opposite", Embedding: []float64{-1, 0}, Metadata: map[string]interface{}{"lang": "en"}},
+			},
+			"board-2": {
+				{Content: "wrong dimension", Embedding: []float64{1, 0, 0}},
+				{Content: "text only"},
+			},
+		},
+		"files": {
+			"doc": {{Content: "orthogonal", Embedding: []float64{0, 3}, Metadata: map[string]interface{}{"lang": "en"}}},
+		},
+	}
+}
+
+func contents(results []SearchResult) []string {
+	var out []string
+	for _, result := range results {
+		out = append(out, result.Content)
+	}
+	return out
+}
+
+func TestSearch_RanksByCosineSimilarity(t *testing.T) {
+	results, err := Search(testStore(), SearchQuery{Embedding: []float64{1, 0}})
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+
+	want := []string{"same direction", "diagonal", "orthogonal", "opposite"}
+	if got := contents(results); len(got) != len(want) {
+		t.Fatalf("results = %v, want %v", got, want)
+	}
+	for i, result := range results {
+		if result.Content != want[i] {
+			t.Errorf("result %d = %q, want %q", i, result.Content, want[i])
+		}
+	}
+	if results[0].Score != 1 || math.Abs(results[1].Score-math.Sqrt2/2) > 1e-9 {
+		t.Errorf("scores = %v, %v", results[0].Score, results[1].Score)
+	}
+	if results[1].Type != "notes" || results[1].Source != "board-1" || results[1].Index != 1 {
+		t.Errorf("location = %s/%s/%d", results[1].Type, results[1].Source, results[1].Index)
+	}
+}
+
+func TestSearch_Filters(t *testing.T) {
+	minScore := 0.5
+	cases := []struct {
+		name  string
+		query SearchQuery
+		want  []string
+	}{
+		{"type", SearchQuery{Types: []string{"files"}}, []string{"orthogonal"}},
+		{"source", SearchQuery{Sources: []string{"board-1"}, TopK: 1}, []string{"same direction"}},
+		{"metadata string", SearchQuery{Metadata: map[string]interface{}{"lang": "de"}}, []string{"diagonal"}},
+		{"metadata number from Mongo", SearchQuery{Metadata: map[string]interface{}{"page": 1.0}}, []string{"same direction"}},
+		{"metadata any of", SearchQuery{Metadata: map[string]interface{}{"page": []interface{}{2.0, 3.0}}}, []string{"diagonal"}},
+		{"min score", SearchQuery{MinScore: &minScore}, []string{"same direction", "diagonal"}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.query.Embedding = []float64{1, 0}
+			results, err := Search(testStore(), tc.query)
+			if err != nil {
+				t.Fatalf("Search() error = %v", err)
+			}
+			got := contents(results)
+			if len(got) != len(tc.want) {
+				t.Fatalf("results = %v, want %v", got, tc.want)
+			}
+			for i := range got {
+				if got[i] != tc.want[i] {
+					t.Errorf("results = %v, want %v", got, tc.want)
+				}
+			}
+		})
+	}
+}
+
+func TestSearch_RejectsZeroQuery(t *testing.T) {
+	if _, err := Search(testStore(), SearchQuery{Embedding: []float64{0, 0}}); err == nil {
+		t.Error("zero query vector should be rejected")
+	}
+}
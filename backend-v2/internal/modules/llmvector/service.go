@@ -2,146 +2,292 @@ package llmvector
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"github.com/qiniu/qmgo"
+	"github.com/qiniu/qmgo/options"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 
+	"backend-v2/internal/common/logger"
 	"backend-v2/internal/models"
+	"backend-v2/internal/services/vectorindex"
 )
 
+var log = logger.New("LLMVECTOR")
+
+const (
+	contextsCollection = "llmvectors"
+	chunksCollection   = "llmvectorchunks"
+)
+
+/*
+Service keeps one header document per context and one document per vector, so writes touch
+only the vectors they add or remove and a context is not bounded by Mongo's document size.
+*/
 type Service struct {
-	collection *qmgo.Collection
+	contexts *qmgo.Collection
+	chunks   *qmgo.Collection
+	/* users resolves the mail address that mail grants are matched against */
+	users *qmgo.Collection
+	/* index serves nearest-neighbour queries; nil leaves them unavailable */
+	index *vectorindex.Manager
+	/* lexical holds the BM25 indexes behind keyword retrieval */
+	lexical *lexicalCache
 }
 
-func NewService(collection *qmgo.Collection) *Service {
-	return &Service{collection: collection}
+func NewService(db *qmgo.Database, index *vectorindex.Manager) *Service {
+	contexts := db.Collection(contextsCollection)
+	chunks := db.Collection(chunksCollection)
+
+	/* Missing indexes only cost speed, so failures are logged, not fatal */
+	if err := contexts.CreateOneIndex(context.Background(), options.IndexModel{Key: []string{"userId", "name"}}); err != nil {
+		log.Warn("could not create index on %s: %v", contextsCollection, err)
+	}
+	if err := contexts.CreateOneIndex(context.Background(), options.IndexModel{Key: []string{"share.access.subjectId"}}); err != nil {
+		log.Warn("could not create index on %s: %v", contextsCollection, err)
+	}
+	if err := chunks.CreateOneIndex(context.Background(), options.IndexModel{Key: []string{"userId", "context", "type", "source", "_id"}}); err != nil {
+		log.Warn("could not create index on %s: %v", chunksCollection, err)
+	}
+
+	return &Service{contexts: contexts, chunks: chunks, users: db.Collection("users"), index: index, lexical: newLexicalCache(lexicalBudget)}
 }
 
 /* Get context by name and userId */
 func (s *Service) GetContext(ctx context.Context, name *string, userID string) (*models.LLMVector, error) {
-	var context models.LLMVector
-	filter := bson.M{"userId": userID, "name": name}
-	err := s.collection.Find(ctx, filter).One(&context)
-	return &context, err
+	return s.GetFilteredContext(ctx, name, userID, StoreFilter{})
+}
+
+/* GetFilteredContext loads only the vectors of the filter's types and sources */
+func (s *Service) GetFilteredContext(ctx context.Context, name *string, userID string, filter StoreFilter) (*models.LLMVector, error) {
+	header, err := s.header(ctx, name, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.load(ctx, header, filter); err != nil {
+		return nil, err
+	}
+	s.touch(ctx, header)
+	return header, nil
 }
 
 /* Get all contexts for user */
 func (s *Service) GetAllContexts(ctx context.Context, userID string) ([]models.LLMVector, error) {
 	contexts := []models.LLMVector{}
 	filter := bson.M{"userId": userID}
-	err := s.collection.Find(ctx, filter).All(&contexts)
-	return contexts, err
+	if err := s.contexts.Find(ctx, filter).All(&contexts); err != nil {
+		return nil, err
+	}
+	for i := range contexts {
+		if err := s.load(ctx, &contexts[i], StoreFilter{}); err != nil {
+			return nil, err
+		}
+	}
+	return contexts, nil
 }
 
-/* Save or update context */
+/*
+Save or update context. Appending only inserts the new vectors; replacing inserts the new
+vectors before dropping the type's older ones, so readers never see the type empty.
+*/
 func (s *Service) SaveContext(ctx context.Context, name *string, userID, contextType string, data map[string][]models.MemoryVector, keep bool) (*models.LLMVector, error) {
-	filter := bson.M{"userId": userID, "name": name}
+	if err := s.save(ctx, name, userID, contextType, data, keep, false); err != nil {
+		return nil, err
+	}
+	return s.GetContext(ctx, name, userID)
+}
 
-	var existing models.LLMVector
-	err := s.collection.Find(ctx, filter).One(&existing)
+/* ReplaceSources swaps the vectors of data's sources and leaves the type's other sources alone */
+func (s *Service) ReplaceSources(ctx context.Context, name *string, userID, contextType string, data map[string][]models.MemoryVector) error {
+	return s.save(ctx, name, userID, contextType, data, false, true)
+}
 
-	now := time.Now()
+/*
+save inserts data, then unless keep drops older vectors of the type, or only of data's sources
+when bySource. Embeddings must match the model and dimension of those the type keeps, and an
+append skips content its source already holds.
+*/
+func (s *Service) save(ctx context.Context, name *string, userID, contextType string, data map[string][]models.MemoryVector, keep, bySource bool) error {
+	header, err := s.ensureHeader(ctx, name, userID)
+	if err != nil {
+		return err
+	}
+	if err := s.migrate(ctx, header); err != nil {
+		return err
+	}
 
+	incoming, err := specOf(contextType, data)
 	if err != nil {
-		// Create new context
-		newContext := models.LLMVector{
-			ID:        primitive.NewObjectID(),
-			UserID:    userID,
-			Name:      name,
-			Store:     make(map[string]map[string][]models.MemoryVector),
-			CreatedAt: now,
-			UpdatedAt: now,
-		}
-		newContext.Store[contextType] = data
-
-		_, err = s.collection.InsertOne(ctx, newContext)
-		if err != nil {
-			return nil, err
+		return err
+	}
+	replacing := !keep && !bySource
+	var stored *models.EmbeddingSpec
+	if !replacing {
+		if stored, err = s.storedSpec(ctx, header, contextType); err != nil {
+			return err
+		}
+		if stored != nil && incoming != nil {
+			if err := agree(stored, incoming); err != nil {
+				return err
+			}
+		}
+	}
+	if spec, changed := nextSpec(stored, incoming, replacing); changed {
+		if err := s.recordSpec(ctx, header, contextType, spec); err != nil {
+			return err
+		}
+	}
+
+	if keep {
+		var skipped int
+		if data, skipped, err = s.dedupe(ctx, name, userID, contextType, data); err != nil {
+			return err
+		}
+		if skipped > 0 {
+			log.Info("skipped %d repeated vectors appending to context %s of user %s", skipped, header.ID.Hex(), userID)
 		}
-		return &newContext, nil
 	}
 
-	// Update existing context
-	if existing.Store == nil {
-		existing.Store = make(map[string]map[string][]models.MemoryVector)
+	/* Every chunk inserted below gets a larger ObjectID than cutoff */
+	cutoff := primitive.NewObjectID()
+	chunks, sources := splitData(userID, name, contextType, data, primitive.NewObjectID)
+	if len(chunks) > 0 {
+		if _, err := s.chunks.InsertMany(ctx, chunks); err != nil {
+			return err
+		}
 	}
 
+	filter := bson.M{"_id": header.ID}
+	replaced := sortedKeys(data, nil)
 	if !keep {
-		// Replace type data
-		existing.Store[contextType] = data
-	} else {
-		// Append to existing type
-		if existing.Store[contextType] == nil {
-			existing.Store[contextType] = make(map[string][]models.MemoryVector)
-		}
-
-		for source, vectors := range data {
-			if existingVectors, ok := existing.Store[contextType][source]; ok {
-				existing.Store[contextType][source] = append(existingVectors, vectors...)
-			} else {
-				existing.Store[contextType][source] = vectors
+		stale := bson.M{"userId": userID, "context": name, "type": contextType, "_id": bson.M{"$lte": cutoff}}
+		if bySource {
+			stale["source"] = bson.M{"$in": replaced}
+		}
+		if _, err := s.chunks.RemoveAll(ctx, stale); err != nil {
+			return err
+		}
+		/* Sources being replaced are added back below, so only a full replace forgets the others */
+		if !bySource {
+			if err := s.contexts.UpdateOne(ctx, filter, bson.M{"$pull": bson.M{"sources": bson.M{"type": contextType}}}); err != nil {
+				return err
 			}
 		}
 	}
 
-	existing.UpdatedAt = now
-
+	now := stamp()
 	update := bson.M{
-		"$set": bson.M{
-			"store":     existing.Store,
-			"updatedAt": now,
-		},
+		"$addToSet": bson.M{"types": contextType},
+		"$set":      bson.M{"updatedAt": now, "lastUsedAt": now},
+	}
+	if len(sources) > 0 {
+		update["$addToSet"] = bson.M{"types": contextType, "sources": bson.M{"$each": sources}}
+	}
+	if err := s.contexts.UpdateOne(ctx, filter, update); err != nil {
+		return err
 	}
 
-	err = s.collection.UpdateOne(ctx, filter, update)
+	s.reindex(userID, name, header.UpdatedAt, now, func(idx *vectorindex.Index) {
+		if !keep {
+			idx.Remove(func(item vectorindex.Item) bool {
+				return item.Type == contextType && item.ID <= cutoff.Hex() && (!bySource || contains(replaced, item.Source))
+			})
+		}
+		idx.Add(indexEntries(chunks))
+	})
+
+	/* A cap is kept on every write; TTLs can wait for the sweeper */
+	if header.Retention != nil && header.Retention.MaxVectors > 0 {
+		header.UpdatedAt, header.LastUsedAt = now, now
+		return s.enforce(ctx, header, time.Now())
+	}
+	return nil
+}
+
+/* EnsureType creates the context and an empty type in it unless they exist */
+func (s *Service) EnsureType(ctx context.Context, name *string, userID, contextType string) (*models.LLMVector, error) {
+	header, err := s.ensureHeader(ctx, name, userID)
 	if err != nil {
 		return nil, err
 	}
-
-	return &existing, nil
+	if err := s.contexts.UpdateOne(ctx, bson.M{"_id": header.ID}, bson.M{"$addToSet": bson.M{"types": contextType}}); err != nil {
+		return nil, err
+	}
+	return s.GetContext(ctx, name, userID)
 }
 
 /* Delete context, type, or specific sources */
 func (s *Service) DeleteContext(ctx context.Context, name *string, userID string, contextType *string, sources []string) error {
-	filter := bson.M{"userId": userID, "name": name}
-
-	var existing models.LLMVector
-	err := s.collection.Find(ctx, filter).One(&existing)
+	header, err := s.header(ctx, name, userID)
 	if err != nil {
 		return err
 	}
 
+	chunkFilter := bson.M{"userId": userID, "context": name}
+
 	// Delete entire context if no type specified
 	if contextType == nil {
-		return s.collection.Remove(ctx, filter)
+		if _, err := s.chunks.RemoveAll(ctx, chunkFilter); err != nil {
+			return err
+		}
+		if s.index != nil {
+			s.index.Drop(indexKey(userID, name))
+		}
+		s.lexical.drop(indexKey(userID, name))
+		return s.contexts.Remove(ctx, bson.M{"_id": header.ID})
+	}
+
+	if err := s.migrate(ctx, header); err != nil {
+		return err
 	}
+	chunkFilter["type"] = *contextType
+	filter := bson.M{"_id": header.ID}
+	now := stamp()
 
 	// Delete specific sources from type
 	if len(sources) > 0 {
-		if typeStore, ok := existing.Store[*contextType]; ok {
-			for _, source := range sources {
-				delete(typeStore, source)
-			}
-
-			// If type is empty, remove it
-			if len(typeStore) == 0 {
-				delete(existing.Store, *contextType)
-			}
+		chunkFilter["source"] = bson.M{"$in": sources}
+		if _, err := s.chunks.RemoveAll(ctx, chunkFilter); err != nil {
+			return err
 		}
-
-		update := bson.M{"$set": bson.M{"store": existing.Store, "updatedAt": time.Now()}}
-		return s.collection.UpdateOne(ctx, filter, update)
+		update := bson.M{
+			"$pull": bson.M{"sources": bson.M{"type": *contextType, "source": bson.M{"$in": sources}}},
+			"$set":  bson.M{"updatedAt": now, "lastUsedAt": now},
+		}
+		if err := s.contexts.UpdateOne(ctx, filter, update); err != nil {
+			return err
+		}
+		s.reindex(userID, name, header.UpdatedAt, now, func(idx *vectorindex.Index) {
+			idx.Remove(func(item vectorindex.Item) bool {
+				return item.Type == *contextType && contains(sources, item.Source)
+			})
+		})
+
+		// If type is empty, remove it
+		emptyType := bson.M{"_id": header.ID, "sources.type": bson.M{"$ne": *contextType}}
+		err := s.contexts.UpdateOne(ctx, emptyType, bson.M{"$pull": bson.M{"types": *contextType, "embeddings": bson.M{"type": *contextType}}})
+		if err != nil && !errors.Is(err, qmgo.ErrNoSuchDocuments) {
+			return err
+		}
+		return nil
 	}
 
 	// Delete entire type
-	if _, ok := existing.Store[*contextType]; ok {
-		delete(existing.Store, *contextType)
-		update := bson.M{"$set": bson.M{"store": existing.Store, "updatedAt": time.Now()}}
-		return s.collection.UpdateOne(ctx, filter, update)
+	if _, err := s.chunks.RemoveAll(ctx, chunkFilter); err != nil {
+		return err
 	}
-
+	update := bson.M{
+		"$pull": bson.M{"types": *contextType, "sources": bson.M{"type": *contextType}, "embeddings": bson.M{"type": *contextType}},
+		"$set":  bson.M{"updatedAt": now, "lastUsedAt": now},
+	}
+	if err := s.contexts.UpdateOne(ctx, filter, update); err != nil {
+		return err
+	}
+	s.reindex(userID, name, header.UpdatedAt, now, func(idx *vectorindex.Index) {
+		idx.Remove(func(item vectorindex.Item) bool { return item.Type == *contextType })
+	})
 	return nil
 }
 
@@ -149,31 +295,168 @@ func (s *Service) DeleteContext(ctx context.Context, name *string, userID string
 func (s *Service) GetOverview(ctx context.Context, userID string, filterType *string) (map[string]map[string][]string, error) {
 	contexts := []models.LLMVector{}
 	filter := bson.M{"userId": userID}
-	err := s.collection.Find(ctx, filter).All(&contexts)
+	err := s.contexts.Find(ctx, filter).All(&contexts)
 	if err != nil {
 		return nil, err
 	}
 
 	overview := make(map[string]map[string][]string)
 
-	for _, context := range contexts {
+	for i, context := range contexts {
 		contextKey := ""
 		if context.Name != nil {
 			contextKey = *context.Name
 		}
+		overview[contextKey] = overviewOf(&contexts[i], filterType)
+	}
 
-		overview[contextKey] = make(map[string][]string)
+	return overview, nil
+}
 
-		for storeType, typeStore := range context.Store {
-			if filterType == nil || *filterType == storeType {
-				sources := make([]string, 0, len(typeStore))
-				for source := range typeStore {
-					sources = append(sources, source)
-				}
-				overview[contextKey][storeType] = sources
-			}
+/*
+Migrate moves a context's nested store into chunks and drops it from the header. Chunks it
+inserted on an earlier interrupted run are replaced, so it is safe to rerun. Returns the
+number of vectors moved.
+*/
+func (s *Service) Migrate(ctx context.Context, header *models.LLMVector) (int, error) {
+	if header.Store == nil {
+		return 0, nil
+	}
+
+	var chunks []models.LLMVectorChunk
+	var sources []models.VectorSource
+	types := sortedKeys(header.Store, nil)
+	newID := legacyChunkIDs(header.ID.Timestamp())
+	for _, contextType := range types {
+		typeChunks, typeSources := splitData(header.UserID, header.Name, contextType, header.Store[contextType], newID)
+		chunks = append(chunks, typeChunks...)
+		sources = append(sources, typeSources...)
+	}
+	for i := range chunks {
+		chunks[i].Legacy = true
+	}
+
+	if _, err := s.chunks.RemoveAll(ctx, bson.M{"userId": header.UserID, "context": header.Name, "legacy": true}); err != nil {
+		return 0, err
+	}
+	if len(chunks) > 0 {
+		if _, err := s.chunks.InsertMany(ctx, chunks); err != nil {
+			return 0, err
 		}
 	}
 
-	return overview, nil
+	addToSet := bson.M{}
+	if len(types) > 0 {
+		addToSet["types"] = bson.M{"$each": types}
+	}
+	if len(sources) > 0 {
+		addToSet["sources"] = bson.M{"$each": sources}
+	}
+	update := bson.M{"$unset": bson.M{"store": ""}}
+	if len(addToSet) > 0 {
+		update["$addToSet"] = addToSet
+	}
+	if err := s.contexts.UpdateOne(ctx, bson.M{"_id": header.ID}, update); err != nil {
+		return 0, err
+	}
+
+	header.Store = nil
+	return len(chunks), nil
+}
+
+/*
+BackfillHashes records the content hash of chunks written before hashes were, so appends find
+their content again. It returns how many chunks it hashed; dryRun only counts them.
+*/
+func (s *Service) BackfillHashes(ctx context.Context, dryRun bool) (int, error) {
+	query := bson.M{"hash": bson.M{"$exists": false}, "content": bson.M{"$nin": bson.A{"", nil}}}
+	if dryRun {
+		count, err := s.chunks.Find(ctx, query).Count()
+		return int(count), err
+	}
+
+	cursor := s.chunks.Find(ctx, query).Select(bson.M{"content": 1}).Cursor()
+	defer cursor.Close()
+
+	hashed := 0
+	var chunk models.LLMVectorChunk
+	for cursor.Next(&chunk) {
+		filter := bson.M{"_id": chunk.ID, "hash": bson.M{"$exists": false}}
+		err := s.chunks.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"hash": contentHash(chunk.Content)}})
+		if err != nil && !errors.Is(err, qmgo.ErrNoSuchDocuments) {
+			return hashed, err
+		}
+		if err == nil {
+			hashed++
+		}
+		chunk = models.LLMVectorChunk{}
+	}
+	return hashed, cursor.Err()
+}
+
+func (s *Service) migrate(ctx context.Context, header *models.LLMVector) error {
+	moved, err := s.Migrate(ctx, header)
+	if moved > 0 {
+		log.Info("migrated %d vectors of context %s for user %s", moved, header.ID.Hex(), header.UserID)
+	}
+	return err
+}
+
+func (s *Service) header(ctx context.Context, name *string, userID string) (*models.LLMVector, error) {
+	var header models.LLMVector
+	if err := s.contexts.Find(ctx, bson.M{"userId": userID, "name": name}).One(&header); err != nil {
+		return nil, err
+	}
+	return &header, nil
+}
+
+/*
+ensureHeader finds or atomically creates the context header. UpdatedAt is left as it was, so
+it still names the version a resident index reflects before this write.
+*/
+func (s *Service) ensureHeader(ctx context.Context, name *string, userID string) (*models.LLMVector, error) {
+	now := stamp()
+	change := qmgo.Change{
+		Update: bson.M{
+			"$setOnInsert": bson.M{"userId": userID, "name": name, "createdAt": now, "updatedAt": now},
+		},
+		Upsert:    true,
+		ReturnNew: true,
+	}
+
+	var header models.LLMVector
+	if err := s.contexts.Find(ctx, bson.M{"userId": userID, "name": name}).Apply(change, &header); err != nil {
+		return nil, err
+	}
+	return &header, nil
+}
+
+/* load fills header.Store from its layout, unmigrated nested store and chunks */
+func (s *Service) load(ctx context.Context, header *models.LLMVector, filter StoreFilter) error {
+	query := bson.M{"userId": header.UserID, "context": header.Name}
+	if len(filter.Types) > 0 {
+		query["type"] = bson.M{"$in": filter.Types}
+	}
+	if len(filter.Sources) > 0 {
+		query["source"] = bson.M{"$in": filter.Sources}
+	}
+
+	chunks := []models.LLMVectorChunk{}
+	if err := s.chunks.Find(ctx, query).Sort("type", "source", "_id").All(&chunks); err != nil {
+		return err
+	}
+	header.Store = assembleStore(header, chunks, filter)
+	return nil
+}
+
+/* reindex moves a resident index from the version before a write to the one the write stored */
+func (s *Service) reindex(userID string, name *string, from, to time.Time, apply func(*vectorindex.Index)) {
+	if s.index != nil {
+		s.index.Update(indexKey(userID, name), from, to, apply)
+	}
+}
+
+/* stamp is the current time at Mongo's millisecond precision, so stored versions compare equal once read back */
+func stamp() time.Time {
+	return time.Now().Truncate(time.Millisecond)
 }
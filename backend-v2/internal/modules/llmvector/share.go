@@ -0,0 +1,180 @@
+package llmvector
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/qiniu/qmgo"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"backend-v2/internal/common/constants"
+	"backend-v2/internal/models"
+)
+
+/* ErrInvalidShare is returned by SetShare for an access list it cannot store */
+var ErrInvalidShare = errors.New("invalid access list")
+
+/* Subject is who is asking: the user and the mail address of their account */
+type Subject struct {
+	UserID string
+	Mail   string
+}
+
+/* matches reports whether binding names the subject */
+func (s Subject) matches(binding models.RoleBinding) bool {
+	switch binding.SubjectType {
+	case constants.User:
+		return binding.SubjectID == s.UserID
+	case constants.Mail:
+		return s.Mail != "" && binding.SubjectID == s.Mail
+	}
+	return false
+}
+
+/* roleFor returns the subject's role on a context; ok is false when the subject has none */
+func roleFor(header *models.LLMVector, subject Subject) (constants.AccessRole, bool) {
+	if header.UserID == subject.UserID {
+		return constants.Owner, true
+	}
+	if header.Share == nil {
+		return "", false
+	}
+	/* The strongest matching binding wins, so a mail grant cannot weaken a personal one */
+	var role constants.AccessRole
+	for _, binding := range header.Share.Access {
+		if !subject.matches(binding) {
+			continue
+		}
+		if binding.Role == constants.Contributor || role == "" {
+			role = binding.Role
+		}
+	}
+	return role, role != ""
+}
+
+/* CanWrite reports whether role may save to or delete from a context */
+func CanWrite(role constants.AccessRole) bool {
+	return role == constants.Owner || role == constants.Contributor
+}
+
+/* sharedFilter selects the headers of other users that name the subject in their access list */
+func sharedFilter(subject Subject) bson.M {
+	grants := []bson.M{{"subjectType": constants.User, "subjectId": subject.UserID}}
+	if subject.Mail != "" {
+		grants = append(grants, bson.M{"subjectType": constants.Mail, "subjectId": subject.Mail})
+	}
+	return bson.M{
+		"userId":       bson.M{"$ne": subject.UserID},
+		"share.access": bson.M{"$elemMatch": bson.M{"$or": grants}},
+	}
+}
+
+/*
+validateAccess accepts reader and contributor grants to users and mail addresses. Groups are
+refused: users belong to none, so a group grant would reach nobody.
+*/
+func validateAccess(access []models.RoleBinding) error {
+	for _, binding := range access {
+		if binding.Role != constants.Reader && binding.Role != constants.Contributor {
+			return ErrInvalidShare
+		}
+		switch binding.SubjectType {
+		case constants.User, constants.Mail:
+		default:
+			return ErrInvalidShare
+		}
+		if strings.TrimSpace(binding.SubjectID) == "" || strings.ContainsAny(binding.SubjectID, "<>\"'") {
+			return ErrInvalidShare
+		}
+	}
+	return nil
+}
+
+/* Subject looks up the caller's mail address, which tokens do not carry */
+func (s *Service) Subject(ctx context.Context, userID string) (Subject, error) {
+	subject := Subject{UserID: userID}
+	var user models.User
+	err := s.users.Find(ctx, bson.M{"name": userID}).Select(bson.M{"mail": 1}).One(&user)
+	if errors.Is(err, qmgo.ErrNoSuchDocuments) {
+		return subject, nil
+	}
+	if err != nil {
+		return subject, err
+	}
+	subject.Mail = user.Mail
+	return subject, nil
+}
+
+/*
+Role returns the subject's role on owner's context. A context the subject has no grant on is
+reported as missing, so its existence is not revealed.
+*/
+func (s *Service) Role(ctx context.Context, name *string, owner string, subject Subject) (constants.AccessRole, error) {
+	header, err := s.header(ctx, name, owner)
+	if err != nil {
+		return "", err
+	}
+	role, ok := roleFor(header, subject)
+	if !ok {
+		return "", qmgo.ErrNoSuchDocuments
+	}
+	return role, nil
+}
+
+/* GetShare returns the access list of one of the owner's contexts */
+func (s *Service) GetShare(ctx context.Context, name *string, owner string) ([]models.RoleBinding, error) {
+	header, err := s.header(ctx, name, owner)
+	if err != nil {
+		return nil, err
+	}
+	if header.Share == nil {
+		return []models.RoleBinding{}, nil
+	}
+	return header.Share.Access, nil
+}
+
+/* SetShare replaces the access list of one of the owner's contexts */
+func (s *Service) SetShare(ctx context.Context, name *string, owner string, access []models.RoleBinding) error {
+	if err := validateAccess(access); err != nil {
+		return err
+	}
+	if access == nil {
+		access = []models.RoleBinding{}
+	}
+	return s.contexts.UpdateOne(ctx, bson.M{"userId": owner, "name": name}, bson.M{"$set": bson.M{"share.access": access}})
+}
+
+/* GetSharedContexts returns the contexts other users share with the subject */
+func (s *Service) GetSharedContexts(ctx context.Context, subject Subject) ([]models.LLMVector, error) {
+	contexts := []models.LLMVector{}
+	if err := s.contexts.Find(ctx, sharedFilter(subject)).All(&contexts); err != nil {
+		return nil, err
+	}
+	for i := range contexts {
+		/* Who else the owner shares with is theirs to know */
+		contexts[i].Share = nil
+		if err := s.load(ctx, &contexts[i], StoreFilter{}); err != nil {
+			return nil, err
+		}
+	}
+	return contexts, nil
+}
+
+/* GetSharedOverview lists the types and sources of shared contexts, keyed "owner/name" */
+func (s *Service) GetSharedOverview(ctx context.Context, subject Subject, filterType *string) (map[string]map[string][]string, error) {
+	contexts := []models.LLMVector{}
+	if err := s.contexts.Find(ctx, sharedFilter(subject)).All(&contexts); err != nil {
+		return nil, err
+	}
+
+	overview := make(map[string]map[string][]string)
+	for i, context := range contexts {
+		name := ""
+		if context.Name != nil {
+			name = *context.Name
+		}
+		overview[context.UserID+"/"+name] = overviewOf(&contexts[i], filterType)
+	}
+	return overview, nil
+}
@@ -0,0 +1,94 @@
+package llmvector
+
+import (
+	"errors"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"backend-v2/internal/common/constants"
+	"backend-v2/internal/models"
+)
+
+func TestRoleFor(t *testing.T) {
+	header := &models.LLMVector{
+		UserID: "owner",
+		Share: &models.VectorShare{Access: []models.RoleBinding{
+			{SubjectID: "reader", SubjectType: constants.User, Role: constants.Reader},
+			{SubjectID: "team@example.com", SubjectType: constants.Mail, Role: constants.Reader},
+			{SubjectID: "research", SubjectType: constants.Group, Role: constants.Contributor},
+			{SubjectID: "both", SubjectType: constants.User, Role: constants.Contributor},
+			{SubjectID: "both@example.com", SubjectType: constants.Mail, Role: constants.Reader},
+		}},
+	}
+
+	cases := []struct {
+		name    string
+		subject Subject
+		want    constants.AccessRole
+		ok      bool
+	}{
+		{"owner", Subject{UserID: "owner"}, constants.Owner, true},
+		{"user grant", Subject{UserID: "reader"}, constants.Reader, true},
+		{"mail grant", Subject{UserID: "someone", Mail: "team@example.com"}, constants.Reader, true},
+		{"strongest grant wins", Subject{UserID: "both", Mail: "both@example.com"}, constants.Contributor, true},
+		{"no grant", Subject{UserID: "stranger", Mail: "other@example.com"}, "", false},
+		{"group grants match nobody", Subject{UserID: "research"}, "", false},
+	}
+	for _, c := range cases {
+		role, ok := roleFor(header, c.subject)
+		if role != c.want || ok != c.ok {
+			t.Errorf("%s: roleFor() = %q, %v, want %q, %v", c.name, role, ok, c.want, c.ok)
+		}
+	}
+
+	if _, ok := roleFor(&models.LLMVector{UserID: "owner"}, Subject{UserID: "reader"}); ok {
+		t.Errorf("unshared context granted a role")
+	}
+	if CanWrite(constants.Reader) || !CanWrite(constants.Contributor) || !CanWrite(constants.Owner) {
+		t.Errorf("CanWrite() lets readers write or stops contributors")
+	}
+}
+
+func TestValidateAccess(t *testing.T) {
+	valid := []models.RoleBinding{
+		{SubjectID: "user-1", SubjectType: constants.User, Role: constants.Reader},
+		{SubjectID: "team@example.com", SubjectType: constants.Mail, Role: constants.Contributor},
+	}
+	if err := validateAccess(valid); err != nil {
+		t.Errorf("validateAccess(valid) = %v", err)
+	}
+	if err := validateAccess(nil); err != nil {
+		t.Errorf("validateAccess(nil) = %v, want an empty list to clear sharing", err)
+	}
+
+	invalid := []models.RoleBinding{
+		{SubjectID: "user-1", SubjectType: constants.User, Role: constants.Owner},
+		{SubjectID: "user-1", SubjectType: "team", Role: constants.Reader},
+		{SubjectID: "research", SubjectType: constants.Group, Role: constants.Reader},
+		{SubjectID: " ", SubjectType: constants.User, Role: constants.Reader},
+		{SubjectID: "<script>", SubjectType: constants.Mail, Role: constants.Reader},
+	}
+	for _, binding := range invalid {
+		if err := validateAccess([]models.RoleBinding{binding}); !errors.Is(err, ErrInvalidShare) {
+			t.Errorf("validateAccess(%+v) = %v, want ErrInvalidShare", binding, err)
+		}
+	}
+}
+
+func TestSharedFilter_AsksOnlyForKnownAddresses(t *testing.T) {
+	grants := func(subject Subject) []bson.M {
+		access := sharedFilter(subject)["share.access"].(bson.M)
+		return access["$elemMatch"].(bson.M)["$or"].([]bson.M)
+	}
+
+	if got := grants(Subject{UserID: "u"}); len(got) != 1 || got[0]["subjectId"] != "u" {
+		t.Errorf("grants for a bare user = %v, want only the user grant", got)
+	}
+	if got := grants(Subject{UserID: "u", Mail: "u@example.com"}); len(got) != 2 {
+		t.Errorf("grants with mail = %v, want user and mail grants", got)
+	}
+	if owner := sharedFilter(Subject{UserID: "u"})["userId"]; owner.(bson.M)["$ne"] != "u" {
+		t.Errorf("shared filter includes the user's own contexts")
+	}
+}
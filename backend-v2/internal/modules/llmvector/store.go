@@ -0,0 +1,134 @@
+package llmvector
+
+import (
+	"encoding/binary"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"backend-v2/internal/models"
+)
+
+/* StoreFilter narrows which types and sources are loaded; empty means all */
+type StoreFilter struct {
+	Types   []string
+	Sources []string
+}
+
+func (f StoreFilter) hasType(contextType string) bool {
+	return len(f.Types) == 0 || contains(f.Types, contextType)
+}
+
+func (f StoreFilter) hasSource(source string) bool {
+	return len(f.Sources) == 0 || contains(f.Sources, source)
+}
+
+/*
+assembleStore rebuilds store[type][source][]vectors from a header's layout, any unmigrated
+nested store it still carries, and its chunks sorted by type, source and _id. Nested vectors
+predate every chunk, so they come first.
+*/
+func assembleStore(header *models.LLMVector, chunks []models.LLMVectorChunk, filter StoreFilter) map[string]map[string][]models.MemoryVector {
+	store := make(map[string]map[string][]models.MemoryVector)
+	slot := func(contextType, source string) bool {
+		if !filter.hasType(contextType) {
+			return false
+		}
+		if store[contextType] == nil {
+			store[contextType] = make(map[string][]models.MemoryVector)
+		}
+		if source == "" || !filter.hasSource(source) {
+			return false
+		}
+		if store[contextType][source] == nil {
+			store[contextType][source] = []models.MemoryVector{}
+		}
+		return true
+	}
+
+	for _, contextType := range header.Types {
+		slot(contextType, "")
+	}
+	for _, pair := range header.Sources {
+		slot(pair.Type, pair.Source)
+	}
+	for contextType, typeStore := range header.Store {
+		slot(contextType, "")
+		for source, vectors := range typeStore {
+			if slot(contextType, source) {
+				store[contextType][source] = append(store[contextType][source], vectors...)
+			}
+		}
+	}
+	for _, chunk := range chunks {
+		if slot(chunk.Type, chunk.Source) {
+			store[chunk.Type][chunk.Source] = append(store[chunk.Type][chunk.Source], chunk.MemoryVector)
+		}
+	}
+	return store
+}
+
+/* overviewOf lists each type's sources, restricted to filterType when set */
+func overviewOf(header *models.LLMVector, filterType *string) map[string][]string {
+	filter := StoreFilter{}
+	if filterType != nil {
+		filter.Types = []string{*filterType}
+	}
+
+	overview := make(map[string][]string)
+	for contextType, typeStore := range assembleStore(header, nil, filter) {
+		overview[contextType] = sortedKeys(typeStore, nil)
+	}
+	return overview
+}
+
+/* splitData turns one type's sources into chunks, in source order and then vector order, plus their layout */
+func splitData(userID string, name *string, contextType string, data map[string][]models.MemoryVector, newID func() primitive.ObjectID) ([]models.LLMVectorChunk, []models.VectorSource) {
+	var chunks []models.LLMVectorChunk
+	var sources []models.VectorSource
+	for _, source := range sortedKeys(data, nil) {
+		sources = append(sources, models.VectorSource{Type: contextType, Source: source})
+		for _, vector := range data[source] {
+			/* Only an embedding has a model and a dimension */
+			vector.Dimension = len(vector.Embedding)
+			if vector.Dimension == 0 {
+				vector.Model = ""
+			}
+			chunk := models.LLMVectorChunk{
+				ID:           newID(),
+				UserID:       userID,
+				Context:      name,
+				Type:         contextType,
+				Source:       source,
+				MemoryVector: vector,
+			}
+			if vector.Content != "" {
+				chunk.Hash = contentHash(vector.Content)
+			}
+			chunks = append(chunks, chunk)
+		}
+	}
+	return chunks, sources
+}
+
+/*
+legacyChunkIDs issues ids stamped with the context's creation time so migrated vectors sort
+before anything appended since; the remaining bytes come from fresh ObjectIDs, which keeps
+them unique and increasing.
+*/
+func legacyChunkIDs(created time.Time) func() primitive.ObjectID {
+	return func() primitive.ObjectID {
+		id := primitive.NewObjectID()
+		binary.BigEndian.PutUint32(id[0:4], uint32(created.Unix()))
+		return id
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,108 @@
+package llmvector
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"backend-v2/internal/models"
+)
+
+func TestSplitData_OrdersBySourceThenVector(t *testing.T) {
+	name := "notes"
+	data := map[string][]models.MemoryVector{
+		"b":     {{Content: "b1"}, {Content: "b2"}},
+		"a":     {{Content: "a1"}},
+		"empty": {},
+	}
+
+	chunks, sources := splitData("user-1", &name, "openai", data, primitive.NewObjectID)
+
+	var got []string
+	for i, chunk := range chunks {
+		got = append(got, chunk.Content)
+		if chunk.UserID != "user-1" || *chunk.Context != "notes" || chunk.Type != "openai" {
+			t.Errorf("chunk %d addressed as %s/%v/%s", i, chunk.UserID, chunk.Context, chunk.Type)
+		}
+		if i > 0 && chunk.ID.Hex() <= chunks[i-1].ID.Hex() {
+			t.Errorf("chunk ids must increase: %s after %s", chunk.ID.Hex(), chunks[i-1].ID.Hex())
+		}
+	}
+	if want := []string{"a1", "b1", "b2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("chunk order = %v, want %v", got, want)
+	}
+
+	wantSources := []models.VectorSource{{Type: "openai", Source: "a"}, {Type: "openai", Source: "b"}, {Type: "openai", Source: "empty"}}
+	if !reflect.DeepEqual(sources, wantSources) {
+		t.Errorf("sources = %v, want %v", sources, wantSources)
+	}
+}
+
+func TestAssembleStore_MatchesNestedLayout(t *testing.T) {
+	header := &models.LLMVector{
+		Types:   []string{"openai", "claude"},
+		Sources: []models.VectorSource{{Type: "openai", Source: "doc"}, {Type: "openai", Source: "empty"}},
+		/* Unmigrated vectors come before chunks of the same source */
+		Store: map[string]map[string][]models.MemoryVector{
+			"openai": {"doc": {{Content: "legacy"}}},
+			"local":  {"old": {{Content: "only legacy"}}},
+		},
+	}
+	chunks := []models.LLMVectorChunk{
+		{Type: "openai", Source: "doc", MemoryVector: models.MemoryVector{Content: "first"}},
+		{Type: "openai", Source: "doc", MemoryVector: models.MemoryVector{Content: "second"}},
+	}
+
+	store := assembleStore(header, chunks, StoreFilter{})
+
+	want := map[string]map[string][]models.MemoryVector{
+		"openai": {
+			"doc":   {{Content: "legacy"}, {Content: "first"}, {Content: "second"}},
+			"empty": {},
+		},
+		"claude": {},
+		"local":  {"old": {{Content: "only legacy"}}},
+	}
+	if !reflect.DeepEqual(store, want) {
+		t.Errorf("store = %v, want %v", store, want)
+	}
+
+	filtered := assembleStore(header, chunks, StoreFilter{Types: []string{"openai"}, Sources: []string{"empty"}})
+	if len(filtered) != 1 || len(filtered["openai"]) != 1 || filtered["openai"]["empty"] == nil {
+		t.Errorf("filtered store = %v", filtered)
+	}
+}
+
+func TestOverviewOf(t *testing.T) {
+	header := &models.LLMVector{
+		Types:   []string{"openai", "claude"},
+		Sources: []models.VectorSource{{Type: "openai", Source: "b"}, {Type: "openai", Source: "a"}},
+	}
+
+	if got, want := overviewOf(header, nil), map[string][]string{"openai": {"a", "b"}, "claude": {}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("overview = %v, want %v", got, want)
+	}
+
+	claude := "claude"
+	if got, want := overviewOf(header, &claude), map[string][]string{"claude": {}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("filtered overview = %v, want %v", got, want)
+	}
+}
+
+func TestLegacyChunkIDs_SortBeforeNewChunks(t *testing.T) {
+	created := time.Now().Add(-24 * time.Hour)
+	newID := legacyChunkIDs(created)
+
+	first, second := newID(), newID()
+	if first.Timestamp().Unix() != created.Unix() {
+		t.Errorf("legacy id time = %v, want %v", first.Timestamp(), created)
+	}
+	if first == second || second.Hex() <= first.Hex() {
+		t.Errorf("legacy ids must be unique and increasing: %s, %s", first.Hex(), second.Hex())
+	}
+	if fresh := primitive.NewObjectID(); fresh.Hex() <= second.Hex() {
+		t.Errorf("new chunk id %s should sort after legacy id %s", fresh.Hex(), second.Hex())
+	}
+}
@@ -0,0 +1,411 @@
+package llmvector
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"github.com/qiniu/qmgo"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"backend-v2/internal/models"
+)
+
+/*
+A context export is JSON Lines: one header line naming the context and its layout, then one
+line per vector in type, source and insertion order. Vector lines stand alone, so an export
+can be split anywhere and imported piece by piece with ImportMerge.
+*/
+const (
+	exportFormat  = "d5-vector-context"
+	exportVersion = 1
+	/* maxImportLine bounds one line, a vector with its content and embedding */
+	maxImportLine = 16 << 20
+	/* maxDimension bounds an imported embedding; the largest common models use under 4096 */
+	maxDimension = 16384
+)
+
+/* EmbeddingEncoding chooses how exported vectors carry their embeddings */
+type EmbeddingEncoding string
+
+const (
+	/* EncodeJSON writes embeddings as JSON number arrays, exactly */
+	EncodeJSON EmbeddingEncoding = "json"
+	/* EncodeBinary writes base64 little-endian float32, about a quarter of the size at float32 precision */
+	EncodeBinary EmbeddingEncoding = "binary"
+	/* EncodeNone leaves embeddings out, for moving content to be embedded again */
+	EncodeNone EmbeddingEncoding = "none"
+)
+
+type exportHeader struct {
+	Format     string                `json:"format"`
+	Version    int                   `json:"version"`
+	Name       *string               `json:"name"`
+	Types      []string              `json:"types"`
+	Sources    []models.VectorSource `json:"sources"`
+	ExportedAt time.Time             `json:"exportedAt"`
+}
+
+/* exportLine is one vector; at most one of Embedding and EmbeddingF32 is set */
+type exportLine struct {
+	Type         string                 `json:"type"`
+	Source       string                 `json:"source"`
+	Content      string                 `json:"content"`
+	Metadata     map[string]interface{} `json:"metadata,omitempty"`
+	Model        string                 `json:"model,omitempty"`
+	Embedding    []float64              `json:"embedding,omitempty"`
+	EmbeddingF32 string                 `json:"embeddingF32,omitempty"`
+}
+
+/* exportWriter writes one context as JSON Lines */
+type exportWriter struct {
+	encoder  *json.Encoder
+	encoding EmbeddingEncoding
+}
+
+func newExportWriter(w io.Writer, encoding EmbeddingEncoding) *exportWriter {
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	return &exportWriter{encoder: encoder, encoding: encoding}
+}
+
+func (e *exportWriter) header(context *models.LLMVector, exportedAt time.Time) error {
+	types := context.Types
+	if types == nil {
+		types = []string{}
+	}
+	sources := context.Sources
+	if sources == nil {
+		sources = []models.VectorSource{}
+	}
+	return e.encoder.Encode(exportHeader{
+		Format:     exportFormat,
+		Version:    exportVersion,
+		Name:       context.Name,
+		Types:      types,
+		Sources:    sources,
+		ExportedAt: exportedAt,
+	})
+}
+
+func (e *exportWriter) vector(chunk models.LLMVectorChunk) error {
+	line := exportLine{Type: chunk.Type, Source: chunk.Source, Content: chunk.Content, Metadata: chunk.Metadata}
+	switch e.encoding {
+	case EncodeJSON:
+		line.Embedding = chunk.Embedding
+		line.Model = chunk.Model
+	case EncodeBinary:
+		if len(chunk.Embedding) > 0 {
+			line.EmbeddingF32 = encodeFloat32(chunk.Embedding)
+			line.Model = chunk.Model
+		}
+	}
+	return e.encoder.Encode(line)
+}
+
+/* ImportFile is a parsed export: its context name, when it had a header, and its vectors by type and source */
+type ImportFile struct {
+	HasHeader bool
+	Name      *string
+	Data      map[string]map[string][]models.MemoryVector
+	Vectors   int
+}
+
+/* ImportError points at the line of an export that cannot be imported */
+type ImportError struct {
+	Line    int
+	Message string
+}
+
+func (e *ImportError) Error() string {
+	if e.Line == 0 {
+		return e.Message
+	}
+	return fmt.Sprintf("line %d: %s", e.Line, e.Message)
+}
+
+/*
+ReadImport parses an export. The header is optional but must come first; blank lines are
+skipped. Every embedding of a type must have the same dimension and model, since only those
+compare.
+*/
+func ReadImport(r io.Reader) (*ImportFile, error) {
+	file := &ImportFile{Data: make(map[string]map[string][]models.MemoryVector)}
+	specs := make(map[string]*models.EmbeddingSpec)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64<<10), maxImportLine)
+	number := 0
+	for scanner.Scan() {
+		number++
+		raw := scanner.Bytes()
+		if len(bytes.TrimSpace(raw)) == 0 {
+			continue
+		}
+
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &fields); err != nil {
+			return nil, &ImportError{Line: number, Message: "invalid JSON"}
+		}
+		if _, isHeader := fields["format"]; isHeader {
+			if file.HasHeader || file.Vectors > 0 {
+				return nil, &ImportError{Line: number, Message: "header must be the first line"}
+			}
+			if err := file.readHeader(raw); err != nil {
+				return nil, &ImportError{Line: number, Message: err.Error()}
+			}
+			continue
+		}
+
+		contextType, source, vector, err := readVector(raw)
+		if err != nil {
+			return nil, &ImportError{Line: number, Message: err.Error()}
+		}
+		if dimension := len(vector.Embedding); dimension > 0 {
+			spec := specs[contextType]
+			switch {
+			case spec == nil:
+				specs[contextType] = &models.EmbeddingSpec{Type: contextType, Model: vector.Model, Dimension: dimension}
+			case spec.Dimension != dimension:
+				return nil, &ImportError{Line: number, Message: fmt.Sprintf("embedding has %d dimensions, type %q has %d", dimension, contextType, spec.Dimension)}
+			case spec.Model != "" && vector.Model != "" && spec.Model != vector.Model:
+				return nil, &ImportError{Line: number, Message: fmt.Sprintf("embedding is from model %q, type %q has %q", vector.Model, contextType, spec.Model)}
+			case spec.Model == "":
+				spec.Model = vector.Model
+			}
+		}
+		file.slot(contextType)[source] = append(file.slot(contextType)[source], vector)
+		file.Vectors++
+	}
+	if err := scanner.Err(); err != nil {
+		if err == bufio.ErrTooLong {
+			return nil, &ImportError{Line: number + 1, Message: fmt.Sprintf("line is longer than %d MB", maxImportLine>>20)}
+		}
+		return nil, err
+	}
+	if !file.HasHeader && file.Vectors == 0 {
+		return nil, &ImportError{Message: "export is empty"}
+	}
+	return file, nil
+}
+
+func (f *ImportFile) readHeader(raw []byte) error {
+	var header exportHeader
+	if err := json.Unmarshal(raw, &header); err != nil {
+		return fmt.Errorf("invalid header")
+	}
+	if header.Format != exportFormat {
+		return fmt.Errorf("unknown format %q", header.Format)
+	}
+	if header.Version < 1 || header.Version > exportVersion {
+		return fmt.Errorf("unsupported version %d", header.Version)
+	}
+
+	f.HasHeader = true
+	f.Name = header.Name
+	/* Types and sources without vectors are part of the layout too */
+	for _, contextType := range header.Types {
+		if contextType != "" {
+			f.slot(contextType)
+		}
+	}
+	for _, source := range header.Sources {
+		if source.Type == "" || source.Source == "" {
+			continue
+		}
+		if _, ok := f.slot(source.Type)[source.Source]; !ok {
+			f.Data[source.Type][source.Source] = []models.MemoryVector{}
+		}
+	}
+	return nil
+}
+
+func (f *ImportFile) slot(contextType string) map[string][]models.MemoryVector {
+	if f.Data[contextType] == nil {
+		f.Data[contextType] = make(map[string][]models.MemoryVector)
+	}
+	return f.Data[contextType]
+}
+
+func readVector(raw []byte) (string, string, models.MemoryVector, error) {
+	var line exportLine
+	if err := json.Unmarshal(raw, &line); err != nil {
+		return "", "", models.MemoryVector{}, fmt.Errorf("invalid vector")
+	}
+	if line.Type == "" || line.Source == "" {
+		return "", "", models.MemoryVector{}, fmt.Errorf("\"type\" and \"source\" are required")
+	}
+	if len(line.Embedding) > 0 && line.EmbeddingF32 != "" {
+		return "", "", models.MemoryVector{}, fmt.Errorf("only one of \"embedding\" and \"embeddingF32\" may be set")
+	}
+
+	embedding := line.Embedding
+	if line.EmbeddingF32 != "" {
+		var err error
+		if embedding, err = decodeFloat32(line.EmbeddingF32); err != nil {
+			return "", "", models.MemoryVector{}, err
+		}
+	}
+	if len(embedding) > maxDimension {
+		return "", "", models.MemoryVector{}, fmt.Errorf("embedding has more than %d dimensions", maxDimension)
+	}
+	for _, value := range embedding {
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			return "", "", models.MemoryVector{}, fmt.Errorf("embedding holds a non-finite value")
+		}
+	}
+	if line.Content == "" && len(embedding) == 0 {
+		return "", "", models.MemoryVector{}, fmt.Errorf("vector has neither content nor embedding")
+	}
+
+	vector := models.MemoryVector{Content: line.Content, Embedding: embedding, Metadata: line.Metadata}
+	if len(embedding) > 0 {
+		vector.Model = line.Model
+	}
+	return line.Type, line.Source, vector, nil
+}
+
+func encodeFloat32(values []float64) string {
+	buf := make([]byte, 4*len(values))
+	for i, value := range values {
+		binary.LittleEndian.PutUint32(buf[4*i:], math.Float32bits(float32(value)))
+	}
+	return base64.StdEncoding.EncodeToString(buf)
+}
+
+func decodeFloat32(encoded string) ([]float64, error) {
+	buf, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(buf)%4 != 0 {
+		return nil, fmt.Errorf("\"embeddingF32\" is not base64 float32 data")
+	}
+	values := make([]float64, len(buf)/4)
+	for i := range values {
+		values[i] = float64(math.Float32frombits(binary.LittleEndian.Uint32(buf[4*i:])))
+	}
+	return values, nil
+}
+
+/* ImportMode says what Import does when the context already exists */
+type ImportMode string
+
+const (
+	/* ImportFail refuses to touch an existing context */
+	ImportFail ImportMode = "fail"
+	/* ImportMerge appends to the existing types, like saving with keep */
+	ImportMerge ImportMode = "merge"
+	/* ImportReplace replaces the types the export holds and leaves the others, like saving without keep */
+	ImportReplace ImportMode = "replace"
+)
+
+var ErrContextExists = errors.New("context already exists")
+
+/*
+Export checks the context exists and brings it to the chunk layout, then returns the function
+that streams it, so a missing context is reported before the response starts.
+*/
+func (s *Service) Export(ctx context.Context, name *string, userID string, encoding EmbeddingEncoding) (func(context.Context, io.Writer) error, error) {
+	header, err := s.header(ctx, name, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.migrate(ctx, header); err != nil {
+		return nil, err
+	}
+	/* Migration may have recorded more of the layout */
+	if header, err = s.header(ctx, name, userID); err != nil {
+		return nil, err
+	}
+	s.touch(ctx, header)
+
+	return func(ctx context.Context, w io.Writer) error {
+		out := newExportWriter(w, encoding)
+		if err := out.header(header, time.Now()); err != nil {
+			return err
+		}
+
+		find := s.chunks.Find(ctx, bson.M{"userId": userID, "context": name}).Sort("type", "source", "_id")
+		if encoding == EncodeNone {
+			find = find.Select(bson.M{"embedding": 0})
+		}
+		cursor := find.Cursor()
+		defer cursor.Close()
+		for {
+			var chunk models.LLMVectorChunk
+			if !cursor.Next(&chunk) {
+				break
+			}
+			if err := out.vector(chunk); err != nil {
+				return err
+			}
+		}
+		return cursor.Err()
+	}, nil
+}
+
+/*
+Import writes file into the named context. An existing context is refused, merged into or has
+the export's types replaced, per mode; merged embeddings must match the model and dimension
+of the type's existing ones.
+*/
+func (s *Service) Import(ctx context.Context, name *string, userID string, file *ImportFile, mode ImportMode) error {
+	header, err := s.header(ctx, name, userID)
+	if err != nil && !errors.Is(err, qmgo.ErrNoSuchDocuments) {
+		return err
+	}
+	if header != nil {
+		switch mode {
+		case ImportFail:
+			return ErrContextExists
+		case ImportMerge:
+			if err := s.migrate(ctx, header); err != nil {
+				return err
+			}
+			if err := s.checkEmbeddings(ctx, header, file); err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(file.Data) == 0 {
+		_, err := s.ensureHeader(ctx, name, userID)
+		return err
+	}
+	keep := mode == ImportMerge
+	for _, contextType := range sortedKeys(file.Data, nil) {
+		if err := s.save(ctx, name, userID, contextType, file.Data[contextType], keep, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/* checkEmbeddings compares each type's import embeddings with those the type already stores */
+func (s *Service) checkEmbeddings(ctx context.Context, header *models.LLMVector, file *ImportFile) error {
+	for _, contextType := range sortedKeys(file.Data, nil) {
+		incoming, err := specOf(contextType, file.Data[contextType])
+		if err != nil {
+			return &ImportError{Message: err.Error()}
+		}
+		if incoming == nil {
+			continue
+		}
+		stored, err := s.storedSpec(ctx, header, contextType)
+		if err != nil {
+			return err
+		}
+		if stored != nil {
+			if err := agree(stored, incoming); err != nil {
+				return &ImportError{Message: err.Error()}
+			}
+		}
+	}
+	return nil
+}
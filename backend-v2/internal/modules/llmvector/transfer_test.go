@@ -0,0 +1,126 @@
+package llmvector
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"backend-v2/internal/models"
+)
+
+func exportOf(t *testing.T, encoding EmbeddingEncoding) []byte {
+	t.Helper()
+	name := "board"
+	header := &models.LLMVector{
+		Name:  &name,
+		Types: []string{"notes", "empty"},
+		Sources: []models.VectorSource{
+			{Type: "notes", Source: "a"},
+			{Type: "notes", Source: "blank"},
+		},
+	}
+	chunks := lexicalChunks("first", "second")
+	chunks[0].Source = "a"
+	chunks[0].Embedding = []float64{0.5, -1.25}
+	chunks[0].Model = "tiny-embed"
+	chunks[1].Source = "a"
+	chunks[1].Metadata = map[string]interface{}{"page": 2.0}
+
+	var out bytes.Buffer
+	writer := newExportWriter(&out, encoding)
+	if err := writer.header(header, time.Unix(0, 0)); err != nil {
+		t.Fatalf("header() error = %v", err)
+	}
+	for _, chunk := range chunks {
+		if err := writer.vector(chunk); err != nil {
+			t.Fatalf("vector() error = %v", err)
+		}
+	}
+	return out.Bytes()
+}
+
+func TestExport_RoundTrip(t *testing.T) {
+	for _, encoding := range []EmbeddingEncoding{EncodeJSON, EncodeBinary, EncodeNone} {
+		data := exportOf(t, encoding)
+		if lines := bytes.Count(data, []byte("\n")); lines != 3 {
+			t.Fatalf("%s export has %d lines, want 3", encoding, lines)
+		}
+		if encoding == EncodeBinary && !bytes.Contains(data, []byte(`"embeddingF32":"AAAAPwAAoL8="`)) {
+			t.Errorf("binary export = %s, want float32 base64", data)
+		}
+
+		file, err := ReadImport(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("ReadImport(%s) error = %v", encoding, err)
+		}
+		if !file.HasHeader || file.Name == nil || *file.Name != "board" || file.Vectors != 2 {
+			t.Errorf("ReadImport(%s) = %+v", encoding, file)
+		}
+
+		var embedding []float64
+		model := ""
+		if encoding != EncodeNone {
+			embedding = []float64{0.5, -1.25}
+			model = "tiny-embed"
+		}
+		want := map[string]map[string][]models.MemoryVector{
+			"notes": {
+				"a": {
+					{Content: "first", Embedding: embedding, Model: model, Metadata: map[string]interface{}{"n": 0.0}},
+					{Content: "second", Metadata: map[string]interface{}{"page": 2.0}},
+				},
+				"blank": {},
+			},
+			"empty": {},
+		}
+		if !reflect.DeepEqual(file.Data, want) {
+			t.Errorf("ReadImport(%s).Data = %v, want %v", encoding, file.Data, want)
+		}
+	}
+}
+
+func TestReadImport_Rejects(t *testing.T) {
+	cases := []struct {
+		name, input, want string
+	}{
+		{"empty", "\n\n", "export is empty"},
+		{"bad json", `{"type":`, "line 1: invalid JSON"},
+		{"late header", `{"type":"t","source":"s","content":"x"}` + "\n" + `{"format":"d5-vector-context","version":1}`, "line 2: header must be the first line"},
+		{"other format", `{"format":"csv","version":1}`, `line 1: unknown format "csv"`},
+		{"missing source", `{"type":"t","content":"x"}`, "line 1: \"type\" and \"source\" are required"},
+		{"hollow vector", `{"type":"t","source":"s"}`, "line 1: vector has neither content nor embedding"},
+		{"bad binary", `{"type":"t","source":"s","embeddingF32":"AAA"}`, "line 1: \"embeddingF32\" is not base64 float32 data"},
+		{"mixed dimensions", `{"type":"t","source":"s","embedding":[1,2]}` + "\n\n" + `{"type":"t","source":"u","embedding":[1,2,3]}`, `line 3: embedding has 3 dimensions, type "t" has 2`},
+		{"mixed models", `{"type":"t","source":"s","embedding":[1,2]}` + "\n" + `{"type":"t","source":"s","embedding":[1,2],"model":"a"}` + "\n" + `{"type":"t","source":"s","embedding":[3,4],"model":"b"}`, `line 3: embedding is from model "b", type "t" has "a"`},
+	}
+	for _, c := range cases {
+		_, err := ReadImport(strings.NewReader(c.input))
+		var importErr *ImportError
+		if !errors.As(err, &importErr) || err.Error() != c.want {
+			t.Errorf("%s: ReadImport() error = %v, want %q", c.name, err, c.want)
+		}
+	}
+
+	/* Dimensions and models may differ between types */
+	_, err := ReadImport(strings.NewReader(`{"type":"a","source":"s","embedding":[1,2],"model":"m"}` + "\n" + `{"type":"b","source":"s","embedding":[1,2,3],"model":"n"}`))
+	if err != nil {
+		t.Errorf("ReadImport() error = %v, want embeddings checked per type", err)
+	}
+}
+
+func TestExportFilename(t *testing.T) {
+	cases := map[string]string{
+		"":                 "context.jsonl",
+		"research-board_1": "research-board_1.jsonl",
+		`a "b"/c`:          "a__b__c.jsonl",
+		"доска":            "_____.jsonl",
+	}
+	for name, want := range cases {
+		if got := exportFilename(name); got != want {
+			t.Errorf("exportFilename(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
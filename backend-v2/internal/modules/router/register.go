@@ -4,10 +4,13 @@ import (
 	"backend-v2/internal/config"
 	"backend-v2/internal/database"
 	"backend-v2/internal/middlewares"
+	"backend-v2/internal/modules/accesstoken"
 	"backend-v2/internal/modules/auth"
 	"backend-v2/internal/modules/clienterror"
 	"backend-v2/internal/modules/gateway"
+	"backend-v2/internal/modules/ingest"
 	"backend-v2/internal/modules/integration"
+	"backend-v2/internal/modules/llm"
 	"backend-v2/internal/modules/llmvector"
 	"backend-v2/internal/modules/macro"
 	"backend-v2/internal/modules/progress"
@@ -16,7 +19,9 @@ import (
 	"backend-v2/internal/modules/template"
 	"backend-v2/internal/modules/unauth"
 	"backend-v2/internal/modules/urlthumbnail"
+	"backend-v2/internal/modules/usage"
 	"backend-v2/internal/modules/user"
+	"backend-v2/internal/modules/webhook"
 	"backend-v2/internal/modules/workflow"
 	"backend-v2/internal/services/container"
 
@@ -29,7 +34,7 @@ func RegisterRoutes(app *fiber.App, db *qmgo.Database, services *container.Servi
 
 	gateway.Register(apiRoot)
 
-	unauthHandler := unauth.NewController()
+	unauthHandler := unauth.NewController(services.VectorIndex.Metrics())
 	unauth.RegisterRoutes(apiRoot, unauthHandler)
 
 	auth.RegisterRoutes(apiRoot, db, services.Email)
@@ -38,7 +43,7 @@ func RegisterRoutes(app *fiber.App, db *qmgo.Database, services *container.Servi
 	api.Use(middlewares.JWTMiddleware)
 	api.Use(middlewares.ExtractUserID)
 
-	workflowService := workflow.NewService(db)
+	workflowService := workflow.NewService(db, services.Events)
 	workflowHandler := workflow.NewHandler(workflowService, db, database.MongoClient)
 	api.Get("/workflow", workflowHandler.GetWorkflows)
 
@@ -50,10 +55,15 @@ func RegisterRoutes(app *fiber.App, db *qmgo.Database, services *container.Servi
 	macro.Register(api, db)
 	integration.Register(api, db, services)
 	user.RegisterRoutes(api, db)
+	accesstoken.Register(api, db)
 	sync.RegisterRoutes(api, db)
-	llmvector.RegisterRoutes(api, db)
+	llmvector.RegisterRoutes(api, db, services.Embedder, services.VectorIndex)
+	ingest.Register(api, db, services)
 	clienterror.RegisterRoutes(api, db)
-	statistics.Register(api, db)
+	statistics.Register(api, db, services.Events, services.Usage)
 	urlthumbnail.RegisterRoutes(api, services.Thumbnail)
 	progress.RegisterRoutes(api)
+	webhook.Register(api, db, services.Events)
+	usage.RegisterRoutes(api, services.Usage)
+	llm.RegisterRoutes(api, services.LLMProxy)
 }
@@ -2,6 +2,8 @@ package statistics
 
 import (
 	"backend-v2/internal/common/response"
+	"backend-v2/internal/services/events"
+	"backend-v2/internal/services/usage"
 	"encoding/json"
 	"strings"
 	"time"
@@ -12,11 +14,26 @@ import (
 )
 
 type Controller struct {
-	db *qmgo.Database
+	db     *qmgo.Database
+	events events.Bus
+	usage  usage.Store
 }
 
-func NewController(db *qmgo.Database) *Controller {
-	return &Controller{db: db}
+func NewController(db *qmgo.Database, bus events.Bus, usageStore usage.Store) *Controller {
+	return &Controller{db: db, events: bus, usage: usageStore}
+}
+
+/* publishApproved announces a waitlist user that has just become a confirmed user */
+func (ctrl *Controller) publishApproved(user bson.M) {
+	if ctrl.events == nil {
+		return
+	}
+	ctrl.events.Publish(events.New(events.UserApproved, map[string]interface{}{
+		"userId": user["id"],
+		"name":   user["name"],
+		"mail":   user["mail"],
+		"roles":  user["roles"],
+	}))
 }
 
 /* Authorization - admin only */
@@ -315,6 +332,48 @@ func (ctrl *Controller) UserStatistics(c *fiber.Ctx) error {
 	return c.JSON(response)
 }
 
+/* GET /statistics/usage - LLM usage of all users (?from=&to=&provider=&model=&userId=&groupBy=user|provider|model|day) */
+func (ctrl *Controller) UsageOverview(c *fiber.Ctx) error {
+	filter, err := usage.FilterFromQuery(c)
+	if err != nil {
+		return response.BadRequest(c, err.Error())
+	}
+	filter.UserID = c.Query("userId")
+
+	groupBy := c.Query("groupBy", "user")
+	if _, ok := usage.GroupFields[groupBy]; !ok {
+		return response.BadRequest(c, "groupBy must be one of user, provider, model, day")
+	}
+
+	totals, err := ctrl.usage.Totals(c.Context(), filter, groupBy)
+	if err != nil {
+		return response.InternalError(c, err.Error())
+	}
+
+	return c.JSON(fiber.Map{
+		"from":    filter.From,
+		"to":      filter.To,
+		"groupBy": groupBy,
+		"totals":  totals,
+	})
+}
+
+/* GET /statistics/usage/:userId - LLM usage report of one user */
+func (ctrl *Controller) UserUsage(c *fiber.Ctx) error {
+	filter, err := usage.FilterFromQuery(c)
+	if err != nil {
+		return response.BadRequest(c, err.Error())
+	}
+	filter.UserID = c.Params("userId")
+
+	report, err := usage.BuildReport(c.Context(), ctrl.usage, filter)
+	if err != nil {
+		return response.InternalError(c, err.Error())
+	}
+
+	return c.JSON(report)
+}
+
 func (ctrl *Controller) UserComment(c *fiber.Ctx) error {
 	userId := c.Params("userId")
 	if userId == "" {
@@ -441,6 +500,8 @@ func (ctrl *Controller) ApproveWaitlistUser(c *fiber.Ctx) error {
 		return c.Status(500).JSON(fiber.Map{"error": "Failed to remove waitlist record"})
 	}
 
+	ctrl.publishApproved(newUser)
+
 	return c.JSON(fiber.Map{"success": true})
 }
 
@@ -525,6 +586,7 @@ func (ctrl *Controller) ActivateUsersBatch(c *fiber.Ctx) error {
 			continue
 		}
 
+		ctrl.publishApproved(newUser)
 		results = append(results, fiber.Map{"id": userId, "success": true})
 	}
 
@@ -1,12 +1,15 @@
 package statistics
 
 import (
+	"backend-v2/internal/services/events"
+	"backend-v2/internal/services/usage"
+
 	"github.com/gofiber/fiber/v2"
 	"github.com/qiniu/qmgo"
 )
 
-func Register(router fiber.Router, db *qmgo.Database) {
-	controller := NewController(db)
+func Register(router fiber.Router, db *qmgo.Database, bus events.Bus, usageStore usage.Store) {
+	controller := NewController(db, bus, usageStore)
 
 	statsGroup := router.Group("/statistics")
 	statsGroup.Use(controller.Authorization)
@@ -18,6 +21,8 @@ func Register(router fiber.Router, db *qmgo.Database) {
 	statsGroup.Get("/workflow/:userId", controller.UserWorkflowStatistics)
 	statsGroup.Get("/users/:userId", controller.UserStatistics)
 	statsGroup.Post("/users/:userId/comment", controller.UserComment)
+	statsGroup.Get("/usage", controller.UsageOverview)
+	statsGroup.Get("/usage/:userId", controller.UserUsage)
 	statsGroup.Get("/waitlist", controller.UserWaitlist)
 	statsGroup.Get("/waitlist/confirm/:waitUserId", controller.ApproveWaitlistUser)
 	statsGroup.Get("/waitlist/reject/:waitUserId", controller.RejectWaitlistUser)
@@ -1,13 +1,23 @@
 package unauth
 
 import (
+	"io"
+	"strings"
+
 	"github.com/gofiber/fiber/v2"
 )
 
-type Controller struct{}
+/* MetricsWriter appends its metrics in the Prometheus text format */
+type MetricsWriter interface {
+	WriteMetrics(w io.Writer)
+}
 
-func NewController() *Controller {
-	return &Controller{}
+type Controller struct {
+	metrics []MetricsWriter
+}
+
+func NewController(metrics ...MetricsWriter) *Controller {
+	return &Controller{metrics: metrics}
 }
 
 /* Health check endpoint for monitoring */
@@ -21,6 +31,12 @@ func (h *Controller) ServeMetrics(c *fiber.Ctx) error {
 	metrics += "# TYPE go_info gauge\n"
 	metrics += "go_info{version=\"go1.21\"} 1\n"
 
+	var extra strings.Builder
+	for _, writer := range h.metrics {
+		writer.WriteMetrics(&extra)
+	}
+	metrics += extra.String()
+
 	c.Set("Content-Type", "text/plain; version=0.0.4")
 	return c.SendString(metrics)
 }
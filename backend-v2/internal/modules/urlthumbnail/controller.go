@@ -1,6 +1,7 @@
 package urlthumbnail
 
 import (
+	"backend-v2/internal/common/http"
 	"backend-v2/internal/common/response"
 	"backend-v2/internal/services/thumbnail"
 
@@ -45,6 +46,9 @@ func (h *Controller) GetThumbnail(c *fiber.Ctx) error {
 	})
 
 	if err != nil {
+		if http.IsBlocked(err) {
+			return response.BadRequest(c, "URL is not allowed")
+		}
 		return response.InternalError(c, err.Error())
 	}
 
@@ -0,0 +1,38 @@
+package usage
+
+import (
+	"backend-v2/internal/common/constants"
+	"backend-v2/internal/common/response"
+	"backend-v2/internal/services/usage"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type Controller struct {
+	store usage.Store
+}
+
+func NewController(store usage.Store) *Controller {
+	return &Controller{store: store}
+}
+
+/* GET /usage - the caller's LLM token usage (?from=&to=&provider=&model=, days as YYYY-MM-DD) */
+func (ctrl *Controller) Mine(c *fiber.Ctx) error {
+	userID, ok := c.Locals(constants.ContextUserIDKey).(string)
+	if !ok || userID == "" {
+		return response.Unauthorized(c, "Authentication needed.")
+	}
+
+	filter, err := usage.FilterFromQuery(c)
+	if err != nil {
+		return response.BadRequest(c, err.Error())
+	}
+	filter.UserID = userID
+
+	report, err := usage.BuildReport(c.Context(), ctrl.store, filter)
+	if err != nil {
+		return response.InternalError(c, err.Error())
+	}
+
+	return c.JSON(report)
+}
@@ -0,0 +1,13 @@
+package usage
+
+import (
+	"backend-v2/internal/services/usage"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func RegisterRoutes(router fiber.Router, store usage.Store) {
+	controller := NewController(store)
+
+	router.Get("/usage", controller.Mine)
+}
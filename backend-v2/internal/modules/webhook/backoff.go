@@ -0,0 +1,35 @@
+package webhook
+
+import (
+	"math/rand"
+	"time"
+)
+
+const (
+	/* MaxAttempts bounds delivery attempts before a delivery is marked failed */
+	MaxAttempts = 8
+
+	backoffBase = 10 * time.Second
+	backoffCap  = 6 * time.Hour
+)
+
+/* Backoff returns the delay before the next attempt: base * 2^(attempt-1), capped, with up to 20% jitter */
+func Backoff(attempt int) time.Duration {
+	return backoffWithJitter(attempt, rand.Float64())
+}
+
+func backoffWithJitter(attempt int, jitter float64) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+
+	delay := backoffBase
+	for i := 1; i < attempt && delay < backoffCap; i++ {
+		delay *= 2
+	}
+	if delay > backoffCap {
+		delay = backoffCap
+	}
+
+	return delay + time.Duration(float64(delay)*0.2*jitter)
+}
@@ -0,0 +1,216 @@
+package webhook
+
+import (
+	"backend-v2/internal/common/constants"
+	"backend-v2/internal/common/response"
+	"backend-v2/internal/common/utils"
+	"backend-v2/internal/services/events"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/qiniu/qmgo"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Controller struct {
+	service    *Service
+	dispatcher *Dispatcher
+}
+
+func NewController(service *Service, dispatcher *Dispatcher) *Controller {
+	return &Controller{service: service, dispatcher: dispatcher}
+}
+
+/* Authorization - admin only, subscriptions see events of every user */
+func (ctrl *Controller) Authorization(c *fiber.Ctx) error {
+	roles, ok := c.Locals("roles").([]string)
+	if !ok || !utils.Contains(roles, string(constants.Administrator)) {
+		return response.Forbidden(c, "This endpoint is only available for administrators.")
+	}
+	return c.Next()
+}
+
+/* GET /webhooks/events - list subscribable event types */
+func (ctrl *Controller) EventTypes(c *fiber.Ctx) error {
+	return c.JSON(events.KnownTypes)
+}
+
+/* GET /webhooks - list subscriptions (secrets omitted) */
+func (ctrl *Controller) List(c *fiber.Ctx) error {
+	subscriptions, err := ctrl.service.List(c.Context())
+	if err != nil {
+		return response.InternalError(c, err.Error())
+	}
+
+	for i := range subscriptions {
+		subscriptions[i].Secret = ""
+	}
+	return c.JSON(subscriptions)
+}
+
+/* POST /webhooks - register endpoint; the signing secret is only returned here */
+func (ctrl *Controller) Create(c *fiber.Ctx) error {
+	userID, _ := c.Locals(constants.ContextUserIDKey).(string)
+
+	var input SubscriptionInput
+	if err := c.BodyParser(&input); err != nil {
+		return response.BadRequest(c, "Invalid request body")
+	}
+
+	subscription, err := ctrl.service.Create(c.Context(), userID, input)
+	if err == ErrInvalidURL || err == ErrInvalidEvents {
+		return response.BadRequest(c, err.Error())
+	}
+	if err != nil {
+		return response.InternalError(c, err.Error())
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(subscription)
+}
+
+/* GET /webhooks/:id */
+func (ctrl *Controller) Get(c *fiber.Ctx) error {
+	id, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return response.BadRequest(c, "Invalid subscription ID")
+	}
+
+	subscription, err := ctrl.service.Get(c.Context(), id)
+	if err == qmgo.ErrNoSuchDocuments {
+		return response.NotFound(c, "Subscription not found")
+	}
+	if err != nil {
+		return response.InternalError(c, err.Error())
+	}
+
+	subscription.Secret = ""
+	return c.JSON(subscription)
+}
+
+/* PUT /webhooks/:id */
+func (ctrl *Controller) Update(c *fiber.Ctx) error {
+	id, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return response.BadRequest(c, "Invalid subscription ID")
+	}
+
+	var input SubscriptionInput
+	if err := c.BodyParser(&input); err != nil {
+		return response.BadRequest(c, "Invalid request body")
+	}
+
+	subscription, err := ctrl.service.Update(c.Context(), id, input)
+	if err == ErrInvalidURL || err == ErrInvalidEvents {
+		return response.BadRequest(c, err.Error())
+	}
+	if err == qmgo.ErrNoSuchDocuments {
+		return response.NotFound(c, "Subscription not found")
+	}
+	if err != nil {
+		return response.InternalError(c, err.Error())
+	}
+
+	subscription.Secret = ""
+	return c.JSON(subscription)
+}
+
+/* POST /webhooks/:id/secret - rotate signing secret */
+func (ctrl *Controller) RotateSecret(c *fiber.Ctx) error {
+	id, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return response.BadRequest(c, "Invalid subscription ID")
+	}
+
+	subscription, err := ctrl.service.RotateSecret(c.Context(), id)
+	if err == qmgo.ErrNoSuchDocuments {
+		return response.NotFound(c, "Subscription not found")
+	}
+	if err != nil {
+		return response.InternalError(c, err.Error())
+	}
+
+	return c.JSON(subscription)
+}
+
+/* DELETE /webhooks/:id */
+func (ctrl *Controller) Delete(c *fiber.Ctx) error {
+	id, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return response.BadRequest(c, "Invalid subscription ID")
+	}
+
+	err = ctrl.service.Delete(c.Context(), id)
+	if err == qmgo.ErrNoSuchDocuments {
+		return response.NotFound(c, "Subscription not found")
+	}
+	if err != nil {
+		return response.InternalError(c, err.Error())
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+/* GET /webhooks/:id/deliveries - delivery log with pagination */
+func (ctrl *Controller) Deliveries(c *fiber.Ctx) error {
+	id, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return response.BadRequest(c, "Invalid subscription ID")
+	}
+
+	page := c.QueryInt("page", 1)
+	if page < 1 {
+		page = 1
+	}
+	limit := c.QueryInt("limit", 20)
+	if limit < 1 {
+		limit = 20
+	}
+
+	deliveries, total, err := ctrl.service.ListDeliveries(c.Context(), id, c.Query("status"), page, limit)
+	if err != nil {
+		return response.InternalError(c, err.Error())
+	}
+
+	return c.JSON(fiber.Map{
+		"total": total,
+		"page":  page,
+		"limit": limit,
+		"data":  deliveries,
+	})
+}
+
+/* GET /webhooks/deliveries/:deliveryId */
+func (ctrl *Controller) GetDelivery(c *fiber.Ctx) error {
+	id, err := primitive.ObjectIDFromHex(c.Params("deliveryId"))
+	if err != nil {
+		return response.BadRequest(c, "Invalid delivery ID")
+	}
+
+	delivery, err := ctrl.service.GetDelivery(c.Context(), id)
+	if err == qmgo.ErrNoSuchDocuments {
+		return response.NotFound(c, "Delivery not found")
+	}
+	if err != nil {
+		return response.InternalError(c, err.Error())
+	}
+
+	return c.JSON(delivery)
+}
+
+/* POST /webhooks/deliveries/:deliveryId/replay - resend a logged event */
+func (ctrl *Controller) Replay(c *fiber.Ctx) error {
+	id, err := primitive.ObjectIDFromHex(c.Params("deliveryId"))
+	if err != nil {
+		return response.BadRequest(c, "Invalid delivery ID")
+	}
+
+	delivery, err := ctrl.service.Replay(c.Context(), id)
+	if err == qmgo.ErrNoSuchDocuments {
+		return response.NotFound(c, "Delivery not found")
+	}
+	if err != nil {
+		return response.InternalError(c, err.Error())
+	}
+
+	ctrl.dispatcher.Wake()
+	return c.Status(fiber.StatusAccepted).JSON(delivery)
+}
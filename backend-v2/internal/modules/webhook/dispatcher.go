@@ -0,0 +1,240 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	nethttp "net/http"
+	"time"
+
+	"backend-v2/internal/common/http"
+	"backend-v2/internal/common/logger"
+	"backend-v2/internal/models"
+	"backend-v2/internal/services/events"
+
+	"github.com/qiniu/qmgo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var log = logger.New("WEBHOOK")
+
+const (
+	deliveryTimeout = 10 * time.Second
+	pollInterval    = 15 * time.Second
+
+	/* Deliveries stuck in progress longer than this (e.g. instance crashed) are reclaimed */
+	staleClaimAfter = 2 * time.Minute
+
+	/* Only the head of the endpoint response is kept in the delivery log */
+	maxLoggedResponse = 1024
+)
+
+/* Dispatcher turns bus events into persisted deliveries and sends them with retries */
+type Dispatcher struct {
+	subscriptions *qmgo.Collection
+	deliveries    *qmgo.Collection
+	client        http.Client
+	wake          chan struct{}
+}
+
+func NewDispatcher(db *qmgo.Database) *Dispatcher {
+	return &Dispatcher{
+		subscriptions: db.Collection("webhooksubscriptions"),
+		deliveries:    db.Collection("webhookdeliveries"),
+		client:        http.NewClientFactory().Create(deliveryTimeout),
+		wake:          make(chan struct{}, 1),
+	}
+}
+
+/* HandleEvent records one pending delivery per matching active subscription */
+func (d *Dispatcher) HandleEvent(event events.Event) {
+	ctx := context.Background()
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		log.Error("marshal event %s: %v", event.ID, err)
+		return
+	}
+
+	filter := bson.M{
+		"active": true,
+		"events": bson.M{"$in": []string{string(event.Type), string(events.Wildcard)}},
+	}
+
+	var subscriptions []models.WebhookSubscription
+	if err := d.subscriptions.Find(ctx, filter).All(&subscriptions); err != nil {
+		log.Error("load subscriptions for %s: %v", event.Type, err)
+		return
+	}
+	if len(subscriptions) == 0 {
+		return
+	}
+
+	now := time.Now()
+	for _, subscription := range subscriptions {
+		delivery := models.WebhookDelivery{
+			ID:             primitive.NewObjectID(),
+			SubscriptionID: subscription.ID,
+			EventID:        event.ID,
+			EventType:      string(event.Type),
+			Payload:        string(payload),
+			Status:         models.WebhookDeliveryPending,
+			NextAttemptAt:  now,
+			CreatedAt:      now,
+			UpdatedAt:      now,
+		}
+		if _, err := d.deliveries.InsertOne(ctx, delivery); err != nil {
+			log.Error("enqueue delivery for subscription %s: %v", subscription.ID.Hex(), err)
+		}
+	}
+
+	d.Wake()
+}
+
+/* Wake asks the worker loop to process due deliveries without waiting for the next tick */
+func (d *Dispatcher) Wake() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+/* Run processes due deliveries until ctx is cancelled */
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		d.drain(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-d.wake:
+		}
+	}
+}
+
+func (d *Dispatcher) drain(ctx context.Context) {
+	for ctx.Err() == nil {
+		delivery, err := d.claimNext(ctx)
+		if err == qmgo.ErrNoSuchDocuments {
+			return
+		}
+		if err != nil {
+			log.Error("claim delivery: %v", err)
+			return
+		}
+		d.attempt(ctx, delivery)
+	}
+}
+
+/* claimNext atomically moves one due delivery to in_progress so concurrent instances never send it twice */
+func (d *Dispatcher) claimNext(ctx context.Context) (*models.WebhookDelivery, error) {
+	now := time.Now()
+	filter := bson.M{
+		"$or": []bson.M{
+			{"status": models.WebhookDeliveryPending, "nextAttemptAt": bson.M{"$lte": now}},
+			{"status": models.WebhookDeliveryInProgress, "updatedAt": bson.M{"$lt": now.Add(-staleClaimAfter)}},
+		},
+	}
+	change := qmgo.Change{
+		Update:    bson.M{"$set": bson.M{"status": models.WebhookDeliveryInProgress, "updatedAt": now}},
+		ReturnNew: true,
+	}
+
+	var delivery models.WebhookDelivery
+	if err := d.deliveries.Find(ctx, filter).Sort("nextAttemptAt").Apply(change, &delivery); err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+func (d *Dispatcher) attempt(ctx context.Context, delivery *models.WebhookDelivery) {
+	var subscription models.WebhookSubscription
+	err := d.subscriptions.Find(ctx, bson.M{"_id": delivery.SubscriptionID}).One(&subscription)
+	if err != nil || !subscription.Active {
+		d.finish(ctx, delivery, models.WebhookDeliveryFailed, 0, "subscription removed or inactive")
+		return
+	}
+
+	statusCode, sendErr := d.send(ctx, &subscription, delivery)
+	attempts := delivery.Attempts + 1
+
+	if sendErr == nil {
+		d.record(ctx, delivery.ID, bson.M{
+			"status":         models.WebhookDeliverySucceeded,
+			"attempts":       attempts,
+			"responseStatus": statusCode,
+			"lastError":      "",
+		})
+		return
+	}
+
+	if attempts >= MaxAttempts {
+		log.Warn("delivery %s to %s failed permanently after %d attempts: %v", delivery.ID.Hex(), subscription.URL, attempts, sendErr)
+		d.record(ctx, delivery.ID, bson.M{
+			"status":         models.WebhookDeliveryFailed,
+			"attempts":       attempts,
+			"responseStatus": statusCode,
+			"lastError":      sendErr.Error(),
+		})
+		return
+	}
+
+	d.record(ctx, delivery.ID, bson.M{
+		"status":         models.WebhookDeliveryPending,
+		"attempts":       attempts,
+		"responseStatus": statusCode,
+		"lastError":      sendErr.Error(),
+		"nextAttemptAt":  time.Now().Add(Backoff(attempts)),
+	})
+}
+
+func (d *Dispatcher) send(ctx context.Context, subscription *models.WebhookSubscription, delivery *models.WebhookDelivery) (int, error) {
+	body := []byte(delivery.Payload)
+
+	req, err := nethttp.NewRequestWithContext(ctx, nethttp.MethodPost, subscription.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "D5-Webhooks/1.0")
+	req.Header.Set(HeaderEvent, delivery.EventType)
+	req.Header.Set(HeaderEventID, delivery.EventID)
+	req.Header.Set(HeaderDeliveryID, delivery.ID.Hex())
+	req.Header.Set(HeaderSignature, Sign(subscription.Secret, time.Now(), body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("execute request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	head, _ := io.ReadAll(io.LimitReader(resp.Body, maxLoggedResponse))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("endpoint responded %d: %s", resp.StatusCode, head)
+	}
+	return resp.StatusCode, nil
+}
+
+func (d *Dispatcher) finish(ctx context.Context, delivery *models.WebhookDelivery, status models.WebhookDeliveryStatus, statusCode int, message string) {
+	d.record(ctx, delivery.ID, bson.M{
+		"status":         status,
+		"responseStatus": statusCode,
+		"lastError":      message,
+	})
+}
+
+func (d *Dispatcher) record(ctx context.Context, id primitive.ObjectID, fields bson.M) {
+	fields["updatedAt"] = time.Now()
+	if err := d.deliveries.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": fields}); err != nil {
+		log.Error("update delivery %s: %v", id.Hex(), err)
+	}
+}
@@ -0,0 +1,36 @@
+package webhook
+
+import (
+	"context"
+
+	"backend-v2/internal/middlewares"
+	"backend-v2/internal/services/events"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/qiniu/qmgo"
+)
+
+func Register(router fiber.Router, db *qmgo.Database, bus events.Bus) {
+	service := NewService(db)
+	dispatcher := NewDispatcher(db)
+	controller := NewController(service, dispatcher)
+
+	/* Every domain event is fanned out to matching subscriptions */
+	bus.Subscribe(events.Wildcard, dispatcher.HandleEvent)
+	go dispatcher.Run(context.Background())
+
+	group := router.Group("/webhooks", middlewares.RequireAuth, controller.Authorization)
+
+	group.Get("/events", controller.EventTypes)
+	group.Get("/", controller.List)
+	group.Post("/", controller.Create)
+
+	group.Get("/deliveries/:deliveryId", controller.GetDelivery)
+	group.Post("/deliveries/:deliveryId/replay", controller.Replay)
+
+	group.Get("/:id", controller.Get)
+	group.Put("/:id", controller.Update)
+	group.Delete("/:id", controller.Delete)
+	group.Post("/:id/secret", controller.RotateSecret)
+	group.Get("/:id/deliveries", controller.Deliveries)
+}
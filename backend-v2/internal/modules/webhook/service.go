@@ -0,0 +1,210 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"time"
+
+	"backend-v2/internal/models"
+	"backend-v2/internal/services/events"
+
+	"github.com/qiniu/qmgo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrInvalidURL    = errors.New("url must be an absolute http(s) URL")
+	ErrInvalidEvents = errors.New("events must be a non-empty list of known event types")
+)
+
+type Service struct {
+	subscriptions *qmgo.Collection
+	deliveries    *qmgo.Collection
+}
+
+func NewService(db *qmgo.Database) *Service {
+	return &Service{
+		subscriptions: db.Collection("webhooksubscriptions"),
+		deliveries:    db.Collection("webhookdeliveries"),
+	}
+}
+
+/* SubscriptionInput carries user-editable subscription fields; nil means "not provided" */
+type SubscriptionInput struct {
+	URL    *string   `json:"url"`
+	Events *[]string `json:"events"`
+	Active *bool     `json:"active"`
+}
+
+func (s *Service) List(ctx context.Context) ([]models.WebhookSubscription, error) {
+	subscriptions := []models.WebhookSubscription{}
+	err := s.subscriptions.Find(ctx, bson.M{}).Sort("-createdAt").All(&subscriptions)
+	return subscriptions, err
+}
+
+func (s *Service) Get(ctx context.Context, id primitive.ObjectID) (*models.WebhookSubscription, error) {
+	var subscription models.WebhookSubscription
+	if err := s.subscriptions.Find(ctx, bson.M{"_id": id}).One(&subscription); err != nil {
+		return nil, err
+	}
+	return &subscription, nil
+}
+
+func (s *Service) Create(ctx context.Context, userID string, input SubscriptionInput) (*models.WebhookSubscription, error) {
+	if input.URL == nil || validateURL(*input.URL) != nil {
+		return nil, ErrInvalidURL
+	}
+	if input.Events == nil || validateEvents(*input.Events) != nil {
+		return nil, ErrInvalidEvents
+	}
+
+	secret, err := GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	active := true
+	if input.Active != nil {
+		active = *input.Active
+	}
+
+	now := time.Now()
+	subscription := models.WebhookSubscription{
+		ID:        primitive.NewObjectID(),
+		UserID:    userID,
+		URL:       *input.URL,
+		Events:    *input.Events,
+		Secret:    secret,
+		Active:    active,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	if _, err := s.subscriptions.InsertOne(ctx, subscription); err != nil {
+		return nil, err
+	}
+	return &subscription, nil
+}
+
+func (s *Service) Update(ctx context.Context, id primitive.ObjectID, input SubscriptionInput) (*models.WebhookSubscription, error) {
+	setDoc := bson.M{"updatedAt": time.Now()}
+
+	if input.URL != nil {
+		if err := validateURL(*input.URL); err != nil {
+			return nil, err
+		}
+		setDoc["url"] = *input.URL
+	}
+	if input.Events != nil {
+		if err := validateEvents(*input.Events); err != nil {
+			return nil, err
+		}
+		setDoc["events"] = *input.Events
+	}
+	if input.Active != nil {
+		setDoc["active"] = *input.Active
+	}
+
+	if err := s.subscriptions.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": setDoc}); err != nil {
+		return nil, err
+	}
+	return s.Get(ctx, id)
+}
+
+/* RotateSecret replaces the signing secret; the new secret is returned once */
+func (s *Service) RotateSecret(ctx context.Context, id primitive.ObjectID) (*models.WebhookSubscription, error) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	update := bson.M{"$set": bson.M{"secret": secret, "updatedAt": time.Now()}}
+	if err := s.subscriptions.UpdateOne(ctx, bson.M{"_id": id}, update); err != nil {
+		return nil, err
+	}
+	return s.Get(ctx, id)
+}
+
+func (s *Service) Delete(ctx context.Context, id primitive.ObjectID) error {
+	if err := s.subscriptions.Remove(ctx, bson.M{"_id": id}); err != nil {
+		return err
+	}
+	_, err := s.deliveries.RemoveAll(ctx, bson.M{"subscriptionId": id})
+	return err
+}
+
+func (s *Service) ListDeliveries(ctx context.Context, subscriptionID primitive.ObjectID, status string, page, limit int) ([]models.WebhookDelivery, int64, error) {
+	filter := bson.M{"subscriptionId": subscriptionID}
+	if status != "" {
+		filter["status"] = status
+	}
+
+	total, err := s.deliveries.Find(ctx, filter).Count()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	deliveries := []models.WebhookDelivery{}
+	err = s.deliveries.Find(ctx, filter).
+		Sort("-createdAt").
+		Skip(int64((page - 1) * limit)).
+		Limit(int64(limit)).
+		All(&deliveries)
+	return deliveries, total, err
+}
+
+func (s *Service) GetDelivery(ctx context.Context, id primitive.ObjectID) (*models.WebhookDelivery, error) {
+	var delivery models.WebhookDelivery
+	if err := s.deliveries.Find(ctx, bson.M{"_id": id}).One(&delivery); err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+/* Replay enqueues a fresh delivery of the same event payload, keeping the original log intact */
+func (s *Service) Replay(ctx context.Context, id primitive.ObjectID) (*models.WebhookDelivery, error) {
+	original, err := s.GetDelivery(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	replay := models.WebhookDelivery{
+		ID:             primitive.NewObjectID(),
+		SubscriptionID: original.SubscriptionID,
+		EventID:        original.EventID,
+		EventType:      original.EventType,
+		Payload:        original.Payload,
+		Status:         models.WebhookDeliveryPending,
+		NextAttemptAt:  now,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+
+	if _, err := s.deliveries.InsertOne(ctx, replay); err != nil {
+		return nil, err
+	}
+	return &replay, nil
+}
+
+func validateURL(raw string) error {
+	parsed, err := url.Parse(raw)
+	if err != nil || parsed.Host == "" || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return ErrInvalidURL
+	}
+	return nil
+}
+
+func validateEvents(eventTypes []string) error {
+	if len(eventTypes) == 0 {
+		return ErrInvalidEvents
+	}
+	for _, eventType := range eventTypes {
+		if eventType != string(events.Wildcard) && !events.IsKnownType(events.Type(eventType)) {
+			return ErrInvalidEvents
+		}
+	}
+	return nil
+}
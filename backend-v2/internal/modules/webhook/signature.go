@@ -0,0 +1,74 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	HeaderSignature  = "X-D5-Signature"
+	HeaderEvent      = "X-D5-Event"
+	HeaderEventID    = "X-D5-Event-Id"
+	HeaderDeliveryID = "X-D5-Delivery"
+
+	secretPrefix = "whsec_"
+)
+
+/* GenerateSecret creates a random signing secret for a new subscription */
+func GenerateSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("crypto/rand.Read failed: %w", err)
+	}
+	return secretPrefix + hex.EncodeToString(buf), nil
+}
+
+/* Sign computes the signature header value: t=<unix>,v1=<hex(HMAC-SHA256(secret, "<unix>.<body>"))> */
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	ts := strconv.FormatInt(timestamp.Unix(), 10)
+	return fmt.Sprintf("t=%s,v1=%s", ts, computeMAC(secret, ts, body))
+}
+
+/* Verify checks a signature header produced by Sign, rejecting timestamps older than tolerance */
+func Verify(secret, header string, body []byte, tolerance time.Duration, now time.Time) bool {
+	var ts, mac string
+	for _, part := range strings.Split(header, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "t":
+			ts = value
+		case "v1":
+			mac = value
+		}
+	}
+	if ts == "" || mac == "" {
+		return false
+	}
+
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return false
+	}
+	if tolerance > 0 && now.Sub(time.Unix(unix, 0)) > tolerance {
+		return false
+	}
+
+	return hmac.Equal([]byte(mac), []byte(computeMAC(secret, ts, body)))
+}
+
+func computeMAC(secret, ts string, body []byte) string {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(ts))
+	h.Write([]byte("."))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
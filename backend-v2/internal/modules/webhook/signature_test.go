@@ -0,0 +1,104 @@
+package webhook
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSign_Format(t *testing.T) {
+	ts := time.Unix(1700000000, 0)
+	header := Sign("whsec_test", ts, []byte(`{"id":"evt"}`))
+
+	if !strings.HasPrefix(header, "t=1700000000,v1=") {
+		t.Fatalf("Sign() header = %q, want t=1700000000,v1=<mac>", header)
+	}
+	if len(header) != len("t=1700000000,v1=")+64 {
+		t.Errorf("Sign() mac length = %d, want 64 hex chars", len(header)-len("t=1700000000,v1="))
+	}
+}
+
+func TestVerify_RoundTrip(t *testing.T) {
+	body := []byte(`{"type":"workflow.created"}`)
+	now := time.Now()
+	header := Sign("secret", now, body)
+
+	if !Verify("secret", header, body, 5*time.Minute, now) {
+		t.Error("Verify() rejected its own signature")
+	}
+}
+
+func TestVerify_Rejects(t *testing.T) {
+	body := []byte(`{"type":"workflow.created"}`)
+	now := time.Now()
+	header := Sign("secret", now, body)
+
+	tests := []struct {
+		name   string
+		secret string
+		header string
+		body   []byte
+		now    time.Time
+	}{
+		{"wrong secret", "other", header, body, now},
+		{"tampered body", "secret", header, []byte(`{"type":"workflow.deleted"}`), now},
+		{"expired timestamp", "secret", header, body, now.Add(10 * time.Minute)},
+		{"missing mac", "secret", "t=123", body, now},
+		{"garbage header", "secret", "nonsense", body, now},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if Verify(tt.secret, tt.header, tt.body, 5*time.Minute, tt.now) {
+				t.Error("Verify() accepted invalid signature")
+			}
+		})
+	}
+}
+
+func TestGenerateSecret_Unique(t *testing.T) {
+	a, err := GenerateSecret()
+	if err != nil {
+		t.Fatalf("GenerateSecret() error = %v", err)
+	}
+	b, _ := GenerateSecret()
+
+	if !strings.HasPrefix(a, secretPrefix) {
+		t.Errorf("secret %q missing prefix", a)
+	}
+	if a == b {
+		t.Error("GenerateSecret() returned identical secrets")
+	}
+}
+
+func TestBackoff_Exponential(t *testing.T) {
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{0, 10 * time.Second},
+		{1, 10 * time.Second},
+		{2, 20 * time.Second},
+		{3, 40 * time.Second},
+		{6, 320 * time.Second},
+		{30, backoffCap},
+	}
+
+	for _, tt := range tests {
+		if got := backoffWithJitter(tt.attempt, 0); got != tt.want {
+			t.Errorf("backoff(%d) = %v, want %v", tt.attempt, got, tt.want)
+		}
+	}
+}
+
+func TestBackoff_JitterBounded(t *testing.T) {
+	for attempt := 1; attempt <= MaxAttempts; attempt++ {
+		base := backoffWithJitter(attempt, 0)
+		max := backoffWithJitter(attempt, 1)
+		got := Backoff(attempt)
+
+		if got < base || got > max {
+			t.Errorf("Backoff(%d) = %v, want within [%v, %v]", attempt, got, base, max)
+		}
+	}
+}
@@ -10,21 +10,35 @@ import (
 	"backend-v2/internal/common/errors"
 	"backend-v2/internal/common/utils"
 	"backend-v2/internal/models"
+	"backend-v2/internal/services/events"
 
 	"github.com/qiniu/qmgo"
-	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type WorkflowService struct {
 	Collection *qmgo.Collection
+	events     events.Bus
 }
 
-func NewService(db *qmgo.Database) *WorkflowService {
+func NewService(db *qmgo.Database, bus events.Bus) *WorkflowService {
 	return &WorkflowService{
 		Collection: db.Collection("workflows"),
+		events:     bus,
 	}
 }
 
+/* publish emits a workflow domain event; a nil bus disables publishing */
+func (s *WorkflowService) publish(eventType events.Type, workflowId string, data map[string]interface{}) {
+	if s.events == nil {
+		return
+	}
+	if data == nil {
+		data = map[string]interface{}{}
+	}
+	data["workflowId"] = workflowId
+	s.events.Publish(events.New(eventType, data))
+}
+
 func (s *WorkflowService) GetByWorkflowID(ctx context.Context, workflowId string) (*models.Workflow, error) {
 	var wf models.Workflow
 	err := s.Collection.Find(ctx, map[string]string{"workflowId": workflowId}).One(&wf)
@@ -71,6 +85,14 @@ func (s *WorkflowService) UpdateWorkflow(ctx context.Context, workflowId string,
 		return err
 	}
 
+	fields := make([]string, 0, len(setDoc))
+	for field := range setDoc {
+		if field != "updatedAt" {
+			fields = append(fields, field)
+		}
+	}
+	s.publish(events.WorkflowUpdated, workflowId, map[string]interface{}{"fields": fields})
+
 	return nil
 }
 
@@ -194,6 +216,8 @@ func (s *WorkflowService) CreateWorkflow(ctx context.Context, dto CreateWorkflow
 		return nil, errors.NewHTTPError(500, "Failed to insert workflow into database")
 	}
 
+	s.publish(events.WorkflowCreated, workflowId, map[string]interface{}{"userId": dto.UserID})
+
 	return &data, nil
 }
 
@@ -210,6 +234,8 @@ func (s *WorkflowService) DeleteWorkflow(ctx context.Context, workflowId string,
 		return errors.NewHTTPError(500, "Can not remove")
 	}
 
+	s.publish(events.WorkflowDeleted, workflowId, nil)
+
 	return nil
 }
 
@@ -290,6 +316,11 @@ func (s *WorkflowService) SetShareAccess(
 		return errors.NewHTTPError(500, err.Error())
 	}
 
+	s.publish(events.WorkflowShared, workflow.WorkflowID, map[string]interface{}{
+		"userId": workflow.UserID,
+		"access": update,
+	})
+
 	return nil
 }
 
@@ -331,20 +362,27 @@ func (s *WorkflowService) SetSharePublic(
 		return errors.NewHTTPError(500, err.Error())
 	}
 
+	s.publish(events.WorkflowShared, workflow.WorkflowID, map[string]interface{}{
+		"userId": workflow.UserID,
+		"public": update,
+	})
+
 	return nil
 }
 
-func (s *WorkflowService) CreateWorkflowFromTemplate(ctx context.Context, template *models.WorkflowTemplate, userId string) (*models.WorkflowTemplate, *errors.HTTPError) {
-	data := models.WorkflowTemplate{
-		TemplateID:      primitive.NewObjectID(),
-		UserID:          userId,
-		Name:            template.Name,
-		Keywords:        template.Keywords,
-		Root:            template.Root,
-		Share:           template.Share,
-		BackgroundImage: template.BackgroundImage,
-		Nodes:           template.Nodes,
-		Edges:           template.Edges,
+/* CreateWorkflowFromTemplate copies a template's graph into a new private workflow of the user */
+func (s *WorkflowService) CreateWorkflowFromTemplate(ctx context.Context, template *models.WorkflowTemplate, userId string) (*models.Workflow, *errors.HTTPError) {
+	data := models.Workflow{
+		UserID:     userId,
+		WorkflowID: utils.GenerateID(),
+		Title:      template.Name,
+		UpdatedAt:  time.Now().Unix() * 1000, // Milliseconds timestamp for frontend compatibility
+		Nodes:      template.Nodes,
+		Edges:      template.Edges,
+		Root:       template.Root,
+		Share: models.Share{
+			Access: make([]models.RoleBinding, 0),
+		},
 	}
 
 	_, err := s.Collection.InsertOne(ctx, data)
@@ -352,5 +390,10 @@ func (s *WorkflowService) CreateWorkflowFromTemplate(ctx context.Context, templa
 		return nil, errors.NewHTTPError(500, err.Error())
 	}
 
+	s.publish(events.WorkflowCreated, data.WorkflowID, map[string]interface{}{
+		"userId":     userId,
+		"templateId": template.TemplateID.Hex(),
+	})
+
 	return &data, nil
 }
@@ -0,0 +1,27 @@
+package apikey
+
+import "strings"
+
+const (
+	/* MaskPrefix starts every masked key; provider keys never begin with it */
+	MaskPrefix = "****"
+
+	maskVisibleChars = 4
+	maskMinLength    = 12
+)
+
+/* Mask hides an API key, keeping the last 4 characters of keys long enough to stay unguessable */
+func Mask(key string) string {
+	if key == "" {
+		return ""
+	}
+	if len(key) < maskMinLength {
+		return MaskPrefix
+	}
+	return MaskPrefix + key[len(key)-maskVisibleChars:]
+}
+
+/* IsMasked reports whether a value is a masked key echoed back by a client */
+func IsMasked(key string) bool {
+	return strings.HasPrefix(key, MaskPrefix)
+}
@@ -0,0 +1,26 @@
+package apikey
+
+import "testing"
+
+func TestMask(t *testing.T) {
+	cases := map[string]string{
+		"":                         "",
+		"short":                    MaskPrefix,
+		"sk-proj-1234567890abcd":   MaskPrefix + "abcd",
+		"sk-ant-api03-xyz-999wxyz": MaskPrefix + "wxyz",
+	}
+	for key, want := range cases {
+		if got := Mask(key); got != want {
+			t.Errorf("Mask(%q) = %q, want %q", key, got, want)
+		}
+	}
+}
+
+func TestIsMasked(t *testing.T) {
+	if !IsMasked(Mask("sk-proj-1234567890abcd")) {
+		t.Error("Masked key should be detected as masked")
+	}
+	if IsMasked("sk-proj-1234567890abcd") || IsMasked("") {
+		t.Error("Plain or empty key should not be detected as masked")
+	}
+}
@@ -8,11 +8,25 @@ import (
 	"fmt"
 )
 
+/* ErrNotConfigured is returned when the user's integration lacks the requested key */
+var ErrNotConfigured = errors.New("API key not configured")
+
 /* Provider abstracts API key retrieval for external services */
 type Provider interface {
+	GetOpenAIConfig(ctx context.Context, userID string) (*models.OpenAIConfig, error)
 	GetYandexConfig(ctx context.Context, userID string) (*models.YandexConfig, error)
 	GetClaudeConfig(ctx context.Context, userID string) (*models.ClaudeConfig, error)
 	GetPerplexityConfig(ctx context.Context, userID string) (*models.PerplexityConfig, error)
+	GetQwenConfig(ctx context.Context, userID string) (*models.QwenConfig, error)
+	GetDeepseekConfig(ctx context.Context, userID string) (*models.DeepseekConfig, error)
+	GetCustomLLMConfig(ctx context.Context, userID string) (*models.CustomLLMConfig, error)
+	GetLocalConfig(ctx context.Context, userID string) (*models.LocalLLMConfig, error)
+
+	/* GetAPIKey resolves the key of an integration service by its document field name (e.g. "openai") */
+	GetAPIKey(ctx context.Context, userID, service string) (string, error)
+
+	/* GetFallbacks returns the user's LLM fallback chain as "provider:model" entries */
+	GetFallbacks(ctx context.Context, userID string) ([]string, error)
 }
 
 /* IntegrationProvider retrieves API keys from Integration repository */
@@ -24,15 +38,37 @@ func NewIntegrationProvider(repo integration.Repository) Provider {
 	return &IntegrationProvider{repo: repo}
 }
 
-/* GetYandexConfig retrieves Yandex API configuration for user */
-func (p *IntegrationProvider) GetYandexConfig(ctx context.Context, userID string) (*models.YandexConfig, error) {
+func (p *IntegrationProvider) find(ctx context.Context, userID string) (*models.Integration, error) {
 	integration, err := p.repo.FindByUserID(ctx, userID)
 	if err != nil {
 		return nil, fmt.Errorf("integration not found for user: %w", err)
 	}
+	return integration, nil
+}
+
+/* GetOpenAIConfig retrieves OpenAI API configuration for user */
+func (p *IntegrationProvider) GetOpenAIConfig(ctx context.Context, userID string) (*models.OpenAIConfig, error) {
+	integration, err := p.find(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if integration.OpenAI == nil || integration.OpenAI.APIKey == "" {
+		return nil, fmt.Errorf("openai %w", ErrNotConfigured)
+	}
+
+	return integration.OpenAI, nil
+}
+
+/* GetYandexConfig retrieves Yandex API configuration for user */
+func (p *IntegrationProvider) GetYandexConfig(ctx context.Context, userID string) (*models.YandexConfig, error) {
+	integration, err := p.find(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
 
 	if integration.Yandex == nil || integration.Yandex.APIKey == "" {
-		return nil, errors.New("yandex API key not configured")
+		return nil, fmt.Errorf("yandex %w", ErrNotConfigured)
 	}
 
 	return integration.Yandex, nil
@@ -40,13 +76,13 @@ func (p *IntegrationProvider) GetYandexConfig(ctx context.Context, userID string
 
 /* GetClaudeConfig retrieves Claude API configuration for user */
 func (p *IntegrationProvider) GetClaudeConfig(ctx context.Context, userID string) (*models.ClaudeConfig, error) {
-	integration, err := p.repo.FindByUserID(ctx, userID)
+	integration, err := p.find(ctx, userID)
 	if err != nil {
-		return nil, fmt.Errorf("integration not found for user: %w", err)
+		return nil, err
 	}
 
 	if integration.Claude == nil || integration.Claude.APIKey == "" {
-		return nil, errors.New("claude API key not configured")
+		return nil, fmt.Errorf("claude %w", ErrNotConfigured)
 	}
 
 	return integration.Claude, nil
@@ -54,14 +90,135 @@ func (p *IntegrationProvider) GetClaudeConfig(ctx context.Context, userID string
 
 /* GetPerplexityConfig retrieves Perplexity API configuration for user */
 func (p *IntegrationProvider) GetPerplexityConfig(ctx context.Context, userID string) (*models.PerplexityConfig, error) {
-	integration, err := p.repo.FindByUserID(ctx, userID)
+	integration, err := p.find(ctx, userID)
 	if err != nil {
-		return nil, fmt.Errorf("integration not found for user: %w", err)
+		return nil, err
 	}
 
 	if integration.Perplexity == nil || integration.Perplexity.APIKey == "" {
-		return nil, errors.New("perplexity API key not configured")
+		return nil, fmt.Errorf("perplexity %w", ErrNotConfigured)
 	}
 
 	return integration.Perplexity, nil
 }
+
+/* GetQwenConfig retrieves Qwen API configuration for user */
+func (p *IntegrationProvider) GetQwenConfig(ctx context.Context, userID string) (*models.QwenConfig, error) {
+	integration, err := p.find(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if integration.Qwen == nil || integration.Qwen.APIKey == "" {
+		return nil, fmt.Errorf("qwen %w", ErrNotConfigured)
+	}
+
+	return integration.Qwen, nil
+}
+
+/* GetDeepseekConfig retrieves DeepSeek API configuration for user */
+func (p *IntegrationProvider) GetDeepseekConfig(ctx context.Context, userID string) (*models.DeepseekConfig, error) {
+	integration, err := p.find(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if integration.Deepseek == nil || integration.Deepseek.APIKey == "" {
+		return nil, fmt.Errorf("deepseek %w", ErrNotConfigured)
+	}
+
+	return integration.Deepseek, nil
+}
+
+/* GetCustomLLMConfig retrieves custom LLM configuration; the key is optional for self-hosted endpoints */
+func (p *IntegrationProvider) GetCustomLLMConfig(ctx context.Context, userID string) (*models.CustomLLMConfig, error) {
+	integration, err := p.find(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if integration.CustomLLM == nil || integration.CustomLLM.APIRootURL == "" {
+		return nil, fmt.Errorf("custom_llm %w", ErrNotConfigured)
+	}
+
+	return integration.CustomLLM, nil
+}
+
+/* GetLocalConfig retrieves the self-hosted LLM settings; base URL and key may be left to the server default */
+func (p *IntegrationProvider) GetLocalConfig(ctx context.Context, userID string) (*models.LocalLLMConfig, error) {
+	integration, err := p.find(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if integration.Local == nil {
+		return nil, fmt.Errorf("local %w", ErrNotConfigured)
+	}
+
+	return integration.Local, nil
+}
+
+/* GetAPIKey resolves the key of an integration service by its document field name */
+func (p *IntegrationProvider) GetAPIKey(ctx context.Context, userID, service string) (string, error) {
+	switch service {
+	case "openai":
+		config, err := p.GetOpenAIConfig(ctx, userID)
+		if err != nil {
+			return "", err
+		}
+		return config.APIKey, nil
+	case "yandex":
+		config, err := p.GetYandexConfig(ctx, userID)
+		if err != nil {
+			return "", err
+		}
+		return config.APIKey, nil
+	case "claude":
+		config, err := p.GetClaudeConfig(ctx, userID)
+		if err != nil {
+			return "", err
+		}
+		return config.APIKey, nil
+	case "perplexity":
+		config, err := p.GetPerplexityConfig(ctx, userID)
+		if err != nil {
+			return "", err
+		}
+		return config.APIKey, nil
+	case "qwen":
+		config, err := p.GetQwenConfig(ctx, userID)
+		if err != nil {
+			return "", err
+		}
+		return config.APIKey, nil
+	case "deepseek":
+		config, err := p.GetDeepseekConfig(ctx, userID)
+		if err != nil {
+			return "", err
+		}
+		return config.APIKey, nil
+	case "custom_llm":
+		config, err := p.GetCustomLLMConfig(ctx, userID)
+		if err != nil {
+			return "", err
+		}
+		return config.APIKey, nil
+	case "local":
+		config, err := p.GetLocalConfig(ctx, userID)
+		if err != nil {
+			return "", err
+		}
+		return config.APIKey, nil
+	default:
+		return "", fmt.Errorf("unknown integration service %q", service)
+	}
+}
+
+/* GetFallbacks returns the user's LLM fallback chain; users without an integration have none */
+func (p *IntegrationProvider) GetFallbacks(ctx context.Context, userID string) ([]string, error) {
+	integration, err := p.find(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return integration.Fallbacks, nil
+}
@@ -15,19 +15,23 @@ type Repository interface {
 
 /* MongoRepository implements Repository using MongoDB */
 type MongoRepository struct {
-	db *qmgo.Database
+	db      *qmgo.Database
+	secrets *Secrets
 }
 
-func NewMongoRepository(db *qmgo.Database) Repository {
-	return &MongoRepository{db: db}
+func NewMongoRepository(db *qmgo.Database, secrets *Secrets) Repository {
+	return &MongoRepository{db: db, secrets: secrets}
 }
 
-/* FindByUserID retrieves Integration document by userID */
+/* FindByUserID retrieves Integration document by userID with API keys decrypted */
 func (r *MongoRepository) FindByUserID(ctx context.Context, userID string) (*models.Integration, error) {
 	var integration models.Integration
 	err := r.db.Collection("integrations").Find(ctx, bson.M{"userId": userID}).One(&integration)
 	if err != nil {
 		return nil, err
 	}
+	if err := r.secrets.Open(&integration); err != nil {
+		return nil, err
+	}
 	return &integration, nil
 }
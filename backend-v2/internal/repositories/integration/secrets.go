@@ -0,0 +1,272 @@
+package integration
+
+import (
+	"backend-v2/internal/common/envelope"
+	"backend-v2/internal/config"
+	"backend-v2/internal/models"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/qiniu/qmgo"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	apiKeyField     = "apiKey"
+	encryptionField = "encryption"
+)
+
+/* Secrets applies envelope encryption to the provider API keys of Integration documents */
+type Secrets struct {
+	keyring *envelope.Keyring
+}
+
+func NewSecrets(keyring *envelope.Keyring) *Secrets {
+	return &Secrets{keyring: keyring}
+}
+
+/* NewSecretsFromConfig builds Secrets from INTEGRATION_ENCRYPTION_KEYS */
+func NewSecretsFromConfig() (*Secrets, error) {
+	keyring, err := envelope.ParseKeyring(config.IntegrationEncryptionKeys)
+	if err != nil {
+		return nil, err
+	}
+	return NewSecrets(keyring), nil
+}
+
+/* Enabled reports whether new secrets are encrypted on write */
+func (s *Secrets) Enabled() bool {
+	return s != nil && s.keyring.Enabled()
+}
+
+/* secretFields maps each configured service of the document to its API key */
+func secretFields(doc *models.Integration) map[string]*string {
+	fields := map[string]*string{}
+	if doc.OpenAI != nil {
+		fields["openai"] = &doc.OpenAI.APIKey
+	}
+	if doc.Yandex != nil {
+		fields["yandex"] = &doc.Yandex.APIKey
+	}
+	if doc.Claude != nil {
+		fields["claude"] = &doc.Claude.APIKey
+	}
+	if doc.Perplexity != nil {
+		fields["perplexity"] = &doc.Perplexity.APIKey
+	}
+	if doc.Qwen != nil {
+		fields["qwen"] = &doc.Qwen.APIKey
+	}
+	if doc.Deepseek != nil {
+		fields["deepseek"] = &doc.Deepseek.APIKey
+	}
+	if doc.CustomLLM != nil {
+		fields["custom_llm"] = &doc.CustomLLM.APIKey
+	}
+	if doc.Local != nil {
+		fields["local"] = &doc.Local.APIKey
+	}
+	return fields
+}
+
+/* Open decrypts the document's API keys in place; legacy plaintext keys pass through */
+func (s *Secrets) Open(doc *models.Integration) error {
+	fields := secretFields(doc)
+
+	sealed := false
+	for _, value := range fields {
+		if envelope.IsSealed(*value) {
+			sealed = true
+			break
+		}
+	}
+	if !sealed {
+		return nil
+	}
+
+	if s == nil || doc.Encryption == nil {
+		return fmt.Errorf("integration %s has encrypted keys but no usable data key", doc.UserID)
+	}
+
+	dataKey, err := s.keyring.Unwrap(doc.Encryption.KeyID, doc.Encryption.DataKey)
+	if err != nil {
+		return fmt.Errorf("unwrap data key: %w", err)
+	}
+
+	for service, value := range fields {
+		opened, err := envelope.Open(dataKey, *value)
+		if err != nil {
+			return fmt.Errorf("decrypt %s key: %w", service, err)
+		}
+		*value = opened
+	}
+	return nil
+}
+
+/*
+SealUpdate encrypts the apiKey of every service config in a $set document.
+The existing document's data key is reused (and re-wrapped if its master key was rotated);
+a new data key is generated for documents that have none.
+*/
+func (s *Secrets) SealUpdate(existing *models.Integration, update bson.M) error {
+	if !s.Enabled() {
+		return nil
+	}
+
+	var dataKey []byte
+	for service, raw := range update {
+		serviceConfig, ok := raw.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		apiKey, _ := serviceConfig[apiKeyField].(string)
+		if apiKey == "" || envelope.IsSealed(apiKey) {
+			continue
+		}
+
+		if dataKey == nil {
+			key, err := s.dataKeyFor(existing, update)
+			if err != nil {
+				return err
+			}
+			dataKey = key
+		}
+
+		sealed, err := envelope.Seal(dataKey, apiKey)
+		if err != nil {
+			return err
+		}
+
+		copied := make(map[string]interface{}, len(serviceConfig))
+		for k, v := range serviceConfig {
+			copied[k] = v
+		}
+		copied[apiKeyField] = sealed
+		update[service] = copied
+	}
+	return nil
+}
+
+/*
+SealDocument returns the $set fields that bring a stored document up to date:
+plaintext keys are encrypted and a data key wrapped by a retired master key is re-wrapped.
+An empty result means the document needs no change.
+*/
+func (s *Secrets) SealDocument(doc *models.Integration) (bson.M, error) {
+	set := bson.M{}
+	if !s.Enabled() {
+		return set, nil
+	}
+
+	fields := secretFields(doc)
+	var dataKey []byte
+	for service, value := range fields {
+		if *value == "" || envelope.IsSealed(*value) {
+			continue
+		}
+
+		if dataKey == nil {
+			key, err := s.dataKeyFor(doc, set)
+			if err != nil {
+				return nil, err
+			}
+			dataKey = key
+		}
+
+		sealed, err := envelope.Seal(dataKey, *value)
+		if err != nil {
+			return nil, err
+		}
+		set[service+"."+apiKeyField] = sealed
+	}
+
+	if dataKey == nil && doc.Encryption != nil && doc.Encryption.KeyID != s.keyring.ActiveID() {
+		if _, err := s.dataKeyFor(doc, set); err != nil {
+			return nil, err
+		}
+	}
+	return set, nil
+}
+
+/*
+SealFilter matches a stored document only while it still holds the values SealDocument read
+from doc, so a key saved in the meantime is not overwritten with a stale one.
+*/
+func SealFilter(doc *models.Integration, set bson.M) bson.M {
+	filter := bson.M{"userId": doc.UserID}
+	for service, value := range secretFields(doc) {
+		if _, ok := set[service+"."+apiKeyField]; ok {
+			filter[service+"."+apiKeyField] = *value
+		}
+	}
+	if _, ok := set[encryptionField]; ok {
+		if doc.Encryption == nil {
+			filter[encryptionField] = bson.M{"$exists": false}
+		} else {
+			filter[encryptionField+".keyId"] = doc.Encryption.KeyID
+			filter[encryptionField+".dataKey"] = doc.Encryption.DataKey
+		}
+	}
+	return filter
+}
+
+/*
+EnsureDataKey gives a stored document its data key before anything is sealed with it.
+The new key is only set if the document still has none and is then read back, so
+concurrent writers all seal with whichever key landed first.
+*/
+func (s *Secrets) EnsureDataKey(ctx context.Context, collection *qmgo.Collection, doc *models.Integration) error {
+	if !s.Enabled() || doc.Encryption != nil {
+		return nil
+	}
+
+	_, wrapped, err := s.keyring.NewDataKey()
+	if err != nil {
+		return err
+	}
+	filter := bson.M{"userId": doc.UserID, encryptionField: bson.M{"$exists": false}}
+	update := bson.M{"$set": bson.M{encryptionField: models.IntegrationEncryption{KeyID: s.keyring.ActiveID(), DataKey: wrapped}}}
+	if err := collection.UpdateOne(ctx, filter, update); err != nil && !errors.Is(err, qmgo.ErrNoSuchDocuments) {
+		return err
+	}
+
+	var stored models.Integration
+	if err := collection.Find(ctx, bson.M{"userId": doc.UserID}).Select(bson.M{encryptionField: 1}).One(&stored); err != nil {
+		return err
+	}
+	if stored.Encryption == nil {
+		return fmt.Errorf("integration %s has no data key after creating one", doc.UserID)
+	}
+	doc.Encryption = stored.Encryption
+	return nil
+}
+
+/*
+dataKeyFor returns the document's data key, recording a new or re-wrapped key in set when needed.
+A new key is only safe for a document about to be inserted; stored documents get theirs from EnsureDataKey.
+*/
+func (s *Secrets) dataKeyFor(doc *models.Integration, set bson.M) ([]byte, error) {
+	if doc == nil || doc.Encryption == nil {
+		dataKey, wrapped, err := s.keyring.NewDataKey()
+		if err != nil {
+			return nil, err
+		}
+		set[encryptionField] = models.IntegrationEncryption{KeyID: s.keyring.ActiveID(), DataKey: wrapped}
+		return dataKey, nil
+	}
+
+	dataKey, err := s.keyring.Unwrap(doc.Encryption.KeyID, doc.Encryption.DataKey)
+	if err != nil {
+		return nil, fmt.Errorf("unwrap data key: %w", err)
+	}
+
+	if doc.Encryption.KeyID != s.keyring.ActiveID() {
+		wrapped, err := s.keyring.Wrap(dataKey)
+		if err != nil {
+			return nil, err
+		}
+		set[encryptionField] = models.IntegrationEncryption{KeyID: s.keyring.ActiveID(), DataKey: wrapped}
+	}
+	return dataKey, nil
+}
@@ -0,0 +1,173 @@
+package integration
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"backend-v2/internal/common/envelope"
+	"backend-v2/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func testSecrets(t *testing.T, spec string) *Secrets {
+	t.Helper()
+	keyring, err := envelope.ParseKeyring(spec)
+	if err != nil {
+		t.Fatalf("ParseKeyring() error = %v", err)
+	}
+	return NewSecrets(keyring)
+}
+
+func masterKey(b byte) string {
+	return base64.StdEncoding.EncodeToString([]byte(strings.Repeat(string(b), 32)))
+}
+
+/* applySet mimics Mongo applying a SealDocument $set to the decoded document */
+func applySet(doc *models.Integration, set bson.M) {
+	for field, value := range set {
+		switch field {
+		case "encryption":
+			enc := value.(models.IntegrationEncryption)
+			doc.Encryption = &enc
+		default:
+			service := strings.TrimSuffix(field, ".apiKey")
+			*secretFields(doc)[service] = value.(string)
+		}
+	}
+}
+
+func TestSecrets_SealUpdateAndOpen(t *testing.T) {
+	secrets := testSecrets(t, "k1:"+masterKey('a'))
+
+	update := bson.M{
+		"openai": map[string]interface{}{"apiKey": "sk-openai", "model": "gpt-4o"},
+		"lang":   "en",
+	}
+	if err := secrets.SealUpdate(nil, update); err != nil {
+		t.Fatalf("SealUpdate() error = %v", err)
+	}
+
+	sealed := update["openai"].(map[string]interface{})["apiKey"].(string)
+	if !envelope.IsSealed(sealed) {
+		t.Fatalf("apiKey = %q, want sealed value", sealed)
+	}
+	enc, ok := update["encryption"].(models.IntegrationEncryption)
+	if !ok || enc.KeyID != "k1" {
+		t.Fatalf("encryption = %#v, want data key wrapped by k1", update["encryption"])
+	}
+
+	doc := &models.Integration{UserID: "u1", OpenAI: &models.OpenAIConfig{APIKey: sealed}, Encryption: &enc}
+	if err := secrets.Open(doc); err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	if doc.OpenAI.APIKey != "sk-openai" {
+		t.Errorf("APIKey = %q, want sk-openai", doc.OpenAI.APIKey)
+	}
+}
+
+func TestSecrets_SealUpdateReusesDataKey(t *testing.T) {
+	secrets := testSecrets(t, "k1:"+masterKey('a'))
+
+	doc := &models.Integration{UserID: "u1", Claude: &models.ClaudeConfig{APIKey: "sk-claude"}}
+	applySet(doc, mustSealDocument(t, secrets, doc))
+
+	update := bson.M{"openai": map[string]interface{}{"apiKey": "sk-openai"}}
+	if err := secrets.SealUpdate(doc, update); err != nil {
+		t.Fatalf("SealUpdate() error = %v", err)
+	}
+	if _, rewrapped := update["encryption"]; rewrapped {
+		t.Error("SealUpdate() replaced the data key of an encrypted document")
+	}
+
+	doc.OpenAI = &models.OpenAIConfig{APIKey: update["openai"].(map[string]interface{})["apiKey"].(string)}
+	if err := secrets.Open(doc); err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	if doc.OpenAI.APIKey != "sk-openai" || doc.Claude.APIKey != "sk-claude" {
+		t.Errorf("Open() = %q, %q; want both keys decrypted", doc.OpenAI.APIKey, doc.Claude.APIKey)
+	}
+}
+
+func TestSecrets_SealDocumentMigratesAndRotates(t *testing.T) {
+	doc := &models.Integration{
+		UserID:    "u1",
+		Deepseek:  &models.DeepseekConfig{APIKey: "sk-deepseek"},
+		CustomLLM: &models.CustomLLMConfig{APIRootURL: "http://llm.local"},
+	}
+
+	oldSecrets := testSecrets(t, "k1:"+masterKey('a'))
+	set := mustSealDocument(t, oldSecrets, doc)
+	if _, ok := set["custom_llm.apiKey"]; ok {
+		t.Error("SealDocument() sealed an empty key")
+	}
+	applySet(doc, set)
+
+	if again := mustSealDocument(t, oldSecrets, doc); len(again) != 0 {
+		t.Errorf("SealDocument() on sealed document = %v, want no changes", again)
+	}
+
+	rotated := testSecrets(t, "k2:"+masterKey('b')+",k1:"+masterKey('a'))
+	set = mustSealDocument(t, rotated, doc)
+	if enc, ok := set["encryption"].(models.IntegrationEncryption); !ok || enc.KeyID != "k2" || len(set) != 1 {
+		t.Fatalf("SealDocument() after rotation = %v, want only a re-wrapped data key", set)
+	}
+	applySet(doc, set)
+
+	if err := testSecrets(t, "k2:"+masterKey('b')).Open(doc); err != nil {
+		t.Fatalf("Open() with retired key removed error = %v", err)
+	}
+	if doc.Deepseek.APIKey != "sk-deepseek" {
+		t.Errorf("APIKey = %q, want sk-deepseek", doc.Deepseek.APIKey)
+	}
+}
+
+func TestSealFilter(t *testing.T) {
+	doc := &models.Integration{
+		UserID:   "u1",
+		Deepseek: &models.DeepseekConfig{APIKey: "sk-deepseek"},
+		Claude:   &models.ClaudeConfig{APIKey: "sk-claude"},
+	}
+	set := bson.M{"deepseek.apiKey": "enc:v1:x", "encryption": models.IntegrationEncryption{KeyID: "k1"}}
+
+	filter := SealFilter(doc, set)
+	if filter["userId"] != "u1" || filter["deepseek.apiKey"] != "sk-deepseek" || filter["encryption"] == nil {
+		t.Errorf("SealFilter() = %v, want the read key and a missing data key", filter)
+	}
+	if _, ok := filter["claude.apiKey"]; ok {
+		t.Errorf("SealFilter() = %v, must not guard fields it does not set", filter)
+	}
+
+	doc.Encryption = &models.IntegrationEncryption{KeyID: "k0", DataKey: "wrapped"}
+	filter = SealFilter(doc, set)
+	if filter["encryption.keyId"] != "k0" || filter["encryption.dataKey"] != "wrapped" {
+		t.Errorf("SealFilter() = %v, want the read data key", filter)
+	}
+}
+
+func TestSecrets_DisabledPassthrough(t *testing.T) {
+	var secrets *Secrets
+
+	update := bson.M{"openai": map[string]interface{}{"apiKey": "sk-openai"}}
+	if err := secrets.SealUpdate(nil, update); err != nil {
+		t.Fatalf("SealUpdate() error = %v", err)
+	}
+	if update["openai"].(map[string]interface{})["apiKey"] != "sk-openai" {
+		t.Error("SealUpdate() without keys modified the value")
+	}
+
+	doc := &models.Integration{OpenAI: &models.OpenAIConfig{APIKey: "sk-openai"}}
+	if err := secrets.Open(doc); err != nil || doc.OpenAI.APIKey != "sk-openai" {
+		t.Errorf("Open() = %q, %v; want plaintext passthrough", doc.OpenAI.APIKey, err)
+	}
+}
+
+func mustSealDocument(t *testing.T, secrets *Secrets, doc *models.Integration) bson.M {
+	t.Helper()
+	set, err := secrets.SealDocument(doc)
+	if err != nil {
+		t.Fatalf("SealDocument() error = %v", err)
+	}
+	return set
+}
@@ -5,12 +5,14 @@ import (
 	"context"
 
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
 /* FileRepository handles WorkflowFile GridFS operations */
 type FileRepository interface {
 	FindByWorkflowID(ctx context.Context, workflowID string) ([]database.GridFSFile, error)
+	FindByID(ctx context.Context, id primitive.ObjectID) (*database.GridFSFile, error)
 }
 
 type fileRepository struct {
@@ -32,3 +34,15 @@ func (r *fileRepository) FindByWorkflowID(ctx context.Context, workflowID string
 	filter := bson.M{"metadata.workflowId": workflowID}
 	return r.bucket.Find(ctx, filter)
 }
+
+/* FindByID returns one file, mongo.ErrNoDocuments when it does not exist */
+func (r *fileRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*database.GridFSFile, error) {
+	files, err := r.bucket.Find(ctx, bson.M{"_id": id})
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, mongo.ErrNoDocuments
+	}
+	return &files[0], nil
+}
@@ -1,14 +1,32 @@
 package container
 
 import (
+	"context"
+	"log"
+	"net/url"
+	"strings"
+	"sync"
+
+	"backend-v2/internal/common/http"
+	"backend-v2/internal/config"
+	"backend-v2/internal/models"
+	"backend-v2/internal/providers/apikey"
+	integrationRepo "backend-v2/internal/repositories/integration"
 	"backend-v2/internal/services/email"
+	"backend-v2/internal/services/events"
 	"backend-v2/internal/services/freepik"
+	"backend-v2/internal/services/llmcache"
+	"backend-v2/internal/services/llmcatalog"
 	"backend-v2/internal/services/llmproxy"
 	"backend-v2/internal/services/midjourney"
+	"backend-v2/internal/services/ratelimit"
 	"backend-v2/internal/services/thumbnail"
+	"backend-v2/internal/services/usage"
+	"backend-v2/internal/services/vectorindex"
 	"backend-v2/internal/services/zoom"
 
 	"github.com/qiniu/qmgo"
+	"go.mongodb.org/mongo-driver/bson"
 )
 
 /* ServiceContainer centralizes service instantiation for DRY/SOLID compliance */
@@ -19,18 +37,153 @@ type ServiceContainer struct {
 	Zoom       zoom.Service
 	Freepik    freepik.Service
 	LLMProxy   llmproxy.Service
+	KeyChecker llmproxy.KeyChecker
+	Embedder   llmproxy.Embedder
+	Events     events.Bus
+	Usage      usage.Store
+
+	/* VectorIndex keeps nearest-neighbour indexes of vector contexts in memory */
+	VectorIndex *vectorindex.Manager
+
+	/* Catalog lists provider endpoints and models, built-in defaults overlaid by configuration */
+	Catalog *llmcatalog.Catalog
+
+	/* IntegrationSecrets encrypts and decrypts stored provider API keys */
+	IntegrationSecrets *integrationRepo.Secrets
 }
 
 /* NewServiceContainer instantiates all services based on mock flag */
 func NewServiceContainer(useMockServices bool, db *qmgo.Database) *ServiceContainer {
+	secrets, err := integrationRepo.NewSecretsFromConfig()
+	if err != nil {
+		log.Fatalf("Integration encryption keys invalid: %v", err)
+	}
+	if !secrets.Enabled() {
+		log.Printf("[WARN] INTEGRATION_ENCRYPTION_KEYS not set - integration API keys are stored unencrypted")
+	}
+
+	/* Stored integration keys let the LLM proxy call providers without the browser holding keys */
+	keyResolver := llmproxy.NewKeyResolver(
+		apikey.NewIntegrationProvider(integrationRepo.NewMongoRepository(db, secrets)),
+		config.LLMProxyKeyMode,
+	).WithLocalDefault(config.LocalLLMBaseURL)
+
+	usageStore := usage.NewMongoStore(db)
+
+	ratePolicy, err := ratelimit.ParsePolicy(config.LLMRateLimits)
+	if err != nil {
+		log.Fatalf("LLM rate limits invalid: %v", err)
+	}
+
+	routing, err := llmproxy.ParseRoutingPolicy(config.LLMRouting)
+	if err != nil {
+		log.Fatalf("LLM routing invalid: %v", err)
+	}
+	resilience, err := llmproxy.ParseResilience(config.LLMResilience)
+	if err != nil {
+		log.Fatalf("LLM resilience settings invalid: %v", err)
+	}
+	catalog, err := llmcatalog.Load(config.LLMProvidersFile, config.LLMProviders)
+	if err != nil {
+		log.Fatalf("LLM provider catalog invalid: %v", err)
+	}
+
+	cachePolicy, err := llmcache.ParsePolicy(config.LLMCache)
+	if err != nil {
+		log.Fatalf("LLM cache settings invalid: %v", err)
+	}
+
+	indexPolicy, err := vectorindex.ParsePolicy(config.VectorIndex)
+	if err != nil {
+		log.Fatalf("Vector index settings invalid: %v", err)
+	}
+
+	/* Proxied calls and embeddings share one limiter, so they draw on the same allowance */
+	limiter := sync.OnceValue(func() *ratelimit.Limiter {
+		return ratelimit.NewLimiter(newRateLimitStore(db), usageStore, ratePolicy)
+	})
+
+	guard, err := newOutboundGuard(catalog)
+	if err != nil {
+		log.Fatalf("Outbound allowlist invalid: %v", err)
+	}
+	http.SetDefaultGuard(guard)
+
 	return &ServiceContainer{
 		Email:      selectService(useMockServices, email.NewNoopService, email.NewSMTPService),
 		Thumbnail:  selectService(useMockServices, thumbnail.NewNoopService, thumbnail.NewProdService),
 		Midjourney: selectService(useMockServices, midjourney.NewNoopService, midjourney.NewProdService),
 		Zoom:       selectService(useMockServices, zoom.NewNoopService, zoom.NewProdService),
 		Freepik:    selectService(useMockServices, freepik.NewNoopService, freepik.NewProdService),
-		LLMProxy:   selectService(useMockServices, llmproxy.NewNoopService, llmproxy.NewProdService),
+		LLMProxy: selectService(useMockServices, llmproxy.NewNoopService, func() llmproxy.Service {
+			router := llmproxy.NewRouter(routing, resilience)
+			service := llmproxy.NewLimitedService(llmproxy.NewProdService(keyResolver, usageStore, router, catalog), limiter())
+			/* Hits are answered before the limiter: a replayed answer costs no upstream tokens */
+			if store := newLLMCacheStore(db, cachePolicy); store != nil {
+				service = llmproxy.NewCachedService(service, llmcache.New(store, cachePolicy))
+			}
+			return service
+		}),
+		KeyChecker: selectService(useMockServices, llmproxy.NewNoopKeyChecker, func() llmproxy.KeyChecker {
+			return llmproxy.NewProdKeyChecker(catalog, config.LocalLLMBaseURL)
+		}),
+		Embedder: selectService(useMockServices, llmproxy.NewNoopEmbedder, func() llmproxy.Embedder {
+			return llmproxy.NewProdEmbedder(keyResolver, catalog, usageStore, limiter(), userRoles(db))
+		}),
+		Events:             events.NewBus(),
+		Usage:              usageStore,
+		VectorIndex:        vectorindex.NewManager(indexPolicy, config.VectorIndexDir),
+		Catalog:            catalog,
+		IntegrationSecrets: secrets,
+	}
+}
+
+/*
+newOutboundGuard blocks private destinations for user-supplied URLs; endpoints the operator
+configured (LOCAL_LLM_BASE_URL, the provider catalog) are trusted alongside OUTBOUND_ALLOWLIST
+*/
+func newOutboundGuard(catalog *llmcatalog.Catalog) (*http.Guard, error) {
+	policy := http.DefaultGuardPolicy()
+	cidrs, hosts, err := http.ParseAllowlist(config.OutboundAllowlist)
+	if err != nil {
+		return nil, err
+	}
+	policy.AllowCIDRs = cidrs
+	policy.AllowHosts = hosts
+
+	configured := []string{config.LocalLLMBaseURL}
+	for _, id := range catalog.IDs() {
+		provider, _ := catalog.Provider(id)
+		configured = append(configured, provider.BaseURL)
+	}
+	for _, endpoint := range configured {
+		if parsed, err := url.Parse(endpoint); err == nil && parsed.Host != "" {
+			policy.AllowHosts = append(policy.AllowHosts, strings.ToLower(parsed.Host))
+		}
 	}
+	return http.NewGuard(policy), nil
+}
+
+/* newRateLimitStore shares rate state through Mongo unless a single-instance memory store is configured */
+func newRateLimitStore(db *qmgo.Database) ratelimit.Store {
+	if config.LLMRateLimitStore == "memory" {
+		return ratelimit.NewMemoryStore()
+	}
+	return ratelimit.NewMongoStore(db)
+}
+
+/* newLLMCacheStore returns the configured response cache store, nil when caching is off */
+func newLLMCacheStore(db *qmgo.Database, policy llmcache.Policy) llmcache.Store {
+	switch config.LLMCacheStore {
+	case "memory":
+		return llmcache.NewMemoryStore(policy)
+	case "mongo":
+		return llmcache.NewMongoStore(db)
+	case "":
+		return nil
+	}
+	log.Fatalf("LLM_CACHE_STORE %q invalid: expected memory or mongo", config.LLMCacheStore)
+	return nil
 }
 
 /* selectService returns noop or prod implementation based on flag */
@@ -40,3 +193,15 @@ func selectService[T any](useMock bool, noopFactory func() T, prodFactory func()
 	}
 	return prodFactory()
 }
+
+/* userRoles reads a user's roles for limits applied outside a request */
+func userRoles(db *qmgo.Database) llmproxy.RoleLookup {
+	users := db.Collection("users")
+	return func(ctx context.Context, userID string) ([]string, error) {
+		var user models.User
+		if err := users.Find(ctx, bson.M{"name": userID}).Select(bson.M{"roles": 1}).One(&user); err != nil {
+			return nil, err
+		}
+		return user.Roles, nil
+	}
+}
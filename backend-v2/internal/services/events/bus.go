@@ -0,0 +1,118 @@
+package events
+
+import (
+	"sync"
+	"time"
+
+	"backend-v2/internal/common/logger"
+	"backend-v2/internal/common/utils"
+)
+
+var log = logger.New("EVENTS")
+
+/* Type identifies a domain event */
+type Type string
+
+const (
+	WorkflowCreated Type = "workflow.created"
+	WorkflowUpdated Type = "workflow.updated"
+	WorkflowShared  Type = "workflow.shared"
+	WorkflowDeleted Type = "workflow.deleted"
+	UserApproved    Type = "user.approved"
+
+	/* Wildcard subscribes a handler to every event type */
+	Wildcard Type = "*"
+)
+
+/* KnownTypes lists every event type that can be published */
+var KnownTypes = []Type{
+	WorkflowCreated,
+	WorkflowUpdated,
+	WorkflowShared,
+	WorkflowDeleted,
+	UserApproved,
+}
+
+/* IsKnownType reports whether t is a publishable event type */
+func IsKnownType(t Type) bool {
+	for _, known := range KnownTypes {
+		if known == t {
+			return true
+		}
+	}
+	return false
+}
+
+/* Event is a domain occurrence published on the bus */
+type Event struct {
+	ID         string                 `json:"id" bson:"id"`
+	Type       Type                   `json:"type" bson:"type"`
+	OccurredAt time.Time              `json:"occurredAt" bson:"occurredAt"`
+	Data       map[string]interface{} `json:"data" bson:"data"`
+}
+
+/* New creates an event with generated ID and current timestamp */
+func New(eventType Type, data map[string]interface{}) Event {
+	return Event{
+		ID:         utils.GenerateID(),
+		Type:       eventType,
+		OccurredAt: time.Now().UTC(),
+		Data:       data,
+	}
+}
+
+/* Handler reacts to a published event */
+type Handler func(Event)
+
+/* Bus fans out domain events to in-process subscribers */
+type Bus interface {
+	Publish(event Event)
+	Subscribe(eventType Type, handler Handler)
+}
+
+/* InProcessBus delivers events asynchronously so publishers never block on subscribers */
+type InProcessBus struct {
+	mu       sync.RWMutex
+	handlers map[Type][]Handler
+	wg       sync.WaitGroup
+}
+
+func NewBus() *InProcessBus {
+	return &InProcessBus{
+		handlers: make(map[Type][]Handler),
+	}
+}
+
+func (b *InProcessBus) Subscribe(eventType Type, handler Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers[eventType] = append(b.handlers[eventType], handler)
+}
+
+func (b *InProcessBus) Publish(event Event) {
+	b.mu.RLock()
+	handlers := make([]Handler, 0, len(b.handlers[event.Type])+len(b.handlers[Wildcard]))
+	handlers = append(handlers, b.handlers[event.Type]...)
+	handlers = append(handlers, b.handlers[Wildcard]...)
+	b.mu.RUnlock()
+
+	for _, handler := range handlers {
+		b.wg.Add(1)
+		go b.dispatch(handler, event)
+	}
+}
+
+/* Wait blocks until all in-flight handlers have returned */
+func (b *InProcessBus) Wait() {
+	b.wg.Wait()
+}
+
+func (b *InProcessBus) dispatch(handler Handler, event Event) {
+	defer b.wg.Done()
+	defer func() {
+		if r := recover(); r != nil {
+			log.Error("handler panic for %s (%s): %v", event.Type, event.ID, r)
+		}
+	}()
+	handler(event)
+}
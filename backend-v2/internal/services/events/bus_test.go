@@ -0,0 +1,94 @@
+package events
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestInProcessBus_DeliversToTypeSubscribers(t *testing.T) {
+	bus := NewBus()
+
+	var mu sync.Mutex
+	received := []Type{}
+	bus.Subscribe(WorkflowCreated, func(e Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		received = append(received, e.Type)
+	})
+
+	bus.Publish(New(WorkflowCreated, nil))
+	bus.Publish(New(WorkflowDeleted, nil))
+	bus.Wait()
+
+	if len(received) != 1 || received[0] != WorkflowCreated {
+		t.Errorf("received = %v, want [%s]", received, WorkflowCreated)
+	}
+}
+
+func TestInProcessBus_WildcardReceivesEverything(t *testing.T) {
+	bus := NewBus()
+
+	var mu sync.Mutex
+	count := 0
+	bus.Subscribe(Wildcard, func(e Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		count++
+	})
+
+	for _, eventType := range KnownTypes {
+		bus.Publish(New(eventType, nil))
+	}
+	bus.Wait()
+
+	if count != len(KnownTypes) {
+		t.Errorf("wildcard count = %d, want %d", count, len(KnownTypes))
+	}
+}
+
+func TestInProcessBus_HandlerPanicIsContained(t *testing.T) {
+	bus := NewBus()
+
+	delivered := make(chan struct{}, 1)
+	bus.Subscribe(UserApproved, func(e Event) {
+		panic("boom")
+	})
+	bus.Subscribe(UserApproved, func(e Event) {
+		delivered <- struct{}{}
+	})
+
+	bus.Publish(New(UserApproved, map[string]interface{}{"userId": "alice"}))
+	bus.Wait()
+
+	select {
+	case <-delivered:
+	default:
+		t.Error("second handler should still receive the event")
+	}
+}
+
+func TestNew_PopulatesIdentity(t *testing.T) {
+	event := New(WorkflowShared, map[string]interface{}{"workflowId": "wf1"})
+
+	if event.ID == "" {
+		t.Error("event ID should be generated")
+	}
+	if event.OccurredAt.IsZero() {
+		t.Error("event timestamp should be set")
+	}
+	if event.Data["workflowId"] != "wf1" {
+		t.Errorf("event data = %v", event.Data)
+	}
+}
+
+func TestIsKnownType(t *testing.T) {
+	if !IsKnownType(WorkflowUpdated) {
+		t.Error("workflow.updated should be known")
+	}
+	if IsKnownType(Wildcard) {
+		t.Error("wildcard is not a publishable type")
+	}
+	if IsKnownType(Type("workflow.exploded")) {
+		t.Error("unknown type reported as known")
+	}
+}
@@ -0,0 +1,147 @@
+package llmcache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"backend-v2/internal/common/logger"
+)
+
+var log = logger.New("LLMCACHE")
+
+/* Entry is one cached upstream answer together with what is needed to replay it */
+type Entry struct {
+	Status      int       `bson:"status"`
+	ContentType string    `bson:"contentType"`
+	Body        []byte    `bson:"body"`
+	Provider    string    `bson:"provider"`
+	Model       string    `bson:"model"`
+	ExpiresAt   time.Time `bson:"expiresAt"`
+}
+
+func (e *Entry) size() int64 {
+	return int64(len(e.Body) + len(e.ContentType) + len(e.Provider) + len(e.Model))
+}
+
+/* Policy bounds the cache; MaxEntries and MaxBytes only apply to the memory store, Mongo relies on the TTL */
+type Policy struct {
+	TTL           time.Duration
+	MaxEntryBytes int64
+	MaxEntries    int
+	MaxBytes      int64
+}
+
+func DefaultPolicy() Policy {
+	return Policy{
+		TTL:           time.Hour,
+		MaxEntryBytes: 256 << 10,
+		MaxEntries:    10_000,
+		MaxBytes:      64 << 20,
+	}
+}
+
+/*
+ParsePolicy overrides DefaultPolicy with a spec such as "ttl=30m,entryBytes=131072,entries=5000,bytes=33554432".
+Unspecified fields keep their default.
+*/
+func ParsePolicy(spec string) (Policy, error) {
+	policy := DefaultPolicy()
+
+	for _, field := range strings.Split(spec, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		name, raw, ok := strings.Cut(field, "=")
+		if !ok {
+			return Policy{}, fmt.Errorf("cache field %q: expected name=value", field)
+		}
+
+		if name == "ttl" {
+			ttl, err := time.ParseDuration(raw)
+			if err != nil || ttl <= 0 {
+				return Policy{}, fmt.Errorf("cache field %q: invalid duration", field)
+			}
+			policy.TTL = ttl
+			continue
+		}
+
+		value, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || value <= 0 {
+			return Policy{}, fmt.Errorf("cache field %q: invalid value", field)
+		}
+		switch name {
+		case "entryBytes":
+			policy.MaxEntryBytes = value
+		case "entries":
+			policy.MaxEntries = int(value)
+		case "bytes":
+			policy.MaxBytes = value
+		default:
+			return Policy{}, fmt.Errorf("cache field %q: unknown field %q", field, name)
+		}
+	}
+
+	return policy, nil
+}
+
+/*
+Key derives the cache key from the user, provider, model and request body. The body is
+re-encoded so that key order and whitespace do not matter; the user scopes every entry.
+*/
+func Key(userID, provider, model string, body map[string]interface{}) (string, error) {
+	/* encoding/json writes map keys sorted, which makes the encoding canonical */
+	normalized, err := json.Marshal(body)
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.New()
+	for _, part := range []string{userID, provider, model} {
+		hash.Write([]byte(part))
+		hash.Write([]byte{0})
+	}
+	hash.Write(normalized)
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+/* Cache applies the policy on top of a Store; store failures degrade to misses */
+type Cache struct {
+	store  Store
+	policy Policy
+	now    func() time.Time
+}
+
+func New(store Store, policy Policy) *Cache {
+	return &Cache{store: store, policy: policy, now: time.Now}
+}
+
+/* Get returns a live entry for key */
+func (c *Cache) Get(ctx context.Context, key string) (*Entry, bool) {
+	entry, err := c.store.Get(ctx, key)
+	if err != nil {
+		log.Warn("cache read failed: %v", err)
+		return nil, false
+	}
+	if entry == nil || !c.now().Before(entry.ExpiresAt) {
+		return nil, false
+	}
+	return entry, true
+}
+
+/* Put stores entry under key for the policy TTL; oversized entries are skipped */
+func (c *Cache) Put(ctx context.Context, key string, entry Entry) {
+	if entry.size() > c.policy.MaxEntryBytes {
+		return
+	}
+	entry.ExpiresAt = c.now().Add(c.policy.TTL)
+	if err := c.store.Set(ctx, key, entry); err != nil {
+		log.Warn("cache write failed: %v", err)
+	}
+}
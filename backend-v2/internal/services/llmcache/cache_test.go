@@ -0,0 +1,90 @@
+package llmcache
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParsePolicy(t *testing.T) {
+	policy, err := ParsePolicy("ttl=30m, entries=5")
+	if err != nil {
+		t.Fatalf("ParsePolicy() error = %v", err)
+	}
+	if policy.TTL != 30*time.Minute || policy.MaxEntries != 5 || policy.MaxBytes != DefaultPolicy().MaxBytes {
+		t.Errorf("policy = %+v", policy)
+	}
+
+	for _, spec := range []string{"ttl=soon", "ttl=-1m", "entries=0", "size=10", "entries"} {
+		if _, err := ParsePolicy(spec); err == nil {
+			t.Errorf("ParsePolicy(%q) expected error", spec)
+		}
+	}
+}
+
+func TestKey(t *testing.T) {
+	body := map[string]interface{}{"model": "gpt-4o", "temperature": 0.0, "messages": []interface{}{"hi"}}
+	reordered := map[string]interface{}{"messages": []interface{}{"hi"}, "temperature": 0.0, "model": "gpt-4o"}
+
+	a, _ := Key("user-1", "openai", "gpt-4o", body)
+	b, _ := Key("user-1", "openai", "gpt-4o", reordered)
+	if a != b {
+		t.Error("key order must not change the cache key")
+	}
+
+	for name, other := range map[string][3]string{
+		"user":     {"user-2", "openai", "gpt-4o"},
+		"provider": {"user-1", "deepseek", "gpt-4o"},
+		"model":    {"user-1", "openai", "gpt-4o-mini"},
+	} {
+		if key, _ := Key(other[0], other[1], other[2], body); key == a {
+			t.Errorf("a different %s must change the cache key", name)
+		}
+	}
+}
+
+func TestCache_ExpiresAndSkipsOversizedEntries(t *testing.T) {
+	policy := Policy{TTL: time.Minute, MaxEntryBytes: 16, MaxEntries: 10, MaxBytes: 1024}
+	cache := New(NewMemoryStore(policy), policy)
+	now := time.Unix(0, 0)
+	cache.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	cache.Put(ctx, "small", Entry{Status: 200, Body: []byte("ok")})
+	cache.Put(ctx, "large", Entry{Status: 200, Body: []byte(strings.Repeat("x", 17))})
+
+	if entry, hit := cache.Get(ctx, "small"); !hit || string(entry.Body) != "ok" {
+		t.Errorf("Get(small) = %+v, %t", entry, hit)
+	}
+	if _, hit := cache.Get(ctx, "large"); hit {
+		t.Error("entries over MaxEntryBytes must not be stored")
+	}
+
+	now = now.Add(time.Minute)
+	if _, hit := cache.Get(ctx, "small"); hit {
+		t.Error("entry should expire after the TTL")
+	}
+}
+
+func TestMemoryStore_EvictsLeastRecentlyUsed(t *testing.T) {
+	store := NewMemoryStore(Policy{MaxEntries: 2, MaxBytes: 10})
+	ctx := context.Background()
+
+	_ = store.Set(ctx, "a", Entry{Body: []byte("1")})
+	_ = store.Set(ctx, "b", Entry{Body: []byte("2")})
+	_, _ = store.Get(ctx, "a")
+	_ = store.Set(ctx, "c", Entry{Body: []byte("3")})
+
+	if entry, _ := store.Get(ctx, "b"); entry != nil {
+		t.Error("least recently used entry should be evicted by count")
+	}
+	if entry, _ := store.Get(ctx, "a"); entry == nil {
+		t.Error("recently read entry should survive")
+	}
+
+	_ = store.Set(ctx, "big", Entry{Body: []byte("1234567890")})
+	if entry, _ := store.Get(ctx, "big"); entry == nil || store.order.Len() != 1 {
+		t.Errorf("byte limit should evict older entries, %d left", store.order.Len())
+	}
+}
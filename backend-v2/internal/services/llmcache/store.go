@@ -0,0 +1,124 @@
+package llmcache
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/qiniu/qmgo"
+	"github.com/qiniu/qmgo/options"
+	"go.mongodb.org/mongo-driver/bson"
+	mongoOptions "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+/* Store persists cache entries; Get returns nil without error on a miss */
+type Store interface {
+	Get(ctx context.Context, key string) (*Entry, error)
+	Set(ctx context.Context, key string, entry Entry) error
+}
+
+type memoryItem struct {
+	key   string
+	entry Entry
+}
+
+/* MemoryStore is an in-process LRU bounded by entry count and total bytes */
+type MemoryStore struct {
+	mu         sync.Mutex
+	maxEntries int
+	maxBytes   int64
+	bytes      int64
+	order      *list.List
+	items      map[string]*list.Element
+}
+
+func NewMemoryStore(policy Policy) *MemoryStore {
+	return &MemoryStore{
+		maxEntries: policy.MaxEntries,
+		maxBytes:   policy.MaxBytes,
+		order:      list.New(),
+		items:      map[string]*list.Element{},
+	}
+}
+
+func (s *MemoryStore) Get(_ context.Context, key string) (*Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	element, ok := s.items[key]
+	if !ok {
+		return nil, nil
+	}
+	s.order.MoveToFront(element)
+	entry := element.Value.(*memoryItem).entry
+	return &entry, nil
+}
+
+func (s *MemoryStore) Set(_ context.Context, key string, entry Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if element, ok := s.items[key]; ok {
+		s.remove(element)
+	}
+	s.items[key] = s.order.PushFront(&memoryItem{key: key, entry: entry})
+	s.bytes += entry.size()
+
+	for s.order.Len() > 0 && (s.order.Len() > s.maxEntries || s.bytes > s.maxBytes) {
+		s.remove(s.order.Back())
+	}
+	return nil
+}
+
+func (s *MemoryStore) remove(element *list.Element) {
+	item := element.Value.(*memoryItem)
+	s.order.Remove(element)
+	delete(s.items, item.key)
+	s.bytes -= item.entry.size()
+}
+
+const collectionName = "llmcache"
+
+type entryDocument struct {
+	Key   string `bson:"_id"`
+	Entry `bson:",inline"`
+}
+
+/* MongoStore shares the cache between instances; a TTL index on expiresAt evicts old entries */
+type MongoStore struct {
+	collection *qmgo.Collection
+}
+
+func NewMongoStore(db *qmgo.Database) *MongoStore {
+	collection := db.Collection(collectionName)
+
+	/* Without the index expired entries are still ignored on read, they just stay on disk */
+	expireAfter := int32(0)
+	err := collection.CreateOneIndex(context.Background(), options.IndexModel{
+		Key:          []string{"expiresAt"},
+		IndexOptions: mongoOptions.Index().SetExpireAfterSeconds(expireAfter),
+	})
+	if err != nil {
+		log.Warn("could not create TTL index on %s: %v", collectionName, err)
+	}
+
+	return &MongoStore{collection: collection}
+}
+
+func (s *MongoStore) Get(ctx context.Context, key string) (*Entry, error) {
+	var doc entryDocument
+	err := s.collection.Find(ctx, bson.M{"_id": key}).One(&doc)
+	if errors.Is(err, qmgo.ErrNoSuchDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &doc.Entry, nil
+}
+
+func (s *MongoStore) Set(ctx context.Context, key string, entry Entry) error {
+	_, err := s.collection.Upsert(ctx, bson.M{"_id": key}, entryDocument{Key: key, Entry: entry})
+	return err
+}
@@ -0,0 +1,193 @@
+package llmcatalog
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+)
+
+/* Model types */
+const (
+	TypeChat      = "chat"
+	TypeEmbedding = "embedding"
+)
+
+/* AuthBearer sends the key as "Authorization: Bearer <key>"; any other Auth value names the header carrying the raw key */
+const AuthBearer = "bearer"
+
+/* Model describes one model a provider serves; prices are USD per million tokens, 0 when unknown */
+type Model struct {
+	ID              string  `json:"id"`
+	Name            string  `json:"name,omitempty"`
+	Type            string  `json:"type"`
+	ContextWindow   int     `json:"contextWindow,omitempty"`
+	MaxOutputTokens int     `json:"maxOutputTokens,omitempty"`
+	InputPerMTok    float64 `json:"inputPerMTok,omitempty"`
+	OutputPerMTok   float64 `json:"outputPerMTok,omitempty"`
+}
+
+/* Provider is one upstream LLM API: where it lives, how it authenticates and what it serves */
+type Provider struct {
+	Name           string            `json:"name,omitempty"`
+	BaseURL        string            `json:"baseUrl,omitempty"`
+	ChatPath       string            `json:"chatPath,omitempty"`
+	EmbeddingsPath string            `json:"embeddingsPath,omitempty"`
+	Auth           string            `json:"auth,omitempty"`
+	Headers        map[string]string `json:"headers,omitempty"`
+	/* Integration names the models.Integration field holding the user's key */
+	Integration  string  `json:"integration,omitempty"`
+	DefaultModel string  `json:"defaultModel,omitempty"`
+	Models       []Model `json:"models,omitempty"`
+}
+
+/* ChatURL is the provider's chat/completion endpoint */
+func (p Provider) ChatURL() string {
+	return strings.TrimRight(p.BaseURL, "/") + p.ChatPath
+}
+
+/* EmbeddingsURL is the provider's embeddings endpoint, empty when it has none */
+func (p Provider) EmbeddingsURL() string {
+	if p.EmbeddingsPath == "" {
+		return ""
+	}
+	return strings.TrimRight(p.BaseURL, "/") + p.EmbeddingsPath
+}
+
+/* Catalog holds every provider definition, keyed by provider id ("openai", "claude", ...) */
+type Catalog struct {
+	Providers map[string]Provider `json:"providers"`
+}
+
+//go:embed defaults.json
+var defaultsJSON []byte
+
+/* Default returns the built-in catalog */
+func Default() *Catalog {
+	var catalog Catalog
+	if err := json.Unmarshal(defaultsJSON, &catalog); err != nil {
+		panic(fmt.Sprintf("llmcatalog: invalid defaults.json: %v", err))
+	}
+	return &catalog
+}
+
+/*
+Load overlays the built-in catalog with the JSON file at path (LLM_PROVIDERS_FILE) and then
+with inline JSON (LLM_PROVIDERS); both are optional and use the defaults.json schema.
+Set fields replace the default, headers merge by name, and a models list replaces the default list.
+*/
+func Load(path, inline string) (*Catalog, error) {
+	catalog := Default()
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", path, err)
+		}
+		if err := catalog.overlay(data); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	if strings.TrimSpace(inline) != "" {
+		if err := catalog.overlay([]byte(inline)); err != nil {
+			return nil, fmt.Errorf("inline providers: %w", err)
+		}
+	}
+
+	return catalog, catalog.validate()
+}
+
+func (c *Catalog) overlay(data []byte) error {
+	var override Catalog
+	if err := json.Unmarshal(data, &override); err != nil {
+		return fmt.Errorf("parse: %w", err)
+	}
+
+	for id, patch := range override.Providers {
+		provider, known := c.Providers[id]
+		if !known {
+			/* The proxy only has routes and adapters for built-in providers */
+			return fmt.Errorf("unknown provider %q", id)
+		}
+
+		if patch.Name != "" {
+			provider.Name = patch.Name
+		}
+		if patch.BaseURL != "" {
+			provider.BaseURL = patch.BaseURL
+		}
+		if patch.ChatPath != "" {
+			provider.ChatPath = patch.ChatPath
+		}
+		if patch.EmbeddingsPath != "" {
+			provider.EmbeddingsPath = patch.EmbeddingsPath
+		}
+		if patch.Auth != "" {
+			provider.Auth = patch.Auth
+		}
+		if patch.DefaultModel != "" {
+			provider.DefaultModel = patch.DefaultModel
+		}
+		if len(patch.Models) > 0 {
+			provider.Models = patch.Models
+		}
+		if len(patch.Headers) > 0 {
+			headers := make(map[string]string, len(provider.Headers)+len(patch.Headers))
+			for name, value := range provider.Headers {
+				headers[name] = value
+			}
+			for name, value := range patch.Headers {
+				headers[name] = value
+			}
+			provider.Headers = headers
+		}
+
+		c.Providers[id] = provider
+	}
+	return nil
+}
+
+func (c *Catalog) validate() error {
+	for id, provider := range c.Providers {
+		parsed, err := url.Parse(provider.BaseURL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return fmt.Errorf("provider %q: baseUrl %q must be an absolute http(s) URL", id, provider.BaseURL)
+		}
+		for _, model := range provider.Models {
+			if model.ID == "" || (model.Type != TypeChat && model.Type != TypeEmbedding) {
+				return fmt.Errorf("provider %q: model %q needs an id and type %q or %q", id, model.ID, TypeChat, TypeEmbedding)
+			}
+		}
+	}
+	return nil
+}
+
+/* Provider returns one provider definition */
+func (c *Catalog) Provider(id string) (Provider, bool) {
+	provider, ok := c.Providers[id]
+	return provider, ok
+}
+
+/* Model looks up a model of a provider */
+func (c *Catalog) Model(providerID, modelID string) (Model, bool) {
+	for _, model := range c.Providers[providerID].Models {
+		if model.ID == modelID {
+			return model, true
+		}
+	}
+	return Model{}, false
+}
+
+/* IDs returns the provider ids in stable order */
+func (c *Catalog) IDs() []string {
+	ids := make([]string, 0, len(c.Providers))
+	for id := range c.Providers {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
@@ -0,0 +1,80 @@
+package llmcatalog
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDefault_IsValid(t *testing.T) {
+	catalog := Default()
+	if err := catalog.validate(); err != nil {
+		t.Fatalf("defaults.json invalid: %v", err)
+	}
+
+	for _, id := range catalog.IDs() {
+		provider, _ := catalog.Provider(id)
+		if provider.DefaultModel == "" {
+			continue
+		}
+		if _, ok := catalog.Model(id, provider.DefaultModel); !ok {
+			t.Errorf("provider %s: default model %s is not in its model list", id, provider.DefaultModel)
+		}
+	}
+
+	claude, _ := catalog.Provider("claude")
+	if claude.ChatURL() != "https://api.anthropic.com/v1/messages" || claude.Headers["anthropic-version"] == "" {
+		t.Errorf("claude = %+v", claude)
+	}
+	if openai, _ := catalog.Provider("openai"); openai.EmbeddingsURL() != "https://api.openai.com/v1/embeddings" {
+		t.Errorf("openai embeddings URL = %s", openai.EmbeddingsURL())
+	}
+}
+
+func TestLoad_Overlays(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "providers.json")
+	file := `{"providers":{"openai":{"baseUrl":"https://gateway.example.com/openai/v1/"},
+		"claude":{"headers":{"anthropic-beta":"tools-2024"}}}}`
+	if err := os.WriteFile(path, []byte(file), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	inline := `{"providers":{"deepseek":{"models":[{"id":"deepseek-chat","type":"chat","contextWindow":65536,"inputPerMTok":0.27}]}}}`
+
+	catalog, err := Load(path, inline)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	openai, _ := catalog.Provider("openai")
+	if openai.ChatURL() != "https://gateway.example.com/openai/v1/chat/completions" || len(openai.Models) == 0 {
+		t.Errorf("openai = %s with %d models", openai.ChatURL(), len(openai.Models))
+	}
+	claude, _ := catalog.Provider("claude")
+	if claude.Headers["anthropic-version"] != "2023-06-01" || claude.Headers["anthropic-beta"] != "tools-2024" {
+		t.Errorf("claude headers = %v, want defaults merged with overrides", claude.Headers)
+	}
+	if model, _ := catalog.Model("deepseek", "deepseek-chat"); model.InputPerMTok != 0.27 || len(catalog.Providers["deepseek"].Models) != 1 {
+		t.Errorf("deepseek models = %+v", catalog.Providers["deepseek"].Models)
+	}
+	if Default().Providers["openai"].BaseURL != "https://api.openai.com/v1" {
+		t.Error("Load must not modify the built-in defaults")
+	}
+}
+
+func TestLoad_Rejects(t *testing.T) {
+	cases := map[string]string{
+		"unknown provider": `{"providers":{"mistral":{"baseUrl":"https://api.mistral.ai/v1"}}}`,
+		"relative url":     `{"providers":{"openai":{"baseUrl":"/v1"}}}`,
+		"untyped model":    `{"providers":{"openai":{"models":[{"id":"gpt-x"}]}}}`,
+		"malformed json":   `{"providers":`,
+	}
+	for name, inline := range cases {
+		if _, err := Load("", inline); err == nil {
+			t.Errorf("%s: Load() expected error", name)
+		}
+	}
+
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.json"), ""); err == nil {
+		t.Error("missing file: Load() expected error")
+	}
+}
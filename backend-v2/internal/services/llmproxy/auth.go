@@ -1,6 +1,10 @@
 package llmproxy
 
-import "github.com/gofiber/fiber/v2"
+import (
+	"backend-v2/internal/providers/apikey"
+
+	"github.com/gofiber/fiber/v2"
+)
 
 const (
 	bearerPrefix      = "Bearer "
@@ -25,6 +29,7 @@ func HeaderAPIKeyExtractor(c *fiber.Ctx) string {
 	return c.Get(headerAPIKey)
 }
 
+/* IsEmptyAPIKey reports whether the client sent no usable key (missing, "EMPTY" or a masked echo) */
 func IsEmptyAPIKey(key string) bool {
-	return key == "" || key == emptyAPIKey
+	return key == "" || key == emptyAPIKey || apikey.IsMasked(key)
 }
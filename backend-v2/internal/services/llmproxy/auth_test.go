@@ -149,6 +149,12 @@ func TestIsEmptyAPIKey_EMPTY(t *testing.T) {
 	}
 }
 
+func TestIsEmptyAPIKey_Masked(t *testing.T) {
+	if !IsEmptyAPIKey("****abcd") {
+		t.Error("Masked key should be considered empty API key")
+	}
+}
+
 func TestIsEmptyAPIKey_ValidKey(t *testing.T) {
 	if IsEmptyAPIKey("sk-test-key") {
 		t.Error("Valid key should not be considered empty")
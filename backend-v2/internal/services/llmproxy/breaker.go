@@ -0,0 +1,100 @@
+package llmproxy
+
+import (
+	"sync"
+	"time"
+)
+
+/*
+CircuitBreaker fails fast on upstreams that keep erroring. After threshold consecutive
+failures a circuit opens for cooldown; then a single probe request is let through and
+its outcome closes or re-opens the circuit. State is per process.
+*/
+type CircuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+	circuits  map[string]*circuit
+}
+
+type circuit struct {
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+/* NewCircuitBreaker builds a breaker; a threshold of 0 disables it */
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		now:       time.Now,
+		circuits:  make(map[string]*circuit),
+	}
+}
+
+/* Allow reports whether a request to key may go out; in the half-open state only one probe is allowed */
+func (b *CircuitBreaker) Allow(key string) bool {
+	if b.threshold <= 0 {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	state, ok := b.circuits[key]
+	if !ok || state.failures < b.threshold {
+		return true
+	}
+	if b.now().Before(state.openUntil) || state.probing {
+		return false
+	}
+	state.probing = true
+	return true
+}
+
+/* IsOpen reports whether key is currently failing fast, without claiming a probe */
+func (b *CircuitBreaker) IsOpen(key string) bool {
+	if b.threshold <= 0 {
+		return false
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	state, ok := b.circuits[key]
+	return ok && state.failures >= b.threshold && b.now().Before(state.openUntil)
+}
+
+/* Success closes the circuit */
+func (b *CircuitBreaker) Success(key string) {
+	if b.threshold <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.circuits, key)
+}
+
+/* Failure counts one upstream failure and opens the circuit once the threshold is reached */
+func (b *CircuitBreaker) Failure(key string) {
+	if b.threshold <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	state, ok := b.circuits[key]
+	if !ok {
+		state = &circuit{}
+		b.circuits[key] = state
+	}
+	state.failures++
+	state.probing = false
+	if state.failures >= b.threshold {
+		state.openUntil = b.now().Add(b.cooldown)
+	}
+}
@@ -0,0 +1,150 @@
+package llmproxy
+
+import (
+	"encoding/json"
+
+	"backend-v2/internal/common/constants"
+	"backend-v2/internal/services/llmcache"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+/*
+HeaderCache is sent both ways: a request may carry "on" to cache a non-deterministic call
+or "off" to bypass the cache, and cacheable responses carry "hit" or "miss"
+*/
+const HeaderCache = "X-LLM-Cache"
+
+/* CachedService replays identical deterministic requests from a per-user cache in front of another Service */
+type CachedService struct {
+	next  Service
+	cache *llmcache.Cache
+}
+
+func NewCachedService(next Service, cache *llmcache.Cache) Service {
+	return &CachedService{next: next, cache: cache}
+}
+
+func (s *CachedService) ChatCompletions(c *fiber.Ctx) error {
+	return s.cached(c, "openai", false, s.next.ChatCompletions)
+}
+
+func (s *CachedService) Embeddings(c *fiber.Ctx) error {
+	return s.cached(c, "openai-embeddings", true, s.next.Embeddings)
+}
+
+func (s *CachedService) PerplexityChatCompletions(c *fiber.Ctx) error {
+	return s.cached(c, "perplexity", false, s.next.PerplexityChatCompletions)
+}
+
+func (s *CachedService) ClaudeMessages(c *fiber.Ctx) error {
+	return s.cached(c, "claude", false, s.next.ClaudeMessages)
+}
+
+func (s *CachedService) YandexCompletion(c *fiber.Ctx) error {
+	return s.cached(c, "yandex", false, s.next.YandexCompletion)
+}
+
+func (s *CachedService) DeepSeekChatCompletions(c *fiber.Ctx) error {
+	return s.cached(c, "deepseek", false, s.next.DeepSeekChatCompletions)
+}
+
+func (s *CachedService) QwenChatCompletions(c *fiber.Ctx) error {
+	return s.cached(c, "qwen", false, s.next.QwenChatCompletions)
+}
+
+func (s *CachedService) CustomLLMChatCompletions(c *fiber.Ctx) error {
+	return s.cached(c, "custom_llm", false, s.next.CustomLLMChatCompletions)
+}
+
+func (s *CachedService) CustomLLMEmbeddings(c *fiber.Ctx) error {
+	return s.cached(c, "custom_llm-embeddings", true, s.next.CustomLLMEmbeddings)
+}
+
+func (s *CachedService) LocalChatCompletions(c *fiber.Ctx) error {
+	return s.cached(c, "local", false, s.next.LocalChatCompletions)
+}
+
+func (s *CachedService) LocalEmbeddings(c *fiber.Ctx) error {
+	return s.cached(c, "local-embeddings", true, s.next.LocalEmbeddings)
+}
+
+/* LocalModels reflects what the server has pulled right now, so it is never cached */
+func (s *CachedService) LocalModels(c *fiber.Ctx) error {
+	return s.next.LocalModels(c)
+}
+
+/* Chat has its own namespace: its normalized responses differ from the raw routes' for the same body */
+func (s *CachedService) Chat(c *fiber.Ctx) error {
+	return s.cached(c, "chat", false, s.next.Chat)
+}
+
+/* cached serves a hit, or runs handler and stores its successful buffered response */
+func (s *CachedService) cached(c *fiber.Ctx, route string, deterministic bool, handler fiber.Handler) error {
+	userID, _ := c.Locals(constants.ContextUserIDKey).(string)
+
+	var body map[string]interface{}
+	if userID == "" || json.Unmarshal(c.Body(), &body) != nil || !cacheable(c, body, deterministic) {
+		return handler(c)
+	}
+
+	model, _ := body["model"].(string)
+	key, err := llmcache.Key(userID, route, model, body)
+	if err != nil {
+		return handler(c)
+	}
+
+	if entry, hit := s.cache.Get(c.Context(), key); hit {
+		c.Set(HeaderCache, "hit")
+		if entry.Provider != "" {
+			setServedHeaders(c, Target{Provider: entry.Provider, Model: entry.Model})
+		}
+		c.Set(fiber.HeaderContentType, entry.ContentType)
+		return c.Status(entry.Status).Send(entry.Body)
+	}
+
+	if err := handler(c); err != nil {
+		return err
+	}
+	c.Set(HeaderCache, "miss")
+
+	resp := c.Response()
+	status := resp.StatusCode()
+	if status < 200 || status >= 300 || resp.IsBodyStream() {
+		return nil
+	}
+	s.cache.Put(c.Context(), key, llmcache.Entry{
+		Status:      status,
+		ContentType: string(resp.Header.ContentType()),
+		Body:        append([]byte(nil), resp.Body()...),
+		Provider:    string(resp.Header.Peek(HeaderServedProvider)),
+		Model:       string(resp.Header.Peek(HeaderServedModel)),
+	})
+	return nil
+}
+
+/*
+cacheable admits embeddings and temperature-0 calls unless the caller opted out; "on" admits
+anything else. Streams and key validation always go upstream.
+*/
+func cacheable(c *fiber.Ctx, body map[string]interface{}, deterministic bool) bool {
+	if IsKeyValidation(c) || c.Get(HeaderCache) == "off" {
+		return false
+	}
+
+	/* Yandex nests its generation settings under completionOptions */
+	options, _ := body["completionOptions"].(map[string]interface{})
+	if body["stream"] == true || options["stream"] == true {
+		return false
+	}
+
+	if deterministic || c.Get(HeaderCache) == "on" {
+		return true
+	}
+	return isZero(body["temperature"]) || isZero(options["temperature"])
+}
+
+func isZero(value interface{}) bool {
+	number, ok := value.(float64)
+	return ok && number == 0
+}
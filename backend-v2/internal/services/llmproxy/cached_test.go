@@ -0,0 +1,86 @@
+package llmproxy
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"backend-v2/internal/common/constants"
+	"backend-v2/internal/services/llmcache"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+/* countingService answers every chat call with a distinct body so replays are detectable */
+type countingService struct {
+	Service
+	calls int
+}
+
+func (s *countingService) ChatCompletions(c *fiber.Ctx) error {
+	s.calls++
+	setServedHeaders(c, Target{Provider: "openai", Model: "gpt-4o"})
+	return c.JSON(fiber.Map{"call": s.calls})
+}
+
+func TestCachedService(t *testing.T) {
+	next := &countingService{}
+	policy := llmcache.DefaultPolicy()
+	cached := NewCachedService(next, llmcache.New(llmcache.NewMemoryStore(policy), policy))
+
+	app := fiber.New()
+	app.Post("/chat", func(c *fiber.Ctx) error {
+		c.Locals(constants.ContextUserIDKey, c.Get("X-Test-User"))
+		return cached.ChatCompletions(c)
+	})
+
+	call := func(user, body, cacheHeader string) (string, string) {
+		t.Helper()
+		req := httptest.NewRequest("POST", "/chat", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Test-User", user)
+		if cacheHeader != "" {
+			req.Header.Set(HeaderCache, cacheHeader)
+		}
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatalf("Test request failed: %v", err)
+		}
+		data, _ := io.ReadAll(resp.Body)
+		if resp.Header.Get(HeaderCache) == "hit" && resp.Header.Get(HeaderServedProvider) != "openai" {
+			t.Errorf("hit should replay the served provider header")
+		}
+		return resp.Header.Get(HeaderCache), string(data)
+	}
+
+	deterministic := `{"model":"gpt-4o","temperature":0,"messages":[{"role":"user","content":"hi"}]}`
+	if state, body := call("user-1", deterministic, ""); state != "miss" || body != `{"call":1}` {
+		t.Fatalf("first call = %s %s", state, body)
+	}
+	reordered := `{"messages":[{"role":"user","content":"hi"}],"temperature":0,"model":"gpt-4o"}`
+	if state, body := call("user-1", reordered, ""); state != "hit" || body != `{"call":1}` {
+		t.Errorf("repeat call = %s %s, want hit replaying call 1", state, body)
+	}
+	if state, _ := call("user-2", deterministic, ""); state != "miss" {
+		t.Errorf("another user's call = %s, cache must be per user", state)
+	}
+	if state, _ := call("user-1", deterministic, "off"); state != "" {
+		t.Errorf("opted-out call = %q, want bypass", state)
+	}
+
+	creative := `{"model":"gpt-4o","temperature":0.7,"messages":[]}`
+	call("user-1", creative, "")
+	if state, _ := call("user-1", creative, ""); state != "" {
+		t.Errorf("non-zero temperature must bypass the cache, got %q", state)
+	}
+	call("user-1", creative, "on")
+	if state, _ := call("user-1", creative, "on"); state != "hit" {
+		t.Errorf("explicitly cacheable call = %q, want hit", state)
+	}
+
+	streaming := `{"model":"gpt-4o","temperature":0,"stream":true,"messages":[]}`
+	if state, _ := call("user-1", streaming, ""); state != "" {
+		t.Errorf("streams must bypass the cache, got %q", state)
+	}
+}
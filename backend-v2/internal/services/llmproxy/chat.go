@@ -0,0 +1,157 @@
+package llmproxy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"backend-v2/internal/services/usage"
+)
+
+/* Roles of normalized chat messages */
+const (
+	RoleSystem    = "system"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+	RoleTool      = "tool"
+)
+
+/* Normalized finish reasons */
+const (
+	FinishStop      = "stop"
+	FinishLength    = "length"
+	FinishToolCalls = "tool_calls"
+)
+
+var (
+	ErrUnknownChatProvider = errors.New("unknown chat provider")
+	ErrUnsupportedFeature  = errors.New("not supported by this provider")
+)
+
+/* ChatRequest is the provider-agnostic body of POST /llm/chat */
+type ChatRequest struct {
+	Provider    string        `json:"provider"`
+	Model       string        `json:"model"`
+	Messages    []ChatMessage `json:"messages"`
+	Temperature *float64      `json:"temperature,omitempty"`
+	TopP        *float64      `json:"topP,omitempty"`
+	MaxTokens   int           `json:"maxTokens,omitempty"`
+	Stop        []string      `json:"stop,omitempty"`
+	Stream      bool          `json:"stream,omitempty"`
+	Tools       []ChatTool    `json:"tools,omitempty"`
+
+	/* folderID is filled from the stored Yandex integration when the model is not a full URI */
+	folderID string
+}
+
+/* ChatMessage is one conversation turn; assistant turns may request tool calls, tool turns answer them */
+type ChatMessage struct {
+	Role       string     `json:"role"`
+	Content    string     `json:"content"`
+	ToolCalls  []ToolCall `json:"toolCalls,omitempty"`
+	ToolCallID string     `json:"toolCallId,omitempty"`
+}
+
+/* ChatTool declares a function the model may call; Parameters is a JSON schema */
+type ChatTool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Parameters  json.RawMessage `json:"parameters,omitempty"`
+}
+
+/* ToolCall is a model's request to run a tool; Arguments is a JSON document */
+type ToolCall struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+/* ChatResponse is the normalized non-streamed answer */
+type ChatResponse struct {
+	ID           string       `json:"id,omitempty"`
+	Provider     string       `json:"provider"`
+	Model        string       `json:"model"`
+	Message      ChatMessage  `json:"message"`
+	FinishReason string       `json:"finishReason"`
+	Usage        usage.Tokens `json:"usage"`
+}
+
+/* ChatStreamEvent is one normalized SSE event; the last event carries finishReason and usage */
+type ChatStreamEvent struct {
+	Delta        *ChatDelta    `json:"delta,omitempty"`
+	FinishReason string        `json:"finishReason,omitempty"`
+	Usage        *usage.Tokens `json:"usage,omitempty"`
+}
+
+/* ChatDelta is incremental assistant output */
+type ChatDelta struct {
+	Content   string          `json:"content,omitempty"`
+	ToolCalls []ToolCallDelta `json:"toolCalls,omitempty"`
+}
+
+/* ToolCallDelta streams a tool call: id and name arrive first, arguments in fragments */
+type ToolCallDelta struct {
+	Index     int    `json:"index"`
+	ID        string `json:"id,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments,omitempty"`
+}
+
+/* Validate checks the request shape independent of provider */
+func (r *ChatRequest) Validate() error {
+	if r.Provider == "" {
+		return errors.New("provider is required")
+	}
+	if len(r.Messages) == 0 {
+		return errors.New("messages must not be empty")
+	}
+	for i, message := range r.Messages {
+		switch message.Role {
+		case RoleSystem, RoleUser, RoleAssistant:
+		case RoleTool:
+			if message.ToolCallID == "" {
+				return fmt.Errorf("messages[%d]: tool messages need toolCallId", i)
+			}
+		default:
+			return fmt.Errorf("messages[%d]: unknown role %q", i, message.Role)
+		}
+	}
+	for i, tool := range r.Tools {
+		if tool.Name == "" {
+			return fmt.Errorf("tools[%d]: name is required", i)
+		}
+	}
+	return nil
+}
+
+/* hasToolTraffic reports whether the conversation declares or uses tools */
+func (r *ChatRequest) hasToolTraffic() bool {
+	if len(r.Tools) > 0 {
+		return true
+	}
+	for _, message := range r.Messages {
+		if message.Role == RoleTool || len(message.ToolCalls) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+/* toolSchema returns the tool's parameter schema, defaulting to an empty object schema */
+func (t ChatTool) toolSchema() json.RawMessage {
+	if len(t.Parameters) == 0 {
+		return json.RawMessage(`{"type":"object","properties":{}}`)
+	}
+	return t.Parameters
+}
+
+/* sseEvent frames a normalized event as an SSE data line */
+func sseEvent(event interface{}) []byte {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return nil
+	}
+	return []byte("data: " + string(data) + "\n\n")
+}
+
+var sseDone = []byte("data: [DONE]\n\n")
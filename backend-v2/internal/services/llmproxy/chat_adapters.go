@@ -0,0 +1,501 @@
+package llmproxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+/* chatAdapter translates the unified chat format to one provider API family and back */
+type chatAdapter interface {
+	buildBody(req *ChatRequest) (map[string]interface{}, error)
+	parseResponse(body []byte) (*ChatResponse, error)
+	newStreamTranslator() chatStreamTranslator
+}
+
+/* chatStreamTranslator turns the JSON payload of one upstream SSE data line into normalized events */
+type chatStreamTranslator interface {
+	translate(payload []byte) []ChatStreamEvent
+	finishReason() string
+}
+
+/* chatAdapters lists the providers reachable through POST /llm/chat */
+var chatAdapters = map[string]chatAdapter{
+	"openai":     openAIChatAdapter{streamUsage: true},
+	"deepseek":   openAIChatAdapter{streamUsage: true},
+	"qwen":       openAIChatAdapter{streamUsage: true},
+	"perplexity": openAIChatAdapter{},
+	"custom_llm": openAIChatAdapter{},
+	"local":      openAIChatAdapter{},
+	"claude":     claudeChatAdapter{},
+	"yandex":     yandexChatAdapter{},
+}
+
+func applyCommonOptions(body map[string]interface{}, req *ChatRequest, maxTokensField string) {
+	if req.Temperature != nil {
+		body["temperature"] = *req.Temperature
+	}
+	if req.TopP != nil {
+		body["top_p"] = *req.TopP
+	}
+	if req.MaxTokens > 0 {
+		body[maxTokensField] = req.MaxTokens
+	}
+	if req.Stream {
+		body["stream"] = true
+	}
+}
+
+/* toolArguments parses tool call arguments, falling back to an empty object for invalid JSON */
+func toolArguments(arguments string) json.RawMessage {
+	if json.Valid([]byte(arguments)) && strings.HasPrefix(strings.TrimSpace(arguments), "{") {
+		return json.RawMessage(arguments)
+	}
+	return json.RawMessage(`{}`)
+}
+
+/* ---------- OpenAI-compatible (OpenAI, DeepSeek, Perplexity, custom endpoints) ---------- */
+
+type openAIChatAdapter struct {
+	/* streamUsage asks for the final usage chunk, which not every compatible API accepts */
+	streamUsage bool
+}
+
+type openAIToolCall struct {
+	Index    int    `json:"index"`
+	ID       string `json:"id,omitempty"`
+	Type     string `json:"type,omitempty"`
+	Function struct {
+		Name      string `json:"name,omitempty"`
+		Arguments string `json:"arguments,omitempty"`
+	} `json:"function"`
+}
+
+type openAIChatResponse struct {
+	ID      string `json:"id"`
+	Model   string `json:"model"`
+	Choices []struct {
+		Message struct {
+			Content   *string          `json:"content"`
+			ToolCalls []openAIToolCall `json:"tool_calls"`
+		} `json:"message"`
+		Delta struct {
+			Content   string           `json:"content"`
+			ToolCalls []openAIToolCall `json:"tool_calls"`
+		} `json:"delta"`
+		FinishReason *string `json:"finish_reason"`
+	} `json:"choices"`
+}
+
+func (a openAIChatAdapter) buildBody(req *ChatRequest) (map[string]interface{}, error) {
+	messages := make([]map[string]interface{}, 0, len(req.Messages))
+	for _, message := range req.Messages {
+		switch {
+		case message.Role == RoleTool:
+			messages = append(messages, map[string]interface{}{
+				"role":         RoleTool,
+				"tool_call_id": message.ToolCallID,
+				"content":      message.Content,
+			})
+		case len(message.ToolCalls) > 0:
+			calls := make([]map[string]interface{}, 0, len(message.ToolCalls))
+			for _, call := range message.ToolCalls {
+				calls = append(calls, map[string]interface{}{
+					"id":       call.ID,
+					"type":     "function",
+					"function": map[string]interface{}{"name": call.Name, "arguments": call.Arguments},
+				})
+			}
+			var content interface{}
+			if message.Content != "" {
+				content = message.Content
+			}
+			messages = append(messages, map[string]interface{}{"role": message.Role, "content": content, "tool_calls": calls})
+		default:
+			messages = append(messages, map[string]interface{}{"role": message.Role, "content": message.Content})
+		}
+	}
+
+	body := map[string]interface{}{"model": req.Model, "messages": messages}
+	applyCommonOptions(body, req, "max_tokens")
+	if len(req.Stop) > 0 {
+		body["stop"] = req.Stop
+	}
+	if req.Stream && a.streamUsage {
+		body["stream_options"] = map[string]interface{}{"include_usage": true}
+	}
+
+	if len(req.Tools) > 0 {
+		tools := make([]map[string]interface{}, 0, len(req.Tools))
+		for _, tool := range req.Tools {
+			tools = append(tools, map[string]interface{}{
+				"type": "function",
+				"function": map[string]interface{}{
+					"name":        tool.Name,
+					"description": tool.Description,
+					"parameters":  tool.toolSchema(),
+				},
+			})
+		}
+		body["tools"] = tools
+	}
+
+	return body, nil
+}
+
+func (a openAIChatAdapter) parseResponse(body []byte) (*ChatResponse, error) {
+	var parsed openAIChatResponse
+	if err := json.Unmarshal(body, &parsed); err != nil || len(parsed.Choices) == 0 {
+		return nil, fmt.Errorf("unexpected response format")
+	}
+
+	choice := parsed.Choices[0]
+	message := ChatMessage{Role: RoleAssistant}
+	if choice.Message.Content != nil {
+		message.Content = *choice.Message.Content
+	}
+	for _, call := range choice.Message.ToolCalls {
+		message.ToolCalls = append(message.ToolCalls, ToolCall{ID: call.ID, Name: call.Function.Name, Arguments: call.Function.Arguments})
+	}
+
+	finish := ""
+	if choice.FinishReason != nil {
+		finish = openAIFinishReason(*choice.FinishReason)
+	}
+
+	return &ChatResponse{ID: parsed.ID, Model: parsed.Model, Message: message, FinishReason: finish}, nil
+}
+
+func openAIFinishReason(reason string) string {
+	switch reason {
+	case "tool_calls", "function_call":
+		return FinishToolCalls
+	default:
+		return reason
+	}
+}
+
+func (a openAIChatAdapter) newStreamTranslator() chatStreamTranslator {
+	return &openAIStreamTranslator{}
+}
+
+type openAIStreamTranslator struct {
+	finish string
+}
+
+func (t *openAIStreamTranslator) translate(payload []byte) []ChatStreamEvent {
+	var chunk openAIChatResponse
+	if err := json.Unmarshal(payload, &chunk); err != nil || len(chunk.Choices) == 0 {
+		return nil
+	}
+
+	choice := chunk.Choices[0]
+	if choice.FinishReason != nil && *choice.FinishReason != "" {
+		t.finish = openAIFinishReason(*choice.FinishReason)
+	}
+
+	delta := ChatDelta{Content: choice.Delta.Content}
+	for _, call := range choice.Delta.ToolCalls {
+		delta.ToolCalls = append(delta.ToolCalls, ToolCallDelta{
+			Index:     call.Index,
+			ID:        call.ID,
+			Name:      call.Function.Name,
+			Arguments: call.Function.Arguments,
+		})
+	}
+	if delta.Content == "" && len(delta.ToolCalls) == 0 {
+		return nil
+	}
+	return []ChatStreamEvent{{Delta: &delta}}
+}
+
+func (t *openAIStreamTranslator) finishReason() string {
+	return t.finish
+}
+
+/* ---------- Claude messages ---------- */
+
+/* claudeDefaultMaxTokens is sent when the client gives none; the Messages API requires max_tokens */
+const claudeDefaultMaxTokens = 4096
+
+type claudeChatAdapter struct{}
+
+type claudeBlock struct {
+	Type  string          `json:"type"`
+	Text  string          `json:"text,omitempty"`
+	ID    string          `json:"id,omitempty"`
+	Name  string          `json:"name,omitempty"`
+	Input json.RawMessage `json:"input,omitempty"`
+}
+
+type claudeResponse struct {
+	ID         string        `json:"id"`
+	Model      string        `json:"model"`
+	Content    []claudeBlock `json:"content"`
+	StopReason string        `json:"stop_reason"`
+}
+
+func (a claudeChatAdapter) buildBody(req *ChatRequest) (map[string]interface{}, error) {
+	var system []string
+	var messages []map[string]interface{}
+
+	/* Claude requires alternating roles, so consecutive turns of one role are merged into one block list */
+	appendBlocks := func(role string, blocks ...map[string]interface{}) {
+		if n := len(messages); n > 0 && messages[n-1]["role"] == role {
+			messages[n-1]["content"] = append(messages[n-1]["content"].([]map[string]interface{}), blocks...)
+			return
+		}
+		messages = append(messages, map[string]interface{}{"role": role, "content": blocks})
+	}
+
+	for _, message := range req.Messages {
+		switch message.Role {
+		case RoleSystem:
+			system = append(system, message.Content)
+		case RoleTool:
+			appendBlocks(RoleUser, map[string]interface{}{
+				"type":        "tool_result",
+				"tool_use_id": message.ToolCallID,
+				"content":     message.Content,
+			})
+		default:
+			var blocks []map[string]interface{}
+			if message.Content != "" {
+				blocks = append(blocks, map[string]interface{}{"type": "text", "text": message.Content})
+			}
+			for _, call := range message.ToolCalls {
+				blocks = append(blocks, map[string]interface{}{
+					"type":  "tool_use",
+					"id":    call.ID,
+					"name":  call.Name,
+					"input": toolArguments(call.Arguments),
+				})
+			}
+			if len(blocks) > 0 {
+				appendBlocks(message.Role, blocks...)
+			}
+		}
+	}
+
+	body := map[string]interface{}{
+		"model":      req.Model,
+		"messages":   messages,
+		"max_tokens": claudeDefaultMaxTokens,
+	}
+	applyCommonOptions(body, req, "max_tokens")
+	if len(system) > 0 {
+		body["system"] = strings.Join(system, "\n\n")
+	}
+	if len(req.Stop) > 0 {
+		body["stop_sequences"] = req.Stop
+	}
+
+	if len(req.Tools) > 0 {
+		tools := make([]map[string]interface{}, 0, len(req.Tools))
+		for _, tool := range req.Tools {
+			tools = append(tools, map[string]interface{}{
+				"name":         tool.Name,
+				"description":  tool.Description,
+				"input_schema": tool.toolSchema(),
+			})
+		}
+		body["tools"] = tools
+	}
+
+	return body, nil
+}
+
+func (a claudeChatAdapter) parseResponse(body []byte) (*ChatResponse, error) {
+	var parsed claudeResponse
+	if err := json.Unmarshal(body, &parsed); err != nil || parsed.Content == nil {
+		return nil, fmt.Errorf("unexpected response format")
+	}
+
+	message := ChatMessage{Role: RoleAssistant}
+	var text []string
+	for _, block := range parsed.Content {
+		switch block.Type {
+		case "text":
+			text = append(text, block.Text)
+		case "tool_use":
+			arguments := string(block.Input)
+			if arguments == "" {
+				arguments = "{}"
+			}
+			message.ToolCalls = append(message.ToolCalls, ToolCall{ID: block.ID, Name: block.Name, Arguments: arguments})
+		}
+	}
+	message.Content = strings.Join(text, "")
+
+	return &ChatResponse{ID: parsed.ID, Model: parsed.Model, Message: message, FinishReason: claudeFinishReason(parsed.StopReason)}, nil
+}
+
+func claudeFinishReason(reason string) string {
+	switch reason {
+	case "end_turn", "stop_sequence":
+		return FinishStop
+	case "max_tokens":
+		return FinishLength
+	case "tool_use":
+		return FinishToolCalls
+	default:
+		return reason
+	}
+}
+
+func (a claudeChatAdapter) newStreamTranslator() chatStreamTranslator {
+	return &claudeStreamTranslator{toolIndex: map[int]int{}}
+}
+
+type claudeStreamTranslator struct {
+	finish    string
+	toolIndex map[int]int
+}
+
+type claudeStreamEvent struct {
+	Type         string      `json:"type"`
+	Index        int         `json:"index"`
+	ContentBlock claudeBlock `json:"content_block"`
+	Delta        struct {
+		Type        string `json:"type"`
+		Text        string `json:"text"`
+		PartialJSON string `json:"partial_json"`
+		StopReason  string `json:"stop_reason"`
+	} `json:"delta"`
+}
+
+func (t *claudeStreamTranslator) translate(payload []byte) []ChatStreamEvent {
+	var event claudeStreamEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil
+	}
+
+	switch event.Type {
+	case "content_block_start":
+		if event.ContentBlock.Type != "tool_use" {
+			return nil
+		}
+		/* Claude indexes all content blocks; clients see tool calls numbered from 0 */
+		index := len(t.toolIndex)
+		t.toolIndex[event.Index] = index
+		return []ChatStreamEvent{{Delta: &ChatDelta{ToolCalls: []ToolCallDelta{{
+			Index: index,
+			ID:    event.ContentBlock.ID,
+			Name:  event.ContentBlock.Name,
+		}}}}}
+	case "content_block_delta":
+		switch event.Delta.Type {
+		case "text_delta":
+			return []ChatStreamEvent{{Delta: &ChatDelta{Content: event.Delta.Text}}}
+		case "input_json_delta":
+			index, ok := t.toolIndex[event.Index]
+			if !ok || event.Delta.PartialJSON == "" {
+				return nil
+			}
+			return []ChatStreamEvent{{Delta: &ChatDelta{ToolCalls: []ToolCallDelta{{
+				Index:     index,
+				Arguments: event.Delta.PartialJSON,
+			}}}}}
+		}
+	case "message_delta":
+		if event.Delta.StopReason != "" {
+			t.finish = claudeFinishReason(event.Delta.StopReason)
+		}
+	}
+	return nil
+}
+
+func (t *claudeStreamTranslator) finishReason() string {
+	return t.finish
+}
+
+/* ---------- Yandex foundation models ---------- */
+
+const yandexDefaultModel = "yandexgpt/latest"
+
+type yandexChatAdapter struct{}
+
+type yandexResponse struct {
+	Result struct {
+		Alternatives []struct {
+			Message struct {
+				Text string `json:"text"`
+			} `json:"message"`
+			Status string `json:"status"`
+		} `json:"alternatives"`
+		ModelVersion string `json:"modelVersion"`
+	} `json:"result"`
+}
+
+/* yandexModelURI accepts a full gpt:// URI or a model name completed with the folder id */
+func yandexModelURI(model, folderID string) (string, error) {
+	if strings.Contains(model, "://") {
+		return model, nil
+	}
+	if folderID == "" {
+		return "", fmt.Errorf("yandex needs a gpt:// model URI or a folder_id in the integration")
+	}
+	if model == "" {
+		model = yandexDefaultModel
+	}
+	return fmt.Sprintf("gpt://%s/%s", folderID, model), nil
+}
+
+func (a yandexChatAdapter) buildBody(req *ChatRequest) (map[string]interface{}, error) {
+	if req.Stream {
+		return nil, fmt.Errorf("streaming is %w", ErrUnsupportedFeature)
+	}
+	if req.hasToolTraffic() {
+		return nil, fmt.Errorf("tool calls are %w", ErrUnsupportedFeature)
+	}
+
+	modelURI, err := yandexModelURI(req.Model, req.folderID)
+	if err != nil {
+		return nil, err
+	}
+
+	messages := make([]map[string]interface{}, 0, len(req.Messages))
+	for _, message := range req.Messages {
+		messages = append(messages, map[string]interface{}{"role": message.Role, "text": message.Content})
+	}
+
+	options := map[string]interface{}{"stream": false}
+	if req.Temperature != nil {
+		options["temperature"] = *req.Temperature
+	}
+	if req.MaxTokens > 0 {
+		/* int64 fields are strings in the Yandex JSON API */
+		options["maxTokens"] = strconv.Itoa(req.MaxTokens)
+	}
+
+	return map[string]interface{}{
+		"modelUri":          modelURI,
+		"completionOptions": options,
+		"messages":          messages,
+	}, nil
+}
+
+func (a yandexChatAdapter) parseResponse(body []byte) (*ChatResponse, error) {
+	var parsed yandexResponse
+	if err := json.Unmarshal(body, &parsed); err != nil || len(parsed.Result.Alternatives) == 0 {
+		return nil, fmt.Errorf("unexpected response format")
+	}
+
+	alternative := parsed.Result.Alternatives[0]
+	finish := FinishStop
+	if alternative.Status == "ALTERNATIVE_STATUS_TRUNCATED_FINAL" {
+		finish = FinishLength
+	}
+
+	return &ChatResponse{
+		Model:        parsed.Result.ModelVersion,
+		Message:      ChatMessage{Role: RoleAssistant, Content: alternative.Message.Text},
+		FinishReason: finish,
+	}, nil
+}
+
+/* newStreamTranslator is never used: buildBody rejects streaming requests */
+func (a yandexChatAdapter) newStreamTranslator() chatStreamTranslator {
+	return &openAIStreamTranslator{}
+}
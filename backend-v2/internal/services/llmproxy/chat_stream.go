@@ -0,0 +1,89 @@
+package llmproxy
+
+import (
+	"bytes"
+	"encoding/json"
+	nethttp "net/http"
+
+	"backend-v2/internal/services/usage"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+/* chatStreamTransformer renders a provider SSE stream as normalized ChatStreamEvents */
+type chatStreamTransformer struct {
+	provider   string
+	translator chatStreamTranslator
+	meter      usage.StreamMeter
+}
+
+func newChatStreamTransformer(provider string, translator chatStreamTranslator) *chatStreamTransformer {
+	return &chatStreamTransformer{provider: provider, translator: translator}
+}
+
+func (t *chatStreamTransformer) Transform(line []byte) []byte {
+	t.meter.Feed(line)
+
+	trimmed := bytes.TrimSpace(line)
+	if !bytes.HasPrefix(trimmed, []byte("data:")) {
+		return nil
+	}
+	payload := bytes.TrimSpace(trimmed[len("data:"):])
+	if len(payload) == 0 || payload[0] != '{' {
+		return nil
+	}
+
+	var out []byte
+	for _, event := range t.translator.translate(payload) {
+		out = append(out, sseEvent(event)...)
+	}
+	return out
+}
+
+/* Finish emits the closing event with finish reason and accumulated usage, then [DONE] */
+func (t *chatStreamTransformer) Finish() []byte {
+	tokens, _ := t.meter.Result()
+	final := sseEvent(ChatStreamEvent{FinishReason: t.translator.finishReason(), Usage: &tokens})
+	return append(final, sseDone...)
+}
+
+func (t *chatStreamTransformer) Fallback(c *fiber.Ctx, body []byte, statusCode int) error {
+	return respondUpstreamError(c, t.provider, body, statusCode)
+}
+
+/* upstreamErrorMessage extracts the human-readable message from the provider error shapes */
+func upstreamErrorMessage(body []byte, statusCode int) string {
+	var parsed struct {
+		Error   json.RawMessage `json:"error"`
+		Message string          `json:"message"`
+	}
+	if err := json.Unmarshal(body, &parsed); err == nil {
+		var nested struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(parsed.Error, &nested) == nil && nested.Message != "" {
+			return nested.Message
+		}
+		var plain string
+		if json.Unmarshal(parsed.Error, &plain) == nil && plain != "" {
+			return plain
+		}
+		if parsed.Message != "" {
+			return parsed.Message
+		}
+	}
+	return nethttp.StatusText(statusCode)
+}
+
+/* respondUpstreamError normalizes a provider error; client errors keep their status, others become 502 */
+func respondUpstreamError(c *fiber.Ctx, provider string, body []byte, statusCode int) error {
+	status := statusCode
+	if status < 400 || status >= 500 {
+		status = fiber.StatusBadGateway
+	}
+	return c.Status(status).JSON(fiber.Map{
+		"message":        upstreamErrorMessage(body, statusCode),
+		"provider":       provider,
+		"upstreamStatus": statusCode,
+	})
+}
@@ -0,0 +1,263 @@
+package llmproxy
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	nethttp "net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"backend-v2/internal/common/constants"
+	"backend-v2/internal/models"
+	"backend-v2/internal/providers/apikey"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func toolConversation() *ChatRequest {
+	return &ChatRequest{
+		Model: "m",
+		Messages: []ChatMessage{
+			{Role: RoleSystem, Content: "Be brief."},
+			{Role: RoleUser, Content: "Weather in Paris and Rome?"},
+			{Role: RoleAssistant, ToolCalls: []ToolCall{
+				{ID: "call_1", Name: "weather", Arguments: `{"city":"Paris"}`},
+				{ID: "call_2", Name: "weather", Arguments: `{"city":"Rome"}`},
+			}},
+			{Role: RoleTool, ToolCallID: "call_1", Content: "18C"},
+			{Role: RoleTool, ToolCallID: "call_2", Content: "24C"},
+		},
+		Tools: []ChatTool{{Name: "weather", Parameters: json.RawMessage(`{"type":"object"}`)}},
+	}
+}
+
+func marshalMap(t *testing.T, body map[string]interface{}) map[string]interface{} {
+	t.Helper()
+	raw, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("marshal body: %v", err)
+	}
+	var decoded map[string]interface{}
+	_ = json.Unmarshal(raw, &decoded)
+	return decoded
+}
+
+func TestChatRequest_Validate(t *testing.T) {
+	invalid := []ChatRequest{
+		{Messages: []ChatMessage{{Role: RoleUser}}},
+		{Provider: "openai"},
+		{Provider: "openai", Messages: []ChatMessage{{Role: "robot"}}},
+		{Provider: "openai", Messages: []ChatMessage{{Role: RoleTool, Content: "x"}}},
+	}
+	for i, req := range invalid {
+		if err := req.Validate(); err == nil {
+			t.Errorf("case %d: Validate() expected error", i)
+		}
+	}
+}
+
+func TestOpenAIChatAdapter_BuildBodyWithTools(t *testing.T) {
+	body, err := openAIChatAdapter{}.buildBody(toolConversation())
+	if err != nil {
+		t.Fatalf("buildBody() error = %v", err)
+	}
+	decoded := marshalMap(t, body)
+
+	messages := decoded["messages"].([]interface{})
+	assistant := messages[2].(map[string]interface{})
+	if assistant["content"] != nil || len(assistant["tool_calls"].([]interface{})) != 2 {
+		t.Errorf("assistant message = %v, want null content with 2 tool_calls", assistant)
+	}
+	if tool := messages[3].(map[string]interface{}); tool["tool_call_id"] != "call_1" {
+		t.Errorf("tool message = %v", tool)
+	}
+	function := decoded["tools"].([]interface{})[0].(map[string]interface{})["function"].(map[string]interface{})
+	if function["name"] != "weather" {
+		t.Errorf("tool = %v", function)
+	}
+}
+
+func TestClaudeChatAdapter_BuildBodyMergesTurns(t *testing.T) {
+	body, err := claudeChatAdapter{}.buildBody(toolConversation())
+	if err != nil {
+		t.Fatalf("buildBody() error = %v", err)
+	}
+	decoded := marshalMap(t, body)
+
+	if decoded["system"] != "Be brief." || decoded["max_tokens"] != float64(claudeDefaultMaxTokens) {
+		t.Errorf("system/max_tokens = %v/%v", decoded["system"], decoded["max_tokens"])
+	}
+
+	messages := decoded["messages"].([]interface{})
+	if len(messages) != 3 {
+		t.Fatalf("messages = %d, want user, assistant, merged tool results", len(messages))
+	}
+	results := messages[2].(map[string]interface{})
+	blocks := results["content"].([]interface{})
+	if results["role"] != RoleUser || len(blocks) != 2 || blocks[1].(map[string]interface{})["tool_use_id"] != "call_2" {
+		t.Errorf("tool results message = %v", results)
+	}
+	toolUse := messages[1].(map[string]interface{})["content"].([]interface{})[0].(map[string]interface{})
+	if toolUse["type"] != "tool_use" || toolUse["input"].(map[string]interface{})["city"] != "Paris" {
+		t.Errorf("tool_use block = %v", toolUse)
+	}
+}
+
+func TestClaudeChatAdapter_ParseToolUse(t *testing.T) {
+	resp, err := claudeChatAdapter{}.parseResponse([]byte(`{"id":"msg_1","model":"claude-sonnet-4","stop_reason":"tool_use",
+		"content":[{"type":"text","text":"Checking."},{"type":"tool_use","id":"tu_1","name":"weather","input":{"city":"Paris"}}]}`))
+	if err != nil {
+		t.Fatalf("parseResponse() error = %v", err)
+	}
+	if resp.Message.Content != "Checking." || resp.FinishReason != FinishToolCalls {
+		t.Errorf("response = %+v", resp)
+	}
+	if len(resp.Message.ToolCalls) != 1 || resp.Message.ToolCalls[0].Arguments != `{"city":"Paris"}` {
+		t.Errorf("tool calls = %+v", resp.Message.ToolCalls)
+	}
+}
+
+func TestYandexChatAdapter_BuildBody(t *testing.T) {
+	req := &ChatRequest{Model: "yandexgpt-lite/latest", MaxTokens: 100, Messages: []ChatMessage{{Role: RoleUser, Content: "Hi"}}, folderID: "b1g"}
+	body, err := yandexChatAdapter{}.buildBody(req)
+	if err != nil {
+		t.Fatalf("buildBody() error = %v", err)
+	}
+	if body["modelUri"] != "gpt://b1g/yandexgpt-lite/latest" {
+		t.Errorf("modelUri = %v", body["modelUri"])
+	}
+	if options := body["completionOptions"].(map[string]interface{}); options["maxTokens"] != "100" {
+		t.Errorf("completionOptions = %v", options)
+	}
+
+	req.Stream = true
+	if _, err := (yandexChatAdapter{}).buildBody(req); err == nil {
+		t.Error("buildBody() with stream expected unsupported error")
+	}
+}
+
+func TestChatStreamTransformer_OpenAIToolCalls(t *testing.T) {
+	transformer := newChatStreamTransformer("openai", openAIChatAdapter{}.newStreamTranslator())
+
+	var out strings.Builder
+	for _, line := range []string{
+		`data: {"choices":[{"delta":{"tool_calls":[{"index":0,"id":"call_1","function":{"name":"weather","arguments":""}}]}}]}`,
+		`data: {"choices":[{"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"city\":\"Paris\"}"}}]}}]}`,
+		`data: {"choices":[{"delta":{},"finish_reason":"tool_calls"}]}`,
+		`data: {"choices":[],"usage":{"prompt_tokens":5,"completion_tokens":7,"total_tokens":12}}`,
+		`data: [DONE]`,
+	} {
+		out.Write(transformer.Transform([]byte(line + "\n")))
+	}
+	out.Write(transformer.Finish())
+
+	want := `data: {"delta":{"toolCalls":[{"index":0,"id":"call_1","name":"weather"}]}}
+
+data: {"delta":{"toolCalls":[{"index":0,"arguments":"{\"city\":\"Paris\"}"}]}}
+
+data: {"finishReason":"tool_calls","usage":{"promptTokens":5,"completionTokens":7,"totalTokens":12}}
+
+data: [DONE]
+
+`
+	if out.String() != want {
+		t.Errorf("stream =\n%s\nwant\n%s", out.String(), want)
+	}
+}
+
+func TestChatStreamTransformer_Claude(t *testing.T) {
+	transformer := newChatStreamTransformer("claude", claudeChatAdapter{}.newStreamTranslator())
+
+	var out strings.Builder
+	for _, line := range []string{
+		"event: message_start",
+		`data: {"type":"message_start","message":{"model":"claude-sonnet-4","usage":{"input_tokens":10,"output_tokens":1}}}`,
+		`data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hi"}}`,
+		`data: {"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"tu_1","name":"weather"}}`,
+		`data: {"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{}"}}`,
+		`data: {"type":"message_delta","delta":{"stop_reason":"tool_use"},"usage":{"output_tokens":4}}`,
+	} {
+		out.Write(transformer.Transform([]byte(line + "\n")))
+	}
+	out.Write(transformer.Finish())
+
+	for _, fragment := range []string{
+		`{"delta":{"content":"Hi"}}`,
+		`{"delta":{"toolCalls":[{"index":0,"id":"tu_1","name":"weather"}]}}`,
+		`{"delta":{"toolCalls":[{"index":0,"arguments":"{}"}]}}`,
+		`{"finishReason":"tool_calls","usage":{"promptTokens":10,"completionTokens":4,"totalTokens":14}}`,
+	} {
+		if !strings.Contains(out.String(), fragment) {
+			t.Errorf("stream missing %s\n%s", fragment, out.String())
+		}
+	}
+}
+
+func TestUpstreamErrorMessage(t *testing.T) {
+	cases := map[string]string{
+		`{"error":{"message":"Incorrect API key"}}`:                    "Incorrect API key",
+		`{"type":"error","error":{"type":"x","message":"overloaded"}}`: "overloaded",
+		`{"error":"quota exceeded"}`:                                   "quota exceeded",
+		`{"message":"folder not found"}`:                               "folder not found",
+		`<html>`:                                                       "Bad Gateway",
+	}
+	for body, want := range cases {
+		if got := upstreamErrorMessage([]byte(body), 502); got != want {
+			t.Errorf("upstreamErrorMessage(%s) = %q, want %q", body, got, want)
+		}
+	}
+}
+
+type customLLMProvider struct {
+	apikey.Provider
+	url string
+}
+
+func (p *customLLMProvider) GetFallbacks(context.Context, string) ([]string, error) {
+	return nil, nil
+}
+
+func (p *customLLMProvider) GetCustomLLMConfig(context.Context, string) (*models.CustomLLMConfig, error) {
+	return &models.CustomLLMConfig{APIRootURL: p.url, APIKey: "sk-local"}, nil
+}
+
+func TestProdService_ChatNormalizesResponse(t *testing.T) {
+	var upstreamBody map[string]interface{}
+	upstream := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		raw, _ := io.ReadAll(r.Body)
+		_ = json.Unmarshal(raw, &upstreamBody)
+		if r.URL.Path != "/chat/completions" || r.Header.Get("Authorization") != "Bearer sk-local" {
+			w.WriteHeader(nethttp.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"error":{"message":"bad request routing"}}`))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"c1","model":"llama3","choices":[{"message":{"content":"Hello"},"finish_reason":"stop"}],"usage":{"prompt_tokens":3,"completion_tokens":1,"total_tokens":4}}`))
+	}))
+	defer upstream.Close()
+
+	service := NewProdService(NewKeyResolver(&customLLMProvider{url: upstream.URL}, KeyModeClient), nil, nil, nil)
+	app := fiber.New()
+	app.Post("/llm/chat", func(c *fiber.Ctx) error {
+		c.Locals(constants.ContextUserIDKey, "user-1")
+		return service.Chat(c)
+	})
+
+	req := httptest.NewRequest("POST", "/llm/chat", strings.NewReader(`{"provider":"custom_llm","model":"llama3","messages":[{"role":"user","content":"Hi"}],"maxTokens":50}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("Test request failed: %v", err)
+	}
+
+	var result ChatResponse
+	_ = json.NewDecoder(resp.Body).Decode(&result)
+	if resp.StatusCode != fiber.StatusOK || result.Message.Content != "Hello" || result.Usage.Total != 4 || result.Provider != "custom_llm" {
+		t.Fatalf("status %d, response %+v", resp.StatusCode, result)
+	}
+	if upstreamBody["max_tokens"] != float64(50) {
+		t.Errorf("upstream body = %v, want max_tokens 50", upstreamBody)
+	}
+}
@@ -1,49 +1,54 @@
 package llmproxy
 
+import (
+	"backend-v2/internal/services/llmcatalog"
+
+	"github.com/gofiber/fiber/v2"
+)
+
 type ProviderConfig struct {
 	URL            string
 	AuthExtractor  AuthExtractor
 	AuthHeaderName string
 	ExtraHeaders   map[string]string
+	/* IntegrationService names the models.Integration field holding the user's stored key */
+	IntegrationService string
 }
 
-var providerConfigs = map[string]ProviderConfig{
-	"openai": {
-		URL:            "https://api.openai.com/v1/chat/completions",
-		AuthExtractor:  BearerTokenExtractor,
-		AuthHeaderName: headerAuth,
-	},
-	"openai-embeddings": {
-		URL:            "https://api.openai.com/v1/embeddings",
-		AuthExtractor:  BearerTokenExtractor,
-		AuthHeaderName: headerAuth,
-	},
-	"perplexity": {
-		URL:            "https://api.perplexity.ai/chat/completions",
-		AuthExtractor:  BearerTokenExtractor,
-		AuthHeaderName: headerAuth,
-	},
-	"claude": {
-		URL:            "https://api.anthropic.com/v1/messages",
-		AuthExtractor:  HeaderAPIKeyExtractor,
-		AuthHeaderName: headerAPIKey,
-		ExtraHeaders: map[string]string{
-			"anthropic-version": "2023-06-01",
-		},
-	},
-	"yandex": {
-		URL:            "https://llm.api.cloud.yandex.net/foundationModels/v1/completion",
-		AuthExtractor:  BearerTokenExtractor,
-		AuthHeaderName: headerAuth,
-	},
-	"deepseek": {
-		URL:            "https://api.deepseek.com/chat/completions",
-		AuthExtractor:  BearerTokenExtractor,
-		AuthHeaderName: headerAuth,
-	},
+/*
+providerConfigsFrom turns catalog definitions into proxy targets. A provider with an
+embeddings endpoint also gets an "<id>-embeddings" entry (e.g. "openai-embeddings").
+*/
+func providerConfigsFrom(catalog *llmcatalog.Catalog) map[string]ProviderConfig {
+	configs := make(map[string]ProviderConfig, len(catalog.Providers))
+	for id, provider := range catalog.Providers {
+		config := ProviderConfig{
+			URL:                provider.ChatURL(),
+			AuthExtractor:      BearerTokenExtractor,
+			AuthHeaderName:     headerAuth,
+			ExtraHeaders:       provider.Headers,
+			IntegrationService: provider.Integration,
+		}
+		if provider.Auth != "" && provider.Auth != llmcatalog.AuthBearer {
+			header := provider.Auth
+			config.AuthHeaderName = header
+			config.AuthExtractor = func(c *fiber.Ctx) string { return c.Get(header) }
+		}
+		configs[id] = config
+
+		if embeddingsURL := provider.EmbeddingsURL(); embeddingsURL != "" {
+			embeddings := config
+			embeddings.URL = embeddingsURL
+			configs[id+"-embeddings"] = embeddings
+		}
+	}
+	return configs
 }
 
+var defaultProviderConfigs = providerConfigsFrom(llmcatalog.Default())
+
+/* GetProviderConfig looks up a provider of the built-in catalog */
 func GetProviderConfig(provider string) (ProviderConfig, bool) {
-	config, exists := providerConfigs[provider]
+	config, exists := defaultProviderConfigs[provider]
 	return config, exists
 }
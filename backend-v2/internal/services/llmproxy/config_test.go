@@ -2,6 +2,8 @@ package llmproxy
 
 import (
 	"testing"
+
+	"backend-v2/internal/services/llmcatalog"
 )
 
 func TestGetProviderConfig_OpenAI(t *testing.T) {
@@ -92,6 +94,22 @@ func TestGetProviderConfig_Yandex(t *testing.T) {
 	}
 }
 
+func TestGetProviderConfig_Qwen(t *testing.T) {
+	config, exists := GetProviderConfig("qwen")
+
+	if !exists {
+		t.Fatal("qwen provider should exist")
+	}
+
+	if config.URL != "https://dashscope-intl.aliyuncs.com/compatible-mode/v1/chat/completions" {
+		t.Errorf("URL = %v, want the DashScope compatible-mode endpoint", config.URL)
+	}
+
+	if config.AuthHeaderName != headerAuth || config.IntegrationService != "qwen" {
+		t.Errorf("AuthHeaderName = %v, IntegrationService = %v", config.AuthHeaderName, config.IntegrationService)
+	}
+}
+
 func TestGetProviderConfig_Unknown(t *testing.T) {
 	_, exists := GetProviderConfig("unknown-provider")
 
@@ -101,7 +119,7 @@ func TestGetProviderConfig_Unknown(t *testing.T) {
 }
 
 func TestGetProviderConfig_AllProvidersHaveAuthExtractor(t *testing.T) {
-	providers := []string{"openai", "openai-embeddings", "perplexity", "claude", "yandex"}
+	providers := []string{"openai", "openai-embeddings", "perplexity", "claude", "yandex", "deepseek", "qwen"}
 
 	for _, provider := range providers {
 		config, exists := GetProviderConfig(provider)
@@ -115,3 +133,27 @@ func TestGetProviderConfig_AllProvidersHaveAuthExtractor(t *testing.T) {
 		}
 	}
 }
+
+func TestProviderConfigsFrom_CatalogOverrides(t *testing.T) {
+	catalog, err := llmcatalog.Load("", `{"providers":{
+		"openai":{"baseUrl":"https://gateway.example.com/v1","headers":{"X-Tenant":"acme"}},
+		"deepseek":{"auth":"api-key"}}}`)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	configs := providerConfigsFrom(catalog)
+
+	if configs["openai"].URL != "https://gateway.example.com/v1/chat/completions" ||
+		configs["openai-embeddings"].URL != "https://gateway.example.com/v1/embeddings" {
+		t.Errorf("openai URLs = %s, %s", configs["openai"].URL, configs["openai-embeddings"].URL)
+	}
+	if configs["openai-embeddings"].ExtraHeaders["X-Tenant"] != "acme" {
+		t.Errorf("embeddings headers = %v", configs["openai-embeddings"].ExtraHeaders)
+	}
+	if configs["deepseek"].AuthHeaderName != "api-key" {
+		t.Errorf("deepseek auth header = %s", configs["deepseek"].AuthHeaderName)
+	}
+	if _, exists := configs["claude-embeddings"]; exists {
+		t.Error("providers without an embeddings path must not get an embeddings entry")
+	}
+}
@@ -0,0 +1,259 @@
+package llmproxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"backend-v2/internal/common/http"
+	"backend-v2/internal/services/llmcatalog"
+	"backend-v2/internal/services/ratelimit"
+	"backend-v2/internal/services/usage"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var (
+	ErrEmbeddingUnavailable = errors.New("text embedding is not available")
+	ErrEmbeddingProvider    = errors.New("provider cannot embed text; use openai, local or custom_llm")
+	ErrEmbeddingModel       = errors.New("self-hosted embeddings need a model")
+	ErrEmbeddingLimited     = errors.New("embedding refused by the LLM rate limits")
+)
+
+/* RoleLookup returns the roles of a user, for embeddings made outside a request */
+type RoleLookup func(ctx context.Context, userID string) ([]string, error)
+
+/* Embedder turns text into a vector with the caller's own integration */
+type Embedder interface {
+	Embed(c *fiber.Ctx, provider, model, text string) ([]float64, error)
+	/* EmbedBatch embeds texts for userID outside a request; vectors come back in input order */
+	EmbedBatch(ctx context.Context, userID, provider, model string, texts []string) ([][]float64, error)
+	/* ChunkSize is the chunk size userID configured for the provider's embeddings, 0 when unset */
+	ChunkSize(ctx context.Context, userID, provider string) int
+	/* Model names the model a request for model would use, so vectors can record it; "" when unknown */
+	Model(provider, model string) string
+}
+
+/* NoopEmbedder has no upstream to call; callers must send precomputed embeddings */
+type NoopEmbedder struct{}
+
+func NewNoopEmbedder() Embedder {
+	return &NoopEmbedder{}
+}
+
+func (e *NoopEmbedder) Embed(*fiber.Ctx, string, string, string) ([]float64, error) {
+	return nil, ErrEmbeddingUnavailable
+}
+
+func (e *NoopEmbedder) EmbedBatch(context.Context, string, string, string, []string) ([][]float64, error) {
+	return nil, ErrEmbeddingUnavailable
+}
+
+func (e *NoopEmbedder) ChunkSize(context.Context, string, string) int {
+	return 0
+}
+
+func (e *NoopEmbedder) Model(_, model string) string {
+	return model
+}
+
+/*
+ProdEmbedder calls the OpenAI-compatible embeddings endpoint of the chosen provider. Every call
+passes the caller's rate limits and token quotas and records its usage, as proxied calls do.
+*/
+type ProdEmbedder struct {
+	client    http.Client
+	keys      *KeyResolver
+	catalog   *llmcatalog.Catalog
+	providers map[string]ProviderConfig
+	recorder  usage.Recorder
+	limiter   *ratelimit.Limiter
+	roles     RoleLookup
+}
+
+/*
+NewProdEmbedder resolves keys and endpoints like the proxy; catalog may be nil for the built-in providers.
+A nil recorder skips metering and a nil limiter or roles skips the limits.
+*/
+func NewProdEmbedder(keys *KeyResolver, catalog *llmcatalog.Catalog, recorder usage.Recorder, limiter *ratelimit.Limiter, roles RoleLookup) Embedder {
+	if catalog == nil {
+		catalog = llmcatalog.Default()
+	}
+	return &ProdEmbedder{
+		client:    http.NewClientFactory().Create(30 * time.Second),
+		keys:      keys,
+		catalog:   catalog,
+		providers: providerConfigsFrom(catalog),
+		recorder:  recorder,
+		limiter:   limiter,
+		roles:     roles,
+	}
+}
+
+func (e *ProdEmbedder) Embed(c *fiber.Ctx, provider, model, text string) ([]float64, error) {
+	roles, _ := c.Locals("roles").([]string)
+	if err := e.admit(c.Context(), callerID(c), roles); err != nil {
+		return nil, err
+	}
+	embeddings, err := e.embed(c.Context(), callerID(c), provider, model, text, 1)
+	if err != nil {
+		return nil, err
+	}
+	return embeddings[0], nil
+}
+
+func (e *ProdEmbedder) EmbedBatch(ctx context.Context, userID, provider, model string, texts []string) ([][]float64, error) {
+	if len(texts) == 0 {
+		return [][]float64{}, nil
+	}
+	if e.limiter != nil && e.roles != nil {
+		roles, err := e.roles(ctx, userID)
+		if err != nil {
+			log.Warn("role lookup failed for user %s, embedding with default limits: %v", userID, err)
+		}
+		if err := e.admit(ctx, userID, roles); err != nil {
+			return nil, err
+		}
+	}
+	return e.embed(ctx, userID, provider, model, texts, len(texts))
+}
+
+/* admit checks the limiter like LimitedService.guard does, failing open when quota storage is down */
+func (e *ProdEmbedder) admit(ctx context.Context, userID string, roles []string) error {
+	if e.limiter == nil {
+		return nil
+	}
+	result, err := e.limiter.Check(ctx, userID, roles)
+	if err != nil {
+		log.Warn("quota check failed for user %s, allowing embedding: %v", userID, err)
+		return nil
+	}
+	if result.Allowed {
+		return nil
+	}
+
+	retryAfter := max(int(math.Ceil(result.RetryAfter.Seconds())), 1)
+	message := rateLimitExceededMessage
+	if result.Reason != ratelimit.ReasonRate {
+		message = tokenQuotaExhaustedMessage
+	}
+	return fmt.Errorf("%w: "+message, ErrEmbeddingLimited, retryAfter)
+}
+
+/* ChunkSize reads embeddingsChunkSize of a custom_llm integration; other providers configure none */
+func (e *ProdEmbedder) ChunkSize(ctx context.Context, userID, provider string) int {
+	if provider != "custom_llm" {
+		return 0
+	}
+	stored, err := e.keys.StoredCustomLLMFor(ctx, userID)
+	if err != nil || stored == nil {
+		return 0
+	}
+	return stored.EmbeddingsChunkSize
+}
+
+/* embed sends input, a string or a list of want strings, and returns want vectors in input order */
+func (e *ProdEmbedder) embed(ctx context.Context, userID, provider, model string, input interface{}, want int) ([][]float64, error) {
+	request, err := e.embeddingRequest(ctx, userID, provider, model)
+	if err != nil {
+		return nil, err
+	}
+	request.Body["input"] = input
+
+	req, err := BuildProxyRequest(request)
+	if err != nil {
+		return nil, err
+	}
+	body, status, err := ExecuteProxyRequest(e.client, req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if status < 200 || status >= 300 {
+		return nil, fmt.Errorf("%s embeddings: %d %s", provider, status, upstreamErrorMessage(body, status))
+	}
+	meter := &callMeter{recorder: e.recorder, userID: userID, provider: provider, model: requestModel(request.Body)}
+	meter.Response(body, status)
+
+	var parsed struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float64 `json:"embedding"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &parsed); err != nil || len(parsed.Data) != want {
+		return nil, fmt.Errorf("%s embeddings: response has no embedding", provider)
+	}
+	/* Providers may reorder results; index says which input each belongs to */
+	embeddings := make([][]float64, want)
+	for i, item := range parsed.Data {
+		slot := i
+		if want > 1 {
+			slot = item.Index
+		}
+		if slot < 0 || slot >= want || len(item.Embedding) == 0 || embeddings[slot] != nil {
+			return nil, fmt.Errorf("%s embeddings: response has no embedding", provider)
+		}
+		embeddings[slot] = item.Embedding
+	}
+	return embeddings, nil
+}
+
+/* embeddingRequest resolves endpoint, key and model; the body only carries the model so far */
+func (e *ProdEmbedder) embeddingRequest(ctx context.Context, userID, provider, model string) (ProxyRequest, error) {
+	if isSelfHosted(provider) {
+		if model == "" {
+			return ProxyRequest{}, ErrEmbeddingModel
+		}
+		baseURL, apiKey, err := e.keys.StoredEndpointFor(ctx, userID, provider)
+		if err != nil {
+			return ProxyRequest{}, err
+		}
+		return ProxyRequest{
+			TargetURL:  baseURL + "/embeddings",
+			APIKey:     apiKey,
+			AuthHeader: headerAuth,
+			Body:       map[string]interface{}{"model": model},
+		}, nil
+	}
+
+	config, exists := e.providers[provider+"-embeddings"]
+	if !exists {
+		return ProxyRequest{}, ErrEmbeddingProvider
+	}
+	apiKey, err := e.keys.StoredFor(ctx, userID, config.IntegrationService)
+	if err != nil {
+		return ProxyRequest{}, err
+	}
+	if model == "" {
+		model = e.defaultModel(provider)
+	}
+	return ProxyRequest{
+		TargetURL:    config.URL,
+		APIKey:       apiKey,
+		AuthHeader:   config.AuthHeaderName,
+		ExtraHeaders: config.ExtraHeaders,
+		Body:         map[string]interface{}{"model": model},
+	}, nil
+}
+
+/* Model resolves an empty model to the provider's default, as requests do */
+func (e *ProdEmbedder) Model(provider, model string) string {
+	if model == "" && !isSelfHosted(provider) {
+		return e.defaultModel(provider)
+	}
+	return model
+}
+
+/* defaultModel is the provider's first catalog embedding model */
+func (e *ProdEmbedder) defaultModel(provider string) string {
+	definition, _ := e.catalog.Provider(provider)
+	for _, model := range definition.Models {
+		if model.Type == llmcatalog.TypeEmbedding {
+			return model.ID
+		}
+	}
+	return ""
+}
@@ -0,0 +1,117 @@
+package llmproxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	nethttp "net/http"
+	"net/http/httptest"
+	"testing"
+
+	"backend-v2/internal/common/constants"
+	"backend-v2/internal/services/ratelimit"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestProdEmbedder_Local(t *testing.T) {
+	var received map[string]interface{}
+	upstream := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&received)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"data":[{"embedding":[0.1,0.2,0.3]}]}`))
+	}))
+	defer upstream.Close()
+
+	embedder := NewProdEmbedder(NewKeyResolver(&localProvider{}, KeyModeClient).WithLocalDefault(upstream.URL+"/v1"), nil, nil, nil, nil)
+
+	var (
+		embedding []float64
+		err       error
+		noModel   error
+	)
+	app := fiber.New()
+	app.Get("/", func(c *fiber.Ctx) error {
+		c.Locals(constants.ContextUserIDKey, "user-1")
+		embedding, err = embedder.Embed(c, "local", "nomic-embed-text", "hello")
+		_, noModel = embedder.Embed(c, "local", "", "hello")
+		return nil
+	})
+	if _, testErr := app.Test(httptest.NewRequest("GET", "/", nil), -1); testErr != nil {
+		t.Fatalf("Test request failed: %v", testErr)
+	}
+
+	if err != nil || len(embedding) != 3 {
+		t.Fatalf("Embed() = %v, %v", embedding, err)
+	}
+	if received["model"] != "nomic-embed-text" || received["input"] != "hello" {
+		t.Errorf("upstream body = %v", received)
+	}
+	if !errors.Is(noModel, ErrEmbeddingModel) {
+		t.Errorf("missing model error = %v, want ErrEmbeddingModel", noModel)
+	}
+}
+
+func TestProdEmbedder_EmbedBatchOrdersByIndex(t *testing.T) {
+	var received map[string]interface{}
+	upstream := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&received)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"data":[{"index":1,"embedding":[2]},{"index":0,"embedding":[1]}]}`))
+	}))
+	defer upstream.Close()
+
+	embedder := NewProdEmbedder(NewKeyResolver(&localProvider{}, KeyModeClient).WithLocalDefault(upstream.URL+"/v1"), nil, nil, nil, nil)
+
+	embeddings, err := embedder.EmbedBatch(context.Background(), "user-1", "local", "nomic-embed-text", []string{"a", "b"})
+	if err != nil {
+		t.Fatalf("EmbedBatch() error = %v", err)
+	}
+	if len(embeddings) != 2 || embeddings[0][0] != 1 || embeddings[1][0] != 2 {
+		t.Errorf("EmbedBatch() = %v, want [[1] [2]]", embeddings)
+	}
+	if inputs, ok := received["input"].([]interface{}); !ok || len(inputs) != 2 {
+		t.Errorf("upstream input = %v, want both texts", received["input"])
+	}
+}
+
+func TestProdEmbedder_EmbedBatchMetersAndLimits(t *testing.T) {
+	upstream := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"model":"nomic-embed-text","data":[{"embedding":[1]}],"usage":{"prompt_tokens":7,"total_tokens":7}}`))
+	}))
+	defer upstream.Close()
+
+	records := make(chanRecorder, 1)
+	policy := ratelimit.Policy{"subscriber": {RequestsPerMinute: 1}}
+	roles := func(context.Context, string) ([]string, error) { return []string{"subscriber"}, nil }
+	embedder := NewProdEmbedder(NewKeyResolver(&localProvider{}, KeyModeClient).WithLocalDefault(upstream.URL+"/v1"), nil,
+		records, ratelimit.NewLimiter(ratelimit.NewMemoryStore(), nil, policy), roles)
+
+	if _, err := embedder.EmbedBatch(context.Background(), "user-1", "local", "nomic-embed-text", []string{"a"}); err != nil {
+		t.Fatalf("EmbedBatch() error = %v", err)
+	}
+	if record := waitRecord(t, records); record.UserID != "user-1" || record.Provider != "local" || record.Tokens.Total != 7 {
+		t.Errorf("usage record = %+v, want 7 tokens of user-1 on local", record)
+	}
+
+	if _, err := embedder.EmbedBatch(context.Background(), "user-1", "local", "nomic-embed-text", []string{"b"}); !errors.Is(err, ErrEmbeddingLimited) {
+		t.Errorf("EmbedBatch() over the rate error = %v, want ErrEmbeddingLimited", err)
+	}
+}
+
+func TestProdEmbedder_ModelResolvesDefaults(t *testing.T) {
+	embedder := NewProdEmbedder(NewKeyResolver(&localProvider{}, KeyModeClient), nil, nil, nil, nil)
+
+	cases := []struct{ provider, model, want string }{
+		{"openai", "", "text-embedding-3-small"},
+		{"openai", "text-embedding-ada-002", "text-embedding-ada-002"},
+		{"local", "", ""},
+		{"local", "nomic-embed-text", "nomic-embed-text"},
+	}
+	for _, c := range cases {
+		if got := embedder.Model(c.provider, c.model); got != c.want {
+			t.Errorf("Model(%q, %q) = %q, want %q", c.provider, c.model, got, c.want)
+		}
+	}
+}
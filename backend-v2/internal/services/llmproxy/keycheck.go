@@ -0,0 +1,265 @@
+package llmproxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	nethttp "net/http"
+	"strings"
+	"time"
+
+	"backend-v2/internal/common/http"
+	"backend-v2/internal/models"
+	"backend-v2/internal/services/llmcatalog"
+)
+
+/* keyCheckTimeout bounds one credential check so a hung upstream cannot stall a save */
+const keyCheckTimeout = 15 * time.Second
+
+/* CheckableServices are the integration services whose credentials KeyChecker can verify */
+var CheckableServices = []string{"openai", "claude", "perplexity", "deepseek", "qwen", "yandex", "custom_llm", "local"}
+
+/* Credentials are what a credential check needs from one integration service */
+type Credentials struct {
+	APIKey string
+	/* BaseURL is the endpoint of custom_llm and local */
+	BaseURL string
+	/* FolderID is Yandex Cloud's folder, part of every model URI */
+	FolderID string
+}
+
+/* CredentialsFor extracts the credentials of service from a decrypted integration; false when it is not an LLM service or not configured */
+func CredentialsFor(integration *models.Integration, service string) (Credentials, bool) {
+	switch service {
+	case "openai":
+		if integration.OpenAI != nil {
+			return Credentials{APIKey: integration.OpenAI.APIKey}, true
+		}
+	case "claude":
+		if integration.Claude != nil {
+			return Credentials{APIKey: integration.Claude.APIKey}, true
+		}
+	case "perplexity":
+		if integration.Perplexity != nil {
+			return Credentials{APIKey: integration.Perplexity.APIKey}, true
+		}
+	case "deepseek":
+		if integration.Deepseek != nil {
+			return Credentials{APIKey: integration.Deepseek.APIKey}, true
+		}
+	case "qwen":
+		if integration.Qwen != nil {
+			return Credentials{APIKey: integration.Qwen.APIKey}, true
+		}
+	case "yandex":
+		if integration.Yandex != nil {
+			return Credentials{APIKey: integration.Yandex.APIKey, FolderID: integration.Yandex.FolderID}, true
+		}
+	case "custom_llm":
+		if integration.CustomLLM != nil {
+			return Credentials{APIKey: integration.CustomLLM.APIKey, BaseURL: integration.CustomLLM.APIRootURL}, true
+		}
+	case "local":
+		if integration.Local != nil {
+			return Credentials{APIKey: integration.Local.APIKey, BaseURL: integration.Local.BaseURL}, true
+		}
+	}
+	return Credentials{}, false
+}
+
+/* KeyChecker verifies stored provider credentials with the cheapest call each provider offers */
+type KeyChecker interface {
+	Check(ctx context.Context, service string, credentials Credentials) models.IntegrationHealth
+}
+
+/* NoopKeyChecker reports every credential as valid without calling out */
+type NoopKeyChecker struct{}
+
+func NewNoopKeyChecker() KeyChecker {
+	return &NoopKeyChecker{}
+}
+
+func (k *NoopKeyChecker) Check(context.Context, string, Credentials) models.IntegrationHealth {
+	return models.IntegrationHealth{Status: models.HealthValid, CheckedAt: time.Now()}
+}
+
+/* ProdKeyChecker lists models where the provider allows it and sends a one-token completion otherwise */
+type ProdKeyChecker struct {
+	client       http.Client
+	catalog      *llmcatalog.Catalog
+	providers    map[string]ProviderConfig
+	localBaseURL string
+	now          func() time.Time
+}
+
+/* NewProdKeyChecker checks against catalog endpoints (the built-in ones when nil); localBaseURL is LOCAL_LLM_BASE_URL */
+func NewProdKeyChecker(catalog *llmcatalog.Catalog, localBaseURL string) KeyChecker {
+	if catalog == nil {
+		catalog = llmcatalog.Default()
+	}
+	return &ProdKeyChecker{
+		/* custom_llm and local endpoints are user-supplied, so this goes through the outbound guard */
+		client:       http.NewClientFactory().Create(keyCheckTimeout),
+		catalog:      catalog,
+		providers:    providerConfigsFrom(catalog),
+		localBaseURL: strings.TrimRight(localBaseURL, "/"),
+		now:          time.Now,
+	}
+}
+
+func (k *ProdKeyChecker) Check(ctx context.Context, service string, credentials Credentials) models.IntegrationHealth {
+	ctx, cancel := context.WithTimeout(ctx, keyCheckTimeout)
+	defer cancel()
+
+	health := k.check(ctx, service, credentials)
+	health.CheckedAt = k.now()
+	return health
+}
+
+func (k *ProdKeyChecker) check(ctx context.Context, service string, credentials Credentials) models.IntegrationHealth {
+	if isSelfHosted(service) {
+		baseURL := strings.TrimRight(credentials.BaseURL, "/")
+		if baseURL == "" && service == "local" {
+			baseURL = k.localBaseURL
+		}
+		if baseURL == "" {
+			return invalidHealth("no endpoint URL configured")
+		}
+		/* Self-hosted servers often run without a key; only send one when it is set */
+		auth := ProviderConfig{AuthHeaderName: headerAuth}
+		return k.listModels(ctx, baseURL+"/models", credentials.APIKey, auth)
+	}
+
+	config, exists := k.providerConfig(service)
+	if !exists {
+		return invalidHealth("unknown service " + service)
+	}
+	provider, _ := k.catalog.Provider(service)
+	if credentials.APIKey == "" {
+		return invalidHealth("API key is not set")
+	}
+
+	switch service {
+	case "perplexity":
+		/* Perplexity has no model listing, so a one-token completion stands in */
+		body := map[string]interface{}{
+			"model":      provider.DefaultModel,
+			"messages":   []map[string]string{{"role": "user", "content": "ping"}},
+			"max_tokens": 1,
+		}
+		return k.complete(ctx, config, credentials.APIKey, body, k.catalogModels(service))
+	case "yandex":
+		modelURI, err := yandexModelURI("", credentials.FolderID)
+		if err != nil {
+			return invalidHealth(err.Error())
+		}
+		body := map[string]interface{}{
+			"modelUri":          modelURI,
+			"completionOptions": map[string]interface{}{"maxTokens": "1"},
+			"messages":          []map[string]string{{"role": "user", "text": "ping"}},
+		}
+		return k.complete(ctx, config, credentials.APIKey, body, k.catalogModels(service))
+	}
+	return k.listModels(ctx, strings.TrimRight(provider.BaseURL, "/")+"/models", credentials.APIKey, config)
+}
+
+func (k *ProdKeyChecker) providerConfig(service string) (ProviderConfig, bool) {
+	config, exists := k.providers[service]
+	return config, exists
+}
+
+/* catalogModels is the model list reported for providers checked with a completion */
+func (k *ProdKeyChecker) catalogModels(service string) []string {
+	provider, _ := k.catalog.Provider(service)
+	var ids []string
+	for _, model := range provider.Models {
+		ids = append(ids, model.ID)
+	}
+	return ids
+}
+
+func (k *ProdKeyChecker) listModels(ctx context.Context, url, apiKey string, config ProviderConfig) models.IntegrationHealth {
+	req, err := nethttp.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return invalidHealth(err.Error())
+	}
+	if apiKey != "" {
+		setAuthHeader(req, config.AuthHeaderName, apiKey)
+	}
+	for name, value := range config.ExtraHeaders {
+		req.Header.Set(name, value)
+	}
+
+	body, status, err := k.do(req)
+	health := healthFrom(body, status, err)
+	if health.Status != models.HealthValid {
+		return health
+	}
+
+	var listing struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &listing); err != nil {
+		return invalidHealth("endpoint did not return a model list")
+	}
+	for _, model := range listing.Data {
+		health.Models = append(health.Models, model.ID)
+	}
+	return health
+}
+
+func (k *ProdKeyChecker) complete(ctx context.Context, config ProviderConfig, apiKey string, payload map[string]interface{}, available []string) models.IntegrationHealth {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return invalidHealth(err.Error())
+	}
+	req, err := nethttp.NewRequestWithContext(ctx, "POST", config.URL, bytes.NewReader(data))
+	if err != nil {
+		return invalidHealth(err.Error())
+	}
+	req.Header.Set(headerContentType, contentTypeJSON)
+	setAuthHeader(req, config.AuthHeaderName, apiKey)
+	for name, value := range config.ExtraHeaders {
+		req.Header.Set(name, value)
+	}
+
+	body, status, err := k.do(req)
+	health := healthFrom(body, status, err)
+	if health.Status == models.HealthValid {
+		health.Models = available
+	}
+	return health
+}
+
+func (k *ProdKeyChecker) do(req *nethttp.Request) ([]byte, int, error) {
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	return body, resp.StatusCode, err
+}
+
+/* healthFrom classifies a check: rejected credentials are invalid, outages and rate limits say nothing about the key */
+func healthFrom(body []byte, status int, err error) models.IntegrationHealth {
+	switch {
+	case err != nil && http.IsBlocked(err):
+		return invalidHealth("endpoint URL is not allowed")
+	case err != nil:
+		return models.IntegrationHealth{Status: models.HealthUnreachable, Error: err.Error()}
+	case status == nethttp.StatusTooManyRequests || status >= 500:
+		return models.IntegrationHealth{Status: models.HealthUnreachable, Error: fmt.Sprintf("%d: %s", status, upstreamErrorMessage(body, status))}
+	case status < 200 || status >= 300:
+		return invalidHealth(fmt.Sprintf("%d: %s", status, upstreamErrorMessage(body, status)))
+	}
+	return models.IntegrationHealth{Status: models.HealthValid}
+}
+
+func invalidHealth(message string) models.IntegrationHealth {
+	return models.IntegrationHealth{Status: models.HealthInvalid, Error: message}
+}
@@ -0,0 +1,106 @@
+package llmproxy
+
+import (
+	"context"
+	"encoding/json"
+	nethttp "net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"backend-v2/internal/models"
+	"backend-v2/internal/services/llmcatalog"
+)
+
+func TestCredentialsFor(t *testing.T) {
+	integration := &models.Integration{
+		Yandex: &models.YandexConfig{APIKey: "y-key", FolderID: "b1g"},
+		Local:  &models.LocalLLMConfig{BaseURL: "http://gpu-box:8000/v1"},
+	}
+
+	if creds, ok := CredentialsFor(integration, "yandex"); !ok || creds.APIKey != "y-key" || creds.FolderID != "b1g" {
+		t.Errorf("yandex credentials = %+v, %t", creds, ok)
+	}
+	if creds, ok := CredentialsFor(integration, "local"); !ok || creds.BaseURL != "http://gpu-box:8000/v1" {
+		t.Errorf("local credentials = %+v, %t", creds, ok)
+	}
+	for _, service := range []string{"openai", "midjourney"} {
+		if _, ok := CredentialsFor(integration, service); ok {
+			t.Errorf("CredentialsFor(%s) should report nothing to check", service)
+		}
+	}
+}
+
+/* newCheckServer accepts "good-key" in either Authorization or x-api-key */
+func newCheckServer(t *testing.T, status int) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if status != nethttp.StatusOK {
+			w.WriteHeader(status)
+			_, _ = w.Write([]byte(`{"error":{"message":"upstream says no"}}`))
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer good-key" && r.Header.Get("x-api-key") != "good-key" {
+			w.WriteHeader(nethttp.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"error":{"message":"invalid api key"}}`))
+			return
+		}
+		if r.Method == "GET" && strings.HasSuffix(r.URL.Path, "/models") {
+			_, _ = w.Write([]byte(`{"data":[{"id":"model-a"},{"id":"model-b"}]}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"choices":[{"message":{"content":"p"}}]}`))
+	}))
+}
+
+func checkerFor(t *testing.T, upstream string) KeyChecker {
+	t.Helper()
+	overrides, _ := json.Marshal(map[string]interface{}{"providers": map[string]interface{}{
+		"claude":     map[string]string{"baseUrl": upstream + "/v1"},
+		"perplexity": map[string]string{"baseUrl": upstream},
+	}})
+	catalog, err := llmcatalog.Load("", string(overrides))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	return NewProdKeyChecker(catalog, upstream+"/v1")
+}
+
+func TestProdKeyChecker(t *testing.T) {
+	healthy := newCheckServer(t, nethttp.StatusOK)
+	defer healthy.Close()
+	down := newCheckServer(t, nethttp.StatusServiceUnavailable)
+	defer down.Close()
+
+	cases := []struct {
+		name        string
+		upstream    string
+		service     string
+		credentials Credentials
+		wantStatus  string
+		wantModels  int
+	}{
+		{"claude lists models", healthy.URL, "claude", Credentials{APIKey: "good-key"}, models.HealthValid, 2},
+		{"rejected key", healthy.URL, "claude", Credentials{APIKey: "bad-key"}, models.HealthInvalid, 0},
+		{"missing key", healthy.URL, "claude", Credentials{}, models.HealthInvalid, 0},
+		{"perplexity sends a tiny completion", healthy.URL, "perplexity", Credentials{APIKey: "good-key"}, models.HealthValid, len(llmcatalog.Default().Providers["perplexity"].Models)},
+		{"outage says nothing about the key", down.URL, "claude", Credentials{APIKey: "good-key"}, models.HealthUnreachable, 0},
+		{"local uses the server default", healthy.URL, "local", Credentials{APIKey: "good-key"}, models.HealthValid, 2},
+		{"custom endpoint required", healthy.URL, "custom_llm", Credentials{APIKey: "good-key"}, models.HealthInvalid, 0},
+		{"blocked endpoint", healthy.URL, "custom_llm", Credentials{BaseURL: "http://169.254.169.254/v1"}, models.HealthInvalid, 0},
+		{"yandex needs a folder", healthy.URL, "yandex", Credentials{APIKey: "good-key"}, models.HealthInvalid, 0},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			health := checkerFor(t, tc.upstream).Check(context.Background(), tc.service, tc.credentials)
+			if health.Status != tc.wantStatus || len(health.Models) != tc.wantModels || health.CheckedAt.IsZero() {
+				t.Errorf("Check() = %+v, want status %s with %d models", health, tc.wantStatus, tc.wantModels)
+			}
+			if health.Status != models.HealthValid && health.Error == "" {
+				t.Error("failed checks must carry an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,228 @@
+package llmproxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"backend-v2/internal/common/constants"
+	"backend-v2/internal/common/response"
+	"backend-v2/internal/models"
+	"backend-v2/internal/providers/apikey"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	/* keyValidationLocal marks requests that came through a KeyValidation route */
+	keyValidationLocal = "llmKeyValidation"
+
+	/* KeyModeClient forwards explicit client keys and falls back to the stored integration key */
+	KeyModeClient = "client"
+	/* KeyModeServer only uses stored integration keys; explicit keys are accepted for key validation only */
+	KeyModeServer = "server"
+)
+
+var (
+	ErrAPIKeyRequired          = errors.New("API key required")
+	ErrExplicitKeyNotAllowed   = errors.New("explicit API keys are only accepted for key validation")
+	ErrIntegrationNotAvailable = errors.New("integration key lookup is not available")
+	ErrEndpointNotConfigured   = errors.New("endpoint is not configured")
+)
+
+/* KeyResolver decides which upstream key a proxied request uses */
+type KeyResolver struct {
+	provider apikey.Provider
+	mode     string
+	/* localBaseURL is the server-side Ollama/vLLM endpoint used when a caller configured none */
+	localBaseURL string
+}
+
+func NewKeyResolver(provider apikey.Provider, mode string) *KeyResolver {
+	if mode != KeyModeServer {
+		mode = KeyModeClient
+	}
+	return &KeyResolver{provider: provider, mode: mode}
+}
+
+/* WithLocalDefault sets the base URL the "local" provider falls back to */
+func (r *KeyResolver) WithLocalDefault(baseURL string) *KeyResolver {
+	r.localBaseURL = strings.TrimRight(baseURL, "/")
+	return r
+}
+
+/*
+KeyValidation guards the integration proxy routes the install dialogs check keys through.
+A request there that brings the provider's key, or a self-hosted endpoint, is the
+validate-on-install flow; one relying on stored keys is an ordinary call.
+*/
+func KeyValidation(provider string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if bringsOwnKey(c, provider) {
+			c.Locals(keyValidationLocal, true)
+		}
+		return c.Next()
+	}
+}
+
+/* bringsOwnKey reports whether the caller sent the credentials or endpoint to use instead of relying on stored ones */
+func bringsOwnKey(c *fiber.Ctx, provider string) bool {
+	if isSelfHosted(strings.TrimSuffix(provider, "-embeddings")) {
+		var body struct {
+			URL string `json:"url"`
+		}
+		return c.Query("url") != "" || (json.Unmarshal(c.Body(), &body) == nil && body.URL != "")
+	}
+	config, exists := GetProviderConfig(provider)
+	return exists && !IsEmptyAPIKey(config.AuthExtractor(c))
+}
+
+/* IsKeyValidation reports whether the request is the validate-on-install flow; only KeyValidation routes decide it */
+func IsKeyValidation(c *fiber.Ctx) bool {
+	validation, _ := c.Locals(keyValidationLocal).(bool)
+	return validation
+}
+
+/* CheckExplicit reports whether a caller-supplied key may be forwarded upstream */
+func (r *KeyResolver) CheckExplicit(c *fiber.Ctx) error {
+	if r.mode == KeyModeServer && !IsKeyValidation(c) {
+		return ErrExplicitKeyNotAllowed
+	}
+	return nil
+}
+
+/* Resolve returns the explicit client key when allowed, otherwise the caller's stored integration key */
+func (r *KeyResolver) Resolve(c *fiber.Ctx, explicitKey, integrationService string) (string, error) {
+	if !IsEmptyAPIKey(explicitKey) {
+		if err := r.CheckExplicit(c); err != nil {
+			return "", err
+		}
+		return explicitKey, nil
+	}
+
+	return r.Stored(c, integrationService)
+}
+
+/* Stored looks up the caller's key from their integration document */
+func (r *KeyResolver) Stored(c *fiber.Ctx, integrationService string) (string, error) {
+	return r.StoredFor(c.Context(), callerID(c), integrationService)
+}
+
+/* StoredFor is Stored outside a request, e.g. in a background job acting for userID */
+func (r *KeyResolver) StoredFor(ctx context.Context, userID, integrationService string) (string, error) {
+	if r.provider == nil || integrationService == "" {
+		return "", ErrIntegrationNotAvailable
+	}
+	if userID == "" {
+		return "", ErrAPIKeyRequired
+	}
+
+	key, err := r.provider.GetAPIKey(ctx, userID, integrationService)
+	if err != nil || IsEmptyAPIKey(key) {
+		return "", ErrAPIKeyRequired
+	}
+	return key, nil
+}
+
+/* StoredCustomLLM returns the caller's configured custom LLM endpoint and optional key */
+func (r *KeyResolver) StoredCustomLLM(c *fiber.Ctx) (*models.CustomLLMConfig, error) {
+	return r.StoredCustomLLMFor(c.Context(), callerID(c))
+}
+
+func (r *KeyResolver) StoredCustomLLMFor(ctx context.Context, userID string) (*models.CustomLLMConfig, error) {
+	if r.provider == nil {
+		return nil, ErrIntegrationNotAvailable
+	}
+	if userID == "" {
+		return nil, ErrAPIKeyRequired
+	}
+
+	return r.provider.GetCustomLLMConfig(ctx, userID)
+}
+
+/*
+StoredEndpoint returns the base URL and optional key of a self-hosted provider.
+custom_llm needs the caller's own endpoint; local falls back to the server default.
+*/
+func (r *KeyResolver) StoredEndpoint(c *fiber.Ctx, provider string) (string, string, error) {
+	return r.StoredEndpointFor(c.Context(), callerID(c), provider)
+}
+
+func (r *KeyResolver) StoredEndpointFor(ctx context.Context, userID, provider string) (string, string, error) {
+	switch provider {
+	case "custom_llm":
+		stored, err := r.StoredCustomLLMFor(ctx, userID)
+		if err != nil {
+			break
+		}
+		return stored.APIRootURL, stored.APIKey, nil
+	case "local":
+		var baseURL, apiKey string
+		if stored, err := r.storedLocal(ctx, userID); err == nil {
+			baseURL, apiKey = stored.BaseURL, stored.APIKey
+		}
+		if baseURL == "" {
+			baseURL = r.localBaseURL
+		}
+		if baseURL == "" {
+			break
+		}
+		return strings.TrimRight(baseURL, "/"), apiKey, nil
+	}
+	return "", "", fmt.Errorf("%s %w", provider, ErrEndpointNotConfigured)
+}
+
+func (r *KeyResolver) storedLocal(ctx context.Context, userID string) (*models.LocalLLMConfig, error) {
+	if r.provider == nil {
+		return nil, ErrIntegrationNotAvailable
+	}
+	if userID == "" {
+		return nil, ErrAPIKeyRequired
+	}
+
+	return r.provider.GetLocalConfig(ctx, userID)
+}
+
+func callerID(c *fiber.Ctx) string {
+	userID, _ := c.Locals(constants.ContextUserIDKey).(string)
+	return userID
+}
+
+/* StoredYandexFolder returns the folder id of the caller's Yandex integration, if any */
+func (r *KeyResolver) StoredYandexFolder(c *fiber.Ctx) string {
+	if r.provider == nil {
+		return ""
+	}
+	userID, _ := c.Locals(constants.ContextUserIDKey).(string)
+	config, err := r.provider.GetYandexConfig(c.Context(), userID)
+	if err != nil {
+		return ""
+	}
+	return config.FolderID
+}
+
+/* respondKeyError maps resolver errors to HTTP responses */
+func respondKeyError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, ErrExplicitKeyNotAllowed) {
+		return response.Forbidden(c, err.Error())
+	}
+	return response.Unauthorized(c, ErrAPIKeyRequired.Error())
+}
+
+/* StoredFallbacks returns the caller's own fallback chain ("provider:model" entries), if any */
+func (r *KeyResolver) StoredFallbacks(c *fiber.Ctx) []string {
+	if r.provider == nil {
+		return nil
+	}
+	userID, _ := c.Locals(constants.ContextUserIDKey).(string)
+	if userID == "" {
+		return nil
+	}
+	fallbacks, err := r.provider.GetFallbacks(c.Context(), userID)
+	if err != nil {
+		return nil
+	}
+	return fallbacks
+}
@@ -0,0 +1,152 @@
+package llmproxy
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"backend-v2/internal/common/constants"
+	"backend-v2/internal/models"
+	"backend-v2/internal/providers/apikey"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type stubKeyProvider struct {
+	apikey.Provider
+	keys map[string]string
+}
+
+func (p *stubKeyProvider) GetAPIKey(_ context.Context, userID, service string) (string, error) {
+	key, ok := p.keys[userID+"/"+service]
+	if !ok {
+		return "", apikey.ErrNotConfigured
+	}
+	return key, nil
+}
+
+func (p *stubKeyProvider) GetFallbacks(context.Context, string) ([]string, error) {
+	return nil, nil
+}
+
+func (p *stubKeyProvider) GetCustomLLMConfig(_ context.Context, userID string) (*models.CustomLLMConfig, error) {
+	return nil, apikey.ErrNotConfigured
+}
+
+func resolveKey(t *testing.T, resolver *KeyResolver, userID, explicitKey string, validation bool) (string, error) {
+	t.Helper()
+
+	app := fiber.New()
+	var (
+		key string
+		err error
+	)
+	if validation {
+		app.Use(KeyValidation("openai"))
+	}
+	app.Get("/test", func(c *fiber.Ctx) error {
+		if userID != "" {
+			c.Locals(constants.ContextUserIDKey, userID)
+		}
+		key, err = resolver.Resolve(c, explicitKey, "openai")
+		return c.SendString("ok")
+	})
+
+	req := httptest.NewRequest("GET", "/test", nil)
+	req.Header.Set(headerAuth, bearerPrefix+explicitKey)
+	/* A client cannot ask for validation mode itself */
+	req.Header.Set("X-Key-Validation", "true")
+	if _, testErr := app.Test(req, -1); testErr != nil {
+		t.Fatalf("Test request failed: %v", testErr)
+	}
+	return key, err
+}
+
+func newStubResolver(mode string) *KeyResolver {
+	return NewKeyResolver(&stubKeyProvider{keys: map[string]string{"user-1/openai": "sk-stored"}}, mode)
+}
+
+func TestKeyResolver_ClientModeForwardsExplicitKey(t *testing.T) {
+	key, err := resolveKey(t, newStubResolver(KeyModeClient), "user-1", "sk-explicit", false)
+	if err != nil || key != "sk-explicit" {
+		t.Errorf("Resolve() = %q, %v; want sk-explicit, nil", key, err)
+	}
+}
+
+func TestKeyResolver_EmptyKeyFallsBackToStored(t *testing.T) {
+	for _, explicit := range []string{"", "EMPTY"} {
+		key, err := resolveKey(t, newStubResolver(KeyModeClient), "user-1", explicit, false)
+		if err != nil || key != "sk-stored" {
+			t.Errorf("Resolve(%q) = %q, %v; want sk-stored, nil", explicit, key, err)
+		}
+	}
+}
+
+func TestKeyResolver_ServerModeRejectsExplicitKey(t *testing.T) {
+	_, err := resolveKey(t, newStubResolver(KeyModeServer), "user-1", "sk-explicit", false)
+	if !errors.Is(err, ErrExplicitKeyNotAllowed) {
+		t.Errorf("Resolve() error = %v, want ErrExplicitKeyNotAllowed", err)
+	}
+}
+
+func TestKeyResolver_ServerModeAllowsKeyValidation(t *testing.T) {
+	key, err := resolveKey(t, newStubResolver(KeyModeServer), "user-1", "sk-explicit", true)
+	if err != nil || key != "sk-explicit" {
+		t.Errorf("Resolve() = %q, %v; want sk-explicit, nil", key, err)
+	}
+}
+
+func TestKeyValidation_OnlyForOwnKeys(t *testing.T) {
+	app := fiber.New()
+	var validation bool
+	record := func(c *fiber.Ctx) error {
+		validation = IsKeyValidation(c)
+		return c.SendString("ok")
+	}
+	app.Post("/integration/chat/completions", KeyValidation("openai"), record)
+	app.Post("/integration/local/chat/completions", KeyValidation("local"), record)
+	app.Post("/llm/chat", record)
+
+	cases := []struct {
+		path, auth, body string
+		want             bool
+	}{
+		{"/integration/chat/completions", "Bearer sk-installing", `{}`, true},
+		{"/integration/chat/completions", "", `{}`, false},
+		{"/integration/chat/completions", "Bearer EMPTY", `{}`, false},
+		{"/integration/local/chat/completions", "", `{"url":"http://localhost:11434/v1"}`, true},
+		{"/integration/local/chat/completions", "", `{}`, false},
+		{"/llm/chat", "Bearer sk-installing", `{}`, false},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest("POST", tc.path, strings.NewReader(tc.body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Key-Validation", "true")
+		if tc.auth != "" {
+			req.Header.Set(headerAuth, tc.auth)
+		}
+		if _, err := app.Test(req, -1); err != nil {
+			t.Fatalf("Test request failed: %v", err)
+		}
+		if validation != tc.want {
+			t.Errorf("%s with %q %s: IsKeyValidation() = %t, want %t", tc.path, tc.auth, tc.body, validation, tc.want)
+		}
+	}
+}
+
+func TestKeyResolver_MissingStoredKey(t *testing.T) {
+	if _, err := resolveKey(t, newStubResolver(KeyModeServer), "user-2", "", false); !errors.Is(err, ErrAPIKeyRequired) {
+		t.Errorf("Resolve() for unknown user error = %v, want ErrAPIKeyRequired", err)
+	}
+	if _, err := resolveKey(t, newStubResolver(KeyModeServer), "", "", false); !errors.Is(err, ErrAPIKeyRequired) {
+		t.Errorf("Resolve() without user error = %v, want ErrAPIKeyRequired", err)
+	}
+}
+
+func TestNewKeyResolver_UnknownModeDefaultsToClient(t *testing.T) {
+	if r := NewKeyResolver(nil, "bogus"); r.mode != KeyModeClient {
+		t.Errorf("mode = %q, want %q", r.mode, KeyModeClient)
+	}
+}
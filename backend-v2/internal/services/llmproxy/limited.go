@@ -0,0 +1,129 @@
+package llmproxy
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	"backend-v2/internal/common/constants"
+	"backend-v2/internal/common/response"
+	"backend-v2/internal/services/ratelimit"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	HeaderRateLimitLimit       = "X-RateLimit-Limit"
+	HeaderRateLimitRemaining   = "X-RateLimit-Remaining"
+	HeaderQuotaTokensDay       = "X-Quota-Tokens-Day-Remaining"
+	HeaderQuotaTokensMonth     = "X-Quota-Tokens-Month-Remaining"
+	headerRetryAfter           = "Retry-After"
+	rateLimitExceededMessage   = "Rate limit exceeded, retry in %d seconds"
+	tokenQuotaExhaustedMessage = "Token quota exhausted, resets in %d seconds"
+)
+
+/* LimitedService enforces the per-role rate limits and token quotas in front of another Service */
+type LimitedService struct {
+	next    Service
+	limiter *ratelimit.Limiter
+}
+
+func NewLimitedService(next Service, limiter *ratelimit.Limiter) Service {
+	return &LimitedService{next: next, limiter: limiter}
+}
+
+func (s *LimitedService) ChatCompletions(c *fiber.Ctx) error {
+	return s.guard(c, s.next.ChatCompletions)
+}
+
+func (s *LimitedService) Embeddings(c *fiber.Ctx) error {
+	return s.guard(c, s.next.Embeddings)
+}
+
+func (s *LimitedService) PerplexityChatCompletions(c *fiber.Ctx) error {
+	return s.guard(c, s.next.PerplexityChatCompletions)
+}
+
+func (s *LimitedService) ClaudeMessages(c *fiber.Ctx) error {
+	return s.guard(c, s.next.ClaudeMessages)
+}
+
+func (s *LimitedService) YandexCompletion(c *fiber.Ctx) error {
+	return s.guard(c, s.next.YandexCompletion)
+}
+
+func (s *LimitedService) DeepSeekChatCompletions(c *fiber.Ctx) error {
+	return s.guard(c, s.next.DeepSeekChatCompletions)
+}
+
+func (s *LimitedService) QwenChatCompletions(c *fiber.Ctx) error {
+	return s.guard(c, s.next.QwenChatCompletions)
+}
+
+func (s *LimitedService) CustomLLMChatCompletions(c *fiber.Ctx) error {
+	return s.guard(c, s.next.CustomLLMChatCompletions)
+}
+
+func (s *LimitedService) CustomLLMEmbeddings(c *fiber.Ctx) error {
+	return s.guard(c, s.next.CustomLLMEmbeddings)
+}
+
+func (s *LimitedService) LocalChatCompletions(c *fiber.Ctx) error {
+	return s.guard(c, s.next.LocalChatCompletions)
+}
+
+func (s *LimitedService) LocalEmbeddings(c *fiber.Ctx) error {
+	return s.guard(c, s.next.LocalEmbeddings)
+}
+
+/* LocalModels only lists models, so it does not count against the caller's limits */
+func (s *LimitedService) LocalModels(c *fiber.Ctx) error {
+	return s.next.LocalModels(c)
+}
+
+func (s *LimitedService) Chat(c *fiber.Ctx) error {
+	return s.guard(c, s.next.Chat)
+}
+
+func (s *LimitedService) guard(c *fiber.Ctx, handler fiber.Handler) error {
+	userID, _ := c.Locals(constants.ContextUserIDKey).(string)
+	roles, _ := c.Locals("roles").([]string)
+
+	result, err := s.limiter.Check(c.Context(), userID, roles)
+	if err != nil {
+		/* Quota storage outages must not take the proxy down; fail open */
+		log.Warn("quota check failed for user %s, allowing request: %v", userID, err)
+		return handler(c)
+	}
+
+	setQuotaHeaders(c, result)
+	if result.Allowed {
+		return handler(c)
+	}
+
+	retryAfter := int(math.Ceil(result.RetryAfter.Seconds()))
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+	c.Set(headerRetryAfter, strconv.Itoa(retryAfter))
+
+	message := rateLimitExceededMessage
+	if result.Reason != ratelimit.ReasonRate {
+		message = tokenQuotaExhaustedMessage
+	}
+	return response.TooManyRequests(c, fmt.Sprintf(message, retryAfter))
+}
+
+func setQuotaHeaders(c *fiber.Ctx, result ratelimit.Result) {
+	/* RequestsRemaining stays Unlimited when a token quota denied the call before the rate was taken */
+	if result.Limits.RequestsPerMinute > 0 && result.RequestsRemaining >= 0 {
+		c.Set(HeaderRateLimitLimit, strconv.Itoa(result.Limits.RequestsPerMinute))
+		c.Set(HeaderRateLimitRemaining, strconv.Itoa(result.RequestsRemaining))
+	}
+	if result.TokensRemainingDay != ratelimit.Unlimited {
+		c.Set(HeaderQuotaTokensDay, strconv.FormatInt(result.TokensRemainingDay, 10))
+	}
+	if result.TokensRemainingMonth != ratelimit.Unlimited {
+		c.Set(HeaderQuotaTokensMonth, strconv.FormatInt(result.TokensRemainingMonth, 10))
+	}
+}
@@ -0,0 +1,127 @@
+package llmproxy
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	nethttp "net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"backend-v2/internal/common/constants"
+	"backend-v2/internal/services/ratelimit"
+	"backend-v2/internal/services/usage"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestLimitedService_RejectsOverRate(t *testing.T) {
+	policy := ratelimit.Policy{"subscriber": {RequestsPerMinute: 1}}
+	limited := NewLimitedService(NewNoopService(), ratelimit.NewLimiter(ratelimit.NewMemoryStore(), nil, policy))
+
+	app := fiber.New()
+	app.Post("/chat", func(c *fiber.Ctx) error {
+		c.Locals(constants.ContextUserIDKey, "user-1")
+		c.Locals("roles", []string{"subscriber"})
+		return limited.ChatCompletions(c)
+	})
+
+	first, err := app.Test(httptest.NewRequest("POST", "/chat", nil), -1)
+	if err != nil {
+		t.Fatalf("Test request failed: %v", err)
+	}
+	if first.StatusCode != fiber.StatusOK || first.Header.Get(HeaderRateLimitLimit) != "1" || first.Header.Get(HeaderRateLimitRemaining) != "0" {
+		t.Errorf("first call = %d, limit %q remaining %q", first.StatusCode, first.Header.Get(HeaderRateLimitLimit), first.Header.Get(HeaderRateLimitRemaining))
+	}
+
+	second, err := app.Test(httptest.NewRequest("POST", "/chat", nil), -1)
+	if err != nil {
+		t.Fatalf("Test request failed: %v", err)
+	}
+	if second.StatusCode != fiber.StatusTooManyRequests {
+		t.Fatalf("second call status = %d, want 429", second.StatusCode)
+	}
+	if retry := second.Header.Get("Retry-After"); retry != "60" {
+		t.Errorf("Retry-After = %q, want 60", retry)
+	}
+}
+
+/* tallyUsage sums recorded tokens into today's total, as the Mongo store's daily totals would */
+type tallyUsage struct {
+	usage.Store
+	mu       sync.Mutex
+	tokens   int64
+	recorded chan struct{}
+}
+
+func (u *tallyUsage) Record(_ context.Context, record usage.Record) error {
+	u.mu.Lock()
+	u.tokens += record.Tokens.Total
+	u.mu.Unlock()
+	u.recorded <- struct{}{}
+	return nil
+}
+
+func (u *tallyUsage) Totals(_ context.Context, _ usage.Filter, _ string) ([]usage.Total, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return []usage.Total{{Key: time.Now().UTC().Format(usage.DayFormat), TotalTokens: u.tokens}}, nil
+}
+
+func TestLimitedService_StreamedCallsCountAgainstQuota(t *testing.T) {
+	upstream := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		var body map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = w.Write([]byte(`data: {"choices":[{"delta":{"content":"Hi"}}]}` + "\n\n"))
+		if includesUsage(body) {
+			_, _ = w.Write([]byte(`data: {"choices":[],"usage":{"prompt_tokens":600,"completion_tokens":600,"total_tokens":1200}}` + "\n\n"))
+		}
+		_, _ = w.Write([]byte("data: [DONE]\n\n"))
+	}))
+	defer upstream.Close()
+
+	used := &tallyUsage{recorded: make(chan struct{}, 1)}
+	prod := NewProdService(NewKeyResolver(nil, KeyModeClient), used, nil, nil).(*ProdService)
+	openai := prod.providers["openai"]
+	openai.URL = upstream.URL
+	prod.providers = map[string]ProviderConfig{"openai": openai}
+
+	policy := ratelimit.Policy{"subscriber": {TokensPerDay: 1000}}
+	limited := NewLimitedService(prod, ratelimit.NewLimiter(ratelimit.NewMemoryStore(), used, policy))
+
+	app := fiber.New()
+	app.Post("/openai", func(c *fiber.Ctx) error {
+		c.Locals(constants.ContextUserIDKey, "user-1")
+		c.Locals("roles", []string{"subscriber"})
+		return limited.ChatCompletions(c)
+	})
+	call := func() *nethttp.Response {
+		req := httptest.NewRequest("POST", "/openai", strings.NewReader(`{"model":"gpt-4o","stream":true,"messages":[]}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer sk-test")
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatalf("Test request failed: %v", err)
+		}
+		_, _ = io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return resp
+	}
+
+	if first := call(); first.StatusCode != fiber.StatusOK {
+		t.Fatalf("first call status = %d, want 200", first.StatusCode)
+	}
+	select {
+	case <-used.recorded:
+	case <-time.After(time.Second):
+		t.Fatal("streamed usage was not recorded")
+	}
+
+	if second := call(); second.StatusCode != fiber.StatusTooManyRequests {
+		t.Errorf("second call status = %d, want 429 once the stream used up the daily quota", second.StatusCode)
+	}
+}
@@ -0,0 +1,131 @@
+package llmproxy
+
+import (
+	"context"
+	"encoding/json"
+	nethttp "net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"backend-v2/internal/common/constants"
+	"backend-v2/internal/models"
+	"backend-v2/internal/providers/apikey"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type localProvider struct {
+	apikey.Provider
+	config *models.LocalLLMConfig
+}
+
+func (p *localProvider) GetLocalConfig(context.Context, string) (*models.LocalLLMConfig, error) {
+	if p.config == nil {
+		return nil, apikey.ErrNotConfigured
+	}
+	return p.config, nil
+}
+
+func (p *localProvider) GetFallbacks(context.Context, string) ([]string, error) {
+	return nil, nil
+}
+
+/* newLocalServer mimics Ollama's OpenAI-compatible API */
+func newLocalServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/v1/models":
+			_, _ = w.Write([]byte(`{"object":"list","data":[{"id":"llama3.1:8b","object":"model"}]}`))
+		case "/v1/chat/completions":
+			_, _ = w.Write([]byte(`{"id":"c1","model":"llama3.1:8b","choices":[{"message":{"content":"local hi"},"finish_reason":"stop"}]}`))
+		default:
+			w.WriteHeader(nethttp.StatusNotFound)
+		}
+	}))
+}
+
+func TestKeyResolver_StoredEndpoint(t *testing.T) {
+	cases := []struct {
+		name     string
+		config   *models.LocalLLMConfig
+		fallback string
+		wantURL  string
+		wantErr  bool
+	}{
+		{"user endpoint wins", &models.LocalLLMConfig{BaseURL: "http://gpu-box:8000/v1/", APIKey: "vllm-key"}, "http://ollama:11434/v1", "http://gpu-box:8000/v1", false},
+		{"server default", nil, "http://ollama:11434/v1", "http://ollama:11434/v1", false},
+		{"model-only settings use the server default", &models.LocalLLMConfig{Model: "qwen2.5"}, "http://ollama:11434/v1", "http://ollama:11434/v1", false},
+		{"nothing configured", nil, "", "", true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			resolver := NewKeyResolver(&localProvider{config: tc.config}, KeyModeClient).WithLocalDefault(tc.fallback)
+
+			app := fiber.New()
+			var (
+				baseURL string
+				err     error
+			)
+			app.Get("/", func(c *fiber.Ctx) error {
+				c.Locals(constants.ContextUserIDKey, "user-1")
+				baseURL, _, err = resolver.StoredEndpoint(c, "local")
+				return nil
+			})
+			if _, testErr := app.Test(httptest.NewRequest("GET", "/", nil), -1); testErr != nil {
+				t.Fatalf("Test request failed: %v", testErr)
+			}
+
+			if (err != nil) != tc.wantErr || baseURL != tc.wantURL {
+				t.Errorf("StoredEndpoint() = %q, %v; want %q, error %t", baseURL, err, tc.wantURL, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestProdService_LocalProvider(t *testing.T) {
+	upstream := newLocalServer(t)
+	defer upstream.Close()
+
+	resolver := NewKeyResolver(&localProvider{}, KeyModeClient).WithLocalDefault(upstream.URL + "/v1")
+	service := NewProdService(resolver, nil, nil, nil)
+
+	app := fiber.New()
+	withUser := func(handler fiber.Handler) fiber.Handler {
+		return func(c *fiber.Ctx) error {
+			c.Locals(constants.ContextUserIDKey, "user-1")
+			return handler(c)
+		}
+	}
+	app.Get("/local/models", withUser(service.LocalModels))
+	app.Post("/llm/chat", withUser(service.Chat))
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/local/models", nil), -1)
+	if err != nil {
+		t.Fatalf("models request failed: %v", err)
+	}
+	var models struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	_ = json.NewDecoder(resp.Body).Decode(&models)
+	if resp.StatusCode != fiber.StatusOK || len(models.Data) != 1 || models.Data[0].ID != "llama3.1:8b" {
+		t.Errorf("models: status %d, %+v", resp.StatusCode, models)
+	}
+
+	req := httptest.NewRequest("POST", "/llm/chat", strings.NewReader(`{"provider":"local","model":"llama3.1:8b","messages":[{"role":"user","content":"hi"}]}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err = app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("chat request failed: %v", err)
+	}
+	var chat ChatResponse
+	_ = json.NewDecoder(resp.Body).Decode(&chat)
+	if resp.StatusCode != fiber.StatusOK || chat.Provider != "local" || chat.Message.Content != "local hi" {
+		t.Errorf("chat: status %d, %+v", resp.StatusCode, chat)
+	}
+}
@@ -0,0 +1,17 @@
+package llmproxy
+
+import (
+	"net/netip"
+	"os"
+	"testing"
+
+	"backend-v2/internal/common/http"
+)
+
+/* TestMain lets the guarded clients reach the loopback httptest upstreams */
+func TestMain(m *testing.M) {
+	policy := http.DefaultGuardPolicy()
+	policy.AllowCIDRs = []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8")}
+	http.SetDefaultGuard(http.NewGuard(policy))
+	os.Exit(m.Run())
+}
@@ -0,0 +1,90 @@
+package llmproxy
+
+import (
+	"context"
+	"time"
+
+	"backend-v2/internal/common/constants"
+	"backend-v2/internal/common/logger"
+	"backend-v2/internal/services/usage"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var log = logger.New("LLMPROXY")
+
+const recordTimeout = 5 * time.Second
+
+/* callMeter records the token usage of one proxied call; a nil recorder disables metering */
+type callMeter struct {
+	recorder usage.Recorder
+	userID   string
+	provider string
+	model    string
+	stream   usage.StreamMeter
+}
+
+func newCallMeter(c *fiber.Ctx, recorder usage.Recorder, provider string, body map[string]interface{}) *callMeter {
+	userID, _ := c.Locals(constants.ContextUserIDKey).(string)
+	return &callMeter{
+		recorder: recorder,
+		userID:   userID,
+		provider: provider,
+		model:    requestModel(body),
+	}
+}
+
+/* requestModel is the fallback model name when the response does not echo one */
+func requestModel(body map[string]interface{}) string {
+	if model, ok := body["model"].(string); ok && model != "" {
+		return model
+	}
+	/* Yandex addresses models by URI */
+	if modelURI, ok := body["modelUri"].(string); ok {
+		return modelURI
+	}
+	return ""
+}
+
+/* Response records usage from a complete (non-streamed) provider response */
+func (m *callMeter) Response(body []byte, statusCode int) {
+	tokens, model := usage.Parse(body)
+	m.record(statusCode, tokens, model)
+}
+
+/* Observe implements StreamObserver */
+func (m *callMeter) Observe(line []byte) {
+	m.stream.Feed(line)
+}
+
+/* Close implements StreamObserver */
+func (m *callMeter) Close(statusCode int) {
+	tokens, model := m.stream.Result()
+	m.record(statusCode, tokens, model)
+}
+
+func (m *callMeter) record(statusCode int, tokens usage.Tokens, model string) {
+	if m.recorder == nil || m.userID == "" || statusCode < 200 || statusCode >= 300 {
+		return
+	}
+	if model == "" {
+		model = m.model
+	}
+
+	record := usage.Record{
+		UserID:   m.userID,
+		Provider: m.provider,
+		Model:    model,
+		Tokens:   tokens,
+		At:       time.Now(),
+	}
+
+	/* Metering must never delay or fail the proxied response */
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), recordTimeout)
+		defer cancel()
+		if err := m.recorder.Record(ctx, record); err != nil {
+			log.Warn("usage record failed for user %s (%s/%s): %v", record.UserID, record.Provider, record.Model, err)
+		}
+	}()
+}
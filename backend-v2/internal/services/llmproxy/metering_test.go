@@ -0,0 +1,86 @@
+package llmproxy
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"backend-v2/internal/common/constants"
+	"backend-v2/internal/services/usage"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type chanRecorder chan usage.Record
+
+func (r chanRecorder) Record(_ context.Context, record usage.Record) error {
+	r <- record
+	return nil
+}
+
+func newTestMeter(t *testing.T, recorder usage.Recorder, body map[string]interface{}) *callMeter {
+	t.Helper()
+
+	var meter *callMeter
+	app := fiber.New()
+	app.Get("/test", func(c *fiber.Ctx) error {
+		c.Locals(constants.ContextUserIDKey, "user-1")
+		meter = newCallMeter(c, recorder, "openai", body)
+		return nil
+	})
+	if _, err := app.Test(httptest.NewRequest("GET", "/test", nil), -1); err != nil {
+		t.Fatalf("Test request failed: %v", err)
+	}
+	return meter
+}
+
+func waitRecord(t *testing.T, records chanRecorder) usage.Record {
+	t.Helper()
+	select {
+	case record := <-records:
+		return record
+	case <-time.After(time.Second):
+		t.Fatal("usage was not recorded")
+		return usage.Record{}
+	}
+}
+
+func TestCallMeter_RecordsResponseUsage(t *testing.T) {
+	records := make(chanRecorder, 1)
+	meter := newTestMeter(t, records, map[string]interface{}{"model": "gpt-4o"})
+
+	meter.Response([]byte(`{"model":"gpt-4o-2024-08-06","usage":{"prompt_tokens":3,"completion_tokens":4,"total_tokens":7}}`), 200)
+
+	record := waitRecord(t, records)
+	if record.UserID != "user-1" || record.Provider != "openai" || record.Model != "gpt-4o-2024-08-06" || record.Tokens.Total != 7 {
+		t.Errorf("recorded %+v", record)
+	}
+}
+
+func TestCallMeter_StreamFallsBackToRequestModel(t *testing.T) {
+	records := make(chanRecorder, 1)
+	meter := newTestMeter(t, records, map[string]interface{}{"model": "gpt-4o"})
+
+	meter.Observe([]byte(`data: {"choices":[{"delta":{"content":"Hi"}}]}` + "\n"))
+	meter.Observe([]byte("data: [DONE]\n"))
+	meter.Close(200)
+
+	record := waitRecord(t, records)
+	if record.Model != "gpt-4o" || !record.Tokens.IsZero() {
+		t.Errorf("recorded %+v, want request model with zero tokens", record)
+	}
+}
+
+func TestCallMeter_SkipsFailedCalls(t *testing.T) {
+	records := make(chanRecorder, 1)
+	meter := newTestMeter(t, records, nil)
+
+	meter.Response([]byte(`{"error":{"message":"invalid key"}}`), 401)
+
+	select {
+	case record := <-records:
+		t.Errorf("failed call recorded: %+v", record)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -1,8 +1,12 @@
 package llmproxy
 
 import (
+	"strings"
 	"time"
 
+	"backend-v2/internal/common/response"
+	"backend-v2/internal/services/usage"
+
 	"github.com/gofiber/fiber/v2"
 )
 
@@ -14,6 +18,14 @@ func NewNoopService() Service {
 }
 
 func (s *NoopService) ChatCompletions(c *fiber.Ctx) error {
+	if wantsStream(c) {
+		return sendMockStream(c, []string{
+			`data: {"id":"chatcmpl-mock","object":"chat.completion.chunk","model":"gpt-4o","choices":[{"index":0,"delta":{"role":"assistant","content":"Mock "},"finish_reason":null}]}`,
+			`data: {"id":"chatcmpl-mock","object":"chat.completion.chunk","model":"gpt-4o","choices":[{"index":0,"delta":{"content":"response from OpenAI"},"finish_reason":"stop"}]}`,
+			`data: [DONE]`,
+		})
+	}
+
 	return c.JSON(fiber.Map{
 		"id":      "chatcmpl-mock",
 		"object":  "chat.completion",
@@ -60,6 +72,15 @@ func (s *NoopService) PerplexityChatCompletions(c *fiber.Ctx) error {
 }
 
 func (s *NoopService) ClaudeMessages(c *fiber.Ctx) error {
+	if wantsStream(c) {
+		return sendMockStream(c, []string{
+			"event: message_start\ndata: {\"type\":\"message_start\",\"message\":{\"id\":\"msg_mock\",\"model\":\"claude-3-sonnet\",\"usage\":{\"input_tokens\":10,\"output_tokens\":0}}}",
+			"event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"text_delta\",\"text\":\"Mock response from Claude\"}}",
+			"event: message_delta\ndata: {\"type\":\"message_delta\",\"delta\":{\"stop_reason\":\"end_turn\"},\"usage\":{\"output_tokens\":5}}",
+			"event: message_stop\ndata: {\"type\":\"message_stop\"}",
+		})
+	}
+
 	return c.JSON(fiber.Map{
 		"id":   "msg_mock",
 		"type": "message",
@@ -106,6 +127,10 @@ func (s *NoopService) DeepSeekChatCompletions(c *fiber.Ctx) error {
 	return s.ChatCompletions(c)
 }
 
+func (s *NoopService) QwenChatCompletions(c *fiber.Ctx) error {
+	return s.ChatCompletions(c)
+}
+
 func (s *NoopService) CustomLLMChatCompletions(c *fiber.Ctx) error {
 	return s.ChatCompletions(c)
 }
@@ -113,3 +138,77 @@ func (s *NoopService) CustomLLMChatCompletions(c *fiber.Ctx) error {
 func (s *NoopService) CustomLLMEmbeddings(c *fiber.Ctx) error {
 	return s.Embeddings(c)
 }
+
+func (s *NoopService) LocalChatCompletions(c *fiber.Ctx) error {
+	return s.ChatCompletions(c)
+}
+
+func (s *NoopService) LocalEmbeddings(c *fiber.Ctx) error {
+	return s.Embeddings(c)
+}
+
+func (s *NoopService) LocalModels(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{
+		"object": "list",
+		"data": []fiber.Map{
+			{"id": "llama3.1:8b", "object": "model", "owned_by": "library"},
+			{"id": "nomic-embed-text", "object": "model", "owned_by": "library"},
+		},
+	})
+}
+
+func (s *NoopService) Chat(c *fiber.Ctx) error {
+	var chat ChatRequest
+	if err := c.BodyParser(&chat); err != nil {
+		return response.BadRequest(c, "Invalid request body")
+	}
+	if err := chat.Validate(); err != nil {
+		return response.BadRequest(c, err.Error())
+	}
+	if _, exists := chatAdapters[chat.Provider]; !exists {
+		return response.BadRequest(c, ErrUnknownChatProvider.Error())
+	}
+
+	mockUsage := usage.Tokens{Prompt: 10, Completion: 5, Total: 15}
+	content := "Mock response from " + chat.Provider
+	setServedHeaders(c, Target{Provider: chat.Provider, Model: chat.Model})
+
+	if chat.Stream {
+		return sendMockStream(c, []string{
+			strings.TrimSpace(string(sseEvent(ChatStreamEvent{Delta: &ChatDelta{Content: content}}))),
+			strings.TrimSpace(string(sseEvent(ChatStreamEvent{FinishReason: FinishStop, Usage: &mockUsage}))),
+			strings.TrimSpace(string(sseDone)),
+		})
+	}
+
+	return c.JSON(ChatResponse{
+		ID:           "chat-mock",
+		Provider:     chat.Provider,
+		Model:        chat.Model,
+		Message:      ChatMessage{Role: RoleAssistant, Content: content},
+		FinishReason: FinishStop,
+		Usage:        mockUsage,
+	})
+}
+
+/* wantsStream reports whether the mocked request asked for SSE */
+func wantsStream(c *fiber.Ctx) bool {
+	var body map[string]interface{}
+	if err := c.BodyParser(&body); err != nil {
+		return false
+	}
+	return IsStreamingRequest(body)
+}
+
+/* sendMockStream writes each event followed by a blank line, mimicking provider SSE framing */
+func sendMockStream(c *fiber.Ctx, events []string) error {
+	c.Set(headerContentType, contentTypeEventStream)
+	c.Set("Cache-Control", "no-cache")
+
+	var sb strings.Builder
+	for _, event := range events {
+		sb.WriteString(event)
+		sb.WriteString("\n\n")
+	}
+	return c.SendString(sb.String())
+}
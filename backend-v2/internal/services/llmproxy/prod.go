@@ -3,22 +3,56 @@ package llmproxy
 import (
 	"backend-v2/internal/common/http"
 	"backend-v2/internal/common/response"
+	"backend-v2/internal/services/llmcatalog"
+	"backend-v2/internal/services/usage"
+	"errors"
+	nethttp "net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 )
 
 type ProdService struct {
-	httpClient http.Client
+	httpClient   http.Client
+	streamClient http.Client
+	keys         *KeyResolver
+	usage        usage.Recorder
+	router       *Router
+	providers    map[string]ProviderConfig
 }
 
-func NewProdService() Service {
+/*
+NewProdService builds the real proxy; recorder may be nil to disable usage metering,
+router may be nil to call each upstream exactly once without fallback, and catalog
+may be nil to use the built-in provider endpoints
+*/
+func NewProdService(keys *KeyResolver, recorder usage.Recorder, router *Router, catalog *llmcatalog.Catalog) Service {
+	if router == nil {
+		router = directRouter()
+	}
+	providers := defaultProviderConfigs
+	if catalog != nil {
+		providers = providerConfigsFrom(catalog)
+	}
 	factory := http.NewClientFactory()
 	return &ProdService{
 		httpClient: factory.Create(30 * time.Second),
+		/* No overall deadline for streams - long generations are bounded by StreamIdleTimeout instead */
+		streamClient: factory.Create(0),
+		keys:         keys,
+		usage:        recorder,
+		router:       router,
+		providers:    providers,
 	}
 }
 
+func (s *ProdService) providerConfig(provider string) (ProviderConfig, bool) {
+	config, exists := s.providers[provider]
+	return config, exists
+}
+
 func (s *ProdService) ChatCompletions(c *fiber.Ctx) error {
 	return s.proxyWithConfig(c, "openai")
 }
@@ -43,55 +77,249 @@ func (s *ProdService) DeepSeekChatCompletions(c *fiber.Ctx) error {
 	return s.proxyWithConfig(c, "deepseek")
 }
 
+func (s *ProdService) QwenChatCompletions(c *fiber.Ctx) error {
+	return s.proxyWithConfig(c, "qwen")
+}
+
 func (s *ProdService) CustomLLMChatCompletions(c *fiber.Ctx) error {
-	return s.proxyCustomLLM(c, "/chat/completions")
+	return s.proxySelfHosted(c, "custom_llm", "/chat/completions")
 }
 
 func (s *ProdService) CustomLLMEmbeddings(c *fiber.Ctx) error {
-	return s.proxyCustomLLM(c, "/embeddings")
+	return s.proxySelfHosted(c, "custom_llm", "/embeddings")
 }
 
-func (s *ProdService) proxyCustomLLM(c *fiber.Ctx, endpoint string) error {
-	var body map[string]interface{}
-	if err := c.BodyParser(&body); err != nil {
+func (s *ProdService) LocalChatCompletions(c *fiber.Ctx) error {
+	return s.proxySelfHosted(c, "local", "/chat/completions")
+}
+
+func (s *ProdService) LocalEmbeddings(c *fiber.Ctx) error {
+	return s.proxySelfHosted(c, "local", "/embeddings")
+}
+
+/* LocalModels relays the local server's OpenAI-compatible model list; ?url= probes an endpoint before it is saved */
+func (s *ProdService) LocalModels(c *fiber.Ctx) error {
+	baseURL, apiKey, err := s.selfHostedEndpoint(c, "local", c.Query("url"))
+	if err != nil {
+		return respondEndpointError(c, err)
+	}
+
+	req, err := nethttp.NewRequest("GET", baseURL+"/models", nil)
+	if err != nil {
+		return response.BadRequest(c, "Invalid local LLM URL")
+	}
+	if !IsEmptyAPIKey(apiKey) {
+		req.Header.Set(headerAuth, bearerPrefix+apiKey)
+	}
+
+	body, statusCode, err := ExecuteProxyRequest(s.httpClient, req)
+	if err != nil {
+		return respondTransportError(c, err)
+	}
+	return SendProxyResponse(c, body, statusCode)
+}
+
+func (s *ProdService) Chat(c *fiber.Ctx) error {
+	var chat ChatRequest
+	if err := c.BodyParser(&chat); err != nil {
 		return response.BadRequest(c, "Invalid request body")
 	}
+	if err := chat.Validate(); err != nil {
+		return response.BadRequest(c, err.Error())
+	}
 
-	url, ok := body["url"].(string)
-	if !ok || url == "" {
-		return response.BadRequest(c, "URL parameter is required")
+	primary, err := s.chatRoute(c, chat, Target{Provider: chat.Provider, Model: chat.Model}, true)
+	if err != nil {
+		return respondChatRouteError(c, err)
+	}
+
+	fallbacks := func() []route {
+		var routes []route
+		for _, target := range s.router.policy.Fallbacks(primary.Target, s.keys.StoredFallbacks(c)) {
+			fallback, err := s.chatRoute(c, chat, target, false)
+			if err != nil {
+				log.Debug("skipping chat fallback %s: %v", target, err)
+				continue
+			}
+			routes = append(routes, fallback)
+		}
+		return routes
+	}
+
+	served, result, attempted := s.router.Do(c.Context(), primary, fallbacks, s.caller(chat.Stream))
+	if !attempted {
+		return s.respondUpstreamsUnavailable(c)
+	}
+	setServedHeaders(c, served.Target)
+	meter := newCallMeter(c, s.usage, served.service, served.request.Body)
+
+	if chat.Stream {
+		transformer := newChatStreamTransformer(served.Provider, served.adapter.newStreamTranslator())
+		if err := deliverStream(c, result, meter, transformer); err != nil {
+			return respondTransportError(c, err)
+		}
+		return nil
+	}
+
+	if result.err != nil {
+		return respondTransportError(c, result.err)
+	}
+	meter.Response(result.body, result.status)
+
+	if result.status < 200 || result.status >= 300 {
+		return respondUpstreamError(c, served.Provider, result.body, result.status)
+	}
+
+	parsed, err := served.adapter.parseResponse(result.body)
+	if err != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"message":        err.Error(),
+			"provider":       served.Provider,
+			"upstreamStatus": result.status,
+		})
+	}
+	parsed.Provider = served.Provider
+	parsed.Usage, _ = usage.Parse(result.body)
+	if parsed.Model == "" {
+		parsed.Model = served.Model
+	}
+
+	return c.JSON(parsed)
+}
+
+/*
+chatRoute resolves the key, endpoint and translated body for sending chat to target.
+Only the primary route may use an explicit client key; fallbacks use stored keys.
+*/
+func (s *ProdService) chatRoute(c *fiber.Ctx, chat ChatRequest, target Target, primary bool) (route, error) {
+	adapter, exists := chatAdapters[target.Provider]
+	if !exists {
+		return route{}, ErrUnknownChatProvider
+	}
+	chat.Provider, chat.Model = target.Provider, target.Model
+
+	request := ProxyRequest{AuthHeader: headerAuth}
+	integrationService := target.Provider
+	if isSelfHosted(target.Provider) {
+		baseURL, apiKey, err := s.keys.StoredEndpoint(c, target.Provider)
+		if err != nil {
+			return route{}, err
+		}
+		request.TargetURL = baseURL + "/chat/completions"
+		request.APIKey = apiKey
+	} else {
+		config, _ := s.providerConfig(target.Provider)
+		var (
+			apiKey string
+			err    error
+		)
+		if primary {
+			apiKey, err = s.keys.Resolve(c, config.AuthExtractor(c), config.IntegrationService)
+		} else {
+			apiKey, err = s.keys.Stored(c, config.IntegrationService)
+		}
+		if err != nil {
+			return route{}, err
+		}
+		request.TargetURL = config.URL
+		request.APIKey = apiKey
+		request.AuthHeader = config.AuthHeaderName
+		request.ExtraHeaders = config.ExtraHeaders
+		integrationService = config.IntegrationService
 	}
-	delete(body, "url")
 
-	apiKey := BearerTokenExtractor(c)
+	if target.Provider == "yandex" {
+		chat.folderID = s.keys.StoredYandexFolder(c)
+	}
 
-	req, err := BuildProxyRequest(ProxyRequest{
-		TargetURL:  url + endpoint,
-		APIKey:     apiKey,
-		Body:       body,
-		AuthHeader: headerAuth,
-	})
+	body, err := adapter.buildBody(&chat)
 	if err != nil {
-		return response.InternalError(c, err.Error())
+		return route{}, err
+	}
+	request.Body = body
+
+	return route{Target: target, service: integrationService, request: request, adapter: adapter}, nil
+}
+
+/* respondChatRouteError maps a failure to reach the requested provider to an HTTP response */
+func respondChatRouteError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, ErrAPIKeyRequired), errors.Is(err, ErrExplicitKeyNotAllowed), errors.Is(err, ErrIntegrationNotAvailable):
+		return respondKeyError(c, err)
+	default:
+		return response.BadRequest(c, err.Error())
+	}
+}
+
+/* isSelfHosted reports providers whose endpoint comes from configuration rather than the provider catalog */
+func isSelfHosted(provider string) bool {
+	return provider == "custom_llm" || provider == "local"
+}
+
+/* selfHostedEndpoint picks the caller-supplied URL (validate-on-install flow) or the stored endpoint */
+func (s *ProdService) selfHostedEndpoint(c *fiber.Ctx, provider, explicitURL string) (string, string, error) {
+	if explicitURL == "" {
+		return s.keys.StoredEndpoint(c, provider)
+	}
+	if err := s.keys.CheckExplicit(c); err != nil {
+		return "", "", err
+	}
+	return strings.TrimRight(explicitURL, "/"), BearerTokenExtractor(c), nil
+}
+
+/* respondTransportError maps a failed upstream call; a destination refused by the outbound guard is the caller's fault */
+func respondTransportError(c *fiber.Ctx, err error) error {
+	if http.IsBlocked(err) {
+		return response.BadRequest(c, "Upstream URL is not allowed")
+	}
+	return response.InternalError(c, err.Error())
+}
+
+/* respondEndpointError maps self-hosted endpoint resolution errors to HTTP responses */
+func respondEndpointError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, ErrEndpointNotConfigured) {
+		return response.BadRequest(c, "URL parameter is required")
+	}
+	return respondKeyError(c, err)
+}
+
+func (s *ProdService) proxySelfHosted(c *fiber.Ctx, provider, endpoint string) error {
+	var body map[string]interface{}
+	if err := c.BodyParser(&body); err != nil {
+		return response.BadRequest(c, "Invalid request body")
 	}
 
-	respBody, statusCode, err := ExecuteProxyRequest(s.httpClient, req)
+	explicitURL, _ := body["url"].(string)
+	delete(body, "url")
+
+	baseURL, apiKey, err := s.selfHostedEndpoint(c, provider, explicitURL)
 	if err != nil {
-		return response.InternalError(c, err.Error())
+		return respondEndpointError(c, err)
 	}
 
-	return SendProxyResponse(c, respBody, statusCode)
+	model, _ := body["model"].(string)
+	primary := route{
+		Target:  Target{Provider: provider, Model: model},
+		service: provider,
+		request: ProxyRequest{
+			TargetURL:  baseURL + endpoint,
+			APIKey:     apiKey,
+			Body:       body,
+			AuthHeader: headerAuth,
+		},
+	}
+	return s.execute(c, primary, nil, IsStreamingRequest(body))
 }
 
 func (s *ProdService) proxyWithConfig(c *fiber.Ctx, provider string) error {
-	config, exists := GetProviderConfig(provider)
+	config, exists := s.providerConfig(provider)
 	if !exists {
 		return response.InternalError(c, "Unknown provider")
 	}
 
-	apiKey := config.AuthExtractor(c)
-	if IsEmptyAPIKey(apiKey) {
-		return response.Unauthorized(c, "API key required")
+	apiKey, err := s.keys.Resolve(c, config.AuthExtractor(c), config.IntegrationService)
+	if err != nil {
+		return respondKeyError(c, err)
 	}
 
 	var body map[string]interface{}
@@ -99,21 +327,123 @@ func (s *ProdService) proxyWithConfig(c *fiber.Ctx, provider string) error {
 		return response.BadRequest(c, "Invalid request body")
 	}
 
-	req, err := BuildProxyRequest(ProxyRequest{
-		TargetURL:    config.URL,
-		APIKey:       apiKey,
-		Body:         body,
-		AuthHeader:   config.AuthHeaderName,
-		ExtraHeaders: config.ExtraHeaders,
-	})
-	if err != nil {
-		return response.InternalError(c, err.Error())
+	model, _ := body["model"].(string)
+	primary := route{
+		Target:  Target{Provider: config.IntegrationService, Model: model},
+		service: config.IntegrationService,
+		request: ProxyRequest{
+			TargetURL:    config.URL,
+			APIKey:       apiKey,
+			Body:         body,
+			AuthHeader:   config.AuthHeaderName,
+			ExtraHeaders: config.ExtraHeaders,
+		},
 	}
 
-	respBody, statusCode, err := ExecuteProxyRequest(s.httpClient, req)
-	if err != nil {
-		return response.InternalError(c, err.Error())
+	/* Key validation must hit the provider being installed, and embeddings from another model are incompatible */
+	var fallbacks func() []route
+	if !IsKeyValidation(c) && provider != "openai-embeddings" {
+		fallbacks = func() []route { return s.rawFallbacks(c, primary) }
+	}
+	return s.execute(c, primary, fallbacks, IsStreamingRequest(body))
+}
+
+/*
+rawFallbacks builds fallback routes for a raw provider body. Only providers sharing the
+primary's wire format qualify; translating across formats is what /llm/chat is for.
+*/
+func (s *ProdService) rawFallbacks(c *fiber.Ctx, primary route) []route {
+	var routes []route
+	for _, target := range s.router.policy.Fallbacks(primary.Target, s.keys.StoredFallbacks(c)) {
+		config, exists := s.providerConfig(target.Provider)
+		if !exists || wireFormats[target.Provider] != wireFormats[primary.Provider] {
+			continue
+		}
+		apiKey, err := s.keys.Stored(c, config.IntegrationService)
+		if err != nil {
+			continue
+		}
+
+		body := make(map[string]interface{}, len(primary.request.Body))
+		for key, value := range primary.request.Body {
+			body[key] = value
+		}
+		if target.Provider == "yandex" {
+			modelURI, err := yandexModelURI(target.Model, s.keys.StoredYandexFolder(c))
+			if err != nil {
+				continue
+			}
+			body["modelUri"] = modelURI
+		} else {
+			body["model"] = target.Model
+		}
+
+		routes = append(routes, route{
+			Target:  target,
+			service: config.IntegrationService,
+			request: ProxyRequest{
+				TargetURL:    config.URL,
+				APIKey:       apiKey,
+				Body:         body,
+				AuthHeader:   config.AuthHeaderName,
+				ExtraHeaders: config.ExtraHeaders,
+			},
+		})
+	}
+	return routes
+}
+
+/* execute sends a raw proxy request through the router and relays whatever upstream served it */
+func (s *ProdService) execute(c *fiber.Ctx, primary route, fallbacks func() []route, stream bool) error {
+	served, result, attempted := s.router.Do(c.Context(), primary, fallbacks, s.caller(stream))
+	if !attempted {
+		return s.respondUpstreamsUnavailable(c)
+	}
+	setServedHeaders(c, served.Target)
+	meter := newCallMeter(c, s.usage, served.service, served.request.Body)
+
+	if stream {
+		var transformer StreamTransformer
+		if streamUsageProvider(served.Provider) && !includesUsage(served.request.Body) {
+			transformer = &usageChunkFilter{}
+		}
+		if err := deliverStream(c, result, meter, transformer); err != nil {
+			return respondTransportError(c, err)
+		}
+		return nil
+	}
+
+	if result.err != nil {
+		return respondTransportError(c, result.err)
 	}
 
-	return SendProxyResponse(c, respBody, statusCode)
+	meter.Response(result.body, result.status)
+	return SendProxyResponse(c, result.body, result.status)
+}
+
+/* caller performs one upstream call for the router; streams are opened but not yet relayed */
+func (s *ProdService) caller(stream bool) func(route) upstreamResult {
+	return func(target route) upstreamResult {
+		if stream {
+			target.request.Body = withStreamUsage(target.Provider, target.request.Body)
+		}
+		req, err := BuildProxyRequest(target.request)
+		if err != nil {
+			return upstreamResult{err: err}
+		}
+		if stream {
+			return openStream(s.streamClient, req, StreamIdleTimeout)
+		}
+		return executeOnce(s.httpClient, req)
+	}
+}
+
+/* respondUpstreamsUnavailable answers when every candidate upstream's circuit is open */
+func (s *ProdService) respondUpstreamsUnavailable(c *fiber.Ctx) error {
+	retryAfter := int(s.router.resilience.BreakerCooldown.Seconds())
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+	c.Set(headerRetryAfter, strconv.Itoa(retryAfter))
+	return response.ServiceUnavailable(c, "LLM provider temporarily unavailable, try again later")
 }
@@ -32,11 +32,7 @@ func BuildProxyRequest(req ProxyRequest) (*nethttp.Request, error) {
 
 	httpReq.Header.Set(headerContentType, contentTypeJSON)
 
-	if req.AuthHeader == headerAuth {
-		httpReq.Header.Set(headerAuth, fmt.Sprintf("%s%s", bearerPrefix, req.APIKey))
-	} else {
-		httpReq.Header.Set(req.AuthHeader, req.APIKey)
-	}
+	setAuthHeader(httpReq, req.AuthHeader, req.APIKey)
 
 	for key, value := range req.ExtraHeaders {
 		httpReq.Header.Set(key, value)
@@ -45,6 +41,15 @@ func BuildProxyRequest(req ProxyRequest) (*nethttp.Request, error) {
 	return httpReq, nil
 }
 
+/* setAuthHeader sends the key as a bearer token or, for providers such as Claude, raw in their own header */
+func setAuthHeader(req *nethttp.Request, authHeader, apiKey string) {
+	if authHeader == headerAuth {
+		req.Header.Set(headerAuth, fmt.Sprintf("%s%s", bearerPrefix, apiKey))
+	} else {
+		req.Header.Set(authHeader, apiKey)
+	}
+}
+
 func ExecuteProxyRequest(client http.Client, req *nethttp.Request) ([]byte, int, error) {
 	resp, err := client.Do(req)
 	if err != nil {
@@ -65,3 +70,9 @@ func SendProxyResponse(c *fiber.Ctx, body []byte, statusCode int) error {
 	c.Set(headerContentType, contentTypeJSON)
 	return c.Send(body)
 }
+
+/* executeOnce runs ExecuteProxyRequest for the router */
+func executeOnce(client http.Client, req *nethttp.Request) upstreamResult {
+	body, status, err := ExecuteProxyRequest(client, req)
+	return upstreamResult{body: body, status: status, err: err}
+}
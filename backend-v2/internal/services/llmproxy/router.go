@@ -0,0 +1,235 @@
+package llmproxy
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"backend-v2/internal/common/http"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+/* Resilience tunes retries and circuit breaking of upstream calls */
+type Resilience struct {
+	/* Attempts per upstream, including the first call */
+	Attempts int
+	/* BaseDelay doubles per retry up to MaxDelay; the actual sleep is jittered below that */
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	/* BreakerFailures consecutive failures open an upstream's circuit for BreakerCooldown; 0 disables */
+	BreakerFailures int
+	BreakerCooldown time.Duration
+}
+
+func DefaultResilience() Resilience {
+	return Resilience{
+		Attempts:        2,
+		BaseDelay:       250 * time.Millisecond,
+		MaxDelay:        2 * time.Second,
+		BreakerFailures: 5,
+		BreakerCooldown: 30 * time.Second,
+	}
+}
+
+/*
+ParseResilience overrides DefaultResilience with a spec such as
+"attempts=3,backoff=200ms,maxBackoff=2s,breakerFailures=5,breakerCooldown=30s".
+*/
+func ParseResilience(spec string) (Resilience, error) {
+	resilience := DefaultResilience()
+
+	for _, field := range strings.Split(spec, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+
+		name, raw, ok := strings.Cut(field, "=")
+		if !ok {
+			return Resilience{}, fmt.Errorf("resilience field %q: expected name=value", field)
+		}
+
+		var err error
+		switch name {
+		case "attempts":
+			resilience.Attempts, err = strconv.Atoi(raw)
+			if err == nil && resilience.Attempts < 1 {
+				err = fmt.Errorf("must be at least 1")
+			}
+		case "breakerFailures":
+			resilience.BreakerFailures, err = strconv.Atoi(raw)
+		case "backoff":
+			resilience.BaseDelay, err = time.ParseDuration(raw)
+		case "maxBackoff":
+			resilience.MaxDelay, err = time.ParseDuration(raw)
+		case "breakerCooldown":
+			resilience.BreakerCooldown, err = time.ParseDuration(raw)
+		default:
+			return Resilience{}, fmt.Errorf("resilience field %q: unknown name %q", field, name)
+		}
+		if err != nil {
+			return Resilience{}, fmt.Errorf("resilience field %q: %v", field, err)
+		}
+	}
+
+	return resilience, nil
+}
+
+/* backoff returns a full-jitter delay before retry number attempt (1-based) */
+func (r Resilience) backoff(attempt int) time.Duration {
+	ceiling := r.BaseDelay << (attempt - 1)
+	if ceiling > r.MaxDelay || ceiling <= 0 {
+		ceiling = r.MaxDelay
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(ceiling) + 1))
+}
+
+/* route is one fully resolved upstream: where to send, with which key and body */
+type route struct {
+	Target
+	/* service is the integration service usage is metered under */
+	service string
+	request ProxyRequest
+	/* adapter translates unified chat requests; nil on raw proxy routes */
+	adapter chatAdapter
+}
+
+/* breakerKey scopes circuits by upstream host, so each custom LLM endpoint trips on its own */
+func (r route) breakerKey() string {
+	if parsed, err := url.Parse(r.request.TargetURL); err == nil && parsed.Host != "" {
+		return parsed.Host
+	}
+	return r.Provider
+}
+
+/* upstreamResult is the outcome of one upstream call: a buffered body, a live stream, or a transport error */
+type upstreamResult struct {
+	body   []byte
+	status int
+	err    error
+	stream *upstreamStream
+}
+
+/* retryable reports failures worth another attempt: transport errors, 429 and 5xx; a guard refusal is final */
+func (r upstreamResult) retryable() bool {
+	return (r.err != nil && !http.IsBlocked(r.err)) || r.status == fiber.StatusTooManyRequests || r.status >= 500
+}
+
+/* discard closes a stream the result will not be relayed from */
+func (r upstreamResult) discard() {
+	if r.stream != nil {
+		r.stream.close()
+	}
+}
+
+/* upstreamDown reports failures that count against the circuit; a 429 is the caller's key, not the upstream */
+func (r upstreamResult) upstreamDown() bool {
+	return (r.err != nil && !http.IsBlocked(r.err)) || r.status >= 500
+}
+
+/* Router runs upstream calls with jittered retries, per-upstream circuit breaking and fallback */
+type Router struct {
+	policy     RoutingPolicy
+	resilience Resilience
+	breaker    *CircuitBreaker
+	sleep      func(ctx context.Context, d time.Duration) error
+}
+
+func NewRouter(policy RoutingPolicy, resilience Resilience) *Router {
+	return &Router{
+		policy:     policy,
+		resilience: resilience,
+		breaker:    NewCircuitBreaker(resilience.BreakerFailures, resilience.BreakerCooldown),
+		sleep:      sleepContext,
+	}
+}
+
+/* directRouter makes exactly one call and never falls back */
+func directRouter() *Router {
+	return NewRouter(nil, Resilience{Attempts: 1})
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+/*
+Do calls primary, retrying transient failures, and then each fallback in order until one
+answers. fallbacks is only evaluated once primary has failed. It returns the route behind
+the final result; attempted is false when every circuit was open and nothing was sent.
+*/
+func (r *Router) Do(ctx context.Context, primary route, fallbacks func() []route, call func(route) upstreamResult) (served route, result upstreamResult, attempted bool) {
+	routes := []route{primary}
+	for i := 0; i < len(routes); i++ {
+		current := routes[i]
+		key := current.breakerKey()
+
+		if !r.breaker.Allow(key) {
+			log.Warn("circuit open for %s, skipping %s", key, current.Target)
+		} else {
+			/* A failed stream is only kept open while it may still be the final answer */
+			result.discard()
+			served, attempted = current, true
+			result = r.attempt(ctx, current, key, call)
+			if !result.retryable() || ctx.Err() != nil {
+				return served, result, true
+			}
+		}
+
+		if i == 0 && fallbacks != nil {
+			routes = append(routes, fallbacks()...)
+		}
+		if i+1 < len(routes) {
+			log.Warn("%s failed (status %d, err %v), falling back to %s", current.Target, result.status, result.err, routes[i+1].Target)
+		}
+	}
+	return served, result, attempted
+}
+
+/* attempt calls one route up to Attempts times, stopping early when its circuit opens */
+func (r *Router) attempt(ctx context.Context, current route, key string, call func(route) upstreamResult) upstreamResult {
+	var result upstreamResult
+	for attempt := 0; attempt < r.resilience.Attempts; attempt++ {
+		if attempt > 0 {
+			if err := r.sleep(ctx, r.resilience.backoff(attempt)); err != nil {
+				return result
+			}
+			result.discard()
+		}
+
+		result = call(current)
+		if result.upstreamDown() {
+			r.breaker.Failure(key)
+		} else {
+			r.breaker.Success(key)
+		}
+
+		if !result.retryable() || r.breaker.IsOpen(key) {
+			return result
+		}
+	}
+	return result
+}
+
+/* setServedHeaders reports the upstream that produced the response */
+func setServedHeaders(c *fiber.Ctx, target Target) {
+	c.Set(HeaderServedProvider, target.Provider)
+	if target.Model != "" {
+		c.Set(HeaderServedModel, target.Model)
+	}
+}
@@ -0,0 +1,286 @@
+package llmproxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	nethttp "net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"backend-v2/internal/common/constants"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestParseRoutingPolicy(t *testing.T) {
+	policy, err := ParseRoutingPolicy("openai:gpt-4o=claude:claude-sonnet-4, deepseek:deepseek-chat; openai=deepseek:deepseek-chat")
+	if err != nil {
+		t.Fatalf("ParseRoutingPolicy() error = %v", err)
+	}
+	if got := policy["openai:gpt-4o"]; len(got) != 2 || got[0] != (Target{Provider: "claude", Model: "claude-sonnet-4"}) {
+		t.Errorf("model rule = %v", got)
+	}
+
+	for _, spec := range []string{"openai", "openai=claude", "openai=nope:model", "=claude:x"} {
+		if _, err := ParseRoutingPolicy(spec); err == nil {
+			t.Errorf("ParseRoutingPolicy(%q) expected error", spec)
+		}
+	}
+}
+
+func TestRoutingPolicy_Fallbacks(t *testing.T) {
+	policy := RoutingPolicy{
+		"openai:gpt-4o": {{Provider: "claude", Model: "claude-sonnet-4"}},
+		"openai":        {{Provider: "deepseek", Model: "deepseek-chat"}, {Provider: "openai", Model: "gpt-4o-mini"}},
+	}
+
+	cases := []struct {
+		name    string
+		primary Target
+		user    []string
+		want    string
+	}{
+		{"model rule wins over provider rule", Target{"openai", "gpt-4o"}, nil, "claude:claude-sonnet-4"},
+		{"provider rule", Target{"openai", "gpt-4o-mini"}, nil, "deepseek:deepseek-chat"},
+		{"user list wins over server policy", Target{"openai", "gpt-4o"}, []string{"bogus", "deepseek:deepseek-chat", "deepseek:deepseek-chat"}, "deepseek:deepseek-chat"},
+		{"no rule", Target{"claude", "claude-sonnet-4"}, nil, ""},
+	}
+	for _, tc := range cases {
+		var names []string
+		for _, target := range policy.Fallbacks(tc.primary, tc.user) {
+			names = append(names, target.String())
+		}
+		if got := strings.Join(names, ","); got != tc.want {
+			t.Errorf("%s: Fallbacks() = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestParseResilience(t *testing.T) {
+	resilience, err := ParseResilience("attempts=3,backoff=100ms,breakerCooldown=1m")
+	if err != nil {
+		t.Fatalf("ParseResilience() error = %v", err)
+	}
+	if resilience.Attempts != 3 || resilience.BaseDelay != 100*time.Millisecond || resilience.BreakerCooldown != time.Minute {
+		t.Errorf("resilience = %+v", resilience)
+	}
+	if resilience.BreakerFailures != DefaultResilience().BreakerFailures {
+		t.Errorf("unspecified fields must keep defaults, got %+v", resilience)
+	}
+
+	for _, spec := range []string{"attempts=0", "backoff=soon", "retries=2", "attempts"} {
+		if _, err := ParseResilience(spec); err == nil {
+			t.Errorf("ParseResilience(%q) expected error", spec)
+		}
+	}
+
+	for attempt := 1; attempt <= 6; attempt++ {
+		if delay := resilience.backoff(attempt); delay < 0 || delay > resilience.MaxDelay {
+			t.Errorf("backoff(%d) = %v, want within [0, %v]", attempt, delay, resilience.MaxDelay)
+		}
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Unix(0, 0)
+	breaker := NewCircuitBreaker(2, time.Minute)
+	breaker.now = func() time.Time { return now }
+
+	breaker.Failure("api")
+	if !breaker.Allow("api") {
+		t.Fatal("one failure must not open the circuit")
+	}
+	breaker.Failure("api")
+	if breaker.Allow("api") || !breaker.IsOpen("api") {
+		t.Fatal("circuit should be open after reaching the threshold")
+	}
+	if !breaker.Allow("other") {
+		t.Fatal("circuits are per key")
+	}
+
+	now = now.Add(time.Minute)
+	if !breaker.Allow("api") {
+		t.Fatal("half-open circuit should let one probe through")
+	}
+	if breaker.Allow("api") {
+		t.Fatal("only one probe at a time")
+	}
+	breaker.Failure("api")
+	if breaker.Allow("api") {
+		t.Fatal("failed probe should re-open the circuit")
+	}
+
+	now = now.Add(time.Minute)
+	breaker.Allow("api")
+	breaker.Success("api")
+	if !breaker.Allow("api") || breaker.IsOpen("api") {
+		t.Fatal("successful probe should close the circuit")
+	}
+}
+
+func testRouter(policy RoutingPolicy, resilience Resilience) *Router {
+	router := NewRouter(policy, resilience)
+	router.sleep = func(context.Context, time.Duration) error { return nil }
+	return router
+}
+
+func testRoute(provider, url string) route {
+	return route{Target: Target{Provider: provider, Model: "m"}, request: ProxyRequest{TargetURL: url}}
+}
+
+func TestRouter_RetriesThenFallsBack(t *testing.T) {
+	router := testRouter(nil, Resilience{Attempts: 2, BreakerFailures: 10, BreakerCooldown: time.Minute})
+
+	var calls []string
+	served, result, attempted := router.Do(context.Background(), testRoute("openai", "https://api.openai.com/v1"),
+		func() []route {
+			return []route{testRoute("deepseek", "https://api.deepseek.com"), testRoute("claude", "https://api.anthropic.com")}
+		},
+		func(r route) upstreamResult {
+			calls = append(calls, r.Provider)
+			switch r.Provider {
+			case "openai":
+				return upstreamResult{status: 503}
+			case "deepseek":
+				return upstreamResult{err: errors.New("connection refused")}
+			}
+			return upstreamResult{status: 200, body: []byte("ok")}
+		})
+
+	if !attempted || served.Provider != "claude" || result.status != 200 {
+		t.Fatalf("served %s with %+v", served.Provider, result)
+	}
+	if got := strings.Join(calls, ","); got != "openai,openai,deepseek,deepseek,claude" {
+		t.Errorf("calls = %s", got)
+	}
+}
+
+func TestRouter_ClosesStreamsItMovesPast(t *testing.T) {
+	router := testRouter(nil, Resilience{Attempts: 2, BreakerFailures: 10, BreakerCooldown: time.Minute})
+
+	var streams []*closeCounter
+	failing := func(route) upstreamResult {
+		body := &closeCounter{}
+		streams = append(streams, body)
+		stream := &upstreamStream{resp: &nethttp.Response{Body: body}, cancel: func() {}, timer: time.NewTimer(time.Minute)}
+		return upstreamResult{status: 503, stream: stream}
+	}
+	_, result, _ := router.Do(context.Background(), testRoute("openai", "https://api.openai.com"),
+		func() []route { return []route{testRoute("deepseek", "https://api.deepseek.com")} }, failing)
+
+	if len(streams) != 4 || result.stream == nil {
+		t.Fatalf("calls = %d, final stream = %v", len(streams), result.stream)
+	}
+	for i, stream := range streams[:3] {
+		if stream.closed != 1 {
+			t.Errorf("stream %d closed %d times, want once before the next call", i, stream.closed)
+		}
+	}
+	if streams[3].closed != 0 {
+		t.Error("the final stream must stay open for the caller to relay")
+	}
+}
+
+/* closeCounter is an upstream body that counts Close calls */
+type closeCounter struct {
+	io.Reader
+	closed int
+}
+
+func (c *closeCounter) Close() error {
+	c.closed++
+	return nil
+}
+
+func TestRouter_ClientErrorsAreFinal(t *testing.T) {
+	router := testRouter(nil, Resilience{Attempts: 3})
+
+	calls := 0
+	fallbacksEvaluated := false
+	served, result, _ := router.Do(context.Background(), testRoute("openai", "https://api.openai.com"),
+		func() []route { fallbacksEvaluated = true; return nil },
+		func(route) upstreamResult { calls++; return upstreamResult{status: 400} })
+
+	if calls != 1 || fallbacksEvaluated || served.Provider != "openai" || result.status != 400 {
+		t.Errorf("calls = %d, fallbacks evaluated = %t, result = %+v", calls, fallbacksEvaluated, result)
+	}
+}
+
+func TestRouter_OpenCircuitFailsFast(t *testing.T) {
+	router := testRouter(nil, Resilience{Attempts: 3, BreakerFailures: 2, BreakerCooldown: time.Minute})
+
+	calls := 0
+	failing := func(route) upstreamResult { calls++; return upstreamResult{status: 502} }
+
+	router.Do(context.Background(), testRoute("openai", "https://api.openai.com"), nil, failing)
+	if calls != 2 {
+		t.Fatalf("retries should stop once the circuit opens, calls = %d", calls)
+	}
+
+	_, _, attempted := router.Do(context.Background(), testRoute("openai", "https://api.openai.com"), nil, failing)
+	if attempted || calls != 2 {
+		t.Errorf("open circuit must not send requests, attempted = %t, calls = %d", attempted, calls)
+	}
+}
+
+func TestProdService_RetriesTransientUpstream(t *testing.T) {
+	var hits int32
+	upstream := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		if atomic.AddInt32(&hits, 1) == 1 {
+			w.WriteHeader(nethttp.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"choices":[{"message":{"content":"ok"}}]}`))
+	}))
+	defer upstream.Close()
+
+	router := testRouter(nil, Resilience{Attempts: 2})
+	service := NewProdService(NewKeyResolver(&customLLMProvider{url: upstream.URL}, KeyModeClient), nil, router, nil)
+	app := fiber.New()
+	app.Post("/custom", func(c *fiber.Ctx) error {
+		c.Locals(constants.ContextUserIDKey, "user-1")
+		return service.CustomLLMChatCompletions(c)
+	})
+
+	req := httptest.NewRequest("POST", "/custom", strings.NewReader(`{"model":"llama3","messages":[]}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("Test request failed: %v", err)
+	}
+
+	if resp.StatusCode != fiber.StatusOK || atomic.LoadInt32(&hits) != 2 {
+		t.Fatalf("status = %d after %d upstream hits, want 200 after 2", resp.StatusCode, hits)
+	}
+	if resp.Header.Get(HeaderServedProvider) != "custom_llm" || resp.Header.Get(HeaderServedModel) != "llama3" {
+		t.Errorf("served headers = %q/%q", resp.Header.Get(HeaderServedProvider), resp.Header.Get(HeaderServedModel))
+	}
+}
+
+func TestProdService_BlockedUpstreamIsFinal(t *testing.T) {
+	router := testRouter(nil, Resilience{Attempts: 3, BreakerFailures: 1, BreakerCooldown: time.Minute})
+	service := NewProdService(NewKeyResolver(&customLLMProvider{url: "http://169.254.169.254/latest/meta-data"}, KeyModeClient), nil, router, nil)
+	app := fiber.New()
+	app.Post("/custom", func(c *fiber.Ctx) error {
+		c.Locals(constants.ContextUserIDKey, "user-1")
+		return service.CustomLLMChatCompletions(c)
+	})
+
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest("POST", "/custom", strings.NewReader(`{"model":"llama3","messages":[]}`))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatalf("Test request failed: %v", err)
+		}
+		/* A refusal must not open the circuit, so the second call is refused the same way instead of a 503 */
+		if resp.StatusCode != fiber.StatusBadRequest {
+			t.Fatalf("call %d: status = %d, want 400", i+1, resp.StatusCode)
+		}
+	}
+}
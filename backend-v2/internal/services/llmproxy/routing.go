@@ -0,0 +1,115 @@
+package llmproxy
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	/* HeaderServedProvider and HeaderServedModel tell the caller which upstream actually answered */
+	HeaderServedProvider = "X-LLM-Provider"
+	HeaderServedModel    = "X-LLM-Model"
+)
+
+/* Target names an upstream provider and the model to ask it for */
+type Target struct {
+	Provider string
+	Model    string
+}
+
+func (t Target) String() string {
+	if t.Model == "" {
+		return t.Provider
+	}
+	return t.Provider + ":" + t.Model
+}
+
+/* ParseTarget reads "provider:model"; the model may itself contain colons */
+func ParseTarget(spec string) (Target, error) {
+	provider, model, _ := strings.Cut(strings.TrimSpace(spec), ":")
+	if _, ok := chatAdapters[provider]; !ok {
+		return Target{}, fmt.Errorf("fallback %q: unknown provider %q", spec, provider)
+	}
+	if model == "" {
+		return Target{}, fmt.Errorf("fallback %q: expected provider:model", spec)
+	}
+	return Target{Provider: provider, Model: model}, nil
+}
+
+/* RoutingPolicy maps a primary "provider" or "provider:model" to the ordered targets tried after it fails */
+type RoutingPolicy map[string][]Target
+
+/*
+ParseRoutingPolicy reads a spec such as
+"openai:gpt-4o=claude:claude-sonnet-4,deepseek:deepseek-chat;perplexity=openai:gpt-4o-mini".
+A provider:model key takes precedence over a bare provider key.
+*/
+func ParseRoutingPolicy(spec string) (RoutingPolicy, error) {
+	policy := RoutingPolicy{}
+
+	for _, entry := range strings.Split(spec, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		primary, chain, ok := strings.Cut(entry, "=")
+		primary = strings.TrimSpace(primary)
+		if !ok || primary == "" {
+			return nil, fmt.Errorf("routing entry %q: expected primary=fallback,...", entry)
+		}
+
+		for _, spec := range strings.Split(chain, ",") {
+			target, err := ParseTarget(spec)
+			if err != nil {
+				return nil, fmt.Errorf("routing entry %q: %w", entry, err)
+			}
+			policy[primary] = append(policy[primary], target)
+		}
+	}
+
+	return policy, nil
+}
+
+/*
+Fallbacks returns the targets to try after primary. The user's own list wins over
+the server policy; entries that repeat primary or each other are dropped.
+*/
+func (p RoutingPolicy) Fallbacks(primary Target, userFallbacks []string) []Target {
+	var chain []Target
+	for _, spec := range userFallbacks {
+		/* Stored lists are validated on write; anything unparsable is stale and ignored */
+		if target, err := ParseTarget(spec); err == nil {
+			chain = append(chain, target)
+		}
+	}
+	if len(chain) == 0 {
+		chain = p[primary.String()]
+	}
+	if len(chain) == 0 {
+		chain = p[primary.Provider]
+	}
+
+	seen := map[Target]bool{primary: true}
+	result := make([]Target, 0, len(chain))
+	for _, target := range chain {
+		if seen[target] {
+			continue
+		}
+		seen[target] = true
+		result = append(result, target)
+	}
+	return result
+}
+
+/* wireFormats groups providers that accept the same raw request body; raw routes only fall back within a group */
+var wireFormats = map[string]string{
+	"openai":     "openai",
+	"deepseek":   "openai",
+	"perplexity": "openai",
+	"qwen":       "openai",
+	"custom_llm": "openai",
+	"local":      "openai",
+	"claude":     "claude",
+	"yandex":     "yandex",
+}
@@ -22,7 +22,18 @@ type Service interface {
 	/* DeepSeek endpoints */
 	DeepSeekChatCompletions(c *fiber.Ctx) error
 
+	/* Qwen (DashScope) endpoints */
+	QwenChatCompletions(c *fiber.Ctx) error
+
 	/* Custom LLM endpoints */
 	CustomLLMChatCompletions(c *fiber.Ctx) error
 	CustomLLMEmbeddings(c *fiber.Ctx) error
+
+	/* Local OpenAI-compatible server (Ollama, vLLM) endpoints */
+	LocalChatCompletions(c *fiber.Ctx) error
+	LocalEmbeddings(c *fiber.Ctx) error
+	LocalModels(c *fiber.Ctx) error
+
+	/* Unified endpoint: one request/response shape translated to any chat provider */
+	Chat(c *fiber.Ctx) error
 }
@@ -0,0 +1,186 @@
+package llmproxy
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	nethttp "net/http"
+	"strings"
+	"time"
+
+	"backend-v2/internal/common/http"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	headerAccept           = "Accept"
+	contentTypeEventStream = "text/event-stream"
+
+	/* StreamIdleTimeout aborts a stream when upstream sends nothing for this long */
+	StreamIdleTimeout = 90 * time.Second
+)
+
+/* IsStreamingRequest reports whether the client asked the provider for an SSE stream */
+func IsStreamingRequest(body map[string]interface{}) bool {
+	stream, ok := body["stream"].(bool)
+	return ok && stream
+}
+
+/* idleTimeoutReader cancels the upstream request when no bytes arrive within timeout */
+type idleTimeoutReader struct {
+	reader  io.Reader
+	timer   *time.Timer
+	timeout time.Duration
+}
+
+func (r *idleTimeoutReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if n > 0 {
+		r.timer.Reset(r.timeout)
+	}
+	return n, err
+}
+
+/* StreamObserver sees every relayed SSE line; Close runs once when the stream ends */
+type StreamObserver interface {
+	Observe(line []byte)
+	Close(statusCode int)
+}
+
+/* StreamTransformer rewrites upstream SSE lines into another event format */
+type StreamTransformer interface {
+	/* Transform returns the bytes to send for one upstream line; nil sends nothing */
+	Transform(line []byte) []byte
+	/* Finish returns trailing bytes written after upstream ends */
+	Finish() []byte
+	/* Fallback answers a non-SSE upstream response (typically a provider error) */
+	Fallback(c *fiber.Ctx, body []byte, statusCode int) error
+}
+
+/* ExecuteStreamingRequest relays upstream SSE chunks to the client as they arrive.
+ * The upstream request is cancelled when the client disconnects or the stream goes idle.
+ * Non-SSE upstream responses (typically provider errors) are relayed as a regular body.
+ * observer may be nil. */
+func ExecuteStreamingRequest(c *fiber.Ctx, client http.Client, req *nethttp.Request, idleTimeout time.Duration, observer StreamObserver) error {
+	return deliverStream(c, openStream(client, req, idleTimeout), observer, nil)
+}
+
+/* upstreamStream is an opened upstream SSE response waiting to be relayed */
+type upstreamStream struct {
+	resp    *nethttp.Response
+	cancel  context.CancelFunc
+	timer   *time.Timer
+	timeout time.Duration
+}
+
+/* close releases the upstream response and its connection */
+func (s *upstreamStream) close() {
+	s.timer.Stop()
+	s.resp.Body.Close()
+	s.cancel()
+}
+
+/* openStream sends req and returns the live SSE stream, or the fully read body when upstream answered without SSE */
+func openStream(client http.Client, req *nethttp.Request, idleTimeout time.Duration) upstreamResult {
+	ctx, cancel := context.WithCancel(context.Background())
+	timer := time.AfterFunc(idleTimeout, cancel)
+
+	req = req.WithContext(ctx)
+	req.Header.Set(headerAccept, contentTypeEventStream)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		timer.Stop()
+		cancel()
+		return upstreamResult{err: fmt.Errorf("execute request: %w", err)}
+	}
+
+	if !strings.HasPrefix(resp.Header.Get(headerContentType), contentTypeEventStream) {
+		defer timer.Stop()
+		defer cancel()
+
+		body, status, err := http.NewResponseReader().ReadWithStatus(resp)
+		if err != nil {
+			return upstreamResult{status: status, err: fmt.Errorf("read response: %w", err)}
+		}
+		return upstreamResult{body: body, status: status}
+	}
+
+	return upstreamResult{
+		status: resp.StatusCode,
+		stream: &upstreamStream{resp: resp, cancel: cancel, timer: timer, timeout: idleTimeout},
+	}
+}
+
+/* deliverStream relays an opened stream, or answers with the buffered non-SSE response */
+func deliverStream(c *fiber.Ctx, result upstreamResult, observer StreamObserver, transformer StreamTransformer) error {
+	if result.err != nil {
+		return result.err
+	}
+	if result.stream == nil {
+		if transformer != nil {
+			return transformer.Fallback(c, result.body, result.status)
+		}
+		return SendProxyResponse(c, result.body, result.status)
+	}
+	result.stream.relay(c, observer, transformer)
+	return nil
+}
+
+func (s *upstreamStream) relay(c *fiber.Ctx, observer StreamObserver, transformer StreamTransformer) {
+	c.Status(s.resp.StatusCode)
+	c.Set(headerContentType, contentTypeEventStream)
+	c.Set("Cache-Control", "no-cache")
+	c.Set("Connection", "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer s.close()
+		if observer != nil {
+			defer observer.Close(s.resp.StatusCode)
+		}
+
+		reader := bufio.NewReader(&idleTimeoutReader{reader: s.resp.Body, timer: s.timer, timeout: s.timeout})
+		for {
+			line, readErr := reader.ReadBytes('\n')
+			if len(line) > 0 {
+				if observer != nil {
+					observer.Observe(line)
+				}
+				if !writeFlush(w, line, transformer) {
+					return
+				}
+			}
+			if readErr != nil {
+				if transformer != nil {
+					writeRaw(w, transformer.Finish())
+				}
+				return
+			}
+		}
+	})
+}
+
+/* writeFlush sends one line (transformed if needed); false means the client has gone away */
+func writeFlush(w *bufio.Writer, line []byte, transformer StreamTransformer) bool {
+	if transformer != nil {
+		line = transformer.Transform(line)
+		if len(line) == 0 {
+			return true
+		}
+	}
+	return writeRaw(w, line)
+}
+
+func writeRaw(w *bufio.Writer, data []byte) bool {
+	if len(data) == 0 {
+		return true
+	}
+	if _, err := w.Write(data); err != nil {
+		return false
+	}
+	/* Flush fails once the client has gone away, which cancels upstream via defer */
+	return w.Flush() == nil
+}
@@ -0,0 +1,191 @@
+package llmproxy
+
+import (
+	"io"
+	nethttp "net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"backend-v2/internal/common/http"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestIsStreamingRequest(t *testing.T) {
+	tests := []struct {
+		name string
+		body map[string]interface{}
+		want bool
+	}{
+		{"stream true", map[string]interface{}{"stream": true}, true},
+		{"stream false", map[string]interface{}{"stream": false}, false},
+		{"stream missing", map[string]interface{}{"model": "gpt-4"}, false},
+		{"stream as string", map[string]interface{}{"stream": "true"}, false},
+		{"nil body", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsStreamingRequest(tt.body); got != tt.want {
+				t.Errorf("IsStreamingRequest() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func newStreamApp(client http.Client, upstreamURL string, idle time.Duration) *fiber.App {
+	app := fiber.New()
+	app.Post("/stream", func(c *fiber.Ctx) error {
+		req, err := nethttp.NewRequest("POST", upstreamURL, strings.NewReader(`{"stream":true}`))
+		if err != nil {
+			return err
+		}
+		if err := ExecuteStreamingRequest(c, client, req, idle, nil); err != nil {
+			return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+		}
+		return nil
+	})
+	return app
+}
+
+func TestExecuteStreamingRequest_RelaysEvents(t *testing.T) {
+	var receivedAccept string
+	upstream := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		receivedAccept = r.Header.Get("Accept")
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(nethttp.StatusOK)
+		flusher := w.(nethttp.Flusher)
+		for _, chunk := range []string{"Hel", "lo"} {
+			_, _ = w.Write([]byte(`data: {"choices":[{"delta":{"content":"` + chunk + `"}}]}` + "\n\n"))
+			flusher.Flush()
+		}
+		_, _ = w.Write([]byte("data: [DONE]\n\n"))
+	}))
+	defer upstream.Close()
+
+	app := newStreamApp(http.NewClientFactory().Create(0), upstream.URL, time.Second)
+
+	resp, err := app.Test(httptest.NewRequest("POST", "/stream", nil), 2000)
+	if err != nil {
+		t.Fatalf("Test request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if receivedAccept != "text/event-stream" {
+		t.Errorf("upstream Accept = %q, want text/event-stream", receivedAccept)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Content-Type = %q, want text/event-stream", ct)
+	}
+	if cc := resp.Header.Get("Cache-Control"); cc != "no-cache" {
+		t.Errorf("Cache-Control = %q, want no-cache", cc)
+	}
+
+	body, _ := io.ReadAll(resp.Body)
+	if strings.Count(string(body), "data: ") != 3 {
+		t.Errorf("expected 3 SSE events, got body %q", body)
+	}
+	if !strings.HasSuffix(string(body), "data: [DONE]\n\n") {
+		t.Errorf("stream should end with [DONE], got %q", body)
+	}
+}
+
+func TestExecuteStreamingRequest_RelaysNonStreamErrors(t *testing.T) {
+	upstream := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(nethttp.StatusUnauthorized)
+		_, _ = w.Write([]byte(`{"error":{"message":"invalid api key"}}`))
+	}))
+	defer upstream.Close()
+
+	app := newStreamApp(http.NewClientFactory().Create(0), upstream.URL, time.Second)
+
+	resp, err := app.Test(httptest.NewRequest("POST", "/stream", nil), 2000)
+	if err != nil {
+		t.Fatalf("Test request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != nethttp.StatusUnauthorized {
+		t.Errorf("Status = %d, want 401", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", ct)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if !strings.Contains(string(body), "invalid api key") {
+		t.Errorf("body = %q, want upstream error", body)
+	}
+}
+
+func TestExecuteStreamingRequest_IdleTimeoutEndsStream(t *testing.T) {
+	release := make(chan struct{})
+	upstream := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(nethttp.StatusOK)
+		_, _ = w.Write([]byte("data: first\n\n"))
+		w.(nethttp.Flusher).Flush()
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer upstream.Close()
+	defer close(release)
+
+	app := newStreamApp(http.NewClientFactory().Create(0), upstream.URL, 100*time.Millisecond)
+
+	start := time.Now()
+	resp, err := app.Test(httptest.NewRequest("POST", "/stream", nil), 3000)
+	if err != nil {
+		t.Fatalf("Test request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if !strings.Contains(string(body), "data: first") {
+		t.Errorf("body = %q, want first event before idle timeout", body)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("stream took %v, idle timeout should have ended it", elapsed)
+	}
+}
+
+func TestExecuteStreamingRequest_UpstreamUnavailable(t *testing.T) {
+	app := newStreamApp(http.NewClientFactory().Create(time.Second), "http://127.0.0.1:1", time.Second)
+
+	resp, err := app.Test(httptest.NewRequest("POST", "/stream", nil), 2000)
+	if err != nil {
+		t.Fatalf("Test request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != fiber.StatusInternalServerError {
+		t.Errorf("Status = %d, want 500", resp.StatusCode)
+	}
+}
+
+func TestNoopService_StreamsWhenRequested(t *testing.T) {
+	app := fiber.New()
+	service := NewNoopService()
+	app.Post("/chat", service.ChatCompletions)
+
+	req := httptest.NewRequest("POST", "/chat", strings.NewReader(`{"model":"gpt-4o","stream":true}`))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("Test request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Content-Type = %q, want text/event-stream", ct)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if !strings.HasSuffix(string(body), "data: [DONE]\n\n") {
+		t.Errorf("mock stream should end with [DONE], got %q", body)
+	}
+}
@@ -0,0 +1,87 @@
+package llmproxy
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+/* streamUsageProvider reports whether provider accepts stream_options.include_usage */
+func streamUsageProvider(provider string) bool {
+	adapter, ok := chatAdapters[provider].(openAIChatAdapter)
+	return ok && adapter.streamUsage
+}
+
+/* includesUsage reports whether a streamed body already asks for the final usage chunk */
+func includesUsage(body map[string]interface{}) bool {
+	options, _ := body["stream_options"].(map[string]interface{})
+	include, _ := options["include_usage"].(bool)
+	return include
+}
+
+/*
+withStreamUsage asks an OpenAI-compatible provider to end a stream with its usage, which
+streamed calls are otherwise metered without. The body is copied, not changed, since
+fallback routes are built from it.
+*/
+func withStreamUsage(provider string, body map[string]interface{}) map[string]interface{} {
+	if !IsStreamingRequest(body) || !streamUsageProvider(provider) || includesUsage(body) {
+		return body
+	}
+
+	options := map[string]interface{}{}
+	if existing, ok := body["stream_options"].(map[string]interface{}); ok {
+		for key, value := range existing {
+			options[key] = value
+		}
+	}
+	options["include_usage"] = true
+
+	copied := make(map[string]interface{}, len(body)+1)
+	for key, value := range body {
+		copied[key] = value
+	}
+	copied["stream_options"] = options
+	return copied
+}
+
+/*
+usageChunkFilter hides the usage chunk withStreamUsage asked for from clients that did not,
+since it has no choices and would surprise them. The meter still sees it.
+*/
+type usageChunkFilter struct {
+	dropped bool
+}
+
+func (f *usageChunkFilter) Transform(line []byte) []byte {
+	trimmed := bytes.TrimSpace(line)
+	if f.dropped && len(trimmed) == 0 {
+		/* The blank line ending the dropped event goes with it */
+		f.dropped = false
+		return nil
+	}
+	f.dropped = false
+
+	if payload, ok := bytes.CutPrefix(trimmed, []byte("data:")); ok {
+		var chunk struct {
+			Choices []json.RawMessage `json:"choices"`
+			Usage   json.RawMessage   `json:"usage"`
+		}
+		payload = bytes.TrimSpace(payload)
+		if len(payload) > 0 && payload[0] == '{' && json.Unmarshal(payload, &chunk) == nil &&
+			len(chunk.Choices) == 0 && len(chunk.Usage) > 0 && string(chunk.Usage) != "null" {
+			f.dropped = true
+			return nil
+		}
+	}
+	return line
+}
+
+func (f *usageChunkFilter) Finish() []byte {
+	return nil
+}
+
+func (f *usageChunkFilter) Fallback(c *fiber.Ctx, body []byte, statusCode int) error {
+	return SendProxyResponse(c, body, statusCode)
+}
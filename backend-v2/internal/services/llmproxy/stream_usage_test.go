@@ -0,0 +1,82 @@
+package llmproxy
+
+import (
+	"encoding/json"
+	"io"
+	nethttp "net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"backend-v2/internal/common/constants"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestWithStreamUsage(t *testing.T) {
+	body := map[string]interface{}{"model": "gpt-4o", "stream": true, "stream_options": map[string]interface{}{"other": 1}}
+
+	got := withStreamUsage("openai", body)
+	if !includesUsage(got) || got["stream_options"].(map[string]interface{})["other"] != 1 {
+		t.Errorf("withStreamUsage() = %v, want include_usage alongside the caller's options", got)
+	}
+	if includesUsage(body) {
+		t.Errorf("withStreamUsage() changed the caller's body")
+	}
+
+	for _, unchanged := range []struct {
+		provider string
+		body     map[string]interface{}
+	}{
+		{"openai", map[string]interface{}{"model": "gpt-4o"}},
+		{"claude", map[string]interface{}{"stream": true}},
+		{"custom_llm", map[string]interface{}{"stream": true}},
+	} {
+		if got := withStreamUsage(unchanged.provider, unchanged.body); includesUsage(got) {
+			t.Errorf("withStreamUsage(%q, %v) asked for usage", unchanged.provider, unchanged.body)
+		}
+	}
+}
+
+func TestProdService_MetersRawStreams(t *testing.T) {
+	var upstreamBody map[string]interface{}
+	upstream := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&upstreamBody)
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = w.Write([]byte(`data: {"model":"gpt-4o","choices":[{"delta":{"content":"Hi"}}]}` + "\n\n"))
+		if includesUsage(upstreamBody) {
+			_, _ = w.Write([]byte(`data: {"model":"gpt-4o","choices":[],"usage":{"prompt_tokens":3,"completion_tokens":4,"total_tokens":7}}` + "\n\n"))
+		}
+		_, _ = w.Write([]byte("data: [DONE]\n\n"))
+	}))
+	defer upstream.Close()
+
+	records := make(chanRecorder, 1)
+	service := NewProdService(NewKeyResolver(nil, KeyModeClient), records, nil, nil).(*ProdService)
+	openai := service.providers["openai"]
+	openai.URL = upstream.URL
+	service.providers = map[string]ProviderConfig{"openai": openai}
+
+	app := fiber.New()
+	app.Post("/openai", func(c *fiber.Ctx) error {
+		c.Locals(constants.ContextUserIDKey, "user-1")
+		return service.ChatCompletions(c)
+	})
+
+	req := httptest.NewRequest("POST", "/openai", strings.NewReader(`{"model":"gpt-4o","stream":true,"messages":[]}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer sk-test")
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("Test request failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if record := waitRecord(t, records); record.Tokens.Total != 7 {
+		t.Errorf("recorded %+v, want the streamed usage", record)
+	}
+	if strings.Contains(string(body), "usage") || !strings.Contains(string(body), "Hi") || !strings.HasSuffix(string(body), "data: [DONE]\n\n") {
+		t.Errorf("client stream = %q, want the content without the usage chunk it did not ask for", body)
+	}
+}
@@ -0,0 +1,62 @@
+package ratelimit
+
+import "time"
+
+/*
+Rate is a requests-per-minute limit with a burst allowance, enforced with GCRA
+(generic cell rate algorithm): each key stores only its theoretical arrival time (TAT).
+A client may send Burst requests above the steady rate at once, then one every Interval.
+*/
+type Rate struct {
+	PerMinute int
+	Burst     int
+}
+
+/* Decision is the outcome of taking one request from a rate */
+type Decision struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	RetryAfter time.Duration
+}
+
+/* Interval is the steady-state spacing between requests */
+func (r Rate) Interval() time.Duration {
+	return time.Minute / time.Duration(r.PerMinute)
+}
+
+func (r Rate) tolerance() time.Duration {
+	return r.Interval() * time.Duration(r.Burst)
+}
+
+/* take applies one request at now against the stored TAT and returns the new TAT to persist */
+func (r Rate) take(storedTAT, now time.Time) (time.Time, Decision) {
+	interval, tolerance := r.Interval(), r.tolerance()
+
+	tat := storedTAT
+	if tat.Before(now) {
+		tat = now
+	}
+	newTAT := tat.Add(interval)
+	allowAt := newTAT.Add(-interval - tolerance)
+
+	if now.Before(allowAt) {
+		return storedTAT, Decision{
+			Allowed:    false,
+			Limit:      r.PerMinute,
+			Remaining:  0,
+			RetryAfter: allowAt.Sub(now),
+		}
+	}
+
+	return newTAT, Decision{
+		Allowed:   true,
+		Limit:     r.PerMinute,
+		Remaining: int(now.Sub(allowAt) / interval),
+	}
+}
+
+/* expiry is when a stored TAT no longer affects any decision and may be dropped */
+func (r Rate) expiry(tat time.Time) time.Time {
+	return tat.Add(r.tolerance())
+}
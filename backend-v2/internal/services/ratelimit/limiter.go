@@ -0,0 +1,139 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"backend-v2/internal/services/usage"
+)
+
+/* Unlimited is reported as the remaining quota of limits that are not set */
+const Unlimited int64 = -1
+
+const (
+	ReasonRate          = "rate"
+	ReasonDailyTokens   = "tokens_day"
+	ReasonMonthlyTokens = "tokens_month"
+)
+
+/* Result describes the caller's quota after a Check */
+type Result struct {
+	Allowed    bool
+	Reason     string
+	RetryAfter time.Duration
+
+	Limits               Limits
+	RequestsRemaining    int
+	TokensRemainingDay   int64
+	TokensRemainingMonth int64
+}
+
+/* Limiter enforces a Policy: request rate through Store, token quotas from recorded usage */
+type Limiter struct {
+	store  Store
+	usage  usage.Store
+	policy Policy
+	now    func() time.Time
+}
+
+func NewLimiter(store Store, usageStore usage.Store, policy Policy) *Limiter {
+	return &Limiter{store: store, usage: usageStore, policy: policy, now: time.Now}
+}
+
+/*
+Check admits one LLM call for the user. Token quotas are checked first so a user who has
+exhausted them does not also burn request-rate allowance.
+*/
+func (l *Limiter) Check(ctx context.Context, userID string, roles []string) (Result, error) {
+	limits := l.policy.For(roles)
+	result := Result{
+		Allowed:              true,
+		Limits:               limits,
+		RequestsRemaining:    int(Unlimited),
+		TokensRemainingDay:   Unlimited,
+		TokensRemainingMonth: Unlimited,
+	}
+	if limits.Unlimited() {
+		return result, nil
+	}
+
+	now := l.now().UTC()
+
+	if limits.TokensPerDay > 0 || limits.TokensPerMonth > 0 {
+		usedDay, usedMonth, err := l.tokensUsed(ctx, userID, now)
+		if err != nil {
+			return result, err
+		}
+
+		if limits.TokensPerDay > 0 {
+			result.TokensRemainingDay = remaining(limits.TokensPerDay, usedDay)
+		}
+		if limits.TokensPerMonth > 0 {
+			result.TokensRemainingMonth = remaining(limits.TokensPerMonth, usedMonth)
+		}
+
+		if result.TokensRemainingMonth == 0 {
+			return deny(result, ReasonMonthlyTokens, startOfNextMonth(now).Sub(now)), nil
+		}
+		if result.TokensRemainingDay == 0 {
+			return deny(result, ReasonDailyTokens, startOfNextDay(now).Sub(now)), nil
+		}
+	}
+
+	if limits.RequestsPerMinute > 0 {
+		decision, err := l.store.Take(ctx, "llm:"+userID, now, Rate{PerMinute: limits.RequestsPerMinute, Burst: limits.Burst})
+		if err != nil {
+			return result, err
+		}
+		result.RequestsRemaining = decision.Remaining
+		if !decision.Allowed {
+			return deny(result, ReasonRate, decision.RetryAfter), nil
+		}
+	}
+
+	return result, nil
+}
+
+/* tokensUsed sums today's and this month's recorded tokens with one query */
+func (l *Limiter) tokensUsed(ctx context.Context, userID string, now time.Time) (int64, int64, error) {
+	today := now.Format(usage.DayFormat)
+	daily, err := l.usage.Totals(ctx, usage.Filter{
+		UserID: userID,
+		From:   time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC).Format(usage.DayFormat),
+		To:     today,
+	}, "day")
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var day, month int64
+	for _, total := range daily {
+		month += total.TotalTokens
+		if total.Key == today {
+			day = total.TotalTokens
+		}
+	}
+	return day, month, nil
+}
+
+func deny(result Result, reason string, retryAfter time.Duration) Result {
+	result.Allowed = false
+	result.Reason = reason
+	result.RetryAfter = retryAfter
+	return result
+}
+
+func remaining(limit, used int64) int64 {
+	if used >= limit {
+		return 0
+	}
+	return limit - used
+}
+
+func startOfNextDay(now time.Time) time.Time {
+	return time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+}
+
+func startOfNextMonth(now time.Time) time.Time {
+	return time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,129 @@
+package ratelimit
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"backend-v2/internal/common/constants"
+)
+
+/* Limits caps one user's LLM proxy traffic; zero means unlimited */
+type Limits struct {
+	RequestsPerMinute int
+	Burst             int
+	TokensPerDay      int64
+	TokensPerMonth    int64
+}
+
+/* Unlimited reports whether no limit applies at all */
+func (l Limits) Unlimited() bool {
+	return l.RequestsPerMinute == 0 && l.TokensPerDay == 0 && l.TokensPerMonth == 0
+}
+
+/* Policy maps roles to limits; users without a known role get DefaultRole's limits */
+type Policy map[constants.Role]Limits
+
+/* DefaultRole applies to users whose roles have no entry in the policy */
+const DefaultRole = constants.Customer
+
+/* DefaultPolicy holds the built-in tiers; they only apply once LLM_RATE_LIMITS is set */
+func DefaultPolicy() Policy {
+	return Policy{
+		constants.Customer:       {RequestsPerMinute: 10, Burst: 5, TokensPerDay: 50_000, TokensPerMonth: 500_000},
+		constants.Subscriber:     {RequestsPerMinute: 20, Burst: 10, TokensPerDay: 200_000, TokensPerMonth: 2_000_000},
+		constants.Org_subscriber: {RequestsPerMinute: 60, Burst: 30, TokensPerDay: 1_000_000, TokensPerMonth: 10_000_000},
+		constants.Administrator:  {},
+	}
+}
+
+/*
+ParsePolicy overrides DefaultPolicy with a spec such as
+"subscriber:rpm=30,burst=10,day=100000,month=0;customer:rpm=5".
+Unspecified fields keep their default; 0 removes that limit. The entry "default" takes the
+built-in tiers unchanged, and an empty spec limits nobody.
+*/
+func ParsePolicy(spec string) (Policy, error) {
+	if strings.TrimSpace(spec) == "" {
+		return Policy{}, nil
+	}
+	policy := DefaultPolicy()
+
+	for _, entry := range strings.Split(spec, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" || entry == "default" {
+			continue
+		}
+
+		roleName, fields, ok := strings.Cut(entry, ":")
+		if !ok {
+			return nil, fmt.Errorf("rate limit entry %q: expected role:field=value,...", entry)
+		}
+		role := constants.Role(strings.TrimSpace(roleName))
+		limits := policy[role]
+
+		for _, field := range strings.Split(fields, ",") {
+			name, raw, ok := strings.Cut(strings.TrimSpace(field), "=")
+			value, err := strconv.ParseInt(raw, 10, 64)
+			if !ok || err != nil || value < 0 {
+				return nil, fmt.Errorf("rate limit entry %q: invalid field %q", entry, field)
+			}
+
+			switch name {
+			case "rpm":
+				limits.RequestsPerMinute = int(value)
+			case "burst":
+				limits.Burst = int(value)
+			case "day":
+				limits.TokensPerDay = value
+			case "month":
+				limits.TokensPerMonth = value
+			default:
+				return nil, fmt.Errorf("rate limit entry %q: unknown field %q", entry, name)
+			}
+		}
+		policy[role] = limits
+	}
+
+	return policy, nil
+}
+
+/* For returns the most generous limits among the user's roles */
+func (p Policy) For(roles []string) Limits {
+	var (
+		result Limits
+		found  bool
+	)
+	for _, name := range roles {
+		limits, ok := p[constants.Role(name)]
+		if !ok {
+			continue
+		}
+		if !found {
+			result, found = limits, true
+			continue
+		}
+		result = Limits{
+			RequestsPerMinute: generous(result.RequestsPerMinute, limits.RequestsPerMinute),
+			Burst:             generous(result.Burst, limits.Burst),
+			TokensPerDay:      generous(result.TokensPerDay, limits.TokensPerDay),
+			TokensPerMonth:    generous(result.TokensPerMonth, limits.TokensPerMonth),
+		}
+	}
+
+	if !found {
+		return p[DefaultRole]
+	}
+	return result
+}
+
+/* generous picks the larger limit, where 0 (unlimited) beats any number */
+func generous[T int | int64](a, b T) T {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,135 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"backend-v2/internal/services/usage"
+)
+
+func TestParsePolicy_OverridesDefaults(t *testing.T) {
+	policy, err := ParsePolicy("subscriber:rpm=30,day=0; customer:burst=1")
+	if err != nil {
+		t.Fatalf("ParsePolicy() error = %v", err)
+	}
+
+	subscriber := policy["subscriber"]
+	if subscriber.RequestsPerMinute != 30 || subscriber.TokensPerDay != 0 || subscriber.TokensPerMonth != DefaultPolicy()["subscriber"].TokensPerMonth {
+		t.Errorf("subscriber limits = %+v", subscriber)
+	}
+	if policy["customer"].Burst != 1 || policy["customer"].RequestsPerMinute != DefaultPolicy()["customer"].RequestsPerMinute {
+		t.Errorf("customer limits = %+v", policy["customer"])
+	}
+}
+
+func TestParsePolicy_UnsetLimitsNobody(t *testing.T) {
+	policy, err := ParsePolicy(" ")
+	if err != nil {
+		t.Fatalf("ParsePolicy() error = %v", err)
+	}
+	if limits := policy.For([]string{"customer"}); !limits.Unlimited() {
+		t.Errorf("unset policy limits customers to %+v", limits)
+	}
+
+	policy, err = ParsePolicy("default")
+	if err != nil || policy["customer"] != DefaultPolicy()["customer"] {
+		t.Errorf("ParsePolicy(\"default\") = %+v, %v; want the built-in tiers", policy, err)
+	}
+}
+
+func TestParsePolicy_Invalid(t *testing.T) {
+	for _, spec := range []string{"subscriber", "subscriber:rpm", "subscriber:rpm=-1", "subscriber:speed=3"} {
+		if _, err := ParsePolicy(spec); err == nil {
+			t.Errorf("ParsePolicy(%q) expected error", spec)
+		}
+	}
+}
+
+func TestPolicy_ForPicksMostGenerous(t *testing.T) {
+	policy := Policy{
+		"customer":      {RequestsPerMinute: 10, Burst: 5, TokensPerDay: 100},
+		"subscriber":    {RequestsPerMinute: 20, Burst: 2, TokensPerDay: 0},
+		"administrator": {},
+	}
+
+	got := policy.For([]string{"customer", "subscriber"})
+	if want := (Limits{RequestsPerMinute: 20, Burst: 5}); got != want {
+		t.Errorf("For() = %+v, want %+v", got, want)
+	}
+	if !policy.For([]string{"customer", "administrator"}).Unlimited() {
+		t.Error("administrator role should lift all limits")
+	}
+	if got := policy.For([]string{"unknown"}); got != policy[DefaultRole] {
+		t.Errorf("For(unknown) = %+v, want default role limits", got)
+	}
+}
+
+func TestRate_BurstThenSteady(t *testing.T) {
+	store := NewMemoryStore()
+	rate := Rate{PerMinute: 60, Burst: 2}
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	for i, wantRemaining := range []int{2, 1, 0} {
+		decision, _ := store.Take(context.Background(), "k", now, rate)
+		if !decision.Allowed || decision.Remaining != wantRemaining {
+			t.Fatalf("request %d = %+v, want allowed with %d remaining", i, decision, wantRemaining)
+		}
+	}
+
+	denied, _ := store.Take(context.Background(), "k", now, rate)
+	if denied.Allowed || denied.RetryAfter != time.Second {
+		t.Fatalf("burst exceeded = %+v, want denied with 1s retry", denied)
+	}
+
+	allowed, _ := store.Take(context.Background(), "k", now.Add(time.Second), rate)
+	if !allowed.Allowed {
+		t.Errorf("request after one interval = %+v, want allowed", allowed)
+	}
+}
+
+type fakeUsage struct {
+	usage.Store
+	daily []usage.Total
+}
+
+func (f *fakeUsage) Totals(_ context.Context, _ usage.Filter, _ string) ([]usage.Total, error) {
+	return f.daily, nil
+}
+
+func TestLimiter_TokenQuotas(t *testing.T) {
+	now := time.Date(2026, 3, 15, 18, 0, 0, 0, time.UTC)
+	policy := Policy{"subscriber": {TokensPerDay: 1000, TokensPerMonth: 5000}}
+	used := &fakeUsage{daily: []usage.Total{{Key: "2026-03-01", TotalTokens: 3000}, {Key: "2026-03-15", TotalTokens: 400}}}
+
+	limiter := NewLimiter(NewMemoryStore(), used, policy)
+	limiter.now = func() time.Time { return now }
+
+	result, err := limiter.Check(context.Background(), "u1", []string{"subscriber"})
+	if err != nil || !result.Allowed {
+		t.Fatalf("Check() = %+v, %v; want allowed", result, err)
+	}
+	if result.TokensRemainingDay != 600 || result.TokensRemainingMonth != 1600 {
+		t.Errorf("remaining = day %d, month %d; want 600, 1600", result.TokensRemainingDay, result.TokensRemainingMonth)
+	}
+
+	used.daily[1].TotalTokens = 1200
+	result, _ = limiter.Check(context.Background(), "u1", []string{"subscriber"})
+	if result.Allowed || result.Reason != ReasonDailyTokens || result.RetryAfter != 6*time.Hour {
+		t.Errorf("Check() over daily quota = %+v, want denied until midnight", result)
+	}
+
+	used.daily[0].TotalTokens = 4000
+	result, _ = limiter.Check(context.Background(), "u1", []string{"subscriber"})
+	if result.Allowed || result.Reason != ReasonMonthlyTokens {
+		t.Errorf("Check() over monthly quota = %+v, want monthly denial", result)
+	}
+}
+
+func TestLimiter_UnlimitedSkipsStores(t *testing.T) {
+	limiter := NewLimiter(nil, nil, Policy{"administrator": {}})
+	result, err := limiter.Check(context.Background(), "admin", []string{"administrator"})
+	if err != nil || !result.Allowed || result.TokensRemainingDay != Unlimited {
+		t.Errorf("Check() = %+v, %v; want unlimited", result, err)
+	}
+}
@@ -0,0 +1,117 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"backend-v2/internal/common/logger"
+
+	"github.com/qiniu/qmgo"
+	"github.com/qiniu/qmgo/options"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	mongoOptions "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var log = logger.New("RATELIMIT")
+
+/* Store persists GCRA state; implementations must make Take atomic per key */
+type Store interface {
+	Take(ctx context.Context, key string, now time.Time, rate Rate) (Decision, error)
+}
+
+/* MemoryStore keeps state in process; suitable for a single instance and tests */
+type MemoryStore struct {
+	mu   sync.Mutex
+	tats map[string]time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{tats: map[string]time.Time{}}
+}
+
+func (s *MemoryStore) Take(_ context.Context, key string, now time.Time, rate Rate) (Decision, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	newTAT, decision := rate.take(s.tats[key], now)
+	if decision.Allowed {
+		s.tats[key] = newTAT
+	}
+	return decision, nil
+}
+
+const (
+	collectionName = "ratelimits"
+	maxCASAttempts = 5
+)
+
+var ErrContention = errors.New("rate limit state contended")
+
+type tatDocument struct {
+	Key       string    `bson:"_id"`
+	TAT       time.Time `bson:"tat"`
+	ExpiresAt time.Time `bson:"expiresAt"`
+}
+
+/* MongoStore shares state between instances with compare-and-swap updates on the stored TAT */
+type MongoStore struct {
+	collection *qmgo.Collection
+}
+
+func NewMongoStore(db *qmgo.Database) *MongoStore {
+	collection := db.Collection(collectionName)
+
+	/* TTL index drops idle keys; failures only cost disk space, so they are logged, not fatal */
+	expireAfter := int32(0)
+	err := collection.CreateOneIndex(context.Background(), options.IndexModel{
+		Key:          []string{"expiresAt"},
+		IndexOptions: mongoOptions.Index().SetExpireAfterSeconds(expireAfter),
+	})
+	if err != nil {
+		log.Warn("could not create TTL index on %s: %v", collectionName, err)
+	}
+
+	return &MongoStore{collection: collection}
+}
+
+func (s *MongoStore) Take(ctx context.Context, key string, now time.Time, rate Rate) (Decision, error) {
+	for attempt := 0; attempt < maxCASAttempts; attempt++ {
+		var current tatDocument
+		err := s.collection.Find(ctx, bson.M{"_id": key}).One(&current)
+		exists := err == nil
+		if err != nil && !errors.Is(err, qmgo.ErrNoSuchDocuments) {
+			return Decision{}, err
+		}
+
+		newTAT, decision := rate.take(current.TAT, now)
+		if !decision.Allowed {
+			return decision, nil
+		}
+
+		/* Mongo stores milliseconds; truncating keeps the CAS filter equal to what is read back */
+		newTAT = newTAT.Truncate(time.Millisecond)
+		doc := tatDocument{Key: key, TAT: newTAT, ExpiresAt: rate.expiry(newTAT)}
+
+		if !exists {
+			_, err = s.collection.InsertOne(ctx, doc)
+			if mongo.IsDuplicateKeyError(err) {
+				continue
+			}
+			return decision, err
+		}
+
+		err = s.collection.UpdateOne(ctx,
+			bson.M{"_id": key, "tat": current.TAT},
+			bson.M{"$set": bson.M{"tat": doc.TAT, "expiresAt": doc.ExpiresAt}},
+		)
+		if errors.Is(err, qmgo.ErrNoSuchDocuments) {
+			continue
+		}
+		return decision, err
+	}
+
+	return Decision{}, ErrContention
+}
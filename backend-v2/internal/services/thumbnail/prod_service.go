@@ -11,19 +11,20 @@ import (
 	"io"
 	"net/http"
 	"time"
+
+	commonhttp "backend-v2/internal/common/http"
 )
 
 // prodService is the production implementation for thumbnail generation
 type prodService struct {
-	client *http.Client
+	/* The URL comes from the caller, so requests go through the outbound guard */
+	client commonhttp.Client
 }
 
 // NewProdService creates a new production thumbnail service
 func NewProdService() Service {
 	return &prodService{
-		client: &http.Client{
-			Timeout: 30 * time.Second,
-		},
+		client: commonhttp.NewClientFactory().Create(30 * time.Second),
 	}
 }
 
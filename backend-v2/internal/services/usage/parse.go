@@ -0,0 +1,159 @@
+package usage
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+)
+
+/* Tokens is the token count of one or more LLM calls */
+type Tokens struct {
+	Prompt     int64 `json:"promptTokens"`
+	Completion int64 `json:"completionTokens"`
+	Total      int64 `json:"totalTokens"`
+}
+
+func (t Tokens) IsZero() bool {
+	return t.Prompt == 0 && t.Completion == 0 && t.Total == 0
+}
+
+/* flexInt accepts both JSON numbers and numeric strings (Yandex encodes int64 as strings) */
+type flexInt int64
+
+func (f *flexInt) UnmarshalJSON(data []byte) error {
+	data = bytes.Trim(data, `"`)
+	if len(data) == 0 || string(data) == "null" {
+		return nil
+	}
+	value, err := strconv.ParseInt(string(data), 10, 64)
+	if err != nil {
+		return nil
+	}
+	*f = flexInt(value)
+	return nil
+}
+
+/* usageBlock covers the usage field names of every supported provider */
+type usageBlock struct {
+	/* OpenAI, DeepSeek, Perplexity, Qwen and OpenAI-compatible endpoints */
+	PromptTokens     flexInt `json:"prompt_tokens"`
+	CompletionTokens flexInt `json:"completion_tokens"`
+	TotalTokens      flexInt `json:"total_tokens"`
+
+	/* Claude */
+	InputTokens  flexInt `json:"input_tokens"`
+	OutputTokens flexInt `json:"output_tokens"`
+
+	/* Yandex */
+	InputTextTokens   flexInt `json:"inputTextTokens"`
+	YandexCompletion  flexInt `json:"completionTokens"`
+	YandexTotalTokens flexInt `json:"totalTokens"`
+}
+
+func (u *usageBlock) tokens() Tokens {
+	if u == nil {
+		return Tokens{}
+	}
+	t := Tokens{
+		Prompt:     maxInt(int64(u.PromptTokens), int64(u.InputTokens), int64(u.InputTextTokens)),
+		Completion: maxInt(int64(u.CompletionTokens), int64(u.OutputTokens), int64(u.YandexCompletion)),
+		Total:      maxInt(int64(u.TotalTokens), int64(u.YandexTotalTokens)),
+	}
+	t.Total = maxInt(t.Total, t.Prompt+t.Completion)
+	return t
+}
+
+type responseBody struct {
+	Model string      `json:"model"`
+	Usage *usageBlock `json:"usage"`
+
+	/* Claude stream message_start event */
+	Message *struct {
+		Model string      `json:"model"`
+		Usage *usageBlock `json:"usage"`
+	} `json:"message"`
+
+	/* Yandex foundation models completion */
+	Result *struct {
+		ModelVersion string      `json:"modelVersion"`
+		Usage        *usageBlock `json:"usage"`
+	} `json:"result"`
+}
+
+/* Parse extracts token usage and the model name from a provider response body */
+func Parse(body []byte) (Tokens, string) {
+	var parsed responseBody
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return Tokens{}, ""
+	}
+
+	tokens, model := parsed.Usage.tokens(), parsed.Model
+	if parsed.Message != nil {
+		tokens = merge(tokens, parsed.Message.Usage.tokens())
+		if model == "" {
+			model = parsed.Message.Model
+		}
+	}
+	if parsed.Result != nil {
+		tokens = merge(tokens, parsed.Result.Usage.tokens())
+		if model == "" {
+			model = parsed.Result.ModelVersion
+		}
+	}
+	return tokens, model
+}
+
+/*
+StreamMeter accumulates usage from SSE lines. Providers report usage in different events
+(OpenAI-style final chunk, Claude message_start + cumulative message_delta), so the largest
+value seen for each counter wins.
+*/
+type StreamMeter struct {
+	tokens Tokens
+	model  string
+}
+
+var dataPrefix = []byte("data:")
+
+/* Feed inspects one SSE line */
+func (m *StreamMeter) Feed(line []byte) {
+	line = bytes.TrimSpace(line)
+	if !bytes.HasPrefix(line, dataPrefix) {
+		return
+	}
+	payload := bytes.TrimSpace(line[len(dataPrefix):])
+	if len(payload) == 0 || payload[0] != '{' {
+		return
+	}
+
+	tokens, model := Parse(payload)
+	m.tokens = merge(m.tokens, tokens)
+	if m.model == "" {
+		m.model = model
+	}
+}
+
+/* Result returns the usage and model seen so far */
+func (m *StreamMeter) Result() (Tokens, string) {
+	return m.tokens, m.model
+}
+
+func merge(a, b Tokens) Tokens {
+	t := Tokens{
+		Prompt:     maxInt(a.Prompt, b.Prompt),
+		Completion: maxInt(a.Completion, b.Completion),
+		Total:      maxInt(a.Total, b.Total),
+	}
+	t.Total = maxInt(t.Total, t.Prompt+t.Completion)
+	return t
+}
+
+func maxInt(values ...int64) int64 {
+	var result int64
+	for _, v := range values {
+		if v > result {
+			result = v
+		}
+	}
+	return result
+}
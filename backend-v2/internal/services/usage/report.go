@@ -0,0 +1,84 @@
+package usage
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+/* DefaultRangeDays is the reporting window when a query gives no dates */
+const DefaultRangeDays = 30
+
+var ErrInvalidRange = errors.New("from/to must be YYYY-MM-DD with from <= to")
+
+/* Report summarises usage in a date range */
+type Report struct {
+	From       string  `json:"from"`
+	To         string  `json:"to"`
+	Total      Total   `json:"total"`
+	ByProvider []Total `json:"byProvider"`
+	ByModel    []Total `json:"byModel"`
+	Daily      []Total `json:"daily"`
+}
+
+/* NormalizeRange validates From/To and fills missing bounds with the last DefaultRangeDays days */
+func (f *Filter) NormalizeRange(now time.Time) error {
+	if f.To == "" {
+		f.To = now.UTC().Format(DayFormat)
+	}
+	to, err := time.Parse(DayFormat, f.To)
+	if err != nil {
+		return ErrInvalidRange
+	}
+
+	if f.From == "" {
+		f.From = to.AddDate(0, 0, -(DefaultRangeDays - 1)).Format(DayFormat)
+	}
+	from, err := time.Parse(DayFormat, f.From)
+	if err != nil || from.After(to) {
+		return ErrInvalidRange
+	}
+	return nil
+}
+
+/* FilterFromQuery reads from, to, provider and model query parameters */
+func FilterFromQuery(c *fiber.Ctx) (Filter, error) {
+	filter := Filter{
+		Provider: c.Query("provider"),
+		Model:    c.Query("model"),
+		From:     c.Query("from"),
+		To:       c.Query("to"),
+	}
+	err := filter.NormalizeRange(time.Now())
+	return filter, err
+}
+
+/* BuildReport collects the overall total plus per-provider, per-model and per-day breakdowns */
+func BuildReport(ctx context.Context, store Store, filter Filter) (*Report, error) {
+	report := &Report{From: filter.From, To: filter.To, Total: Total{Key: "all"}}
+
+	totals, err := store.Totals(ctx, filter, "")
+	if err != nil {
+		return nil, err
+	}
+	if len(totals) > 0 {
+		report.Total = totals[0]
+	}
+
+	if report.ByProvider, err = store.Totals(ctx, filter, "provider"); err != nil {
+		return nil, err
+	}
+	if report.ByModel, err = store.Totals(ctx, filter, "model"); err != nil {
+		return nil, err
+	}
+	if report.Daily, err = store.Totals(ctx, filter, "day"); err != nil {
+		return nil, err
+	}
+	/* Totals orders by token count; days read better chronologically */
+	sort.Slice(report.Daily, func(i, j int) bool { return report.Daily[i].Key < report.Daily[j].Key })
+
+	return report, nil
+}
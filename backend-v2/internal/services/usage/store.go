@@ -0,0 +1,157 @@
+package usage
+
+import (
+	"context"
+	"time"
+
+	"backend-v2/internal/models"
+
+	"github.com/qiniu/qmgo"
+	qmgoOpts "github.com/qiniu/qmgo/options"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+/* DayFormat is the layout of LLMUsage.Day (UTC calendar day) */
+const DayFormat = "2006-01-02"
+
+const collectionName = "llmusage"
+
+/* Record is the usage of a single LLM call */
+type Record struct {
+	UserID   string
+	Provider string
+	Model    string
+	Tokens   Tokens
+	At       time.Time
+}
+
+/* Recorder persists LLM call usage */
+type Recorder interface {
+	Record(ctx context.Context, record Record) error
+}
+
+/* Filter narrows usage queries; empty fields match everything, From/To are inclusive days */
+type Filter struct {
+	UserID   string
+	Provider string
+	Model    string
+	From     string
+	To       string
+}
+
+/* Total is usage summed over one group key */
+type Total struct {
+	Key              string `json:"key" bson:"_id"`
+	Requests         int64  `json:"requests" bson:"requests"`
+	PromptTokens     int64  `json:"promptTokens" bson:"promptTokens"`
+	CompletionTokens int64  `json:"completionTokens" bson:"completionTokens"`
+	TotalTokens      int64  `json:"totalTokens" bson:"totalTokens"`
+}
+
+/* GroupFields maps group-by names accepted by the API to LLMUsage fields */
+var GroupFields = map[string]string{
+	"user":     "userId",
+	"provider": "provider",
+	"model":    "model",
+	"day":      "day",
+}
+
+/* Store records usage and answers aggregate queries */
+type Store interface {
+	Recorder
+	List(ctx context.Context, filter Filter) ([]models.LLMUsage, error)
+	Totals(ctx context.Context, filter Filter, groupBy string) ([]Total, error)
+}
+
+/* MongoStore keeps one LLMUsage document per user, provider, model and day */
+type MongoStore struct {
+	collection *qmgo.Collection
+}
+
+func NewMongoStore(db *qmgo.Database) Store {
+	return &MongoStore{collection: db.Collection(collectionName)}
+}
+
+/* Record increments the day bucket of the call, creating it on first use */
+func (s *MongoStore) Record(ctx context.Context, record Record) error {
+	at := record.At
+	if at.IsZero() {
+		at = time.Now()
+	}
+
+	filter := bson.M{
+		"userId":   record.UserID,
+		"provider": record.Provider,
+		"model":    record.Model,
+		"day":      at.UTC().Format(DayFormat),
+	}
+	update := bson.M{
+		"$inc": bson.M{
+			"requests":         1,
+			"promptTokens":     record.Tokens.Prompt,
+			"completionTokens": record.Tokens.Completion,
+			"totalTokens":      record.Tokens.Total,
+		},
+		"$set": bson.M{"updatedAt": at},
+	}
+
+	return s.collection.UpdateOne(ctx, filter, update, qmgoOpts.UpdateOptions{
+		UpdateOptions: options.Update().SetUpsert(true),
+	})
+}
+
+func (s *MongoStore) List(ctx context.Context, filter Filter) ([]models.LLMUsage, error) {
+	usage := []models.LLMUsage{}
+	err := s.collection.Find(ctx, filter.query()).Sort("-day", "provider", "model").All(&usage)
+	return usage, err
+}
+
+/* Totals sums usage per value of groupBy (see GroupFields); an unknown groupBy sums everything */
+func (s *MongoStore) Totals(ctx context.Context, filter Filter, groupBy string) ([]Total, error) {
+	var groupKey interface{} = "all"
+	if field, ok := GroupFields[groupBy]; ok {
+		groupKey = "$" + field
+	}
+
+	pipeline := bson.A{
+		bson.D{{Key: "$match", Value: filter.query()}},
+		bson.D{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: groupKey},
+			{Key: "requests", Value: bson.D{{Key: "$sum", Value: "$requests"}}},
+			{Key: "promptTokens", Value: bson.D{{Key: "$sum", Value: "$promptTokens"}}},
+			{Key: "completionTokens", Value: bson.D{{Key: "$sum", Value: "$completionTokens"}}},
+			{Key: "totalTokens", Value: bson.D{{Key: "$sum", Value: "$totalTokens"}}},
+		}}},
+		bson.D{{Key: "$sort", Value: bson.D{{Key: "totalTokens", Value: -1}}}},
+	}
+
+	totals := []Total{}
+	err := s.collection.Aggregate(ctx, pipeline).All(&totals)
+	return totals, err
+}
+
+func (f Filter) query() bson.M {
+	query := bson.M{}
+	if f.UserID != "" {
+		query["userId"] = f.UserID
+	}
+	if f.Provider != "" {
+		query["provider"] = f.Provider
+	}
+	if f.Model != "" {
+		query["model"] = f.Model
+	}
+
+	day := bson.M{}
+	if f.From != "" {
+		day["$gte"] = f.From
+	}
+	if f.To != "" {
+		day["$lte"] = f.To
+	}
+	if len(day) > 0 {
+		query["day"] = day
+	}
+	return query
+}
@@ -0,0 +1,108 @@
+package usage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse_ProviderFormats(t *testing.T) {
+	cases := []struct {
+		name  string
+		body  string
+		want  Tokens
+		model string
+	}{
+		{
+			name:  "openai",
+			body:  `{"model":"gpt-4o","usage":{"prompt_tokens":12,"completion_tokens":30,"total_tokens":42}}`,
+			want:  Tokens{Prompt: 12, Completion: 30, Total: 42},
+			model: "gpt-4o",
+		},
+		{
+			name:  "embeddings",
+			body:  `{"model":"text-embedding-3-small","usage":{"prompt_tokens":8,"total_tokens":8}}`,
+			want:  Tokens{Prompt: 8, Total: 8},
+			model: "text-embedding-3-small",
+		},
+		{
+			name:  "claude",
+			body:  `{"model":"claude-sonnet-4","usage":{"input_tokens":20,"output_tokens":5}}`,
+			want:  Tokens{Prompt: 20, Completion: 5, Total: 25},
+			model: "claude-sonnet-4",
+		},
+		{
+			name:  "yandex",
+			body:  `{"result":{"modelVersion":"23.10.2024","usage":{"inputTextTokens":"7","completionTokens":"3","totalTokens":"10"}}}`,
+			want:  Tokens{Prompt: 7, Completion: 3, Total: 10},
+			model: "23.10.2024",
+		},
+		{
+			name: "no usage",
+			body: `{"error":{"message":"bad key"}}`,
+		},
+		{
+			name: "not json",
+			body: `<html>`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tokens, model := Parse([]byte(tc.body))
+			if tokens != tc.want || model != tc.model {
+				t.Errorf("Parse() = %+v, %q; want %+v, %q", tokens, model, tc.want, tc.model)
+			}
+		})
+	}
+}
+
+func TestStreamMeter_Claude(t *testing.T) {
+	var meter StreamMeter
+	for _, line := range []string{
+		"event: message_start\n",
+		`data: {"type":"message_start","message":{"model":"claude-sonnet-4","usage":{"input_tokens":25,"output_tokens":1}}}` + "\n",
+		`data: {"type":"content_block_delta","delta":{"text":"Hi"}}` + "\n",
+		`data: {"type":"message_delta","usage":{"output_tokens":15}}` + "\n",
+	} {
+		meter.Feed([]byte(line))
+	}
+
+	tokens, model := meter.Result()
+	if want := (Tokens{Prompt: 25, Completion: 15, Total: 40}); tokens != want || model != "claude-sonnet-4" {
+		t.Errorf("Result() = %+v, %q; want %+v, claude-sonnet-4", tokens, model, want)
+	}
+}
+
+func TestStreamMeter_OpenAIFinalChunk(t *testing.T) {
+	var meter StreamMeter
+	for _, line := range []string{
+		`data: {"model":"deepseek-chat","choices":[{"delta":{"content":"Hi"}}]}`,
+		`data: {"model":"deepseek-chat","choices":[],"usage":{"prompt_tokens":9,"completion_tokens":4,"total_tokens":13}}`,
+		`data: [DONE]`,
+	} {
+		meter.Feed([]byte(line))
+	}
+
+	tokens, model := meter.Result()
+	if want := (Tokens{Prompt: 9, Completion: 4, Total: 13}); tokens != want || model != "deepseek-chat" {
+		t.Errorf("Result() = %+v, %q; want %+v, deepseek-chat", tokens, model, want)
+	}
+}
+
+func TestFilter_NormalizeRange(t *testing.T) {
+	now := time.Date(2026, 3, 31, 15, 0, 0, 0, time.UTC)
+
+	f := Filter{}
+	if err := f.NormalizeRange(now); err != nil {
+		t.Fatalf("NormalizeRange() error = %v", err)
+	}
+	if f.From != "2026-03-02" || f.To != "2026-03-31" {
+		t.Errorf("NormalizeRange() = %s..%s, want 2026-03-02..2026-03-31", f.From, f.To)
+	}
+
+	for _, bad := range []Filter{{From: "03/01/2026"}, {From: "2026-04-01", To: "2026-03-01"}} {
+		if err := bad.NormalizeRange(now); err != ErrInvalidRange {
+			t.Errorf("NormalizeRange(%+v) error = %v, want ErrInvalidRange", bad, err)
+		}
+	}
+}
@@ -0,0 +1,356 @@
+package vectorindex
+
+import (
+	"container/heap"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+/* Params tune the HNSW graphs; zero fields take the defaults */
+type Params struct {
+	/* M is the number of links per node on upper layers; layer 0 keeps twice as many */
+	M int
+	/* EfConstruction is the candidate list size while inserting */
+	EfConstruction int
+	/* EfSearch is the minimum candidate list size while querying */
+	EfSearch int
+}
+
+func (p Params) withDefaults() Params {
+	if p.M <= 0 {
+		p.M = 16
+	}
+	if p.EfConstruction <= 0 {
+		p.EfConstruction = 200
+	}
+	if p.EfSearch <= 0 {
+		p.EfSearch = 64
+	}
+	return p
+}
+
+type node struct {
+	item    Item
+	vector  []float32
+	links   [][]int32
+	deleted bool
+}
+
+/*
+graph is a hierarchical navigable small world graph over unit vectors of one dimension, so
+the dot product is the cosine similarity. Deleted nodes stay in the graph as waypoints and
+are skipped in results until the graph is rebuilt.
+*/
+type graph struct {
+	params    Params
+	dim       int
+	nodes     []*node
+	entry     int32
+	maxLevel  int
+	live      int
+	levelMult float64
+	rng       *rand.Rand
+}
+
+func newGraph(params Params, dim int) *graph {
+	params = params.withDefaults()
+	return &graph{
+		params:    params,
+		dim:       dim,
+		entry:     -1,
+		levelMult: 1 / math.Log(float64(params.M)),
+		rng:       rand.New(rand.NewSource(int64(dim))),
+	}
+}
+
+/* insert adds a unit vector; callers normalize and check the dimension */
+func (g *graph) insert(item Item, vector []float32) {
+	level := int(-math.Log(1-g.rng.Float64()) * g.levelMult)
+	id := int32(len(g.nodes))
+	n := &node{item: item, vector: vector, links: make([][]int32, level+1)}
+	g.nodes = append(g.nodes, n)
+	g.live++
+
+	if g.entry < 0 {
+		g.entry, g.maxLevel = id, level
+		return
+	}
+
+	ep := g.entry
+	for layer := g.maxLevel; layer > level; layer-- {
+		ep = g.greedy(vector, ep, layer)
+	}
+	for layer := min(level, g.maxLevel); layer >= 0; layer-- {
+		candidates := g.searchLayer(vector, ep, g.params.EfConstruction, layer)
+		n.links[layer] = g.selectNeighbors(candidates, g.params.M)
+		for _, neighbor := range n.links[layer] {
+			g.link(neighbor, id, layer)
+		}
+		ep = candidates[0].id
+	}
+	if level > g.maxLevel {
+		g.entry, g.maxLevel = id, level
+	}
+}
+
+/* link adds id to from's links on layer, pruning back to the layer's capacity */
+func (g *graph) link(from, id int32, layer int) {
+	n := g.nodes[from]
+	n.links[layer] = append(n.links[layer], id)
+
+	capacity := g.params.M
+	if layer == 0 {
+		capacity *= 2
+	}
+	if len(n.links[layer]) <= capacity {
+		return
+	}
+
+	candidates := make([]candidate, 0, len(n.links[layer]))
+	for _, other := range n.links[layer] {
+		candidates = append(candidates, candidate{id: other, score: dot(n.vector, g.nodes[other].vector)})
+	}
+	sortCandidates(candidates)
+	n.links[layer] = g.selectNeighbors(candidates, capacity)
+}
+
+/*
+selectNeighbors keeps candidates (best first) that are closer to the query than to any
+neighbor already kept, so links spread in different directions; it tops up with the best
+skipped ones when that leaves fewer than m.
+*/
+func (g *graph) selectNeighbors(candidates []candidate, m int) []int32 {
+	selected := make([]int32, 0, m)
+	var skipped []int32
+	for _, c := range candidates {
+		if len(selected) == m {
+			break
+		}
+		diverse := true
+		for _, kept := range selected {
+			if dot(g.nodes[c.id].vector, g.nodes[kept].vector) > c.score {
+				diverse = false
+				break
+			}
+		}
+		if diverse {
+			selected = append(selected, c.id)
+		} else {
+			skipped = append(skipped, c.id)
+		}
+	}
+	for _, id := range skipped {
+		if len(selected) == m {
+			break
+		}
+		selected = append(selected, id)
+	}
+	return selected
+}
+
+/* greedy walks layer towards the query and returns the closest node it reaches */
+func (g *graph) greedy(query []float32, ep int32, layer int) int32 {
+	best := dot(query, g.nodes[ep].vector)
+	for changed := true; changed; {
+		changed = false
+		for _, neighbor := range g.nodes[ep].links[layer] {
+			if score := dot(query, g.nodes[neighbor].vector); score > best {
+				best, ep, changed = score, neighbor, true
+			}
+		}
+	}
+	return ep
+}
+
+/* searchLayer returns up to ef nodes of layer closest to the query, best first */
+func (g *graph) searchLayer(query []float32, ep int32, ef int, layer int) []candidate {
+	visited := map[int32]struct{}{ep: {}}
+	first := candidate{id: ep, score: dot(query, g.nodes[ep].vector)}
+	frontier := &maxHeap{first}
+	results := &minHeap{first}
+
+	for frontier.Len() > 0 {
+		current := heap.Pop(frontier).(candidate)
+		if results.Len() >= ef && current.score < (*results)[0].score {
+			break
+		}
+		for _, neighbor := range g.nodes[current.id].links[layer] {
+			if _, seen := visited[neighbor]; seen {
+				continue
+			}
+			visited[neighbor] = struct{}{}
+
+			score := dot(query, g.nodes[neighbor].vector)
+			if results.Len() < ef || score > (*results)[0].score {
+				heap.Push(frontier, candidate{id: neighbor, score: score})
+				heap.Push(results, candidate{id: neighbor, score: score})
+				if results.Len() > ef {
+					heap.Pop(results)
+				}
+			}
+		}
+	}
+
+	found := make([]candidate, results.Len())
+	for i := len(found) - 1; i >= 0; i-- {
+		found[i] = heap.Pop(results).(candidate)
+	}
+	return found
+}
+
+/*
+search returns the k best live nodes that accept admits. Selective filters widen the
+candidate list until enough pass; once it would cover the whole graph an exact scan is
+cheaper and cannot miss anything.
+*/
+func (g *graph) search(query []float32, k int, accept func(Item) bool) []candidate {
+	if g.live == 0 || k <= 0 {
+		return nil
+	}
+
+	ef := max(g.params.EfSearch, k)
+	for ef < len(g.nodes) {
+		ep := g.entry
+		for layer := g.maxLevel; layer > 0; layer-- {
+			ep = g.greedy(query, ep, layer)
+		}
+
+		var found []candidate
+		for _, c := range g.searchLayer(query, ep, ef, 0) {
+			if n := g.nodes[c.id]; !n.deleted && accept(n.item) {
+				found = append(found, c)
+			}
+		}
+		if len(found) >= k || len(found) == g.live {
+			return found[:min(k, len(found))]
+		}
+		ef *= 4
+	}
+	return g.exact(query, k, accept)
+}
+
+/* exact ranks every live node; it backs tiny or heavily filtered searches and recall sampling */
+func (g *graph) exact(query []float32, k int, accept func(Item) bool) []candidate {
+	best := &minHeap{}
+	for id, n := range g.nodes {
+		if n.deleted || !accept(n.item) {
+			continue
+		}
+		score := dot(query, n.vector)
+		if best.Len() < k {
+			heap.Push(best, candidate{id: int32(id), score: score})
+		} else if k > 0 && score > (*best)[0].score {
+			(*best)[0] = candidate{id: int32(id), score: score}
+			heap.Fix(best, 0)
+		}
+	}
+
+	found := make([]candidate, best.Len())
+	for i := len(found) - 1; i >= 0; i-- {
+		found[i] = heap.Pop(best).(candidate)
+	}
+	return found
+}
+
+/* remove tombstones every live node matching pred and reports how many it hit */
+func (g *graph) remove(pred func(Item) bool) int {
+	removed := 0
+	for _, n := range g.nodes {
+		if !n.deleted && pred(n.item) {
+			n.deleted = true
+			removed++
+		}
+	}
+	g.live -= removed
+	return removed
+}
+
+/* compacted rebuilds the graph from its live nodes once tombstones outnumber half of them */
+func (g *graph) compacted() *graph {
+	if dead := len(g.nodes) - g.live; dead < 64 || dead*2 < g.live {
+		return g
+	}
+	rebuilt := newGraph(g.params, g.dim)
+	for _, n := range g.nodes {
+		if !n.deleted {
+			rebuilt.insert(n.item, n.vector)
+		}
+	}
+	return rebuilt
+}
+
+/* bytes estimates the graph's heap footprint for the manager's memory budget */
+func (g *graph) bytes() int64 {
+	var total int64
+	for _, n := range g.nodes {
+		total += 96 + int64(len(n.vector))*4 + int64(len(n.item.ID)+len(n.item.Type)+len(n.item.Source))
+		total += int64(len(n.item.Metadata)) * 64
+		for _, links := range n.links {
+			total += 24 + int64(cap(links))*4
+		}
+	}
+	return total
+}
+
+/* unit converts to float32 and scales to length one; false for zero or non-finite vectors */
+func unit(vector []float64) ([]float32, bool) {
+	var norm float64
+	for _, x := range vector {
+		norm += x * x
+	}
+	norm = math.Sqrt(norm)
+	if norm == 0 || math.IsNaN(norm) || math.IsInf(norm, 0) {
+		return nil, false
+	}
+	out := make([]float32, len(vector))
+	for i, x := range vector {
+		out[i] = float32(x / norm)
+	}
+	return out, true
+}
+
+func dot(a, b []float32) float64 {
+	var sum float32
+	for i := range a {
+		sum += a[i] * b[i]
+	}
+	return float64(sum)
+}
+
+type candidate struct {
+	id    int32
+	score float64
+}
+
+func sortCandidates(candidates []candidate) {
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].score > candidates[j].score })
+}
+
+/* maxHeap pops the best candidate first */
+type maxHeap []candidate
+
+func (h maxHeap) Len() int            { return len(h) }
+func (h maxHeap) Less(i, j int) bool  { return h[i].score > h[j].score }
+func (h maxHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *maxHeap) Push(x interface{}) { *h = append(*h, x.(candidate)) }
+func (h *maxHeap) Pop() interface{} {
+	old := *h
+	last := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return last
+}
+
+/* minHeap pops the worst candidate first, bounding a best-k set */
+type minHeap []candidate
+
+func (h minHeap) Len() int            { return len(h) }
+func (h minHeap) Less(i, j int) bool  { return h[i].score < h[j].score }
+func (h minHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *minHeap) Push(x interface{}) { *h = append(*h, x.(candidate)) }
+func (h *minHeap) Pop() interface{} {
+	old := *h
+	last := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return last
+}
@@ -0,0 +1,165 @@
+package vectorindex
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+/* Item identifies an indexed vector and carries what filters need; content stays in Mongo */
+type Item struct {
+	ID       string
+	Type     string
+	Source   string
+	Metadata map[string]interface{}
+}
+
+/* Entry is an item with its raw embedding, as loaded or saved */
+type Entry struct {
+	Item
+	Embedding []float64
+}
+
+/* Hit is a search result, best first by cosine similarity */
+type Hit struct {
+	Item
+	Score float64
+}
+
+/*
+Index holds the graphs of one context, one per embedding dimension since only vectors of the
+query's dimension are comparable. Version is the context's updatedAt the index reflects.
+*/
+type Index struct {
+	mu      sync.RWMutex
+	params  Params
+	version time.Time
+	graphs  map[int]*graph
+	dirty   bool
+}
+
+/* NewIndex builds an index from entries; entries without a usable embedding are skipped */
+func NewIndex(params Params, version time.Time, entries []Entry) *Index {
+	idx := &Index{params: params.withDefaults(), version: version, graphs: map[int]*graph{}}
+	idx.add(entries)
+	return idx
+}
+
+func (idx *Index) Version() time.Time {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return idx.version
+}
+
+/* Len counts live vectors across dimensions */
+func (idx *Index) Len() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	total := 0
+	for _, g := range idx.graphs {
+		total += g.live
+	}
+	return total
+}
+
+/* Add inserts entries; callers hold no lock */
+func (idx *Index) Add(entries []Entry) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.add(entries)
+}
+
+func (idx *Index) add(entries []Entry) {
+	for _, entry := range entries {
+		vector, ok := unit(entry.Embedding)
+		if !ok {
+			continue
+		}
+		g := idx.graphs[len(vector)]
+		if g == nil {
+			g = newGraph(idx.params, len(vector))
+			idx.graphs[len(vector)] = g
+		}
+		g.insert(entry.Item, vector)
+	}
+	idx.dirty = idx.dirty || len(entries) > 0
+}
+
+/* Remove drops every item matching pred, compacting graphs left mostly tombstones */
+func (idx *Index) Remove(pred func(Item) bool) int {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	removed := 0
+	for dim, g := range idx.graphs {
+		removed += g.remove(pred)
+		if g.live == 0 {
+			delete(idx.graphs, dim)
+			continue
+		}
+		idx.graphs[dim] = g.compacted()
+	}
+	idx.dirty = idx.dirty || removed > 0
+	return removed
+}
+
+/* Search returns up to k approximate nearest neighbours that accept admits; nil accept admits all */
+func (idx *Index) Search(query []float64, k int, accept func(Item) bool) []Hit {
+	return idx.search(query, k, accept, false)
+}
+
+/* Exact is Search by full scan, the reference recall is measured against */
+func (idx *Index) Exact(query []float64, k int, accept func(Item) bool) []Hit {
+	return idx.search(query, k, accept, true)
+}
+
+func (idx *Index) search(query []float64, k int, accept func(Item) bool, exact bool) []Hit {
+	vector, ok := unit(query)
+	if !ok {
+		return nil
+	}
+	if accept == nil {
+		accept = func(Item) bool { return true }
+	}
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	g := idx.graphs[len(vector)]
+	if g == nil {
+		return nil
+	}
+	var found []candidate
+	if exact {
+		found = g.exact(vector, k, accept)
+	} else {
+		found = g.search(vector, k, accept)
+	}
+
+	hits := make([]Hit, len(found))
+	for i, c := range found {
+		hits[i] = Hit{Item: g.nodes[c.id].item, Score: c.score}
+	}
+	return hits
+}
+
+/* Bytes estimates the index's memory footprint */
+func (idx *Index) Bytes() int64 {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	var total int64
+	for _, g := range idx.graphs {
+		total += g.bytes()
+	}
+	return total
+}
+
+/* dims lists the indexed dimensions in order, for stable snapshots */
+func (idx *Index) dims() []int {
+	dims := make([]int, 0, len(idx.graphs))
+	for dim := range idx.graphs {
+		dims = append(dims, dim)
+	}
+	sort.Ints(dims)
+	return dims
+}
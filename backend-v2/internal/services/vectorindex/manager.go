@@ -0,0 +1,388 @@
+package vectorindex
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"backend-v2/internal/common/logger"
+)
+
+var log = logger.New("VECTORINDEX")
+
+/* Policy bounds the resident indexes and tunes search, snapshots and recall sampling */
+type Policy struct {
+	Params
+	/* MaxBytes is the memory budget; least recently used contexts are evicted past it */
+	MaxBytes int64
+	/* RecallSample is the share of searches also answered exactly to measure recall */
+	RecallSample float64
+	/* SnapshotEvery is how often changed indexes are written to the snapshot directory */
+	SnapshotEvery time.Duration
+}
+
+func DefaultPolicy() Policy {
+	return Policy{
+		Params:        Params{}.withDefaults(),
+		MaxBytes:      256 << 20,
+		RecallSample:  0.05,
+		SnapshotEvery: time.Minute,
+	}
+}
+
+/*
+ParsePolicy reads "bytes=268435456,m=16,efConstruction=200,ef=64,recallSample=0.05,snapshotEvery=1m";
+fields left out keep their defaults
+*/
+func ParsePolicy(spec string) (Policy, error) {
+	policy := DefaultPolicy()
+	for _, field := range strings.Split(spec, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(field, "=")
+		if !ok {
+			return policy, fmt.Errorf("vector index setting %q: expected name=value", field)
+		}
+
+		var err error
+		switch strings.TrimSpace(name) {
+		case "bytes":
+			policy.MaxBytes, err = strconv.ParseInt(value, 10, 64)
+		case "m":
+			policy.M, err = strconv.Atoi(value)
+		case "efConstruction":
+			policy.EfConstruction, err = strconv.Atoi(value)
+		case "ef":
+			policy.EfSearch, err = strconv.Atoi(value)
+		case "recallSample":
+			policy.RecallSample, err = strconv.ParseFloat(value, 64)
+		case "snapshotEvery":
+			policy.SnapshotEvery, err = time.ParseDuration(value)
+		default:
+			return policy, fmt.Errorf("vector index setting %q: unknown name", name)
+		}
+		if err != nil {
+			return policy, fmt.Errorf("vector index setting %q: %v", field, err)
+		}
+	}
+
+	if policy.MaxBytes <= 0 || policy.M < 2 || policy.EfConstruction <= 0 || policy.EfSearch <= 0 {
+		return policy, fmt.Errorf("vector index sizes must be positive and m at least 2")
+	}
+	if policy.RecallSample < 0 || policy.RecallSample > 1 {
+		return policy, fmt.Errorf("vector index recallSample must be between 0 and 1")
+	}
+	return policy, nil
+}
+
+/* Loader reads a context's vectors from the database along with the version they reflect */
+type Loader func(ctx context.Context) (time.Time, []Entry, error)
+
+type resident struct {
+	key   string
+	index *Index
+	bytes int64
+}
+
+type build struct {
+	done  chan struct{}
+	index *Index
+	err   error
+}
+
+/*
+Manager keeps one Index per context in memory, built on first use from a snapshot or the
+database and evicted least recently used past the memory budget. Indexes are keyed by the
+caller; a version mismatch with the database means a write this process did not see, and
+the index is rebuilt.
+*/
+type Manager struct {
+	policy  Policy
+	dir     string
+	metrics *Metrics
+
+	mu       sync.Mutex
+	bytes    int64
+	order    *list.List
+	resident map[string]*list.Element
+	building map[string]*build
+}
+
+/* NewManager snapshots into dir, which may be empty to keep indexes in memory only */
+func NewManager(policy Policy, dir string) *Manager {
+	m := &Manager{
+		policy:   policy,
+		dir:      dir,
+		metrics:  newMetrics(),
+		order:    list.New(),
+		resident: map[string]*list.Element{},
+		building: map[string]*build{},
+	}
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			log.Warn("snapshots disabled, cannot create %s: %v", dir, err)
+			m.dir = ""
+		} else if policy.SnapshotEvery > 0 {
+			go m.snapshotLoop()
+		}
+	}
+	return m
+}
+
+/* Get returns the index of key at version, loading or building it when missing or stale */
+func (m *Manager) Get(ctx context.Context, key string, version time.Time, load Loader) (*Index, error) {
+	for {
+		m.mu.Lock()
+		if element, ok := m.resident[key]; ok {
+			r := element.Value.(*resident)
+			if r.index.Version().Equal(version) {
+				m.order.MoveToFront(element)
+				m.mu.Unlock()
+				return r.index, nil
+			}
+			m.evict(element, false)
+		}
+		if b, ok := m.building[key]; ok {
+			m.mu.Unlock()
+			select {
+			case <-b.done:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+			if b.err != nil {
+				return nil, b.err
+			}
+			if b.index.Version().Equal(version) {
+				return b.index, nil
+			}
+			continue
+		}
+		b := &build{done: make(chan struct{})}
+		m.building[key] = b
+		m.mu.Unlock()
+
+		b.index, b.err = m.open(ctx, key, version, load)
+
+		m.mu.Lock()
+		delete(m.building, key)
+		if b.err == nil {
+			m.admit(key, b.index)
+		}
+		m.mu.Unlock()
+		close(b.done)
+		return b.index, b.err
+	}
+}
+
+/* open prefers a snapshot written at version and builds from the database otherwise */
+func (m *Manager) open(ctx context.Context, key string, version time.Time, load Loader) (*Index, error) {
+	if idx := m.readSnapshot(key); idx != nil && idx.Version().Equal(version) {
+		m.metrics.snapshotLoaded()
+		return idx, nil
+	}
+
+	started := time.Now()
+	loadedVersion, entries, err := load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	idx := NewIndex(m.policy.Params, loadedVersion, entries)
+	m.metrics.built(time.Since(started))
+	return idx, nil
+}
+
+/*
+Update applies a write this process made to a resident index, moving it from version from to
+version to. An index at any other version missed a write and is dropped instead.
+*/
+func (m *Manager) Update(key string, from, to time.Time, apply func(*Index)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	element, ok := m.resident[key]
+	if !ok {
+		return
+	}
+	r := element.Value.(*resident)
+	if !r.index.Version().Equal(from) {
+		m.evict(element, false)
+		return
+	}
+
+	apply(r.index)
+	r.index.mu.Lock()
+	r.index.version = to
+	r.index.dirty = true
+	r.index.mu.Unlock()
+
+	size := r.index.Bytes()
+	m.bytes += size - r.bytes
+	r.bytes = size
+	m.trim()
+	m.metrics.resize(m.order.Len(), m.bytes)
+}
+
+/* Drop forgets key, in memory and on disk, after its context is deleted */
+func (m *Manager) Drop(key string) {
+	m.mu.Lock()
+	if element, ok := m.resident[key]; ok {
+		m.evict(element, false)
+	}
+	m.mu.Unlock()
+
+	if m.dir != "" {
+		if err := os.Remove(m.snapshotPath(key)); err != nil && !os.IsNotExist(err) {
+			log.Warn("could not remove snapshot of %s: %v", key, err)
+		}
+	}
+}
+
+/* Search answers from idx and records latency; a sample of searches is also answered exactly to track recall */
+func (m *Manager) Search(idx *Index, query []float64, k int, accept func(Item) bool) []Hit {
+	started := time.Now()
+	hits := idx.Search(query, k, accept)
+	m.metrics.searched(time.Since(started))
+
+	if m.policy.RecallSample > 0 && rand.Float64() < m.policy.RecallSample {
+		go func() {
+			exact := idx.Exact(query, k, accept)
+			m.metrics.recall(hits, exact)
+		}()
+	}
+	return hits
+}
+
+/* Metrics exposes the manager's counters */
+func (m *Manager) Metrics() *Metrics {
+	return m.metrics
+}
+
+/* admit makes idx resident and evicts past the budget; callers hold m.mu */
+func (m *Manager) admit(key string, idx *Index) {
+	if element, ok := m.resident[key]; ok {
+		m.evict(element, false)
+	}
+	r := &resident{key: key, index: idx, bytes: idx.Bytes()}
+	m.resident[key] = m.order.PushFront(r)
+	m.bytes += r.bytes
+	m.trim()
+	m.metrics.resize(m.order.Len(), m.bytes)
+
+	if m.dir != "" && idx.isDirty() {
+		go m.writeSnapshot(key, idx)
+	}
+}
+
+/* trim evicts cold indexes until the budget holds, always keeping the most recent one; callers hold m.mu */
+func (m *Manager) trim() {
+	for m.bytes > m.policy.MaxBytes && m.order.Len() > 1 {
+		m.evict(m.order.Back(), true)
+	}
+}
+
+/* evict removes a resident index, snapshotting it first when it changed; callers hold m.mu */
+func (m *Manager) evict(element *list.Element, cold bool) {
+	r := element.Value.(*resident)
+	m.order.Remove(element)
+	delete(m.resident, r.key)
+	m.bytes -= r.bytes
+	m.metrics.resize(m.order.Len(), m.bytes)
+
+	if cold {
+		m.metrics.evicted()
+		if m.dir != "" && r.index.isDirty() {
+			go m.writeSnapshot(r.key, r.index)
+		}
+	}
+}
+
+func (m *Manager) snapshotLoop() {
+	ticker := time.NewTicker(m.policy.SnapshotEvery)
+	defer ticker.Stop()
+	for range ticker.C {
+		m.mu.Lock()
+		var dirty []*resident
+		for element := m.order.Front(); element != nil; element = element.Next() {
+			if r := element.Value.(*resident); r.index.isDirty() {
+				dirty = append(dirty, r)
+			}
+		}
+		m.metrics.resize(m.order.Len(), m.bytes)
+		m.mu.Unlock()
+
+		for _, r := range dirty {
+			m.writeSnapshot(r.key, r.index)
+		}
+	}
+}
+
+/* writeSnapshot writes to a temporary file and renames it so readers never see a partial snapshot */
+func (m *Manager) writeSnapshot(key string, idx *Index) {
+	path := m.snapshotPath(key)
+	tmp, err := os.CreateTemp(m.dir, filepath.Base(path)+".*.tmp")
+	if err != nil {
+		log.Warn("could not snapshot %s: %v", key, err)
+		return
+	}
+	defer os.Remove(tmp.Name())
+
+	/* Clear first: a write racing with the encode marks the index dirty again */
+	idx.setDirty(false)
+	err = idx.writeSnapshot(tmp, key)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		idx.setDirty(true)
+		log.Warn("could not snapshot %s: %v", key, err)
+	}
+}
+
+func (m *Manager) readSnapshot(key string) *Index {
+	if m.dir == "" {
+		return nil
+	}
+	file, err := os.Open(m.snapshotPath(key))
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	idx, err := readSnapshot(file, key, m.policy.Params)
+	if err != nil {
+		log.Warn("ignoring snapshot of %s: %v", key, err)
+		return nil
+	}
+	return idx
+}
+
+func (m *Manager) snapshotPath(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(m.dir, hex.EncodeToString(sum[:16])+".hnsw")
+}
+
+func (idx *Index) isDirty() bool {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return idx.dirty
+}
+
+func (idx *Index) setDirty(dirty bool) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.dirty = dirty
+}
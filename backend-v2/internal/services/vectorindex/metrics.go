@@ -0,0 +1,146 @@
+package vectorindex
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+/* latencyBuckets are the upper bounds, in seconds, of the search latency histogram */
+var latencyBuckets = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 1}
+
+/* Metrics counts searches, recall samples, builds and evictions for the Prometheus endpoint */
+type Metrics struct {
+	mu sync.Mutex
+
+	searches      uint64
+	latencyCounts []uint64
+	latencySum    float64
+
+	recallSamples uint64
+	recallSum     float64
+
+	builds        uint64
+	buildSeconds  float64
+	snapshotLoads uint64
+	evictions     uint64
+
+	residentIndexes int
+	residentBytes   int64
+}
+
+func newMetrics() *Metrics {
+	return &Metrics{latencyCounts: make([]uint64, len(latencyBuckets))}
+}
+
+func (m *Metrics) searched(elapsed time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	seconds := elapsed.Seconds()
+	m.searches++
+	m.latencySum += seconds
+	for i, bound := range latencyBuckets {
+		if seconds <= bound {
+			m.latencyCounts[i]++
+		}
+	}
+}
+
+/* recall records which share of the exact top-k the approximate search found */
+func (m *Metrics) recall(approximate, exact []Hit) {
+	if len(exact) == 0 {
+		return
+	}
+	found := make(map[string]bool, len(approximate))
+	for _, hit := range approximate {
+		found[hit.ID] = true
+	}
+	matched := 0
+	for _, hit := range exact {
+		if found[hit.ID] {
+			matched++
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.recallSamples++
+	m.recallSum += float64(matched) / float64(len(exact))
+}
+
+func (m *Metrics) built(elapsed time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.builds++
+	m.buildSeconds += elapsed.Seconds()
+}
+
+func (m *Metrics) snapshotLoaded() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.snapshotLoads++
+}
+
+func (m *Metrics) evicted() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.evictions++
+}
+
+func (m *Metrics) resize(indexes int, bytes int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.residentIndexes = indexes
+	m.residentBytes = bytes
+}
+
+/* Recall is the mean sampled recall, 1 before any sample */
+func (m *Metrics) Recall() float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.recallSamples == 0 {
+		return 1
+	}
+	return m.recallSum / float64(m.recallSamples)
+}
+
+/* WriteMetrics writes the counters in the Prometheus text format */
+func (m *Metrics) WriteMetrics(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fmt.Fprint(w, "# HELP vector_index_search_seconds Approximate nearest-neighbour search latency.\n")
+	fmt.Fprint(w, "# TYPE vector_index_search_seconds histogram\n")
+	for i, bound := range latencyBuckets {
+		fmt.Fprintf(w, "vector_index_search_seconds_bucket{le=\"%g\"} %d\n", bound, m.latencyCounts[i])
+	}
+	fmt.Fprintf(w, "vector_index_search_seconds_bucket{le=\"+Inf\"} %d\n", m.searches)
+	fmt.Fprintf(w, "vector_index_search_seconds_sum %g\n", m.latencySum)
+	fmt.Fprintf(w, "vector_index_search_seconds_count %d\n", m.searches)
+
+	fmt.Fprint(w, "# HELP vector_index_recall Recall@k of sampled searches against an exact scan.\n")
+	fmt.Fprint(w, "# TYPE vector_index_recall summary\n")
+	fmt.Fprintf(w, "vector_index_recall_sum %g\n", m.recallSum)
+	fmt.Fprintf(w, "vector_index_recall_count %d\n", m.recallSamples)
+
+	fmt.Fprint(w, "# HELP vector_index_builds_total Indexes built from the database.\n")
+	fmt.Fprint(w, "# TYPE vector_index_builds_total counter\n")
+	fmt.Fprintf(w, "vector_index_builds_total %d\n", m.builds)
+	fmt.Fprint(w, "# HELP vector_index_build_seconds_total Time spent building indexes.\n")
+	fmt.Fprint(w, "# TYPE vector_index_build_seconds_total counter\n")
+	fmt.Fprintf(w, "vector_index_build_seconds_total %g\n", m.buildSeconds)
+	fmt.Fprint(w, "# HELP vector_index_snapshot_loads_total Indexes loaded from snapshots.\n")
+	fmt.Fprint(w, "# TYPE vector_index_snapshot_loads_total counter\n")
+	fmt.Fprintf(w, "vector_index_snapshot_loads_total %d\n", m.snapshotLoads)
+	fmt.Fprint(w, "# HELP vector_index_evictions_total Cold indexes evicted to stay within the memory budget.\n")
+	fmt.Fprint(w, "# TYPE vector_index_evictions_total counter\n")
+	fmt.Fprintf(w, "vector_index_evictions_total %d\n", m.evictions)
+
+	fmt.Fprint(w, "# HELP vector_index_resident Indexes held in memory.\n")
+	fmt.Fprint(w, "# TYPE vector_index_resident gauge\n")
+	fmt.Fprintf(w, "vector_index_resident %d\n", m.residentIndexes)
+	fmt.Fprint(w, "# HELP vector_index_resident_bytes Estimated memory held by resident indexes.\n")
+	fmt.Fprint(w, "# TYPE vector_index_resident_bytes gauge\n")
+	fmt.Fprintf(w, "vector_index_resident_bytes %d\n", m.residentBytes)
+}
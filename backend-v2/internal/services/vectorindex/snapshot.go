@@ -0,0 +1,109 @@
+package vectorindex
+
+import (
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+/* snapshotFormat is bumped whenever the encoded layout changes; older files are rebuilt */
+const snapshotFormat = 1
+
+type snapshotNode struct {
+	ID     string
+	Type   string
+	Source string
+	/* Metadata is JSON: gob cannot encode arbitrary interface values without registering them */
+	Metadata []byte
+	Vector   []float32
+	Links    [][]int32
+	Deleted  bool
+}
+
+type snapshotGraph struct {
+	Dim      int
+	Entry    int32
+	MaxLevel int
+	Nodes    []snapshotNode
+}
+
+type snapshot struct {
+	Format  int
+	Key     string
+	Version time.Time
+	Params  Params
+	Graphs  []snapshotGraph
+}
+
+/* writeSnapshot encodes the index under a read lock; key guards against hash collisions on load */
+func (idx *Index) writeSnapshot(w io.Writer, key string) error {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	s := snapshot{Format: snapshotFormat, Key: key, Version: idx.version, Params: idx.params}
+	for _, dim := range idx.dims() {
+		g := idx.graphs[dim]
+		sg := snapshotGraph{Dim: dim, Entry: g.entry, MaxLevel: g.maxLevel, Nodes: make([]snapshotNode, len(g.nodes))}
+		for i, n := range g.nodes {
+			metadata, err := json.Marshal(n.item.Metadata)
+			if err != nil {
+				return err
+			}
+			sg.Nodes[i] = snapshotNode{
+				ID: n.item.ID, Type: n.item.Type, Source: n.item.Source, Metadata: metadata,
+				Vector: n.vector, Links: n.links, Deleted: n.deleted,
+			}
+		}
+		s.Graphs = append(s.Graphs, sg)
+	}
+	return gob.NewEncoder(w).Encode(&s)
+}
+
+/* readSnapshot decodes an index written for key; params must match or the graphs are rebuilt */
+func readSnapshot(r io.Reader, key string, params Params) (*Index, error) {
+	var s snapshot
+	if err := gob.NewDecoder(r).Decode(&s); err != nil {
+		return nil, err
+	}
+	if s.Format != snapshotFormat || s.Key != key || s.Params != params.withDefaults() {
+		return nil, fmt.Errorf("snapshot does not match this index")
+	}
+
+	idx := &Index{params: s.Params, version: s.Version, graphs: map[int]*graph{}}
+	for _, sg := range s.Graphs {
+		g := newGraph(s.Params, sg.Dim)
+		g.entry, g.maxLevel = sg.Entry, sg.MaxLevel
+		g.nodes = make([]*node, len(sg.Nodes))
+		for i, sn := range sg.Nodes {
+			var metadata map[string]interface{}
+			if err := json.Unmarshal(sn.Metadata, &metadata); err != nil {
+				return nil, err
+			}
+			if len(sn.Vector) != sg.Dim || int(sg.Entry) >= len(sg.Nodes) {
+				return nil, fmt.Errorf("snapshot graph %d is corrupt", sg.Dim)
+			}
+			g.nodes[i] = &node{
+				item:    Item{ID: sn.ID, Type: sn.Type, Source: sn.Source, Metadata: metadata},
+				vector:  sn.Vector,
+				links:   sn.Links,
+				deleted: sn.Deleted,
+			}
+			if !sn.Deleted {
+				g.live++
+			}
+		}
+		for _, n := range g.nodes {
+			for _, links := range n.links {
+				for _, id := range links {
+					if id < 0 || int(id) >= len(g.nodes) {
+						return nil, fmt.Errorf("snapshot graph %d is corrupt", sg.Dim)
+					}
+				}
+			}
+		}
+		idx.graphs[sg.Dim] = g
+	}
+	return idx, nil
+}
@@ -0,0 +1,279 @@
+package vectorindex
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func randomEntries(n, dim int, seed int64) []Entry {
+	rng := rand.New(rand.NewSource(seed))
+	entries := make([]Entry, n)
+	for i := range entries {
+		embedding := make([]float64, dim)
+		for j := range embedding {
+			embedding[j] = rng.NormFloat64()
+		}
+		entries[i] = Entry{
+			Item:      Item{ID: fmt.Sprintf("%06d", i), Type: "openai", Source: fmt.Sprintf("doc-%d", i%10), Metadata: map[string]interface{}{"even": i%2 == 0}},
+			Embedding: embedding,
+		}
+	}
+	return entries
+}
+
+func recallOf(approximate, exact []Hit) float64 {
+	found := map[string]bool{}
+	for _, hit := range approximate {
+		found[hit.ID] = true
+	}
+	matched := 0
+	for _, hit := range exact {
+		if found[hit.ID] {
+			matched++
+		}
+	}
+	return float64(matched) / float64(len(exact))
+}
+
+func TestIndex_RecallAgainstExactScan(t *testing.T) {
+	entries := randomEntries(3000, 24, 1)
+	idx := NewIndex(Params{}, time.Time{}, entries)
+	queries := randomEntries(50, 24, 2)
+
+	total := 0.0
+	for _, query := range queries {
+		approximate := idx.Search(query.Embedding, 10, nil)
+		exact := idx.Exact(query.Embedding, 10, nil)
+		if len(approximate) != 10 || len(exact) != 10 {
+			t.Fatalf("got %d approximate and %d exact hits, want 10", len(approximate), len(exact))
+		}
+		for i := 1; i < len(approximate); i++ {
+			if approximate[i].Score > approximate[i-1].Score {
+				t.Fatal("hits must be ordered best first")
+			}
+		}
+		total += recallOf(approximate, exact)
+	}
+	if recall := total / float64(len(queries)); recall < 0.9 {
+		t.Errorf("mean recall@10 = %.3f, want at least 0.9", recall)
+	}
+}
+
+func TestIndex_FiltersAndDimensions(t *testing.T) {
+	entries := randomEntries(1000, 16, 3)
+	entries = append(entries, Entry{Item: Item{ID: "small"}, Embedding: []float64{1, 0, 0}})
+	entries = append(entries, Entry{Item: Item{ID: "zero"}, Embedding: []float64{0, 0, 0}})
+	idx := NewIndex(Params{}, time.Time{}, entries)
+
+	onlySource := func(item Item) bool { return item.Source == "doc-3" }
+	hits := idx.Search(entries[3].Embedding, 5, onlySource)
+	if len(hits) != 5 || hits[0].ID != "000003" {
+		t.Fatalf("filtered hits = %v, want 5 from doc-3 led by the query itself", hits)
+	}
+	for _, hit := range hits {
+		if hit.Source != "doc-3" {
+			t.Errorf("hit %s from %s passed the source filter", hit.ID, hit.Source)
+		}
+	}
+
+	/* A filter only one vector passes still finds it */
+	single := idx.Search(entries[500].Embedding, 3, func(item Item) bool { return item.ID == "000777" })
+	if len(single) != 1 || single[0].ID != "000777" {
+		t.Errorf("single-match hits = %v", single)
+	}
+
+	if hits := idx.Search([]float64{0, 2, 0}, 5, nil); len(hits) != 1 || hits[0].ID != "small" {
+		t.Errorf("3-dimensional hits = %v, want only the 3-dimensional vector", hits)
+	}
+	if idx.Len() != 1001 {
+		t.Errorf("Len() = %d, want the zero vector skipped", idx.Len())
+	}
+}
+
+func TestIndex_RemoveAndCompact(t *testing.T) {
+	entries := randomEntries(600, 8, 4)
+	idx := NewIndex(Params{}, time.Time{}, entries)
+
+	removed := idx.Remove(func(item Item) bool { return item.Metadata["even"] == true })
+	if removed != 300 || idx.Len() != 300 {
+		t.Fatalf("Remove() = %d leaving %d, want 300 and 300", removed, idx.Len())
+	}
+	if nodes := len(idx.graphs[8].nodes); nodes != 300 {
+		t.Errorf("graph holds %d nodes, want it compacted to the 300 live ones", nodes)
+	}
+	for _, hit := range idx.Search(entries[0].Embedding, 20, nil) {
+		if hit.Metadata["even"] == true {
+			t.Errorf("removed item %s returned", hit.ID)
+		}
+	}
+
+	idx.Remove(func(Item) bool { return true })
+	if len(idx.graphs) != 0 || idx.Search(entries[0].Embedding, 5, nil) != nil {
+		t.Error("an emptied dimension should be dropped")
+	}
+}
+
+func TestSnapshot_RoundTrip(t *testing.T) {
+	version := time.Date(2026, 10, 1, 12, 0, 0, 123000000, time.UTC)
+	idx := NewIndex(Params{}, version, randomEntries(400, 12, 5))
+	idx.Remove(func(item Item) bool { return item.ID == "000001" })
+
+	var buf bytes.Buffer
+	if err := idx.writeSnapshot(&buf, "user/notes"); err != nil {
+		t.Fatalf("writeSnapshot() error = %v", err)
+	}
+	encoded := buf.Bytes()
+
+	restored, err := readSnapshot(bytes.NewReader(encoded), "user/notes", Params{})
+	if err != nil {
+		t.Fatalf("readSnapshot() error = %v", err)
+	}
+	if !restored.Version().Equal(version) || restored.Len() != idx.Len() {
+		t.Errorf("restored version %v with %d vectors, want %v with %d", restored.Version(), restored.Len(), version, idx.Len())
+	}
+
+	query := randomEntries(1, 12, 6)[0].Embedding
+	want, got := idx.Search(query, 10, nil), restored.Search(query, 10, nil)
+	for i := range want {
+		if got[i].ID != want[i].ID || got[i].Metadata["even"] != want[i].Metadata["even"] {
+			t.Fatalf("restored hits differ: %v vs %v", got[i], want[i])
+		}
+	}
+
+	if _, err := readSnapshot(bytes.NewReader(encoded), "user/other", Params{}); err == nil {
+		t.Error("a snapshot must not load under another key")
+	}
+	if _, err := readSnapshot(bytes.NewReader(encoded), "user/notes", Params{M: 8}); err == nil {
+		t.Error("a snapshot must not load under other graph parameters")
+	}
+}
+
+func TestManager_BuildsOnceAndFollowsVersions(t *testing.T) {
+	manager := NewManager(DefaultPolicy(), "")
+	v1 := time.Unix(100, 0)
+	v2 := time.Unix(200, 0)
+
+	var loads atomic.Int32
+	load := func(version time.Time) Loader {
+		return func(context.Context) (time.Time, []Entry, error) {
+			loads.Add(1)
+			return version, randomEntries(50, 4, 7), nil
+		}
+	}
+
+	idx, err := manager.Get(context.Background(), "k", v1, load(v1))
+	if err != nil || idx.Len() != 50 {
+		t.Fatalf("Get() = %v, %v", idx, err)
+	}
+	if again, _ := manager.Get(context.Background(), "k", v1, load(v1)); again != idx || loads.Load() != 1 {
+		t.Error("a resident index at the same version must be reused")
+	}
+
+	/* A write made here moves the index along without a rebuild */
+	manager.Update("k", v1, v2, func(idx *Index) {
+		idx.Add([]Entry{{Item: Item{ID: "new"}, Embedding: []float64{1, 2, 3, 4}}})
+	})
+	if again, _ := manager.Get(context.Background(), "k", v2, load(v2)); again != idx || idx.Len() != 51 || loads.Load() != 1 {
+		t.Error("Update should keep the index current")
+	}
+
+	/* A write from elsewhere shows up as a newer version and forces a rebuild */
+	v3 := time.Unix(300, 0)
+	manager.Update("k", v1, v3, func(*Index) { t.Error("a stale update must not be applied") })
+	if rebuilt, _ := manager.Get(context.Background(), "k", v3, load(v3)); rebuilt == idx || loads.Load() != 2 {
+		t.Error("a version mismatch should rebuild the index")
+	}
+}
+
+func TestManager_EvictsColdIndexesAndReloadsSnapshots(t *testing.T) {
+	policy := DefaultPolicy()
+	policy.RecallSample = 0
+	policy.SnapshotEvery = 0
+	probe := NewIndex(policy.Params, time.Time{}, randomEntries(200, 16, 8))
+	policy.MaxBytes = probe.Bytes() * 3 / 2
+
+	dir := t.TempDir()
+	manager := NewManager(policy, dir)
+	version := time.Unix(100, 0)
+	var loads atomic.Int32
+	load := func(context.Context) (time.Time, []Entry, error) {
+		loads.Add(1)
+		return version, randomEntries(200, 16, 8), nil
+	}
+
+	for _, key := range []string{"a", "b"} {
+		if _, err := manager.Get(context.Background(), key, version, load); err != nil {
+			t.Fatalf("Get(%s) error = %v", key, err)
+		}
+	}
+	var out strings.Builder
+	manager.Metrics().WriteMetrics(&out)
+	if !strings.Contains(out.String(), "vector_index_resident 1\n") || !strings.Contains(out.String(), "vector_index_evictions_total 1\n") {
+		t.Errorf("metrics after eviction:\n%s", out.String())
+	}
+
+	/* Snapshots are written in the background after a build */
+	deadline := time.Now().Add(5 * time.Second)
+	for manager.readSnapshot("a") == nil && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, err := manager.Get(context.Background(), "a", version, load); err != nil || loads.Load() != 2 {
+		t.Errorf("evicted index should come back from its snapshot, loads = %d, err = %v", loads.Load(), err)
+	}
+
+	manager.Drop("a")
+	if manager.readSnapshot("a") != nil {
+		t.Error("Drop should remove the snapshot")
+	}
+}
+
+func TestManager_SearchRecordsMetrics(t *testing.T) {
+	policy := DefaultPolicy()
+	policy.RecallSample = 1
+	manager := NewManager(policy, "")
+	idx := NewIndex(policy.Params, time.Time{}, randomEntries(300, 8, 9))
+
+	manager.Search(idx, randomEntries(1, 8, 10)[0].Embedding, 5, nil)
+
+	deadline := time.Now().Add(5 * time.Second)
+	var out strings.Builder
+	for time.Now().Before(deadline) {
+		out.Reset()
+		manager.Metrics().WriteMetrics(&out)
+		if strings.Contains(out.String(), "vector_index_recall_count 1\n") {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	for _, want := range []string{"vector_index_search_seconds_count 1\n", "vector_index_recall_count 1\n"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("metrics missing %q:\n%s", want, out.String())
+		}
+	}
+	if recall := manager.Metrics().Recall(); recall <= 0 || recall > 1 {
+		t.Errorf("Recall() = %v", recall)
+	}
+}
+
+func TestParsePolicy(t *testing.T) {
+	policy, err := ParsePolicy("bytes=1048576, m=8, ef=32, recallSample=0.1, snapshotEvery=30s")
+	if err != nil {
+		t.Fatalf("ParsePolicy() error = %v", err)
+	}
+	if policy.MaxBytes != 1<<20 || policy.M != 8 || policy.EfSearch != 32 || policy.EfConstruction != 200 ||
+		policy.RecallSample != 0.1 || policy.SnapshotEvery != 30*time.Second {
+		t.Errorf("ParsePolicy() = %+v", policy)
+	}
+
+	for _, spec := range []string{"bytes", "m=1", "recallSample=2", "colour=blue", "ef=x"} {
+		if _, err := ParsePolicy(spec); err == nil {
+			t.Errorf("ParsePolicy(%q) should fail", spec)
+		}
+	}
+}
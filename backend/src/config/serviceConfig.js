@@ -91,6 +91,11 @@ export const webScraperConfig = {
   userAgent: env.USER_AGENT || 'Delta5-Bot/1.0',
 }
 
+/* Integration Secrets Configuration, shared with backend-v2: "id:base64key,..." with the active key first */
+export const integrationSecretsConfig = {
+  encryptionKeys: env.INTEGRATION_ENCRYPTION_KEYS || '',
+}
+
 /* Export complete service configuration */
 export const serviceConfig = {
   mode: serviceMode,
@@ -104,4 +109,5 @@ export const serviceConfig = {
   zoom: zoomConfig,
   freepik: freepikConfig,
   webScraper: webScraperConfig,
+  integrationSecrets: integrationSecretsConfig,
 }
@@ -8,6 +8,7 @@ import {validateLang} from './utils/validateLang'
 import {LANGUAGES, MODELS, USER_DEFAULT_LANGUAGE, USER_DEFAULT_MODEL} from '../shared/config/constants'
 import {PhraseChunkBuilderV2, scrapeFiles, fetchAsString} from './utils/scrape'
 import LLMVector from '../models/LLMVector'
+import {ensureDataKey, isMasked, maskIntegration, openIntegration, sealService} from './utils/integrationSecrets'
 
 const IntegrationController = {
   authorization: async (ctx, next) => {
@@ -22,21 +23,22 @@ const IntegrationController = {
   getAll: async ctx => {
     const {userId} = ctx.state
 
-    const integration = await Integration.findOne({userId})
+    const integration = await Integration.findOne({userId}).lean()
     if (!integration) {
       ctx.throw(404, 'Integration not found')
     }
-    ctx.body = integration
+    // Keys leave masked, as from backend-v2, which alone reveals them
+    ctx.body = maskIntegration(openIntegration(integration))
   },
   getService: async ctx => {
     const {userId} = ctx.state
     const {service} = ctx.params
 
-    const integration = await Integration.findOne({userId}, {[service]: 1, _id: 0})
+    const integration = await Integration.findOne({userId}, {[service]: 1, encryption: 1, _id: 0}).lean()
     if (!integration) {
       ctx.throw(404, 'Integration for the called application was not found')
     }
-    ctx.body = integration
+    ctx.body = maskIntegration(openIntegration(integration))
   },
   updateService: async ctx => {
     const {userId} = ctx.state
@@ -47,30 +49,26 @@ const IntegrationController = {
       ctx.throw(400, 'Something is wrong with the provided data')
     }
 
-    let updateVectors = false
-    let vectors = await LLMVector.findOne({userId, name: null})
-
-    if (!vectors) {
-      vectors = new LLMVector({
-        userId,
-        name: null,
-        store: {
-          [service]: {},
-        },
-      })
-      updateVectors = true
-    } else {
-      if (!vectors.store.has(service)) {
-        vectors.store.set(service, {})
-        updateVectors = true
+    // Clients round-trip the masked document; a masked key means "keep the stored one"
+    if (isMasked(integration.apiKey)) {
+      const stored = await Integration.findOne({userId}, {[service]: 1}).lean()
+      if (!stored?.[service]?.apiKey) {
+        ctx.throw(400, 'API key is masked and no stored key exists; provide the full key')
       }
+      integration.apiKey = stored[service].apiKey
     }
 
-    if (updateVectors) {
-      await vectors.save()
-    }
+    // The default context lists the service as an (empty) type, as backend-v2 EnsureType does
+    const now = new Date()
+    const vectors = await LLMVector.findOneAndUpdate(
+      {userId, name: null},
+      {$setOnInsert: {createdAt: now, updatedAt: now}, $addToSet: {types: service}},
+      {upsert: true, new: true},
+    )
 
-    const update = {$set: {userId, [service]: integration}}
+    // API keys are encrypted with the document's data key before they reach Mongo, as backend-v2 does
+    const dataKey = integration.apiKey ? await ensureDataKey(Integration, userId) : null
+    const update = {$set: {userId, [service]: sealService(integration, dataKey)}}
     const options = {upsert: true}
     await Integration.updateOne({userId}, update, options)
 
@@ -1,4 +1,5 @@
 import Integration from '../../../../../models/Integration'
+import {openIntegration} from '../../../../utils/integrationSecrets'
 import {YandexGPT, YandexGPTEmbeddings} from './YandexGPT'
 import {
   getClaudeMaxTokens,
@@ -60,7 +61,7 @@ export const getIntegrationSettings = async userId => {
     throw Error('Integration not found')
   }
 
-  return settings
+  return openIntegration(settings)
 }
 
 export const getLLM = ({type, settings, log}) => {
@@ -1,16 +1,59 @@
+import crypto from 'crypto'
+import mongoose from 'mongoose'
 import {MemoryVectorStore} from '@langchain/classic/vectorstores/memory'
 import {RecursiveCharacterTextSplitter} from '@langchain/textsplitters'
 import LLMVector from './../../../../../../models/LLMVector'
+import LLMVectorChunk from './../../../../../../models/LLMVectorChunk'
 import {DEFAULT_CONTEXT_NAME} from './../../../../constants/ext'
 import {EmbStorageType} from '../../../../../../shared/config/constants'
 
 const DEFAULT_CHUNK_SIZE = 8191
 const TOKEN_PER_MINUTE_MAX = 150000
+// Reads are recorded at most this often, as backend-v2 does
+const TOUCH_EVERY_MS = 60 * 1000
 
 const encodeKey = key => {
   return key.replace(/[^a-zA-Z0-9]/g, '_')
 }
 
+// Same hash backend-v2 records to skip repeated content
+const contentHash = content => crypto.createHash('sha256').update(content).digest('hex')
+
+const mismatch = message => {
+  const error = new Error(`embedding mismatch: ${message}`)
+  error.code = 400
+
+  return error
+}
+
+// Checks that incoming embeddings can sit beside stored ones; a missing model agrees with any model
+const agree = (stored, incoming) => {
+  if (stored.dimension !== incoming.dimension) {
+    throw mismatch(`type "${stored.type}" holds ${stored.dimension}-dimension embeddings, got ${incoming.dimension}`)
+  }
+  if (stored.model && incoming.model && stored.model !== incoming.model) {
+    throw mismatch(`type "${stored.type}" holds embeddings from "${stored.model}", got "${incoming.model}"`)
+  }
+}
+
+// Model and dimension the chunks' embeddings share, null when none has an embedding
+const specOf = (type, chunks) => {
+  let spec = null
+  chunks.forEach(({model, dimension}) => {
+    if (!dimension) {
+      return
+    }
+    const next = {type, model, dimension}
+    if (!spec) {
+      spec = next
+      return
+    }
+    agree(spec, next)
+  })
+
+  return spec
+}
+
 export class ExtVectorStore {
   constructor({
     userId,
@@ -30,6 +73,7 @@ export class ExtVectorStore {
     this.contextName = contextName
     this.chunkSize = chunkSize || DEFAULT_CHUNK_SIZE
     this.storageType = storageType
+    this.embeddingModel = embeddings?.model || undefined
 
     this.memoryVectorStore = new MemoryVectorStore(embeddings)
     this.splitter = new RecursiveCharacterTextSplitter({
@@ -37,10 +81,14 @@ export class ExtVectorStore {
     })
   }
 
+  get contextKey() {
+    return this.contextName === DEFAULT_CONTEXT_NAME ? null : this.contextName
+  }
+
   async setVectors() {
     const context = await LLMVector.findOne({
       userId: this.userId,
-      name: this.contextName === DEFAULT_CONTEXT_NAME ? null : this.contextName,
+      name: this.contextKey,
     }).lean()
 
     if (!context) {
@@ -50,9 +98,12 @@ export class ExtVectorStore {
       throw error
     }
 
+    await this.touch(context)
+
     const vectors = []
 
-    const tStore = context.store[this.storageType]
+    // Contexts saved before the chunk split keep their vectors in the nested store until migrated
+    const tStore = context.store?.[this.storageType]
 
     if (tStore) {
       Object.entries(tStore).forEach(([, newVectors]) => {
@@ -60,9 +111,111 @@ export class ExtVectorStore {
       })
     }
 
+    const chunks = await LLMVectorChunk.find({
+      userId: this.userId,
+      context: this.contextKey,
+      type: this.storageType,
+    })
+      .sort({source: 1, _id: 1})
+      .lean()
+
+    chunks.forEach(({content, embedding, metadata}) => {
+      vectors.push({content, embedding, metadata})
+    })
+
     this.memoryVectorStore.memoryVectors = vectors
   }
 
+  // Documents whose content their source does not hold yet, without repeats; only stored hashes count
+  async skipHeld(docs) {
+    const keyed = docs.map(doc => ({
+      doc,
+      source: encodeKey(doc.metadata.source[0] || 'main'),
+      hash: contentHash(doc.pageContent),
+    }))
+    const held = await LLMVectorChunk.find(
+      {
+        userId: this.userId,
+        context: this.contextKey,
+        type: this.storageType,
+        source: {$in: [...new Set(keyed.map(({source}) => source))]},
+        hash: {$in: [...new Set(keyed.map(({hash}) => hash))]},
+      },
+      {source: 1, hash: 1},
+    ).lean()
+
+    const seen = new Set(held.map(({source, hash}) => `${source}\0${hash}`))
+    return keyed
+      .filter(({source, hash}) => {
+        const key = `${source}\0${hash}`
+        if (seen.has(key)) {
+          return false
+        }
+        seen.add(key)
+        return true
+      })
+      .map(({doc}) => doc)
+  }
+
+  // The header's spec of the type, else one read off a chunk stored before specs were recorded
+  async storedSpec(context) {
+    const spec = context.embeddings?.find(({type}) => type === this.storageType)
+    if (spec) {
+      return {type: spec.type, model: spec.model, dimension: spec.dimension}
+    }
+
+    const chunk = await LLMVectorChunk.findOne(
+      {userId: this.userId, context: this.contextKey, type: this.storageType, 'embedding.0': {$exists: true}},
+      {embedding: 1, model: 1},
+    ).lean()
+    if (!chunk) {
+      return null
+    }
+
+    return {type: this.storageType, model: chunk.model, dimension: chunk.embedding.length}
+  }
+
+  // Records the type's spec: the incoming one on replace or when there was none, the stored one otherwise
+  async recordSpec(context, stored, incoming, replacing) {
+    let spec = stored
+    if (replacing || !stored) {
+      spec = incoming
+    } else if (!stored.model && incoming?.model) {
+      spec = {...stored, model: incoming.model}
+    }
+
+    const recorded = context.embeddings?.find(({type}) => type === this.storageType)
+    if (!spec && !recorded) {
+      return
+    }
+    if (spec && recorded && spec.model === recorded.model && spec.dimension === recorded.dimension) {
+      return
+    }
+
+    await LLMVector.updateOne({_id: context._id}, {$pull: {embeddings: {type: this.storageType}}})
+    if (spec) {
+      await LLMVector.updateOne({_id: context._id}, {$push: {embeddings: spec}})
+    }
+  }
+
+  // Records a read so a context with a retention TTL is not removed while it is in use
+  async touch(context) {
+    const now = new Date()
+    if (context.lastUsedAt && now - context.lastUsedAt < TOUCH_EVERY_MS) {
+      return
+    }
+
+    const stale = new Date(now.getTime() - TOUCH_EVERY_MS)
+    try {
+      await LLMVector.updateOne(
+        {_id: context._id, $or: [{lastUsedAt: {$exists: false}}, {lastUsedAt: {$lt: stale}}]},
+        {$set: {lastUsedAt: now}},
+      )
+    } catch (e) {
+      console.error('Failed to record use of vector context', {context: context._id, error: e})
+    }
+  }
+
   async getRelevantData(query, maxChunks, similarityThreshold) {
     let docs = await this.memoryVectorStore.similaritySearchWithScore(query, maxChunks)
 
@@ -106,29 +259,12 @@ export class ExtVectorStore {
       throw new Error('Each vector must have content and non-empty hrefs array')
     }
 
-    let context = await LLMVector.findOne({
-      userId: this.userId,
-      name: this.contextName === DEFAULT_CONTEXT_NAME ? null : this.contextName,
-    })
-
-    if (!context) {
-      context = new LLMVector({
-        userId: this.userId,
-        name: this.contextName === DEFAULT_CONTEXT_NAME ? null : this.contextName,
-        store: {},
-      })
-    }
-
-    if (!context.store.get(this.storageType)) {
-      context.store.set(this.storageType, new Map())
-    }
-
     const totalTextLength = vectors.reduce((acc, curr) => acc + curr.content.length, 0)
     const totalTextSizeInKB = (totalTextLength / 1024).toFixed(2)
     this.log('Summarized length of text:', totalTextLength)
     this.log('Total text size in KB:', totalTextSizeInKB)
 
-    const docs = []
+    let docs = []
 
     await Promise.all(
       vectors.map(async ({content, hrefs}) => {
@@ -137,6 +273,13 @@ export class ExtVectorStore {
       }),
     )
 
+    // Appends skip content their source already holds before paying to embed it, as backend-v2 does
+    if (keep && docs.length) {
+      const split = docs.length
+      docs = await this.skipHeld(docs)
+      this.log('Vectors already stored:', split - docs.length)
+    }
+
     if (docs.length) {
       const maxDocs = Math.floor(TOKEN_PER_MINUTE_MAX / DEFAULT_CHUNK_SIZE)
 
@@ -150,26 +293,65 @@ export class ExtVectorStore {
         }
       }
 
-      const tStore = context.store.get(this.storageType)
+      const now = new Date()
+      const context = await LLMVector.findOneAndUpdate(
+        {userId: this.userId, name: this.contextKey},
+        {$setOnInsert: {createdAt: now, updatedAt: now}},
+        {upsert: true, new: true},
+      )
 
-      if (!keep) {
-        tStore.clear()
+      // Every chunk inserted below gets a larger ObjectId than cutoff
+      const cutoff = new mongoose.Types.ObjectId()
+      const chunks = this.memoryVectors.map(({content, embedding, metadata}) => ({
+        userId: this.userId,
+        context: this.contextKey,
+        type: this.storageType,
+        source: encodeKey(metadata.source[0] || 'main'),
+        content,
+        embedding,
+        ...(this.embeddingModel && embedding?.length && {model: this.embeddingModel}),
+        ...(embedding?.length && {dimension: embedding.length}),
+        ...(content && {hash: contentHash(content)}),
+        metadata,
+      }))
+
+      // Appends must match the model and dimension the type already holds, as in backend-v2
+      const incoming = specOf(this.storageType, chunks)
+      const stored = keep ? await this.storedSpec(context) : null
+      if (stored && incoming) {
+        agree(stored, incoming)
       }
 
-      for (const doc of this.memoryVectors) {
-        const {source: hrefs} = doc.metadata
-        const source = encodeKey(hrefs[0] || 'main')
+      await LLMVectorChunk.insertMany(chunks)
 
-        if (tStore.has(source)) {
-          const existing = tStore.get(source) || []
-          tStore.set(source, [...existing, doc])
-        } else {
-          tStore.set(source, [doc])
-        }
+      // Replacing drops older vectors only after the new ones are in, so readers never see the type empty
+      if (!keep) {
+        await LLMVectorChunk.deleteMany({
+          userId: this.userId,
+          context: this.contextKey,
+          type: this.storageType,
+          _id: {$lte: cutoff},
+        })
+        await LLMVector.updateOne(
+          {_id: context._id},
+          {$pull: {sources: {type: this.storageType}}, $unset: {[`store.${this.storageType}`]: ''}},
+        )
       }
 
-      context.markModified('store')
-      await context.save()
+      await this.recordSpec(context, stored, incoming, !keep)
+
+      // backend-v2 keys its indexes on updatedAt, so it moves only once the chunks are written
+      const sources = [...new Set(chunks.map(({source}) => source))]
+      await LLMVector.updateOne(
+        {_id: context._id},
+        {
+          $set: {updatedAt: new Date()},
+          $addToSet: {
+            types: this.storageType,
+            sources: {$each: sources.map(source => ({type: this.storageType, source}))},
+          },
+        },
+      )
     }
   }
 }
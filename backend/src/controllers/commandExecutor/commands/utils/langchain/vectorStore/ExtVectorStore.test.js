@@ -1,12 +1,15 @@
+import crypto from 'crypto'
 import {ExtVectorStore} from './ExtVectorStore'
 import {MemoryVectorStore} from '@langchain/classic/vectorstores/memory'
 import {RecursiveCharacterTextSplitter} from '@langchain/textsplitters'
 import LLMVector from '../../../../../../models/LLMVector'
+import LLMVectorChunk from '../../../../../../models/LLMVectorChunk'
 import {EmbStorageType} from '../../../../../../shared/config/constants'
 
 jest.mock('@langchain/classic/vectorstores/memory')
 jest.mock('@langchain/textsplitters')
 jest.mock('../../../../../../models/LLMVector')
+jest.mock('../../../../../../models/LLMVectorChunk')
 
 describe('ExtVectorStore', () => {
   const userId = 'testUser'
@@ -33,19 +36,18 @@ describe('ExtVectorStore', () => {
       ]),
     }))
 
-    LLMVector.findOne.mockResolvedValue(null)
-    LLMVector.mockImplementation(() => ({
-      save: jest.fn().mockResolvedValue(undefined),
-      markModified: jest.fn(),
-      store: new Map(),
-      clear: jest.fn(),
-    }))
+    LLMVector.findOneAndUpdate.mockResolvedValue({_id: 'contextId'})
+    LLMVector.updateOne.mockResolvedValue(undefined)
+    LLMVectorChunk.insertMany.mockResolvedValue(undefined)
+    LLMVectorChunk.deleteMany.mockResolvedValue(undefined)
+    LLMVectorChunk.findOne.mockReturnValue({lean: jest.fn().mockResolvedValue(null)})
+    LLMVectorChunk.find.mockReturnValue({lean: jest.fn().mockResolvedValue([])})
 
     extVectorStore = new ExtVectorStore({userId, embeddings, log})
   })
 
   describe('load', () => {
-    it('should create a new context and initialize storageType if no context exists', async () => {
+    it('should upsert the context and store each vector as a chunk', async () => {
       const mockVectors = [
         {
           content: 'test content',
@@ -53,18 +55,119 @@ describe('ExtVectorStore', () => {
         },
       ]
 
-      await extVectorStore.load(mockVectors)
+      const mockVector = {
+        content: 'test content',
+        embedding: [0.234234, 0.324234],
+        metadata: {source: ['test.href']},
+      }
 
-      expect(LLMVector.findOne).toHaveBeenCalledWith({
-        userId,
-        name: null,
+      jest.spyOn(extVectorStore.memoryVectorStore, 'addDocuments').mockImplementation(() => {
+        extVectorStore.memoryVectorStore.memoryVectors = [mockVector]
+      })
+
+      await extVectorStore.load(mockVectors, true)
+
+      expect(LLMVector.findOneAndUpdate).toHaveBeenCalledWith(
+        {userId, name: null},
+        expect.objectContaining({$setOnInsert: expect.any(Object)}),
+        {upsert: true, new: true},
+      )
+      expect(LLMVectorChunk.insertMany).toHaveBeenCalledWith([
+        {
+          userId,
+          context: null,
+          type: EmbStorageType.openai,
+          source: 'test_href',
+          ...mockVector,
+          dimension: 2,
+          hash: crypto.createHash('sha256').update('test content').digest('hex'),
+        },
+      ])
+      expect(LLMVector.updateOne).toHaveBeenCalledWith(
+        {_id: 'contextId'},
+        {$push: {embeddings: {type: EmbStorageType.openai, model: undefined, dimension: 2}}},
+      )
+      expect(LLMVectorChunk.deleteMany).not.toHaveBeenCalled()
+      expect(LLMVector.findOneAndUpdate.mock.calls[0][1].$set).toBeUndefined()
+      expect(LLMVector.updateOne).toHaveBeenLastCalledWith(
+        {_id: 'contextId'},
+        {
+          $set: {updatedAt: expect.any(Date)},
+          $addToSet: {
+            types: EmbStorageType.openai,
+            sources: {$each: [{type: EmbStorageType.openai, source: 'test_href'}]},
+          },
+        },
+      )
+    })
+
+    it('should skip content its source already holds when appending', async () => {
+      const hash = crypto.createHash('sha256').update('test content').digest('hex')
+      RecursiveCharacterTextSplitter.mockImplementation(() => ({
+        createDocuments: jest.fn().mockResolvedValue([
+          {pageContent: 'test content', metadata: {source: ['testHref']}},
+          {pageContent: 'new content', metadata: {source: ['testHref']}},
+          {pageContent: 'new content', metadata: {source: ['testHref']}},
+        ]),
+      }))
+      LLMVectorChunk.find.mockReturnValue({lean: jest.fn().mockResolvedValue([{source: 'testHref', hash}])})
+      extVectorStore = new ExtVectorStore({userId, embeddings, log})
+      const added = []
+      jest.spyOn(extVectorStore.memoryVectorStore, 'addDocuments').mockImplementation(async docs => {
+        added.push(...docs)
       })
 
-      const createdContext = LLMVector.mock.results[0].value
+      await extVectorStore.load([{content: 'test content new content', hrefs: ['testHref']}], true)
+
+      expect(LLMVectorChunk.find).toHaveBeenCalledWith(
+        expect.objectContaining({source: {$in: ['testHref']}, hash: {$in: expect.arrayContaining([hash])}}),
+        {source: 1, hash: 1},
+      )
+      expect(added).toEqual([{pageContent: 'new content', metadata: {source: ['testHref']}}])
+    })
+
+    it('should refuse to append embeddings of another dimension', async () => {
+      LLMVector.findOneAndUpdate.mockResolvedValue({
+        _id: 'contextId',
+        embeddings: [{type: EmbStorageType.openai, model: 'text-embedding-3-small', dimension: 1536}],
+      })
+      jest.spyOn(extVectorStore.memoryVectorStore, 'addDocuments').mockImplementation(() => {
+        extVectorStore.memoryVectorStore.memoryVectors = [
+          {content: 'test content', embedding: [0.1, 0.2], metadata: {source: ['testHref']}},
+        ]
+      })
+
+      await expect(extVectorStore.load([{content: 'test content', hrefs: ['testHref']}], true)).rejects.toThrow(
+        'embedding mismatch',
+      )
+      expect(LLMVectorChunk.insertMany).not.toHaveBeenCalled()
+    })
+
+    it('should record the embedding model of the store', async () => {
+      extVectorStore = new ExtVectorStore({userId, embeddings: {model: 'text-embedding-3-small'}, log})
+      jest.spyOn(extVectorStore.memoryVectorStore, 'addDocuments').mockImplementation(() => {
+        extVectorStore.memoryVectorStore.memoryVectors = [
+          {content: 'test content', embedding: [0.1, 0.2], metadata: {source: ['testHref']}},
+        ]
+      })
+
+      await extVectorStore.load([{content: 'test content', hrefs: ['testHref']}], true)
+
+      expect(LLMVectorChunk.insertMany).toHaveBeenCalledWith([
+        expect.objectContaining({model: 'text-embedding-3-small', dimension: 2}),
+      ])
+    })
+
+    it('should not touch the database when there is nothing to store', async () => {
+      RecursiveCharacterTextSplitter.mockImplementation(() => ({
+        createDocuments: jest.fn().mockResolvedValue([]),
+      }))
+      extVectorStore = new ExtVectorStore({userId, embeddings, log})
+
+      await extVectorStore.load([{content: 'test content', hrefs: ['testHref']}])
 
-      expect(createdContext.save).toHaveBeenCalled()
-      expect(createdContext.markModified).toHaveBeenCalledWith('store')
-      expect(createdContext.store.get(EmbStorageType.openai)).toBeInstanceOf(Map)
+      expect(LLMVector.findOneAndUpdate).not.toHaveBeenCalled()
+      expect(LLMVectorChunk.insertMany).not.toHaveBeenCalled()
     })
 
     it('should throw an error if vectors is not an array', async () => {
@@ -85,35 +188,7 @@ describe('ExtVectorStore', () => {
       )
     })
 
-    it('should create clear context if keep false', async () => {
-      const mockVectors = [
-        {
-          content: 'test content',
-          hrefs: ['testHref'],
-        },
-      ]
-
-      const store = new Map([
-        [
-          EmbStorageType.openai,
-          new Map([
-            [
-              'id',
-              {
-                content: 'some content',
-                embedding: [0.4234231324],
-              },
-            ],
-          ]),
-        ],
-      ])
-
-      LLMVector.findOne.mockImplementation(() => ({
-        save: jest.fn().mockResolvedValue(undefined),
-        markModified: jest.fn(),
-        store,
-      }))
-
+    it('should replace older vectors of the type if keep false', async () => {
       const mockVector = {
         content: 'test content',
         embedding: [0.234234, 0.324234],
@@ -124,58 +199,65 @@ describe('ExtVectorStore', () => {
         extVectorStore.memoryVectorStore.memoryVectors = [mockVector]
       })
 
-      await extVectorStore.load(mockVectors, false)
-
-      expect(Array.from(store.get(EmbStorageType.openai).entries())).toEqual([
-        [
-          'testHref',
-          [
-            {
-              content: 'test content',
-              embedding: [0.234234, 0.324234],
-              metadata: {source: ['testHref']},
-            },
-          ],
-        ],
-      ])
+      await extVectorStore.load([{content: 'test content', hrefs: ['testHref']}], false)
+
+      expect(LLMVectorChunk.deleteMany).toHaveBeenCalledWith({
+        userId,
+        context: null,
+        type: EmbStorageType.openai,
+        _id: {$lte: expect.anything()},
+      })
+      expect(LLMVector.updateOne).toHaveBeenCalledWith(
+        {_id: 'contextId'},
+        {$pull: {sources: {type: EmbStorageType.openai}}, $unset: {[`store.${EmbStorageType.openai}`]: ''}},
+      )
+      expect(LLMVectorChunk.deleteMany.mock.invocationCallOrder[0]).toBeGreaterThan(
+        LLMVectorChunk.insertMany.mock.invocationCallOrder[0],
+      )
     })
+  })
 
-    it('should keep existing context if keep true', async () => {
-      const mockVectors = [
-        {
-          content: 'test content',
-          hrefs: ['testHref1'],
-        },
-      ]
+  describe('setVectors', () => {
+    const mockQuery = result => ({lean: jest.fn().mockResolvedValue(result)})
 
-      const existingVector = {
-        content: 'some content',
-        embedding: [0.4234231324],
-      }
-      const store = new Map([[EmbStorageType.openai, new Map([['testHref1', [existingVector]]])]])
+    it('should merge unmigrated nested vectors with chunks', async () => {
+      const legacyVector = {content: 'legacy', embedding: [0.1]}
+      LLMVector.findOne.mockReturnValue(mockQuery({store: {[EmbStorageType.openai]: {old: [legacyVector]}}}))
+      const sort = jest.fn().mockReturnValue(
+        mockQuery([{_id: 'id', userId, content: 'chunk', embedding: [0.2], metadata: {source: ['a']}}]),
+      )
+      LLMVectorChunk.find.mockReturnValue({sort})
 
-      LLMVector.findOne.mockImplementation(() => ({
-        save: jest.fn().mockResolvedValue(undefined),
-        markModified: jest.fn(),
-        store,
-      }))
+      await extVectorStore.setVectors()
 
-      const mockVector = {
-        content: 'test content',
-        embedding: [0.234234, 0.324234],
-        metadata: {source: ['testHref2']},
-      }
+      expect(LLMVectorChunk.find).toHaveBeenCalledWith({userId, context: null, type: EmbStorageType.openai})
+      expect(sort).toHaveBeenCalledWith({source: 1, _id: 1})
+      expect(extVectorStore.memoryVectorStore.memoryVectors).toEqual([
+        legacyVector,
+        {content: 'chunk', embedding: [0.2], metadata: {source: ['a']}},
+      ])
+    })
 
-      jest.spyOn(extVectorStore.memoryVectorStore, 'addDocuments').mockImplementation(() => {
-        extVectorStore.memoryVectorStore.memoryVectors = [mockVector]
-      })
+    it('should record the read at most once a minute', async () => {
+      LLMVectorChunk.find.mockReturnValue({sort: jest.fn().mockReturnValue(mockQuery([]))})
 
-      await extVectorStore.load(mockVectors, true)
+      LLMVector.findOne.mockReturnValue(mockQuery({_id: 'contextId', lastUsedAt: new Date(Date.now() - 5 * 60 * 1000)}))
+      await extVectorStore.setVectors()
+      expect(LLMVector.updateOne).toHaveBeenCalledWith(
+        expect.objectContaining({_id: 'contextId'}),
+        {$set: {lastUsedAt: expect.any(Date)}},
+      )
 
-      expect(Array.from(store.get(EmbStorageType.openai).entries())).toEqual([
-        ['testHref1', [existingVector]],
-        ['testHref2', [mockVector]],
-      ])
+      LLMVector.updateOne.mockClear()
+      LLMVector.findOne.mockReturnValue(mockQuery({_id: 'contextId', lastUsedAt: new Date()}))
+      await extVectorStore.setVectors()
+      expect(LLMVector.updateOne).not.toHaveBeenCalled()
+    })
+
+    it('should throw if the context does not exist', async () => {
+      LLMVector.findOne.mockReturnValue(mockQuery(null))
+
+      await expect(extVectorStore.setVectors()).rejects.toThrow("Context doesn't exists")
     })
   })
 })
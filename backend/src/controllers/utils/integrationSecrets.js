@@ -0,0 +1,176 @@
+import crypto from 'crypto'
+import {integrationSecretsConfig} from '../../config/serviceConfig'
+
+/*
+ * Reads and writes provider API keys that backend-v2 stores with envelope encryption.
+ * Keys look like "enc:v1:" + base64(nonce | AES-256-GCM ciphertext | tag), sealed with a
+ * per-document data key; the data key is sealed the same way with a master key from
+ * INTEGRATION_ENCRYPTION_KEYS and stored in the document's `encryption` field.
+ * Plaintext keys pass through unchanged, so both formats work during the migration.
+ */
+
+export const SEALED_PREFIX = 'enc:v1:'
+
+const KEY_SIZE = 32
+const NONCE_SIZE = 12
+const TAG_SIZE = 16
+
+const SERVICES = ['openai', 'yandex', 'claude', 'perplexity', 'qwen', 'deepseek', 'custom_llm', 'local']
+
+/* parseKeyring reads "id:base64key[,id:base64key...]" into a Map of id to key */
+export const parseKeyring = spec => {
+  const keys = new Map()
+
+  for (const entry of (spec || '').split(',')) {
+    const trimmed = entry.trim()
+    if (!trimmed) {
+      continue
+    }
+
+    const separator = trimmed.indexOf(':')
+    const id = separator > 0 ? trimmed.slice(0, separator) : ''
+    const key = Buffer.from(trimmed.slice(separator + 1), 'base64')
+    if (!id || keys.has(id) || key.length !== KEY_SIZE) {
+      throw new Error(`Invalid INTEGRATION_ENCRYPTION_KEYS entry "${id || trimmed.slice(0, 8)}"`)
+    }
+    keys.set(id, key)
+  }
+
+  return keys
+}
+
+let keyring = null
+
+const getKeyring = () => {
+  if (!keyring) {
+    keyring = parseKeyring(integrationSecretsConfig.encryptionKeys)
+  }
+  return keyring
+}
+
+const decrypt = (key, encoded) => {
+  const raw = Buffer.from(encoded, 'base64')
+  if (raw.length < NONCE_SIZE + TAG_SIZE) {
+    throw new Error('Malformed ciphertext')
+  }
+
+  const decipher = crypto.createDecipheriv('aes-256-gcm', key, raw.subarray(0, NONCE_SIZE))
+  decipher.setAuthTag(raw.subarray(raw.length - TAG_SIZE))
+  return Buffer.concat([decipher.update(raw.subarray(NONCE_SIZE, raw.length - TAG_SIZE)), decipher.final()])
+}
+
+const encrypt = (key, plaintext) => {
+  const nonce = crypto.randomBytes(NONCE_SIZE)
+  const cipher = crypto.createCipheriv('aes-256-gcm', key, nonce)
+  const ciphertext = Buffer.concat([cipher.update(plaintext), cipher.final()])
+  return Buffer.concat([nonce, ciphertext, cipher.getAuthTag()]).toString('base64')
+}
+
+export const isSealed = value => typeof value === 'string' && value.startsWith(SEALED_PREFIX)
+
+/*
+ * openIntegration returns a copy of a lean Integration document with its API keys decrypted
+ * and the `encryption` field removed. It throws when a key is sealed but cannot be opened.
+ */
+export const openIntegration = (doc, keys = getKeyring()) => {
+  if (!doc) {
+    return doc
+  }
+
+  const {encryption, ...opened} = doc
+  const sealed = SERVICES.filter(service => isSealed(doc[service]?.apiKey))
+  if (!sealed.length) {
+    return opened
+  }
+
+  const masterKey = encryption && keys.get(encryption.keyId)
+  if (!masterKey) {
+    throw new Error(`Integration ${doc.userId} has encrypted keys but no usable data key`)
+  }
+
+  const dataKey = decrypt(masterKey, encryption.dataKey)
+  for (const service of sealed) {
+    const apiKey = decrypt(dataKey, doc[service].apiKey.slice(SEALED_PREFIX.length)).toString('utf8')
+    opened[service] = {...doc[service], apiKey}
+  }
+  return opened
+}
+
+/*
+ * ensureDataKey returns the data key of the user's integration document, creating the document
+ * and its key when needed. As in backend-v2's EnsureDataKey, a new key is only set while the
+ * document has none and is then read back, so concurrent writers seal with the same key.
+ * A key wrapped by a retired master key is re-wrapped with the active one.
+ * Returns null when INTEGRATION_ENCRYPTION_KEYS is not set.
+ */
+export const ensureDataKey = async (Integration, userId, keys = getKeyring()) => {
+  if (!keys.size) {
+    return null
+  }
+
+  const [activeId, activeKey] = keys.entries().next().value
+  const wrapped = encrypt(activeKey, crypto.randomBytes(KEY_SIZE))
+  await Integration.updateOne({userId}, {$setOnInsert: {userId}}, {upsert: true})
+  await Integration.updateOne(
+    {userId, encryption: {$exists: false}},
+    {$set: {encryption: {keyId: activeId, dataKey: wrapped}}},
+  )
+
+  const {encryption} = (await Integration.findOne({userId}, {encryption: 1}).lean()) || {}
+  const masterKey = encryption && keys.get(encryption.keyId)
+  if (!masterKey) {
+    throw new Error(`Integration ${userId} has no usable data key`)
+  }
+
+  const dataKey = decrypt(masterKey, encryption.dataKey)
+  if (encryption.keyId !== activeId) {
+    await Integration.updateOne(
+      {userId, 'encryption.keyId': encryption.keyId},
+      {$set: {encryption: {keyId: activeId, dataKey: encrypt(activeKey, dataKey)}}},
+    )
+  }
+  return dataKey
+}
+
+/* sealService returns a copy of a service config with its plaintext apiKey encrypted under dataKey */
+export const sealService = (config, dataKey) => {
+  const apiKey = config?.apiKey
+  if (!dataKey || typeof apiKey !== 'string' || !apiKey || isSealed(apiKey)) {
+    return config
+  }
+  return {...config, apiKey: SEALED_PREFIX + encrypt(dataKey, Buffer.from(apiKey, 'utf8'))}
+}
+
+// Masked keys start with MASK_PREFIX, which no provider key does, as in backend-v2's apikey package
+export const MASK_PREFIX = '****'
+
+const MASK_VISIBLE_CHARS = 4
+const MASK_MIN_LENGTH = 12
+
+/* maskKey hides an API key, keeping the last 4 characters of keys long enough to stay unguessable */
+export const maskKey = key => {
+  if (!key) {
+    return key
+  }
+  if (key.length < MASK_MIN_LENGTH) {
+    return MASK_PREFIX
+  }
+  return MASK_PREFIX + key.slice(-MASK_VISIBLE_CHARS)
+}
+
+export const isMasked = key => typeof key === 'string' && key.startsWith(MASK_PREFIX)
+
+/* maskIntegration returns a copy of an opened Integration document with every API key masked for clients */
+export const maskIntegration = doc => {
+  if (!doc) {
+    return doc
+  }
+
+  const masked = {...doc}
+  for (const service of SERVICES) {
+    if (typeof doc[service]?.apiKey === 'string') {
+      masked[service] = {...doc[service], apiKey: maskKey(doc[service].apiKey)}
+    }
+  }
+  return masked
+}
@@ -0,0 +1,99 @@
+import crypto from 'crypto'
+import {
+  ensureDataKey,
+  isMasked,
+  maskIntegration,
+  MASK_PREFIX,
+  openIntegration,
+  parseKeyring,
+  sealService,
+  SEALED_PREFIX,
+} from './integrationSecrets'
+
+/* seal mirrors backend-v2's envelope.Seal: base64(nonce | ciphertext | tag) */
+const seal = (key, plaintext) => {
+  const nonce = crypto.randomBytes(12)
+  const cipher = crypto.createCipheriv('aes-256-gcm', key, nonce)
+  const ciphertext = Buffer.concat([cipher.update(plaintext), cipher.final()])
+  return Buffer.concat([nonce, ciphertext, cipher.getAuthTag()]).toString('base64')
+}
+
+describe('integrationSecrets', () => {
+  const masterKey = crypto.randomBytes(32)
+  const dataKey = crypto.randomBytes(32)
+  const keys = parseKeyring(`k1:${masterKey.toString('base64')}`)
+
+  it('parses the keyring and rejects malformed entries', () => {
+    expect(keys.get('k1')).toEqual(masterKey)
+    expect(parseKeyring('').size).toBe(0)
+    expect(() => parseKeyring('k1')).toThrow()
+    expect(() => parseKeyring('k1:c2hvcnQ=')).toThrow()
+  })
+
+  it('decrypts sealed keys and passes plaintext keys through', () => {
+    const doc = {
+      userId: 'alice',
+      openai: {apiKey: SEALED_PREFIX + seal(dataKey, 'sk-secret'), model: 'gpt-4'},
+      claude: {apiKey: 'plain-key'},
+      encryption: {keyId: 'k1', dataKey: seal(masterKey, dataKey)},
+    }
+
+    expect(openIntegration(doc, keys)).toEqual({
+      userId: 'alice',
+      openai: {apiKey: 'sk-secret', model: 'gpt-4'},
+      claude: {apiKey: 'plain-key'},
+    })
+    expect(doc.openai.apiKey.startsWith(SEALED_PREFIX)).toBe(true)
+  })
+
+  it('fails when the master key is unknown', () => {
+    const doc = {
+      userId: 'alice',
+      openai: {apiKey: SEALED_PREFIX + seal(dataKey, 'sk-secret')},
+      encryption: {keyId: 'retired', dataKey: seal(masterKey, dataKey)},
+    }
+
+    expect(() => openIntegration(doc, keys)).toThrow('no usable data key')
+  })
+
+  it('seals keys so they open again', () => {
+    const sealed = sealService({apiKey: 'sk-secret', model: 'gpt-4'}, dataKey)
+    expect(sealed.apiKey.startsWith(SEALED_PREFIX)).toBe(true)
+    expect(sealService(sealed, dataKey)).toBe(sealed)
+    expect(sealService({apiKey: 'sk-secret'}, null)).toEqual({apiKey: 'sk-secret'})
+
+    const doc = {userId: 'alice', openai: sealed, encryption: {keyId: 'k1', dataKey: seal(masterKey, dataKey)}}
+    expect(openIntegration(doc, keys).openai).toEqual({apiKey: 'sk-secret', model: 'gpt-4'})
+  })
+
+  it('masks keys but the last 4 characters of long ones', () => {
+    const masked = maskIntegration({
+      userId: 'alice',
+      openai: {apiKey: 'sk-proj-1234567890abcd', model: 'gpt-4'},
+      claude: {apiKey: 'short'},
+    })
+    expect(masked.openai).toEqual({apiKey: `${MASK_PREFIX}abcd`, model: 'gpt-4'})
+    expect(masked.claude.apiKey).toBe(MASK_PREFIX)
+    expect(isMasked(masked.openai.apiKey)).toBe(true)
+    expect(isMasked('sk-proj-1234567890abcd')).toBe(false)
+  })
+
+  it('keeps the first data key written for a document', async () => {
+    const stored = {userId: 'alice'}
+    const Integration = {
+      updateOne: jest.fn(async (filter, update) => {
+        if (filter.encryption && stored.encryption) {
+          return
+        }
+        Object.assign(stored, update.$set || {})
+      }),
+      findOne: jest.fn(() => ({lean: async () => stored})),
+    }
+
+    const first = await ensureDataKey(Integration, 'alice', keys)
+    const second = await ensureDataKey(Integration, 'alice', keys)
+    expect(second).toEqual(first)
+    expect(stored.encryption.keyId).toBe('k1')
+    expect(await ensureDataKey(Integration, 'alice', new Map())).toBeNull()
+  })
+})
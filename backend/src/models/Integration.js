@@ -80,6 +80,15 @@ const CustomLLM = createSchema(
   {_id: false, timestamps: false},
 )
 
+/* Wrapped data key backend-v2 encrypts the API keys with; see controllers/utils/integrationSecrets */
+const Encryption = createSchema(
+  {
+    keyId: String,
+    dataKey: String,
+  },
+  {_id: false, timestamps: false},
+)
+
 const IntegrationSchema = createSchema({
   userId: {type: String, required: true, index: true},
   openai: Openai,
@@ -92,6 +101,7 @@ const IntegrationSchema = createSchema({
   lang: {type: String, default: 'none'},
   model: {type: String, default: 'auto'},
   perplexity: Perplexity,
+  encryption: Encryption,
 })
 
 const Integration = mongoose.model('Integration', IntegrationSchema)
@@ -11,9 +11,33 @@ const MemoryVectorSchema = new mongoose.Schema({
   },
 })
 
+const VectorSourceSchema = new mongoose.Schema(
+  {
+    type: {type: String, required: true},
+    source: {type: String, required: true},
+  },
+  {_id: false},
+)
+
+// Model and dimension shared by the embeddings of one type
+const EmbeddingSpecSchema = new mongoose.Schema(
+  {
+    type: {type: String, required: true},
+    model: {type: String},
+    dimension: {type: Number, required: true},
+  },
+  {_id: false},
+)
+
+// Context header; its vectors live one per document in LLMVectorChunk and `types`/`sources` record the layout,
+// `embeddings` the model and dimension each type's embeddings share.
+// `store` only holds vectors saved before the split that are not migrated yet (see backend-v2 cmd/migrate-llmvectors)
 const LLMVectorSchema = new mongoose.Schema({
   userId: {type: String, required: true, index: true},
   name: {type: String, required: false},
+  types: {type: [String], default: undefined},
+  sources: {type: [VectorSourceSchema], default: undefined},
+  embeddings: {type: [EmbeddingSpecSchema], default: undefined},
   store: {
     type: Map,
     of: {
@@ -21,6 +45,10 @@ const LLMVectorSchema = new mongoose.Schema({
       of: [MemoryVectorSchema],
     },
   },
+  createdAt: {type: Date},
+  updatedAt: {type: Date},
+  // Last read or write by a user; a retention TTL counts idle time from the later of this and updatedAt
+  lastUsedAt: {type: Date},
 })
 
 const LLMVector = mongoose.model('LLMVector', LLMVectorSchema)
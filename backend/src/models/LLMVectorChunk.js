@@ -0,0 +1,26 @@
+import mongoose from 'mongoose'
+
+// One vector of an LLMVector context; _id order is append order within a source
+const LLMVectorChunkSchema = new mongoose.Schema(
+  {
+    userId: {type: String, required: true},
+    context: {type: String, default: null},
+    type: {type: String, required: true},
+    source: {type: String, required: true},
+    content: {type: String, required: true},
+    embedding: {type: [Number], default: undefined},
+    model: {type: String},
+    dimension: {type: Number},
+    metadata: {type: mongoose.Schema.Types.Mixed},
+    // SHA-256 of content, so appends can skip repeated content
+    hash: {type: String},
+    legacy: {type: Boolean},
+  },
+  {versionKey: false},
+)
+
+LLMVectorChunkSchema.index({userId: 1, context: 1, type: 1, source: 1, _id: 1})
+
+const LLMVectorChunk = mongoose.model('LLMVectorChunk', LLMVectorChunkSchema, 'llmvectorchunks')
+
+export default LLMVectorChunk